@@ -1,10 +1,6 @@
 package daemon
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
-
 	"github.com/takama/daemon"
 	"github.com/taskcluster/taskcluster-worker/config"
 	"github.com/taskcluster/taskcluster-worker/runtime"
@@ -32,12 +28,7 @@ func (svc *service) Run(monitor runtime.Monitor) (string, error) {
 		return "Could not create worker", err
 	}
 
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigTerm
-		w.StopNow()
-	}()
+	defer w.HandleShutdownSignals()()
 
 	w.Start()
 	return "Worker successfully started", nil
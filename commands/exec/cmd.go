@@ -0,0 +1,205 @@
+// Package exec implements the 'exec' command, which replays a task from a
+// replay bundle written by the worker.
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/taskcluster/taskcluster-worker/commands"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
+	"github.com/taskcluster/taskcluster-worker/runtime/webhookserver"
+	"github.com/taskcluster/taskcluster-worker/worker/taskrun"
+)
+
+func init() {
+	commands.Register("exec", cmd{})
+}
+
+type cmd struct{}
+
+func (cmd) Summary() string {
+	return "Replay a task from a replay bundle"
+}
+
+func (cmd) Usage() string {
+	return `
+taskcluster-worker exec replays a task from a replay bundle, written by the
+worker when a task is resolved exception, see 'worker.replayBundles' in the
+worker configuration.
+
+The engine is created from the engine configuration in the replay bundle, and
+the task payload is executed without plugins, writing the task log to stdout.
+Use --show-log to print the task log and diagnostics from the original run.
+
+Properties that may hold secrets are removed from the engine configuration in
+replay bundles, use --engine-config to replay with a complete configuration.
+
+usage: taskcluster-worker exec [options] <bundle>
+
+options:
+     --show-log              Print log and diagnostics from the original run.
+     --engine-config <file>  File with engine configuration as JSON, instead of
+                             the configuration from the replay bundle.
+     --log-level <level>     Log level debug, info, warning, error [default: warning].
+  -h --help               Show this screen.
+`
+}
+
+func (cmd) Execute(arguments map[string]interface{}) bool {
+	bundleFile := arguments["<bundle>"].(string)
+	showLog := arguments["--show-log"].(bool)
+	logLevel := arguments["--log-level"].(string)
+
+	b, err := taskrun.ReadReplayBundle(bundleFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read replay bundle, error: %s\n", err)
+		return false
+	}
+	if file, ok := arguments["--engine-config"].(string); ok {
+		data, rerr := ioutil.ReadFile(file)
+		if rerr == nil {
+			rerr = json.Unmarshal(data, &b.EngineConfig)
+		}
+		if rerr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read engine configuration, error: %s\n", rerr)
+			return false
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Replaying taskId: %s, runId: %d, originally resolved: %s\n",
+		b.TaskInfo.TaskID, b.TaskInfo.RunID, b.Reason)
+	if showLog {
+		fmt.Fprintf(os.Stderr, "--- Original task log\n%s\n", b.Log)
+		if b.Diagnostics != "" {
+			fmt.Fprintf(os.Stderr, "--- Original diagnostics\n%s\n", b.Diagnostics)
+		}
+		for _, p := range b.Panics {
+			fmt.Fprintf(os.Stderr, "--- Original panic\n%s\n", p)
+		}
+		fmt.Fprintln(os.Stderr, "--- Replay")
+	}
+
+	provider := engines.Engines()[b.Engine]
+	if provider == nil {
+		fmt.Fprintf(os.Stderr, "Engine '%s' from replay bundle is not supported\n", b.Engine)
+		return false
+	}
+
+	monitor := monitoring.NewLoggingMonitor(logLevel, nil, "").WithTag("component", "exec")
+
+	// Create temporary storage and environment
+	tempFolder, err := ioutil.TempDir("", "taskcluster-worker-exec-")
+	if err != nil {
+		monitor.Panic("Failed to create temporary folder, error: ", err)
+	}
+	defer os.RemoveAll(tempFolder)
+	storage, err := runtime.NewTemporaryStorage(tempFolder)
+	if err != nil {
+		monitor.Panic("Failed to create TemporaryStorage, error: ", err)
+	}
+	webhookServer, err := webhookserver.NewTestServer()
+	if err != nil {
+		monitor.Panic("Failed to create webhookserver, error: ", err)
+	}
+	defer webhookServer.Stop()
+	gc := gc.New(tempFolder, 0, 0)
+	environment := &runtime.Environment{
+		Monitor:          monitor,
+		GarbageCollector: gc,
+		TemporaryStorage: storage,
+		WebHookServer:    webhookServer,
+		Worker:           &runtime.LifeCycleTracker{},
+		ProvisionerID:    b.TaskInfo.ProvisionerID,
+		WorkerType:       b.TaskInfo.WorkerType,
+	}
+
+	// Create engine
+	engine, err := provider.NewEngine(engines.EngineOptions{
+		Environment: environment,
+		Monitor:     monitor.WithPrefix("engine").WithTag("engine", b.Engine),
+		Config:      b.EngineConfig,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create engine '%s', error: %s\n", b.Engine, err)
+		return false
+	}
+	defer gc.CollectAll()
+	defer engine.Dispose()
+	if err = engine.PreflightCheck(); err != nil {
+		fmt.Fprintf(os.Stderr, "Engine preflight check failed, error: %s\n", err)
+		return false
+	}
+
+	// Create TaskContext and copy the task log to stdout
+	ctx, control, err := runtime.NewTaskContext(storage.NewFilePath(), b.TaskInfo)
+	if err != nil {
+		monitor.Panic("Failed to create TaskContext, error: ", err)
+	}
+	defer control.Dispose()
+	logReader, err := ctx.NewLogReader()
+	if err != nil {
+		monitor.Panic("Failed to open task log, error: ", err)
+	}
+	logDone := make(chan struct{})
+	go func() {
+		defer close(logDone)
+		io.Copy(os.Stdout, logReader)
+		logReader.Close()
+	}()
+
+	success := run(engine, ctx, b.Payload, monitor)
+
+	control.CloseLog()
+	<-logDone
+	fmt.Fprintf(os.Stderr, "Replay completed, success: %v\n", success)
+	return success
+}
+
+// run executes payload with engine, returning true if the task was successful
+func run(engine engines.Engine, ctx *runtime.TaskContext, payload map[string]interface{}, monitor runtime.Monitor) bool {
+	builder, err := engine.NewSandboxBuilder(engines.SandboxOptions{
+		TaskContext: ctx,
+		Payload:     engine.PayloadSchema().Filter(payload),
+		Monitor:     monitor.WithPrefix("engine"),
+	})
+	if err != nil {
+		ctx.LogError("Failed to create SandboxBuilder, error: ", err)
+		return false
+	}
+	sandbox, err := builder.StartSandbox()
+	if err != nil {
+		builder.Discard()
+		ctx.LogError("Failed to start sandbox, error: ", err)
+		return false
+	}
+
+	// Kill the sandbox on SIGINT or SIGTERM
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-c:
+			ctx.LogError("Received signal, killing sandbox")
+			sandbox.Kill()
+		case <-done:
+		}
+	}()
+	resultSet, err := sandbox.WaitForResult()
+	signal.Stop(c)
+	close(done)
+	if err != nil {
+		ctx.LogError("Sandbox execution failed, error: ", err)
+		return false
+	}
+	defer resultSet.Dispose()
+	return resultSet.Success()
+}
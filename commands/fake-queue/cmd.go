@@ -0,0 +1,121 @@
+package fakequeue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/taskcluster/slugid-go/slugid"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/commands"
+	fq "github.com/taskcluster/taskcluster-worker/worker/workertest/fakequeue"
+)
+
+func init() {
+	commands.Register("fake-queue", cmd{})
+}
+
+type cmd struct{}
+
+func (cmd) Summary() string {
+	return "Run a fake queue for running the worker locally"
+}
+
+func (cmd) Usage() string {
+	return `
+taskcluster-worker fake-queue runs a fake implementation of taskcluster-queue,
+which stores tasks in memory and doesn't validate credentials. This is useful
+for running the worker end-to-end locally, by setting 'queueBaseUrl' in the
+worker config to the URL printed.
+
+The given task definition files are created as tasks when the server starts,
+fields 'created' and 'deadline' default to now and 24 hours from now.
+
+usage: taskcluster-worker fake-queue [options] [<task.json>...]
+
+options:
+  --port <port>         Port to listen on [default: 8080].
+  --artifacts <folder>  Folder to write uploaded artifacts to.
+  -h --help             Show this screen.
+`
+}
+
+func (cmd) Execute(arguments map[string]interface{}) bool {
+	port := arguments["--port"].(string)
+	folder, _ := arguments["--artifacts"].(string)
+	files := arguments["<task.json>"].([]string)
+
+	// Read task definitions before starting the server
+	tasks := make([]queue.TaskDefinitionRequest, len(files))
+	for i, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read task definition '%s', error: %s\n", file, err)
+			return false
+		}
+		if err = json.Unmarshal(data, &tasks[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse task definition '%s', error: %s\n", file, err)
+			return false
+		}
+	}
+
+	var fakeQueue *fq.FakeQueue
+	if folder != "" {
+		fakeQueue = fq.NewWithArtifactFolder(folder)
+	} else {
+		fakeQueue = fq.New()
+	}
+
+	l, err := net.Listen("tcp", "localhost:"+port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to listen on port %s, error: %s\n", port, err)
+		return false
+	}
+	server := &http.Server{Handler: fakeQueue}
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(l)
+	}()
+	baseURL := "http://" + l.Addr().String()
+	fmt.Printf("Fake queue listening on %s\n", baseURL)
+
+	// Create tasks
+	q := queue.New(&tcclient.Credentials{})
+	q.BaseURL = baseURL
+	for i, task := range tasks {
+		if time.Time(task.Created).IsZero() {
+			task.Created = tcclient.Time(time.Now())
+		}
+		if time.Time(task.Deadline).IsZero() {
+			task.Deadline = tcclient.Time(time.Now().Add(24 * time.Hour))
+		}
+		taskID := slugid.Nice()
+		debug("creating task %s from %s", taskID, files[i])
+		if _, err = q.CreateTask(taskID, &task); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create task from '%s', error: %s\n", files[i], err)
+			l.Close()
+			return false
+		}
+		fmt.Printf("Created task %s from %s\n", taskID, files[i])
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-c:
+		signal.Stop(c)
+		l.Close()
+		<-done
+		return true
+	case err = <-done:
+		fmt.Fprintf(os.Stderr, "Fake queue server stopped, error: %s\n", err)
+		return false
+	}
+}
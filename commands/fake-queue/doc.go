@@ -0,0 +1,7 @@
+// Package fakequeue provides a CommandProvider that runs a fake queue
+// server, such that the worker can be run end-to-end locally.
+package fakequeue
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("fakequeue")
@@ -0,0 +1,49 @@
+package networkhelper
+
+import (
+	"os"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/network"
+	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
+)
+
+type cmd struct{}
+
+func (cmd) Summary() string {
+	return "Run privileged network helper for the QEMU engine"
+}
+
+func (cmd) Usage() string {
+	return `taskcluster-worker network-helper sets up tap devices, iptables rules and
+dnsmasq on behalf of an unprivileged worker running the QEMU engine.
+
+This command must run as root, and is started by the worker when the QEMU
+engine is configured with 'networkHelper'. It reads credentials from standard
+input and connects back to the worker, then exits when the worker disconnects,
+removing any networks the worker left behind.
+
+Usage:
+  taskcluster-worker network-helper [options]
+
+Options:
+  --log-level <level>  Log-level of the helper [default: info].
+  -h, --help           Show this screen.
+`
+}
+
+func (cmd) Execute(arguments map[string]interface{}) bool {
+	monitor := monitoring.NewLoggingMonitor(
+		arguments["--log-level"].(string), nil, "",
+	).WithTag("component", "network-helper")
+
+	if os.Geteuid() != 0 {
+		monitor.Error("network-helper must run as root")
+		return false
+	}
+
+	if err := network.ServeHelper(os.Stdin, monitor); err != nil {
+		monitor.Error("network-helper failed, error: ", err)
+		return false
+	}
+	return true
+}
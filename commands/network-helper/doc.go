@@ -0,0 +1,3 @@
+// Package networkhelper implements the privileged helper process that sets up
+// networks for the QEMU engine, when the worker itself runs unprivileged.
+package networkhelper
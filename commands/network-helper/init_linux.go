@@ -0,0 +1,9 @@
+package networkhelper
+
+import "github.com/taskcluster/taskcluster-worker/commands"
+
+func init() {
+	// The QEMU engine networks are only available on linux, so we register it in
+	// a file that ends with _linux.go
+	commands.Register("network-helper", cmd{})
+}
@@ -25,6 +25,7 @@ func buildImage(
 	monitor runtime.Monitor,
 	inputFile, outputFile string,
 	fromImage bool,
+	diskFile, diskFormat string,
 	vncPort int,
 	boot, cdrom string,
 	linuxBootOptions vm.LinuxBootOptions,
@@ -56,7 +57,11 @@ func buildImage(
 
 		// Construct MutableImage
 		monitor.Info("Creating MutableImage")
-		img, err2 = image.NewMutableImage(tempFolder, size, machine)
+		if diskFile != "" {
+			img, err2 = image.NewMutableImageFromDisk(diskFile, diskFormat, tempFolder, size, machine)
+		} else {
+			img, err2 = image.NewMutableImage(tempFolder, size, machine)
+		}
 		if err2 != nil {
 			monitor.Error("Failed to create image, error: ", err2)
 			return err2
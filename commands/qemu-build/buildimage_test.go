@@ -48,7 +48,7 @@ func TestBuildImage(t *testing.T) {
 
 	err = buildImage(
 		monitor, inputImageFile, outputFile,
-		true, vncPort, isofile, cdrom, vm.LinuxBootOptions{}, 1,
+		true, "", "", vncPort, isofile, cdrom, vm.LinuxBootOptions{}, 1,
 	)
 	if err != nil {
 		panic(err)
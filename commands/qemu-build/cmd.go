@@ -19,13 +19,23 @@ taskcluster-worker qemu-build takes a machine definition as JSON or an existing
 image and two ISO files to mounted as CDs and creates a virtual machine that
 will be saved to disk when terminated.
 
+Use 'from-new' to create a blank disk for installing from --boot, 'from-image'
+to modify an existing image, and 'from-disk' to create an image from a disk in
+a format supported by qemu-img, such as qcow2. An install script can be
+given on an ISO file with --cdrom, building is done when the virtual machine
+powers off. Use --vnc to install interactively.
+
 usage:
   taskcluster-worker qemu-build [options] from-new <machine.json> <result.tar.zst>
   taskcluster-worker qemu-build [options] from-image <image.tar.zst> <result.tar.zst>
+  taskcluster-worker qemu-build [options] from-disk <machine.json> <disk> <result.tar.zst>
 
 options:
      --vnc <port>       Expose VNC on given port.
-     --size <size>      Size of the image in GiB [default: 10].
+     --size <size>      Size of the image in GiB, disks given with 'from-disk'
+                        are grown to this size if smaller [default: 10].
+     --format <format>  Format of the disk given with 'from-disk', such as
+                        qcow2 or raw [default: qcow2].
      --boot <file>      File to use as cd-rom 1 and boot medium.
      --cdrom <file>     File to use as cd-rom 2 (drivers etc).
      --kernel <image>   Multi-boot option -kernel for QEMU.
@@ -43,6 +53,7 @@ func (cmd) Execute(arguments map[string]interface{}) bool {
 	outputFile := arguments["<result.tar.zst>"].(string)
 	fromNew := arguments["from-new"].(bool)
 	fromImage := arguments["from-image"].(bool)
+	fromDisk := arguments["from-disk"].(bool)
 	var vncPort int64
 	var err error
 	if vnc, ok := arguments["--vnc"].(string); ok {
@@ -60,22 +71,29 @@ func (cmd) Execute(arguments map[string]interface{}) bool {
 	if size > 80 {
 		monitor.Panic("Images have a sanity limit of 80 GiB!")
 	}
-	if fromNew == fromImage {
+	if !fromNew && !fromImage && !fromDisk {
 		panic("Impossible arguments")
 	}
 
-	var inputFile string
+	var inputFile, diskFile, diskFormat string
 	if !fromImage {
 		inputFile = arguments["<machine.json>"].(string)
 	} else {
 		inputFile = arguments["<image.tar.zst>"].(string)
 	}
+	if fromDisk {
+		diskFile = arguments["<disk>"].(string)
+		diskFormat = arguments["--format"].(string)
+	}
 
 	linuxBootOptions := vm.LinuxBootOptions{}
+	linuxBootOptions.Kernel, _ = arguments["--kernel"].(string)
+	linuxBootOptions.Append, _ = arguments["--append"].(string)
+	linuxBootOptions.Initrd, _ = arguments["--initrd"].(string)
 
 	return buildImage(
 		monitor, inputFile, outputFile,
-		fromImage, int(vncPort),
+		fromImage, diskFile, diskFormat, int(vncPort),
 		boot, cdrom, linuxBootOptions,
 		int(size),
 	) == nil
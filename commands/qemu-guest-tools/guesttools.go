@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -138,20 +139,9 @@ func (g *guestTools) Run() {
 	})
 
 	if err == nil {
-		// kill if 'killed' is done
-		done := make(chan struct{})
-		go func() {
-			select {
-			case <-g.killed.Done():
-				system.KillProcessTree(proc)
-			case <-done:
-			}
-		}()
-
-		if proc.Wait() {
+		if g.waitForProcess(proc, time.Duration(task.Timeout)*time.Second, taskLog) {
 			result = "success"
 		}
-		close(done)
 	}
 
 resolved:
@@ -174,6 +164,38 @@ resolved:
 	}
 }
 
+// waitForProcess waits for proc to exit, killing it if the task is killed or
+// timeout is exceeded, returns true if the process exited successfully.
+// A timeout of zero implies no timeout.
+func (g *guestTools) waitForProcess(proc *system.Process, timeout time.Duration, taskLog io.Writer) bool {
+	var timedOut <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+
+	// kill if 'killed' is done or timeout is exceeded
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-g.killed.Done():
+			system.KillProcessTree(proc)
+		case <-timedOut:
+			fmt.Fprintf(taskLog, "\r\n[taskcluster:error] Command timed out after %s, killing process\r\n", timeout)
+			system.KillProcessTree(proc)
+		case <-done:
+		}
+	}()
+
+	success := proc.Wait()
+	close(done)
+	<-stopped // ensure we don't write to taskLog after returning
+	return success
+}
+
 func (g *guestTools) CreateTaskLog() (io.WriteCloser, <-chan struct{}) {
 	reader, writer := nio.Pipe(buffer.New(4 * 1024 * 1024))
 	req, err := http.NewRequest("POST", g.url("engine/v1/log"), reader)
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/metaservice"
 	"github.com/taskcluster/taskcluster-worker/runtime"
@@ -131,6 +132,66 @@ func TestGuestToolsFailed(t *testing.T) {
 	}
 }
 
+func TestGuestToolsTimeout(t *testing.T) {
+	// Create temporary storage
+	storage, err := runtime.NewTemporaryStorage(os.TempDir())
+	if err != nil {
+		panic("Failed to create TemporaryStorage")
+	}
+	environment := &runtime.Environment{
+		TemporaryStorage: storage,
+		Monitor:          mocks.NewMockMonitor(true),
+		ProvisionerID:    "dummy-provisioner",
+		WorkerType:       "dummy-worker",
+		WorkerGroup:      "dummy-tests",
+		WorkerID:         "localhost",
+	}
+
+	// platform specific command that runs longer than the timeout
+	command := []string{"sh", "-c", "echo \"$TEST_TEXT\" && sleep 20 && true"}
+	if rt.GOOS == "windows" {
+		command = []string{`c:\Windows\system32\cmd.exe`, "/C", "echo %TEST_TEXT% && timeout /t 20 && exit 0"}
+	}
+
+	// Setup a new MetaService
+	logTask := bytes.NewBuffer(nil)
+	result := false
+	var resolved atomics.Once
+	s := metaservice.New(command, map[string]string{
+		"TEST_TEXT": "Hello world",
+	}, logTask, func(r bool) {
+		if !resolved.Do(func() { result = r }) {
+			panic("It shouldn't be possible to resolve twice")
+		}
+	}, environment)
+	s.SetCommandTimeout(1 * time.Second)
+
+	// Create http server for testing
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		panic("Expected a url we can parse")
+	}
+
+	// Create an run guest-tools
+	g := new(config{}, u.Host, mocks.NewMockMonitor(true))
+	started := time.Now()
+	g.Run()
+
+	// Check the state
+	resolved.Wait()
+	if result {
+		t.Error("Expected the metadata to get failed result")
+	}
+	if time.Since(started) > 15*time.Second {
+		t.Error("Expected the command to be killed when the timeout was exceeded")
+	}
+	if !strings.Contains(logTask.String(), "Command timed out after 1s") {
+		t.Error("Got unexpected taskLog: '", logTask.String(), "'")
+	}
+}
+
 func TestGuestToolsLiveLog(t *testing.T) {
 	nowReady := sync.WaitGroup{}
 	nowReady.Add(1)
@@ -1,6 +1,7 @@
 package qemurun
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -98,7 +99,7 @@ func (cmd) Execute(arguments map[string]interface{}) bool {
 
 	// Get an instance of the image
 	monitor.Info("Creating instance of image")
-	image, err := manager.Instance("image", func(target *os.File) error {
+	image, err := manager.Instance("image", func(ctx context.Context, target *os.File) error {
 		f, ferr := os.Open(imageFile)
 		if ferr != nil {
 			return ferr
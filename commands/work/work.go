@@ -1,10 +1,9 @@
 package work
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/taskcluster/taskcluster-worker/commands"
 	"github.com/taskcluster/taskcluster-worker/config"
@@ -24,39 +23,77 @@ func (cmd) Summary() string {
 
 func (cmd) Usage() string {
 	return `Usage:
-  taskcluster-worker work <config.yml>
+  taskcluster-worker work [options] <config.yml>
+
+Options:
+  --profile <name>  Apply the named profile from the config file, such as
+                    'dev' or 'prod', before loading the configuration.
+  --dev-insecure    Run tasks as the current user without isolation, by
+                    running the native engine in insecure development mode.
+                    The worker refuses to claim tasks from a queue that isn't
+                    running on the local machine.
 `
 }
 
 func (cmd) Execute(args map[string]interface{}) bool {
 	monitor := monitoring.PreConfig()
 
-	config, err := config.LoadFromFile(args["<config.yml>"].(string), monitor)
+	profile, _ := args["--profile"].(string)
+	config, err := config.LoadProfileFromFile(args["<config.yml>"].(string), profile, monitor)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return false
 	}
 
+	if devInsecure, _ := args["--dev-insecure"].(bool); devInsecure {
+		if err = enableDevInsecure(config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		fmt.Fprintln(os.Stderr, "WARNING: running in insecure development mode, tasks are not isolated!")
+	}
+
 	w, err := worker.New(config)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return false
 	}
 
-	done := make(chan struct{})
-	go func() {
-		w.Start()
-		close(done)
-	}()
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	select {
-	case <-c:
-		signal.Stop(c)
-		w.StopNow()
-		<-done
-	case <-done:
+	// Stop gracefully on SIGTERM/SIGINT, resolving tasks after grace period
+	stopHandlingSignals := w.HandleShutdownSignals()
+	startErr := w.Start()
+	stopHandlingSignals()
+
+	// Exit with a distinct exit code, if the worker was drained
+	if startErr == nil && w.IsDraining() {
+		os.Exit(worker.ExitCodeDrained)
 	}
 
+	// Exit with a distinct exit code, if the host should be rebooted
+	if startErr == nil && w.IsContaminated() {
+		os.Exit(worker.ExitCodeContaminated)
+	}
 	return true
 }
+
+// enableDevInsecure sets the 'devInsecure' option for the native engine in
+// config, and disables user creation.
+func enableDevInsecure(config interface{}) error {
+	c, ok := config.(map[string]interface{})
+	if !ok || c["engine"] != "native" {
+		return errors.New("--dev-insecure requires the config to use the 'native' engine")
+	}
+	engines, _ := c["engines"].(map[string]interface{})
+	if engines == nil {
+		engines = make(map[string]interface{})
+		c["engines"] = engines
+	}
+	native, _ := engines["native"].(map[string]interface{})
+	if native == nil {
+		native = make(map[string]interface{})
+		engines["native"] = native
+	}
+	native["devInsecure"] = true
+	native["createUser"] = false
+	return nil
+}
@@ -13,6 +13,14 @@
 // In the example above configuration options from `config` will be transformed
 // by the packet, env, and secrets TransformationProviders, in the order given.
 //
+// The config file may also contain named profiles, which are merged into
+// `config` before transformations are applied, when selected with
+// `taskcluster-worker work --profile <name>`:
+//   profiles:
+//    dev:
+//     queueBaseUrl: http://localhost:8080
+//     monitor: {logLevel: debug}
+//
 // After all configured TransformationProviders have run
 // the configuration object constructed will be validated against the config
 // schema required by the 'worker' package.
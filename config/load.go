@@ -6,6 +6,7 @@ import (
 
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
 	"github.com/taskcluster/taskcluster-worker/worker"
 
 	yaml "gopkg.in/yaml.v2"
@@ -28,6 +29,21 @@ func Schema() schematypes.Object {
 					Options: transformations,
 				},
 			},
+			"profiles": schematypes.Map{
+				Title: "Configuration Profiles",
+				Description: util.Markdown(`
+					Named profiles, such as 'dev' or 'prod', that can be selected when
+					starting the worker. A profile is an object that is merged into
+					'config' before transformations are applied. Objects are merged
+					recursively, 'null' removes an option and other values replace the
+					option from 'config'.
+
+					This allows a single config file to be used for local development and
+					deployment, by overriding options like 'monitor.logLevel',
+					'queueBaseUrl' or 'worker.selfTest' in a profile.
+				`),
+				Values: schematypes.Object{AdditionalProperties: true},
+			},
 			"config": worker.ConfigSchema(),
 		},
 		Required: []string{"config"},
@@ -37,6 +53,13 @@ func Schema() schematypes.Object {
 
 // Load configuration from YAML config object.
 func Load(data []byte, monitor runtime.Monitor) (map[string]interface{}, error) {
+	return LoadProfile(data, "", monitor)
+}
+
+// LoadProfile loads configuration from YAML config object, with the given
+// profile merged into the configuration. If profile is empty no profile is
+// applied.
+func LoadProfile(data []byte, profile string, monitor runtime.Monitor) (map[string]interface{}, error) {
 	// Parse config file
 	var config interface{}
 	err := yaml.Unmarshal(data, &config)
@@ -63,6 +86,13 @@ func Load(data []byte, monitor runtime.Monitor) (map[string]interface{}, error)
 		panic(fmt.Sprintf("YAML loaded wrong types, error: %s", err))
 	}
 
+	// Apply profile
+	if profile != "" {
+		if err := applyProfile(result, c["profiles"], profile); err != nil {
+			return nil, err
+		}
+	}
+
 	// Apply transforms
 	if ct, ok := c["transforms"]; ok {
 		var transforms []string
@@ -107,13 +137,19 @@ func Load(data []byte, monitor runtime.Monitor) (map[string]interface{}, error)
 // against the config file schema, returning an error message explaining what
 // went wrong if unsuccessful.
 func LoadFromFile(filename string, monitor runtime.Monitor) (interface{}, error) {
+	return LoadProfileFromFile(filename, "", monitor)
+}
+
+// LoadProfileFromFile is the same as LoadFromFile, except the given profile is
+// merged into the configuration, see LoadProfile.
+func LoadProfileFromFile(filename, profile string, monitor runtime.Monitor) (interface{}, error) {
 	// Read config file
 	configFile, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file '%s': %s", filename, err)
 	}
 
-	return Load(configFile, monitor)
+	return LoadProfile(configFile, profile, monitor)
 }
 
 func convertSimpleJSONTypes(val interface{}) interface{} {
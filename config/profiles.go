@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// applyProfile merges the profile with given name from profiles into config.
+//
+// Objects are merged recursively, null removes the value from config and any
+// other value in the profile replaces the value in config. This allows a
+// profile to override a few options, such as monitor.logLevel or queueBaseUrl,
+// without repeating the entire config.
+func applyProfile(config map[string]interface{}, profiles interface{}, name string) error {
+	p, _ := profiles.(map[string]interface{})
+	profile, ok := p[name].(map[string]interface{})
+	if !ok {
+		available := []string{}
+		for k := range p {
+			available = append(available, k)
+		}
+		sort.Strings(available)
+		return fmt.Errorf(
+			"Unknown config profile: '%s', available profiles: %s",
+			name, strings.Join(available, ", "),
+		)
+	}
+	mergeObjects(config, profile)
+	return nil
+}
+
+// mergeObjects merges source into target recursively
+func mergeObjects(target, source map[string]interface{}) {
+	for k, v := range source {
+		if v == nil {
+			delete(target, k)
+			continue
+		}
+		if s, ok := v.(map[string]interface{}); ok {
+			if t, ok := target[k].(map[string]interface{}); ok {
+				mergeObjects(t, s)
+				continue
+			}
+		}
+		target[k] = v
+	}
+}
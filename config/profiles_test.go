@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyProfile(t *testing.T) {
+	config := map[string]interface{}{
+		"queueBaseUrl": "https://queue.example.com",
+		"monitor": map[string]interface{}{
+			"logLevel": "warning",
+			"project":  "my-project",
+		},
+		"worker": map[string]interface{}{
+			"selfTest": map[string]interface{}{"iterations": float64(1)},
+		},
+	}
+	profiles := map[string]interface{}{
+		"dev": map[string]interface{}{
+			"queueBaseUrl": "http://localhost:8080",
+			"monitor": map[string]interface{}{
+				"logLevel": "debug",
+			},
+			"worker": map[string]interface{}{
+				"selfTest": nil,
+			},
+		},
+		"prod": map[string]interface{}{},
+	}
+
+	require.NoError(t, applyProfile(config, profiles, "dev"))
+	require.Equal(t, map[string]interface{}{
+		"queueBaseUrl": "http://localhost:8080",
+		"monitor": map[string]interface{}{
+			"logLevel": "debug",
+			"project":  "my-project",
+		},
+		"worker": map[string]interface{}{},
+	}, config)
+
+	err := applyProfile(config, profiles, "staging")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dev, prod")
+}
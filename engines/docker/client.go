@@ -0,0 +1,337 @@
+package dockerengine
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Docker API version used, this is supported by Docker 1.12 and later
+const dockerAPIVersion = "v1.24"
+
+// Maximum number of bytes of an error response from docker we'll read
+const maxErrorResponseSize = 64 * 1024
+
+// errNoSuchContainer is returned when docker responds 404 for a container
+var errNoSuchContainer = errors.New("no such container")
+
+// dockerClient is a minimal client for the docker engine API, implementing
+// only what the engine needs.
+type dockerClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// newDockerClient returns a dockerClient talking to the docker daemon over the
+// unix domain socket given.
+func newDockerClient(socket string) *dockerClient {
+	dialer := net.Dialer{Timeout: 30 * time.Second}
+	return &dockerClient{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+				MaxIdleConns:    10,
+				IdleConnTimeout: 90 * time.Second,
+			},
+		},
+		baseURL: "http://docker/" + dockerAPIVersion,
+	}
+}
+
+// dockerError is an error response from the docker daemon
+type dockerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("docker responded %d: %s", e.StatusCode, e.Message)
+}
+
+// do sends a request to docker, encoding body as JSON if not nil, and returns
+// an error if the response status isn't 2xx. Caller must close the response
+// body, if no error is returned.
+func (c *dockerClient) do(method, path string, query url.Values, body interface{}, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			panic(errors.Wrap(err, "failed to serialize docker request"))
+		}
+		reader = bytes.NewReader(data)
+	}
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		panic(errors.Wrap(err, "failed to create docker request"))
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send request to docker")
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		defer res.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorResponseSize))
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &dockerError{StatusCode: res.StatusCode, Message: msg.Message}
+	}
+	return res, nil
+}
+
+// call sends a request and decodes the JSON response into result, if not nil
+func (c *dockerClient) call(method, path string, query url.Values, body, result interface{}) error {
+	res, err := c.do(method, path, query, body, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if result != nil {
+		if err = json.NewDecoder(res.Body).Decode(result); err != nil {
+			return errors.Wrap(err, "failed to parse response from docker")
+		}
+	}
+	return nil
+}
+
+// Ping checks that the docker daemon is reachable
+func (c *dockerClient) Ping() error {
+	res, err := c.do(http.MethodGet, "/_ping", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// registryAuth holds credentials for a docker registry
+type registryAuth struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ServerAddress string `json:"serveraddress"`
+}
+
+// pullMessage is a progress message from an image pull
+type pullMessage struct {
+	ID             string          `json:"id"`
+	Status         string          `json:"status"`
+	Progress       string          `json:"progress"`
+	ProgressDetail json.RawMessage `json:"progressDetail"`
+	Error          string          `json:"error"`
+}
+
+// PullImage pulls image from a registry, writing progress to log. The image
+// may include a tag or digest, if auth is not nil credentials are sent to the
+// registry.
+func (c *dockerClient) PullImage(image string, auth *registryAuth, log io.Writer) error {
+	header := http.Header{}
+	if auth != nil {
+		data, _ := json.Marshal(auth)
+		header.Set("X-Registry-Auth", base64.URLEncoding.EncodeToString(data))
+	}
+	query := url.Values{}
+	query.Set("fromImage", image)
+	res, err := c.do(http.MethodPost, "/images/create", query, nil, header)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Docker responds 200 and reports errors in the stream of progress messages
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var msg pullMessage
+		err = decoder.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read image pull progress from docker")
+		}
+		if msg.Error != "" {
+			return &dockerError{StatusCode: http.StatusOK, Message: msg.Error}
+		}
+		// Only log status changes, not progress updates
+		if msg.Progress == "" && msg.Status != "" {
+			if msg.ID != "" {
+				fmt.Fprintf(log, "%s: %s\n", msg.ID, msg.Status)
+			} else {
+				fmt.Fprintln(log, msg.Status)
+			}
+		}
+	}
+}
+
+// ImageExists returns true, if image is present locally
+func (c *dockerClient) ImageExists(image string) (bool, error) {
+	if strings.Contains(image, "..") {
+		return false, fmt.Errorf("invalid docker image name: '%s'", image)
+	}
+	err := c.call(http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+	if e, ok := err.(*dockerError); ok && e.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// containerConfig is the subset of container configuration used
+type containerConfig struct {
+	Image      string
+	Cmd        []string `json:",omitempty"`
+	Env        []string `json:",omitempty"`
+	Tty        bool
+	Labels     map[string]string `json:",omitempty"`
+	HostConfig hostConfig
+}
+
+// hostConfig is the subset of container host configuration used
+type hostConfig struct {
+	Memory         int64    `json:",omitempty"` // bytes
+	MemorySwap     int64    `json:",omitempty"` // bytes, memory + swap
+	CPUPeriod      int64    `json:"CpuPeriod,omitempty"`
+	CPUQuota       int64    `json:"CpuQuota,omitempty"`
+	PidsLimit      int64    `json:",omitempty"`
+	NetworkMode    string   `json:",omitempty"`
+	CapDrop        []string `json:",omitempty"`
+	SecurityOpt    []string `json:",omitempty"`
+	ReadonlyRootfs bool     `json:",omitempty"`
+	Binds          []string `json:",omitempty"` // <volume>:<path>[:ro]
+}
+
+// CreateContainer creates a container and returns its id
+func (c *dockerClient) CreateContainer(config containerConfig) (string, error) {
+	var result struct {
+		ID string `json:"Id"`
+	}
+	if err := c.call(http.MethodPost, "/containers/create", nil, config, &result); err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// StartContainer starts a container created with CreateContainer
+func (c *dockerClient) StartContainer(id string) error {
+	return c.containerCall(http.MethodPost, id, "/start", nil, nil)
+}
+
+// ContainerLogs returns a stream of container output until the container
+// exits, containers must be created with Tty for output not to be multiplexed.
+func (c *dockerClient) ContainerLogs(id string) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Set("follow", "1")
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	res, err := c.do(http.MethodGet, "/containers/"+id+"/logs", query, nil, nil)
+	if err != nil {
+		return nil, containerError(err)
+	}
+	return res.Body, nil
+}
+
+// WaitContainer blocks until a container exits, and returns its exit code
+func (c *dockerClient) WaitContainer(id string) (int, error) {
+	var result struct {
+		StatusCode int
+	}
+	err := c.containerCall(http.MethodPost, id, "/wait", nil, &result)
+	return result.StatusCode, err
+}
+
+// containerState is the subset of container state used
+type containerState struct {
+	OOMKilled bool
+	ExitCode  int
+}
+
+// InspectContainer returns the state of a container
+func (c *dockerClient) InspectContainer(id string) (containerState, error) {
+	var result struct {
+		State containerState
+	}
+	err := c.containerCall(http.MethodGet, id, "/json", nil, &result)
+	return result.State, err
+}
+
+// KillContainer sends SIGKILL to a container
+func (c *dockerClient) KillContainer(id string) error {
+	return c.containerCall(http.MethodPost, id, "/kill", nil, nil)
+}
+
+// RemoveContainer removes a container and its anonymous volumes, killing it
+// if still running.
+func (c *dockerClient) RemoveContainer(id string) error {
+	query := url.Values{}
+	query.Set("force", "1")
+	query.Set("v", "1")
+	return containerError(c.call(http.MethodDelete, "/containers/"+id, query, nil, nil))
+}
+
+// CopyFromContainer returns a tar archive of path inside a container, docker
+// responds 404 if either the container or the path doesn't exist.
+func (c *dockerClient) CopyFromContainer(id, path string) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Set("path", path)
+	res, err := c.do(http.MethodGet, "/containers/"+id+"/archive", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// volumeInfo is the subset of volume information used
+type volumeInfo struct {
+	Name       string
+	Mountpoint string // path on the docker host
+}
+
+// CreateVolume creates a local volume with a generated name
+func (c *dockerClient) CreateVolume(labels map[string]string) (volumeInfo, error) {
+	var result volumeInfo
+	err := c.call(http.MethodPost, "/volumes/create", nil, map[string]interface{}{
+		"Driver": "local",
+		"Labels": labels,
+	}, &result)
+	return result, err
+}
+
+// RemoveVolume removes a volume, this fails if the volume is in use
+func (c *dockerClient) RemoveVolume(name string) error {
+	return c.call(http.MethodDelete, "/volumes/"+name, nil, nil, nil)
+}
+
+func (c *dockerClient) containerCall(method, id, action string, body, result interface{}) error {
+	return containerError(c.call(method, "/containers/"+id+action, nil, body, result))
+}
+
+// containerError translates 404 responses to errNoSuchContainer
+func containerError(err error) error {
+	if e, ok := err.(*dockerError); ok && e.StatusCode == http.StatusNotFound {
+		return errNoSuchContainer
+	}
+	return err
+}
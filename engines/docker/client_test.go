@@ -0,0 +1,193 @@
+package dockerengine
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// fakeDocker serves handler on a unix domain socket, returning a client for it
+func fakeDocker(t *testing.T, handler http.HandlerFunc) (*dockerClient, func()) {
+	folder, err := ioutil.TempDir("", "docker-engine-test")
+	require.NoError(t, err)
+	socket := filepath.Join(folder, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	s := httptest.NewUnstartedServer(handler)
+	s.Listener = l
+	s.Start()
+	return newDockerClient(socket), func() {
+		s.Close()
+		os.RemoveAll(folder)
+	}
+}
+
+func TestPullImage(t *testing.T) {
+	c, cleanup := fakeDocker(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/"+dockerAPIVersion+"/images/create", r.URL.Path)
+		switch r.URL.Query().Get("fromImage") {
+		case "ubuntu:16.04":
+			require.Equal(t, "", r.Header.Get("X-Registry-Auth"))
+			w.Write([]byte(`{"status":"Pulling from library/ubuntu","id":"16.04"}`))
+			w.Write([]byte(`{"status":"Downloading","progress":"[==>  ]","id":"abc"}`))
+			w.Write([]byte(`{"status":"Pull complete","id":"abc"}`))
+		case "example.com/private:latest":
+			require.NotEqual(t, "", r.Header.Get("X-Registry-Auth"))
+			w.Write([]byte(`{"error":"unauthorized: authentication required"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"repository not found"}`))
+		}
+	})
+	defer cleanup()
+
+	var log bytes.Buffer
+	require.NoError(t, c.PullImage("ubuntu:16.04", nil, &log))
+	require.Equal(t, "16.04: Pulling from library/ubuntu\nabc: Pull complete\n", log.String())
+
+	err := c.PullImage("example.com/private:latest", &registryAuth{Username: "u", Password: "p"}, &log)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "authentication required")
+
+	err = c.PullImage("missing", nil, &log)
+	require.Equal(t, &dockerError{StatusCode: 404, Message: "repository not found"}, err)
+}
+
+func TestCreateAndRemoveContainer(t *testing.T) {
+	c, cleanup := fakeDocker(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /" + dockerAPIVersion + "/containers/create":
+			var config map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&config))
+			require.Equal(t, "ubuntu:16.04", config["Image"])
+			hostConfig := config["HostConfig"].(map[string]interface{})
+			require.Equal(t, float64(512*1024*1024), hostConfig["Memory"])
+			require.Equal(t, float64(50000), hostConfig["CpuQuota"])
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"container-1"}`))
+		case "DELETE /" + dockerAPIVersion + "/containers/container-1":
+			require.Equal(t, "1", r.URL.Query().Get("force"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"no such container"}`))
+		}
+	})
+	defer cleanup()
+
+	id, err := c.CreateContainer(containerConfig{
+		Image: "ubuntu:16.04",
+		HostConfig: hostConfig{
+			Memory:    512 * 1024 * 1024,
+			CPUPeriod: cpuPeriod,
+			CPUQuota:  cpuPeriod / 2,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "container-1", id)
+	require.NoError(t, c.RemoveContainer(id))
+	require.Equal(t, errNoSuchContainer, c.RemoveContainer("container-2"))
+}
+
+func TestRegistryAuth(t *testing.T) {
+	e := &engine{config: configType{
+		Registries: map[string]registryCredentials{
+			"docker.io":      {Username: "hub", Password: "secret"},
+			"localhost:5000": {Username: "local", Password: "secret"},
+		},
+	}}
+	require.Equal(t, defaultRegistryAddress, e.registryAuth("ubuntu:16.04").ServerAddress)
+	require.Equal(t, "hub", e.registryAuth("library/ubuntu").Username)
+	require.Equal(t, "local", e.registryAuth("localhost:5000/image").Username)
+	require.Nil(t, e.registryAuth("quay.io/coreos/etcd"))
+}
+
+func TestVolume(t *testing.T) {
+	folder, err := ioutil.TempDir("", "docker-engine-volume")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	c, cleanup := fakeDocker(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /" + dockerAPIVersion + "/volumes/create":
+			var config map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&config))
+			require.Equal(t, "local", config["Driver"])
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"Name": "volume-1", "Mountpoint": folder})
+		case "DELETE /" + dockerAPIVersion + "/volumes/volume-1":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"no such volume"}`))
+		}
+	})
+	defer cleanup()
+
+	e := &engine{environment: &runtime.Environment{WorkerType: "test"}, docker: c}
+	v, err := e.NewVolume(nil)
+	require.NoError(t, err)
+
+	empty, err := v.DiskSize()
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "file"), bytes.Repeat([]byte("x"), 64*1024), 0644))
+	size, err := v.DiskSize()
+	require.NoError(t, err)
+	require.True(t, size >= empty+64*1024, "expected DiskSize to include the file written")
+	require.NoError(t, v.Dispose())
+
+	// DiskSize isn't supported, if the volume folder isn't accessible
+	_, err = (&volume{info: volumeInfo{Mountpoint: filepath.Join(folder, "missing")}}).DiskSize()
+	require.Equal(t, engines.ErrFeatureNotSupported, err)
+	require.Error(t, c.RemoveVolume("volume-2"))
+}
+
+func TestValidMountpoint(t *testing.T) {
+	require.True(t, validMountpoint("/cache"))
+	require.True(t, validMountpoint("/home/worker/.cache"))
+	require.False(t, validMountpoint("/"))
+	require.False(t, validMountpoint("cache"))
+	require.False(t, validMountpoint("/cache/../etc"))
+	require.False(t, validMountpoint("/cache:rw"))
+}
+
+func TestIsImageNotFound(t *testing.T) {
+	require.True(t, isImageNotFound(&dockerError{StatusCode: 404, Message: "repository not found"}))
+	require.True(t, isImageNotFound(&dockerError{StatusCode: 401, Message: "authentication required"}))
+	require.True(t, isImageNotFound(&dockerError{StatusCode: 200, Message: "unauthorized: authentication required"}))
+	require.True(t, isImageNotFound(&dockerError{StatusCode: 200, Message: "manifest for ubuntu:missing not found"}))
+	require.False(t, isImageNotFound(&dockerError{StatusCode: 500, Message: "no space left on device"}))
+	require.False(t, isImageNotFound(&dockerError{StatusCode: 200, Message: "net/http: TLS handshake timeout"}))
+	require.False(t, isImageNotFound(errors.New("failed to send request to docker")))
+}
+
+func TestIsClientError(t *testing.T) {
+	require.True(t, isClientError(&dockerError{StatusCode: 400, Message: "executable file not found in $PATH"}))
+	require.True(t, isClientError(&dockerError{StatusCode: 404, Message: "no such container"}))
+	require.False(t, isClientError(&dockerError{StatusCode: 500, Message: "driver failed programming external connectivity"}))
+	require.False(t, isClientError(errors.New("failed to send request to docker")))
+}
+
+func TestImagePattern(t *testing.T) {
+	for _, image := range []string{
+		"ubuntu", "ubuntu:16.04", "registry.example.com:5000/my-org/my_image:v1.2",
+		"ubuntu@sha256:" + strings.Repeat("a", 64),
+	} {
+		require.NoError(t, payloadSchema.Properties["image"].Validate(image), "expected '%s' to be valid", image)
+	}
+	for _, image := range []string{"../../containers/create", "ubuntu/../../info", "ubuntu.", ".ubuntu", "ubuntu:16.04?all=1"} {
+		require.Error(t, payloadSchema.Properties["image"].Validate(image), "expected '%s' to be invalid", image)
+	}
+}
@@ -0,0 +1,121 @@
+package dockerengine
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Default path to the docker daemon socket
+const defaultSocket = "/var/run/docker.sock"
+
+type configType struct {
+	Socket         string                         `json:"socket"`
+	MaxConcurrency int                            `json:"maxConcurrency"`
+	Limits         limitsConfig                   `json:"limits"`
+	Registries     map[string]registryCredentials `json:"registries"`
+	ProxyAddress   string                         `json:"proxyAddress"`
+}
+
+type limitsConfig struct {
+	MaxMemory int     `json:"maxMemory"`
+	MaxCPUs   float64 `json:"maxCPUs"`
+	MaxPids   int     `json:"maxPids"`
+}
+
+type registryCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+var configSchema = schematypes.Object{
+	Title: "Docker Engine Config",
+	Description: util.Markdown(`
+		Configuration for the docker engine, this engine runs each task in
+		a new docker container, which is removed when the task is done.
+	`),
+	Properties: schematypes.Properties{
+		"socket": schematypes.String{
+			Title: "Docker Socket",
+			Description: util.Markdown(`
+				Path to the unix domain socket of the docker daemon, defaults to
+				'/var/run/docker.sock'.
+			`),
+		},
+		"maxConcurrency": schematypes.Integer{
+			Title: "Max Concurrency",
+			Description: util.Markdown(`
+				Maximum number of containers to run concurrently. Ensure that the
+				host has resources for this many containers at 'limits'.
+			`),
+			Minimum: 1,
+			Maximum: 1000,
+		},
+		"limits": schematypes.Object{
+			Title: "Resource Limits",
+			Description: util.Markdown(`
+				Maximum resources a task container may be given, these are also
+				the default limits for tasks that don't specify 'resources' in
+				'task.payload'.
+			`),
+			Properties: schematypes.Properties{
+				"maxMemory": schematypes.Integer{
+					Title:       "Max Memory",
+					Description: "Maximum memory in MiB, swap is disabled for containers.",
+					Minimum:     4,
+					Maximum:     1024 * 1024,
+				},
+				"maxCPUs": schematypes.Number{
+					Title: "Max CPUs",
+					Description: util.Markdown(`
+						Maximum number of CPUs, fractional values limit CPU time, e.g.
+						'1.5' allows a container to use one and a half CPU.
+					`),
+					Minimum: 0.01,
+					Maximum: 1024,
+				},
+				"maxPids": schematypes.Integer{
+					Title: "Max Processes",
+					Description: util.Markdown(`
+						Maximum number of processes and threads in a container, this
+						prevents fork bombs from exhausting the host.
+					`),
+					Minimum: 16,
+					Maximum: 4 * 1024 * 1024,
+				},
+			},
+			Required: []string{"maxMemory", "maxCPUs", "maxPids"},
+		},
+		"registries": schematypes.Map{
+			Title: "Registry Credentials",
+			Description: util.Markdown(`
+				Credentials for pulling images from private registries, given as
+				a mapping from registry hostname to credentials. Use 'docker.io'
+				for images from Docker Hub.
+			`),
+			Values: schematypes.Object{
+				Properties: schematypes.Properties{
+					"username": schematypes.String{},
+					"password": schematypes.String{},
+				},
+				Required: []string{"username", "password"},
+			},
+		},
+		"proxyAddress": schematypes.String{
+			Title: "Proxy Address",
+			Description: util.Markdown(`
+				IP address on the host that containers can reach, such as the
+				gateway of the 'docker0' bridge, usually '172.17.0.1'. Proxies
+				attached by plugins, like 'tcproxy', are exposed on a random port
+				at this address, and the URL for proxy '<name>' is given to the
+				container in the environment variable '<NAME>_URL'.
+
+				If not given, proxies are not supported.
+			`),
+			Pattern: `^(\d{1,3}\.){3}\d{1,3}$`,
+		},
+	},
+	Required: []string{
+		"maxConcurrency",
+		"limits",
+	},
+}
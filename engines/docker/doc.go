@@ -0,0 +1,11 @@
+// Package dockerengine provides an engine that runs tasks in docker
+// containers, as a lighter alternative to the qemu engine for Linux tasks.
+//
+// The engine talks to the docker daemon over its unix domain socket, pulls
+// images from registries, creates a container per task with resource limits
+// from the task payload, and captures container output in the task log.
+package dockerengine
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("docker")
@@ -0,0 +1,144 @@
+package dockerengine
+
+import (
+	"testing"
+
+	"github.com/taskcluster/taskcluster-worker/engines/enginetest"
+)
+
+var provider = &enginetest.EngineProvider{
+	Engine: "docker",
+	Config: `{
+		"maxConcurrency": 1,
+		"limits": {
+			"maxMemory": 512,
+			"maxCPUs": 1,
+			"maxPids": 256
+		}
+	}`,
+}
+
+// requireDocker skips the test, if there is no docker daemon to test against
+func requireDocker(t *testing.T) {
+	if err := newDockerClient(defaultSocket).Ping(); err != nil {
+		t.Skipf("docker daemon not available at '%s', error: %s", defaultSocket, err)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	requireDocker(t)
+	c := enginetest.LoggingTestCase{
+		EngineProvider: provider,
+		Target:         "hello-world",
+		TargetPayload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-c", "echo 'hello-world' && true"]
+		}`,
+		FailingPayload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-c", "echo 'hello-world' && false"]
+		}`,
+		SilentPayload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-c", "echo 'no hello' && true"]
+		}`,
+	}
+
+	c.Test()
+}
+
+func TestEnvironmentVariables(t *testing.T) {
+	requireDocker(t)
+	c := enginetest.EnvVarTestCase{
+		EngineProvider: provider,
+		VariableName:   "TEST_ENV_VAR",
+		InvalidVariableNames: []string{
+			"#=#",
+		},
+		Payload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-c", "echo $TEST_ENV_VAR && true"]
+		}`,
+	}
+
+	c.Test()
+}
+
+func TestVolumes(t *testing.T) {
+	requireDocker(t)
+	c := enginetest.VolumeTestCase{
+		EngineProvider: provider,
+		Mountpoint:     "/mnt/my-volume",
+		WriteVolumePayload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-ec", "mkdir -p /mnt/my-volume/folder && echo 'hello-world' > /mnt/my-volume/folder/file.txt"]
+		}`,
+		CheckVolumePayload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-ec", "grep 'hello-world' /mnt/my-volume/folder/file.txt"]
+		}`,
+	}
+
+	c.Test()
+}
+
+func TestArtifacts(t *testing.T) {
+	requireDocker(t)
+	c := enginetest.ArtifactTestCase{
+		EngineProvider:     provider,
+		Text:               "[hello-world]",
+		TextFilePath:       "/folder/hello.txt",
+		FileNotFoundPath:   "/no-such-file.txt",
+		FolderNotFoundPath: "/no-such-folder/",
+		NestedFolderFiles: []string{
+			"hello.txt",
+			"sub-folder/hello2.txt",
+		},
+		NestedFolderPath: "/folder/",
+		Payload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-ec", "mkdir -p /folder/sub-folder; echo '[hello-world]' > /folder/hello.txt; echo '[hello-world]' > /folder/sub-folder/hello2.txt"]
+		}`,
+	}
+
+	c.Test()
+}
+
+func TestKill(t *testing.T) {
+	requireDocker(t)
+	c := enginetest.KillTestCase{
+		EngineProvider: provider,
+		Target:         `hello-world`,
+		Payload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-c", "echo 'hello-world' && sleep 30 && true"]
+		}`,
+	}
+
+	c.Test()
+}
+
+func TestCommandTimeout(t *testing.T) {
+	requireDocker(t)
+	c := enginetest.LoggingTestCase{
+		EngineProvider: provider,
+		Target:         "hello-world",
+		TargetPayload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-c", "echo 'hello-world' && true"],
+			"commandTimeout": 30
+		}`,
+		FailingPayload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-c", "echo 'hello-world' && sleep 30 && true"],
+			"commandTimeout": 1
+		}`,
+		SilentPayload: `{
+			"image": "alpine:3.6",
+			"command": ["sh", "-c", "true"],
+			"commandTimeout": 30
+		}`,
+	}
+
+	c.Test()
+}
@@ -0,0 +1,142 @@
+package dockerengine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// Registry hostname for images without one, and the server address docker
+// expects in credentials for it.
+const (
+	defaultRegistry        = "docker.io"
+	defaultRegistryAddress = "https://index.docker.io/v1/"
+)
+
+type engineProvider struct {
+	engines.EngineProviderBase
+}
+
+type engine struct {
+	engines.EngineBase
+	environment *runtime.Environment
+	monitor     runtime.Monitor
+	config      configType
+	docker      *dockerClient
+}
+
+func init() {
+	engines.Register("docker", engineProvider{})
+}
+
+func (engineProvider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
+func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine, error) {
+	var c configType
+	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+
+	if c.Socket == "" {
+		c.Socket = defaultSocket
+	}
+
+	return &engine{
+		environment: options.Environment,
+		monitor:     options.Monitor,
+		config:      c,
+		docker:      newDockerClient(c.Socket),
+	}, nil
+}
+
+func (e *engine) PayloadSchema() schematypes.Object {
+	return payloadSchema
+}
+
+func (e *engine) Capabilities() engines.Capabilities {
+	return engines.Capabilities{
+		MaxConcurrency: e.config.MaxConcurrency,
+	}
+}
+
+func (e *engine) PreflightCheck() error {
+	if err := e.docker.Ping(); err != nil {
+		return errors.Wrapf(err, "unable to reach docker daemon at '%s'", e.config.Socket)
+	}
+	return nil
+}
+
+func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.SandboxBuilder, error) {
+	var p payloadType
+	schematypes.MustValidateAndMap(payloadSchema, options.Payload, &p)
+
+	// Apply default resource limits, and check that limits are permitted
+	limits := e.config.Limits
+	if p.Resources.Memory == 0 {
+		p.Resources.Memory = limits.MaxMemory
+	}
+	if p.Resources.CPUs == 0 {
+		p.Resources.CPUs = limits.MaxCPUs
+	}
+	if p.Resources.Pids == 0 {
+		p.Resources.Pids = limits.MaxPids
+	}
+	if p.Resources.Memory > limits.MaxMemory {
+		return nil, runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"task.payload.resources.memory: %d MiB exceeds the maximum of %d MiB",
+			p.Resources.Memory, limits.MaxMemory,
+		))
+	}
+	if p.Resources.CPUs > limits.MaxCPUs {
+		return nil, runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"task.payload.resources.cpus: %g exceeds the maximum of %g",
+			p.Resources.CPUs, limits.MaxCPUs,
+		))
+	}
+	if p.Resources.Pids > limits.MaxPids {
+		return nil, runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"task.payload.resources.pids: %d exceeds the maximum of %d",
+			p.Resources.Pids, limits.MaxPids,
+		))
+	}
+
+	return &sandboxBuilder{
+		engine:  e,
+		payload: p,
+		context: options.TaskContext,
+		env:     make(map[string]string),
+		binds:   make(map[string]string),
+		monitor: options.Monitor,
+	}, nil
+}
+
+// registryAuth returns credentials for the registry hosting image, or nil if
+// none are configured.
+func (e *engine) registryAuth(image string) *registryAuth {
+	registry := defaultRegistry
+	// The first path component is a registry, if it contains '.' or ':' or is
+	// localhost, otherwise the image is on Docker Hub.
+	if i := strings.Index(image, "/"); i != -1 {
+		first := image[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			registry = first
+		}
+	}
+	creds, ok := e.config.Registries[registry]
+	if !ok {
+		return nil
+	}
+	address := registry
+	if registry == defaultRegistry {
+		address = defaultRegistryAddress
+	}
+	return &registryAuth{
+		Username:      creds.Username,
+		Password:      creds.Password,
+		ServerAddress: address,
+	}
+}
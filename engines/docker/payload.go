@@ -0,0 +1,88 @@
+package dockerengine
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type payloadType struct {
+	Image          string           `json:"image"`
+	Command        []string         `json:"command"`
+	CommandTimeout int              `json:"commandTimeout"`
+	Resources      resourcesPayload `json:"resources"`
+}
+
+type resourcesPayload struct {
+	Memory int     `json:"memory"`
+	CPUs   float64 `json:"cpus"`
+	Pids   int     `json:"pids"`
+}
+
+var payloadSchema = schematypes.Object{
+	Properties: schematypes.Properties{
+		"image": schematypes.String{
+			Title: "Docker Image",
+			Description: util.Markdown(`
+				Image to run the task in, this is pulled from the registry before
+				the task is started. The image may include a tag or digest, such
+				as 'ubuntu:16.04' or 'ubuntu@sha256:<hash>'.
+			`),
+			// Repository name with optional registry, tag and digest, dots must be
+			// followed by another character, as the image is used in API paths
+			Pattern: `^[a-zA-Z0-9](\.?[a-zA-Z0-9_:/-])*(@sha256:[a-f0-9]{64})?$`,
+		},
+		"command": schematypes.Array{
+			Title: "Command",
+			Description: util.Markdown(`
+				Command and arguments to execute in the container. Defaults to the
+				command specified by the image.
+
+				Only a single command is supported, use a shell script to run
+				multiple commands.
+			`),
+			Items: schematypes.String{},
+		},
+		"commandTimeout": schematypes.Integer{
+			Title: "Command Timeout",
+			Description: util.Markdown(`
+				Maximum number of seconds the command may run, before the container
+				is killed and the task resolved as failed.
+
+				This is distinct from 'maxRunTime' which limits the duration of the
+				entire task, including image pull and artifact upload. Omit, or set
+				to zero, to only be limited by 'maxRunTime'.
+			`),
+			Minimum: 0,
+			Maximum: 7 * 24 * 60 * 60,
+		},
+		"resources": schematypes.Object{
+			Title: "Resource Limits",
+			Description: util.Markdown(`
+				Resources to limit the container to, these cannot exceed the limits
+				configured for the worker. Omitted properties default to the worker
+				limits.
+			`),
+			Properties: schematypes.Properties{
+				"memory": schematypes.Integer{
+					Title:       "Memory",
+					Description: "Memory limit in MiB, swap is disabled.",
+					Minimum:     4,
+					Maximum:     1024 * 1024,
+				},
+				"cpus": schematypes.Number{
+					Title:       "CPUs",
+					Description: "Number of CPUs the container may use, may be fractional.",
+					Minimum:     0.01,
+					Maximum:     1024,
+				},
+				"pids": schematypes.Integer{
+					Title:       "Max Processes",
+					Description: "Maximum number of processes and threads in the container.",
+					Minimum:     16,
+					Maximum:     4 * 1024 * 1024,
+				},
+			},
+		},
+	},
+	Required: []string{"image"},
+}
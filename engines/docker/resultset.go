@@ -0,0 +1,146 @@
+package dockerengine
+
+import (
+	"archive/tar"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+type resultSet struct {
+	engines.ResultSetBase
+	engine      *engine
+	monitor     runtime.Monitor
+	containerID string
+	success     bool
+}
+
+func (r *resultSet) Success() bool {
+	return r.success
+}
+
+func (r *resultSet) ExtractFile(p string) (ioext.ReadSeekCloser, error) {
+	archive, err := r.archive(p)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	// Archive of a file contains a single entry for the file
+	t := tar.NewReader(archive)
+	hdr, err := t.Next()
+	if err != nil {
+		return nil, r.internalError(err, "failed to read archive from docker container")
+	}
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return nil, engines.ErrResourceNotFound
+	}
+	return r.tempFile(t)
+}
+
+func (r *resultSet) ExtractFolder(p string, handler engines.FileHandler) error {
+	archive, err := r.archive(p)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	// Archive of a folder has entries prefixed with the name of the folder
+	t := tar.NewReader(archive)
+	hdr, err := t.Next()
+	if err != nil {
+		return r.internalError(err, "failed to read archive from docker container")
+	}
+	if hdr.Typeflag != tar.TypeDir {
+		return engines.ErrResourceNotFound
+	}
+	prefix := strings.TrimSuffix(hdr.Name, "/") + "/"
+
+	for {
+		hdr, err = t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return r.internalError(err, "failed to read archive from docker container")
+		}
+		// Skip anything that isn't a plain file
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		f, err := r.tempFile(t)
+		if err != nil {
+			return err
+		}
+		if handler(strings.TrimPrefix(hdr.Name, prefix), f) != nil {
+			return engines.ErrHandlerInterrupt
+		}
+	}
+}
+
+// archive returns a tar archive of absolute path p in the container
+func (r *resultSet) archive(p string) (io.ReadCloser, error) {
+	if !path.IsAbs(p) {
+		return nil, runtime.NewMalformedPayloadError(
+			"Paths in docker containers must be absolute, got: ", p,
+		)
+	}
+	archive, err := r.engine.docker.CopyFromContainer(r.containerID, path.Clean(p))
+	if e, ok := err.(*dockerError); ok && e.StatusCode == http.StatusNotFound {
+		return nil, engines.ErrResourceNotFound
+	}
+	if err != nil {
+		return nil, r.internalError(err, "failed to copy from docker container")
+	}
+	return archive, nil
+}
+
+// tempFile copies r to a temporary file, which is removed when closed
+func (r *resultSet) tempFile(reader io.Reader) (ioext.ReadSeekCloser, error) {
+	f, err := os.Create(r.engine.environment.TemporaryStorage.NewFilePath())
+	if err != nil {
+		return nil, r.internalError(err, "failed to create temporary file")
+	}
+	if _, err = io.Copy(f, reader); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, r.internalError(err, "failed to copy file from docker container")
+	}
+	return &tempFile{f}, nil
+}
+
+func (r *resultSet) internalError(err error, message string) error {
+	r.monitor.ReportError(errors.Wrap(err, message))
+	return runtime.ErrNonFatalInternalError
+}
+
+func (r *resultSet) Dispose() error {
+	err := r.engine.docker.RemoveContainer(r.containerID)
+	if err != nil && err != errNoSuchContainer {
+		return r.internalError(err, "failed to remove docker container")
+	}
+	return nil
+}
+
+// tempFile is a file that is removed when closed
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
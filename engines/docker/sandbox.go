@@ -0,0 +1,265 @@
+package dockerengine
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/localproxy"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+// CPU period in microseconds, CPU limits are implemented as a quota of this
+const cpuPeriod = 100000
+
+type sandbox struct {
+	engines.SandboxBase
+	engine      *engine
+	context     *runtime.TaskContext
+	monitor     runtime.Monitor
+	containerID string
+	memory      int           // memory limit in MiB, for error messages
+	timeout     time.Duration // command timeout, zero if none
+	resolve     atomics.Once
+	resultSet   engines.ResultSet
+	resultError error
+	resultAbort error
+	aborted     atomics.Bool
+}
+
+func newSandbox(b *sandboxBuilder) (*sandbox, error) {
+	e := b.engine
+	p := b.payload
+
+	// Pull image, only errors caused by the image not existing or being
+	// inaccessible are attributed to the task.
+	b.context.Log("Pulling docker image: ", p.Image)
+	b.context.LogSectionStart("docker-pull")
+	err := e.docker.PullImage(p.Image, e.registryAuth(p.Image), b.context.LogDrainWithPrefix("docker"))
+	b.context.LogSectionEnd("docker-pull")
+	if err != nil {
+		if isImageNotFound(err) {
+			return nil, runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"failed to pull docker image '%s', error: %s", p.Image, err,
+			))
+		}
+		b.monitor.ReportError(err, "failed to pull docker image")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+
+	// Construct environment variables in sorted order
+	env := map[string]string{
+		"TASK_ID": b.context.TaskID,
+		"RUN_ID":  strconv.Itoa(b.context.RunID),
+	}
+	for k, v := range b.env {
+		env[k] = v
+	}
+	var envList []string
+	for k, v := range env {
+		envList = append(envList, k+"="+v)
+	}
+	sort.Strings(envList)
+
+	var binds []string
+	for _, bind := range b.binds {
+		binds = append(binds, bind)
+	}
+	sort.Strings(binds)
+
+	// Create container
+	id, err := e.docker.CreateContainer(containerConfig{
+		Image: p.Image,
+		Cmd:   p.Command,
+		Env:   envList,
+		Tty:   true, // merges stdout and stderr, and ensures output isn't multiplexed
+		Labels: map[string]string{
+			"taskcluster.taskId": b.context.TaskID,
+			"taskcluster.runId":  strconv.Itoa(b.context.RunID),
+		},
+		HostConfig: hostConfig{
+			Memory:      int64(p.Resources.Memory) * 1024 * 1024,
+			MemorySwap:  int64(p.Resources.Memory) * 1024 * 1024, // no swap
+			CPUPeriod:   cpuPeriod,
+			CPUQuota:    int64(p.Resources.CPUs * cpuPeriod),
+			PidsLimit:   int64(p.Resources.Pids),
+			SecurityOpt: []string{"no-new-privileges"},
+			Binds:       binds,
+		},
+	})
+	if err != nil {
+		b.monitor.ReportError(err, "failed to create docker container")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+
+	s := &sandbox{
+		engine:      e,
+		context:     b.context,
+		monitor:     b.monitor.WithTag("containerId", id),
+		containerID: id,
+		memory:      p.Resources.Memory,
+		timeout:     time.Duration(p.CommandTimeout) * time.Second,
+	}
+
+	// Start container, this fails if the command can't be executed, other
+	// errors from the docker daemon are not attributed to the task.
+	if err = e.docker.StartContainer(id); err != nil {
+		s.removeContainer()
+		if isClientError(err) {
+			return nil, runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"failed to start docker container, error: %s", err,
+			))
+		}
+		b.monitor.ReportError(err, "failed to start docker container")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+
+	go s.run()
+
+	// Stop the server for proxies, once the sandbox is resolved
+	if b.proxies != nil {
+		go func(proxies *localproxy.Server) {
+			s.resolve.Wait()
+			if err := proxies.Close(); err != nil {
+				s.monitor.ReportWarning(err, "failed to close server for proxies")
+			}
+		}(b.proxies)
+	}
+	return s, nil
+}
+
+// isImageNotFound returns true, if err from PullImage indicates that the image
+// doesn't exist, or that the registry refused access to it.
+func isImageNotFound(err error) bool {
+	e, ok := err.(*dockerError)
+	if !ok {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusNotFound, http.StatusUnauthorized:
+		return true
+	case http.StatusOK:
+		// Errors from the registry are reported in the stream of progress messages
+		msg := strings.ToLower(e.Message)
+		return strings.Contains(msg, "not found") ||
+			strings.Contains(msg, "manifest unknown") ||
+			strings.Contains(msg, "unauthorized") ||
+			strings.Contains(msg, "pull access denied")
+	}
+	return false
+}
+
+// isClientError returns true, if err is a 4xx response from the docker daemon
+func isClientError(err error) bool {
+	e, ok := err.(*dockerError)
+	return ok && e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+func (s *sandbox) run() {
+	docker := s.engine.docker
+
+	// Copy container output to the task log, the log stream ends when the
+	// container exits.
+	logsDone := make(chan struct{})
+	logs, err := docker.ContainerLogs(s.containerID)
+	if err != nil {
+		s.monitor.ReportWarning(err, "failed to read logs from docker container")
+		close(logsDone)
+	} else {
+		go func() {
+			defer close(logsDone)
+			io.Copy(s.context.LogDrain(), logs)
+			logs.Close()
+		}()
+	}
+
+	// Kill the container, if the command timeout is exceeded
+	var timer *time.Timer
+	timedOut := make(chan struct{})
+	if s.timeout > 0 {
+		timer = time.AfterFunc(s.timeout, func() {
+			defer close(timedOut)
+			s.context.LogError(fmt.Sprintf(
+				"Command timed out after %s, killing container", s.timeout,
+			))
+			_ = docker.KillContainer(s.containerID)
+		})
+	}
+
+	exitCode, err := docker.WaitContainer(s.containerID)
+	<-logsDone
+	success := exitCode == 0
+	if timer != nil && !timer.Stop() {
+		<-timedOut
+		success = false
+	}
+	if s.aborted.Get() {
+		return // Errors are expected, as the container was removed
+	}
+
+	var resultError error
+	if err != nil {
+		s.monitor.ReportError(err, "failed to wait for docker container")
+		resultError = runtime.ErrNonFatalInternalError
+	} else {
+		state, ierr := docker.InspectContainer(s.containerID)
+		if ierr != nil {
+			s.monitor.ReportWarning(ierr, "failed to inspect docker container")
+		} else if state.OOMKilled {
+			s.context.LogError(fmt.Sprintf(
+				"container was killed for exceeding the memory limit of %d MiB", s.memory,
+			))
+		}
+		s.context.Log("Container exited with exit code: ", exitCode)
+	}
+
+	s.resolve.Do(func() {
+		if resultError != nil {
+			s.resultError = resultError
+			s.removeContainer()
+		} else {
+			s.resultSet = &resultSet{
+				engine:      s.engine,
+				monitor:     s.monitor,
+				containerID: s.containerID,
+				success:     success,
+			}
+		}
+		s.resultAbort = engines.ErrSandboxTerminated
+	})
+}
+
+func (s *sandbox) WaitForResult() (engines.ResultSet, error) {
+	s.resolve.Wait()
+	return s.resultSet, s.resultError
+}
+
+func (s *sandbox) Kill() error {
+	// Ignore errors, as we're racing with the container exiting
+	_ = s.engine.docker.KillContainer(s.containerID)
+	return nil
+}
+
+func (s *sandbox) Abort() error {
+	s.resolve.Do(func() {
+		s.aborted.Set(true)
+		s.removeContainer()
+		s.resultError = engines.ErrSandboxAborted
+	})
+	s.resolve.Wait()
+	return s.resultAbort
+}
+
+// removeContainer removes the container, killing it if it's running
+func (s *sandbox) removeContainer() {
+	err := s.engine.docker.RemoveContainer(s.containerID)
+	if err != nil && err != errNoSuchContainer {
+		s.monitor.ReportWarning(err, "failed to remove docker container")
+	}
+}
@@ -0,0 +1,133 @@
+package dockerengine
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/localproxy"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+type sandboxBuilder struct {
+	engines.SandboxBuilderBase
+	m       sync.Mutex
+	engine  *engine
+	monitor runtime.Monitor
+	payload payloadType
+	context *runtime.TaskContext
+	env     map[string]string
+	binds   map[string]string  // mountpoint -> bind
+	proxies *localproxy.Server // nil, if no proxies are attached
+}
+
+var envVarPattern = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+func (b *sandboxBuilder) SetEnvironmentVariable(name string, value string) error {
+	if !envVarPattern.MatchString(name) {
+		return runtime.NewMalformedPayloadError(
+			"Environment variables name: '", name, "' doesn't match: ",
+			envVarPattern.String(),
+		)
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if _, ok := b.env[name]; ok {
+		return engines.ErrNamingConflict
+	}
+	b.env[name] = value
+	return nil
+}
+
+func (b *sandboxBuilder) AttachProxy(hostname string, handler http.Handler) error {
+	// Proxies are exposed at proxyAddress, which containers must be able to reach
+	if b.engine.config.ProxyAddress == "" {
+		return engines.ErrFeatureNotSupported
+	}
+	if !localproxy.NamePattern.MatchString(hostname) {
+		return runtime.NewMalformedPayloadError(
+			"Proxy hostname: '", hostname, "' is not allowed for docker engine. ",
+			"The hostname must match: ", localproxy.NamePattern.String(),
+		)
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	env := localproxy.EnvironmentVariable(hostname)
+	if _, ok := b.env[env]; ok {
+		return engines.ErrNamingConflict
+	}
+	if b.proxies == nil {
+		proxies, err := localproxy.New(net.JoinHostPort(b.engine.config.ProxyAddress, "0"))
+		if err != nil {
+			b.monitor.ReportError(err, "failed to start server for proxies")
+			return runtime.ErrNonFatalInternalError
+		}
+		b.proxies = proxies
+		b.context.AddSecret(proxies.Token()) // redact the token from the task log
+	}
+	if err := b.proxies.Attach(hostname, handler); err != nil {
+		return err
+	}
+	b.env[env] = b.proxies.URL(hostname)
+	return nil
+}
+
+func (b *sandboxBuilder) AttachVolume(mountpoint string, v engines.Volume, readOnly bool) error {
+	// Volumes are always created by NewVolume() from this engine
+	vol, ok := v.(*volume)
+	if !ok {
+		panic("AttachVolume: volume wasn't created by the docker engine")
+	}
+	if !validMountpoint(mountpoint) {
+		return runtime.NewMalformedPayloadError(
+			"Mountpoint: '", mountpoint, "' is not allowed for docker engine. ",
+			"The mountpoint must be an absolute path without ':' or ','",
+		)
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok := b.binds[mountpoint]; ok {
+		return engines.ErrNamingConflict
+	}
+	bind := vol.info.Name + ":" + mountpoint
+	if readOnly {
+		bind += ":ro"
+	}
+	b.binds[mountpoint] = bind
+	return nil
+}
+
+func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	s, err := newSandbox(b)
+	if err != nil {
+		b.closeProxies()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (b *sandboxBuilder) Discard() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.closeProxies()
+	return nil
+}
+
+// closeProxies stops the server for proxies, if any, must be called with lock
+func (b *sandboxBuilder) closeProxies() {
+	if b.proxies != nil {
+		if err := b.proxies.Close(); err != nil {
+			b.monitor.ReportWarning(err, "failed to close server for proxies")
+		}
+	}
+}
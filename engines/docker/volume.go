@@ -0,0 +1,51 @@
+package dockerengine
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// volume is a local docker volume
+type volume struct {
+	engines.VolumeBase
+	engine *engine
+	info   volumeInfo
+}
+
+func (e *engine) NewVolume(options interface{}) (engines.Volume, error) {
+	info, err := e.docker.CreateVolume(map[string]string{
+		"taskcluster.workerType": e.environment.WorkerType,
+	})
+	if err != nil {
+		e.monitor.ReportError(err, "failed to create docker volume")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+	return &volume{engine: e, info: info}, nil
+}
+
+// DiskSize returns the disk usage of the volume folder on the docker host,
+// this requires that the worker runs on the docker host with permission to
+// read the folder, otherwise ErrFeatureNotSupported is returned.
+func (v *volume) DiskSize() (uint64, error) {
+	size, err := ioext.DiskUsage(v.info.Mountpoint)
+	if os.IsPermission(err) || os.IsNotExist(err) {
+		return 0, engines.ErrFeatureNotSupported
+	}
+	return size, err
+}
+
+func (v *volume) Dispose() error {
+	return v.engine.docker.RemoveVolume(v.info.Name)
+}
+
+// validMountpoint returns true, if mountpoint is an absolute path that can be
+// given as bind to docker.
+func validMountpoint(mountpoint string) bool {
+	return path.IsAbs(mountpoint) && path.Clean(mountpoint) == mountpoint &&
+		mountpoint != "/" && !strings.ContainsAny(mountpoint, ":,")
+}
@@ -50,6 +50,14 @@ type Engine interface {
 	// accepted by this engine.
 	PayloadSchema() schematypes.Object
 
+	// PayloadMigrations returns migrations for converting payloads declaring an
+	// older 'payloadVersion' to the format accepted by PayloadSchema().
+	//
+	// The payload version is shared by engine and plugins, so when changing the
+	// payload format an engine should add a migration from the current version
+	// returned by runtime.CurrentPayloadVersion() for engine and plugins.
+	PayloadMigrations() []runtime.PayloadMigration
+
 	// Capabilities returns a structure declaring which features are supported,
 	// this is used for up-front feature checking. Unsupport methods must also
 	// return ErrFeatureNotSupported when called.
@@ -101,6 +109,26 @@ type Engine interface {
 	// Non-fatal errors: ErrFeatureNotSupported
 	NewVolume(options interface{}) (Volume, error)
 
+	// PreflightCheck verifies that the host has the devices, tools and resources
+	// required to run tasks with this engine. The worker calls this before
+	// claiming any tasks, and will refuse to start if an error is returned.
+	//
+	// Implementors should return an error explaining what is missing and how to
+	// fix it, rather than waiting for tasks to fail with internal errors.
+	PreflightCheck() error
+
+	// VerifyHost checks that the host hasn't been contaminated by a task, the
+	// worker calls this after each task, when the ResultSet or SandboxBuilder
+	// has been disposed. Other sandboxes may still be running, so engines must
+	// only report resources that can't be accounted for, such as leftover
+	// processes, leaked mounts or modified network configuration.
+	//
+	// Engines should attempt to repair contamination where possible, and return
+	// an error describing what was found. The worker will report the error and
+	// run garbage collection, and if verification fails repeatedly the worker
+	// may be quarantined or stopped so the host can be rebooted.
+	VerifyHost() error
+
 	// Dispose cleans up any resources held by the engine. The engine object
 	// cannot be used after Dispose() has been called.
 	//
@@ -129,6 +157,11 @@ type Engine interface {
 type Capabilities struct {
 	// Maximum number of parallel sandboxes, leave 0 if unbounded.
 	MaxConcurrency int
+	// Insecure is true, if sandboxes aren't isolated from the host, or from
+	// each other. The worker refuses to claim tasks from a queue that isn't
+	// running on the local machine, when using an insecure engine, as this is
+	// only for development.
+	Insecure bool
 	// Note: the zero value of Capabilities should always indicate the sane
 	// defaults, typically that a feature isn't supported.
 }
@@ -153,6 +186,12 @@ func (EngineBase) PayloadSchema() schematypes.Object {
 	return schematypes.Object{}
 }
 
+// PayloadMigrations returns no migrations, as the payload format has never
+// changed.
+func (EngineBase) PayloadMigrations() []runtime.PayloadMigration {
+	return nil
+}
+
 // Capabilities returns an zero value Capabilities struct indicating that
 // most features aren't supported.
 func (EngineBase) Capabilities() Capabilities {
@@ -177,6 +216,16 @@ func (EngineBase) NewVolume(options interface{}) (Volume, error) {
 	return nil, ErrFeatureNotSupported
 }
 
+// PreflightCheck trivially passes, as no host requirements are known.
+func (EngineBase) PreflightCheck() error {
+	return nil
+}
+
+// VerifyHost trivially passes, as no contamination can be detected.
+func (EngineBase) VerifyHost() error {
+	return nil
+}
+
 // Dispose trivially implements cleanup by doing nothing.
 func (EngineBase) Dispose() error {
 	return nil
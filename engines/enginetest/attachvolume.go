@@ -111,10 +111,33 @@ func (c *VolumeTestCase) TestReadToReadOnlyVolume() {
 	}
 }
 
+// TestVolumeDiskSize tests that DiskSize of a volume grows when written to,
+// unless the engine doesn't support DiskSize.
+func (c *VolumeTestCase) TestVolumeDiskSize() {
+	c.ensureEngine()
+	volume, err := c.engine.NewVolume(map[string]interface{}{})
+	nilOrPanic(err, "Failed to create a new cache folder")
+	defer evalNilOrPanic(volume.Dispose, "Failed to dispose cache folder")
+	empty, err := volume.DiskSize()
+	if err == engines.ErrFeatureNotSupported {
+		return
+	}
+	nilOrPanic(err, "Failed to get DiskSize of empty volume")
+	if !c.writeVolume(volume, false) {
+		log.Panic("Running with writeVolumePayload didn't finish successfully")
+	}
+	size, err := volume.DiskSize()
+	nilOrPanic(err, "Failed to get DiskSize of volume")
+	if size <= empty {
+		log.Panicf("Expected DiskSize to grow from %d bytes after writing, got %d bytes", empty, size)
+	}
+}
+
 // Test runs all tests on the test case.
 func (c *VolumeTestCase) Test() {
 	c.TestWriteReadVolume()
 	c.TestReadEmptyVolume()
 	c.TestWriteToReadOnlyVolume()
 	c.TestReadToReadOnlyVolume()
+	c.TestVolumeDiskSize()
 }
@@ -0,0 +1,12 @@
+// Package localproxy provides a server that exposes proxies attached to a
+// sandbox on a TCP listener, for engines where processes in the sandbox share
+// a network with the host, such as the native and docker engines.
+//
+// Requests are only forwarded if the URL path starts with a random token
+// unique to the server, hence, processes not given the proxy URL cannot use
+// proxies attached to the sandbox.
+package localproxy
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("localproxy")
@@ -0,0 +1,127 @@
+package localproxy
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// NamePattern is the pattern proxy names must match, this covers names like
+// /[a-z]{3,22}/ as required by the engines.SandboxBuilder.AttachProxy contract.
+var NamePattern = regexp.MustCompile(`^[a-z][a-z0-9]{2,21}$`)
+
+// Server serves proxies attached with Attach on a TCP listener.
+type Server struct {
+	m        sync.Mutex
+	listener net.Listener
+	server   *http.Server
+	token    string
+	proxies  map[string]http.Handler
+	closed   bool
+}
+
+// New returns a Server listening on address, which should be given as
+// '<ip>:<port>', use port zero to pick a random port.
+func New(address string) (*Server, error) {
+	token := make([]byte, 20)
+	if _, err := rand.Read(token); err != nil {
+		return nil, errors.Wrap(err, "failed to generate proxy token")
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on '%s' for proxies", address)
+	}
+	s := &Server{
+		listener: listener,
+		token:    hex.EncodeToString(token),
+		proxies:  make(map[string]http.Handler),
+	}
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Attach handler as proxy with given name, returns MalformedPayloadError if
+// name doesn't match NamePattern and ErrNamingConflict if the name is in use.
+func (s *Server) Attach(name string, handler http.Handler) error {
+	if !NamePattern.MatchString(name) {
+		return runtime.NewMalformedPayloadError(
+			"proxy name: '", name, "' doesn't match: ", NamePattern.String(),
+		)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.proxies[name]; ok {
+		return engines.ErrNamingConflict
+	}
+	s.proxies[name] = handler
+	return nil
+}
+
+// URL returns the URL at which the proxy with given name is exposed, the URL
+// ends with a slash.
+func (s *Server) URL(name string) string {
+	return "http://" + s.listener.Addr().String() + "/" + s.token + "/" + name + "/"
+}
+
+// Token returns the secret token included in URLs returned from URL(), this
+// should be registered as secret with the TaskContext, so it's redacted from
+// the task log.
+func (s *Server) Token() string {
+	return s.token
+}
+
+// EnvironmentVariable returns the name of the environment variable used for
+// exposing the URL of the proxy with given name to the sandbox.
+func EnvironmentVariable(name string) string {
+	return strings.ToUpper(name) + "_URL"
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Path must be on the form: /<token>/<name>/<path>
+	parts := strings.SplitN(r.URL.Path, "/", 4)
+	if len(parts) < 3 || subtle.ConstantTimeCompare([]byte(parts[1]), []byte(s.token)) != 1 {
+		debug("rejected request without valid token")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	name := parts[2]
+
+	s.m.Lock()
+	handler := s.proxies[name]
+	s.m.Unlock()
+	if handler == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Remove prefix and set hostname to the name of the proxy
+	r.URL.Path = "/"
+	if len(parts) == 4 {
+		r.URL.Path += parts[3]
+	}
+	r.URL.RawPath = ""
+	r.Host = name
+	handler.ServeHTTP(w, r)
+}
+
+// Close stops the server, this is safe to call more than once.
+func (s *Server) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.server.Close()
+}
@@ -0,0 +1,66 @@
+package localproxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+func TestServer(t *testing.T) {
+	s, err := New("127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	err = s.Attach("myproxy", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.URL.Path + " " + r.URL.RawQuery))
+	}))
+	require.NoError(t, err)
+
+	t.Run("forward", func(t *testing.T) {
+		res, err := http.Get(s.URL("myproxy") + "v1/ping?a=b")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "myproxy /v1/ping a=b", string(data))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		u := strings.Replace(s.URL("myproxy"), s.Token(), "wrong-token", 1)
+		res, err := http.Get(u + "v1/ping")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("unknown proxy", func(t *testing.T) {
+		res, err := http.Get(s.URL("otherproxy") + "v1/ping")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("naming conflict", func(t *testing.T) {
+		err := s.Attach("myproxy", http.NotFoundHandler())
+		require.Equal(t, engines.ErrNamingConflict, err)
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		err := s.Attach("my/proxy", http.NotFoundHandler())
+		_, ok := runtime.IsMalformedPayloadError(err)
+		require.True(t, ok, "expected MalformedPayloadError")
+	})
+
+	t.Run("environment variable", func(t *testing.T) {
+		require.Equal(t, "MYPROXY_URL", EnvironmentVariable("myproxy"))
+	})
+
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+}
@@ -31,6 +31,7 @@ func TestWriteReadVolume(*t.T)       { volumeTestCase.TestWriteReadVolume() }
 func TestReadEmptyVolume(*t.T)       { volumeTestCase.TestReadEmptyVolume() }
 func TestWriteToReadOnlyVolume(*t.T) { volumeTestCase.TestWriteToReadOnlyVolume() }
 func TestReadToReadOnlyVolume(*t.T)  { volumeTestCase.TestReadToReadOnlyVolume() }
+func TestVolumeDiskSize(*t.T)        { volumeTestCase.TestVolumeDiskSize() }
 func TestVolumeTestCase(t *t.T)      { volumeTestCase.Test() }
 
 var loggingTestCase = enginetest.LoggingTestCase{
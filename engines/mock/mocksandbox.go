@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
@@ -163,7 +164,9 @@ var functions = map[string]func(*sandbox, string) (bool, error){
 		if mount == nil || mount.readOnly {
 			return false, nil
 		}
+		mount.volume.m.Lock()
 		mount.volume.files[fileName] = fileData
+		mount.volume.m.Unlock()
 		return true, nil
 	},
 	"read-volume": func(s *sandbox, arg string) (bool, error) {
@@ -176,11 +179,13 @@ var functions = map[string]func(*sandbox, string) (bool, error){
 		if mount == nil {
 			return false, nil
 		}
+		mount.volume.m.Lock()
+		defer mount.volume.m.Unlock()
 		s.context.Log(mount.volume.files[fileName])
 		return mount.volume.files[fileName] != "", nil
 	},
 	"get-url": func(s *sandbox, arg string) (bool, error) {
-		res, err := http.Get(arg)
+		res, err := s.context.NewHTTPClient(runtime.HTTPClientOptions{}).Get(arg)
 		if err != nil {
 			s.context.Log("Failed to get url: ", arg, " err: ", err)
 			return false, nil
@@ -244,6 +249,17 @@ var functions = map[string]func(*sandbox, string) (bool, error){
 		// Should normally only be used if error is reported with Monitor
 		return false, runtime.ErrNonFatalInternalError
 	},
+	"diagnostic-internal-error": func(s *sandbox, arg string) (bool, error) {
+		// Report diagnostics and internal error, which should be uploaded
+		s.context.LogDiagnostic(arg)
+		return false, runtime.ErrNonFatalInternalError
+	},
+	"infrastructure-error": func(s *sandbox, arg string) (bool, error) {
+		return false, runtime.NewInfrastructureError(arg)
+	},
+	"resource-exhausted": func(s *sandbox, arg string) (bool, error) {
+		return false, errors.Wrap(runtime.NewResourceExhaustedError(arg), "mock engine failed")
+	},
 	"malformed-payload-after-start": func(s *sandbox, arg string) (bool, error) {
 		return false, runtime.NewMalformedPayloadError(s.payload.Argument)
 	},
@@ -15,9 +15,12 @@ type shell struct {
 	stdin  io.WriteCloser
 	stdout io.ReadCloser
 	stderr io.ReadCloser
-	done   chan struct{}
-	abort  error
-	result bool
+	// writer ends of stdout/stderr, closed when aborted
+	stdoutWriter io.Closer
+	stderrWriter io.Closer
+	done         chan struct{}
+	abort        error
+	result       bool
 }
 
 func newShell() *shell {
@@ -26,10 +29,12 @@ func newShell() *shell {
 	stdinReader, stdinWriter := io.Pipe()
 
 	s := &shell{
-		stdin:  stdinWriter,
-		stdout: stdoutReader,
-		stderr: stderrReader,
-		done:   make(chan struct{}),
+		stdin:        stdinWriter,
+		stdout:       stdoutReader,
+		stderr:       stderrReader,
+		stdoutWriter: stdoutWriter,
+		stderrWriter: stderrWriter,
+		done:         make(chan struct{}),
 	}
 
 	go func() {
@@ -124,6 +129,10 @@ func (s *shell) Abort() error {
 		s.abort = engines.ErrShellAborted
 		s.result = false
 		close(s.done)
+		// Close pipes, like a process that was killed
+		s.stdin.Close()
+		s.stdoutWriter.Close()
+		s.stderrWriter.Close()
 	}
 	return nil
 }
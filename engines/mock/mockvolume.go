@@ -45,3 +45,14 @@ func (v *volume) WriteFile(name string) io.WriteCloser {
 func (v *volume) WriteFolder(name string) error {
 	return nil
 }
+
+func (v *volume) DiskSize() (uint64, error) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	var size uint64
+	for _, data := range v.files {
+		size += uint64(len(data))
+	}
+	return size, nil
+}
@@ -42,6 +42,9 @@ var payloadSchema = schematypes.Object{
 				"malformed-payload-after-start",
 				"fatal-internal-error",
 				"nonfatal-internal-error",
+				"diagnostic-internal-error",
+				"infrastructure-error",
+				"resource-exhausted",
 				"stopNow-sleep",
 			},
 		},
@@ -0,0 +1,15 @@
+// Package mounts defines an engine-neutral payload schema for volumes mounted
+// in sandboxes, such as caches, and adapters that map such mounts to the
+// volume options of a specific engine.
+//
+// A task declares engine specific volume options for each engine it may run
+// on under 'engineOptions', keyed by engine name. Hence, the same task
+// definition can be used with the docker and qemu engines without rewriting
+// the section declaring mounts. Plugins mounting volumes should use an Adapter
+// to build their payload schema and resolve volume options, such that mounts
+// are validated the same way for all plugins.
+package mounts
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("mounts")
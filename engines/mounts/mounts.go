@@ -0,0 +1,113 @@
+package mounts
+
+import (
+	"fmt"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Mount is an engine-neutral description of a volume to be mounted in a
+// sandbox, see Adapter.Schema() for the payload schema.
+type Mount struct {
+	Name          string                 `json:"name"`
+	MountPoint    string                 `json:"mountPoint"`
+	ReadOnly      bool                   `json:"readOnly"`
+	Preload       interface{}            `json:"preload"`
+	Options       interface{}            `json:"options"`       // options for the current engine
+	EngineOptions map[string]interface{} `json:"engineOptions"` // engine name -> options
+}
+
+// IsReadOnly returns true, if the volume should be mounted read-only, mounts
+// without a name are always read-only as they may be shared.
+func (m Mount) IsReadOnly() bool {
+	return m.Name == "" || m.ReadOnly
+}
+
+// An Adapter maps engine-neutral mounts to volume options for an engine.
+type Adapter struct {
+	name   string
+	engine engines.Engine
+}
+
+// NewAdapter returns an Adapter for the engine with given name, name may be
+// empty, in which case 'engineOptions' is ignored.
+func NewAdapter(name string, engine engines.Engine) *Adapter {
+	return &Adapter{
+		name:   name,
+		engine: engine,
+	}
+}
+
+// Schema returns the schema for a Mount, using preload as schema for the
+// 'preload' property. If preload is nil, the 'preload' property is omitted.
+func (a *Adapter) Schema(preload schematypes.Schema) schematypes.Object {
+	s := schematypes.Object{
+		Properties: schematypes.Properties{
+			"name": schematypes.String{
+				Title: "Name",
+				Description: util.Markdown(`
+					Name of the volume, volumes with the same name are shared between
+					tasks. Volumes without a name are always mounted read-only.
+				`),
+				Pattern: "^[\\x20-\\x7e]{1,255}$", // printable ascii
+			},
+			"mountPoint": schematypes.String{
+				Title: "Mount Point",
+				Description: util.Markdown(`
+					Location where the volume is mounted in the sandbox, the format
+					depends on the engine, but is typically an absolute path.
+				`),
+			},
+			"readOnly": schematypes.Boolean{
+				Title: "Mount Read-Only",
+				Description: util.Markdown(`
+					Mount a named volume read-only, allowing the volume to be shared
+					with other concurrent tasks mounting it read-only. Tasks mounting
+					the volume read-write take turns having exclusive access, and
+					changes to read-only mounts are never written back to the volume.
+				`),
+			},
+			"options": a.engine.VolumeSchema(),
+			"engineOptions": schematypes.Object{
+				Title: "Engine Specific Options",
+				Description: util.Markdown(`
+					Volume options for each engine the task may run on, keyed by
+					engine name. Only options for the engine used by the worker are
+					validated and used, allowing the task to run on workers with
+					different engines. Ignored if 'options' is given.
+				`),
+				AdditionalProperties: true,
+			},
+		},
+		Required: []string{"mountPoint"},
+	}
+	if preload != nil {
+		s.Properties["preload"] = preload
+	}
+	return s
+}
+
+// VolumeOptions returns the volume options for the engine, as declared by m.
+//
+// Returns a MalformedPayloadError, if the options don't satisfy the volume
+// schema of the engine.
+func (a *Adapter) VolumeOptions(m Mount) (interface{}, error) {
+	options := m.Options
+	if options == nil && a.name != "" {
+		options = m.EngineOptions[a.name]
+	}
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+	if err := a.engine.VolumeSchema().Validate(options); err != nil {
+		debug("invalid volume options for mountPoint: '%s', error: %s", m.MountPoint, err)
+		return nil, runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"volume options for mountPoint '%s' doesn't satisfy the volume schema for the '%s' engine: %s",
+			m.MountPoint, a.name, err,
+		))
+	}
+	return options, nil
+}
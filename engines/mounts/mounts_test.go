@@ -0,0 +1,85 @@
+package mounts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// testEngine has the empty volume schema from EngineBase, which doesn't allow
+// any options
+type testEngine struct {
+	engines.EngineBase
+}
+
+func (testEngine) PayloadSchema() schematypes.Object {
+	return schematypes.Object{}
+}
+
+func (testEngine) NewSandboxBuilder(engines.SandboxOptions) (engines.SandboxBuilder, error) {
+	return nil, engines.ErrFeatureNotSupported
+}
+
+func newTestAdapter() *Adapter {
+	return NewAdapter("mock", testEngine{})
+}
+
+func TestVolumeOptions(t *testing.T) {
+	a := newTestAdapter()
+
+	// Options for other engines are ignored
+	opts, err := a.VolumeOptions(Mount{
+		MountPoint: "cache",
+		EngineOptions: map[string]interface{}{
+			"docker": map[string]interface{}{"driver": "local"},
+			"mock":   map[string]interface{}{},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{}, opts)
+
+	// Defaults to empty options
+	opts, err = a.VolumeOptions(Mount{MountPoint: "cache"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{}, opts)
+
+	// Options for the engine must satisfy the volume schema
+	_, err = a.VolumeOptions(Mount{
+		MountPoint: "cache",
+		EngineOptions: map[string]interface{}{
+			"mock": map[string]interface{}{"driver": "local"},
+		},
+	})
+	_, ok := runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+}
+
+func TestSchema(t *testing.T) {
+	a := newTestAdapter()
+	s := a.Schema(nil)
+
+	require.NoError(t, s.Validate(map[string]interface{}{
+		"name":       "my-cache",
+		"mountPoint": "/cache",
+		"engineOptions": map[string]interface{}{
+			"docker": map[string]interface{}{},
+			"qemu":   map[string]interface{}{},
+		},
+	}))
+	require.Error(t, s.Validate(map[string]interface{}{
+		"name": "my-cache",
+	}), "mountPoint is required")
+	require.Error(t, s.Validate(map[string]interface{}{
+		"mountPoint": "/cache",
+		"preload":    "https://example.com/cache.tar.gz",
+	}), "preload isn't allowed without a preload schema")
+}
+
+func TestIsReadOnly(t *testing.T) {
+	require.True(t, Mount{MountPoint: "cache"}.IsReadOnly())
+	require.True(t, Mount{Name: "a", MountPoint: "cache", ReadOnly: true}.IsReadOnly())
+	require.False(t, Mount{Name: "a", MountPoint: "cache"}.IsReadOnly())
+}
@@ -1,15 +1,23 @@
 package nativeengine
 
 import (
+	"math"
+
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
 type config struct {
-	Groups     []string `json:"groups,omitempty"`
-	CreateUser bool     `json:"createUser"`
+	Groups               []string `json:"groups,omitempty"`
+	CreateUser           bool     `json:"createUser"`
+	DevInsecure          bool     `json:"devInsecure"`
+	EncryptVolumes       bool     `json:"encryptVolumes"`
+	EncryptedStorageSize int64    `json:"encryptedStorageSize"`
 }
 
+// Default size of encrypted storage, if encryptVolumes is enabled
+const defaultEncryptedStorageSize = 10 * 1024 * 1024 * 1024
+
 var configSchema = schematypes.Object{
 	Title: "Native Engine Config",
 	Description: util.Markdown(`
@@ -39,7 +47,48 @@ var configSchema = schematypes.Object{
 				It runs the command from within the user's home directory.
 				If 'false', the command runs without changing userid, hence, tasks
 				will run with the same user as the worker does.
+
+				**Tasks aren't isolated** when this is 'false', the engine is then
+				reported as insecure, and the worker will refuse to claim tasks from
+				a queue that isn't running on the local machine.
+			`),
+		},
+		"devInsecure": schematypes.Boolean{
+			Title: "Insecure Development Mode",
+			Description: util.Markdown(`
+				Run tasks as the user running the worker without any isolation, so
+				plugins and payloads can be developed without root privileges.
+
+				**This is insecure**, tasks have full access to the files and
+				credentials of the user running the worker. The worker will refuse
+				to claim tasks from a queue that isn't running on the local machine,
+				such as the queue served by 'taskcluster-worker fake-queue'. This
+				cannot be combined with 'createUser'.
+			`),
+		},
+		"encryptVolumes": schematypes.Boolean{
+			Title: "Encrypt Volumes",
+			Description: util.Markdown(`
+				If enabled the native engine will create a filesystem on a dm-crypt
+				encrypted loopback device, with an ephemeral key generated at
+				start-up. Volumes, such as persistent caches, are stored in this
+				filesystem, such that their contents doesn't persist in plaintext on
+				disks that are recycled.
+
+				The key is never written to disk, so volumes will not survive a
+				reboot. This is only supported on linux, requires 'losetup',
+				'cryptsetup' and 'mkfs.ext4', and the worker must run as root.
+			`),
+		},
+		"encryptedStorageSize": schematypes.Integer{
+			Title: "Encrypted Storage Size",
+			Description: util.Markdown(`
+				Size of the encrypted filesystem in bytes, if 'encryptVolumes' is
+				enabled. The backing file is sparse, so disk space is only consumed
+				as data is written. Defaults to 10 GiB.
 			`),
+			Minimum: 64 * 1024 * 1024,
+			Maximum: math.MaxInt64,
 		},
 	},
 	Required: []string{
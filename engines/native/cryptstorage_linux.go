@@ -0,0 +1,152 @@
+package nativeengine
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// Size of the ephemeral dm-crypt key in bytes, aes-xts with 512 bit key.
+const cryptKeySize = 64
+
+// cryptStorage is a runtime.TemporaryStorage backed by a filesystem on a
+// dm-crypt encrypted loopback device. The key is generated when the storage
+// is created and never written to disk, hence, data stored will be unreadable
+// once the storage is disposed or the machine is rebooted.
+type cryptStorage struct {
+	runtime.TemporaryFolder
+	backingFile string
+	loopDevice  string
+	mapperName  string
+	mountPoint  string
+}
+
+// runCommand executes a command with stdin, returning an error including
+// stdout and stderr if the command fails.
+func runCommand(stdin []byte, args ...string) (string, error) {
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	c := exec.Command(args[0], args[1:]...)
+	if stdin != nil {
+		c.Stdin = bytes.NewReader(stdin)
+	}
+	c.Stdout = stdout
+	c.Stderr = stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("Command failed: %v, error: %s, stdout: '%s', stderr: '%s'",
+			args, err, stdout.String(), stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// newCryptStorage creates an encrypted filesystem of given size in bytes,
+// using a backing file from storage.
+func newCryptStorage(storage runtime.TemporaryStorage, size int64) (*cryptStorage, error) {
+	s := &cryptStorage{
+		backingFile: storage.NewFilePath(),
+		mountPoint:  storage.NewFilePath(),
+		mapperName:  "tc-worker-volumes-" + strings.ToLower(slugid.Nice()),
+	}
+
+	// Create sparse backing file
+	f, err := os.Create(s.backingFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create backing file for encrypted storage")
+	}
+	err = f.Truncate(size)
+	f.Close()
+	if err != nil {
+		s.Dispose()
+		return nil, errors.Wrap(err, "failed to allocate backing file for encrypted storage")
+	}
+
+	// Attach backing file to a loopback device
+	s.loopDevice, err = runCommand(nil, "losetup", "--find", "--show", s.backingFile)
+	if err != nil {
+		s.Dispose()
+		return nil, errors.Wrap(err, "failed to setup loopback device")
+	}
+
+	// Generate ephemeral key, this is never written to disk
+	key := make([]byte, cryptKeySize)
+	if _, err = rand.Read(key); err != nil {
+		s.Dispose()
+		return nil, errors.Wrap(err, "failed to generate encryption key")
+	}
+	_, err = runCommand(key, "cryptsetup", "open", "--type", "plain",
+		"--cipher", "aes-xts-plain64", "--key-size", fmt.Sprintf("%d", cryptKeySize*8),
+		"--key-file", "-", s.loopDevice, s.mapperName,
+	)
+	for i := range key {
+		key[i] = 0
+	}
+	if err != nil {
+		s.mapperName = ""
+		s.Dispose()
+		return nil, errors.Wrap(err, "failed to open dm-crypt device")
+	}
+
+	// Create filesystem and mount it
+	device := filepath.Join("/dev/mapper", s.mapperName)
+	if _, err = runCommand(nil, "mkfs.ext4", "-q", "-F", device); err != nil {
+		s.Dispose()
+		return nil, errors.Wrap(err, "failed to create filesystem on encrypted device")
+	}
+	if err = os.Mkdir(s.mountPoint, 0700); err != nil {
+		s.Dispose()
+		return nil, errors.Wrap(err, "failed to create mount point for encrypted storage")
+	}
+	if _, err = runCommand(nil, "mount", device, s.mountPoint); err != nil {
+		os.Remove(s.mountPoint)
+		s.mountPoint = ""
+		s.Dispose()
+		return nil, errors.Wrap(err, "failed to mount encrypted filesystem")
+	}
+
+	s.TemporaryFolder, err = runtime.NewTemporaryStorage(s.mountPoint)
+	if err != nil {
+		s.Dispose()
+		return nil, errors.Wrap(err, "failed to create temporary storage in encrypted filesystem")
+	}
+	return s, nil
+}
+
+// Dispose unmounts the filesystem and destroys the encrypted device, after
+// which the data is irrecoverable.
+func (s *cryptStorage) Dispose() error {
+	var errs []string
+	if s.TemporaryFolder != nil {
+		s.TemporaryFolder = nil
+		if _, err := runCommand(nil, "umount", s.mountPoint); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if s.mountPoint != "" {
+		os.Remove(s.mountPoint)
+	}
+	if s.mapperName != "" && s.loopDevice != "" {
+		if _, err := runCommand(nil, "cryptsetup", "close", s.mapperName); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if s.loopDevice != "" {
+		if _, err := runCommand(nil, "losetup", "--detach", s.loopDevice); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if err := os.Remove(s.backingFile); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to dispose encrypted storage: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+// +build !linux
+
+package nativeengine
+
+import (
+	"errors"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+type cryptStorage struct {
+	runtime.TemporaryFolder
+}
+
+func newCryptStorage(storage runtime.TemporaryStorage, size int64) (*cryptStorage, error) {
+	return nil, errors.New("encrypted volume storage is only supported on linux")
+}
+
+func (s *cryptStorage) Dispose() error {
+	return nil
+}
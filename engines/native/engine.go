@@ -1,6 +1,7 @@
 package nativeengine
 
 import (
+	"errors"
 	"fmt"
 
 	schematypes "github.com/taskcluster/go-schematypes"
@@ -15,10 +16,12 @@ type engineProvider struct {
 
 type engine struct {
 	engines.EngineBase
-	environment runtime.Environment
-	monitor     runtime.Monitor
-	config      config
-	groups      []*system.Group
+	environment  runtime.Environment
+	monitor      runtime.Monitor
+	config       config
+	groups       []*system.Group
+	storage      runtime.TemporaryStorage // storage for volumes
+	cryptStorage *cryptStorage            // nil, if encryptVolumes isn't enabled
 }
 
 func init() {
@@ -33,6 +36,16 @@ func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine,
 	var c config
 	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
 
+	if c.DevInsecure {
+		if c.CreateUser {
+			return nil, errors.New("native engine option 'devInsecure' cannot be combined with 'createUser'")
+		}
+		options.Monitor.Warn(
+			"native engine is running in INSECURE DEVELOPMENT MODE, tasks are not isolated " +
+				"and run as the current user with access to all of its files and credentials",
+		)
+	}
+
 	// Load user-groups
 	groups := []*system.Group{}
 	for _, name := range c.Groups {
@@ -46,12 +59,45 @@ func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine,
 		groups = append(groups, group)
 	}
 
-	return &engine{
+	e := &engine{
 		environment: *options.Environment,
 		monitor:     options.Monitor,
 		config:      c,
 		groups:      groups,
-	}, nil
+		storage:     options.Environment.TemporaryStorage,
+	}
+
+	// Setup encrypted storage for volumes, if requested
+	if c.EncryptVolumes {
+		if c.EncryptedStorageSize == 0 {
+			c.EncryptedStorageSize = defaultEncryptedStorageSize
+		}
+		s, err := newCryptStorage(options.Environment.TemporaryStorage, c.EncryptedStorageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup encrypted storage for volumes, error: %s", err)
+		}
+		e.cryptStorage = s
+		e.storage = s
+		options.Monitor.Info("volumes will be stored on encrypted storage")
+	}
+
+	return e, nil
+}
+
+func (e *engine) Capabilities() engines.Capabilities {
+	return engines.Capabilities{
+		// Without a user per task, tasks run as the worker user, unisolated
+		Insecure: e.config.DevInsecure || !e.config.CreateUser,
+	}
+}
+
+// Dispose destroys the encrypted storage, if any, after which the contents
+// of volumes is irrecoverable.
+func (e *engine) Dispose() error {
+	if e.cryptStorage != nil {
+		return e.cryptStorage.Dispose()
+	}
+	return nil
 }
 
 func (e *engine) PayloadSchema() schematypes.Object {
@@ -62,11 +108,43 @@ func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.Sand
 	var p payload
 	schematypes.MustValidateAndMap(payloadSchema, options.Payload, &p)
 
+	if len(p.Command) > 0 && len(p.Commands) > 0 {
+		return nil, runtime.NewMalformedPayloadError(
+			"Only one of 'command' and 'commands' may be specified in the task.payload",
+		)
+	}
+	commands := p.commandList()
+	if len(commands) == 0 {
+		return nil, runtime.NewMalformedPayloadError(
+			"Either 'command' or 'commands' must be specified in the task.payload",
+		)
+	}
+	for i, c := range commands {
+		if len(c.Command) == 0 {
+			return nil, runtime.NewMalformedPayloadError(
+				"Command ", i+1, " in task.payload.commands is empty",
+			)
+		}
+	}
+
+	if e.config.DevInsecure {
+		options.TaskContext.Log(
+			"WARNING: worker is running in insecure development mode, " +
+				"this task is not isolated from the host",
+		)
+	} else if !e.config.CreateUser {
+		options.TaskContext.Log(
+			"WARNING: worker is not creating a user per task, " +
+				"this task is not isolated from the host",
+		)
+	}
+
 	b := &sandboxBuilder{
 		engine:  e,
 		payload: p,
 		context: options.TaskContext,
 		env:     make(map[string]string),
+		mounts:  make(map[string]mount),
 		monitor: options.Monitor,
 	}
 	return b, nil
@@ -69,6 +69,86 @@ func TestLoggingNoUserCreation(t *testing.T) {
 	c.Test()
 }
 
+func TestLoggingMultipleCommands(t *testing.T) {
+	c := enginetest.LoggingTestCase{
+		EngineProvider: provider,
+		Target:         "hello-world",
+		TargetPayload: `{
+			"commands": [
+				{"command": ["sh", "-c", "false"], "continueOnError": true},
+				{"command": ["sh", "-c", "echo \"$GREETING\""], "env": {"GREETING": "hello-world"}}
+			],
+			"commandPolicy": "last"
+		}`,
+		FailingPayload: `{
+			"commands": [
+				{"command": ["sh", "-c", "echo 'hello-world'"]},
+				{"command": ["sh", "-c", "false"], "continueOnError": true},
+				{"command": ["sh", "-c", "true"]}
+			]
+		}`,
+		SilentPayload: `{
+			"commands": [
+				{"command": ["sh", "-c", "true"]},
+				{"command": ["sh", "-c", "false"]},
+				{"command": ["sh", "-c", "echo 'hello-world'"]}
+			],
+			"commandPolicy": "any"
+		}`,
+	}
+
+	c.Test()
+}
+
+func TestCommandTimeout(t *testing.T) {
+	c := enginetest.LoggingTestCase{
+		EngineProvider: provider,
+		Target:         "hello-world",
+		TargetPayload: `{
+			"commands": [
+				{"command": ["sh", "-c", "sleep 30"], "timeout": 1, "continueOnError": true},
+				{"command": ["sh", "-c", "echo 'hello-world'"]}
+			],
+			"commandPolicy": "last"
+		}`,
+		FailingPayload: `{
+			"command": ["sh", "-c", "echo 'hello-world' && sleep 30"],
+			"commandTimeout": 1
+		}`,
+		SilentPayload: `{
+			"command": ["sh", "-c", "true"],
+			"commandTimeout": 30
+		}`,
+	}
+
+	c.Test()
+}
+
+func TestCommandList(t *testing.T) {
+	p := payload{Command: []string{"true"}, CommandTimeout: 5}
+	require.Equal(t, []commandPayload{{Command: []string{"true"}, Timeout: 5}}, p.commandList())
+
+	p = payload{
+		Commands:       []commandPayload{{Command: []string{"a"}}, {Command: []string{"b"}, Timeout: 1}},
+		CommandTimeout: 5,
+	}
+	require.Equal(t, []commandPayload{
+		{Command: []string{"a"}, Timeout: 5},
+		{Command: []string{"b"}, Timeout: 1},
+	}, p.commandList())
+}
+
+func TestResolveCommands(t *testing.T) {
+	require.True(t, resolveCommands(policyAll, []bool{true, true}))
+	require.False(t, resolveCommands(policyAll, []bool{true, false}))
+	require.True(t, resolveCommands("", []bool{true}))
+	require.True(t, resolveCommands(policyLast, []bool{false, true}))
+	require.False(t, resolveCommands(policyLast, []bool{true, false}))
+	require.True(t, resolveCommands(policyAny, []bool{false, true, false}))
+	require.False(t, resolveCommands(policyAny, []bool{false, false}))
+	require.False(t, resolveCommands(policyAll, nil))
+}
+
 func TestEnvironmentVariables(t *testing.T) {
 	c := enginetest.EnvVarTestCase{
 		EngineProvider: provider,
@@ -87,15 +167,40 @@ func TestEnvironmentVariables(t *testing.T) {
 	c.Test()
 }
 
-/*
+func TestVolumes(t *testing.T) {
+	c := enginetest.VolumeTestCase{
+		EngineProvider: provider,
+		Mountpoint:     "cache/my-volume",
+		WriteVolumePayload: `{
+			"command": ["sh", "-ec", "mkdir -p cache/my-volume/folder && echo 'hello-world' > cache/my-volume/folder/file.txt"]
+		}`,
+		CheckVolumePayload: `{
+			"command": ["sh", "-ec", "grep 'hello-world' cache/my-volume/folder/file.txt"]
+		}`,
+	}
 
-func TestAttachProxy(t *testing.T) {
+	c.Test()
+}
 
+func TestValidMountpoint(t *testing.T) {
+	require.True(t, validMountpoint("cache"))
+	require.True(t, validMountpoint("cache/my-volume"))
+	require.False(t, validMountpoint(""))
+	require.False(t, validMountpoint("."))
+	require.False(t, validMountpoint("/etc"))
+	require.False(t, validMountpoint("../cache"))
+	require.False(t, validMountpoint("cache/../.."))
+	require.False(t, validMountpoint("cache/"))
+	require.True(t, nestedMountpoints("cache", "cache/my-volume"))
+	require.False(t, nestedMountpoints("cache", "cache2"))
+}
+
+func TestAttachProxy(t *testing.T) {
 	c := enginetest.ProxyTestCase{
 		EngineProvider: provider,
-		ProxyName:      "test-proxy",
+		ProxyName:      "testproxy",
 		PingProxyPayload: `{
-			"command": ["sh", "-ec", "echo 'Pinging'; STATUS=$(curl -s -o /tmp/output -w '%{http_code}' http://taskcluster/test-proxy/v1/ping); cat /tmp/output; test $STATUS -eq 200;"]
+			"command": ["sh", "-ec", "echo 'Pinging'; STATUS=$(curl -s -o output.txt -w '%{http_code}' \"${TESTPROXY_URL}v1/ping\"); cat output.txt; test $STATUS -eq 200;"]
 		}`,
 	}
 
@@ -105,7 +210,6 @@ func TestAttachProxy(t *testing.T) {
 	c.TestParallelPings()
 	c.Test()
 }
-*/
 
 func TestArtifacts(t *testing.T) {
 	c := enginetest.ArtifactTestCase{
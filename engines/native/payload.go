@@ -6,17 +6,131 @@ import (
 )
 
 type payload struct {
-	Command []string `json:"command"`
-	Context string   `json:"context"`
+	Command        []string         `json:"command"`
+	Commands       []commandPayload `json:"commands"`
+	CommandPolicy  string           `json:"commandPolicy"`
+	CommandTimeout int              `json:"commandTimeout"`
+	Context        string           `json:"context"`
 }
 
-var payloadSchema = schematypes.Object{
+type commandPayload struct {
+	Command          []string          `json:"command"`
+	ContinueOnError  bool              `json:"continueOnError"`
+	WorkingDirectory string            `json:"workingDirectory"`
+	Env              map[string]string `json:"env"`
+	Timeout          int               `json:"timeout"`
+}
+
+// Maximum value for timeouts, as maxRunTime can't exceed 7 days
+const maxCommandTimeout = 7 * 24 * 60 * 60
+
+// Policies for resolving a task from the exit status of its commands
+const (
+	policyAll  = "all"
+	policyLast = "last"
+	policyAny  = "any"
+)
+
+var commandSchema = schematypes.Object{
+	Title: "Command",
+	Description: util.Markdown(`
+		A command to be executed as part of the task, along with options
+		for how it should be executed.
+	`),
 	Properties: schematypes.Properties{
 		"command": schematypes.Array{
 			Title:       "Command",
 			Description: "Command to execute",
 			Items:       schematypes.String{},
 		},
+		"continueOnError": schematypes.Boolean{
+			Title: "Continue on Error",
+			Description: util.Markdown(`
+				If 'true' the remaining commands will be executed even if this
+				command fails. Defaults to 'false', which stops the task at the
+				first failing command.
+			`),
+		},
+		"workingDirectory": schematypes.String{
+			Title: "Working Directory",
+			Description: util.Markdown(`
+				Folder to run the command from, relative paths are resolved
+				relative to the 'HOME' directory. Defaults to 'HOME'.
+			`),
+		},
+		"env": schematypes.Map{
+			Title: "Environment Overrides",
+			Description: util.Markdown(`
+				Environment variables to set for this command only, these
+				override variables set for the task.
+			`),
+			Values: schematypes.String{},
+		},
+		"timeout": schematypes.Integer{
+			Title: "Timeout",
+			Description: util.Markdown(`
+				Maximum number of seconds this command may run, before it is killed
+				and counted as failed. Defaults to 'commandTimeout'.
+			`),
+			Minimum: 0,
+			Maximum: maxCommandTimeout,
+		},
+	},
+	Required: []string{"command"},
+}
+
+var payloadSchema = schematypes.Object{
+	Properties: schematypes.Properties{
+		"command": schematypes.Array{
+			Title: "Command",
+			Description: util.Markdown(`
+				Command to execute, either 'command' or 'commands' must be
+				specified, but not both.
+			`),
+			Items: schematypes.String{},
+		},
+		"commands": schematypes.Array{
+			Title: "Commands",
+			Description: util.Markdown(`
+				Ordered list of commands to execute, the exit status of each
+				command is written to the task log, and the task is resolved
+				according to 'commandPolicy'.
+
+				This is only supported by the native engine, payloads for other
+				engines take a single 'command'.
+			`),
+			Items: commandSchema,
+		},
+		"commandPolicy": schematypes.StringEnum{
+			Title: "Command Policy",
+			Description: util.Markdown(`
+				Policy for resolving the task from the exit status of 'commands',
+				defaults to 'all'.
+
+				 * 'all', the task succeeds if all commands executed successfully,
+				 * 'last', the task succeeds if the last command executed
+				   successfully, and,
+				 * 'any', the task succeeds if any command executed successfully.
+
+				Commands that were not executed because an earlier command failed
+				without 'continueOnError' count as failed.
+			`),
+			Options: []string{policyAll, policyLast, policyAny},
+		},
+		"commandTimeout": schematypes.Integer{
+			Title: "Command Timeout",
+			Description: util.Markdown(`
+				Maximum number of seconds each command may run, before it is killed
+				and counted as failed, this can be overwritten for individual
+				'commands' using 'timeout'.
+
+				This is distinct from 'maxRunTime' which limits the duration of the
+				entire task, including artifact upload. Omit, or set to zero, to
+				only be limited by 'maxRunTime'.
+			`),
+			Minimum: 0,
+			Maximum: maxCommandTimeout,
+		},
 		"context": schematypes.URI{
 			Title: "Task Context",
 			Description: util.Markdown(`
@@ -25,5 +139,47 @@ var payloadSchema = schematypes.Object{
 			`),
 		},
 	},
-	Required: []string{"command"},
+}
+
+// commandList returns the list of commands to be executed for payload p, with
+// commandTimeout applied to commands that don't have a timeout
+func (p *payload) commandList() []commandPayload {
+	if len(p.Command) > 0 {
+		return []commandPayload{{Command: p.Command, Timeout: p.CommandTimeout}}
+	}
+	commands := make([]commandPayload, len(p.Commands))
+	for i, c := range p.Commands {
+		if c.Timeout == 0 {
+			c.Timeout = p.CommandTimeout
+		}
+		commands[i] = c
+	}
+	return commands
+}
+
+// resolveCommands returns true, if a task with given command results should
+// be resolved successfully according to policy. Commands that were never
+// executed are expected to be reported as failed.
+func resolveCommands(policy string, results []bool) bool {
+	if len(results) == 0 {
+		return false
+	}
+	switch policy {
+	case policyLast:
+		return results[len(results)-1]
+	case policyAny:
+		for _, success := range results {
+			if success {
+				return true
+			}
+		}
+		return false
+	default:
+		for _, success := range results {
+			if !success {
+				return false
+			}
+		}
+		return true
+	}
 }
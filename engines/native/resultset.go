@@ -20,12 +20,17 @@ type resultSet struct {
 	workingFolder runtime.TemporaryFolder
 	user          *system.User
 	success       bool
+	usage         engines.ResourceUsage
 }
 
 func (r *resultSet) Success() bool {
 	return r.success
 }
 
+func (r *resultSet) ResourceUsage() (engines.ResourceUsage, error) {
+	return r.usage, nil
+}
+
 func (r *resultSet) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
 	// Evaluate symlinks
 	p, err := filepath.EvalSymlinks(filepath.Join(r.user.Home(), path))
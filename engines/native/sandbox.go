@@ -2,16 +2,20 @@ package nativeengine
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/localproxy"
 	"github.com/taskcluster/taskcluster-worker/engines/native/system"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
-	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
 type sandbox struct {
@@ -21,8 +25,16 @@ type sandbox struct {
 	monitor       runtime.Monitor
 	workingFolder runtime.TemporaryFolder
 	user          *system.User
-	process       *system.Process
+	commands      []commandPayload
+	policy        string
 	env           map[string]string
+	commandEnv    map[string]string
+	mProcess      sync.Mutex // Guarding process, results and halted
+	process       *system.Process
+	results       []bool
+	halted        bool
+	userTime      time.Duration
+	systemTime    time.Duration
 	resolve       atomics.Once // Guarding resultSet, resultErr and abortErr
 	resultSet     *resultSet
 	resultErr     error
@@ -50,8 +62,13 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 	}()
 
 	if b.engine.config.CreateUser {
-		// Create temporary home folder for the task
-		workingFolder, err = b.engine.environment.TemporaryStorage.NewFolder()
+		// Create temporary home folder for the task, in per-task storage if
+		// available, so it counts towards the disk quota of the task
+		storage := b.context.TemporaryStorage()
+		if storage == nil {
+			storage = b.engine.environment.TemporaryStorage
+		}
+		workingFolder, err = storage.NewFolder()
 		if err != nil {
 			err = fmt.Errorf("Failed to temporary folder, error: %s", err)
 			b.monitor.Error(err)
@@ -71,11 +88,26 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 		}
 	}
 
+	for mountpoint, m := range b.mounts {
+		if err = mountVolume(user, mountpoint, m); err != nil {
+			err = fmt.Errorf("Failed to mount volume at '%s', error: %s", mountpoint, err)
+			b.monitor.Error(err)
+			return nil, err
+		}
+	}
+
 	if b.payload.Context != "" {
-		if err = fetchContext(b.payload.Context, user); err != nil {
-			return nil, runtime.NewMalformedPayloadError(
-				fmt.Sprintf("Error downloading %s: %v", b.payload.Context, err),
-			)
+		if err = fetchContext(b.context, b.payload.Context, user); err != nil {
+			if fetcher.IsUnavailableError(err) {
+				err = runtime.NewInfrastructureError(
+					fmt.Sprintf("Error downloading %s: %v", b.payload.Context, err),
+				)
+			} else {
+				err = runtime.NewMalformedPayloadError(
+					fmt.Sprintf("Error downloading %s: %v", b.payload.Context, err),
+				)
+			}
+			return nil, err
 		}
 	}
 
@@ -88,45 +120,212 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 	env["USER"] = user.Name()
 	env["LOGNAME"] = user.Name()
 
-	// Start process
-	debug("StartProcess: %v", b.payload.Command)
+	s := &sandbox{
+		engine:        b.engine,
+		context:       b.context,
+		monitor:       b.monitor,
+		workingFolder: workingFolder,
+		user:          user,
+		commands:      b.payload.commandList(),
+		policy:        b.payload.CommandPolicy,
+		env:           b.env,
+		commandEnv:    env,
+	}
+
+	// Start the first command, so we can report a malformed payload if it
+	// can't be started
+	if err = s.startCommand(0); err != nil {
+		return nil, err
+	}
+
+	go s.waitForTermination()
+
+	// Stop the server for proxies, once the sandbox is resolved
+	if b.proxies != nil {
+		go func(proxies *localproxy.Server) {
+			s.resolve.Wait()
+			if err := proxies.Close(); err != nil {
+				s.monitor.ReportWarning(err, "failed to close server for proxies")
+			}
+		}(b.proxies)
+	}
+
+	return s, nil
+}
+
+// startCommand starts the i'th command in s.commands and sets s.process
+func (s *sandbox) startCommand(i int) error {
+	c := s.commands[i]
+
+	env := map[string]string{}
+	for k, v := range s.commandEnv {
+		env[k] = v
+	}
+	for k, v := range c.Env {
+		env[k] = v
+	}
+
+	workingFolder := s.user.Home()
+	if c.WorkingDirectory != "" {
+		workingFolder = c.WorkingDirectory
+		if !filepath.IsAbs(workingFolder) {
+			workingFolder = filepath.Join(s.user.Home(), workingFolder)
+		}
+	}
+
+	debug("StartProcess: %v", c.Command)
 	process, err := system.StartProcess(system.ProcessOptions{
-		Arguments:     b.payload.Command,
+		Arguments:     c.Command,
 		Environment:   env,
-		WorkingFolder: user.Home(),
-		Owner:         user,
-		Stdout:        ioext.WriteNopCloser(b.context.LogDrain()),
+		WorkingFolder: workingFolder,
+		Owner:         s.user,
+		Stdout:        ioext.WriteNopCloser(s.context.LogDrain()),
 		// Stderr defaults to Stdout when not specified
 	})
 	if err != nil {
 		// StartProcess provides human-readable error messages (see docs)
 		// We'll convert it to a MalformedPayloadError
-		return nil, runtime.NewMalformedPayloadError(
-			"Unable to start specified command: ", b.payload.Command, " error: ", err,
+		return runtime.NewMalformedPayloadError(
+			"Unable to start specified command: ", c.Command, " error: ", err,
 		)
 	}
+	s.process = process
+	return nil
+}
 
-	s := &sandbox{
-		engine:        b.engine,
-		context:       b.context,
-		monitor:       b.monitor,
-		workingFolder: workingFolder,
-		user:          user,
-		process:       process,
-		env:           b.env,
+// runCommands waits for the current process and starts the remaining
+// commands in order, returns true if the task should be resolved successfully.
+func (s *sandbox) runCommands() bool {
+	for i := range s.commands {
+		s.mProcess.Lock()
+		if s.halted {
+			s.mProcess.Unlock()
+			break
+		}
+		var err error
+		if i > 0 {
+			err = s.startCommand(i)
+		}
+		process := s.process
+		s.mProcess.Unlock()
+
+		success := false
+		if err != nil {
+			s.context.LogError(err.Error())
+		} else {
+			success = s.waitForCommand(i, process)
+		}
+		debug("Command %d finished with: %v", i+1, success)
+
+		if len(s.commands) > 1 {
+			status := "succeeded"
+			if !success {
+				status = "failed"
+			}
+			s.context.Log(fmt.Sprintf(
+				"Command %d/%d %v %s", i+1, len(s.commands), s.commands[i].Command, status,
+			))
+		}
+
+		s.mProcess.Lock()
+		s.results = append(s.results, success)
+		s.mProcess.Unlock()
+
+		if !success && !s.commands[i].ContinueOnError {
+			break
+		}
 	}
 
-	go s.waitForTermination()
+	s.mProcess.Lock()
+	defer s.mProcess.Unlock()
 
-	return s, nil
+	// Commands that were never executed count as failed
+	results := make([]bool, len(s.commands))
+	copy(results, s.results)
+	return resolveCommands(s.policy, results)
+}
+
+// waitForCommand waits for process running the i'th command, killing it if
+// the timeout for the command is exceeded, returns true if the command was
+// successful.
+func (s *sandbox) waitForCommand(i int, process *system.Process) bool {
+	c := s.commands[i]
+	if len(s.commands) > 1 {
+		s.context.Log(fmt.Sprintf("Command %d/%d %v started", i+1, len(s.commands), c.Command))
+	}
+
+	var timer *time.Timer
+	killed := make(chan struct{})
+	if c.Timeout > 0 {
+		timeout := time.Duration(c.Timeout) * time.Second
+		timer = time.AfterFunc(timeout, func() {
+			defer close(killed)
+			s.context.LogError(fmt.Sprintf(
+				"Command %d/%d %v timed out after %s, killing process", i+1, len(s.commands), c.Command, timeout,
+			))
+			system.KillProcessTree(process)
+		})
+	}
+
+	success := process.Wait()
+	userTime, systemTime := process.CPUTime()
+	s.userTime += userTime
+	s.systemTime += systemTime
+
+	// If the timer fired, wait for the process to be killed and count as failed
+	if timer != nil && !timer.Stop() {
+		<-killed
+		return false
+	}
+	return success
+}
+
+// haltCommands prevents further commands from being started and kills the
+// process tree of the current command.
+func (s *sandbox) haltCommands() {
+	s.mProcess.Lock()
+	defer s.mProcess.Unlock()
+
+	s.halted = true
+	system.KillProcessTree(s.process)
+}
+
+// fetchTaskContext is a fetcher.Context that logs progress to the task log
+type fetchTaskContext struct {
+	*runtime.TaskContext
+}
+
+func (c fetchTaskContext) Progress(description string, percent float64) {
+	c.Log(fmt.Sprintf("Fetching context: %s - %.0f %%", description, percent*100))
 }
 
-func fetchContext(context string, user *system.User) error {
+func fetchContext(ctx *runtime.TaskContext, context string, user *system.User) error {
 	// TODO: use future cache subsystem, when we have it
-	// TODO: use the soon to be merged fetcher subsystem
-	filename, err := util.Download(context, user.Home())
+	u, err := url.Parse(context)
 	if err != nil {
-		return fmt.Errorf("Error downloading '%s': %v", context, err)
+		return fmt.Errorf("Invalid URL '%s': %v", context, err)
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = "context"
+	}
+	filename := filepath.Join(user.Home(), name)
+
+	ref, err := fetcher.URL.NewReference(fetchTaskContext{ctx}, context)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Error creating '%s': %v", filename, err)
+	}
+	err = ref.Fetch(fetchTaskContext{ctx}, &fetcher.FileReseter{File: file})
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return err
 	}
 
 	// TODO: verify if this will harm Windows
@@ -228,9 +427,9 @@ func (s *sandbox) abortShells() {
 }
 
 func (s *sandbox) waitForTermination() {
-	// Wait for process to terminate
-	success := s.process.Wait()
-	debug("Process finished with: %v", success)
+	// Run all commands and wait for them to terminate
+	success := s.runCommands()
+	debug("Commands finished with: %v", success)
 
 	// Wait for all shell to finish and prevent new shells from being created
 	s.sessions.WaitAndDrain()
@@ -250,6 +449,10 @@ func (s *sandbox) waitForTermination() {
 			workingFolder: s.workingFolder,
 			user:          s.user,
 			success:       success,
+			usage: engines.ResourceUsage{
+				UserTime:   s.userTime,
+				SystemTime: s.systemTime,
+			},
 		}
 		s.abortErr = engines.ErrSandboxTerminated
 	})
@@ -266,7 +469,7 @@ func (s *sandbox) Kill() error {
 		debug("Sandbox.Kill()")
 
 		// Kill process tree
-		system.KillProcessTree(s.process)
+		s.haltCommands()
 
 		// Abort all shells
 		s.abortShells()
@@ -298,7 +501,7 @@ func (s *sandbox) Abort() error {
 		// In case we didn't create a new user, killing
 		// the children processes is the only safe way
 		// to kill processes created by the task.
-		system.KillProcessTree(s.process)
+		s.haltCommands()
 
 		// Abort all shells
 		s.abortShells()
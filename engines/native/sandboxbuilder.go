@@ -1,19 +1,25 @@
 package nativeengine
 
 import (
+	"net/http"
 	"regexp"
+	"sync"
 
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/localproxy"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 )
 
 type sandboxBuilder struct {
 	engines.SandboxBuilderBase
+	m       sync.Mutex
 	engine  *engine
 	monitor runtime.Monitor
 	payload payload
 	context *runtime.TaskContext
 	env     map[string]string
+	mounts  map[string]mount
+	proxies *localproxy.Server // nil, if no proxies are attached
 }
 
 var envVarPattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
@@ -25,6 +31,8 @@ func (b *sandboxBuilder) SetEnvironmentVariable(name string, value string) error
 			envVarPattern.String(),
 		)
 	}
+	b.m.Lock()
+	defer b.m.Unlock()
 	if _, ok := b.env[name]; ok {
 		return engines.ErrNamingConflict
 	}
@@ -32,6 +40,88 @@ func (b *sandboxBuilder) SetEnvironmentVariable(name string, value string) error
 	return nil
 }
 
+func (b *sandboxBuilder) AttachProxy(hostname string, handler http.Handler) error {
+	if !localproxy.NamePattern.MatchString(hostname) {
+		return runtime.NewMalformedPayloadError(
+			"Proxy hostname: '", hostname, "' is not allowed for native engine. ",
+			"The hostname must match: ", localproxy.NamePattern.String(),
+		)
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	// Proxies are exposed on localhost, with the URL in an environment variable
+	env := localproxy.EnvironmentVariable(hostname)
+	if _, ok := b.env[env]; ok {
+		return engines.ErrNamingConflict
+	}
+	if b.proxies == nil {
+		proxies, err := localproxy.New("127.0.0.1:0")
+		if err != nil {
+			b.monitor.ReportError(err, "failed to start server for proxies")
+			return runtime.ErrNonFatalInternalError
+		}
+		b.proxies = proxies
+		b.context.AddSecret(proxies.Token()) // redact the token from the task log
+	}
+	if err := b.proxies.Attach(hostname, handler); err != nil {
+		return err
+	}
+	b.env[env] = b.proxies.URL(hostname)
+	return nil
+}
+
+func (b *sandboxBuilder) AttachVolume(mountpoint string, v engines.Volume, readOnly bool) error {
+	// Volumes are always created by NewVolume() from this engine
+	vol, ok := v.(*volume)
+	if !ok {
+		panic("AttachVolume: volume wasn't created by the native engine")
+	}
+	if !validMountpoint(mountpoint) {
+		return runtime.NewMalformedPayloadError(
+			"Mountpoint: '", mountpoint, "' is not allowed for native engine. ",
+			"The mountpoint must be a relative path inside the home folder",
+		)
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for other := range b.mounts {
+		if nestedMountpoints(mountpoint, other) {
+			return engines.ErrNamingConflict
+		}
+	}
+	b.mounts[mountpoint] = mount{volume: vol, readOnly: readOnly}
+	return nil
+}
+
 func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
-	return newSandbox(b)
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	s, err := newSandbox(b)
+	if err != nil {
+		b.closeProxies()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (b *sandboxBuilder) Discard() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.closeProxies()
+	return nil
+}
+
+// closeProxies stops the server for proxies, if any, must be called with lock
+func (b *sandboxBuilder) closeProxies() {
+	if b.proxies != nil {
+		if err := b.proxies.Close(); err != nil {
+			b.monitor.ReportWarning(err, "failed to close server for proxies")
+		}
+	}
 }
@@ -24,14 +24,16 @@ const systemPKill = "/usr/bin/pkill"
 
 // Process is a representation of a system process.
 type Process struct {
-	cmd     *exec.Cmd
-	pty     *pty.PTY
-	resolve atomics.Once
-	sockets sync.WaitGroup
-	result  bool
-	stdin   io.ReadCloser
-	stdout  io.WriteCloser
-	stderr  io.WriteCloser
+	cmd        *exec.Cmd
+	pty        *pty.PTY
+	resolve    atomics.Once
+	sockets    sync.WaitGroup
+	result     bool
+	userTime   time.Duration
+	systemTime time.Duration
+	stdin      io.ReadCloser
+	stdout     io.WriteCloser
+	stderr     io.WriteCloser
 }
 
 func pkill(args ...string) error {
@@ -243,6 +245,10 @@ func (p *Process) waitForResult() {
 	// Resolve with result
 	p.resolve.Do(func() {
 		p.result = err == nil
+		if p.cmd.ProcessState != nil {
+			p.userTime = p.cmd.ProcessState.UserTime()
+			p.systemTime = p.cmd.ProcessState.SystemTime()
+		}
 	})
 }
 
@@ -252,6 +258,13 @@ func (p *Process) Wait() bool {
 	return p.result
 }
 
+// CPUTime returns user and system CPU time consumed by the process, this
+// blocks until the process has terminated.
+func (p *Process) CPUTime() (userTime, systemTime time.Duration) {
+	p.resolve.Wait()
+	return p.userTime, p.systemTime
+}
+
 // Kill the process
 func (p *Process) Kill() {
 	p.cmd.Process.Kill()
@@ -6,22 +6,32 @@ import (
 	"fmt"
 	"os"
 	osuser "os/user"
+	"path/filepath"
 	"strconv"
 )
 
-// ChangeOwner changes the owner of filepath to the given user
-func ChangeOwner(filepath string, user *User) error {
+// lookupIDs returns the uid and gid of user
+func lookupIDs(user *User) (uid, gid int, err error) {
 	u, err := osuser.Lookup(user.Name())
 	if err != nil {
-		return fmt.Errorf("Cannot lookup user %s: %v", user.Name(), err)
+		return 0, 0, fmt.Errorf("Cannot lookup user %s: %v", user.Name(), err)
+	}
+	uid, err = strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Cannot convert uid(%s) to int: %v", u.Uid, err)
 	}
-	uid, err := strconv.Atoi(u.Uid)
+	gid, err = strconv.Atoi(u.Gid)
 	if err != nil {
-		return fmt.Errorf("Cannot convert uid(%s) to int: %v", u.Uid, err)
+		return 0, 0, fmt.Errorf("Cannot convert gid(%s) to int: %v", u.Gid, err)
 	}
-	gid, err := strconv.Atoi(u.Gid)
+	return uid, gid, nil
+}
+
+// ChangeOwner changes the owner of filepath to the given user
+func ChangeOwner(filepath string, user *User) error {
+	uid, gid, err := lookupIDs(user)
 	if err != nil {
-		return fmt.Errorf("Cannot convert gid(%s) to int: %v", u.Gid, err)
+		return err
 	}
 	if err = os.Chown(filepath, uid, gid); err != nil {
 		return fmt.Errorf("Can't change owner of %s: %v", filepath, err)
@@ -29,3 +39,22 @@ func ChangeOwner(filepath string, user *User) error {
 
 	return nil
 }
+
+// ChangeOwnerR changes the owner of path and everything inside it to the given
+// user. Symbolic links are not followed, so links created by a previous owner
+// cannot be used to change the owner of files outside path.
+func ChangeOwnerR(path string, user *User) error {
+	uid, gid, err := lookupIDs(user)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+		if err == nil {
+			err = os.Lchown(name, uid, gid)
+		}
+		if err != nil {
+			return fmt.Errorf("Can't change owner of %s: %v", name, err)
+		}
+		return nil
+	})
+}
@@ -138,6 +138,16 @@ func CreateUser(homeFolder string, groups []*Group) (*User, error) {
 		return nil, fmt.Errorf("Failed to run useradd, error: %s", err)
 	}
 
+	// Remove the user, if we fail after it was created, as callers only remove
+	// users that are returned
+	defer func() {
+		if err != nil {
+			if _, derr := exec.Command(systemUserDel, name).Output(); derr != nil {
+				debug("Failed to remove user: %s after error: %s, userdel error: %s", name, err, derr)
+			}
+		}
+	}()
+
 	// Lookup user to get the uid
 	u, err := user.Lookup(name)
 	if err != nil {
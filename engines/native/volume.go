@@ -0,0 +1,137 @@
+package nativeengine
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/native/system"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// volume is a folder in the temporary storage of the worker, read-write
+// volumes are symlinked into the home folder of the task user, and read-only
+// volumes are copied into the home folder, so changes are discarded.
+type volume struct {
+	engines.VolumeBase
+	folder runtime.TemporaryFolder
+}
+
+// mount is a volume attached to a sandboxBuilder
+type mount struct {
+	volume   *volume
+	readOnly bool
+}
+
+func (e *engine) NewVolume(options interface{}) (engines.Volume, error) {
+	// Volumes are mounted in the home folder of a temporary user
+	if !e.config.CreateUser {
+		return nil, engines.ErrFeatureNotSupported
+	}
+	folder, err := e.storage.NewFolder()
+	if err != nil {
+		e.monitor.ReportError(err, "failed to create folder for volume")
+		return nil, runtime.ErrNonFatalInternalError
+	}
+	return &volume{folder: folder}, nil
+}
+
+func (v *volume) DiskSize() (uint64, error) {
+	return ioext.DiskUsage(v.folder.Path())
+}
+
+func (v *volume) Dispose() error {
+	return v.folder.Remove()
+}
+
+// validMountpoint returns true, if mountpoint is a relative slash separated
+// path inside the home folder.
+func validMountpoint(mountpoint string) bool {
+	if mountpoint == "" || path.IsAbs(mountpoint) || path.Clean(mountpoint) != mountpoint {
+		return false
+	}
+	return mountpoint != "." && mountpoint != ".." && !strings.HasPrefix(mountpoint, "../")
+}
+
+// nestedMountpoints returns true, if one mountpoint is inside the other
+func nestedMountpoints(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// mountVolume makes the volume available at mountpoint relative to the home
+// folder of user.
+func mountVolume(user *system.User, mountpoint string, m mount) error {
+	target := filepath.Join(user.Home(), filepath.FromSlash(mountpoint))
+
+	// Create parent folders owned by the user
+	parts := strings.Split(mountpoint, "/")
+	for i := 1; i < len(parts); i++ {
+		folder := filepath.Join(user.Home(), filepath.FromSlash(strings.Join(parts[:i], "/")))
+		if err := os.Mkdir(folder, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		if err := system.ChangeOwner(folder, user); err != nil {
+			return err
+		}
+	}
+
+	if m.readOnly {
+		if err := copyFolder(m.volume.folder.Path(), target); err != nil {
+			return err
+		}
+		return system.ChangeOwnerR(target, user)
+	}
+	if err := system.ChangeOwnerR(m.volume.folder.Path(), user); err != nil {
+		return err
+	}
+	return os.Symlink(m.volume.folder.Path(), target)
+}
+
+// copyFolder copies files, folders and symbolic links from src to dst, which
+// must not exist.
+func copyFolder(src, dst string) error {
+	return filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(name, target, info.Mode().Perm())
+		}
+		return nil // skip sockets, devices, etc.
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
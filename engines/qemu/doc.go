@@ -6,6 +6,10 @@
 //  - dnsmasq-base
 // This is tested against Debian Jessie 64bit, should probably work with most
 // other systems.
+//
+// Volumes are not supported, as the engine has no way to share a host folder
+// or attach an additional disk that the guest will mount, hence, caches cannot
+// be used with this engine.
 package qemuengine
 
 import "github.com/taskcluster/taskcluster-worker/runtime/util"
@@ -1,6 +1,10 @@
 package qemuengine
 
 import (
+	"net"
+	"net/http"
+	"sync"
+
 	"github.com/pkg/errors"
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/engines"
@@ -8,10 +12,13 @@ import (
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/network"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
 	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
 type engine struct {
 	engines.EngineBase
+	m              sync.Mutex
+	etags          map[string]string // last known ETag for image URLs
 	engineConfig   configType
 	defaultMachine vm.Machine
 	monitor        runtime.Monitor
@@ -20,6 +27,8 @@ type engine struct {
 	Environment    *runtime.Environment
 	maxConcurrency int
 	socketFolder   runtime.TemporaryFolder
+	imagePeers     []string
+	peerServer     *http.Server
 }
 
 type engineProvider struct {
@@ -27,16 +36,22 @@ type engineProvider struct {
 }
 
 type configType struct {
-	Network       interface{}      `json:"network"`
-	MachineLimits vm.MachineLimits `json:"limits"`
-	Machine       interface{}      `json:"machine"`
+	Network       interface{}        `json:"network"`
+	MachineLimits vm.MachineLimits   `json:"limits"`
+	Machine       interface{}        `json:"machine"`
+	ImagePeers    *imagePeersConfig  `json:"imagePeers"`
+	ImageMirror   *imageMirrorConfig `json:"imageMirror"`
+	Confinement   vm.Confinement     `json:"confinement"`
 }
 
 var configSchema = schematypes.Object{
 	Properties: schematypes.Properties{
-		"network": network.PoolConfigSchema,
-		"limits":  vm.MachineLimitsSchema,
-		"machine": vm.MachineSchema,
+		"network":     network.PoolConfigSchema,
+		"limits":      vm.MachineLimitsSchema,
+		"machine":     vm.MachineSchema,
+		"imagePeers":  imagePeersSchema,
+		"imageMirror": imageMirrorSchema,
+		"confinement": vm.ConfinementSchema,
 	},
 	Required: []string{
 		"network",
@@ -51,6 +66,9 @@ func (p engineProvider) ConfigSchema() schematypes.Schema {
 func (p engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine, error) {
 	var c configType
 	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+	if err := c.Confinement.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid confinement options")
+	}
 
 	// Create socket folder
 	socketFolder, err := options.Environment.TemporaryStorage.NewFolder()
@@ -68,6 +86,31 @@ func (p engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine
 		return nil, errors.Wrap(err, "failed to create image manager")
 	}
 
+	// Share identical disk images through the content store, if we have one
+	if options.Environment.ContentStore != nil {
+		imageManager.UseContentStore(options.Environment.ContentStore)
+	}
+	imageManager.UseOperationTracker(options.Environment.Operations)
+	imageManager.UseMetrics(options.Environment.Metrics)
+
+	// Serve images to peers, if enabled
+	var imagePeers []string
+	var peerServer *http.Server
+	if c.ImagePeers != nil {
+		maxArchiveSize := c.ImagePeers.MaxArchiveSize
+		if maxArchiveSize == 0 {
+			maxArchiveSize = defaultMaxArchiveSize
+		}
+		imageManager.KeepArchives(maxArchiveSize)
+		listener, lerr := net.Listen("tcp", c.ImagePeers.ListenAddress)
+		if lerr != nil {
+			return nil, errors.Wrap(lerr, "failed to listen for image peers")
+		}
+		peerServer = &http.Server{Handler: imageManager}
+		go peerServer.Serve(listener)
+		imagePeers = c.ImagePeers.Peers
+	}
+
 	// Create network pool
 	networkPool, err := network.NewPool(network.PoolOptions{
 		Config:           c.Network,
@@ -86,6 +129,7 @@ func (p engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine
 
 	// Construct engine object
 	return &engine{
+		etags:          make(map[string]string),
 		engineConfig:   c,
 		defaultMachine: defaultMachine,
 		monitor:        options.Monitor,
@@ -94,6 +138,8 @@ func (p engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine
 		maxConcurrency: networkPool.Size(),
 		Environment:    options.Environment,
 		socketFolder:   socketFolder,
+		imagePeers:     imagePeers,
+		peerServer:     peerServer,
 	}, nil
 }
 
@@ -104,18 +150,37 @@ func (e *engine) Capabilities() engines.Capabilities {
 }
 
 type payloadType struct {
-	Image   interface{} `json:"image"`
-	Command []string    `json:"command"`
-	Machine interface{} `json:"machine,omitempty"`
+	Image          interface{} `json:"image"`
+	Command        []string    `json:"command"`
+	CommandTimeout int         `json:"commandTimeout"`
+	Machine        interface{} `json:"machine,omitempty"`
 }
 
 var payloadSchema = schematypes.Object{
 	Properties: schematypes.Properties{
 		"image": imageFetcher.Schema(),
 		"command": schematypes.Array{
-			Title:       "Command to run",
-			Description: `Command and arguments to execute on the guest.`,
-			Items:       schematypes.String{},
+			Title: "Command to run",
+			Description: util.Markdown(`
+				Command and arguments to execute on the guest.
+
+				Only a single command is supported, use a shell script to run
+				multiple commands.
+			`),
+			Items: schematypes.String{},
+		},
+		"commandTimeout": schematypes.Integer{
+			Title: "Command Timeout",
+			Description: util.Markdown(`
+				Maximum number of seconds the command may run, before it is killed
+				and the task resolved as failed.
+
+				This is distinct from 'maxRunTime' which limits the duration of the
+				entire task, including image download and artifact upload. Omit, or
+				set to zero, to only be limited by 'maxRunTime'.
+			`),
+			Minimum: 0,
+			Maximum: 7 * 24 * 60 * 60,
 		},
 		"machine": vm.MachineSchema,
 	},
@@ -144,6 +209,9 @@ func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.Sand
 }
 
 func (e *engine) Dispose() error {
+	if e.peerServer != nil {
+		e.peerServer.Close()
+	}
 	err := e.networkPool.Dispose()
 	e.networkPool = nil
 	return err
@@ -1,6 +1,7 @@
 package qemuengine
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/taskcluster/taskcluster-worker/runtime"
@@ -23,6 +24,13 @@ type fetchImageContext struct {
 	*runtime.TaskContext
 }
 
+// downloadContext is a fetchImageContext with a context.Context that is
+// canceled when the image download should be aborted.
+type downloadContext struct {
+	context.Context
+	*fetchImageContext
+}
+
 func (c fetchImageContext) Progress(description string, percent float64) {
 	c.Log(fmt.Sprintf("Fetching image: %s - %.0f %%", description, percent*100))
 }
@@ -0,0 +1,219 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ChunkSize is the size of chunks in a ChunkManifest, peers fetch images in
+// chunks of this size, such that a large image can be fetched from multiple
+// peers.
+const ChunkSize = 16 * 1024 * 1024
+
+// A ChunkManifest lists the SHA-256 of each chunk of a retained image file, it
+// is served by ServeHTTP as GET /images/<imageID>/chunks.
+type ChunkManifest struct {
+	Size      int64    `json:"size"`
+	ChunkSize int64    `json:"chunkSize"`
+	Chunks    []string `json:"chunks"` // hex encoded SHA-256 of each chunk
+}
+
+// KeepArchives makes the Manager retain downloaded image files, so they can
+// be served to other workers using ServeHTTP. This must be called before any
+// images are loaded.
+//
+// At most maxSize bytes of image files are retained, when this is exceeded the
+// image files least recently served are deleted. Retained image files are also
+// deleted when the image is garbage collected.
+func (m *Manager) KeepArchives(maxSize int64) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.keepArchives = true
+	m.maxArchiveSize = maxSize
+}
+
+// MarkPublic allows the image with imageID to be served to other workers by
+// ServeHTTP. This should only be called for images that can be fetched without
+// any scopes, as ServeHTTP doesn't authenticate requests.
+func (m *Manager) MarkPublic(imageID string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.public[imageID] = true
+}
+
+// retainArchive keeps archive for sharing, evicting image files least recently
+// served until the total size is within the limit. Returns false, if the image
+// file should be deleted, because it's larger than the limit.
+func (m *Manager) retainArchive(img *image, archive string) bool {
+	info, err := os.Stat(archive)
+	if err != nil {
+		return false
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	size := info.Size()
+	if size > m.maxArchiveSize {
+		return false
+	}
+	for m.archiveSize+size > m.maxArchiveSize {
+		var lru *image
+		for _, other := range m.images {
+			if other.archive != "" && (lru == nil || other.archiveUsed.Before(lru.archiveUsed)) {
+				lru = other
+			}
+		}
+		if lru == nil {
+			break
+		}
+		m.dropArchive(lru)
+	}
+	img.archive = archive
+	img.archiveSize = size
+	img.archiveUsed = time.Now()
+	m.archiveSize += size
+	return true
+}
+
+// dropArchive deletes the retained image file for img, m.m must be held
+func (m *Manager) dropArchive(img *image) {
+	debug("deleting retained image file for image: %s", img.imageID)
+	if err := os.Remove(img.archive); err != nil && !os.IsNotExist(err) {
+		m.monitor.ReportWarning(err, "failed to delete retained image file")
+	}
+	m.archiveSize -= img.archiveSize
+	img.archive = ""
+	img.archiveSize = 0
+	img.chunks = nil
+}
+
+// ServeHTTP serves retained image files on the form GET /images/<imageID>, and
+// chunk manifests on the form GET /images/<imageID>/chunks, this allows workers
+// to fetch images from each other. Image files support range requests, so
+// chunks can be fetched from different workers.
+//
+// Only images that have been fully loaded and marked public with MarkPublic()
+// are served, and imageID must be a content hash such as "sha256=<hex>", as
+// other identifiers may not be safe to share, and cannot be validated by the
+// receiving worker.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/images/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	imageID := strings.TrimPrefix(r.URL.Path, "/images/")
+	manifest := strings.HasSuffix(imageID, "/chunks")
+	imageID = strings.TrimSuffix(imageID, "/chunks")
+	if !IsContentAddressed(imageID) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Find the image, and acquire it so it's not collected while we serve it
+	m.m.Lock()
+	img := m.images[imageID]
+	if img != nil {
+		select {
+		case <-img.done:
+		default:
+			img = nil // still loading
+		}
+	}
+	if img == nil || img.err != nil || img.archive == "" || !m.public[imageID] {
+		m.m.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	img.Acquire()
+	img.archiveUsed = time.Now()
+	archive := img.archive
+	chunks := img.chunks
+	m.m.Unlock()
+	defer img.Release()
+
+	f, err := os.Open(archive)
+	if err != nil {
+		m.monitor.ReportWarning(err, "failed to open retained image file")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	if manifest {
+		if chunks == nil {
+			chunks, err = chunkManifest(f)
+			if err != nil {
+				m.monitor.ReportWarning(err, "failed to hash chunks of retained image file")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			m.m.Lock()
+			if img.archive == archive {
+				img.chunks = chunks
+			}
+			m.m.Unlock()
+		}
+		data, _ := json.Marshal(chunks)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return
+	}
+
+	debug("serving image: %s to %s", imageID, r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+// chunkManifest hashes each chunk of f
+func chunkManifest(f *os.File) (*ChunkManifest, error) {
+	manifest := &ChunkManifest{ChunkSize: ChunkSize, Chunks: []string{}}
+	for {
+		h := sha256.New()
+		n, err := io.CopyN(h, f, ChunkSize)
+		if n > 0 {
+			manifest.Size += n
+			manifest.Chunks = append(manifest.Chunks, hex.EncodeToString(h.Sum(nil)))
+		}
+		if err == io.EOF {
+			return manifest, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// contentHashPattern matches imageIDs from fetcher.URLHash references with a
+// sha256 or sha512 hash, optionally prefixed by the index from fetcher.Combine.
+var contentHashPattern = regexp.MustCompile(`^(?:[0-9]+:)?(sha256|sha512)=([0-9a-f]+)$`)
+
+// ContentHash returns the hash algorithm and hex encoded hash, if imageID is
+// on the form "sha256=<hex>" or "sha512=<hex>".
+func ContentHash(imageID string) (algorithm, hashsum string, ok bool) {
+	m := contentHashPattern.FindStringSubmatch(imageID)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// IsContentAddressed returns true, if imageID is a content hash, see
+// ContentHash().
+func IsContentAddressed(imageID string) bool {
+	_, _, ok := ContentHash(imageID)
+	return ok
+}
@@ -0,0 +1,113 @@
+package image
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+// addArchive adds a loaded image with a retained image file containing data
+func addArchive(t *testing.T, m *Manager, imageID, data string) *image {
+	done := make(chan struct{})
+	close(done)
+	img := &image{imageID: imageID, done: done, manager: m}
+	m.images[imageID] = img
+	archive := filepath.Join(m.imageFolder, imageID+".tar.zst")
+	require.NoError(t, ioutil.WriteFile(archive, []byte(data), 0600))
+	require.True(t, m.retainArchive(img, archive))
+	return img
+}
+
+func TestManagerServeHTTP(t *testing.T) {
+	folder, err := ioutil.TempDir("", "qemu-image-archives-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	m, err := NewManager(folder, nil, mocks.NewMockMonitor(false))
+	require.NoError(t, err)
+	m.KeepArchives(1024)
+
+	const imageID = "sha256=0123456789abcdef"
+	const data = "hello world, this is not really an image"
+	addArchive(t, m, imageID, data)
+
+	get := func(path, rng string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("private image", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, get("/images/"+imageID, "").Code)
+		require.Equal(t, http.StatusNotFound, get("/images/"+imageID+"/chunks", "").Code)
+	})
+
+	m.MarkPublic(imageID)
+
+	t.Run("public image", func(t *testing.T) {
+		w := get("/images/"+imageID, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, data, w.Body.String())
+	})
+
+	t.Run("range", func(t *testing.T) {
+		w := get("/images/"+imageID, "bytes=6-10")
+		require.Equal(t, http.StatusPartialContent, w.Code)
+		require.Equal(t, "world", w.Body.String())
+	})
+
+	t.Run("chunk manifest", func(t *testing.T) {
+		w := get("/images/"+imageID+"/chunks", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var manifest ChunkManifest
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &manifest))
+		require.Equal(t, int64(len(data)), manifest.Size)
+		require.Equal(t, int64(ChunkSize), manifest.ChunkSize)
+		require.Len(t, manifest.Chunks, 1)
+	})
+
+	t.Run("not content addressed", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, get("/images/some-image", "").Code)
+	})
+}
+
+func TestManagerRetainArchive(t *testing.T) {
+	folder, err := ioutil.TempDir("", "qemu-image-archives-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	m, err := NewManager(folder, nil, mocks.NewMockMonitor(false))
+	require.NoError(t, err)
+	m.KeepArchives(10)
+
+	img1 := addArchive(t, m, "sha256=01", "12345")
+	img2 := addArchive(t, m, "sha256=02", "12345")
+	require.Equal(t, int64(10), m.archiveSize)
+
+	// Adding another image file evicts the least recently used
+	img2.archiveUsed = img1.archiveUsed.Add(-1)
+	archive2 := img2.archive
+	img3 := addArchive(t, m, "sha256=03", "123")
+	require.Equal(t, "", img2.archive)
+	require.NotEqual(t, "", img1.archive)
+	require.NotEqual(t, "", img3.archive)
+	require.Equal(t, int64(8), m.archiveSize)
+	_, err = os.Stat(archive2)
+	require.True(t, os.IsNotExist(err))
+
+	// Image files larger than the limit aren't retained
+	archive := filepath.Join(folder, "large")
+	require.NoError(t, ioutil.WriteFile(archive, make([]byte, 11), 0600))
+	require.False(t, m.retainArchive(&image{imageID: "sha256=04"}, archive))
+}
@@ -1,41 +1,65 @@
 package image
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
 	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/cas"
 	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
 )
 
 // Manager loads and tracks images.
 type Manager struct {
-	m           sync.Mutex
-	images      map[string]*image
-	imageFolder string
-	gc          gc.ResourceTracker
-	monitor     runtime.Monitor
+	m            sync.Mutex
+	images       map[string]*image
+	imageFolder  string
+	gc           gc.ResourceTracker
+	monitor      runtime.Monitor
+	keepArchives bool
+	store        *cas.Store
+	ops          *runtime.OperationTracker
+	downloadTime *metrics.Histogram
+
+	// Limit and total size of image files retained for sharing
+	maxArchiveSize int64
+	archiveSize    int64
+	public         map[string]bool // imageIDs that may be served to peers
 }
 
 // Downloader is a function capable of downloading an image to an *os.File.
 // The downloader writes the image file to the imageFile supplied, and returns
-// an error if all retries etc. fails.
-type Downloader func(imageFile *os.File) error
+// an error if all retries etc. fails. The download should be aborted if ctx is
+// canceled, this happens if in-flight operations are canceled.
+type Downloader func(ctx context.Context, imageFile *os.File) error
 
 // image represents an image of which multiple instances can be created
 type image struct {
 	gc.DisposableResource
-	imageID string
-	folder  string
-	machine *vm.Machine
-	done    <-chan struct{}
-	manager *Manager
-	err     error
+	imageID   string
+	folder    string
+	archive   string // downloaded image file, if retained for sharing
+	diskHash  string // hash of disk.img in the content store, if linked from it
+	diskInfo  os.FileInfo
+	layerHash string // SHA-256 of layer.qcow2, verified when creating instances
+	corrupt   bool   // true, if removed from the cache because files changed
+	machine   *vm.Machine
+	done      <-chan struct{}
+	manager   *Manager
+	err       error
+
+	// Size, last time served and chunk manifest of the retained image file
+	archiveSize int64
+	archiveUsed time.Time
+	chunks      *ChunkManifest
 }
 
 // Instance represents an instance of an image.
@@ -55,19 +79,59 @@ func NewManager(imageFolder string, gc gc.ResourceTracker, monitor runtime.Monit
 	}
 	return &Manager{
 		images:      make(map[string]*image),
+		public:      make(map[string]bool),
 		imageFolder: imageFolder,
 		gc:          gc,
 		monitor:     monitor,
 	}, nil
 }
 
+// UseContentStore makes the Manager share identical disk images between cached
+// images using a content-addressed store. This must be called before any
+// images are loaded.
+func (m *Manager) UseContentStore(store *cas.Store) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.store = store
+}
+
+// UseOperationTracker makes the Manager register image downloads with ops, such
+// that garbage collection can wait for images being downloaded and extracted.
+func (m *Manager) UseOperationTracker(ops *runtime.OperationTracker) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.ops = ops
+}
+
+// UseMetrics makes the Manager record the time it takes to download images in
+// the given metrics Registry.
+func (m *Manager) UseMetrics(r *metrics.Registry) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.downloadTime = r.Histogram(
+		"taskcluster_worker_image_download_seconds",
+		"Time it took to download images, not including extraction.",
+		metrics.ExponentialBuckets(1, 2, 12),
+	)
+}
+
 // Instance will return an Instance of the image with imageID. If no such
 // image exists in the cache, download() will be called to download it to a
 // temporary filename.
 //
 // This method will insert the downloaded image into the cache, and ensures that
 // if won't be downloaded twice, if another invocation already is downloading
-// an image with the same imageID.
+// an image with the same imageID. Cached images are garbage collected least
+// recently used first, when the garbage collector detects disk pressure.
+//
+// If imageID is a content hash, see ContentHash(), the downloaded image file
+// is verified against the hash before it is extracted. Before an instance is
+// created, the cached image files are checked for modifications, if the
+// image is found to be corrupt it's removed from the cache and
+// ErrImageCorrupt is returned, such that the next call will download it again.
 //
 // It is the responsibility of the caller to make sure that imageID is a string
 // that uniquely identifies the image. Sane patterns includes "url:<url>", or
@@ -87,8 +151,8 @@ func (m *Manager) Instance(imageID string, download Downloader) (*Instance, erro
 			manager: m,
 		}
 		m.images[imageID] = img
-		// Start loading the image
-		go img.loadImage(download, imageDone)
+		// Start loading the image, registering it as in-flight operation first
+		go img.loadImage(download, imageDone, m.ops.Begin("image-download"))
 	}
 
 	// Acqure the image, so we can release lock without risking the image gets
@@ -103,12 +167,19 @@ func (m *Manager) Instance(imageID string, download Downloader) (*Instance, erro
 		img.Release()
 		return nil, img.err
 	}
-	return img.instance()
+	inst, err := img.instance()
+	if err != nil {
+		img.Release()
+	}
+	return inst, err
 }
 
-func (img *image) loadImage(download Downloader, done chan<- struct{}) {
+func (img *image) loadImage(download Downloader, done chan<- struct{}, op *runtime.Operation) {
+	defer op.Done()
+
 	imageFilePath := filepath.Join(img.manager.imageFolder, slugid.Nice()+".tar.zst")
 	var imageFile *os.File
+	var started time.Time
 
 	// Create image folder
 	err := os.Mkdir(img.folder, 0777)
@@ -125,10 +196,12 @@ func (img *image) loadImage(download Downloader, done chan<- struct{}) {
 	}
 
 	// Download image to tempory file
-	err = download(imageFile)
+	started = time.Now()
+	err = download(op.Context, imageFile)
 	if err != nil {
 		goto cleanup
 	}
+	img.manager.downloadTime.Observe(time.Since(started).Seconds())
 
 	// close image file
 	err = imageFile.Close()
@@ -138,12 +211,55 @@ func (img *image) loadImage(download Downloader, done chan<- struct{}) {
 		goto cleanup
 	}
 
+	// Verify the image file, if imageID declares the hash, as the downloader
+	// may have fetched the image from a peer or mirror
+	if algorithm, expected, ok := ContentHash(img.imageID); ok {
+		var hashsum string
+		hashsum, err = hashFile(imageFilePath, algorithm)
+		if err != nil {
+			err = errors.Wrap(err, "failed to hash image file")
+			goto cleanup
+		}
+		if hashsum != expected {
+			err = fmt.Errorf(
+				"image file doesn't match declared %s, expected: '%s', computed: '%s'",
+				algorithm, expected, hashsum,
+			)
+			goto cleanup
+		}
+	}
+
 	// Extract image and validate image
 	img.machine, err = extractImage(imageFilePath, img.folder)
 	if err != nil {
 		goto cleanup
 	}
 
+	// Replace disk.img with a link to the content store, disk.img is read-only
+	// as it's only used as backing file for layer.qcow2
+	if store := img.manager.store; store != nil {
+		diskFile := filepath.Join(img.folder, "disk.img")
+		hash, serr := store.Import(diskFile)
+		if serr == nil {
+			serr = store.Link(hash, diskFile)
+		}
+		if serr != nil {
+			err = errors.Wrap(serr, "failed to link disk.img from content store")
+			goto cleanup
+		}
+		img.diskHash = hash
+	}
+
+	// Record the state of image files, so we can verify them before use
+	img.diskInfo, err = os.Stat(filepath.Join(img.folder, "disk.img"))
+	if err == nil {
+		img.layerHash, err = hashFile(filepath.Join(img.folder, "layer.qcow2"), "sha256")
+	}
+	if err != nil {
+		err = errors.Wrap(err, "failed to inspect extracted image files")
+		goto cleanup
+	}
+
 	// Clean up if there is any error
 cleanup:
 	// Close image file, if still open
@@ -151,10 +267,11 @@ cleanup:
 		imageFile.Close()
 	}
 
-	// Delete the image file
-	e := os.RemoveAll(imageFilePath)
-	if e != nil {
-		img.manager.monitor.ReportWarning(e, "Failed to delete image file")
+	// Delete the image file, unless we're keeping it for sharing
+	if err != nil || !img.manager.keepArchives || !img.manager.retainArchive(img, imageFilePath) {
+		if e := os.RemoveAll(imageFilePath); e != nil {
+			img.manager.monitor.ReportWarning(e, "Failed to delete image file")
+		}
 	}
 
 	// If there was an err, set img.err and remove it from cache
@@ -186,30 +303,61 @@ func (img *image) Dispose() error {
 	if err := img.CanDispose(); err != nil {
 		return err
 	}
-	// Check that we're not disposing twice
-	if _, ok := img.manager.images[img.imageID]; !ok {
+	// Remove image entry, unless already removed because it's corrupt, in
+	// which case the entry may be a new image with the same imageID
+	if img.manager.images[img.imageID] == img {
+		delete(img.manager.images, img.imageID)
+		delete(img.manager.public, img.imageID)
+	} else if !img.corrupt {
 		panic("Can't dispose an image twice")
 	}
-	// Remove image entry
-	delete(img.manager.images, img.imageID)
 
 	// Delete the image folder
 	if err := os.RemoveAll(img.folder); err != nil {
 		return fmt.Errorf("Failed to delete image folder '%s', error: %s", img.folder, err)
 	}
 
+	// Free disk.img from the content store, if no other image is using it
+	if img.diskHash != "" {
+		if err := img.manager.store.Release(img.diskHash); err != nil {
+			return fmt.Errorf("Failed to release disk.img from content store, error: %s", err)
+		}
+	}
+
+	// Delete the image file, if retained
+	if img.archive != "" {
+		img.manager.dropArchive(img)
+	}
+
 	return nil
 }
 
+// ErrImageCorrupt is returned from Manager.Instance(), if files of a cached
+// image have been modified since the image was extracted.
+var ErrImageCorrupt = errors.New("cached image files have been modified, the image must be downloaded again")
+
 // instance returns a new instance of the image for use in a virtual machine.
 // You must have called image.Acquire() first to prevent garbage collection.
 func (img *image) instance() (*Instance, error) {
-	// Create a copy of layer.qcow2
+	// Check that disk.img hasn't been modified, we don't hash it as it's large
+	diskInfo, err := os.Stat(filepath.Join(img.folder, "disk.img"))
+	if err != nil || diskInfo.Size() != img.diskInfo.Size() || !diskInfo.ModTime().Equal(img.diskInfo.ModTime()) {
+		img.evictCorrupt("disk.img")
+		return nil, ErrImageCorrupt
+	}
+
+	// Create a copy of layer.qcow2, and verify the hash of the data copied
 	diskFile := filepath.Join(img.folder, slugid.Nice()+".qcow2")
-	err := copyFile(filepath.Join(img.folder, "layer.qcow2"), diskFile)
+	hashsum, err := copyFileWithHash(filepath.Join(img.folder, "layer.qcow2"), diskFile)
 	if err != nil {
+		os.Remove(diskFile)
 		return nil, fmt.Errorf("Failed to make copy of layer.qcow2, error: %s", err)
 	}
+	if hashsum != img.layerHash {
+		os.Remove(diskFile)
+		img.evictCorrupt("layer.qcow2")
+		return nil, ErrImageCorrupt
+	}
 
 	return &Instance{
 		image:    img,
@@ -217,6 +365,21 @@ func (img *image) instance() (*Instance, error) {
 	}, nil
 }
 
+// evictCorrupt removes img from the cache, because file has been modified. The
+// image is deleted when garbage collected.
+func (img *image) evictCorrupt(file string) {
+	img.manager.m.Lock()
+	defer img.manager.m.Unlock()
+
+	if img.manager.images[img.imageID] == img {
+		delete(img.manager.images, img.imageID)
+		img.corrupt = true
+		img.manager.monitor.ReportWarning(fmt.Errorf(
+			"%s was modified after image '%s' was extracted", file, img.imageID,
+		), "removing corrupt image from cache")
+	}
+}
+
 // Machine returns the virtual machine configuration for this instance.
 func (i *Instance) Machine() vm.Machine {
 	i.m.Lock()
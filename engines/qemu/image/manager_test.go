@@ -3,10 +3,12 @@
 package image
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -37,14 +39,14 @@ func TestImageManager(t *testing.T) {
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 	go func() {
-		_, err1 = manager.Instance("url:test-image-1", func(target *os.File) error {
+		_, err1 = manager.Instance("url:test-image-1", func(ctx context.Context, target *os.File) error {
 			time.Sleep(100 * time.Millisecond) // Sleep giving the second call time
 			return downloadError
 		})
 		wg.Done()
 	}()
 	time.Sleep(50 * time.Millisecond) // Sleep giving the second call time
-	instance, err2 := manager.Instance("url:test-image-1", func(target *os.File) error {
+	instance, err2 := manager.Instance("url:test-image-1", func(ctx context.Context, target *os.File) error {
 		panic("We shouldn't get here, as the previous download haven't returned")
 	})
 	wg.Done()
@@ -54,7 +56,7 @@ func TestImageManager(t *testing.T) {
 	require.True(t, instance == nil, "Expected instance to nil, when we have an error")
 
 	debug(" - Test instantiation of image")
-	instance, err = manager.Instance("url:test-image-1", func(target *os.File) error {
+	instance, err = manager.Instance("url:test-image-1", func(ctx context.Context, target *os.File) error {
 		f, ferr := os.Open(testImageFile)
 		if ferr != nil {
 			return ferr
@@ -89,7 +91,7 @@ func TestImageManager(t *testing.T) {
 	require.True(t, info != nil, "diskImage for instance deleted after GC")
 
 	debug(" - Make a new instance")
-	instance2, err := manager.Instance("url:test-image-1", func(target *os.File) error {
+	instance2, err := manager.Instance("url:test-image-1", func(ctx context.Context, target *os.File) error {
 		panic("We shouldn't get here, as it is currently in the cache")
 	})
 	require.NoError(t, err, "Failed to create new instance")
@@ -127,8 +129,71 @@ func TestImageManager(t *testing.T) {
 	require.True(t, os.IsNotExist(err), "Expected backingFile to be deleted after GC, file: ", backingFile)
 
 	debug(" - Check that we can indeed reload the image")
-	_, err = manager.Instance("url:test-image-1", func(target *os.File) error {
+	_, err = manager.Instance("url:test-image-1", func(ctx context.Context, target *os.File) error {
 		return downloadError
 	})
 	require.True(t, err == downloadError, "Expected a downloadError", err)
 }
+
+func copyTestImage(ctx context.Context, target *os.File) error {
+	f, err := os.Open(testImageFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(target, f)
+	return err
+}
+
+func TestImageManagerIntegrity(t *testing.T) {
+	gc := &gc.GarbageCollector{}
+	monitor := mocks.NewMockMonitor(true)
+	imageFolder := filepath.Join("/tmp", slugid.Nice())
+	defer os.RemoveAll(imageFolder)
+
+	manager, err := NewManager(imageFolder, gc, monitor)
+	require.NoError(t, err, "Failed to create image manager")
+
+	debug(" - Check that image file is verified against declared hash")
+	wrongHash := "sha256=" + strings.Repeat("0", 64)
+	_, err = manager.Instance(wrongHash, copyTestImage)
+	require.Error(t, err, "Expected hash mismatch")
+	require.Contains(t, err.Error(), "doesn't match declared sha256")
+
+	hashsum, err := hashFile(testImageFile, "sha256")
+	require.NoError(t, err)
+	instance, err := manager.Instance("sha256="+hashsum, copyTestImage)
+	require.NoError(t, err, "Failed to load image with correct hash")
+	instance.Release()
+
+	debug(" - Check that a modified layer.qcow2 is detected")
+	instance, err = manager.Instance("url:test-image-2", copyTestImage)
+	require.NoError(t, err)
+	layer := filepath.Join(filepath.Dir(instance.DiskFile()), "layer.qcow2")
+	instance.Release()
+	f, err := os.OpenFile(layer, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("garbage"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = manager.Instance("url:test-image-2", func(ctx context.Context, target *os.File) error {
+		panic("We shouldn't get here, as it is currently in the cache")
+	})
+	require.Equal(t, ErrImageCorrupt, err)
+
+	debug(" - Check that the corrupt image is downloaded again")
+	downloaded := false
+	instance, err = manager.Instance("url:test-image-2", func(ctx context.Context, target *os.File) error {
+		downloaded = true
+		return copyTestImage(ctx, target)
+	})
+	require.NoError(t, err)
+	require.True(t, downloaded, "Expected image to be downloaded again")
+	instance.Release()
+
+	debug(" - Garbage collect everything")
+	require.NoError(t, gc.CollectAll(), "gc.CollectAll() failed")
+	_, err = os.Lstat(layer)
+	require.True(t, os.IsNotExist(err), "Expected corrupt image to be deleted after GC")
+}
@@ -52,6 +52,49 @@ func NewMutableImage(folder string, size int, machine *vm.Machine) (*MutableImag
 	}, nil
 }
 
+// NewMutableImageFromDisk creates a MutableImage from an existing disk image
+// in the given format supported by 'qemu-img', such as qcow2 or raw, using the
+// given machine configuration. The disk is converted to a raw disk image, and
+// grown to size in GiB, if it's smaller.
+//
+// The format must be given, as probing the format of a raw disk image could
+// let the guest write a header that changes how the disk is interpreted.
+//
+// This is used when building images from disks prepared elsewhere.
+func NewMutableImageFromDisk(diskFile, format, folder string, size int, machine *vm.Machine) (*MutableImage, error) {
+	// Do a sanity check on the size
+	if size > 80 {
+		return nil, errors.New("For sanity we don't allow images larger than 80GiB, ask if you need it")
+	}
+
+	// Convert to a raw disk image, keeping it sparse
+	diskImage := filepath.Join(folder, "disk.img")
+	convert := exec.Command("qemu-img", "convert", "-f", format, "-O", "raw", diskFile, diskImage)
+	if _, err := convert.Output(); err != nil {
+		msg := err.Error()
+		if ee, ok := err.(*exec.ExitError); ok {
+			msg = string(ee.Stderr)
+		}
+		return nil, fmt.Errorf("Failed to convert disk image, error: %s", msg)
+	}
+
+	// Grow the disk image, if smaller than size
+	info, err := os.Stat(diskImage)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to stat converted disk image, error: %s", err)
+	}
+	if info.Size() < int64(size)<<30 {
+		if err = os.Truncate(diskImage, int64(size)<<30); err != nil {
+			return nil, fmt.Errorf("Failed to grow disk image, error: %s", err)
+		}
+	}
+
+	return &MutableImage{
+		folder:  folder,
+		machine: machine,
+	}, nil
+}
+
 // NewMutableImageFromFile creates a mutable image from an existing compressed
 // image tar archive.
 func NewMutableImageFromFile(imageFile, imageFolder string) (*MutableImage, error) {
@@ -1,19 +1,26 @@
 package image
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
-	"net/http"
 	"os"
-
-	"github.com/taskcluster/go-got"
-	"github.com/taskcluster/taskcluster-worker/runtime"
 )
 
 // copyFile copies source to destination, and returns an error if one occurs
 // during opening input or output file, copying data from input to output, or
 // closing input or output file
 func copyFile(source, target string) (err error) {
+	_, err = copyFileWithHash(source, target)
+	return
+}
+
+// copyFileWithHash copies source to target like copyFile, and returns the
+// SHA-256 of the data copied as hex.
+func copyFileWithHash(source, target string) (hashsum string, err error) {
 	var input *os.File
 	var output *os.File
 	input, err = os.Open(source)
@@ -38,65 +45,33 @@ func copyFile(source, target string) (err error) {
 	defer closeFile(output)
 
 	// Copy data
-	_, err = io.Copy(output, input)
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(output, h), input)
+	hashsum = hex.EncodeToString(h.Sum(nil))
 	return
 }
 
-const maxRetries = 7
-
-// DownloadImage returns a Downloader that will download the image from the
-// given url. This will attempt multiple retries if necessary.
-//
-// If there is a non-200 response this will return a MalformedPayloadError.
-func DownloadImage(url string) Downloader {
-	// TODO: Add some logging, I really want to abstract away Logger
-	// TODO: This method could probably exist somewhere else, in say runtime
-	//       downloading from a URL to a file or stream with retries, etc. is a
-	//       common thing. Using range headers for retries and getting integrity
-	//       checks right is hard.
-	return func(target *os.File) error {
-		attempt := 1
-		for {
-			// Move to start of file and truncate the file
-			_, err := target.Seek(0, 0)
-			if err != nil {
-				panic("Unable to seek to file start")
-			}
-			err = target.Truncate(0)
-			if err != nil {
-				panic("Unable to truncate file")
-			}
+// hashFile returns the hash of file as hex, using the given algorithm which
+// must be "sha256" or "sha512".
+func hashFile(file, algorithm string) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm: '%s'", algorithm)
+	}
 
-			// Create a GET request
-			res, err := http.Get(url)
-			if err != nil {
-				goto retry
-			}
-			if 500 <= res.StatusCode && res.StatusCode < 600 {
-				err = fmt.Errorf("Image download failed with status code: %d", res.StatusCode)
-				goto retry
-			}
-			if res.StatusCode != 200 {
-				return runtime.NewMalformedPayloadError(
-					"Image download failed with status code: ", res.StatusCode,
-				)
-			}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
 
-			// Copy response to file
-			// TODO: Make integrity check with x-amx-meta-content-sha256 (if present)
-			// TODO: Use range headers for retry, if supported and checksum for
-			//       integrity check is present (otherwise request from start)
-			_, err = io.Copy(target, res.Body)
-			res.Body.Close()
-			if err == nil {
-				return nil
-			}
-		retry:
-			if attempt >= maxRetries {
-				return err
-			}
-			attempt++
-			got.DefaultBackOff.Delay(attempt)
-		}
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
@@ -35,6 +35,7 @@ type MetaService struct {
 	m               sync.Mutex
 	command         []string
 	env             map[string]string
+	timeout         time.Duration
 	logDrain        io.Writer
 	resultCallback  func(bool)
 	environment     *runtime.Environment
@@ -81,6 +82,16 @@ func New(
 	return s
 }
 
+// SetCommandTimeout sets the maximum amount of time the guest may let the
+// command run before killing it, zero implies no timeout.
+//
+// This must be called before the guest requests /engine/v1/execute.
+func (s *MetaService) SetCommandTimeout(timeout time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.timeout = timeout
+}
+
 // ServeHTTP handles request to the meta-data service.
 func (s *MetaService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
@@ -121,9 +132,13 @@ func (s *MetaService) handleExecute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	debug("GET /engine/v1/execute")
+	s.m.Lock()
+	timeout := s.timeout
+	s.m.Unlock()
 	reply(w, http.StatusOK, Execute{
 		Command: s.command,
 		Env:     s.env,
+		Timeout: int(timeout / time.Second),
 	})
 }
 
@@ -4,6 +4,8 @@ package metaservice
 type Execute struct {
 	Env     map[string]string `json:"env"`
 	Command []string          `json:"command"`
+	// Maximum number of seconds the command may run, zero implies no limit
+	Timeout int `json:"timeout,omitempty"`
 }
 
 // List of API error codes for using the Error struct.
@@ -0,0 +1,152 @@
+package qemuengine
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Maximum time to wait for revalidation of an image URL
+const revalidateTimeout = 30 * time.Second
+
+type imageMirrorConfig struct {
+	BaseURL    string `json:"baseUrl"`
+	Revalidate bool   `json:"revalidate"`
+}
+
+var imageMirrorSchema = schematypes.Object{
+	Title: "Image Mirror",
+	Description: util.Markdown(`
+		Fetch images referenced by URL from a local mirror or caching proxy,
+		falling back to the original URL if the mirror fails.
+
+		Images are requested from '<baseUrl>/<original-url>', for example
+		'http://mirror.local/https://example.com/image.tar.zst'. Images
+		referenced with a hash are validated against the hash, also when fetched
+		from the mirror. Images referenced as queue artifacts or by index are
+		always fetched from the queue.
+	`),
+	Properties: schematypes.Properties{
+		"baseUrl": schematypes.URI{
+			Title:       "Mirror Base URL",
+			Description: "Base URL for the mirror, original image URLs are appended to this.",
+		},
+		"revalidate": schematypes.Boolean{
+			Title: "Revalidate Cached Images",
+			Description: util.Markdown(`
+				Revalidate cached images referenced by URL without a hash, using a
+				'HEAD' request to the original URL with 'If-None-Match'. If the 'ETag'
+				has changed the image is downloaded again. Without this, images
+				referenced by URL are cached until garbage collected, even if the
+				resource at the URL changes.
+			`),
+		},
+	},
+	Required: []string{"baseUrl"},
+}
+
+// fetchImageFromMirror attempts to fetch image from the mirror, returns true if
+// successful. If unsuccessful target will have been reset.
+func (e *engine) fetchImageFromMirror(ctx fetcher.Context, image interface{}, target fetcher.WriteReseter) bool {
+	if e.engineConfig.ImageMirror == nil {
+		return false
+	}
+
+	// Rewrite reference to use the mirror, hashes are preserved
+	var mirrored interface{}
+	switch ref := image.(type) {
+	case string:
+		mirrored = e.mirrorURL(ref)
+	case map[string]interface{}:
+		u, ok := ref["url"].(string)
+		if !ok {
+			return false // not a URL reference
+		}
+		m := make(map[string]interface{}, len(ref))
+		for k, v := range ref {
+			m[k] = v
+		}
+		m["url"] = e.mirrorURL(u)
+		mirrored = m
+	default:
+		return false
+	}
+
+	ref, err := imageFetcher.NewReference(ctx, mirrored)
+	if err == nil {
+		err = ref.Fetch(ctx, target)
+	}
+	if err == nil {
+		e.monitor.Count("image-mirror.hit", 1)
+		return true
+	}
+	debug("failed to fetch image from mirror, error: %s", err)
+	e.monitor.Count("image-mirror.miss", 1)
+	if rerr := target.Reset(); rerr != nil {
+		e.monitor.ReportWarning(rerr, "failed to reset target after fetching from mirror")
+	}
+	return false
+}
+
+func (e *engine) mirrorURL(u string) string {
+	return strings.TrimSuffix(e.engineConfig.ImageMirror.BaseURL, "/") + "/" + u
+}
+
+// imageID returns the identifier to cache image under. If revalidation is
+// enabled and image is a plain URL, this includes the current ETag, so that a
+// changed image is downloaded again.
+func (e *engine) imageID(ctx context.Context, client *http.Client, image interface{}, hashKey string) string {
+	u, ok := image.(string)
+	if !ok || e.engineConfig.ImageMirror == nil || !e.engineConfig.ImageMirror.Revalidate {
+		return hashKey
+	}
+
+	e.m.Lock()
+	etag := e.etags[u]
+	e.m.Unlock()
+
+	if current, err := revalidateURL(ctx, client, u, etag); err != nil {
+		debug("failed to revalidate: %s, error: %s", u, err)
+	} else {
+		etag = current
+		e.m.Lock()
+		e.etags[u] = etag
+		e.m.Unlock()
+	}
+
+	if etag == "" {
+		return hashKey
+	}
+	return hashKey + " etag=" + etag
+}
+
+// revalidateURL returns the current ETag for u, given the last known etag
+func revalidateURL(ctx context.Context, client *http.Client, u, etag string) (string, error) {
+	req, err := http.NewRequest(http.MethodHead, u, nil)
+	if err != nil {
+		return "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	ctx, cancel := context.WithTimeout(ctx, revalidateTimeout)
+	defer cancel()
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return etag, nil
+	case http.StatusOK:
+		return res.Header.Get("ETag"), nil
+	default:
+		return etag, nil // let the download report errors
+	}
+}
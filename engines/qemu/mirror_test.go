@@ -0,0 +1,47 @@
+package qemuengine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevalidateURL(t *testing.T) {
+	etag := `"v1"`
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodHead, r.Method)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	current, err := revalidateURL(context.Background(), http.DefaultClient, s.URL, "")
+	require.NoError(t, err)
+	require.Equal(t, `"v1"`, current)
+
+	current, err = revalidateURL(context.Background(), http.DefaultClient, s.URL, current)
+	require.NoError(t, err)
+	require.Equal(t, `"v1"`, current, "expected not modified")
+
+	etag = `"v2"`
+	current, err = revalidateURL(context.Background(), http.DefaultClient, s.URL, current)
+	require.NoError(t, err)
+	require.Equal(t, `"v2"`, current, "expected new etag")
+}
+
+func TestMirrorURL(t *testing.T) {
+	e := &engine{engineConfig: configType{
+		ImageMirror: &imageMirrorConfig{BaseURL: "http://mirror.local/"},
+	}}
+	require.Equal(t,
+		"http://mirror.local/https://example.com/image.tar.zst",
+		e.mirrorURL("https://example.com/image.tar.zst"),
+	)
+}
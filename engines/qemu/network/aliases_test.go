@@ -0,0 +1,59 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+// aliasHost records host aliases, other networkHost methods aren't used
+type aliasHost struct {
+	networkHost
+	aliases [][]string
+}
+
+func (h *aliasHost) SetHostAliases(hostnames []string) error {
+	h.aliases = append(h.aliases, hostnames)
+	return nil
+}
+
+func TestHostAliasesScopedToNetwork(t *testing.T) {
+	h := &aliasHost{}
+	p := &Pool{
+		networks: make(map[string]*entry),
+		host:     h,
+		monitor:  mocks.NewMockMonitor(true),
+	}
+	for i, prefix := range []string{"10.0.0", "10.0.1"} {
+		p.networks[prefix] = &entry{
+			index:     i,
+			tapDevice: tapDeviceName(i),
+			ipPrefix:  prefix,
+			pool:      p,
+			aliases:   make(map[string]bool),
+		}
+	}
+
+	n1, err := p.Network()
+	require.NoError(t, err)
+	n2, err := p.Network()
+	require.NoError(t, err)
+
+	require.NoError(t, n1.AddHostAlias("service"))
+	require.NoError(t, n2.AddHostAlias("service"))
+	require.NoError(t, n2.AddHostAlias("other"))
+	require.Equal(t, [][]string{{"service"}, {"other", "service"}}, h.aliases)
+
+	// Aliases are removed when the last network using them is released
+	n2.Release()
+	require.Equal(t, []string{"service"}, h.aliases[len(h.aliases)-1])
+	n1.Release()
+	require.Equal(t, []string{}, h.aliases[len(h.aliases)-1])
+
+	// Networks are reused without the aliases of the previous task
+	n3, err := p.Network()
+	require.NoError(t, err)
+	require.Empty(t, n3.entry.aliases)
+	n3.Release()
+}
@@ -7,9 +7,17 @@
 // address. Request to the meta-data IP will be forwarded to the handler
 // registered for the network instance.
 //
-// This package uses iptables to lock down network and ensure that the virtual
-// machine attached to a TAP device can't contact the meta-data handler of
-// another virtual machine.
+// If configured with 'ipv6Prefix' each TAP device also gets an IPv6 subnet, in
+// which the virtual machine configures an address from router advertisements.
+//
+// This package uses iptables or nftables to lock down network and ensure that
+// the virtual machine attached to a TAP device can't contact the meta-data
+// handler of another virtual machine.
+//
+// Setting up TAP devices, firewall rules and dnsmasq requires root privileges. If
+// configured with 'networkHelper' the Pool asks a privileged helper process,
+// running ServeHelper(), to do this over a narrow RPC interface, allowing the
+// worker itself to run unprivileged.
 package network
 
 import "github.com/taskcluster/taskcluster-worker/runtime/util"
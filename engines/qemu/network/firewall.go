@@ -0,0 +1,72 @@
+package network
+
+import (
+	"os/exec"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/network/openvpn"
+)
+
+// Firewall backends that can be configured, firewallAuto selects a backend
+// based on what is installed on the host.
+const (
+	firewallAuto     = "auto"
+	firewallIPTables = "iptables"
+	firewallNFTables = "nftables"
+)
+
+// A firewall generates the commands for isolating the network of a tap device,
+// see ipTableRules for the rules that must be implemented.
+type firewall interface {
+	// Command returns the name of the binary the commands are executed with
+	Command() string
+	// Rules returns commands to create the rules for tapDevice, or commands to
+	// delete the rules, if delete is true. If ipv6Prefix is non-empty rules for
+	// the IPv6 subnet <ipv6Prefix>::/64 are also created.
+	Rules(tapDevice, ipPrefix, ipv6Prefix string, vpns []*openvpn.VPN, uplink string, delete bool) [][]string
+	// UplinkRules returns commands to move rules for tapDevice referencing the
+	// uplink interface from oldUplink to newUplink, without any window where
+	// traffic is forwarded unfiltered.
+	UplinkRules(tapDevice, ipPrefix, ipv6Prefix string, vpns []*openvpn.VPN, oldUplink, newUplink string) [][]string
+}
+
+// newFirewall returns the firewall backend given by name, if name is
+// firewallAuto iptables is used if installed, otherwise nftables is used if
+// installed.
+func newFirewall(name string) firewall {
+	if name == "" || name == firewallAuto {
+		name = firewallIPTables
+		if _, err := exec.LookPath("iptables"); err != nil {
+			if _, err = exec.LookPath("nft"); err == nil {
+				name = firewallNFTables
+			}
+		}
+		debug("using firewall backend: %s", name)
+	}
+	if name == firewallNFTables {
+		return nfTablesFirewall{}
+	}
+	return ipTablesFirewall{}
+}
+
+// ipTablesFirewall implements firewall using iptables
+type ipTablesFirewall struct{}
+
+func (ipTablesFirewall) Command() string {
+	return "iptables"
+}
+
+func (ipTablesFirewall) Rules(tapDevice, ipPrefix, ipv6Prefix string, vpns []*openvpn.VPN, uplink string, delete bool) [][]string {
+	cmds := ipTableRules(tapDevice, ipPrefix, vpns, uplink, delete)
+	if ipv6Prefix != "" {
+		cmds = append(cmds, ip6TableRules(tapDevice, ipv6Prefix, vpns, uplink, delete)...)
+	}
+	return cmds
+}
+
+func (ipTablesFirewall) UplinkRules(tapDevice, ipPrefix, ipv6Prefix string, vpns []*openvpn.VPN, oldUplink, newUplink string) [][]string {
+	cmds := uplinkRules(tapDevice, ipPrefix, vpns, oldUplink, newUplink)
+	if ipv6Prefix != "" {
+		cmds = append(cmds, uplinkRules6(tapDevice, ipv6Prefix, vpns, oldUplink, newUplink)...)
+	}
+	return cmds
+}
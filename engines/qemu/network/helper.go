@@ -0,0 +1,318 @@
+package network
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ipc"
+)
+
+// Maximum number of networks the helper will create, matches PoolConfigSchema
+const maxSubnets = 100
+
+var (
+	// Interface names are limited to 15 characters by the kernel
+	interfacePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,15}$`)
+	// Values interpolated into dnsmasq configuration, must not contain ',',
+	// '=' or newlines, as these could be used to inject configuration.
+	dnsValuePattern = regexp.MustCompile(`^[a-zA-Z0-9_.:-]*$`)
+	// IPv6 prefix is interpolated into commands and dnsmasq configuration
+	ipv6PrefixRegexp = regexp.MustCompile(ipv6PrefixPattern)
+)
+
+// HelperNetworkArgs are arguments for network methods of the RPC interface
+// exposed by the network helper.
+type HelperNetworkArgs struct {
+	Index     int
+	Uplink    string
+	OldUplink string
+}
+
+// HelperDNSArgs are arguments for the StartDNS method of the RPC interface
+// exposed by the network helper.
+type HelperDNSArgs struct {
+	Subnets      int
+	HostRecords  []hostRecord
+	SRVRecords   []srvRecord
+	SearchDomain string
+	NTPServers   []string
+}
+
+// helperService is the RPC interface exposed by the network helper, it
+// validates all arguments as the caller is less privileged.
+type helperService struct {
+	m        sync.Mutex
+	host     *localHost
+	hostUp   bool
+	dns      bool
+	networks map[int]string // network index to uplink, for networks created
+}
+
+func (s *helperService) SetupHost(_ bool, ok *bool) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if err := s.host.SetupHost(); err != nil {
+		return err
+	}
+	s.hostUp = true
+	*ok = true
+	return nil
+}
+
+func (s *helperService) TeardownHost(_ bool, ok *bool) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if err := s.host.TeardownHost(); err != nil {
+		return err
+	}
+	s.hostUp = false
+	*ok = true
+	return nil
+}
+
+func (s *helperService) CreateNetwork(args HelperNetworkArgs, ok *bool) error {
+	if err := validateNetworkArgs(args, s.host.subnets.Size()); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, exists := s.networks[args.Index]; exists {
+		return fmt.Errorf("network %d has already been created", args.Index)
+	}
+	if err := s.host.CreateNetwork(args.Index, args.Uplink); err != nil {
+		return err
+	}
+	s.networks[args.Index] = args.Uplink
+	*ok = true
+	return nil
+}
+
+func (s *helperService) DestroyNetwork(args HelperNetworkArgs, ok *bool) error {
+	if err := validateNetworkArgs(args, s.host.subnets.Size()); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, exists := s.networks[args.Index]; !exists {
+		return fmt.Errorf("network %d wasn't created by this helper", args.Index)
+	}
+	if err := s.host.DestroyNetwork(args.Index, args.Uplink); err != nil {
+		return err
+	}
+	delete(s.networks, args.Index)
+	*ok = true
+	return nil
+}
+
+func (s *helperService) RepairNetwork(args HelperNetworkArgs, ok *bool) error {
+	if err := validateNetworkArgs(args, s.host.subnets.Size()); err != nil {
+		return err
+	}
+	if !validInterfaceName(args.OldUplink) {
+		return fmt.Errorf("invalid uplink interface name: %q", args.OldUplink)
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, exists := s.networks[args.Index]; !exists {
+		return fmt.Errorf("network %d wasn't created by this helper", args.Index)
+	}
+	if err := s.host.RepairNetwork(args.Index, args.OldUplink, args.Uplink); err != nil {
+		return err
+	}
+	s.networks[args.Index] = args.Uplink
+	*ok = true
+	return nil
+}
+
+func (s *helperService) StartDNS(args HelperDNSArgs, ok *bool) error {
+	if args.Subnets < 1 || args.Subnets > s.host.subnets.Size() {
+		return fmt.Errorf("invalid number of subnets: %d", args.Subnets)
+	}
+	var values []string
+	for _, rec := range args.HostRecords {
+		if len(rec.Names) == 0 {
+			return errors.New("host record must have at least one name")
+		}
+		for _, name := range rec.Names {
+			if name == "" {
+				return errors.New("host record names must not be empty")
+			}
+		}
+		values = append(append(values, rec.Names...), rec.IPv4, rec.IPv6)
+	}
+	for _, srv := range args.SRVRecords {
+		values = append(values, srv.Service, srv.Protocol, srv.Domain, srv.Target)
+	}
+	values = append(append(values, args.SearchDomain), args.NTPServers...)
+	for _, value := range values {
+		if !dnsValuePattern.MatchString(value) {
+			return fmt.Errorf("invalid value in DNS records: %q", value)
+		}
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.dns {
+		return errors.New("dnsmasq has already been started")
+	}
+	if err := s.host.StartDNS(dnsConfig{
+		Subnets:      args.Subnets,
+		HostRecords:  args.HostRecords,
+		SRVRecords:   args.SRVRecords,
+		SearchDomain: args.SearchDomain,
+		NTPServers:   args.NTPServers,
+	}); err != nil {
+		return err
+	}
+	s.dns = true
+	*ok = true
+	return nil
+}
+
+func (s *helperService) SetHostAliases(hostnames []string, ok *bool) error {
+	for _, hostname := range hostnames {
+		if hostname == "" || !dnsValuePattern.MatchString(hostname) {
+			return fmt.Errorf("invalid hostname: %q", hostname)
+		}
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.dns {
+		return errors.New("dnsmasq hasn't been started")
+	}
+	if err := s.host.SetHostAliases(hostnames); err != nil {
+		return err
+	}
+	*ok = true
+	return nil
+}
+
+func (s *helperService) StopDNS(_ bool, ok *bool) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if err := s.host.StopDNS(); err != nil {
+		return err
+	}
+	s.dns = false
+	*ok = true
+	return nil
+}
+
+// cleanup reverts everything not reverted by the worker, this is called when
+// the worker disconnects.
+func (s *helperService) cleanup(monitor runtime.Monitor) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.dns {
+		s.host.StopDNS()
+	}
+	indexes := make([]int, 0, len(s.networks))
+	for index := range s.networks {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		if err := s.host.DestroyNetwork(index, s.networks[index]); err != nil {
+			monitor.ReportWarning(err, "failed to destroy network ", index, " left by worker")
+		}
+	}
+	if s.hostUp {
+		if err := s.host.TeardownHost(); err != nil {
+			monitor.ReportWarning(err, "failed to teardown host network")
+		}
+	}
+}
+
+func validateNetworkArgs(args HelperNetworkArgs, subnets int) error {
+	if args.Index < 0 || args.Index >= subnets {
+		return fmt.Errorf("invalid network index: %d", args.Index)
+	}
+	if !validInterfaceName(args.Uplink) {
+		return fmt.Errorf("invalid uplink interface name: %q", args.Uplink)
+	}
+	return nil
+}
+
+// validInterfaceName returns true, if name is a valid network interface name,
+// '.' and '..' are rejected as they are used as paths in /sys/class/net/
+func validInterfaceName(name string) bool {
+	return interfacePattern.MatchString(name) && name != "." && name != ".."
+}
+
+// ServeHelper runs the privileged network helper, reading credentials from
+// stdin, as written by a Pool configured with 'networkHelper'. This returns
+// when the worker disconnects, after removing any networks left behind.
+//
+// Tap devices are created owned by the user owning the socket the helper
+// connects to, allowing an unprivileged worker to start QEMU with them.
+func ServeHelper(stdin io.Reader, monitor runtime.Monitor) error {
+	line, err := bufio.NewReader(stdin).ReadBytes('\n')
+	if err != nil {
+		return errors.Wrap(err, "failed to read credentials from stdin")
+	}
+	var creds helperCredentials
+	if err = json.Unmarshal(line, &creds); err != nil {
+		return errors.Wrap(err, "failed to parse credentials from stdin")
+	}
+	secret, err := hex.DecodeString(creds.Secret)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse secret from stdin")
+	}
+	if creds.IPv6Prefix != "" && !ipv6PrefixRegexp.MatchString(creds.IPv6Prefix) {
+		return fmt.Errorf("invalid ipv6Prefix: %q", creds.IPv6Prefix)
+	}
+	subnets, err := newSubnetRange(creds.SubnetBase)
+	if err != nil {
+		return err
+	}
+
+	// Find the user owning the socket, this is the user the worker runs as
+	info, err := os.Stat(creds.Address)
+	if err != nil {
+		return errors.Wrap(err, "failed to stat socket")
+	}
+	owner := strconv.Itoa(int(info.Sys().(*syscall.Stat_t).Uid))
+
+	conn, err := ipc.Dial(creds.Address, secret)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	hostsFile, err := ioutil.TempFile("", "tc-worker-hosts-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create hosts file for dnsmasq")
+	}
+	hostsFile.Close()
+
+	s := &helperService{
+		host: newLocalHost(nil, newFirewall(creds.Firewall), subnets, creds.IPv6Prefix, owner, hostsFile.Name(), func(err error) {
+			incidentID := monitor.ReportError(err)
+			monitor.Panic("dnsmasq crashed, incidentID:", incidentID)
+		}),
+		networks: make(map[int]string),
+	}
+	server := rpc.NewServer()
+	if err = server.RegisterName("NetworkHelper", s); err != nil {
+		panic(errors.Wrap(err, "failed to register RPC service"))
+	}
+	monitor.Info("network helper connected to worker, owner uid: ", owner)
+	server.ServeConn(conn)
+
+	monitor.Info("worker disconnected, cleaning up")
+	s.cleanup(monitor)
+	os.Remove(hostsFile.Name())
+	return nil
+}
@@ -0,0 +1,133 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestValidateNetworkArgs(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		Args  HelperNetworkArgs
+		Valid bool
+	}{
+		{"valid", HelperNetworkArgs{Index: 0, Uplink: "eth0"}, true},
+		{"last index", HelperNetworkArgs{Index: 9, Uplink: "ens3.100"}, true},
+		{"negative index", HelperNetworkArgs{Index: -1, Uplink: "eth0"}, false},
+		{"index out of range", HelperNetworkArgs{Index: 10, Uplink: "eth0"}, false},
+		{"empty uplink", HelperNetworkArgs{Index: 0, Uplink: ""}, false},
+		{"uplink too long", HelperNetworkArgs{Index: 0, Uplink: "abcdefghijklmnop"}, false},
+		{"uplink with space", HelperNetworkArgs{Index: 0, Uplink: "eth0 eth1"}, false},
+		{"uplink with semicolon", HelperNetworkArgs{Index: 0, Uplink: "eth0;reboot"}, false},
+		{"uplink with newline", HelperNetworkArgs{Index: 0, Uplink: "eth0\nflush"}, false},
+		{"uplink with slash", HelperNetworkArgs{Index: 0, Uplink: "../eth0"}, false},
+		{"uplink dot", HelperNetworkArgs{Index: 0, Uplink: "."}, false},
+		{"uplink dot-dot", HelperNetworkArgs{Index: 0, Uplink: ".."}, false},
+		{"uplink with option", HelperNetworkArgs{Index: 0, Uplink: "-o"}, true}, // passed as argument, not a flag
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := validateNetworkArgs(tc.Args, 10)
+			if tc.Valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestDNSValuePattern(t *testing.T) {
+	for value, valid := range map[string]bool{
+		"":                     true,
+		"example.com":          true,
+		"my-host_1.local":      true,
+		"10.0.0.1":             true,
+		"fd00:1:2::1":          true,
+		"a,b":                  false,
+		"server=8.8.8.8":       false,
+		"example.com\naddress": false,
+		"example.com\r":        false,
+		"example.com ":         false,
+		"#comment":             false,
+		"/etc/passwd":          false,
+		"example.com\x00":      false,
+		"exämple.com":          false,
+	} {
+		require.Equal(t, valid, dnsValuePattern.MatchString(value), "unexpected result for %q", value)
+	}
+}
+
+func TestStartDNSValidation(t *testing.T) {
+	subnets, err := newSubnetRange("")
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		Name string
+		Args HelperDNSArgs
+	}{
+		{"zero subnets", HelperDNSArgs{Subnets: 0}},
+		{"too many subnets", HelperDNSArgs{Subnets: subnets.Size() + 1}},
+		{"host record without names", HelperDNSArgs{Subnets: 1, HostRecords: []hostRecord{
+			{IPv4: "10.0.0.1"},
+		}}},
+		{"host record with empty name", HelperDNSArgs{Subnets: 1, HostRecords: []hostRecord{
+			{Names: []string{""}, IPv4: "10.0.0.1"},
+		}}},
+		{"host record name injection", HelperDNSArgs{Subnets: 1, HostRecords: []hostRecord{
+			{Names: []string{"host\naddress=/#/10.0.0.1"}, IPv4: "10.0.0.1"},
+		}}},
+		{"host record address injection", HelperDNSArgs{Subnets: 1, HostRecords: []hostRecord{
+			{Names: []string{"host"}, IPv4: "10.0.0.1,10.0.0.2"},
+		}}},
+		{"srv target injection", HelperDNSArgs{Subnets: 1, SRVRecords: []srvRecord{
+			{Service: "ldap", Protocol: "tcp", Domain: "example.com", Target: "a=b"},
+		}}},
+		{"search domain injection", HelperDNSArgs{Subnets: 1, SearchDomain: "example.com\nserver=1.1.1.1"}},
+		{"ntp server injection", HelperDNSArgs{Subnets: 1, NTPServers: []string{"10.0.0.1,10.0.0.2"}}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			// Validation fails before dnsmasq is started, so host isn't used
+			s := &helperService{host: &localHost{subnets: subnets}}
+			var ok bool
+			require.Error(t, s.StartDNS(tc.Args, &ok))
+			require.False(t, ok)
+			require.False(t, s.dns)
+		})
+	}
+}
+
+func TestServeHelperCredentials(t *testing.T) {
+	folder, err := ioutil.TempDir("", "network-helper-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	missing := filepath.Join(folder, "missing.sock")
+
+	for _, tc := range []struct {
+		Name  string
+		Input string
+		Error string
+	}{
+		{"empty input", "", "failed to read credentials"},
+		{"no newline", `{"address": "` + missing + `", "secret": "00"}`, "failed to read credentials"},
+		{"invalid json", "{address: 1}\n", "failed to parse credentials"},
+		{"wrong type", `{"address": 42}` + "\n", "failed to parse credentials"},
+		{"invalid secret", `{"address": "` + missing + `", "secret": "not-hex"}` + "\n", "failed to parse secret"},
+		{"ipv6Prefix injection", `{"address": "` + missing + `", "secret": "00", "ipv6Prefix": "fd00:1:2; reboot"}` + "\n", "invalid ipv6Prefix"},
+		{"ipv6Prefix not ula", `{"address": "` + missing + `", "secret": "00", "ipv6Prefix": "2001:db8:1"}` + "\n", "invalid ipv6Prefix"},
+		{"subnetBase not cidr", `{"address": "` + missing + `", "secret": "00", "subnetBase": "10.0.0.0"}` + "\n", "subnetBase"},
+		{"subnetBase ipv6", `{"address": "` + missing + `", "secret": "00", "subnetBase": "fd00::/48"}` + "\n", "subnetBase"},
+		{"subnetBase too small", `{"address": "` + missing + `", "secret": "00", "subnetBase": "10.0.0.0/25"}` + "\n", "subnetBase"},
+		{"missing socket", `{"address": "` + missing + `", "secret": "00"}` + "\n", "failed to stat socket"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := ServeHelper(strings.NewReader(tc.Input), mocks.NewMockMonitor(true))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.Error)
+		})
+	}
+}
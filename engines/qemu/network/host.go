@@ -0,0 +1,45 @@
+package network
+
+import "strconv"
+
+// networkHost performs the privileged operations required by a Pool.
+//
+// This is implemented in-process by localHost, and by remoteHost which asks a
+// privileged helper process to perform the operations, allowing the worker
+// itself to run unprivileged.
+type networkHost interface {
+	// SetupHost enables IPv4 forwarding and adds metaDataIP to loopback
+	SetupHost() error
+	// TeardownHost removes metaDataIP from loopback
+	TeardownHost() error
+	// CreateNetwork creates tap device and iptables rules for network index
+	CreateNetwork(index int, uplink string) error
+	// DestroyNetwork removes tap device and iptables rules for network index
+	DestroyNetwork(index int, uplink string) error
+	// RepairNetwork ensures the tap device for network index is up with its
+	// address and route, and moves iptables rules if the uplink changed.
+	RepairNetwork(index int, oldUplink, newUplink string) error
+	// StartDNS starts dnsmasq serving DNS and DHCP to all networks
+	StartDNS(config dnsConfig) error
+	// SetHostAliases makes hostnames resolve to metaDataIP, replacing aliases
+	// previously set, so an empty list removes all aliases.
+	SetHostAliases(hostnames []string) error
+	// StopDNS stops dnsmasq
+	StopDNS() error
+	// Close releases resources held by the networkHost
+	Close() error
+}
+
+// dnsConfig is the configuration for dnsmasq given to networkHost.StartDNS
+type dnsConfig struct {
+	Subnets      int
+	HostRecords  []hostRecord
+	SRVRecords   []srvRecord
+	SearchDomain string   // DNS search domain handed out with DHCP, may be empty
+	NTPServers   []string // IPv4 addresses of NTP servers handed out with DHCP
+}
+
+// tapDeviceName returns the name of the tap device for network index
+func tapDeviceName(index int) string {
+	return "tctap" + strconv.Itoa(index)
+}
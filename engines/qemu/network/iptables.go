@@ -1,6 +1,10 @@
 package network
 
-import "github.com/taskcluster/taskcluster-worker/engines/qemu/network/openvpn"
+import (
+	"strconv"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/network/openvpn"
+)
 
 // Maximum time to wait for the xtables lock when using iptables
 const xtableLockWait = "3"
@@ -14,11 +18,11 @@ const xtableLockWait = "3"
 // * DNS server (dnsmasq)
 // * DHCP server (dnsmasq)
 // * Routes connected through VPN
-// * The public IPv4 internet address
+// * The public IPv4 internet address, through the uplink interface
 // In particular we wish to forbid access to other VMs, IP spoofing, and
 // connections other resources within the private network the worker is
 // deployed in.
-func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete bool) [][]string {
+func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, uplink string, delete bool) [][]string {
 	subnet := ipPrefix + ".0/24"
 	gateway := ipPrefix + ".1"
 	prefixCommands := func(prefix []string, rules [][]string) [][]string {
@@ -54,7 +58,7 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 
 	// Rules for nat from this subnet
 	nat := prefixCommands([]string{"iptables", "-w", xtableLockWait, "-t", "nat", ruleAction}, [][]string{
-		{"POSTROUTING", "-o", "eth0", "-s", subnet, "-j", "MASQUERADE"},
+		natUplinkRule(uplink, subnet),
 	})
 
 	// Rules for filtering INPUT from this tap device
@@ -89,13 +93,11 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 	forwardVPNInputRules := [][]string{}  // Will be prepended fwd_input_...
 	forwardVPNOutputRules := [][]string{} // Will be prepended fwd_output_...
 	for _, vpn := range vpns {
-		for _, ip := range vpn.Routes() {
-			ipv4 := ip.To4()
-			if ipv4 == nil {
-				debug("Skipping IPv6 route to VPN: %s", ip.String())
-				continue // Skip IPv6 for now
+		for _, r := range vpn.Routes() {
+			if r.IP.To4() == nil {
+				continue // IPv6 routes are handled by ip6TableRules
 			}
-			route := ipv4.String()
+			route := r.String()
 			// Allow tap device -> VPN, if source subnet and target tap device matches
 			forwardVPNInputRules = append(forwardVPNInputRules, []string{
 				"-d", route, "-o", vpn.DeviceName(), "-s", subnet, "-j", "ACCEPT",
@@ -119,7 +121,7 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 			{"-d", "169.254.0.0/16", "-j", "REJECT", "--reject-with", "icmp-net-unreachable"},
 			{"-d", "192.168.0.0/16", "-j", "REJECT", "--reject-with", "icmp-net-unreachable"},
 			// Allow out-going from this tap device with correct source subnet
-			{"-o", "eth0", "-s", subnet, "-j", "ACCEPT"},
+			fwdInputUplinkRule(uplink, subnet),
 			// Allow tap device -> tap device within allowed subnet
 			{"-o", tapDevice, "-s", subnet, "-j", "ACCEPT"},
 			// Reject all other input for forwarding from tap-device
@@ -138,7 +140,7 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 			{"-s", "169.254.0.0/16", "-j", "DROP"},
 			{"-s", "192.168.0.0/16", "-j", "DROP"},
 			// Allow incoming from this tap device with correct destination (if already established)
-			{"-i", "eth0", "-d", subnet, "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+			fwdOutputUplinkRule(uplink, subnet),
 			// Allow tap device -> tap device within allowed subnet
 			{"-i", tapDevice, "-s", subnet, "-j", "ACCEPT"},
 			// Reject all other output from forwarding to tap-device
@@ -169,3 +171,227 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 
 	return cmds
 }
+
+// Rules that reference the uplink interface, these are used by ipTableRules
+// and uplinkRules, which must agree on the rule specification.
+func natUplinkRule(uplink, subnet string) []string {
+	return []string{"POSTROUTING", "-o", uplink, "-s", subnet, "-j", "MASQUERADE"}
+}
+
+func fwdInputUplinkRule(uplink, subnet string) []string {
+	return []string{"-o", uplink, "-s", subnet, "-j", "ACCEPT"}
+}
+
+func fwdOutputUplinkRule(uplink, subnet string) []string {
+	return []string{"-i", uplink, "-d", subnet, "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"}
+}
+
+// uplinkRules returns commands to move the rules for tapDevice that reference
+// the uplink interface from oldUplink to newUplink.
+//
+// New rules are inserted at the position of the old rules before the old rules
+// are deleted, such that traffic is never forwarded without filtering.
+func uplinkRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, oldUplink, newUplink string) [][]string {
+	subnet := ipPrefix + ".0/24"
+
+	// Uplink rules in fwd_input_ and fwd_output_ chains come after the VPN
+	// forwarding rules and 4 rules for private subnets.
+	routes := 0
+	for _, vpn := range vpns {
+		for _, r := range vpn.Routes() {
+			if r.IP.To4() != nil {
+				routes++
+			}
+		}
+	}
+	position := strconv.Itoa(routes + 5)
+
+	iptables := func(args []string, rule []string) []string {
+		return append(append([]string{"iptables", "-w", xtableLockWait}, args...), rule...)
+	}
+	return [][]string{
+		iptables([]string{"-t", "nat", "-A"}, natUplinkRule(newUplink, subnet)),
+		iptables([]string{"-I", "fwd_input_" + tapDevice, position}, fwdInputUplinkRule(newUplink, subnet)),
+		iptables([]string{"-I", "fwd_output_" + tapDevice, position}, fwdOutputUplinkRule(newUplink, subnet)),
+		iptables([]string{"-t", "nat", "-D"}, natUplinkRule(oldUplink, subnet)),
+		iptables([]string{"-D", "fwd_input_" + tapDevice}, fwdInputUplinkRule(oldUplink, subnet)),
+		iptables([]string{"-D", "fwd_output_" + tapDevice}, fwdOutputUplinkRule(oldUplink, subnet)),
+	}
+}
+
+// ip6TableRules returns a list of commands to append IPv6 rules for tapDevice,
+// or the commands to delete the rules, if delete is true.
+//
+// The rules are similar to the rules from ipTableRules, except that the VM is
+// restricted to IPs from the subnet <ipv6Prefix>::/64, the meta-data service
+// is only available over IPv4, and ICMPv6 is allowed between the VM and the
+// host, as neighbor discovery and router advertisements requires ICMPv6.
+func ip6TableRules(tapDevice string, ipv6Prefix string, vpns []*openvpn.VPN, uplink string, delete bool) [][]string {
+	subnet := ipv6Prefix + "::/64"
+	gateway := ipv6Prefix + "::1"
+	ip6tables := []string{"ip6tables", "-w", xtableLockWait}
+	prefixCommands := func(prefix []string, rules [][]string) [][]string {
+		cmds := [][]string{}
+		for _, rule := range rules {
+			cmds = append(cmds, append(append(append([]string{}, ip6tables...), prefix...), rule...))
+		}
+		return cmds
+	}
+
+	ruleAction := "-A"
+	chainAction := "-N"
+	if delete {
+		ruleAction = "-D"
+		chainAction = "-X"
+	}
+
+	// Create/delete custom chains for this tap device
+	chains := prefixCommands([]string{chainAction}, [][]string{
+		{"input_" + tapDevice},
+		{"output_" + tapDevice},
+		{"fwd_input_" + tapDevice},
+		{"fwd_output_" + tapDevice},
+	})
+
+	// Rules for jumping to custom chains for this tap device
+	rules := prefixCommands([]string{ruleAction}, [][]string{
+		{"INPUT", "-i", tapDevice, "-j", "input_" + tapDevice},
+		{"OUTPUT", "-o", tapDevice, "-j", "output_" + tapDevice},
+		{"FORWARD", "-i", tapDevice, "-j", "fwd_input_" + tapDevice},
+		{"FORWARD", "-o", tapDevice, "-j", "fwd_output_" + tapDevice},
+	})
+
+	// Rules for nat from this subnet
+	nat := prefixCommands([]string{"-t", "nat", ruleAction}, [][]string{
+		natUplinkRule(uplink, subnet),
+	})
+
+	// Rules for filtering INPUT from this tap device
+	inputRules := prefixCommands([]string{ruleAction, "input_" + tapDevice}, [][]string{
+		// Allow neighbor discovery and router solicitation
+		{"-p", "icmpv6", "-j", "ACCEPT"},
+		// Allow DNS requests
+		{"-p", "tcp", "-s", subnet, "-d", gateway, "-m", "tcp", "--dport", "53", "-m", "state", "--state", "NEW,ESTABLISHED", "-j", "ACCEPT"},
+		{"-p", "udp", "-s", subnet, "-d", gateway, "-m", "udp", "--dport", "53", "-m", "state", "--state", "NEW,ESTABLISHED", "-j", "ACCEPT"},
+		// Allow DHCPv6 requests
+		{"-p", "udp", "-m", "udp", "--sport", "546", "--dport", "547", "-j", "ACCEPT"},
+		// Reject all other input
+		{"-j", "REJECT", "--reject-with", "icmp6-addr-unreachable"},
+	})
+
+	// Rules for filtering OUTPUT to this tap device
+	outputRules := prefixCommands([]string{ruleAction, "output_" + tapDevice}, [][]string{
+		// Allow neighbor discovery and router advertisements
+		{"-p", "icmpv6", "-j", "ACCEPT"},
+		// Allow DNS replies from dnsmasq (to subnet only)
+		{"-p", "udp", "-s", gateway, "-d", subnet, "-m", "udp", "--sport", "53", "-m", "state", "--state", "ESTABLISHED", "-j", "ACCEPT"},
+		{"-p", "tcp", "-s", gateway, "-d", subnet, "-m", "tcp", "--sport", "53", "-m", "state", "--state", "ESTABLISHED", "-j", "ACCEPT"},
+		// Allow DHCPv6 replies
+		{"-p", "udp", "-m", "udp", "--sport", "547", "--dport", "546", "-j", "ACCEPT"},
+		// Reject all other output
+		{"-j", "REJECT", "--reject-with", "icmp6-adm-prohibited"},
+	})
+
+	// Create VPN forwarding rules
+	forwardVPNInputRules := [][]string{}  // Will be prepended fwd_input_...
+	forwardVPNOutputRules := [][]string{} // Will be prepended fwd_output_...
+	for _, vpn := range vpns {
+		for _, r := range vpn.Routes() {
+			if r.IP.To4() != nil {
+				continue // IPv4 routes are handled by ipTableRules
+			}
+			route := r.String()
+			forwardVPNInputRules = append(forwardVPNInputRules, []string{
+				"-d", route, "-o", vpn.DeviceName(), "-s", subnet, "-j", "ACCEPT",
+			})
+			forwardVPNOutputRules = append(forwardVPNOutputRules, []string{
+				"-s", route, "-i", vpn.DeviceName(), "-d", subnet, "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT",
+			})
+		}
+	}
+
+	// Rules for filtering FORWARD from this tap device
+	forwardInputRules := prefixCommands([]string{ruleAction, "fwd_input_" + tapDevice}, append(
+		// Allow tap device -> VPN
+		forwardVPNInputRules,
+		[][]string{
+			// Reject out-going from this tap device to unique local and link-local
+			{"-d", "fc00::/7", "-j", "REJECT", "--reject-with", "icmp6-no-route"},
+			{"-d", "fe80::/10", "-j", "REJECT", "--reject-with", "icmp6-no-route"},
+			// Allow out-going from this tap device with correct source subnet
+			fwdInputUplinkRule(uplink, subnet),
+			// Allow tap device -> tap device within allowed subnet
+			{"-o", tapDevice, "-s", subnet, "-j", "ACCEPT"},
+			// Reject all other input for forwarding from tap-device
+			{"-j", "REJECT", "--reject-with", "icmp6-adm-prohibited"},
+		}...,
+	))
+
+	// Rules for filtering FORWARD to this tap device
+	forwardOutputRules := prefixCommands([]string{ruleAction, "fwd_output_" + tapDevice}, append(
+		// Allow VPN -> tap device, if already established
+		forwardVPNOutputRules,
+		[][]string{
+			// Drop incoming from unique local and link-local to this tap device
+			{"-s", "fc00::/7", "-j", "DROP"},
+			{"-s", "fe80::/10", "-j", "DROP"},
+			// Allow incoming with correct destination (if already established)
+			fwdOutputUplinkRule(uplink, subnet),
+			// Allow tap device -> tap device within allowed subnet
+			{"-i", tapDevice, "-s", subnet, "-j", "ACCEPT"},
+			// Reject all other output from forwarding to tap-device
+			{"-j", "DROP"},
+		}...,
+	))
+
+	cmds := [][]string{}
+	if !delete {
+		cmds = append(cmds, nat...)
+		cmds = append(cmds, chains...)
+		cmds = append(cmds, rules...)
+		cmds = append(cmds, inputRules...)
+		cmds = append(cmds, outputRules...)
+		cmds = append(cmds, forwardOutputRules...)
+		cmds = append(cmds, forwardInputRules...)
+	} else {
+		cmds = append(cmds, forwardInputRules...)
+		cmds = append(cmds, forwardOutputRules...)
+		cmds = append(cmds, outputRules...)
+		cmds = append(cmds, inputRules...)
+		cmds = append(cmds, rules...)
+		cmds = append(cmds, chains...)
+		cmds = append(cmds, nat...)
+	}
+
+	return cmds
+}
+
+// uplinkRules6 returns commands to move the IPv6 rules for tapDevice that
+// reference the uplink interface from oldUplink to newUplink, see uplinkRules.
+func uplinkRules6(tapDevice string, ipv6Prefix string, vpns []*openvpn.VPN, oldUplink, newUplink string) [][]string {
+	subnet := ipv6Prefix + "::/64"
+
+	// Uplink rules in fwd_input_ and fwd_output_ chains come after the VPN
+	// forwarding rules and 2 rules for unique local and link-local addresses.
+	routes := 0
+	for _, vpn := range vpns {
+		for _, r := range vpn.Routes() {
+			if r.IP.To4() == nil {
+				routes++
+			}
+		}
+	}
+	position := strconv.Itoa(routes + 3)
+
+	ip6tables := func(args []string, rule []string) []string {
+		return append(append([]string{"ip6tables", "-w", xtableLockWait}, args...), rule...)
+	}
+	return [][]string{
+		ip6tables([]string{"-t", "nat", "-A"}, natUplinkRule(newUplink, subnet)),
+		ip6tables([]string{"-I", "fwd_input_" + tapDevice, position}, fwdInputUplinkRule(newUplink, subnet)),
+		ip6tables([]string{"-I", "fwd_output_" + tapDevice, position}, fwdOutputUplinkRule(newUplink, subnet)),
+		ip6tables([]string{"-t", "nat", "-D"}, natUplinkRule(oldUplink, subnet)),
+		ip6tables([]string{"-D", "fwd_input_" + tapDevice}, fwdInputUplinkRule(oldUplink, subnet)),
+		ip6tables([]string{"-D", "fwd_output_" + tapDevice}, fwdOutputUplinkRule(oldUplink, subnet)),
+	}
+}
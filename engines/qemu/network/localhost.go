@@ -0,0 +1,307 @@
+package network
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/network/openvpn"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+// localHost implements networkHost by running commands in-process, this
+// requires root privileges.
+type localHost struct {
+	vpns       []*openvpn.VPN
+	firewall   firewall        // firewall backend for isolating networks
+	subnets    subnetRange     // IPv4 subnets allocated to networks
+	ipv6Prefix string          // /48 prefix for IPv6 subnets, empty if disabled
+	tapOwner   string          // user owning tap devices, empty for current user
+	hostsFile  string          // additional hosts file read by dnsmasq
+	onCrash    func(err error) // called if dnsmasq exits unexpectedly
+	dnsmasq    *exec.Cmd
+	dnsDone    chan struct{} // closed when dnsmasq has exited
+	stopping   atomics.Bool  // set when stopping dnsmasq
+}
+
+func newLocalHost(vpns []*openvpn.VPN, fw firewall, subnets subnetRange, ipv6Prefix, tapOwner, hostsFile string, onCrash func(error)) *localHost {
+	return &localHost{
+		vpns:       vpns,
+		firewall:   fw,
+		subnets:    subnets,
+		ipv6Prefix: ipv6Prefix,
+		tapOwner:   tapOwner,
+		hostsFile:  hostsFile,
+		onCrash:    onCrash,
+	}
+}
+
+func (h *localHost) SetupHost() error {
+	err := script([][]string{
+		{"sysctl", "-w", "net.ipv4.ip_forward=1"},
+	}, true)
+	if err != nil {
+		return errors.Wrap(err, "Failed to enable ipv4 forwarding")
+	}
+	if h.ipv6Prefix != "" {
+		err = script([][]string{
+			{"sysctl", "-w", "net.ipv6.conf.all.forwarding=1"},
+		}, true)
+		if err != nil {
+			return errors.Wrap(err, "Failed to enable ipv6 forwarding")
+		}
+	}
+	err = script([][]string{
+		{"ip", "addr", "add", metaDataIP, "dev", "lo"},
+	}, true)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to add: %s to the loopback device", metaDataIP)
+	}
+	return nil
+}
+
+func (h *localHost) TeardownHost() error {
+	return script([][]string{
+		{"ip", "addr", "del", metaDataIP, "dev", "lo"},
+	}, true)
+}
+
+func (h *localHost) CreateNetwork(index int, uplink string) error {
+	tapDevice := tapDeviceName(index)
+	ipPrefix := h.subnets.Prefix(index)
+	ipv6Prefix := subnet6Prefix(h.ipv6Prefix, index)
+
+	// Create tap device, owned by tapOwner if given, so an unprivileged QEMU
+	// can open it
+	create := []string{"ip", "tuntap", "add", "dev", tapDevice, "mode", "tap"}
+	if h.tapOwner != "" {
+		create = append(create, "user", h.tapOwner)
+	}
+	err := script([][]string{
+		create,
+		// Assign IP-address to tap device
+		{"ip", "addr", "add", ipPrefix + ".1", "dev", tapDevice},
+		// Activate the link
+		{"ip", "link", "set", "dev", tapDevice, "up"},
+		// Add route for the network subnet, routing it to the tap device
+		{"ip", "route", "add", ipPrefix + ".0/24", "dev", tapDevice},
+	}, true)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to setup tap device: %s", tapDevice)
+	}
+	if ipv6Prefix != "" {
+		// Assign IPv6-address to tap device, this also adds a route for the subnet
+		err = script([][]string{
+			{"ip", "-6", "addr", "add", ipv6Prefix + "::1/64", "dev", tapDevice},
+		}, true)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to assign IPv6 address to tap device: %s", tapDevice)
+		}
+	}
+
+	// Create firewall rules and chains
+	err = script(h.firewall.Rules(tapDevice, ipPrefix, ipv6Prefix, h.vpns, uplink, false), false)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to setup %s rules for tap device: %s", h.firewall.Command(), tapDevice)
+	}
+	return nil
+}
+
+func (h *localHost) DestroyNetwork(index int, uplink string) error {
+	tapDevice := tapDeviceName(index)
+	ipPrefix := h.subnets.Prefix(index)
+	ipv6Prefix := subnet6Prefix(h.ipv6Prefix, index)
+
+	// Delete firewall rules and chains
+	err := script(h.firewall.Rules(tapDevice, ipPrefix, ipv6Prefix, h.vpns, uplink, true), false)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to remove %s rules for tap device: %s", h.firewall.Command(), tapDevice)
+	}
+
+	err = script([][]string{
+		// Remove route for the network subnet
+		{"ip", "route", "del", ipPrefix + ".0/24", "dev", tapDevice},
+		// Deactivate the link
+		{"ip", "link", "set", "dev", tapDevice, "down"},
+		// Unassign IP-address from tap device
+		{"ip", "addr", "del", ipPrefix + ".1", "dev", tapDevice},
+		// Delete tap device
+		{"ip", "tuntap", "del", "dev", tapDevice, "mode", "tap"},
+	}, true)
+	if err != nil {
+		debug("Failed to destoy tap device: %s, error: %s", tapDevice, err)
+		return errors.Wrapf(err, "Failed to remove tap device: %s", tapDevice)
+	}
+	return nil
+}
+
+func (h *localHost) RepairNetwork(index int, oldUplink, newUplink string) error {
+	tapDevice := tapDeviceName(index)
+	ipPrefix := h.subnets.Prefix(index)
+	ipv6Prefix := subnet6Prefix(h.ipv6Prefix, index)
+
+	// These commands fail if already configured, hence, we ignore errors
+	cmds := [][]string{
+		{"ip", "link", "set", "dev", tapDevice, "up"},
+		{"ip", "addr", "add", ipPrefix + ".1", "dev", tapDevice},
+		{"ip", "route", "add", ipPrefix + ".0/24", "dev", tapDevice},
+	}
+	if ipv6Prefix != "" {
+		cmds = append(cmds, []string{"ip", "-6", "addr", "add", ipv6Prefix + "::1/64", "dev", tapDevice})
+	}
+	for _, cmd := range cmds {
+		_ = script([][]string{cmd}, false)
+	}
+
+	if oldUplink == newUplink {
+		return nil
+	}
+	return script(h.firewall.UplinkRules(tapDevice, ipPrefix, ipv6Prefix, h.vpns, oldUplink, newUplink), false)
+}
+
+func (h *localHost) StartDNS(config dnsConfig) error {
+	// Create hosts file for aliases added with SetHostAliases()
+	if err := ioutil.WriteFile(h.hostsFile, nil, 0644); err != nil {
+		return errors.Wrap(err, "Failed to create hosts file for dnsmasq")
+	}
+
+	// Create dnsmasq configuration
+	dnsmasqConfig := []string{
+		"addn-hosts=" + h.hostsFile,
+		"strict-order",
+		// Bind dynamically, so dnsmasq follows tap devices that flap
+		"bind-dynamic",
+		"except-interface=lo",
+		"conf-file=\"\"",
+		"dhcp-no-override",
+		"host-record=taskcluster," + metaDataIP,
+		"keep-in-foreground",
+		"bogus-priv",
+		"domain-needed",
+		// Consider adding "no-ping"
+	}
+	if config.SearchDomain != "" {
+		// Hand out search domain as domain-name and domain-search options
+		dnsmasqConfig = append(dnsmasqConfig,
+			"domain="+config.SearchDomain,
+			"dhcp-option=option:domain-search,"+config.SearchDomain,
+		)
+	}
+	if len(config.NTPServers) > 0 {
+		dnsmasqConfig = append(dnsmasqConfig,
+			"dhcp-option=option:ntp-server,"+strings.Join(config.NTPServers, ","),
+		)
+	}
+	if h.ipv6Prefix != "" {
+		// Send router advertisements, so VMs can configure IPv6 with SLAAC
+		dnsmasqConfig = append(dnsmasqConfig, "enable-ra")
+	}
+	for _, rec := range config.HostRecords {
+		dnsmasqConfig = append(dnsmasqConfig,
+			"host-record="+strings.Join(append(rec.Names, rec.IPv4, rec.IPv6), ","),
+		)
+	}
+	for _, srv := range config.SRVRecords {
+		dnsmasqConfig = append(dnsmasqConfig,
+			"srv-host="+strings.Join([]string{
+				strings.Join([]string{srv.Service, srv.Protocol, srv.Domain}, "."),
+				srv.Target,
+				strconv.Itoa(srv.Port),
+				strconv.Itoa(srv.Priority),
+				strconv.Itoa(srv.Weight),
+			}, ","),
+		)
+	}
+	for i := 0; i < config.Subnets; i++ {
+		tapDevice := tapDeviceName(i)
+		ipPrefix := h.subnets.Prefix(i)
+		dnsmasqConfig = append(dnsmasqConfig,
+			"interface="+tapDevice,
+			"dhcp-range="+strings.Join([]string{
+				"tag:" + tapDevice,
+				ipPrefix + ".2",
+				ipPrefix + ".254",
+				"255.255.255.0",
+				"20m",
+			}, ","),
+			"dhcp-option="+strings.Join([]string{
+				"tag:" + tapDevice,
+				"option:router",
+				ipPrefix + ".1",
+			}, ","),
+		)
+		if h.ipv6Prefix != "" {
+			// Advertise the /64 subnet on the tap device for SLAAC, and answer
+			// stateless DHCPv6 requests for DNS servers.
+			dnsmasqConfig = append(dnsmasqConfig,
+				"dhcp-range="+strings.Join([]string{
+					"::",
+					"constructor:" + tapDevice,
+					"ra-stateless",
+					"64",
+					"20m",
+				}, ","),
+			)
+		}
+	}
+
+	// Start dnsmasq
+	h.stopping.Set(false)
+	h.dnsmasq = exec.Command("dnsmasq", "--conf-file=-")
+	h.dnsmasq.Stdin = bytes.NewBufferString(strings.Join(dnsmasqConfig, "\n") + "\n")
+	h.dnsmasq.Stderr = nil
+	h.dnsmasq.Stdout = nil
+	if err := h.dnsmasq.Start(); err != nil {
+		return errors.Wrap(err, "Failed to start dnsmasq")
+	}
+
+	// Monitor dnsmasq and report if it crashes unexpectedly
+	h.dnsDone = make(chan struct{})
+	go func(h *localHost) {
+		werr := h.dnsmasq.Wait()
+		close(h.dnsDone)
+		// Ignore errors if stopping is true, otherwise this is a fatal issue
+		if werr != nil && !h.stopping.Get() {
+			// We could probably restart the dnsmasq, as long as we avoid an infinite
+			// loop that should be fine. But dnsmasq probably won't crash without a
+			// good reason
+			h.onCrash(errors.Wrap(werr, "dnsmasq died unexpectedly"))
+		}
+	}(h)
+	return nil
+}
+
+func (h *localHost) SetHostAliases(hostnames []string) error {
+	// Write hosts file with all aliases, and tell dnsmasq to reload it
+	var data []byte
+	if len(hostnames) > 0 {
+		data = []byte(metaDataIP + " " + strings.Join(hostnames, " ") + "\n")
+	}
+	if err := ioutil.WriteFile(h.hostsFile, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write hosts file for dnsmasq")
+	}
+	if err := h.dnsmasq.Process.Signal(syscall.SIGHUP); err != nil {
+		return errors.Wrap(err, "failed to signal dnsmasq to reload hosts file")
+	}
+	return nil
+}
+
+func (h *localHost) StopDNS() error {
+	if h.dnsmasq == nil || h.stopping.Swap(true) {
+		return nil
+	}
+	// Kill dnsmasq and wait for it to halt
+	go h.dnsmasq.Process.Kill()
+	<-h.dnsDone
+	os.Remove(h.hostsFile)
+	return nil
+}
+
+func (h *localHost) Close() error {
+	return nil
+}
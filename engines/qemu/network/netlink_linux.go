@@ -0,0 +1,67 @@
+package network
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Time without further netlink events before we consider the network settled
+const netlinkSettleDelay = 2 * time.Second
+
+// Netlink multicast groups from linux/rtnetlink.h, not exported by syscall
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+)
+
+// watchNetlink calls onChange when links, IPv4 addresses or IPv4 routes have
+// changed and no further changes have happened for netlinkSettleDelay.
+// This returns when stop is closed.
+func watchNetlink(onChange func(), stop <-chan struct{}) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return errors.Wrap(err, "failed to create netlink socket")
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv4Route,
+	})
+	if err != nil {
+		syscall.Close(fd)
+		return errors.Wrap(err, "failed to bind netlink socket")
+	}
+	// Use a receive timeout, so we can check if we should stop
+	tv := syscall.NsecToTimeval(int64(500 * time.Millisecond))
+	if err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return errors.Wrap(err, "failed to set timeout on netlink socket")
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+		buf := make([]byte, syscall.Getpagesize())
+		var changedAt time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n, _, rerr := syscall.Recvfrom(fd, buf, 0)
+			if rerr == nil && n > 0 {
+				if msgs, perr := syscall.ParseNetlinkMessage(buf[:n]); perr == nil && len(msgs) > 0 {
+					debug("netlink: received %d messages", len(msgs))
+					changedAt = time.Now()
+				}
+			}
+			if !changedAt.IsZero() && time.Since(changedAt) > netlinkSettleDelay {
+				changedAt = time.Time{}
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,277 @@
+package network
+
+import (
+	"strings"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/network/openvpn"
+)
+
+// nfTablesFirewall implements firewall using nftables, rules for each tap
+// device are kept in a table named after the tap device.
+//
+// The rules are equivalent to those created by ipTableRules, but all commands
+// for a tap device are given to a single invocation of nft, which applies them
+// atomically. If IPv6 is enabled rules for the IPv6 subnet are kept in a table
+// of the "ip6" family with the same name.
+type nfTablesFirewall struct{}
+
+func (nfTablesFirewall) Command() string {
+	return "nft"
+}
+
+func (f nfTablesFirewall) Rules(tapDevice, ipPrefix, ipv6Prefix string, vpns []*openvpn.VPN, uplink string, delete bool) [][]string {
+	if delete {
+		stmts := []string{"delete table ip " + tapDevice}
+		if ipv6Prefix != "" {
+			stmts = append(stmts, "delete table ip6 "+tapDevice)
+		}
+		return [][]string{{"nft", strings.Join(stmts, " ; ")}}
+	}
+	stmts := nfTableChains("ip " + tapDevice)
+	stmts = append(stmts, nfTableRules(tapDevice, ipPrefix, vpns, uplink)...)
+	if ipv6Prefix != "" {
+		stmts = append(stmts, nfTableChains("ip6 "+tapDevice)...)
+		stmts = append(stmts, nf6TableRules(tapDevice, ipv6Prefix, vpns, uplink)...)
+	}
+	return [][]string{{"nft", strings.Join(stmts, " ; ")}}
+}
+
+func (f nfTablesFirewall) UplinkRules(tapDevice, ipPrefix, ipv6Prefix string, vpns []*openvpn.VPN, oldUplink, newUplink string) [][]string {
+	// Flush and recreate all rules in a single transaction, chains are kept
+	stmts := []string{"flush table ip " + tapDevice}
+	stmts = append(stmts, nfTableRules(tapDevice, ipPrefix, vpns, newUplink)...)
+	if ipv6Prefix != "" {
+		stmts = append(stmts, "flush table ip6 "+tapDevice)
+		stmts = append(stmts, nf6TableRules(tapDevice, ipv6Prefix, vpns, newUplink)...)
+	}
+	return [][]string{{"nft", strings.Join(stmts, " ; ")}}
+}
+
+// nfTableChains returns statements to create table and the chains rules from
+// nfTableRules and nf6TableRules are added to.
+func nfTableChains(table string) []string {
+	return []string{
+		"add table " + table,
+		"add chain " + table + " input { type filter hook input priority 0 ; }",
+		"add chain " + table + " output { type filter hook output priority 0 ; }",
+		"add chain " + table + " forward { type filter hook forward priority 0 ; }",
+		"add chain " + table + " postrouting { type nat hook postrouting priority 100 ; }",
+	}
+}
+
+// nfTableRules returns 'add rule' statements for the chains in the table for
+// tapDevice, see ipTableRules for details on what is allowed.
+func nfTableRules(tapDevice, ipPrefix string, vpns []*openvpn.VPN, uplink string) []string {
+	subnet := ipPrefix + ".0/24"
+	gateway := ipPrefix + ".1"
+	iif := `iifname "` + tapDevice + `" `
+	oif := `oifname "` + tapDevice + `" `
+	prefixRules := func(prefix string, rules []string) []string {
+		stmts := []string{}
+		for _, rule := range rules {
+			stmts = append(stmts, prefix+rule)
+		}
+		return stmts
+	}
+
+	// Rules for filtering input from this tap device
+	input := prefixRules("add rule ip "+tapDevice+" input "+iif, []string{
+		// Allow requests to meta-data service (from subnet only)
+		"ip saddr " + subnet + " ip daddr " + metaDataIP + " tcp dport 80 ct state new,established accept",
+		// Allow DNS requests
+		"ip saddr " + subnet + " ip daddr " + gateway + " tcp dport 53 ct state new,established accept",
+		"ip saddr " + subnet + " ip daddr " + gateway + " udp dport 53 ct state new,established accept",
+		// Allow DCHP requests
+		"ip saddr 0.0.0.0 ip daddr 255.255.255.255 udp sport 68 udp dport 67 accept",
+		"ip saddr " + subnet + " ip daddr " + gateway + " udp sport 68 udp dport 67 accept",
+		// Reject all other input (with special case for wrong port on meta-data service)
+		"ip saddr " + subnet + " ip daddr " + metaDataIP + " reject with icmp type port-unreachable",
+		"reject with icmp type host-unreachable",
+	})
+
+	// Rules for filtering output to this tap device
+	output := prefixRules("add rule ip "+tapDevice+" output "+oif, []string{
+		// Allow meta-data replies (to subnet only)
+		"ip saddr " + metaDataIP + " ip daddr " + subnet + " tcp sport 80 ct state established accept",
+		// Allow DNS replies from dnsmasq (to subnet only)
+		"ip saddr " + gateway + " ip daddr " + subnet + " udp sport 53 ct state established accept",
+		"ip saddr " + gateway + " ip daddr " + subnet + " tcp sport 53 ct state established accept",
+		// Allow DHCP replies
+		"ip saddr " + gateway + " udp sport 67 udp dport 68 accept",
+		// Reject all other output
+		"reject with icmp type net-prohibited",
+	})
+
+	// Create VPN forwarding rules
+	forwardVPNInputRules := []string{}
+	forwardVPNOutputRules := []string{}
+	for _, vpn := range vpns {
+		for _, r := range vpn.Routes() {
+			if r.IP.To4() == nil {
+				continue // IPv6 routes are handled by nf6TableRules
+			}
+			route := r.String()
+			// Allow tap device -> VPN, if source subnet and target tap device matches
+			forwardVPNInputRules = append(forwardVPNInputRules,
+				"ip daddr "+route+` oifname "`+vpn.DeviceName()+`" ip saddr `+subnet+" accept",
+			)
+			// Allow VPN -> tap device, if destination subnet matches and connection
+			// is already established.
+			forwardVPNOutputRules = append(forwardVPNOutputRules,
+				"ip saddr "+route+` iifname "`+vpn.DeviceName()+`" ip daddr `+subnet+" ct state related,established accept",
+			)
+		}
+	}
+
+	// Rules for filtering forwarding from this tap device, these come before
+	// rules for forwarding to this tap device, like the FORWARD chain with
+	// iptables.
+	forwardInput := prefixRules("add rule ip "+tapDevice+" forward "+iif, append(
+		// Allow tap device -> VPN
+		forwardVPNInputRules,
+		// Reject out-going from this tap device to private subnets
+		"ip daddr 10.0.0.0/8 reject with icmp type net-unreachable",
+		"ip daddr 172.16.0.0/12 reject with icmp type net-unreachable",
+		"ip daddr 169.254.0.0/16 reject with icmp type net-unreachable",
+		"ip daddr 192.168.0.0/16 reject with icmp type net-unreachable",
+		// Allow out-going from this tap device with correct source subnet
+		`oifname "`+uplink+`" ip saddr `+subnet+" accept",
+		// Allow tap device -> tap device within allowed subnet
+		oif+"ip saddr "+subnet+" accept",
+		// Reject all other input for forwarding from tap-device
+		"reject with icmp type net-prohibited",
+	))
+
+	// Rules for filtering forwarding to this tap device
+	forwardOutput := prefixRules("add rule ip "+tapDevice+" forward "+oif, append(
+		// Allow VPN -> tap device, if already established
+		forwardVPNOutputRules,
+		// Reject incoming from private subnets to this tap device
+		"ip saddr 10.0.0.0/8 drop",
+		"ip saddr 172.16.0.0/12 drop",
+		"ip saddr 169.254.0.0/16 drop",
+		"ip saddr 192.168.0.0/16 drop",
+		// Allow incoming with correct destination (if already established)
+		`iifname "`+uplink+`" ip daddr `+subnet+" ct state related,established accept",
+		// Allow tap device -> tap device within allowed subnet
+		iif+"ip saddr "+subnet+" accept",
+		// Reject all other output from forwarding to tap-device
+		"drop",
+	))
+
+	// Rule for nat from this subnet
+	nat := []string{
+		"add rule ip " + tapDevice + ` postrouting oifname "` + uplink + `" ip saddr ` + subnet + " masquerade",
+	}
+
+	stmts := []string{}
+	stmts = append(stmts, nat...)
+	stmts = append(stmts, input...)
+	stmts = append(stmts, output...)
+	stmts = append(stmts, forwardInput...)
+	stmts = append(stmts, forwardOutput...)
+	return stmts
+}
+
+// nf6TableRules returns 'add rule' statements for the chains in the "ip6" table
+// for tapDevice, see ip6TableRules for details on what is allowed.
+func nf6TableRules(tapDevice, ipv6Prefix string, vpns []*openvpn.VPN, uplink string) []string {
+	subnet := ipv6Prefix + "::/64"
+	gateway := ipv6Prefix + "::1"
+	iif := `iifname "` + tapDevice + `" `
+	oif := `oifname "` + tapDevice + `" `
+	prefixRules := func(prefix string, rules []string) []string {
+		stmts := []string{}
+		for _, rule := range rules {
+			stmts = append(stmts, prefix+rule)
+		}
+		return stmts
+	}
+
+	// Rules for filtering input from this tap device
+	input := prefixRules("add rule ip6 "+tapDevice+" input "+iif, []string{
+		// Allow neighbor discovery and router solicitation
+		"meta l4proto ipv6-icmp accept",
+		// Allow DNS requests
+		"ip6 saddr " + subnet + " ip6 daddr " + gateway + " tcp dport 53 ct state new,established accept",
+		"ip6 saddr " + subnet + " ip6 daddr " + gateway + " udp dport 53 ct state new,established accept",
+		// Allow DHCPv6 requests
+		"udp sport 546 udp dport 547 accept",
+		// Reject all other input
+		"reject with icmpv6 type addr-unreachable",
+	})
+
+	// Rules for filtering output to this tap device
+	output := prefixRules("add rule ip6 "+tapDevice+" output "+oif, []string{
+		// Allow neighbor discovery and router advertisements
+		"meta l4proto ipv6-icmp accept",
+		// Allow DNS replies from dnsmasq (to subnet only)
+		"ip6 saddr " + gateway + " ip6 daddr " + subnet + " udp sport 53 ct state established accept",
+		"ip6 saddr " + gateway + " ip6 daddr " + subnet + " tcp sport 53 ct state established accept",
+		// Allow DHCPv6 replies
+		"udp sport 547 udp dport 546 accept",
+		// Reject all other output
+		"reject with icmpv6 type admin-prohibited",
+	})
+
+	// Create VPN forwarding rules
+	forwardVPNInputRules := []string{}
+	forwardVPNOutputRules := []string{}
+	for _, vpn := range vpns {
+		for _, r := range vpn.Routes() {
+			if r.IP.To4() != nil {
+				continue // IPv4 routes are handled by nfTableRules
+			}
+			route := r.String()
+			forwardVPNInputRules = append(forwardVPNInputRules,
+				"ip6 daddr "+route+` oifname "`+vpn.DeviceName()+`" ip6 saddr `+subnet+" accept",
+			)
+			forwardVPNOutputRules = append(forwardVPNOutputRules,
+				"ip6 saddr "+route+` iifname "`+vpn.DeviceName()+`" ip6 daddr `+subnet+" ct state related,established accept",
+			)
+		}
+	}
+
+	// Rules for filtering forwarding from this tap device
+	forwardInput := prefixRules("add rule ip6 "+tapDevice+" forward "+iif, append(
+		// Allow tap device -> VPN
+		forwardVPNInputRules,
+		// Reject out-going from this tap device to unique local and link-local
+		"ip6 daddr fc00::/7 reject with icmpv6 type no-route",
+		"ip6 daddr fe80::/10 reject with icmpv6 type no-route",
+		// Allow out-going from this tap device with correct source subnet
+		`oifname "`+uplink+`" ip6 saddr `+subnet+" accept",
+		// Allow tap device -> tap device within allowed subnet
+		oif+"ip6 saddr "+subnet+" accept",
+		// Reject all other input for forwarding from tap-device
+		"reject with icmpv6 type admin-prohibited",
+	))
+
+	// Rules for filtering forwarding to this tap device
+	forwardOutput := prefixRules("add rule ip6 "+tapDevice+" forward "+oif, append(
+		// Allow VPN -> tap device, if already established
+		forwardVPNOutputRules,
+		// Drop incoming from unique local and link-local to this tap device
+		"ip6 saddr fc00::/7 drop",
+		"ip6 saddr fe80::/10 drop",
+		// Allow incoming with correct destination (if already established)
+		`iifname "`+uplink+`" ip6 daddr `+subnet+" ct state related,established accept",
+		// Allow tap device -> tap device within allowed subnet
+		iif+"ip6 saddr "+subnet+" accept",
+		// Reject all other output from forwarding to tap-device
+		"drop",
+	))
+
+	// Rule for nat from this subnet
+	nat := []string{
+		"add rule ip6 " + tapDevice + ` postrouting oifname "` + uplink + `" ip6 saddr ` + subnet + " masquerade",
+	}
+
+	stmts := []string{}
+	stmts = append(stmts, nat...)
+	stmts = append(stmts, input...)
+	stmts = append(stmts, output...)
+	stmts = append(stmts, forwardInput...)
+	stmts = append(stmts, forwardOutput...)
+	return stmts
+}
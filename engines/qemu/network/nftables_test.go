@@ -0,0 +1,72 @@
+package network
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTablesRules(t *testing.T) {
+	f := nfTablesFirewall{}
+
+	// All rules must be applied in a single transaction
+	cmds := f.Rules("tctap0", "192.168.150", "", nil, "eth0", false)
+	require.Len(t, cmds, 1)
+	require.Equal(t, "nft", cmds[0][0])
+	stmts := strings.Split(cmds[0][1], " ; ")
+	require.Equal(t, "add table ip tctap0", stmts[0])
+	require.Contains(t, cmds[0][1], `add rule ip tctap0 postrouting oifname "eth0" ip saddr 192.168.150.0/24 masquerade`)
+
+	// Rules for forwarding from the tap device must come before rules for
+	// forwarding to the tap device, and each must end with reject/drop
+	var forward []string
+	for _, stmt := range stmts {
+		if strings.HasPrefix(stmt, "add rule ip tctap0 forward ") {
+			forward = append(forward, stmt)
+		}
+	}
+	require.Len(t, forward, 14)
+	require.Equal(t, `add rule ip tctap0 forward iifname "tctap0" reject with icmp type net-prohibited`, forward[6])
+	require.Equal(t, `add rule ip tctap0 forward oifname "tctap0" drop`, forward[13])
+
+	cmds = f.Rules("tctap0", "192.168.150", "", nil, "eth0", true)
+	require.Equal(t, [][]string{{"nft", "delete table ip tctap0"}}, cmds)
+}
+
+func TestNFTablesUplinkRules(t *testing.T) {
+	cmds := nfTablesFirewall{}.UplinkRules("tctap0", "192.168.150", "", nil, "eth0", "ens5")
+	require.Len(t, cmds, 1)
+	require.True(t, strings.HasPrefix(cmds[0][1], "flush table ip tctap0 ; "))
+	require.Contains(t, cmds[0][1], `oifname "ens5"`)
+	require.NotContains(t, cmds[0][1], "eth0")
+}
+
+func TestNFTablesRulesIPv6(t *testing.T) {
+	f := nfTablesFirewall{}
+
+	// IPv4 and IPv6 tables must be created in the same transaction
+	cmds := f.Rules("tctap0", "192.168.150", "fd00:1:2:96", nil, "eth0", false)
+	require.Len(t, cmds, 1)
+	require.Contains(t, cmds[0][1], "add table ip tctap0 ; ")
+	require.Contains(t, cmds[0][1], "add table ip6 tctap0 ; ")
+	require.Contains(t, cmds[0][1], `add rule ip6 tctap0 postrouting oifname "eth0" ip6 saddr fd00:1:2:96::/64 masquerade`)
+
+	var forward []string
+	for _, stmt := range strings.Split(cmds[0][1], " ; ") {
+		if strings.HasPrefix(stmt, "add rule ip6 tctap0 forward ") {
+			forward = append(forward, stmt)
+		}
+	}
+	require.Len(t, forward, 10)
+	require.Equal(t, `add rule ip6 tctap0 forward iifname "tctap0" reject with icmpv6 type admin-prohibited`, forward[4])
+	require.Equal(t, `add rule ip6 tctap0 forward oifname "tctap0" drop`, forward[9])
+
+	cmds = f.Rules("tctap0", "192.168.150", "fd00:1:2:96", nil, "eth0", true)
+	require.Equal(t, [][]string{{"nft", "delete table ip tctap0 ; delete table ip6 tctap0"}}, cmds)
+
+	cmds = f.UplinkRules("tctap0", "192.168.150", "fd00:1:2:96", nil, "eth0", "ens5")
+	require.Len(t, cmds, 1)
+	require.Contains(t, cmds[0][1], " ; flush table ip6 tctap0 ; ")
+	require.NotContains(t, cmds[0][1], "eth0")
+}
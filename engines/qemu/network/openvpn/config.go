@@ -39,6 +39,14 @@ type config struct {
 
 // ConfigSchema for options given to New()
 var ConfigSchema schematypes.Schema = schematypes.Object{
+	Description: util.Markdown(`
+		Options for an openvpn client connection.
+
+		Keys, certificates and passwords should be loaded from the secrets
+		service, by giving them as '{$secret: <name>, key: <key>}' and enabling
+		the 'secrets' config transform, instead of storing them in the config
+		file. The values are validated after transforms have been applied.
+	`),
 	Properties: schematypes.Properties{
 		"username": schematypes.String{},
 		"password": schematypes.String{},
@@ -162,13 +170,18 @@ var ConfigSchema schematypes.Schema = schematypes.Object{
 		"routes": schematypes.Array{
 			Title: "Routes",
 			Items: schematypes.String{
-				Pattern: `^\d+(\.\d+){3}$`,
+				Pattern: `^(\d+(\.\d+){3}(/\d{1,2})?|[0-9a-fA-F:]+(/\d{1,3})?)$`,
 				Title:   "Route",
 				Description: util.Markdown(`
-  				Route to be exposed, this must be an IPv4 address.
+					Route to be exposed, this must be an IP address or a network in
+					CIDR notation, e.g. '10.0.0.0/8' or 'fd12:3456::/32'. IPv6 routes
+					are only exposed to virtual machines if 'ipv6Prefix' is configured.
 
-  				This is the '--route' argument for openvpn.
-  			`),
+					Routes may not overlap with routes from other VPN connections,
+					nor with the subnets used for virtual machines.
+
+					This is the '--route' argument for openvpn.
+				`),
 			},
 			Unique: true,
 		},
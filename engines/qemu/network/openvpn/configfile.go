@@ -0,0 +1,287 @@
+package openvpn
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+)
+
+// Validate checks that config matching ConfigSchema is consistent, ie. that
+// certificates can be parsed and haven't expired, that the key matches the
+// certificate and that options which depend on each other are given together.
+//
+// This is also done by New(), but it is useful to call Validate() when
+// loading configuration, such that misconfiguration is visible at startup.
+func Validate(options interface{}) error {
+	if err := ConfigSchema.Validate(options); err != nil {
+		return errors.Wrap(err, "invalid openvpn configuration")
+	}
+	var c config
+	schematypes.MustValidateAndMap(ConfigSchema, options, &c)
+	return c.validate()
+}
+
+func (c *config) validate() error {
+	if (c.Username == "") != (c.Password == "") {
+		return errors.New("openvpn config must specify both 'username' and 'password' or neither")
+	}
+	// Values are written to the config file and the file with credentials, so
+	// they must not be able to terminate a line or an inline block
+	for name, value := range map[string]string{
+		"username":               c.Username,
+		"password":               c.Password,
+		"remote":                 c.Remote,
+		"x509Name":               c.X509Name,
+		"remoteExtendedKeyUsage": c.RemoteExtendedKeyUsage,
+	} {
+		if strings.IndexFunc(value, unicode.IsControl) != -1 {
+			return fmt.Errorf("'%s' in openvpn config must not contain control characters", name)
+		}
+	}
+	if strings.IndexFunc(c.Remote, unicode.IsSpace) != -1 {
+		return errors.New("'remote' in openvpn config must not contain whitespace")
+	}
+	for name, value := range map[string]string{
+		"certificateAuthority": c.CertificateAuthority,
+		"certificate":          c.Certificate,
+		"key":                  c.Key,
+		"tlsKey":               c.TLSKey,
+	} {
+		if strings.ContainsAny(value, "<>") {
+			return fmt.Errorf("'%s' in openvpn config must not contain '<' or '>'", name)
+		}
+	}
+	if (c.Certificate == "") != (c.Key == "") {
+		return errors.New("openvpn config must specify both 'certificate' and 'key' or neither")
+	}
+	if c.CertificateAuthority != "" {
+		if err := validateCertificates(c.CertificateAuthority); err != nil {
+			return errors.Wrap(err, "invalid 'certificateAuthority' in openvpn config")
+		}
+	}
+	if c.Certificate != "" {
+		if err := validateCertificates(c.Certificate); err != nil {
+			return errors.Wrap(err, "invalid 'certificate' in openvpn config")
+		}
+		if _, err := tls.X509KeyPair([]byte(c.Certificate), []byte(c.Key)); err != nil {
+			return errors.Wrap(err, "'key' doesn't match 'certificate' in openvpn config")
+		}
+	}
+	if c.TLSKey != "" && !strings.Contains(c.TLSKey, "-----BEGIN OpenVPN Static key V1-----") {
+		return errors.New("'tlsKey' in openvpn config must be an OpenVPN static key")
+	}
+	if c.KeyDirection != nil && c.TLSKey == "" {
+		return errors.New("'keyDirection' in openvpn config requires 'tlsKey'")
+	}
+	if c.X509NameType != "" && c.X509Name == "" {
+		return errors.New("'x509NameType' in openvpn config requires 'x509Name'")
+	}
+	for _, route := range c.Routes {
+		if _, err := parseRoute(route); err != nil {
+			return errors.Wrap(err, "invalid route in openvpn config")
+		}
+	}
+	return nil
+}
+
+// Routes returns the routes from config matching ConfigSchema, routes that
+// can't be parsed are ignored, use Validate() to check them.
+func Routes(options interface{}) []*net.IPNet {
+	var c config
+	schematypes.MustValidateAndMap(ConfigSchema, options, &c)
+	return c.routes()
+}
+
+func (c *config) routes() []*net.IPNet {
+	var routes []*net.IPNet
+	for _, route := range c.Routes {
+		if r, err := parseRoute(route); err == nil {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// parseRoute parses an IPv4 or IPv6 address or network in CIDR notation
+func parseRoute(route string) (*net.IPNet, error) {
+	if !strings.Contains(route, "/") {
+		ip := net.ParseIP(route)
+		if ip == nil {
+			return nil, fmt.Errorf("route: '%s' is not an IP address", route)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	ip, network, err := net.ParseCIDR(route)
+	if err != nil {
+		return nil, fmt.Errorf("route: '%s' is not an IP network", route)
+	}
+	if !ip.Equal(network.IP) {
+		return nil, fmt.Errorf("route: '%s' has host bits set, did you mean '%s'", route, network)
+	}
+	return network, nil
+}
+
+// validateCertificates checks that data contains one or more PEM encoded
+// certificates that are currently valid.
+func validateCertificates(data string) error {
+	rest := []byte(data)
+	count := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse certificate")
+		}
+		now := time.Now()
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate '%s' expired %s", cert.Subject.CommonName, cert.NotAfter)
+		}
+		if now.Before(cert.NotBefore) {
+			return fmt.Errorf("certificate '%s' isn't valid before %s", cert.Subject.CommonName, cert.NotBefore)
+		}
+		count++
+	}
+	if count == 0 {
+		return errors.New("no PEM encoded certificates found")
+	}
+	return nil
+}
+
+// quoteArg quotes an argument for an openvpn config file, if it contains
+// whitespace or characters with special meaning.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\#;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// render returns the contents of an openvpn config file for c, with keys and
+// certificates inlined. The userPassFile is only used if c has credentials,
+// the management interface will listen on the managementSocket unix socket.
+//
+// Config c must have been validated, so values can't contain line breaks.
+func (c *config) render(deviceName, userPassFile, managementSocket string) []byte {
+	var b bytes.Buffer
+	option := func(name string, args ...string) {
+		b.WriteString(name)
+		for _, arg := range args {
+			b.WriteString(" " + quoteArg(arg))
+		}
+		b.WriteString("\n")
+	}
+	inline := func(name, content string) {
+		fmt.Fprintf(&b, "<%s>\n%s\n</%s>\n", name, strings.TrimSpace(content), name)
+	}
+
+	// Client options
+	option("pull")
+	if c.Username != "" && c.Password != "" {
+		option("auth-user-pass", userPassFile)
+	}
+	option("auth-retry", "none")
+
+	// Encryption options
+	option("cipher", c.Cipher)
+
+	// Tunnel options
+	if c.Port != 0 {
+		option("remote", c.Remote, strconv.Itoa(c.Port))
+	} else {
+		option("remote", c.Remote)
+	}
+	option("resolv-retry", "infinite")
+	option("proto", c.Protocol)
+	option("nobind")
+	if c.Compression != "" {
+		if c.Compression == "none" {
+			option("compress")
+		} else {
+			option("compress", c.Compression)
+		}
+	}
+
+	// Tun device
+	option("dev", deviceName)
+	option("dev-type", "tun")
+
+	// Drop permissions
+	option("user", "nobody")
+	option("group", "nogroup")
+
+	// Persist key material
+	option("persist-key")
+	option("persist-tun")
+
+	// TLS Mode
+	if c.CertificateAuthority != "" {
+		inline("ca", c.CertificateAuthority)
+	}
+	if c.Certificate != "" {
+		inline("cert", c.Certificate)
+	}
+	if c.Key != "" {
+		inline("key", c.Key)
+	}
+	if c.TLS {
+		option("tls-client")
+	}
+	if c.TLSKey != "" {
+		inline("tls-auth", c.TLSKey)
+	}
+	if c.KeyDirection != nil {
+		option("key-direction", strconv.Itoa(*c.KeyDirection))
+	}
+	if c.X509Name != "" {
+		if c.X509NameType != "" {
+			option("verify-x509-name", c.X509Name, c.X509NameType)
+		} else {
+			option("verify-x509-name", c.X509Name)
+		}
+	}
+	if c.RenegotiationDelay != 0 {
+		option("reneg-sec", strconv.Itoa(int(c.RenegotiationDelay.Seconds())))
+	}
+	if c.RemoteExtendedKeyUsage != "" {
+		option("remote-cert-eku", c.RemoteExtendedKeyUsage)
+	}
+
+	// Routing
+	option("route-nopull")
+	for _, route := range c.routes() {
+		if route.IP.To4() == nil {
+			option("route-ipv6", route.String())
+			continue
+		}
+		option("route", route.IP.String(), net.IP(route.Mask).String())
+	}
+
+	// Management interface for state and byte count notifications
+	option("management", managementSocket, "unix")
+
+	// Error messages
+	option("verb", "0")
+	option("errors-to-stderr")
+
+	return b.Bytes()
+}
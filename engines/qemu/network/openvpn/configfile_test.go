@@ -0,0 +1,158 @@
+package openvpn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	workerconfig "github.com/taskcluster/taskcluster-worker/config"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+
+	_ "github.com/taskcluster/taskcluster-worker/config/secrets"
+)
+
+func fileAsJSON(t *testing.T, filename string) string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", filename))
+	require.NoError(t, err, "Failed to read: %s", filename)
+
+	raw, err := json.Marshal(string(data))
+	require.NoError(t, err, "Failed to serialize JSON")
+	return string(raw)
+}
+
+func testConfig(t *testing.T, extra string) interface{} {
+	var config interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"remote": "localhost",
+		"port": 16000,
+		"cipher": "AES-256-CBC",
+		"protocol": "udp",
+		"routes": ["10.0.0.1"],
+		"tls": true,
+		"certificateAuthority": `+fileAsJSON(t, "ca.crt")+`,
+		"tlsKey": `+fileAsJSON(t, "ta.key")+`,
+		"keyDirection": 1`+extra+`
+	}`), &config))
+	return config
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		require.NoError(t, Validate(testConfig(t, `,
+			"key": `+fileAsJSON(t, "client.key")+`,
+			"certificate": `+fileAsJSON(t, "client.crt")+`
+		`)))
+	})
+
+	t.Run("key mismatch", func(t *testing.T) {
+		err := Validate(testConfig(t, `,
+			"key": `+fileAsJSON(t, "server.key")+`,
+			"certificate": `+fileAsJSON(t, "client.crt")+`
+		`))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "doesn't match")
+	})
+
+	t.Run("key without certificate", func(t *testing.T) {
+		require.Error(t, Validate(testConfig(t, `,
+			"key": `+fileAsJSON(t, "client.key")+`
+		`)))
+	})
+
+	t.Run("invalid certificate authority", func(t *testing.T) {
+		require.Error(t, Validate(testConfig(t, `,
+			"certificateAuthority": "not a certificate"
+		`)))
+	})
+
+	t.Run("schema violation", func(t *testing.T) {
+		require.Error(t, Validate(map[string]interface{}{"remote": "localhost"}))
+	})
+}
+
+func TestRender(t *testing.T) {
+	var c config
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"remote": "localhost",
+		"port": 16000,
+		"cipher": "AES-256-CBC",
+		"protocol": "udp",
+		"routes": ["10.0.0.1", "fd12:3456::/32"],
+		"certificateAuthority": "CA-DATA\n"
+	}`), &c))
+	data := string(c.render("tun0", "", "/tmp/mgmt.sock"))
+	require.Contains(t, data, "remote localhost 16000\n")
+	require.Contains(t, data, "dev tun0\n")
+	require.Contains(t, data, "route 10.0.0.1 255.255.255.255\n")
+	require.Contains(t, data, "route-ipv6 fd12:3456::/32\n")
+	require.Contains(t, data, "<ca>\nCA-DATA\n</ca>\n")
+	require.Contains(t, data, "management /tmp/mgmt.sock unix\n")
+	require.NotContains(t, data, "auth-user-pass")
+}
+
+func TestValidateHostileValues(t *testing.T) {
+	for name, extra := range map[string]string{
+		"newline in remote":        `, "remote": "localhost\nscript-security 2"`,
+		"whitespace in remote":     `, "remote": "localhost 1194"`,
+		"newline in x509Name":      `, "x509Name": "server\nup /bin/sh"`,
+		"newline in eku":           `, "remoteExtendedKeyUsage": "TLS Web Server Authentication\nup /bin/sh"`,
+		"newline in username":      `, "username": "user\nadmin", "password": "secret"`,
+		"carriage return password": `, "username": "user", "password": "secret\r"`,
+		"inline break in ca":       `, "certificateAuthority": ` + fileAsJSON(t, "ca.crt")[:1] + `</ca>\nup /bin/sh\n<ca>\n` + fileAsJSON(t, "ca.crt")[1:],
+		"inline break in tlsKey":   `, "tlsKey": "-----BEGIN OpenVPN Static key V1-----\n</tls-auth>\nup /bin/sh"`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Error(t, Validate(testConfig(t, extra)))
+		})
+	}
+}
+
+func TestRenderQuoting(t *testing.T) {
+	c := config{
+		Remote:       "vpn.example.com",
+		Cipher:       "AES-256-CBC",
+		Protocol:     "udp",
+		X509Name:     `C=US, O=Example "VPN" \ Server`,
+		X509NameType: "subject",
+	}
+	data := string(c.render("tun0", "", "/tmp/mgmt.sock"))
+	require.Contains(t, data, `verify-x509-name "C=US, O=Example \"VPN\" \\ Server" subject`+"\n")
+	require.Contains(t, data, "remote vpn.example.com\n")
+	require.Equal(t, `""`, quoteArg(""))
+	require.Equal(t, `"a#b"`, quoteArg("a#b"))
+}
+
+func TestValidateFromSecrets(t *testing.T) {
+	cert, err := ioutil.ReadFile(filepath.Join("testdata", "client.crt"))
+	require.NoError(t, err)
+	key, err := ioutil.ReadFile(filepath.Join("testdata", "client.key"))
+	require.NoError(t, err)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/secret/project/vpn" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"expires": "2030-01-01T00:00:00.000Z",
+			"secret":  map[string]string{"cert": string(cert), "key": string(key)},
+		})
+		w.Write(data)
+	}))
+	defer s.Close()
+
+	// Load certificate and key with the secrets transform, then validate
+	cfg := map[string]interface{}{
+		"credentials":    map[string]interface{}{"clientId": "no-client", "accessToken": "no-secret"},
+		"secretsBaseUrl": s.URL,
+		"openvpn": testConfig(t, `,
+			"certificate": {"$secret": "project/vpn", "key": "cert"},
+			"key": {"$secret": "project/vpn", "key": "key"}
+		`),
+	}
+	require.NoError(t, workerconfig.Providers()["secrets"].Transform(cfg, mocks.NewMockMonitor(true)))
+	require.NoError(t, Validate(cfg["openvpn"]))
+}
@@ -0,0 +1,173 @@
+package openvpn
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interval in seconds between byte count notifications from openvpn
+const byteCountInterval = 10
+
+// Maximum time to wait for openvpn to create the management socket
+const managementConnectTimeout = 30 * time.Second
+
+// Tunnel states reported by the openvpn management interface, see:
+// https://openvpn.net/community-resources/management-interface/
+const (
+	StateConnecting   = "CONNECTING"
+	StateConnected    = "CONNECTED"
+	StateReconnecting = "RECONNECTING"
+	StateExiting      = "EXITING"
+)
+
+// management tracks tunnel state and byte counters reported by the openvpn
+// management interface.
+type management struct {
+	m          sync.Mutex
+	conn       net.Conn
+	state      string
+	reconnects int
+	bytesIn    int64
+	bytesOut   int64
+}
+
+// State returns the current state of the tunnel as reported by openvpn, this
+// is the empty string until the management interface has reported a state.
+func (vpn *VPN) State() string {
+	vpn.management.m.Lock()
+	defer vpn.management.m.Unlock()
+	return vpn.management.state
+}
+
+// Reconnects returns the number of times the tunnel has been reconnecting.
+func (vpn *VPN) Reconnects() int {
+	vpn.management.m.Lock()
+	defer vpn.management.m.Unlock()
+	return vpn.management.reconnects
+}
+
+// monitorManagement connects to the management socket and reports state
+// changes and byte counters, until the connection is closed.
+func (vpn *VPN) monitorManagement(socket string) {
+	var conn net.Conn
+	var err error
+	deadline := time.Now().Add(managementConnectTimeout)
+	for {
+		conn, err = net.Dial("unix", socket)
+		if err == nil || time.Now().After(deadline) || vpn.resolved.IsDone() {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if err != nil {
+		if !vpn.resolved.IsDone() {
+			vpn.monitor.ReportWarning(err, "failed to connect to openvpn management interface")
+		}
+		return
+	}
+
+	vpn.management.m.Lock()
+	vpn.management.conn = conn
+	vpn.management.m.Unlock()
+	defer conn.Close()
+
+	// Ask for state changes and periodic byte counts
+	_, err = fmt.Fprintf(conn, "state on\nbytecount %d\n", byteCountInterval)
+	if err != nil {
+		vpn.monitor.ReportWarning(err, "failed to write to openvpn management interface")
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		vpn.handleManagementLine(scanner.Text())
+	}
+	debug("openvpn management interface closed")
+}
+
+// closeManagement closes the connection to the management interface, if any
+func (vpn *VPN) closeManagement() {
+	vpn.management.m.Lock()
+	defer vpn.management.m.Unlock()
+	if vpn.management.conn != nil {
+		vpn.management.conn.Close()
+	}
+}
+
+// handleManagementLine handles a real-time notification from the management
+// interface, other lines are ignored.
+func (vpn *VPN) handleManagementLine(line string) {
+	switch {
+	case strings.HasPrefix(line, ">STATE:"):
+		// >STATE:<unix time>,<state>,<description>,<local ip>,<remote ip>,...
+		fields := strings.Split(strings.TrimPrefix(line, ">STATE:"), ",")
+		if len(fields) < 2 {
+			return
+		}
+		at := time.Now()
+		if ts, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			at = time.Unix(ts, 0)
+		}
+		vpn.setState(fields[1], at, strings.Join(fields[2:], ","))
+	case strings.HasPrefix(line, ">BYTECOUNT:"):
+		// >BYTECOUNT:<bytes in>,<bytes out>
+		fields := strings.Split(strings.TrimPrefix(line, ">BYTECOUNT:"), ",")
+		if len(fields) != 2 {
+			return
+		}
+		in, err1 := strconv.ParseInt(fields[0], 10, 64)
+		out, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			return
+		}
+		vpn.setByteCount(in, out)
+	}
+}
+
+func (vpn *VPN) setState(state string, at time.Time, details string) {
+	vpn.management.m.Lock()
+	previous := vpn.management.state
+	vpn.management.state = state
+	if state == StateReconnecting {
+		vpn.management.reconnects++
+	}
+	vpn.management.m.Unlock()
+
+	if state == previous {
+		return
+	}
+	vpn.monitor.WithTag("state", state).Infof(
+		"VPN tunnel state changed from '%s' to '%s' at %s (%s)",
+		previous, state, at.UTC().Format(time.RFC3339), details,
+	)
+	if state == StateReconnecting {
+		vpn.monitor.Count("reconnects", 1)
+	}
+	if state == StateConnected {
+		vpn.monitor.Measure("connected", 1)
+	} else {
+		vpn.monitor.Measure("connected", 0)
+	}
+}
+
+func (vpn *VPN) setByteCount(in, out int64) {
+	vpn.management.m.Lock()
+	// Byte counts are reset when the tunnel reconnects
+	deltaIn, deltaOut := in-vpn.management.bytesIn, out-vpn.management.bytesOut
+	if deltaIn < 0 {
+		deltaIn = in
+	}
+	if deltaOut < 0 {
+		deltaOut = out
+	}
+	vpn.management.bytesIn, vpn.management.bytesOut = in, out
+	vpn.management.m.Unlock()
+
+	vpn.monitor.Count("bytes-in", float64(deltaIn))
+	vpn.monitor.Count("bytes-out", float64(deltaOut))
+}
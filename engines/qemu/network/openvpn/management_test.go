@@ -0,0 +1,32 @@
+package openvpn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestHandleManagementLine(t *testing.T) {
+	vpn := &VPN{monitor: mocks.NewMockMonitor(false)}
+	require.Equal(t, "", vpn.State())
+
+	vpn.handleManagementLine(">STATE:1515000000,CONNECTING,,,")
+	require.Equal(t, StateConnecting, vpn.State())
+	vpn.handleManagementLine(">STATE:1515000005,CONNECTED,SUCCESS,10.8.0.6,127.0.0.1")
+	require.Equal(t, StateConnected, vpn.State())
+
+	vpn.handleManagementLine(">BYTECOUNT:1024,2048")
+	require.Equal(t, int64(1024), vpn.management.bytesIn)
+	require.Equal(t, int64(2048), vpn.management.bytesOut)
+
+	vpn.handleManagementLine(">STATE:1515000100,RECONNECTING,ping-restart,,")
+	require.Equal(t, StateReconnecting, vpn.State())
+	require.Equal(t, 1, vpn.Reconnects())
+
+	// Ignores malformed lines and other notifications
+	vpn.handleManagementLine(">BYTECOUNT:abc")
+	vpn.handleManagementLine(">INFO:OpenVPN Management Interface Version 1")
+	vpn.handleManagementLine("SUCCESS: real-time state notification set to ON")
+	require.Equal(t, StateReconnecting, vpn.State())
+}
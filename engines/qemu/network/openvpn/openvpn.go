@@ -7,7 +7,6 @@ import (
 	"io/ioutil"
 	"net"
 	"os/exec"
-	"strconv"
 
 	"github.com/pkg/errors"
 	schematypes "github.com/taskcluster/go-schematypes"
@@ -24,10 +23,11 @@ type VPN struct {
 	stdoutWriter io.WriteCloser
 	stderrWriter io.WriteCloser
 	deviceName   string
-	routes       []net.IP
+	routes       []*net.IPNet
 	resolved     atomics.Once
 	waitErr      error
 	disposed     atomics.Once
+	management   management
 }
 
 // Options for creating a new VPN client with New().
@@ -48,7 +48,12 @@ func New(options Options) (*VPN, error) {
 		panic("A TUN DeviceName must be given in openvpn.Options")
 	}
 
-	// Create a temporary folder for storing keyfiles...
+	// Validate config, so misconfiguration is reported before we start
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	// Create a temporary folder for storing config and credentials...
 	folder, err := options.TemporaryStorage.NewFolder()
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating VPN client, couldn't create temporary folder")
@@ -74,127 +79,18 @@ func New(options Options) (*VPN, error) {
 		}
 	}
 
-	// Create files with CA, cert, key and tls-key
-	var caFile, certFile, keyFile, tlsKeyFile string
-	if c.CertificateAuthority != "" {
-		caFile = folder.NewFilePath()
-		if err = ioutil.WriteFile(caFile, []byte(c.CertificateAuthority), 0600); err != nil {
-			folder.Remove()
-			return nil, errors.Wrap(err, "error creating VPN client, failed to create temporary file")
-		}
-	}
-	if c.Certificate != "" {
-		certFile = folder.NewFilePath()
-		if err = ioutil.WriteFile(certFile, []byte(c.Certificate), 0600); err != nil {
-			folder.Remove()
-			return nil, errors.Wrap(err, "error creating VPN client, failed to create temporary file")
-		}
-	}
-	if c.Key != "" {
-		keyFile = folder.NewFilePath()
-		if err = ioutil.WriteFile(keyFile, []byte(c.Key), 0600); err != nil {
-			folder.Remove()
-			return nil, errors.Wrap(err, "error creating VPN client, failed to create temporary file")
-		}
-	}
-	if c.TLSKey != "" {
-		tlsKeyFile = folder.NewFilePath()
-		if err = ioutil.WriteFile(tlsKeyFile, []byte(c.TLSKey), 0600); err != nil {
-			folder.Remove()
-			return nil, errors.Wrap(err, "error creating VPN client, failed to create temporary file")
-		}
-	}
-
-	var args []string
-	arg := func(a string, opts ...string) {
-		args = append(args, fmt.Sprintf("--%s", a))
-		args = append(args, opts...)
-	}
-
-	// Client options
-	if c.Username != "" && c.Password != "" {
-		arg("auth-user-pass", userPassFile)
-	}
-	arg("auth-retry", "none")
-	arg("pull")
-
-	// Encryption options
-	arg("cipher", c.Cipher)
-
-	// Tunnel options
-	arg("remote", c.Remote)
-	if c.Port != 0 {
-		arg("rport", strconv.Itoa(c.Port))
-	}
-	arg("resolv-retry", "infinite")
-	arg("proto", c.Protocol)
-	arg("nobind")
-	if c.Compression != "" {
-		if c.Compression == "none" {
-			arg("compress")
-		} else {
-			arg("compress", c.Compression)
-		}
-	}
-
-	// Tun device
-	arg("dev", options.DeviceName)
-	arg("dev-type", "tun")
-
-	// Drop permissions
-	arg("user", "nobody")
-	arg("group", "nogroup")
-
-	// Persist key material
-	arg("persist-key")
-	arg("persist-tun")
-
-	// TLS Mode
-	if c.CertificateAuthority != "" {
-		arg("ca", caFile)
-	}
-	if c.Certificate != "" {
-		arg("cert", certFile)
-	}
-	if c.Key != "" {
-		arg("key", keyFile)
-	}
-	if c.TLS {
-		arg("tls-client")
-	}
-	if c.TLSKey != "" {
-		arg("tls-auth", tlsKeyFile)
-	}
-	if c.KeyDirection != nil {
-		arg("key-direction", strconv.Itoa(*c.KeyDirection))
-	}
-	if c.X509Name != "" {
-		if c.X509NameType != "" {
-			arg("verify-x509-name", c.X509Name, c.X509NameType)
-		} else {
-			arg("verify-x509-name", c.X509Name)
-		}
-	}
-	if c.RenegotiationDelay != 0 {
-		arg("reneg-sec", strconv.Itoa(int(c.RenegotiationDelay.Seconds())))
-	}
-	if c.RemoteExtendedKeyUsage != "" {
-		arg("remote-cert-eku", c.RemoteExtendedKeyUsage)
-	}
-
-	// Routing
-	arg("route-nopull")
-	for _, route := range c.Routes {
-		vpn.routes = append(vpn.routes, net.ParseIP(route))
-		arg("route", route)
+	// Create config file with CA, cert, key and tls-key inlined
+	configFile := folder.NewFilePath()
+	managementSocket := folder.NewFilePath()
+	data := c.render(options.DeviceName, userPassFile, managementSocket)
+	if err = ioutil.WriteFile(configFile, data, 0600); err != nil {
+		folder.Remove()
+		return nil, errors.Wrap(err, "error creating VPN client, failed to create config file")
 	}
-
-	// Error messages
-	arg("verb", "0")
-	arg("errors-to-stderr")
+	vpn.routes = c.routes()
 
 	// Create openvpn process
-	vpn.cmd = exec.Command("openvpn", args...)
+	vpn.cmd = exec.Command("openvpn", "--config", configFile)
 
 	// Setup pipes for stdout/stderr
 	var stdout, stderr io.Reader
@@ -216,6 +112,7 @@ func New(options Options) (*VPN, error) {
 	}
 
 	go vpn.waitForCommand()
+	go vpn.monitorManagement(managementSocket)
 
 	return vpn, nil
 }
@@ -228,6 +125,7 @@ func (vpn *VPN) waitForCommand() {
 		}
 	})
 	vpn.disposed.Do(func() {
+		vpn.closeManagement()
 		vpn.folder.Remove()
 		vpn.stdoutWriter.Close()
 		vpn.stderrWriter.Close()
@@ -235,7 +133,7 @@ func (vpn *VPN) waitForCommand() {
 }
 
 // Routes exposed by the VPN
-func (vpn *VPN) Routes() []net.IP {
+func (vpn *VPN) Routes() []*net.IPNet {
 	return vpn.routes
 }
 
@@ -5,10 +5,8 @@ package openvpn
 
 import (
 	"encoding/json"
-	"io/ioutil"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"testing"
 	"time"
 
@@ -19,15 +17,6 @@ import (
 	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
 )
 
-func fileAsJSON(t *testing.T, filename string) string {
-	data, err := ioutil.ReadFile(filepath.Join("testdata", filename))
-	require.NoError(t, err, "Failed to read: %s", filename)
-
-	raw, err := json.Marshal(string(data))
-	require.NoError(t, err, "Failed to serialize JSON")
-	return string(raw)
-}
-
 // Creating this file signals that the server has a connection
 // we use this for testing... As the VPN object doesn't really track if we
 // have connected the VPN-server or not. We can re-think that later, current
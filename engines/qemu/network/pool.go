@@ -1,12 +1,11 @@
 package network
 
 import (
-	"bytes"
 	"fmt"
 	"net"
 	"net/http"
-	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,7 +22,7 @@ import (
 
 const metaDataIP = "169.254.169.254"
 
-var remoteAddrPattern = regexp.MustCompile(`^(192\.168\.\d{1,3})\.\d{1,3}:\d{1,5}$`)
+var remoteAddrPattern = regexp.MustCompile(`^(\d{1,3}\.\d{1,3}\.\d{1,3})\.\d{1,3}:\d{1,5}$`)
 
 // Pool manages a static set of networks (TAP devices).
 type Pool struct {
@@ -32,19 +31,28 @@ type Pool struct {
 	server     *graceful.Server
 	serverDone <-chan struct{} // closed when server is stopped
 	vpns       []*openvpn.VPN
-	dnsmasq    *exec.Cmd
-	disposing  atomics.Bool   // Set when we're disposing, before killing dnsmasq
-	disposed   sync.WaitGroup // Counts subprocesses, dnsmasq and vpns
+	host       networkHost    // performs privileged operations
+	aliases    []string       // hostnames resolving to metaDataIP, sorted
+	disposing  atomics.Bool   // Set when we're disposing, before stopping vpns
+	disposed   sync.WaitGroup // Counts vpns
+	uplink     string         // interface holding the default route
+	fixUplink  bool           // uplink is configured, don't follow default route
+	subnets    subnetRange    // IPv4 subnets allocated to networks
+	firewall   firewall       // firewall backend for isolating networks
+	stopWatch  chan struct{}  // closed to stop watching for network changes
+	monitor    runtime.Monitor
 }
 
 // entry is a strictly internal presentation of a TAP device network.
 type entry struct {
+	index     int
 	tapDevice string
-	ipPrefix  string // 192.168.xxx (subnet without the last ".0")
+	ipPrefix  string // e.g. 192.168.xxx (subnet without the last ".0")
 	m         sync.RWMutex
 	handler   http.Handler
 	pool      *Pool
 	inUse     bool
+	aliases   map[string]bool // hostnames added with AddHostAlias, guarded by pool.m
 }
 
 // PoolOptions specifies options required by NewPool
@@ -63,7 +71,48 @@ func NewPool(options PoolOptions) (*Pool, error) {
 	schematypes.MustValidateAndMap(PoolConfigSchema, options.Config, &C)
 
 	p := &Pool{
-		networks: make(map[string]*entry),
+		networks:  make(map[string]*entry),
+		stopWatch: make(chan struct{}),
+		monitor:   options.Monitor,
+	}
+
+	// Find the uplink interface, used for NAT and forwarding rules
+	p.uplink = C.Uplink
+	p.fixUplink = C.Uplink != ""
+	if !p.fixUplink {
+		uplink, err := findUplink()
+		if err != nil {
+			options.Monitor.Warnf("unable to find uplink interface, assuming %s, error: %s", defaultUplinkInterface, err)
+			uplink = defaultUplinkInterface
+		}
+		p.uplink = uplink
+	}
+	p.firewall = newFirewall(C.Firewall)
+
+	// Find subnets to allocate for networks
+	subnets, err := newSubnetRange(C.SubnetBase)
+	if err != nil {
+		return nil, err
+	}
+	if C.Subnets > subnets.Size() {
+		return nil, errors.Errorf(
+			"subnetBase: '%s' only has room for %d subnets, but 'subnets' is %d",
+			C.SubnetBase, subnets.Size(), C.Subnets,
+		)
+	}
+	p.subnets = subnets
+
+	// Validate VPN configs before we start any of them
+	for i, cfg := range C.VPNs {
+		if err := openvpn.Validate(cfg); err != nil {
+			return nil, errors.Wrapf(err, "invalid config for VPN connection number %d", i)
+		}
+	}
+	if err := checkRouteConflicts(C.VPNs, p.subnets, C.Subnets); err != nil {
+		return nil, err
+	}
+	if len(C.Helper) > 0 && len(C.VPNs) > 0 {
+		return nil, errors.New("'vpnConnections' cannot be used with 'networkHelper'")
 	}
 
 	// Start VPN connections
@@ -92,6 +141,28 @@ func NewPool(options PoolOptions) (*Pool, error) {
 		}(p, p.vpns[i], monitor)
 	}
 
+	// Setup networks in-process, or using the privileged network helper
+	onCrash := func(err error) {
+		incidentID := options.Monitor.ReportError(err)
+		options.Monitor.Panic("network subprocess crashed, incidentID:", incidentID)
+	}
+	if len(C.Helper) > 0 {
+		folder, ferr := options.TemporaryStorage.NewFolder()
+		if ferr != nil {
+			return nil, errors.Wrap(ferr, "failed to create folder for network helper socket")
+		}
+		p.host, err = newRemoteHost(C.Helper, helperCredentials{
+			Firewall:   C.Firewall,
+			SubnetBase: C.SubnetBase,
+			IPv6Prefix: C.IPv6Prefix,
+		}, folder.Path(), onCrash)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.host = newLocalHost(p.vpns, p.firewall, p.subnets, C.IPv6Prefix, "", options.TemporaryStorage.NewFilePath(), onCrash)
+	}
+
 	// Create a number of networks
 	for i := 0; i < C.Subnets; i++ {
 		// Construct the network object
@@ -102,92 +173,26 @@ func NewPool(options PoolOptions) (*Pool, error) {
 		p.networks[n.ipPrefix] = n
 	}
 
-	// Enable IPv4 forwarding
-	err := script([][]string{
-		{"sysctl", "-w", "net.ipv4.ip_forward=1"},
-	}, true)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to enable ipv4 forwarding: %s", err)
-	}
-
-	// Create dnsmasq configuration
-	dnsmasqConfig := []string{
-		"strict-order",
-		"bind-interfaces",
-		"except-interface=lo",
-		"conf-file=\"\"",
-		"dhcp-no-override",
-		"host-record=taskcluster," + metaDataIP,
-		"keep-in-foreground",
-		"bogus-priv",
-		"domain-needed",
-		// Consider adding "no-ping"
-	}
-	for _, rec := range C.HostRecords {
-		dnsmasqConfig = append(dnsmasqConfig,
-			"host-record="+strings.Join(append(rec.Names, rec.IPv4, rec.IPv6), ","),
-		)
-	}
-	for _, srv := range C.SRVRecords {
-		dnsmasqConfig = append(dnsmasqConfig,
-			"srv-host="+strings.Join([]string{
-				strings.Join([]string{srv.Service, srv.Protocol, srv.Domain}, "."),
-				srv.Target,
-				strconv.Itoa(srv.Port),
-				strconv.Itoa(srv.Priority),
-				strconv.Itoa(srv.Weight),
-			}, ","),
-		)
-	}
-	for _, n := range p.networks {
-		dnsmasqConfig = append(dnsmasqConfig,
-			"interface="+n.tapDevice,
-			"dhcp-range="+strings.Join([]string{
-				"tag:" + n.tapDevice,
-				n.ipPrefix + ".2",
-				n.ipPrefix + ".254",
-				"255.255.255.0",
-				"20m",
-			}, ","),
-			"dhcp-option="+strings.Join([]string{
-				"tag:" + n.tapDevice,
-				"option:router",
-				n.ipPrefix + ".1",
-			}, ","),
-		)
+	// Enable IPv4 forwarding and add meta-data IP to loopback device
+	if err = p.host.SetupHost(); err != nil {
+		return nil, err
 	}
 
-	// Start dnsmasq
-	p.dnsmasq = exec.Command("dnsmasq", "--conf-file=-")
-	p.dnsmasq.Stdin = bytes.NewBufferString(strings.Join(dnsmasqConfig, "\n") + "\n")
-	p.dnsmasq.Stderr = nil
-	p.dnsmasq.Stdout = nil
-	err = p.dnsmasq.Start()
+	// Start dnsmasq serving DHCP and DNS to all networks
+	err = p.host.StartDNS(dnsConfig{
+		Subnets:      C.Subnets,
+		HostRecords:  C.HostRecords,
+		SRVRecords:   C.SRVRecords,
+		SearchDomain: C.Domain,
+		NTPServers:   C.NTPServers,
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to start dnsmasq")
-	}
-	// Monitor dnsmasq and panic if it crashes unexpectedly
-	p.disposed.Add(1)
-	go (func(p *Pool) {
-		werr := p.dnsmasq.Wait()
-		p.disposed.Done()
-		// Ignore errors if disposing is true, otherwise this is a fatal issue
-		if werr != nil && !p.disposing.Get() {
-			// We could probably restart the dnsmasq, as long as we avoid an infinite
-			// loop that should be fine. But dnsmasq probably won't crash without a
-			// good reason
-			m := options.Monitor.WithPrefix("dnsmasq")
-			incidentID := m.ReportError(werr, "dnsmasq died unexpectedly")
-			m.Panic("dnsmasq crashed, incidentID:", incidentID)
-		}
-	})(p)
+		return nil, err
+	}
 
-	// Add meta-data IP to loopback device
-	err = script([][]string{
-		{"ip", "addr", "add", metaDataIP, "dev", "lo"},
-	}, true)
-	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to add: %s to the loopback device", metaDataIP)
+	// Repair networks when the host network changes
+	if err = watchNetlink(p.repairNetworks, p.stopWatch); err != nil {
+		options.Monitor.ReportWarning(err, "unable to watch for host network changes")
 	}
 
 	// Create the server
@@ -224,11 +229,78 @@ func NewPool(options PoolOptions) (*Pool, error) {
 	return p, nil
 }
 
+// updateHostAliases makes the hostnames aliased by networks in use resolve to
+// the meta-data service, p.m must be held.
+func (p *Pool) updateHostAliases() error {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, entry := range p.networks {
+		for name := range entry.aliases {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") == strings.Join(p.aliases, " ") {
+		return nil
+	}
+	if err := p.host.SetHostAliases(names); err != nil {
+		return err
+	}
+	p.aliases = names
+	return nil
+}
+
 // Size returns the number of networks in the network Pool
 func (p *Pool) Size() int {
 	return len(p.networks)
 }
 
+// FirewallCommand returns the binary used to setup firewall rules isolating
+// the networks, either 'iptables' or 'nft'.
+func (p *Pool) FirewallCommand() string {
+	return p.firewall.Command()
+}
+
+// InUse returns the number of networks currently in use
+func (p *Pool) InUse() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	n := 0
+	for _, entry := range p.networks {
+		if entry.inUse {
+			n++
+		}
+	}
+	return n
+}
+
+// Verify checks that all tap devices exist and are up, if not the networks
+// are repaired and an error describing the problem is returned.
+func (p *Pool) Verify() error {
+	p.m.Lock()
+	var problems []string
+	for _, entry := range p.networks {
+		iface, err := net.InterfaceByName(entry.tapDevice)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("tap device '%s' is missing: %s", entry.tapDevice, err))
+		} else if iface.Flags&net.FlagUp == 0 {
+			problems = append(problems, fmt.Sprintf("tap device '%s' is down", entry.tapDevice))
+		}
+	}
+	p.m.Unlock()
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	p.repairNetworks()
+	return errors.Errorf("network configuration was modified:\n - %s", strings.Join(problems, "\n - "))
+}
+
 func (p *Pool) dispatchRequest(w http.ResponseWriter, r *http.Request) {
 	// Match remote address to find ipPrefix
 	match := remoteAddrPattern.FindStringSubmatch(r.RemoteAddr)
@@ -282,6 +354,35 @@ func (n *Network) SetHandler(handler http.Handler) {
 	n.entry.handler = handler
 }
 
+// AddHostAlias makes hostname resolve to the meta-data service, until the
+// network is released. Requests for the hostname are dispatched to the handler
+// for this network, so the handler should check the Host header.
+//
+// DNS is served by a single dnsmasq instance, so the hostname also resolves in
+// other networks while this network is in use, but requests from other
+// networks are dispatched to their own handlers.
+func (n *Network) AddHostAlias(hostname string) error {
+	n.m.Lock()
+	defer n.m.Unlock()
+	if n.entry == nil {
+		panic("Network.AddHostAlias() called after Network.Release()")
+	}
+
+	p := n.entry.pool
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if n.entry.aliases[hostname] {
+		return nil
+	}
+	n.entry.aliases[hostname] = true
+	if err := p.updateHostAliases(); err != nil {
+		delete(n.entry.aliases, hostname)
+		return err
+	}
+	return nil
+}
+
 // NetDev returns the argument for the QEMU -netdev option.
 func (n *Network) NetDev(ID string) string {
 	n.m.Lock()
@@ -309,10 +410,17 @@ func (n *Network) Release() {
 	n.entry.handler = nil
 	n.entry.m.Unlock()
 
-	// Set entry as idle
-	n.entry.pool.m.Lock()
+	// Remove host aliases and set entry as idle
+	p := n.entry.pool
+	p.m.Lock()
 	n.entry.inUse = false
-	n.entry.pool.m.Unlock()
+	if len(n.entry.aliases) > 0 {
+		n.entry.aliases = make(map[string]bool)
+		if err := p.updateHostAliases(); err != nil {
+			p.monitor.ReportWarning(err, "failed to remove host aliases for released network")
+		}
+	}
+	p.m.Unlock()
 
 	debug("network released: %s (%s)", n.entry.tapDevice, n.entry.ipPrefix)
 
@@ -353,17 +461,22 @@ func (p *Pool) Dispose() error {
 	p.server.Stop(500 * time.Millisecond)
 	<-p.serverDone
 
-	// Indicate that error exit is expected, from dnsmasq
+	// Indicate that error exit is expected, from vpns
 	p.disposing.Set(true)
 
-	// Kill dnsmasq
-	go p.dnsmasq.Process.Kill()
+	// Stop watching for network changes
+	close(p.stopWatch)
+
+	// Stop dnsmasq
+	if err := p.host.StopDNS(); err != nil {
+		p.monitor.ReportWarning(err, "failed to stop dnsmasq")
+	}
 
 	// Stop all VPNs
 	for _, vpn := range p.vpns {
 		go vpn.Stop()
 	}
-	// Wait for dnsmasq and vpns to halt
+	// Wait for vpns to halt
 	p.disposed.Wait()
 
 	// Delete all the networks
@@ -376,57 +489,66 @@ func (p *Pool) Dispose() error {
 	}
 	p.networks = nil
 	if len(errs) > 0 {
+		p.host.Close()
 		return errors.New(strings.Join(errs, "\n"))
 	}
 
 	// Remove meta-data IP from loopback device
-	err := script([][]string{
-		{"ip", "addr", "del", metaDataIP, "dev", "lo"},
-	}, true)
-
+	err := p.host.TeardownHost()
+	if cerr := p.host.Close(); err == nil {
+		err = cerr
+	}
 	return err
 }
 
+// repairNetworks is called when the host network has changed. It ensures that
+// tap devices are up with their address and route after interface flaps, and
+// moves NAT and forwarding rules if the default route moved to another uplink
+// interface, so VMs aren't black-holed until the worker is restarted.
+func (p *Pool) repairNetworks() {
+	if p.disposing.Get() {
+		return
+	}
+	uplink := p.uplink
+	if !p.fixUplink {
+		var err error
+		uplink, err = findUplink()
+		if err != nil {
+			p.monitor.Warn("host network changed, but unable to find uplink interface, error: ", err)
+			return
+		}
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if uplink != p.uplink {
+		p.monitor.Infof("uplink interface changed from %s to %s, moving iptables rules", p.uplink, uplink)
+	}
+	for _, n := range p.networks {
+		if err := p.host.RepairNetwork(n.index, p.uplink, uplink); err != nil {
+			p.monitor.ReportError(err, "failed to move iptables rules to new uplink interface")
+		}
+	}
+	p.uplink = uplink
+}
+
 // createNetwork creates a tap device and related ip-tables configuration.
 // This does not start dnsmasq, use newNetworkPool() to create a set of
 // networks with dnsmasq running.
 func createNetwork(index int, parent *Pool) (*entry, error) {
-	// Each network has a name and an ip-prefix, we use the 192.168.0.0/16
-	// subnet starting from 192.168.150.0
-	tapDevice := "tctap" + strconv.Itoa(index)
-	ipPrefix := "192.168." + strconv.Itoa(index+150)
-
-	//err := createTAPDevice(tapDevice)
-	//if err != nil {
-	//	return nil, fmt.Errorf("Failed to create tap device: %s, error: %s", tapDevice, err)
-	//}
-
-	err := script([][]string{
-		// Create tap device
-		{"ip", "tuntap", "add", "dev", tapDevice, "mode", "tap"},
-		// Assign IP-address to tap device
-		{"ip", "addr", "add", ipPrefix + ".1", "dev", tapDevice},
-		// Activate the link
-		{"ip", "link", "set", "dev", tapDevice, "up"},
-		// Add route for the network subnet, routing it to the tap device
-		{"ip", "route", "add", ipPrefix + ".0/24", "dev", tapDevice},
-	}, true)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to setup tap device: %s, error: %s", tapDevice, err)
-	}
-
-	// Create iptables rules and chains
-	err = script(ipTableRules(tapDevice, ipPrefix, parent.vpns, false), false)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to setup ip-tables for tap device: %s error: %s", tapDevice, err)
+	if err := parent.host.CreateNetwork(index, parent.uplink); err != nil {
+		return nil, err
 	}
 
 	// Construct the network object
 	return &entry{
-		tapDevice: tapDevice,
-		ipPrefix:  ipPrefix,
+		index:     index,
+		tapDevice: tapDeviceName(index),
+		ipPrefix:  parent.subnets.Prefix(index),
 		handler:   nil,
 		pool:      parent,
+		aliases:   make(map[string]bool),
 	}, nil
 }
 
@@ -438,32 +560,14 @@ func destroyNetwork(n *entry) error {
 		return errors.New("network.tapDevice is empty, implying the network has been destroyed")
 	}
 
-	// Delete iptables rules and chains
-	err := script(ipTableRules(n.tapDevice, n.ipPrefix, n.pool.vpns, true), false)
-	if err != nil {
-		return fmt.Errorf("Failed to remove ip-tables for tap device: %s, error: %s", n.tapDevice, err)
-	}
-
-	err = script([][]string{
-		// Remove route for the network subnet
-		{"ip", "route", "del", n.ipPrefix + ".0/24", "dev", n.tapDevice},
-		// Deactivate the link
-		{"ip", "link", "set", "dev", n.tapDevice, "down"},
-		// Unassign IP-address from tap device
-		{"ip", "addr", "del", n.ipPrefix + ".1", "dev", n.tapDevice},
-		// Delete tap device
-		{"ip", "tuntap", "del", "dev", n.tapDevice, "mode", "tap"},
-	}, true)
-	if err != nil {
-		debug("Failed to destoy tap device: %s, error: %s", n.tapDevice, err)
-		return fmt.Errorf("Failed to remove tap device: %s, error: %s", n.tapDevice, err)
+	// Delete iptables rules, chains and tap device
+	n.pool.m.Lock()
+	uplink := n.pool.uplink
+	n.pool.m.Unlock()
+	if err := n.pool.host.DestroyNetwork(n.index, uplink); err != nil {
+		return err
 	}
 
-	//err = destroyTAPDevice(n.tapDevice)
-	//if err != nil {
-	//	return fmt.Errorf("Failed to destroy tap device: %s, error: %s", n.tapDevice, err)
-	//}
-
 	// Clear handler and tapDevice
 	n.handler = nil
 	n.tapDevice = ""
@@ -11,8 +11,19 @@ type poolConfig struct {
 	VPNs        []interface{} `json:"vpnConnections,omitempty"`
 	SRVRecords  []srvRecord   `json:"srvRecords,omitempty"`
 	HostRecords []hostRecord  `json:"hostRecords,omitempty"`
+	Helper      []string      `json:"networkHelper,omitempty"`
+	Firewall    string        `json:"firewall,omitempty"`
+	IPv6Prefix  string        `json:"ipv6Prefix,omitempty"`
+	SubnetBase  string        `json:"subnetBase,omitempty"`
+	Uplink      string        `json:"uplinkInterface,omitempty"`
+	Domain      string        `json:"searchDomain,omitempty"`
+	NTPServers  []string      `json:"ntpServers,omitempty"`
 }
 
+// ipv6PrefixPattern matches the /48 unique local address prefix from which
+// IPv6 subnets are allocated, given as the first 3 groups, e.g. 'fd00:1:2'.
+const ipv6PrefixPattern = `^fd[0-9a-f]{2}(:[0-9a-f]{1,4}){2}$`
+
 type srvRecord struct {
 	Service  string `json:"service,omitempty"`
 	Protocol string `json:"protocol,omitempty"`
@@ -35,7 +46,7 @@ var PoolConfigSchema schematypes.Schema = schematypes.Object{
 	Properties: schematypes.Properties{
 		"subnets": schematypes.Integer{
 			Description: util.Markdown(`
-				Number of subnets to creates.
+				Number of subnets to creates, each subnet has a tap device.
 				This determines the maximum number of concurrent VMs the worker can run.
 
 				Each subnet defines a set chains and rules in 'iptables', and thus,
@@ -45,6 +56,31 @@ var PoolConfigSchema schematypes.Schema = schematypes.Object{
 			Minimum: 1,
 			Maximum: 100,
 		},
+		"subnetBase": schematypes.String{
+			Title: "Subnet Base",
+			Description: util.Markdown(`
+				IPv4 network in CIDR notation from which a /24 subnet is allocated
+				for each virtual machine network, e.g. '10.100.0.0/16'.
+
+				Subnets are allocated consecutively starting from the address given,
+				which must be the start of a /24 subnet, hence, '192.168.150.0/16'
+				allocates subnets from '192.168.150.0/24' to '192.168.255.0/24'.
+				The network must have room for the number of 'subnets' configured.
+				Defaults to '192.168.150.0/16'.
+			`),
+			Pattern: `^\d{1,3}(\.\d{1,3}){3}/\d{1,2}$`,
+		},
+		"uplinkInterface": schematypes.String{
+			Title: "Uplink Interface",
+			Description: util.Markdown(`
+				Network interface through which traffic from virtual machines is
+				forwarded to the internet with NAT, e.g. 'eth0'.
+
+				If not given, the interface holding the default route is used, and
+				rules are moved if the default route moves to another interface.
+			`),
+			Pattern: `^[a-zA-Z0-9_.-]{1,15}$`,
+		},
 		"vpnConnections": schematypes.Array{
 			Title: "VPN Connections",
 			Description: util.Markdown(`
@@ -54,6 +90,10 @@ var PoolConfigSchema schematypes.Schema = schematypes.Object{
 
 				Note: servers on the VPN will not be able to open incoming connections
 				to the virtual machines, as the VMs will sit behind NAT.
+
+				Certificates and keys can be loaded from the secrets service using
+				the 'secrets' config transform, e.g. '{"$secret": "NAME", "key": "KEY"}'.
+				Configuration is validated when the worker starts.
 			`),
 			Items: openvpn.ConfigSchema,
 		},
@@ -99,6 +139,77 @@ var PoolConfigSchema schematypes.Schema = schematypes.Object{
 				Required: []string{"names"},
 			},
 		},
+		"searchDomain": schematypes.String{
+			Title: "DNS Search Domain",
+			Description: util.Markdown(`
+				DNS search domain handed out to virtual machines with DHCP, such that
+				unqualified hostnames are resolved within this domain, e.g.
+				'internal.example.com'.
+
+				If not given, no search domain is handed out to virtual machines.
+			`),
+			Pattern: `^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`,
+		},
+		"ntpServers": schematypes.Array{
+			Title: "NTP Servers",
+			Description: util.Markdown(`
+				IPv4 addresses of NTP servers handed out to virtual machines with DHCP,
+				such that guests can keep correct time for TLS, without image specific
+				configuration. The servers must be reachable from the virtual machines
+				through the uplink interface or a VPN connection.
+
+				If not given, no NTP servers are handed out to virtual machines.
+			`),
+			Items: schematypes.String{
+				Pattern: `^\d{1,3}(\.\d{1,3}){3}$`,
+			},
+		},
+		"firewall": schematypes.StringEnum{
+			Title: "Firewall Backend",
+			Description: util.Markdown(`
+				Firewall used for isolating virtual machine networks, 'iptables' or
+				'nftables'. Defaults to 'auto', which uses 'iptables' if installed,
+				otherwise 'nftables' is used if the 'nft' binary is installed.
+
+				Use 'nftables' on hosts where 'iptables' is installed, but the
+				legacy iptables kernel modules aren't available.
+			`),
+			Options: []string{firewallAuto, firewallIPTables, firewallNFTables},
+		},
+		"ipv6Prefix": schematypes.String{
+			Title: "IPv6 Prefix",
+			Description: util.Markdown(`
+				Unique local address prefix (/48) from which an IPv6 subnet (/64) is
+				allocated for each virtual machine network, given as the first 3
+				groups, e.g. 'fd00:1:2'. Virtual machines configure IPv6 addresses
+				from router advertisements and traffic is forwarded to the uplink
+				interface with NAT, just like IPv4.
+
+				If not given, virtual machine networks are IPv4 only.
+			`),
+			Pattern: ipv6PrefixPattern,
+		},
+		"networkHelper": schematypes.Array{
+			Title: "Privileged Network Helper",
+			Description: util.Markdown(`
+				Command to start a privileged helper process that creates tap
+				devices, iptables rules and runs dnsmasq on behalf of the worker.
+				This allows the worker to run unprivileged, with only the small
+				helper running as root, e.g.
+				'["sudo", "-n", "/usr/local/bin/taskcluster-worker", "network-helper"]'.
+
+				The helper connects back to the worker over an authenticated unix
+				socket and only accepts a narrow set of validated requests. Tap devices
+				are owned by the worker user, so QEMU can run unprivileged.
+				The worker still needs access to '/dev/kvm' and the capability
+				'CAP_NET_BIND_SERVICE' to serve the meta-data service on port 80.
+				VPN connections are not supported with the network helper.
+
+				If not given, the worker must run as root and sets up networks
+				in-process.
+			`),
+			Items: schematypes.String{},
+		},
 	},
 	Required: []string{"subnets"},
 }
@@ -0,0 +1,178 @@
+package network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/ipc"
+)
+
+// Maximum time to wait for the network helper to connect, and to exit when
+// closing the connection.
+const helperTimeout = 30 * time.Second
+
+// helperCredentials is written as JSON to stdin of the network helper
+type helperCredentials struct {
+	Address    string `json:"address"`
+	Secret     string `json:"secret"`
+	Firewall   string `json:"firewall,omitempty"`   // firewall backend to use
+	SubnetBase string `json:"subnetBase,omitempty"` // CIDR for IPv4 subnets
+	IPv6Prefix string `json:"ipv6Prefix,omitempty"` // prefix for IPv6 subnets
+}
+
+// remoteHost implements networkHost by calling a privileged network helper
+// process started with the configured command, see ServeHelper().
+type remoteHost struct {
+	client  *rpc.Client
+	cmd     *exec.Cmd
+	exited  chan struct{} // closed when the helper has exited
+	closing atomics.Bool  // set when closing, after which helper exit is expected
+}
+
+// newRemoteHost starts the network helper with command and waits for it to
+// connect to a socket created in folder. If the helper exits unexpectedly
+// onCrash is called. Address and secret are set on creds before they are
+// written to the helper.
+func newRemoteHost(command []string, creds helperCredentials, folder string, onCrash func(error)) (*remoteHost, error) {
+	address, err := ipc.NewAddress(folder)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ipc.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	l, err := ipc.Listen(address, secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen for network helper")
+	}
+	defer l.Close() // we only accept a single connection
+
+	// Start the helper with credentials on stdin, unlike environment variables
+	// these aren't cleared by sudo.
+	creds.Address = address
+	creds.Secret = hex.EncodeToString(secret)
+	data, _ := json.Marshal(creds)
+	h := &remoteHost{
+		cmd:    exec.Command(command[0], command[1:]...),
+		exited: make(chan struct{}),
+	}
+	h.cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	h.cmd.Stdout = os.Stderr
+	h.cmd.Stderr = os.Stderr
+	if err = h.cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "failed to start network helper")
+	}
+	var werr error
+	go func() {
+		werr = h.cmd.Wait()
+		close(h.exited)
+	}()
+
+	// Wait for the helper to connect
+	type acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		conn, aerr := l.Accept()
+		accepted <- acceptResult{conn, aerr}
+	}()
+	select {
+	case r := <-accepted:
+		if r.err != nil {
+			h.cmd.Process.Kill()
+			<-h.exited
+			return nil, errors.Wrap(r.err, "network helper failed to connect")
+		}
+		h.client = rpc.NewClient(r.conn)
+	case <-h.exited:
+		return nil, errors.Errorf("network helper exited before connecting, error: %v", werr)
+	case <-time.After(helperTimeout):
+		h.cmd.Process.Kill()
+		<-h.exited
+		return nil, errors.New("timed out waiting for network helper to connect")
+	}
+
+	// Report if the helper exits before we close the connection
+	go func() {
+		<-h.exited
+		if !h.closing.Get() {
+			onCrash(errors.Errorf("network helper exited unexpectedly, error: %v", werr))
+		}
+	}()
+	return h, nil
+}
+
+// call invokes method on the network helper
+func (h *remoteHost) call(method string, args interface{}) error {
+	var ok bool
+	return h.client.Call("NetworkHelper."+method, args, &ok)
+}
+
+func (h *remoteHost) SetupHost() error {
+	return h.call("SetupHost", true)
+}
+
+func (h *remoteHost) TeardownHost() error {
+	return h.call("TeardownHost", true)
+}
+
+func (h *remoteHost) CreateNetwork(index int, uplink string) error {
+	return h.call("CreateNetwork", HelperNetworkArgs{Index: index, Uplink: uplink})
+}
+
+func (h *remoteHost) DestroyNetwork(index int, uplink string) error {
+	return h.call("DestroyNetwork", HelperNetworkArgs{Index: index, Uplink: uplink})
+}
+
+func (h *remoteHost) RepairNetwork(index int, oldUplink, newUplink string) error {
+	return h.call("RepairNetwork", HelperNetworkArgs{
+		Index:     index,
+		OldUplink: oldUplink,
+		Uplink:    newUplink,
+	})
+}
+
+func (h *remoteHost) StartDNS(config dnsConfig) error {
+	return h.call("StartDNS", HelperDNSArgs{
+		Subnets:      config.Subnets,
+		HostRecords:  config.HostRecords,
+		SRVRecords:   config.SRVRecords,
+		SearchDomain: config.SearchDomain,
+		NTPServers:   config.NTPServers,
+	})
+}
+
+func (h *remoteHost) SetHostAliases(hostnames []string) error {
+	return h.call("SetHostAliases", hostnames)
+}
+
+func (h *remoteHost) StopDNS() error {
+	return h.call("StopDNS", true)
+}
+
+// Close disconnects from the network helper, causing it to exit
+func (h *remoteHost) Close() error {
+	if h.closing.Swap(true) {
+		return nil
+	}
+	err := h.client.Close()
+	select {
+	case <-h.exited:
+	case <-time.After(helperTimeout):
+		h.cmd.Process.Kill()
+		<-h.exited
+		return errors.New("network helper didn't exit after connection was closed")
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/network/openvpn"
+)
+
+// defaultSubnetBase is used if 'subnetBase' isn't configured, this allocates
+// subnets in 192.168.0.0/16 starting from 192.168.150.0/24
+const defaultSubnetBase = "192.168.150.0/16"
+
+// subnetRange allocates a /24 subnet for each network, consecutively from the
+// first subnet given by 'subnetBase'.
+type subnetRange struct {
+	base uint32 // address of the first subnet
+	size int    // number of subnets available
+}
+
+// newSubnetRange returns a subnetRange from 'subnetBase' given as an IPv4 CIDR,
+// such as '10.100.0.0/16'. Subnets are allocated from the address given in the
+// CIDR, which must be the start of a /24 subnet, and may not extend beyond the
+// network given by the CIDR. If subnetBase is empty defaultSubnetBase is used.
+func newSubnetRange(subnetBase string) (subnetRange, error) {
+	if subnetBase == "" {
+		subnetBase = defaultSubnetBase
+	}
+	ip, network, err := net.ParseCIDR(subnetBase)
+	if err != nil || ip.To4() == nil {
+		return subnetRange{}, fmt.Errorf("subnetBase: '%s' is not an IPv4 CIDR", subnetBase)
+	}
+	ones, _ := network.Mask.Size()
+	if ones > 24 {
+		return subnetRange{}, fmt.Errorf("subnetBase: '%s' must be /24 or larger", subnetBase)
+	}
+	ip4 := ip.To4()
+	if ip4[3] != 0 {
+		return subnetRange{}, fmt.Errorf("subnetBase: '%s' must start at a /24 subnet", subnetBase)
+	}
+	base := binary.BigEndian.Uint32(ip4)
+	end := binary.BigEndian.Uint32(network.IP.To4()) + uint32(1)<<uint(32-ones)
+	size := int((uint64(end) - uint64(base)) >> 8)
+	if size > maxSubnets {
+		size = maxSubnets
+	}
+	return subnetRange{base: base, size: size}, nil
+}
+
+// Size returns the number of subnets that can be allocated
+func (r subnetRange) Size() int {
+	return r.size
+}
+
+// Prefix returns the ip-prefix for the network with given index, this is the
+// subnet without the last ".0", e.g. '192.168.150'
+func (r subnetRange) Prefix(index int) string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, r.base+uint32(index)<<8)
+	return strings.TrimSuffix(ip.String(), ".0")
+}
+
+// Subnet returns the /24 subnet for the network with given index
+func (r subnetRange) Subnet(index int) *net.IPNet {
+	return &net.IPNet{
+		IP:   net.ParseIP(r.Prefix(index) + ".0").To4(),
+		Mask: net.CIDRMask(24, 32),
+	}
+}
+
+// subnet6Prefix returns the IPv6 prefix for the network with given index, this
+// is the /64 subnet without the trailing "::". Given the /48 prefix configured
+// with 'ipv6Prefix' such as 'fd00:1:2', the network with index 0 has the subnet
+// fd00:1:2:96::/64. Returns empty string, if prefix is empty.
+func subnet6Prefix(prefix string, index int) string {
+	if prefix == "" {
+		return ""
+	}
+	return prefix + ":" + strconv.FormatInt(int64(index+150), 16)
+}
+
+// overlaps returns true, if a and b have addresses in common
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// checkRouteConflicts returns an error, if routes from different VPNs overlap
+// or if a route overlaps with one of the first count subnets from subnets,
+// these are used for virtual machines. Overlapping routes would otherwise give
+// ambiguous iptables forwarding rules.
+func checkRouteConflicts(vpns []interface{}, subnets subnetRange, count int) error {
+	routes := make([][]*net.IPNet, len(vpns))
+	for i, cfg := range vpns {
+		routes[i] = openvpn.Routes(cfg)
+	}
+
+	for i, rs := range routes {
+		for _, r := range rs {
+			for j := 0; j < count; j++ {
+				if s := subnets.Subnet(j); overlaps(r, s) {
+					return fmt.Errorf(
+						"route: %s from VPN connection number %d overlaps with virtual machine subnet %s",
+						r, i, s,
+					)
+				}
+			}
+			for j := i + 1; j < len(routes); j++ {
+				for _, r2 := range routes[j] {
+					if overlaps(r, r2) {
+						return fmt.Errorf(
+							"route: %s from VPN connection number %d overlaps with route: %s from VPN connection number %d",
+							r, i, r2, j,
+						)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
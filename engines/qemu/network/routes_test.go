@@ -0,0 +1,82 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func vpnConfig(routes ...interface{}) interface{} {
+	return map[string]interface{}{
+		"remote":   "localhost",
+		"cipher":   "AES-256-CBC",
+		"protocol": "udp",
+		"routes":   routes,
+	}
+}
+
+func TestCheckRouteConflicts(t *testing.T) {
+	subnets, err := newSubnetRange("")
+	require.NoError(t, err)
+
+	require.NoError(t, checkRouteConflicts([]interface{}{
+		vpnConfig("10.0.0.0/16", "10.2.3.4"),
+		vpnConfig("10.1.0.0/16"),
+	}, subnets, 10))
+
+	err = checkRouteConflicts([]interface{}{
+		vpnConfig("10.0.0.0/8"),
+		vpnConfig("10.1.2.3"),
+	}, subnets, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "VPN connection number 1")
+
+	err = checkRouteConflicts([]interface{}{
+		vpnConfig("192.168.152.7"),
+	}, subnets, 5)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "192.168.152.0/24")
+
+	// Subnets not in use doesn't conflict
+	require.NoError(t, checkRouteConflicts([]interface{}{
+		vpnConfig("192.168.152.7"),
+	}, subnets, 2))
+}
+
+func TestSubnet6Prefix(t *testing.T) {
+	require.Equal(t, "", subnet6Prefix("", 0))
+	require.Equal(t, "fd00:1:2:96", subnet6Prefix("fd00:1:2", 0))
+	require.Equal(t, "fd00:1:2:fa", subnet6Prefix("fd00:1:2", 100))
+}
+
+func TestSubnetRange(t *testing.T) {
+	r, err := newSubnetRange("")
+	require.NoError(t, err)
+	require.Equal(t, "192.168.150", r.Prefix(0))
+	require.Equal(t, "192.168.249", r.Prefix(99))
+	require.Equal(t, "192.168.151.0/24", r.Subnet(1).String())
+	require.Equal(t, 100, r.Size())
+
+	r, err = newSubnetRange("10.100.0.0/16")
+	require.NoError(t, err)
+	require.Equal(t, "10.100.0", r.Prefix(0))
+	require.Equal(t, "10.100.42", r.Prefix(42))
+	require.Equal(t, maxSubnets, r.Size())
+
+	r, err = newSubnetRange("10.0.255.0/8")
+	require.NoError(t, err)
+	require.Equal(t, "10.1.0", r.Prefix(1))
+
+	r, err = newSubnetRange("172.16.4.0/22")
+	require.NoError(t, err)
+	require.Equal(t, 4, r.Size())
+
+	r, err = newSubnetRange("192.168.250.0/16")
+	require.NoError(t, err)
+	require.Equal(t, 6, r.Size())
+
+	for _, invalid := range []string{"10.0.0.1/16", "10.0.0.0/25", "fd00::/48", "10.0.0.0"} {
+		_, err = newSubnetRange(invalid)
+		require.Error(t, err, invalid)
+	}
+}
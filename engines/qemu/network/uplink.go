@@ -0,0 +1,44 @@
+package network
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Uplink interface to assume, if no default route can be found
+const defaultUplinkInterface = "eth0"
+
+// findUplink returns the name of the interface holding the IPv4 default route
+func findUplink() (string, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read routing table")
+	}
+	defer f.Close()
+	return parseUplink(f)
+}
+
+// parseUplink finds the interface of the default route in routing table
+// formatted as /proc/net/route
+func parseUplink(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		if fields[1] == "00000000" && fields[7] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.Wrap(err, "failed to read routing table")
+	}
+	return "", errors.New("no default route found in routing table")
+}
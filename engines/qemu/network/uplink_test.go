@@ -0,0 +1,49 @@
+package network
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const routeTable = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	0000A8C0	00000000	0001	0	0	600	00FFFFFF	0	0	0
+ens5	00000000	0100A8C0	0003	0	0	100	00000000	0	0	0
+`
+
+func TestParseUplink(t *testing.T) {
+	uplink, err := parseUplink(strings.NewReader(routeTable))
+	require.NoError(t, err)
+	require.Equal(t, "ens5", uplink)
+
+	_, err = parseUplink(strings.NewReader(strings.SplitN(routeTable, "ens5", 2)[0]))
+	require.Error(t, err)
+}
+
+func TestUplinkRules(t *testing.T) {
+	cmds := uplinkRules("tctap0", "192.168.150", nil, "eth0", "ens5")
+	require.Len(t, cmds, 6)
+
+	// New rules must be added before old rules are deleted
+	for i, cmd := range cmds {
+		line := strings.Join(cmd, " ")
+		if i < 3 {
+			require.Contains(t, line, "ens5")
+			require.NotContains(t, line, " -D ")
+		} else {
+			require.Contains(t, line, "eth0")
+			require.Contains(t, line, " -D ")
+		}
+	}
+	require.Contains(t, strings.Join(cmds[1], " "), "-I fwd_input_tctap0 5 -o ens5")
+}
+
+func TestUplinkRules6(t *testing.T) {
+	cmds := uplinkRules6("tctap0", "fd00:1:2:96", nil, "eth0", "ens5")
+	require.Len(t, cmds, 6)
+	for _, cmd := range cmds {
+		require.Equal(t, "ip6tables", cmd[0])
+	}
+	require.Contains(t, strings.Join(cmds[1], " "), "-I fwd_input_tctap0 3 -o ens5 -s fd00:1:2:96::/64")
+}
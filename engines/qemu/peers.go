@@ -0,0 +1,318 @@
+package qemuengine
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/image"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Maximum time to spend fetching an image from peers
+const peerFetchTimeout = 30 * time.Minute
+
+// Number of chunks fetched from peers concurrently, this also limits the
+// number of chunks held in memory.
+const peerFetchConcurrency = 4
+
+// Maximum chunk size accepted in a chunk manifest from a peer
+const maxPeerChunkSize = 64 * 1024 * 1024
+
+// Default limit for the size of image files retained for sharing
+const defaultMaxArchiveSize = 10 * 1024 * 1024 * 1024
+
+type imagePeersConfig struct {
+	ListenAddress  string   `json:"listenAddress"`
+	Peers          []string `json:"peers"`
+	MaxArchiveSize int64    `json:"maxArchiveSize"`
+}
+
+var imagePeersSchema = schematypes.Object{
+	Title: "Image Peers",
+	Description: util.Markdown(`
+		Share images with other workers on the same network, instead of all
+		workers downloading images from the original location.
+
+		When enabled, the worker keeps downloaded images and serves them to
+		peers over HTTP on 'listenAddress'. Before downloading an image the
+		worker fetches a list of chunk hashes from a peer that has the image,
+		and then fetches the chunks from all peers that have the image,
+		falling back to the original location if no peer has the image.
+
+		Only images referenced with a 'sha256' or 'sha512' hash, which can be
+		fetched without any scopes are shared. Each chunk is validated against
+		the list of chunk hashes, and the image is validated against the hash
+		from the image reference. Requests from peers are not authenticated, so
+		peers should be on a private network.
+	`),
+	Properties: schematypes.Properties{
+		"listenAddress": schematypes.String{
+			Title: "Listen Address",
+			Description: util.Markdown(`
+				Address to serve images to peers on, e.g. ':60088'.
+			`),
+		},
+		"peers": schematypes.Array{
+			Title: "Peers",
+			Description: util.Markdown(`
+				Base URLs for peers to fetch images from, e.g.
+				'http://10.0.0.2:60088'. This may include the worker itself.
+			`),
+			Items: schematypes.URI{},
+		},
+		"maxArchiveSize": schematypes.Integer{
+			Title: "Maximum Retained Image Size",
+			Description: util.Markdown(`
+				Maximum number of bytes of downloaded image files to keep for
+				serving to peers, image files least recently served are deleted
+				when this is exceeded. Retained image files are in addition to the
+				extracted images, defaults to 10 GiB.
+			`),
+			Minimum: 0,
+			Maximum: math.MaxInt64,
+		},
+	},
+	Required: []string{"listenAddress", "peers"},
+}
+
+// requiresNoScopes returns true, if one of the scopeSets is empty
+func requiresNoScopes(scopeSets [][]string) bool {
+	for _, scopes := range scopeSets {
+		if len(scopes) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchImageFromPeers attempts to fetch imageID from peers, returns true if
+// successful. If unsuccessful target will have been reset.
+func (e *engine) fetchImageFromPeers(ctx context.Context, client *http.Client, imageID string, target fetcher.WriteReseter) bool {
+	if len(e.imagePeers) == 0 || !image.IsContentAddressed(imageID) {
+		return false
+	}
+
+	// Shuffle peers, so we don't all fetch from the same peers
+	peers := make([]string, len(e.imagePeers))
+	for i, j := range rand.Perm(len(e.imagePeers)) {
+		peers[i] = e.imagePeers[j]
+	}
+
+	err := fetchImageFromPeerSet(ctx, client, peers, imageID, target)
+	if err == nil {
+		debug("fetched image: %s from peers", imageID)
+		e.monitor.Count("image-peers.hit", 1)
+		return true
+	}
+	debug("failed to fetch image: %s from peers, error: %s", imageID, err)
+	if rerr := target.Reset(); rerr != nil {
+		e.monitor.ReportWarning(rerr, "failed to reset target after fetching from peers")
+	}
+	e.monitor.Count("image-peers.miss", 1)
+	return false
+}
+
+// fetchImageFromPeerSet fetches the chunk manifest for imageID from the first
+// peer that has it, and then fetches chunks from peers, validating each chunk
+// against the manifest and the image against the hash from imageID.
+func fetchImageFromPeerSet(ctx context.Context, client *http.Client, peers []string, imageID string, target io.Writer) error {
+	algorithm, expected, ok := image.ContentHash(imageID)
+	if !ok {
+		return fmt.Errorf("imageID: %s is not a content hash", imageID)
+	}
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, peerFetchTimeout)
+	defer cancel()
+
+	var manifest *image.ChunkManifest
+	err := errors.New("no peers")
+	for _, peer := range peers {
+		manifest, err = fetchChunkManifest(ctx, client, peer, imageID)
+		if err == nil {
+			break
+		}
+		debug("failed to fetch chunk manifest for image: %s from peer: %s, error: %s", imageID, peer, err)
+	}
+	if manifest == nil {
+		return errors.Wrap(err, "no peer has the image")
+	}
+
+	// Fetch chunks concurrently, and write them to target in order. A slot in
+	// sem is held from a chunk is being fetched until it has been written.
+	p := &peerSet{client: client, peers: peers, bad: make(map[string]bool)}
+	results := make([]chan chunkResult, len(manifest.Chunks))
+	for i := range results {
+		results[i] = make(chan chunkResult, 1)
+	}
+	sem := make(chan struct{}, peerFetchConcurrency)
+	go func() {
+		for i := range results {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				for ; i < len(results); i++ {
+					results[i] <- chunkResult{err: ctx.Err()}
+				}
+				return
+			}
+			go func(i int) {
+				data, err := p.fetchChunk(ctx, imageID, manifest, i)
+				results[i] <- chunkResult{data: data, err: err}
+			}(i)
+		}
+	}()
+	w := io.MultiWriter(target, h)
+	for i := range results {
+		r := <-results[i]
+		if r.err != nil {
+			return r.err
+		}
+		if _, err = w.Write(r.data); err != nil {
+			return err
+		}
+		<-sem
+	}
+
+	if hashsum := hex.EncodeToString(h.Sum(nil)); hashsum != expected {
+		return fmt.Errorf("image from peers had %s: %s, expected: %s", algorithm, hashsum, expected)
+	}
+	return nil
+}
+
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// fetchChunkManifest fetches and validates the chunk manifest for imageID
+func fetchChunkManifest(ctx context.Context, client *http.Client, peer, imageID string) (*image.ChunkManifest, error) {
+	req, err := http.NewRequest(http.MethodGet, peerImageURL(peer, imageID)+"/chunks", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer responded with status: %d", res.StatusCode)
+	}
+
+	var manifest image.ChunkManifest
+	if err = json.NewDecoder(io.LimitReader(res.Body, 10*1024*1024)).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "invalid chunk manifest")
+	}
+	if manifest.ChunkSize <= 0 || manifest.ChunkSize > maxPeerChunkSize || manifest.Size < 0 {
+		return nil, fmt.Errorf("invalid chunk manifest, size: %d, chunkSize: %d", manifest.Size, manifest.ChunkSize)
+	}
+	if int64(len(manifest.Chunks)) != (manifest.Size+manifest.ChunkSize-1)/manifest.ChunkSize {
+		return nil, fmt.Errorf("invalid chunk manifest, %d chunks for size: %d", len(manifest.Chunks), manifest.Size)
+	}
+	return &manifest, nil
+}
+
+// peerSet tracks peers that failed to serve a valid chunk
+type peerSet struct {
+	m      sync.Mutex
+	client *http.Client
+	peers  []string
+	bad    map[string]bool
+}
+
+// fetchChunk fetches chunk i from one of the peers that hasn't failed,
+// starting with peer i, such that chunks are fetched from all peers.
+func (p *peerSet) fetchChunk(ctx context.Context, imageID string, manifest *image.ChunkManifest, i int) ([]byte, error) {
+	var err error
+	for n := 0; n < len(p.peers); n++ {
+		peer := p.peers[(i+n)%len(p.peers)]
+		p.m.Lock()
+		bad := p.bad[peer]
+		p.m.Unlock()
+		if bad {
+			continue
+		}
+		var data []byte
+		data, err = fetchChunkFromPeer(ctx, p.client, peer, imageID, manifest, i)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		debug("failed to fetch chunk %d of image: %s from peer: %s, error: %s", i, imageID, peer, err)
+		p.m.Lock()
+		p.bad[peer] = true
+		p.m.Unlock()
+	}
+	if err == nil {
+		err = errors.New("all peers failed")
+	}
+	return nil, errors.Wrapf(err, "failed to fetch chunk %d from peers", i)
+}
+
+// fetchChunkFromPeer fetches chunk i of imageID from peer, and validates it
+// against the manifest
+func fetchChunkFromPeer(ctx context.Context, client *http.Client, peer, imageID string, manifest *image.ChunkManifest, i int) ([]byte, error) {
+	start := int64(i) * manifest.ChunkSize
+	end := start + manifest.ChunkSize
+	if end > manifest.Size {
+		end = manifest.Size
+	}
+
+	req, err := http.NewRequest(http.MethodGet, peerImageURL(peer, imageID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("peer responded with status: %d", res.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, end-start+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != end-start {
+		return nil, fmt.Errorf("peer returned %d bytes, expected %d", len(data), end-start)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != manifest.Chunks[i] {
+		return nil, errors.New("chunk doesn't match sha256 from chunk manifest")
+	}
+	return data, nil
+}
+
+// peerImageURL returns the URL for imageID on peer
+func peerImageURL(peer, imageID string) string {
+	return strings.TrimSuffix(peer, "/") + "/images/" + url.PathEscape(imageID)
+}
@@ -0,0 +1,101 @@
+package qemuengine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/image"
+)
+
+// servePeer serves data as imageID in chunks of chunkSize, if corrupt is true
+// the served image is modified after the chunk manifest is computed.
+func servePeer(imageID string, data []byte, chunkSize int64, corrupt bool) *httptest.Server {
+	manifest := image.ChunkManifest{Size: int64(len(data)), ChunkSize: chunkSize, Chunks: []string{}}
+	for i := int64(0); i < int64(len(data)); i += chunkSize {
+		end := i + chunkSize
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		sum := sha256.Sum256(data[i:end])
+		manifest.Chunks = append(manifest.Chunks, hex.EncodeToString(sum[:]))
+	}
+	served := data
+	if corrupt {
+		served = bytes.ToUpper(data)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/images/" + imageID + "/chunks":
+			json.NewEncoder(w).Encode(manifest)
+		case "/images/" + imageID:
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(served))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestFetchImageFromPeerSet(t *testing.T) {
+	data := []byte(strings.Repeat("hello world, this is not really an image\n", 100))
+	sum := sha256.Sum256(data)
+	imageID := "3:sha256=" + hex.EncodeToString(sum[:])
+
+	good1 := servePeer(imageID, data, 1000, false)
+	defer good1.Close()
+	good2 := servePeer(imageID, data, 1000, false)
+	defer good2.Close()
+	bad := servePeer(imageID, data, 1000, true)
+	defer bad.Close()
+
+	t.Run("multiple peers", func(t *testing.T) {
+		var b bytes.Buffer
+		err := fetchImageFromPeerSet(context.Background(), http.DefaultClient, []string{good1.URL, good2.URL}, imageID, &b)
+		require.NoError(t, err)
+		require.Equal(t, data, b.Bytes())
+	})
+
+	t.Run("peer with corrupt chunks", func(t *testing.T) {
+		var b bytes.Buffer
+		err := fetchImageFromPeerSet(context.Background(), http.DefaultClient, []string{bad.URL, good1.URL}, imageID, &b)
+		require.NoError(t, err)
+		require.Equal(t, data, b.Bytes())
+	})
+
+	t.Run("only corrupt peers", func(t *testing.T) {
+		var b bytes.Buffer
+		err := fetchImageFromPeerSet(context.Background(), http.DefaultClient, []string{bad.URL}, imageID, &b)
+		require.Error(t, err)
+	})
+
+	t.Run("wrong image hash", func(t *testing.T) {
+		wrongID := "sha256=" + hex.EncodeToString(make([]byte, 32))
+		wrong := servePeer(wrongID, data, 1000, false)
+		defer wrong.Close()
+		var b bytes.Buffer
+		err := fetchImageFromPeerSet(context.Background(), http.DefaultClient, []string{wrong.URL}, wrongID, &b)
+		require.Error(t, err, "expected hash mismatch")
+	})
+
+	t.Run("invalid chunk manifest", func(t *testing.T) {
+		invalid := servePeer(imageID, data, maxPeerChunkSize+1, false)
+		defer invalid.Close()
+		var b bytes.Buffer
+		err := fetchImageFromPeerSet(context.Background(), http.DefaultClient, []string{invalid.URL}, imageID, &b)
+		require.Error(t, err)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var b bytes.Buffer
+		err := fetchImageFromPeerSet(context.Background(), http.DefaultClient, []string{good1.URL}, "sha512=abc", &b)
+		require.Error(t, err, "expected 404")
+	})
+}
@@ -0,0 +1,95 @@
+package qemuengine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Minimum amount of free disk space required in temporary storage, images are
+// extracted here, so we need room for at least a few large images.
+const minFreeDiskSpace = 10 * 1024 * 1024 * 1024
+
+// Binaries the qemu engine invokes, and what they are needed for.
+var requiredBinaries = []struct {
+	Name    string
+	Purpose string
+}{
+	{"qemu-system-x86_64", "running virtual machines"},
+	{"qemu-img", "inspecting images"},
+	{"zstd", "extracting images"},
+	{"tar", "extracting images"},
+	{"ip", "configuring tap devices"},
+	{"dnsmasq", "serving DHCP and DNS to virtual machines"},
+}
+
+func (e *engine) PreflightCheck() error {
+	var problems []string
+
+	// Check that KVM is available and accessible
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf(
+			"unable to open /dev/kvm (%s), ensure virtualization is enabled in "+
+				"firmware, the kvm kernel module is loaded and the worker has access "+
+				"to /dev/kvm", err,
+		))
+	} else {
+		f.Close()
+	}
+
+	// Check that binaries we depend on are installed
+	binaries := append(requiredBinaries, struct {
+		Name    string
+		Purpose string
+	}{e.networkPool.FirewallCommand(), "isolating virtual machine networks"})
+	for _, b := range binaries {
+		if _, err := exec.LookPath(b.Name); err != nil {
+			problems = append(problems, fmt.Sprintf(
+				"'%s' is required for %s, but was not found in PATH", b.Name, b.Purpose,
+			))
+		}
+	}
+
+	// Check that binaries required for confinement are installed
+	var confinementBinaries []string
+	if e.engineConfig.Confinement.AppArmor {
+		confinementBinaries = append(confinementBinaries, "apparmor_parser", "aa-exec")
+	}
+	if e.engineConfig.Confinement.SELinux {
+		confinementBinaries = append(confinementBinaries, "runcon", "chcon")
+	}
+	for _, name := range confinementBinaries {
+		if _, err := exec.LookPath(name); err != nil {
+			problems = append(problems, fmt.Sprintf(
+				"'%s' is required for confining QEMU, but was not found in PATH", name,
+			))
+		}
+	}
+
+	// Check free disk space in temporary storage
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(e.socketFolder.Path(), &stat); err != nil {
+		problems = append(problems, fmt.Sprintf(
+			"unable to determine free disk space in temporary storage, error: %s", err,
+		))
+	} else if free := stat.Bavail * uint64(stat.Bsize); free < minFreeDiskSpace {
+		problems = append(problems, fmt.Sprintf(
+			"temporary storage has %d MiB free disk space, at least %d MiB is "+
+				"required, free up space or configure a larger temporary folder",
+			free/(1024*1024), minFreeDiskSpace/(1024*1024),
+		))
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf(
+			"qemu engine cannot run tasks on this host:\n - %s",
+			strings.Join(problems, "\n - "),
+		)
+	}
+	return nil
+}
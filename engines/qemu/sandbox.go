@@ -1,10 +1,13 @@
 package qemuengine
 
 import (
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/engines"
@@ -20,6 +23,7 @@ type sandbox struct {
 	context     *runtime.TaskContext
 	engine      *engine
 	proxies     map[string]http.Handler
+	services    map[string]http.Handler
 	metaService *metaservice.MetaService
 	resolve     atomics.Once      // Must wrap access mutation of resultXXX/done
 	resultSet   engines.ResultSet // ResultSet for WaitForResult
@@ -27,13 +31,22 @@ type sandbox struct {
 	resultAbort error             // Error for Abort
 	monitor     runtime.Monitor   // System log / metrics / error reporting
 	sessions    *sessionManager
+	started     time.Time    // Time the VM was started
+	booted      atomics.Once // Done when guest-tools first requests the command
+	timeout     time.Duration
 }
 
+// Time guest-tools is given to kill the command and report the result when
+// the command timeout is exceeded, before the sandbox is killed from the host.
+const commandTimeoutGracePeriod = 30 * time.Second
+
 // newSandbox will create a new sandbox and start it.
 func newSandbox(
 	command []string,
+	commandTimeout time.Duration,
 	env map[string]string,
 	proxies map[string]http.Handler,
+	services map[string]http.Handler,
 	machine vm.Machine,
 	image vm.Image,
 	network vm.Network,
@@ -55,18 +68,22 @@ func newSandbox(
 	if err != nil {
 		return nil, err
 	}
+	instance.Confine(e.engineConfig.Confinement)
 
 	// Create sandbox
 	s := &sandbox{
-		vm:      instance,
-		context: c,
-		engine:  e,
-		proxies: proxies,
-		monitor: monitor,
+		vm:       instance,
+		context:  c,
+		engine:   e,
+		proxies:  proxies,
+		services: services,
+		monitor:  monitor,
+		timeout:  commandTimeout,
 	}
 
 	// Setup meta-data service
 	s.metaService = metaservice.New(command, env, c.LogDrain(), s.result, e.Environment)
+	s.metaService.SetCommandTimeout(commandTimeout)
 
 	// Create session manager
 	s.sessions = newSessionManager(s.metaService, s.vm)
@@ -76,6 +93,7 @@ func newSandbox(
 
 	// Start the VM
 	debug("Starting virtual machine")
+	s.started = time.Now()
 	s.vm.Start()
 
 	// Resolve when VM is closed
@@ -85,6 +103,17 @@ func newSandbox(
 }
 
 func (s *sandbox) handleRequest(w http.ResponseWriter, r *http.Request) {
+	// If the request is for an attached service, we forward it unmodified
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if h := s.services[host]; h != nil {
+		debug("handling request for service: %s", host)
+		h.ServeHTTP(w, r)
+		return
+	}
+
 	// Sanity checks and identifiation of name/hostname/virtualhost/folder
 	var origPath string
 	isRawPath := r.URL.RawPath != ""
@@ -108,6 +137,15 @@ func (s *sandbox) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// If name is engine, we pass it to meta-data
 	if name == "engine" {
+		// When guest-tools asks for the command, the VM has booted
+		if path == "/v1/execute" {
+			s.booted.Do(func() {
+				s.context.LogTiming("vm-boot", time.Since(s.started))
+				if s.timeout > 0 {
+					go s.enforceTimeout()
+				}
+			})
+		}
 		s.metaService.ServeHTTP(w, r)
 		return
 	}
@@ -151,6 +189,24 @@ func (s *sandbox) Kill() error {
 	return s.resultError
 }
 
+// enforceTimeout kills the sandbox, if guest-tools doesn't report a result
+// within the command timeout, this ensures the timeout is enforced even if
+// guest-tools doesn't support it.
+func (s *sandbox) enforceTimeout() {
+	timer := time.NewTimer(s.timeout + commandTimeoutGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		if s.resolve.IsDone() {
+			return
+		}
+		s.context.LogError(fmt.Sprintf("Command timed out after %s and guest-tools didn't respond, killing command", s.timeout))
+		s.Kill()
+	case <-s.resolve.Done():
+	}
+}
+
 // waitForCrash will wait for a VM crash and resolve
 func (s *sandbox) waitForCrash() {
 	// Wait for the VM to finish
@@ -160,6 +216,22 @@ func (s *sandbox) waitForCrash() {
 		// Kill all sessions
 		s.sessions.AbortSessions()
 
+		// If the guest kernel panicked, it's most likely out of memory, this is
+		// the fault of the task, so we resolve failed with a clear message.
+		if s.vm.Error == vm.ErrGuestPanicked {
+			s.context.LogError("task exceeded memory limit (OOM), or otherwise caused the guest kernel to panic")
+			s.resultSet = newResultSet(false, s.vm, s.metaService)
+			s.resultAbort = engines.ErrSandboxTerminated
+			return
+		}
+
+		// Write error and QEMU output to diagnostics, so it's uploaded with
+		// the task resolution
+		s.context.LogDiagnostic("QEMU crashed unexpected, error: ", s.vm.Error)
+		if s.vm.Stderr != "" {
+			s.context.LogDiagnostic("QEMU stderr:\n", s.vm.Stderr)
+		}
+
 		// TODO: Read s.vm.Error and handle the error
 		s.resultError = errors.New("QEMU crashed unexpected")
 		s.resultAbort = engines.ErrSandboxTerminated
@@ -0,0 +1,45 @@
+package qemuengine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+func TestGuestPanickedResolvesFailed(t *testing.T) {
+	ctx, control, err := runtime.NewTaskContext(filepath.Join(os.TempDir(), slugid.Nice()), runtime.TaskInfo{})
+	require.NoError(t, err)
+	defer control.Dispose()
+
+	// Virtual machine that was killed because the guest kernel panicked
+	done := make(chan struct{})
+	close(done)
+	machine := &vm.VirtualMachine{Done: done, Error: vm.ErrGuestPanicked}
+	s := &sandbox{
+		vm:       machine,
+		context:  ctx,
+		sessions: newSessionManager(nil, machine),
+	}
+	s.waitForCrash()
+
+	result, err := s.WaitForResult()
+	require.NoError(t, err)
+	require.False(t, result.Success(), "expected task to fail")
+	require.Equal(t, engines.ErrSandboxTerminated, s.Abort())
+
+	require.NoError(t, control.CloseLog())
+	log, err := ctx.ExtractLog()
+	require.NoError(t, err)
+	defer log.Close()
+	data, err := ioutil.ReadAll(log)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "[taskcluster:error]")
+	require.Contains(t, string(data), "task exceeded memory limit (OOM)")
+}
@@ -1,12 +1,15 @@
 package qemuengine
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/image"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/network"
@@ -21,11 +24,13 @@ type sandboxBuilder struct {
 	discarded  bool
 	network    *network.Network
 	command    []string
+	timeout    time.Duration
 	machine    vm.Machine
 	image      *image.Instance
 	imageError error
 	imageDone  <-chan struct{}
 	proxies    map[string]http.Handler
+	services   map[string]http.Handler
 	env        map[string]string
 	context    *runtime.TaskContext
 	engine     *engine
@@ -42,8 +47,10 @@ func newSandboxBuilder(
 	sb := &sandboxBuilder{
 		network:   network,
 		command:   payload.Command,
+		timeout:   time.Duration(payload.CommandTimeout) * time.Second,
 		imageDone: imageDone,
 		proxies:   make(map[string]http.Handler),
+		services:  make(map[string]http.Handler),
 		env:       make(map[string]string),
 		context:   c,
 		engine:    e,
@@ -57,8 +64,13 @@ func newSandboxBuilder(
 	go func() {
 		var scopeSets [][]string
 		var inst *image.Instance
+		var fetchStarted time.Time
+		var imageID string
+		var download image.Downloader
+		var public bool
 
 		ctx := &fetchImageContext{c}
+		client := c.NewHTTPClient(runtime.HTTPClientOptions{})
 		ref, err := imageFetcher.NewReference(ctx, payload.Image)
 		if err != nil {
 			goto handleErr
@@ -78,15 +90,55 @@ func newSandboxBuilder(
 		}
 
 		debug("fetching image: %#v (if not already present)", payload.Image)
-		inst, err = e.imageManager.Instance(ref.HashKey(), func(imageFile *os.File) error {
-			return ref.Fetch(ctx, &fetcher.FileReseter{File: imageFile})
-		})
+		fetchStarted = time.Now()
+		imageID = e.imageID(ctx, client, payload.Image, ref.HashKey())
+		// Only images that can be fetched without scopes are shared with peers
+		public = requiresNoScopes(scopeSets)
+		if public {
+			e.imageManager.MarkPublic(imageID)
+		}
+		download = func(opCtx context.Context, imageFile *os.File) error {
+			// Abort the download, if the task or the download operation is canceled
+			dctx, cancel := context.WithCancel(opCtx)
+			defer cancel()
+			go func() {
+				select {
+				case <-c.Done():
+					cancel()
+				case <-dctx.Done():
+				}
+			}()
+			ctx := &downloadContext{Context: dctx, fetchImageContext: ctx}
+
+			target := &fetcher.FileReseter{File: imageFile}
+			if public && e.fetchImageFromPeers(ctx, client, ref.HashKey(), target) {
+				return nil
+			}
+			if e.fetchImageFromMirror(ctx, payload.Image, target) {
+				return nil
+			}
+			return ref.Fetch(ctx, target)
+		}
+		inst, err = e.imageManager.Instance(imageID, download)
+		if err == image.ErrImageCorrupt {
+			// Corrupt images are removed from the cache, so we can download again
+			c.Log("Cached image was corrupt, fetching image again")
+			inst, err = e.imageManager.Instance(imageID, download)
+		}
 		debug("fetched image: %#v", payload.Image)
+		if err == nil {
+			c.LogTiming("image-fetch", time.Since(fetchStarted))
+		}
 
 	handleErr:
-		// Transform broken reference to malformed payload
+		// Transform broken reference to malformed payload, and unavailable
+		// resources to infrastructure errors
 		if fetcher.IsBrokenReferenceError(err) {
 			err = runtime.NewMalformedPayloadError("unable to fetch image, error:", err)
+		} else if fetcher.IsUnavailableError(err) {
+			err = runtime.NewInfrastructureError("unable to fetch image, error: ", err)
+		} else if _, ok := runtime.IsMalformedPayloadError(err); !ok && err != nil {
+			c.LogDiagnostic("failed to fetch image: ", payload.Image, ", error: ", err)
 		}
 
 		sb.m.Lock()
@@ -136,6 +188,41 @@ func (sb *sandboxBuilder) AttachProxy(hostname string, handler http.Handler) err
 	return nil
 }
 
+// serviceNamePattern defines allowed hostnames for services
+var serviceNamePattern = regexp.MustCompile("^[a-z][a-z0-9-]{1,62}$")
+
+func (sb *sandboxBuilder) AttachService(hostname string, handler http.Handler) error {
+	// Validate hostname against allowed patterns
+	if !serviceNamePattern.MatchString(hostname) {
+		return runtime.NewMalformedPayloadError("Service hostname: '", hostname, "'",
+			" is not allowed for QEMU engine. The hostname must match: ",
+			serviceNamePattern.String())
+	}
+	// Ensure that we're not using the magic "taskcluster" hostname
+	if hostname == "taskcluster" {
+		return runtime.NewMalformedPayloadError("Service hostname: 'taskcluster' " +
+			"is reserved for internal use (meta-data service)")
+	}
+
+	// Acquire the lock
+	sb.m.Lock()
+	defer sb.m.Unlock()
+
+	// Check that the hostname isn't already in use
+	if _, ok := sb.services[hostname]; ok {
+		return engines.ErrNamingConflict
+	}
+
+	// Ensure hostname resolves to the meta-data service, until the network is
+	// released
+	if err := sb.network.AddHostAlias(hostname); err != nil {
+		return errors.Wrapf(err, "failed to add DNS entry for service: %s", hostname)
+	}
+
+	sb.services[hostname] = handler
+	return nil
+}
+
 // envVarPattern defines allowed environment variable names
 var envVarPattern = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
 
@@ -185,7 +272,8 @@ func (sb *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
 
 	// Create a sandbox
 	s, err := newSandbox(
-		sb.command, sb.env, sb.proxies, sb.machine, sb.image, sb.network,
+		sb.command, sb.timeout, sb.env, sb.proxies, sb.services, sb.machine, sb.image,
+		sb.network,
 		sb.context, sb.engine, sb.monitor,
 	)
 	if err != nil {
@@ -0,0 +1,90 @@
+package qemuengine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// qemuProcessName is the process name of qemu-system-x86_64, as it appears in
+// /proc/<pid>/stat, where it is truncated to 15 characters.
+const qemuProcessName = "qemu-system-x86"
+
+func (e *engine) VerifyHost() error {
+	var problems []string
+
+	// Each virtual machine holds a network until QEMU has exited, so if there
+	// are more QEMU processes than networks in use, some were left behind.
+	pids, err := childProcesses(qemuProcessName)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to list QEMU processes: %s", err))
+	} else if inUse := e.networkPool.InUse(); len(pids) > inUse {
+		problems = append(problems, fmt.Sprintf(
+			"found %d QEMU processes, but only %d virtual machines are running",
+			len(pids), inUse,
+		))
+	}
+
+	// Check that tap devices are still configured, this repairs them if not
+	if err := e.networkPool.Verify(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf(
+			"qemu engine found host contamination:\n - %s",
+			strings.Join(problems, "\n - "),
+		)
+	}
+	return nil
+}
+
+// childProcesses returns pids of child processes of the worker with the given
+// process name.
+func childProcesses(name string) ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue // not a process
+		}
+		data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue // process probably exited
+		}
+		comm, ppid, ok := parseProcStat(string(data))
+		if ok && comm == name && ppid == self {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// parseProcStat returns process name and parent pid from /proc/<pid>/stat,
+// formatted as "<pid> (<comm>) <state> <ppid> ...", where comm may contain
+// spaces and parentheses.
+func parseProcStat(stat string) (comm string, ppid int, ok bool) {
+	start := strings.IndexByte(stat, '(')
+	end := strings.LastIndexByte(stat, ')')
+	if start == -1 || end < start {
+		return "", 0, false
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 2 {
+		return "", 0, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0, false
+	}
+	return stat[start+1 : end], ppid, true
+}
@@ -0,0 +1,28 @@
+package qemuengine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStat(t *testing.T) {
+	comm, ppid, ok := parseProcStat("4242 (qemu-system-x86) S 17 4242 17 0 -1 4194560")
+	require.True(t, ok)
+	require.Equal(t, "qemu-system-x86", comm)
+	require.Equal(t, 17, ppid)
+
+	comm, ppid, ok = parseProcStat("42 (my (odd) name) R 1 42 42 0")
+	require.True(t, ok)
+	require.Equal(t, "my (odd) name", comm)
+	require.Equal(t, 1, ppid)
+
+	_, _, ok = parseProcStat("42 (truncated")
+	require.False(t, ok)
+}
+
+func TestChildProcesses(t *testing.T) {
+	pids, err := childProcesses(qemuProcessName)
+	require.NoError(t, err)
+	require.Empty(t, pids, "tests shouldn't have QEMU child processes")
+}
@@ -0,0 +1,284 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// seccompSandbox is the argument for the QEMU -sandbox option, this denies
+// obsolete system calls, changing privileges, spawning processes and setting
+// resource limits or CPU affinity.
+const seccompSandbox = "on,obsolete=deny,elevateprivileges=deny,spawn=deny,resourcecontrol=deny"
+
+// Defaults for Confinement.SELinuxType and Confinement.SELinuxImageType
+const (
+	defaultSELinuxType      = "svirt_t"
+	defaultSELinuxImageType = "svirt_image_t"
+)
+
+// Number of MCS categories on a typical SELinux system, c0 to c1023
+const mcsCategories = 1024
+
+// Confinement specifies how the QEMU process is confined, limiting what a
+// guest can do if it exploits a vulnerability in QEMU.
+type Confinement struct {
+	DisableSeccomp   bool   `json:"disableSeccomp"`
+	AppArmor         bool   `json:"apparmor"`
+	SELinux          bool   `json:"selinux"`
+	SELinuxType      string `json:"selinuxType"`
+	SELinuxImageType string `json:"selinuxImageType"`
+}
+
+// ConfinementSchema is the schema for Confinement.
+var ConfinementSchema = schematypes.Object{
+	Title: "QEMU Confinement",
+	Description: util.Markdown(`
+		Options for confining the QEMU process, reducing what a guest can do
+		if it escapes the virtual machine by exploiting a vulnerability in QEMU.
+
+		By default QEMU runs with a seccomp filter denying obsolete system
+		calls, changing privileges, spawning processes and changing resource
+		limits. AppArmor or SELinux confinement can be enabled in addition.
+	`),
+	Properties: schematypes.Properties{
+		"disableSeccomp": schematypes.Boolean{
+			Title: "Disable Seccomp",
+			Description: util.Markdown(`
+				Run QEMU without the seccomp filter given with '-sandbox'. This is
+				only useful if QEMU is built without seccomp support.
+			`),
+		},
+		"apparmor": schematypes.Boolean{
+			Title: "AppArmor Confinement",
+			Description: util.Markdown(`
+				Generate an AppArmor profile for each virtual machine, allowing
+				access only to its own disk, sockets, '/dev/kvm', '/dev/net/tun' and
+				QEMU firmware files. The profile is loaded with 'apparmor_parser' and
+				QEMU is started with 'aa-exec', this requires the worker to run as
+				root.
+			`),
+		},
+		"selinux": schematypes.Boolean{
+			Title: "SELinux Confinement",
+			Description: util.Markdown(`
+				Run each virtual machine with 'runcon' in 'selinuxType' with a
+				unique pair of MCS categories, and label its disk and sockets with
+				'selinuxImageType' and the same categories using 'chcon'. This
+				prevents virtual machines from accessing each others files.
+			`),
+		},
+		"selinuxType": schematypes.String{
+			Title: "SELinux Process Type",
+			Description: util.Markdown(`
+				SELinux type QEMU is run as, defaults to 'svirt_t'.
+			`),
+			Pattern: `^[a-z0-9_]+$`,
+		},
+		"selinuxImageType": schematypes.String{
+			Title: "SELinux Image Type",
+			Description: util.Markdown(`
+				SELinux type for files QEMU is allowed to access, defaults to
+				'svirt_image_t'.
+			`),
+			Pattern: `^[a-z0-9_]+$`,
+		},
+	},
+}
+
+// Validate returns an error if the Confinement options are conflicting.
+func (c Confinement) Validate() error {
+	if c.AppArmor && c.SELinux {
+		return errors.New("confinement with both AppArmor and SELinux is not supported")
+	}
+	return nil
+}
+
+// confinedFiles are the files QEMU needs access to, used to generate AppArmor
+// profiles and label files for SELinux.
+type confinedFiles struct {
+	DiskFile     string   // primary disk, read-write
+	BackingFile  string   // backing file for DiskFile, read-only, may be shared
+	SocketFolder string   // folder for vnc and qmp sockets
+	ReadOnly     []string // other files, read-only
+}
+
+// confine returns cmd wrapped such that it runs under the confinement c, and a
+// function to release any resources held, to be called after cmd has exited.
+func (c Confinement) confine(cmd *exec.Cmd, name string, files confinedFiles) (*exec.Cmd, func(), error) {
+	args := cmd.Args
+	if !c.DisableSeccomp {
+		args = append(args, "-sandbox", seccompSandbox)
+	}
+	release := func() {}
+
+	if c.SELinux {
+		level, err := allocateMCSLevel()
+		if err != nil {
+			return nil, nil, err
+		}
+		release = func() { releaseMCSLevel(level) }
+		imageType := c.SELinuxImageType
+		if imageType == "" {
+			imageType = defaultSELinuxImageType
+		}
+		// Shared backing files and read-only files are labelled without
+		// categories, so all virtual machines may read them
+		err = chcon(imageType, "s0", append([]string{files.BackingFile}, files.ReadOnly...)...)
+		if err == nil {
+			err = chcon(imageType, level, files.DiskFile, files.SocketFolder)
+		}
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		processType := c.SELinuxType
+		if processType == "" {
+			processType = defaultSELinuxType
+		}
+		args = append([]string{"runcon", "-t", processType, "-l", level, "--"}, args...)
+	}
+
+	if c.AppArmor {
+		profile, err := appArmorProfile(name, cmd.Path, files)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		if err = apparmorParser("-r", profile); err != nil {
+			release()
+			return nil, nil, errors.Wrap(err, "failed to load AppArmor profile")
+		}
+		releaseLevel := release
+		release = func() {
+			if err := apparmorParser("-R", profile); err != nil {
+				debug("failed to unload AppArmor profile: %s, error: %s", name, err)
+			}
+			releaseLevel()
+		}
+		args = append([]string{"aa-exec", "-p", name, "--"}, args...)
+	}
+
+	return exec.Command(args[0], args[1:]...), release, nil
+}
+
+// appArmorProfile generates an AppArmor profile for a QEMU process
+func appArmorProfile(name, qemu string, files confinedFiles) (string, error) {
+	// Resolve symlinks, as AppArmor rules apply to the target
+	qemu, err := filepath.EvalSymlinks(qemu)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to resolve path to QEMU")
+	}
+	for _, p := range append([]string{qemu, files.DiskFile, files.BackingFile, files.SocketFolder}, files.ReadOnly...) {
+		if strings.ContainsAny(p, "\"\n") {
+			return "", errors.Errorf("path %q cannot be used in an AppArmor profile", p)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#include <tunables/global>\n\n")
+	fmt.Fprintf(&b, "profile %s flags=(attach_disconnected) {\n", name)
+	fmt.Fprintf(&b, "  #include <abstractions/base>\n\n")
+	fmt.Fprintf(&b, "  signal (receive) peer=unconfined,\n")
+	fmt.Fprintf(&b, "  unix,\n\n")
+	fmt.Fprintf(&b, "  \"%s\" rm,\n", qemu)
+	for _, folder := range []string{
+		"/usr/share/qemu", "/usr/share/seabios", "/usr/share/sgabios",
+		"/usr/share/vgabios", "/usr/share/ipxe", "/usr/lib/ipxe",
+		"/usr/share/OVMF", "/usr/share/misc",
+	} {
+		fmt.Fprintf(&b, "  %s/** r,\n", folder)
+	}
+	fmt.Fprintf(&b, "  /dev/kvm rw,\n")
+	fmt.Fprintf(&b, "  /dev/net/tun rw,\n")
+	fmt.Fprintf(&b, "  /dev/vhost-net rw,\n")
+	fmt.Fprintf(&b, "  @{PROC}/sys/vm/overcommit_memory r,\n")
+	fmt.Fprintf(&b, "  /sys/devices/system/cpu/** r,\n")
+	fmt.Fprintf(&b, "  /sys/devices/system/node/** r,\n")
+	fmt.Fprintf(&b, "  /sys/kernel/mm/transparent_hugepage/** r,\n\n")
+	fmt.Fprintf(&b, "  \"%s\" rwk,\n", files.DiskFile)
+	fmt.Fprintf(&b, "  \"%s\" rk,\n", files.BackingFile)
+	fmt.Fprintf(&b, "  \"%s/\" rw,\n", files.SocketFolder)
+	fmt.Fprintf(&b, "  \"%s/*\" rw,\n", files.SocketFolder)
+	for _, f := range files.ReadOnly {
+		fmt.Fprintf(&b, "  \"%s\" rk,\n", f)
+	}
+	fmt.Fprintf(&b, "}\n")
+	return b.String(), nil
+}
+
+// apparmorParser runs apparmor_parser with flag and profile on stdin
+func apparmorParser(flag, profile string) error {
+	p := exec.Command("apparmor_parser", flag)
+	p.Stdin = strings.NewReader(profile)
+	output, err := p.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "apparmor_parser %s failed, output: %s", flag, output)
+	}
+	return nil
+}
+
+// chcon labels files with SELinux type and level
+func chcon(fileType, level string, files ...string) error {
+	var targets []string
+	for _, f := range files {
+		if f != "" {
+			targets = append(targets, f)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	args := append([]string{"-t", fileType, "-l", level, "--"}, targets...)
+	output, err := exec.Command("chcon", args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "chcon failed, output: %s", output)
+	}
+	return nil
+}
+
+var (
+	mcsMutex  sync.Mutex
+	mcsLevels = make(map[string]bool) // MCS levels in use by this process
+)
+
+// allocateMCSLevel returns an MCS level with a random pair of categories, not
+// in use by any other virtual machine in this process.
+func allocateMCSLevel() (string, error) {
+	mcsMutex.Lock()
+	defer mcsMutex.Unlock()
+	var buf [4]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			return "", errors.Wrap(err, "failed to generate MCS categories")
+		}
+		c1 := int(binary.LittleEndian.Uint16(buf[0:])) % mcsCategories
+		c2 := int(binary.LittleEndian.Uint16(buf[2:])) % mcsCategories
+		if c1 == c2 {
+			continue
+		}
+		if c1 > c2 {
+			c1, c2 = c2, c1
+		}
+		level := fmt.Sprintf("s0:c%d,c%d", c1, c2)
+		if !mcsLevels[level] {
+			mcsLevels[level] = true
+			return level, nil
+		}
+	}
+}
+
+func releaseMCSLevel(level string) {
+	mcsMutex.Lock()
+	defer mcsMutex.Unlock()
+	delete(mcsLevels, level)
+}
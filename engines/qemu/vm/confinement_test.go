@@ -0,0 +1,62 @@
+package vm
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfineSeccomp(t *testing.T) {
+	cmd, release, err := Confinement{}.confine(exec.Command("qemu-system-x86_64", "-m", "512"), "test", confinedFiles{})
+	assert.NoError(t, err)
+	defer release()
+	assert.Equal(t, []string{"qemu-system-x86_64", "-m", "512", "-sandbox", seccompSandbox}, cmd.Args)
+
+	cmd, release, err = Confinement{DisableSeccomp: true}.confine(exec.Command("qemu-system-x86_64", "-m", "512"), "test", confinedFiles{})
+	assert.NoError(t, err)
+	defer release()
+	assert.Equal(t, []string{"qemu-system-x86_64", "-m", "512"}, cmd.Args)
+}
+
+func TestConfinementValidate(t *testing.T) {
+	assert.NoError(t, Confinement{AppArmor: true}.Validate())
+	assert.Error(t, Confinement{AppArmor: true, SELinux: true}.Validate())
+}
+
+func TestAppArmorProfile(t *testing.T) {
+	executable, err := os.Executable()
+	assert.NoError(t, err)
+	profile, err := appArmorProfile("taskcluster-qemu-test", executable, confinedFiles{
+		DiskFile:     "/tmp/images/abc.qcow2",
+		BackingFile:  "/tmp/images/disk.img",
+		SocketFolder: "/tmp/sockets/abc",
+	})
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(profile, "profile taskcluster-qemu-test "))
+	assert.True(t, strings.Contains(profile, "\"/tmp/images/abc.qcow2\" rwk,"))
+	assert.True(t, strings.Contains(profile, "\"/tmp/images/disk.img\" rk,"))
+	assert.True(t, strings.Contains(profile, "\"/tmp/sockets/abc/*\" rw,"))
+
+	_, err = appArmorProfile("taskcluster-qemu-test", executable, confinedFiles{
+		DiskFile: "/tmp/images/\"bad\".qcow2",
+	})
+	assert.Error(t, err, "expected paths with quotes to be rejected")
+}
+
+func TestAllocateMCSLevel(t *testing.T) {
+	levels := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		level, err := allocateMCSLevel()
+		assert.NoError(t, err)
+		assert.False(t, levels[level], "level allocated twice")
+		assert.True(t, strings.HasPrefix(level, "s0:c"))
+		levels[level] = true
+	}
+	for level := range levels {
+		releaseMCSLevel(level)
+	}
+	assert.Empty(t, mcsLevels)
+}
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -28,6 +29,15 @@ const (
 	qmpSocketFile = "qmp.sock"
 )
 
+// maxStderrSize is the maximum number of bytes from the end of QEMU stderr
+// that is retained in VirtualMachine.Stderr
+const maxStderrSize = 64 * 1024
+
+// ErrGuestPanicked is set as VirtualMachine.Error if the guest kernel reported
+// a panic through the pvpanic device. Linux guests should set vm.panic_on_oom
+// and load the pvpanic module, so that running out of memory is reported.
+var ErrGuestPanicked = errors.New("guest kernel panicked")
+
 // LinuxBootOptions holds optionals boot options for Linux.
 // These are exclusively useful for building images and should not be used in
 // production when running per-task VMs. But they can greatly simplify image
@@ -51,8 +61,12 @@ type VirtualMachine struct {
 	qemuDone     chan<- struct{}
 	Done         <-chan struct{} // Closed when the virtual machine is done
 	Error        error           // Error, to be read after Done is closed
+	Stderr       string          // Tail of stderr from QEMU, to be read after Done is closed
 	monitor      runtime.Monitor
 	domain       *qemu.Domain
+	confinement  *Confinement
+	readOnly     []string // files QEMU reads other than the image
+	unconfine    func()   // releases resources held for confinement
 }
 
 // NewVirtualMachine constructs a new virtual machine using the given
@@ -86,6 +100,12 @@ func NewVirtualMachine(
 		monitor:      monitor,
 	}
 
+	for _, f := range []string{cdrom1, cdrom2, bootOptions.Kernel, bootOptions.Initrd} {
+		if f != "" {
+			vm.readOnly = append(vm.readOnly, f)
+		}
+	}
+
 	vncSocket := filepath.Join(vm.socketFolder, vncSocketFile)
 	qmpSocket := filepath.Join(vm.socketFolder, qmpSocketFile)
 
@@ -193,6 +213,11 @@ func NewVirtualMachine(
 		"addr": "0x4", // Always put balloon on PCI 0x4
 	})
 
+	// Panic device (ISA), so guest kernel panics emits a QMP event
+	device("pvpanic", args{
+		"id": "pvpanic-0",
+	})
+
 	// Network
 	option("netdev", vm.network.NetDev("netdev-0"), nil)
 	device(o.Network, args{
@@ -333,6 +358,17 @@ func (vm *VirtualMachine) SetHTTPHandler(handler http.Handler) {
 	}
 }
 
+// Confine sets the confinement QEMU will run under, this must be called
+// before Start().
+func (vm *VirtualMachine) Confine(confinement Confinement) {
+	vm.m.Lock()
+	defer vm.m.Unlock()
+	if vm.started {
+		panic("VirtualMachine.Confine() called after Start()")
+	}
+	vm.confinement = &confinement
+}
+
 // Start the virtual machine.
 func (vm *VirtualMachine) Start() {
 	vm.m.Lock()
@@ -343,11 +379,6 @@ func (vm *VirtualMachine) Start() {
 	vm.started = true
 	vm.m.Unlock()
 
-	stdout, stdoutWriter := io.Pipe()
-	stderr, stderrWriter := io.Pipe()
-	vm.qemu.Stdout = stdoutWriter
-	vm.qemu.Stderr = stderrWriter
-
 	// Local reference to socketFolder to avoid race condition
 	socketFolder := vm.socketFolder
 
@@ -360,11 +391,40 @@ func (vm *VirtualMachine) Start() {
 		return
 	}
 
+	// Wrap QEMU with confinement, if any
+	vm.unconfine = func() {}
+	if vm.confinement != nil {
+		// Images are qcow2 files backed by 'disk.img' in the same folder, see
+		// the image package.
+		diskFile := vm.image.DiskFile()
+		files := confinedFiles{
+			DiskFile:     diskFile,
+			SocketFolder: socketFolder,
+			ReadOnly:     vm.readOnly,
+		}
+		if vm.image.Format() == "qcow2" {
+			files.BackingFile = filepath.Join(filepath.Dir(diskFile), "disk.img")
+		}
+		vm.qemu, vm.unconfine, err = vm.confinement.confine(vm.qemu, "taskcluster-qemu-"+filepath.Base(socketFolder), files)
+		if err != nil {
+			vm.monitor.Errorf("Failed to confine QEMU, error: %s", err)
+			vm.Error = err
+			close(vm.qemuDone)
+			return
+		}
+	}
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	vm.qemu.Stdout = stdoutWriter
+	vm.qemu.Stderr = stderrWriter
+
 	// Start monitor socketFolder for vnc and qmp sockets
 	socketsReady, err := vm.waitForSockets()
 	if err != nil {
 		vm.monitor.Errorf("Error configuring socketFolder monitoring, error: %s", err)
 		vm.Error = err
+		vm.unconfine()
 		close(vm.qemuDone)
 		return
 	}
@@ -372,6 +432,7 @@ func (vm *VirtualMachine) Start() {
 	// Start QEMU
 	vm.Error = vm.qemu.Start()
 	if vm.Error != nil {
+		vm.unconfine()
 		close(vm.qemuDone)
 		return
 	}
@@ -379,22 +440,42 @@ func (vm *VirtualMachine) Start() {
 	// Forward stdout/err to log
 	// Normally QEMU won't write anything... So sending everything to log is
 	// probably a good thing. Usually, it's errors and deprecation notices.
+	// Retain the tail of stderr, so it can be reported if QEMU crashes.
+	var stderrTail []string
+	stderrDone := make(chan struct{})
 	go scanLog(stdout, vm.monitor.Info, vm.monitor.Error)
-	go scanLog(stderr, vm.monitor.Error, vm.monitor.Error)
+	go func() {
+		defer close(stderrDone)
+		size := 0
+		scanLog(stderr, func(a ...interface{}) {
+			vm.monitor.Error(a...)
+			line := fmt.Sprint(a...)
+			stderrTail = append(stderrTail, line)
+			size += len(line) + 1
+			for size > maxStderrSize && len(stderrTail) > 1 {
+				size -= len(stderrTail[0]) + 1
+				stderrTail = stderrTail[1:]
+			}
+		}, vm.monitor.Error)
+	}()
 
 	// Wait for QEMU to finish and cleanup
 	go func() {
 		// Wait for QEMU to be done
 		werr := vm.qemu.Wait()
 		debug("qemu terminated")
+		vm.unconfine()
+
+		// Close output pipes, and wait for stderr to be read
+		stdoutWriter.Close()
+		stderrWriter.Close()
+		<-stderrDone
 
 		// Acquire lock
 		vm.m.Lock()
 		defer vm.m.Unlock()
 
-		// Close output pipes
-		stdoutWriter.Close()
-		stderrWriter.Close()
+		vm.Stderr = strings.Join(stderrTail, "\n")
 
 		// Set error, if any and not already set
 		if vm.Error == nil {
@@ -474,6 +555,15 @@ func (vm *VirtualMachine) Start() {
 	}
 	vm.m.Unlock()
 
+	// Monitor QMP events, so we can detect guest kernel panics
+	events, _, err := vm.domain.Events()
+	if err != nil {
+		debug("Error listening for QMP events, error: %s", err)
+		vm.abort(fmt.Errorf("Failed to listen for QMP events, error: %s", err))
+		return
+	}
+	go vm.watchEvents(events)
+
 	// Run QMP command continue to start execution
 	_, err = vm.domain.Run(qmp.Command{
 		Execute: "cont",
@@ -489,13 +579,32 @@ func (vm *VirtualMachine) Start() {
 // that was the result of the original error.
 func (vm *VirtualMachine) abort(err error) {
 	vm.m.Lock()
-	if vm.Error != nil {
+	if vm.Error == nil {
 		vm.Error = err
 	}
 	vm.m.Unlock()
 	vm.Kill()
 }
 
+// watchEvents handles QMP events until the virtual machine is done, or the
+// events channel is closed.
+func (vm *VirtualMachine) watchEvents(events <-chan qmp.Event) {
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			debug("qmp-event: %s", e.Event)
+			if e.Event == "GUEST_PANICKED" {
+				vm.abort(ErrGuestPanicked)
+			}
+		case <-vm.Done:
+			return
+		}
+	}
+}
+
 // Kill the virtual machine, can only be called after Start()
 func (vm *VirtualMachine) Kill() {
 	select {
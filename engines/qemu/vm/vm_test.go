@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"os/exec"
+	goruntime "runtime"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchEventsClosed(t *testing.T) {
+	vm := &VirtualMachine{Done: make(chan struct{})}
+	events := make(chan qmp.Event)
+	done := make(chan struct{})
+	go func() {
+		vm.watchEvents(events)
+		close(done)
+	}()
+
+	close(events)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchEvents didn't return when the events channel was closed")
+	}
+}
+
+func TestWatchEventsGuestPanicked(t *testing.T) {
+	if goruntime.GOOS == "windows" {
+		t.Skip("test uses 'sleep' in place of QEMU")
+	}
+
+	// Use a long running process in place of QEMU
+	qemu := exec.Command("sleep", "60")
+	require.NoError(t, qemu.Start())
+	qemuDone := make(chan struct{})
+	vm := &VirtualMachine{qemu: qemu, qemuDone: qemuDone, Done: qemuDone}
+	go func() {
+		qemu.Wait()
+		close(qemuDone)
+	}()
+
+	events := make(chan qmp.Event, 1)
+	go vm.watchEvents(events)
+	events <- qmp.Event{Event: "GUEST_PANICKED"}
+
+	select {
+	case <-vm.Done:
+	case <-time.After(5 * time.Second):
+		qemu.Process.Kill()
+		t.Fatal("expected GUEST_PANICKED to kill the virtual machine")
+	}
+	require.Equal(t, ErrGuestPanicked, vm.Error)
+}
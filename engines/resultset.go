@@ -1,6 +1,8 @@
 package engines
 
 import (
+	"time"
+
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
@@ -19,6 +21,14 @@ import (
 // file, or a copy of the file, or some seekable stream interface.
 type FileHandler func(path string, stream ioext.ReadSeekCloser) error
 
+// ResourceUsage summarizes resources consumed by the sandbox during execution.
+//
+// Engines may leave fields they cannot measure as zero.
+type ResourceUsage struct {
+	UserTime   time.Duration `json:"userTime"`   // CPU time spent in user-space
+	SystemTime time.Duration `json:"systemTime"` // CPU time spent in kernel-space
+}
+
 // The ResultSet interface represents the results of a sandbox that has finished
 // execution, but is hanging around while results are being extracted.
 //
@@ -83,6 +93,14 @@ type ResultSet interface {
 	// as a tar-stream. Ideally this also includes cache folders.
 	ArchiveSandbox() (ioext.ReadSeekCloser, error)
 
+	// ResourceUsage returns the resources consumed by the sandbox.
+	//
+	// Engines that cannot measure resource usage may return
+	// ErrFeatureNotSupported.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported
+	ResourceUsage() (ResourceUsage, error)
+
 	// Dispose shall release all resources.
 	//
 	// CacheFolders given to the sandbox shall not be disposed, instead they are
@@ -120,6 +138,12 @@ func (ResultSetBase) ArchiveSandbox() (ioext.ReadSeekCloser, error) {
 	return nil, ErrFeatureNotSupported
 }
 
+// ResourceUsage returns ErrFeatureNotSupported indicating that the feature
+// isn't supported.
+func (ResultSetBase) ResourceUsage() (ResourceUsage, error) {
+	return ResourceUsage{}, ErrFeatureNotSupported
+}
+
 // Dispose returns nil indicating that resources have been released.
 func (ResultSetBase) Dispose() error {
 	return nil
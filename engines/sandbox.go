@@ -60,7 +60,11 @@ type Sandbox interface {
 	// instance, so that any resources held aren't transferred to multiple
 	// different ResultSet instances.
 	//
-	// Non-fatal errors: ErrNonFatalInternalError, ErrSandboxAborted.
+	// If the task exhausted a resource the worker can't provide more of, such as
+	// disk space, WaitForResult() should return a ResourceExhaustedError.
+	//
+	// Non-fatal errors: ErrNonFatalInternalError, ErrSandboxAborted,
+	// ResourceExhaustedError, InfrastructureError.
 	WaitForResult() (ResultSet, error)
 
 	// NewShell creates a new Shell for interaction with the sandbox. The shell
@@ -64,6 +64,26 @@ type SandboxBuilder interface {
 	// ErrNamingConflict
 	AttachProxy(hostname string, handler http.Handler) error
 
+	// Attach a host-side service to the sandbox, such that HTTP requests for
+	// http://<hostname>/ from inside the sandbox are forwarded to the handler.
+	//
+	// Unlike AttachProxy, which exposes a handler at an engine-specific
+	// location, this makes the service reachable at a well-known hostname. This
+	// allows plugins to offer services like caching proxies or secret endpoints
+	// at stable addresses. The engine is responsible for wiring DNS entries and
+	// routing, and for ensuring that no other sandbox can reach the handler.
+	// Requests are forwarded without rewriting the hostname or path.
+	//
+	// To ensure that all plugins works with all engines, AttachService should
+	// always allow hostnames matching /[a-z]{3,22}/.
+	//
+	// If the engine doesn't support service attachments, it should return
+	// ErrFeatureNotSupported.
+	//
+	// Non-fatal errors: MalformedPayloadError, ErrFeatureNotSupported,
+	// ErrNamingConflict
+	AttachService(hostname string, handler http.Handler) error
+
 	// Set an environement variable.
 	//
 	// If the format of the environment variable name is invalid this method
@@ -81,7 +101,8 @@ type SandboxBuilder interface {
 	// held by the SandboxBuilder instance should be released or transferred to
 	// the Sandbox implementation.
 	//
-	// Non-fatal errors: MalformedPayloadError, ErrSandboxBuilderDiscarded
+	// Non-fatal errors: MalformedPayloadError, ResourceExhaustedError,
+	// InfrastructureError, ErrSandboxBuilderDiscarded
 	StartSandbox() (Sandbox, error)
 
 	// Discard must free all resources held by the SandboxBuilder interface.
@@ -111,6 +132,12 @@ func (SandboxBuilderBase) AttachProxy(string, http.Handler) error {
 	return ErrFeatureNotSupported
 }
 
+// AttachService returns ErrFeatureNotSupported indicating that the feature
+// isn't supported.
+func (SandboxBuilderBase) AttachService(string, http.Handler) error {
+	return ErrFeatureNotSupported
+}
+
 // SetEnvironmentVariable return ErrFeatureNotSupported indicating that the
 // feature isn't supported.
 func (SandboxBuilderBase) SetEnvironmentVariable(string, string) error {
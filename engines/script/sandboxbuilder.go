@@ -26,7 +26,11 @@ type sandboxBuilder struct {
 func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
 	script := b.engine.config.Command
 	cmd := exec.Command(script[0], script[1:]...)
-	folder, err := b.engine.environment.TemporaryStorage.NewFolder()
+	storage := b.context.TemporaryStorage()
+	if storage == nil {
+		storage = b.engine.environment.TemporaryStorage
+	}
+	folder, err := storage.NewFolder()
 	if err != nil {
 		return nil, errors.Wrap(err, "Error creating temporary folder")
 	}
@@ -43,6 +43,14 @@ type VolumeBuilder interface {
 // data through the defined interface, extracting data through the defined
 // interface and deleting the underlying storage when Dispose is called.
 type Volume interface {
+	// DiskSize returns the number of bytes of disk space used by the Volume.
+	//
+	// This is used for tracking cache usage and enforcing size limits, engines
+	// that can't determine the size may return ErrFeatureNotSupported.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported
+	DiskSize() (uint64, error)
+
 	// Dispose deletes all resources used by the Volume.
 	Dispose() error
 }
@@ -66,6 +74,12 @@ func (VolumeBuilderBase) Discard() error {
 // compatibility when we add more optional methods to Volume.
 type VolumeBase struct{}
 
+// DiskSize returns ErrFeatureNotSupported indicating that the feature isn't
+// supported.
+func (VolumeBase) DiskSize() (uint64, error) {
+	return 0, ErrFeatureNotSupported
+}
+
 // Dispose returns nil indicating that resources were released.
 func (VolumeBase) Dispose() error {
 	return nil
@@ -26,7 +26,10 @@ import (
 	// as they will register themselves using extension registries.
 
 	_ "github.com/taskcluster/taskcluster-worker/commands/daemon"
+	_ "github.com/taskcluster/taskcluster-worker/commands/exec"
+	_ "github.com/taskcluster/taskcluster-worker/commands/fake-queue"
 	_ "github.com/taskcluster/taskcluster-worker/commands/help"
+	_ "github.com/taskcluster/taskcluster-worker/commands/network-helper"
 	_ "github.com/taskcluster/taskcluster-worker/commands/qemu-build"
 	_ "github.com/taskcluster/taskcluster-worker/commands/qemu-guest-tools"
 	_ "github.com/taskcluster/taskcluster-worker/commands/qemu-run"
@@ -41,14 +44,18 @@ import (
 	_ "github.com/taskcluster/taskcluster-worker/config/hostcredentials"
 	_ "github.com/taskcluster/taskcluster-worker/config/packet"
 	_ "github.com/taskcluster/taskcluster-worker/config/secrets"
+	_ "github.com/taskcluster/taskcluster-worker/engines/docker"
 	_ "github.com/taskcluster/taskcluster-worker/engines/enginetest"
 	_ "github.com/taskcluster/taskcluster-worker/engines/mock"
 	_ "github.com/taskcluster/taskcluster-worker/engines/native"
 	_ "github.com/taskcluster/taskcluster-worker/engines/qemu"
 	_ "github.com/taskcluster/taskcluster-worker/engines/script"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/artifactcache"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/artifacts"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/cache"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/dependencies"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/env"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/hostevents"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/interactive"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/livelog"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/logprefix"
@@ -56,7 +63,9 @@ import (
 	_ "github.com/taskcluster/taskcluster-worker/plugins/plugintest"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/reboot"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/success"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/summary"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/tcproxy"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/toolchains"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/watchdog"
 )
 
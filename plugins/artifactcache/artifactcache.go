@@ -0,0 +1,202 @@
+package artifactcache
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
+	"github.com/taskcluster/taskcluster-worker/runtime/cas"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+)
+
+// Hostname at which the artifact cache is exposed inside the sandbox
+const serviceHostname = "artifacts"
+
+type provider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+	monitor runtime.Monitor
+	storage runtime.TemporaryStorage
+	store   *cas.Store // nil, if there is no content store
+	cache   *caching.Cache
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	plugin  *plugin
+	monitor runtime.Monitor
+	context *runtime.TaskContext
+}
+
+func init() {
+	plugins.Register("artifactcache", provider{})
+}
+
+func (provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, error) {
+	return &plugin{
+		monitor: options.Monitor,
+		storage: options.Environment.TemporaryStorage,
+		store:   options.Environment.ContentStore,
+		cache:   caching.New(constructor, true, options.Environment.GarbageCollector),
+	}, nil
+}
+
+func (p *plugin) PayloadSchema() schematypes.Object {
+	return payloadSchema
+}
+
+func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	var P payload
+	schematypes.MustValidateAndMap(payloadSchema, options.Payload, &P)
+
+	// If disabled we return nothing
+	if P.DisableArtifactCache {
+		return plugins.TaskPluginBase{}, nil
+	}
+
+	return &taskPlugin{
+		plugin:  p,
+		monitor: options.Monitor,
+		context: options.TaskContext,
+	}, nil
+}
+
+func (p *plugin) Dispose() error {
+	return p.cache.PurgeAll()
+}
+
+func (tp *taskPlugin) BuildSandbox(sandboxBuilder engines.SandboxBuilder) error {
+	err := sandboxBuilder.AttachService(serviceHostname, tp)
+	if err == engines.ErrFeatureNotSupported {
+		// Fire off a warning, and then do nothing...
+		tp.monitor.ReportWarning(err, "plugin 'artifactcache' is enabled, but the engine doesn't support service attachments")
+		return nil
+	}
+	if err == engines.ErrNamingConflict {
+		return runtime.NewMalformedPayloadError("the service hostname '" + serviceHostname + "' is already in use")
+	}
+	if _, ok := runtime.IsMalformedPayloadError(err); ok {
+		// the hostname is required to be allowed by all engines, so if it's not
+		// we'll panic
+		panic(errors.Wrapf(err, "service hostname '%s' is not permitted by the engine", serviceHostname))
+	}
+	return err
+}
+
+// parseArtifactPath returns fetcher and reference options for path, or false
+// if path isn't on one of the forms:
+//
+//	/task/<taskId>/artifacts/<name>
+//	/task/<taskId>/runs/<runId>/artifacts/<name>
+//	/index/<namespace>/artifacts/<name>
+func parseArtifactPath(path string) (fetcher.Fetcher, map[string]interface{}, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 6)
+	switch {
+	case len(parts) >= 4 && parts[0] == "task" && parts[2] == "artifacts":
+		name := strings.Join(parts[3:], "/")
+		return fetcher.Artifact, map[string]interface{}{
+			"taskId":   parts[1],
+			"artifact": name,
+		}, name != ""
+	case len(parts) == 6 && parts[0] == "task" && parts[2] == "runs" && parts[4] == "artifacts":
+		runID, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return nil, nil, false
+		}
+		return fetcher.Artifact, map[string]interface{}{
+			"taskId":   parts[1],
+			"runId":    runID,
+			"artifact": parts[5],
+		}, parts[5] != ""
+	case len(parts) >= 4 && parts[0] == "index" && parts[2] == "artifacts":
+		name := strings.Join(parts[3:], "/")
+		return fetcher.Index, map[string]interface{}{
+			"namespace": parts[1],
+			"artifact":  name,
+		}, name != ""
+	}
+	return nil, nil, false
+}
+
+func (tp *taskPlugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "artifact cache only supports GET and HEAD requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, options, ok := parseArtifactPath(r.URL.Path)
+	if !ok || f.Schema().Validate(options) != nil {
+		http.Error(w, "artifact cache expects paths on the form: /task/<taskId>/artifacts/<name>, "+
+			"/task/<taskId>/runs/<runId>/artifacts/<name> or /index/<namespace>/artifacts/<name>", http.StatusNotFound)
+		return
+	}
+	debug("resolving: '%s'", r.URL.Path)
+
+	// Resolve the reference, this resolves index namespaces and latest runId
+	ctx := &progressContext{tp.context}
+	ref, err := f.NewReference(ctx, options)
+	if err != nil {
+		tp.handleError(w, r, err)
+		return
+	}
+
+	// Check that task.scopes satisfies one of the required scope-sets, before we
+	// serve anything, as the artifact may have been cached by another task
+	if !tp.context.HasScopes(ref.Scopes()...) {
+		tp.context.LogError("artifact cache refused to serve: '", r.URL.Path,
+			"' as task.scopes doesn't satisfy any of the scope-sets: ", ref.Scopes())
+		http.Error(w, "task.scopes doesn't grant access to this artifact", http.StatusForbidden)
+		return
+	}
+
+	handle, err := tp.plugin.cache.Require(ctx, artifactOptions{
+		HashKey:     ref.HashKey(),
+		Reference:   ref,
+		TaskContext: tp.context,
+		Plugin:      tp.plugin,
+	})
+	if err != nil {
+		tp.handleError(w, r, err)
+		return
+	}
+	defer handle.Release()
+
+	artifact := handle.Resource().(*artifactFile)
+	file, err := os.Open(artifact.path)
+	if err != nil {
+		tp.handleError(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		tp.handleError(w, r, err)
+		return
+	}
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+func (tp *taskPlugin) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case fetcher.IsBrokenReferenceError(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case fetcher.IsUnavailableError(err):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	case tp.context.Err() != nil:
+		http.Error(w, "task has been resolved", http.StatusServiceUnavailable)
+	default:
+		incidentID := tp.monitor.ReportError(err, "artifact cache failed to serve: ", r.URL.Path)
+		http.Error(w, "internal error in artifact cache, incidentId: "+incidentID, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,114 @@
+package artifactcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestParseArtifactPath(t *testing.T) {
+	f, options, ok := parseArtifactPath("/task/abc/artifacts/public/build/target.tar.gz")
+	require.True(t, ok)
+	require.Equal(t, fetcher.Artifact, f)
+	require.Equal(t, "abc", options["taskId"])
+	require.Equal(t, "public/build/target.tar.gz", options["artifact"])
+	require.NotContains(t, options, "runId")
+
+	f, options, ok = parseArtifactPath("/task/abc/runs/2/artifacts/public/build/target.tar.gz")
+	require.True(t, ok)
+	require.Equal(t, fetcher.Artifact, f)
+	require.Equal(t, 2, options["runId"])
+	require.Equal(t, "public/build/target.tar.gz", options["artifact"])
+
+	f, options, ok = parseArtifactPath("/index/my-namespace/artifacts/public/toolchain.zip")
+	require.True(t, ok)
+	require.Equal(t, fetcher.Index, f)
+	require.Equal(t, "my-namespace", options["namespace"])
+	require.Equal(t, "public/toolchain.zip", options["artifact"])
+
+	for _, path := range []string{
+		"/",
+		"/task/abc",
+		"/task/abc/artifacts/",
+		"/task/abc/runs/x/artifacts/public/a",
+		"/index/ns/public/a",
+		"/queue/v1/task/abc/artifacts/public/a",
+	} {
+		_, _, ok = parseArtifactPath(path)
+		require.False(t, ok, "expected %s to be rejected", path)
+	}
+}
+
+func TestServeHTTPScopes(t *testing.T) {
+	const taskID = "H6SAIKUFT2mewKH-qHzXjQ"
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/v1/task/" + taskID + "/runs/0/artifacts/private/data.txt":
+			w.Write([]byte("private-data"))
+		case "/v1/task/" + taskID + "/runs/0/artifacts/public/data.txt":
+			w.Write([]byte("public-data"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	storage := runtime.NewTemporaryTestFolderOrPanic()
+	defer storage.Remove()
+	p := &plugin{
+		monitor: mocks.NewMockMonitor(true),
+		storage: storage,
+		cache:   caching.New(constructor, true, gc.New("", 0, 0)),
+	}
+	defer p.Dispose()
+
+	// get requests path from a task with given scopes
+	get := func(path string, scopes ...string) *httptest.ResponseRecorder {
+		ctx, control, err := runtime.NewTaskContext(storage.NewFilePath(), runtime.TaskInfo{Scopes: scopes})
+		require.NoError(t, err)
+		defer control.Dispose()
+		q := queue.New(&tcclient.Credentials{ClientID: "test-client", AccessToken: "test-token"})
+		q.BaseURL = s.URL + "/v1"
+		control.SetQueueClient(q)
+
+		tp := &taskPlugin{plugin: p, monitor: mocks.NewMockMonitor(true), context: ctx}
+		w := httptest.NewRecorder()
+		tp.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	private := "/task/" + taskID + "/runs/0/artifacts/private/data.txt"
+	w := get(private, "queue:get-artifact:private/*")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "private-data", w.Body.String())
+	require.Equal(t, 1, requests)
+
+	// The artifact is cached, but a task without the scope is refused
+	w = get(private)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.NotContains(t, w.Body.String(), "private-data")
+	w = get(private, "queue:get-artifact:public/*")
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// A task with the scope is served from the cache
+	w = get(private, "queue:get-artifact:private/data.txt")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "private-data", w.Body.String())
+	require.Equal(t, 1, requests)
+
+	// Public artifacts don't require scopes
+	w = get("/task/" + taskID + "/runs/0/artifacts/public/data.txt")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "public-data", w.Body.String())
+}
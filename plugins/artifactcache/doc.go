@@ -0,0 +1,14 @@
+// Package artifactcache provides a taskcluster-worker plugin that exposes a
+// caching proxy for artifact downloads to the sandbox at 'http://artifacts/'.
+//
+// Artifacts are fetched by the worker using task-specific credentials, hence,
+// a task can only fetch artifacts that task.scopes grants access to. Fetched
+// artifacts are cached on the host and shared between tasks, such that tasks
+// fetching the same toolchain artifacts don't download them again. Before an
+// artifact is served from cache, the worker checks that task.scopes satisfies
+// the scopes required for the artifact.
+package artifactcache
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("artifactcache")
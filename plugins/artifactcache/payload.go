@@ -0,0 +1,30 @@
+package artifactcache
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+var payloadSchema = schematypes.Object{
+	Properties: schematypes.Properties{
+		"disableArtifactCache": schematypes.Boolean{
+			Title: "Disable Artifact Cache",
+			Description: util.Markdown(`
+				The artifact cache is a caching proxy for artifact downloads exposed
+				at 'http://` + serviceHostname + `/'. Artifacts can be fetched from:
+
+				 * '/task/<taskId>/artifacts/<name>',
+				 * '/task/<taskId>/runs/<runId>/artifacts/<name>', and,
+				 * '/index/<namespace>/artifacts/<name>'.
+
+				Non-public artifacts requires that 'task.scopes' satisfies
+				'queue:get-artifact:<name>'. The artifact cache is enabled by default,
+				this option can be used to disable it per-task.
+			`),
+		},
+	},
+}
+
+type payload struct {
+	DisableArtifactCache bool `json:"disableArtifactCache"`
+}
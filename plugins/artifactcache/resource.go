@@ -0,0 +1,109 @@
+package artifactcache
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
+	"github.com/taskcluster/taskcluster-worker/runtime/cas"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+)
+
+// artifactOptions is given to the cache, only HashKey is used to determine
+// resource equivalence.
+type artifactOptions struct {
+	HashKey     string               `json:"hashKey"`
+	Reference   fetcher.Reference    `json:"-"`
+	TaskContext *runtime.TaskContext `json:"-"`
+	Plugin      *plugin              `json:"-"`
+}
+
+// artifactFile is a cached artifact stored in a temporary file
+type artifactFile struct {
+	path  string
+	size  uint64
+	store *cas.Store // content store path is linked from, if any
+	hash  string
+}
+
+type fetchContext struct {
+	caching.Context
+	TaskContext *runtime.TaskContext
+}
+
+func (c *fetchContext) Queue() client.Queue {
+	return c.TaskContext.Queue()
+}
+
+type progressContext struct {
+	*runtime.TaskContext
+}
+
+func (c *progressContext) Progress(description string, percent float64) {
+	c.Log(fmt.Sprintf("Artifact cache fetching: %s - %.0f %%", description, percent*100))
+}
+
+func constructor(ctx caching.Context, opts interface{}) (caching.Resource, error) {
+	options := opts.(artifactOptions) // must be of this type
+
+	path := options.Plugin.storage.NewFilePath()
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create temporary file for artifact")
+	}
+	defer file.Close()
+
+	err = options.Reference.Fetch(&fetchContext{
+		Context:     ctx,
+		TaskContext: options.TaskContext,
+	}, &fetcher.FileReseter{File: file})
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		os.Remove(path)
+		return nil, errors.Wrap(err, "failed to stat fetched artifact")
+	}
+
+	// Share identical artifacts through the content store, if we have one
+	store := options.Plugin.store
+	var hash string
+	if store != nil {
+		file.Close()
+		if hash, err = store.Import(path); err == nil {
+			err = store.Link(hash, path)
+		}
+		if err != nil {
+			os.Remove(path)
+			return nil, errors.Wrap(err, "failed to move fetched artifact into content store")
+		}
+	}
+
+	return &artifactFile{
+		path:  path,
+		size:  uint64(info.Size()),
+		store: store,
+		hash:  hash,
+	}, nil
+}
+
+func (a *artifactFile) MemorySize() (uint64, error) {
+	return 0, nil
+}
+
+func (a *artifactFile) DiskSize() (uint64, error) {
+	return a.size, nil
+}
+
+func (a *artifactFile) Dispose() error {
+	err := os.Remove(a.path)
+	if a.store != nil && err == nil {
+		err = a.store.Release(a.hash)
+	}
+	return err
+}
@@ -14,7 +14,10 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/clearsign"
 
@@ -41,8 +44,10 @@ type pluginProvider struct {
 
 type plugin struct {
 	plugins.PluginBase
-	environment *runtime.Environment
-	privateKey  *openpgp.Entity // nil, if COT is disabled
+	environment     *runtime.Environment
+	privateKey      *openpgp.Entity    // nil, if COT is disabled
+	signingKey      ed25519.PrivateKey // nil, if artifact signing is disabled
+	deadlineReserve time.Duration
 }
 
 type taskPlugin struct {
@@ -52,6 +57,7 @@ type taskPlugin struct {
 	artifacts    []artifact
 	createCOT    bool
 	certifiedLog bool
+	uploadBy     time.Time         // Artifacts are not uploaded after this, zero if no limit
 	uploaded     map[string][]byte // Map from artifact to sha256 hash
 	mUploaded    sync.Mutex
 	monitor      runtime.Monitor
@@ -86,9 +92,27 @@ func (pluginProvider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin,
 		key = keyring[0]
 	}
 
+	var signingKey ed25519.PrivateKey
+	if c.SigningKey != "" {
+		var err error
+		if signingKey, err = parseSigningKey(c.SigningKey); err != nil {
+			return nil, err
+		}
+	}
+
+	// Use the default, unless deadlineReserve is given, zero disables it
+	reserve := defaultDeadlineReserve
+	if config, ok := options.Config.(map[string]interface{}); ok {
+		if _, ok := config["deadlineReserve"]; ok {
+			reserve = c.DeadlineReserve
+		}
+	}
+
 	return &plugin{
-		environment: options.Environment,
-		privateKey:  key,
+		environment:     options.Environment,
+		privateKey:      key,
+		signingKey:      signingKey,
+		deadlineReserve: reserve,
 	}, nil
 }
 
@@ -122,8 +146,16 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskP
 	var P payload
 	schematypes.MustValidateAndMap(p.PayloadSchema(), options.Payload, &P)
 
+	// Stop uploading artifacts when the deadline is near, so there is time left
+	// for uploading logs and resolving the task
+	var uploadBy time.Time
+	if deadline := options.TaskContext.TaskInfo.LocalDeadline(); !deadline.IsZero() && p.deadlineReserve > 0 {
+		uploadBy = deadline.Add(-p.deadlineReserve)
+	}
+
 	return &taskPlugin{
 		plugin:       p,
+		uploadBy:     uploadBy,
 		artifacts:    P.Artifacts,
 		createCOT:    p.privateKey != nil && P.CreateCOT,
 		certifiedLog: p.privateKey != nil && P.CertifiedLog,
@@ -135,6 +167,7 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskP
 
 func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
 	debug("Extracting artifacts")
+	started := time.Now()
 	util.SpawnWithLimit(len(tp.artifacts), maxUploadConcurrency, func(i int) {
 		// Abort, if task context is cancelled
 		if tp.context.Err() != nil {
@@ -149,9 +182,14 @@ func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
 			tp.processFile(result, a)
 		case typeDirectory:
 			tp.processDirectory(result, a)
+		case typeGlob:
+			tp.processGlob(result, a)
 		}
 	})
 	debug("Artifacts extracted and uploaded")
+	if len(tp.artifacts) > 0 {
+		tp.context.LogTiming("artifact-upload", time.Since(started))
+	}
 
 	// Find error condition
 	var err error
@@ -167,9 +205,30 @@ func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
 	return !tp.failed.Get(), err
 }
 
+// withinDeadline returns true, if there is time to upload the artifact given by
+// name before the task deadline. Otherwise, the task is failed with a message
+// in the task log, so that the task can be resolved before the deadline.
+func (tp *taskPlugin) withinDeadline(name string) bool {
+	if tp.uploadBy.IsZero() || time.Now().Before(tp.uploadBy) {
+		return true
+	}
+	tp.notUploaded(name)
+	return false
+}
+
+// notUploaded fails the task with a message in the task log, explaining that
+// the artifact given by name wasn't uploaded because the deadline is near.
+func (tp *taskPlugin) notUploaded(name string) {
+	tp.failed.Set(true)
+	tp.context.LogError(fmt.Sprintf(
+		"Artifact '%s' was not uploaded, because the task deadline is less than %s away",
+		name, tp.plugin.deadlineReserve,
+	))
+}
+
 func (tp *taskPlugin) hashArtifact(name string, r io.ReadSeeker) error {
-	// Skip if no COT is to be generated
-	if !tp.createCOT {
+	// Skip if no COT or signatures are to be generated
+	if !tp.createCOT && tp.plugin.signingKey == nil {
 		return nil
 	}
 
@@ -182,7 +241,7 @@ func (tp *taskPlugin) hashArtifact(name string, r io.ReadSeeker) error {
 		return errors.Wrap(err, "failed to seek artifact reader to start")
 	}
 
-	// Set artifact hash in uploaded for COT generation
+	// Set artifact hash in uploaded for COT and signature generation
 	tp.mUploaded.Lock()
 	defer tp.mUploaded.Unlock()
 	tp.uploaded[name] = h.Sum(nil)
@@ -191,6 +250,16 @@ func (tp *taskPlugin) hashArtifact(name string, r io.ReadSeeker) error {
 }
 
 func (tp *taskPlugin) Finished(success bool) error {
+	err := tp.createChainOfTrust()
+	if tp.plugin.signingKey != nil {
+		if serr := tp.uploadSignatures(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+func (tp *taskPlugin) createChainOfTrust() error {
 	// Skip if no COT is to be generated
 	if !tp.createCOT {
 		return nil
@@ -379,18 +448,26 @@ func (tp *taskPlugin) processFile(result engines.ResultSet, a artifact) {
 		mtype = unknownMimetype
 	}
 
+	// Skip upload, if the deadline is too close
+	if !tp.withinDeadline(a.Name) {
+		return
+	}
+
 	// Compute artifact hash for chain-of-trust
-	if err = tp.hashArtifact(a.Name, r); err == nil {
-		// Let's upload from r
+	stream := tp.untilDeadline(r)
+	if err = tp.hashArtifact(a.Name, stream); err == nil {
+		// Let's upload from stream
 		err = tp.context.UploadS3Artifact(runtime.S3Artifact{
 			Name:     a.Name,
 			Mimetype: mtype,
-			Stream:   r,
+			Stream:   stream,
 			Expires:  a.Expires,
 		})
 	}
 
-	if err != nil && err != context.Canceled {
+	if errors.Cause(err) == errDeadlineReserve {
+		tp.notUploaded(a.Name)
+	} else if err != nil && err != context.Canceled {
 		tp.nonFatalErr.Set(true)
 		i := tp.monitor.ReportError(err, "Failed to upload artifact")
 		tp.context.LogError("Failed to upload artifact unhandled error, incidentId:", i)
@@ -398,13 +475,40 @@ func (tp *taskPlugin) processFile(result engines.ResultSet, a artifact) {
 }
 
 func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
-	debug("extracting directory from path: %s", a.Path)
+	tp.processFolder(result, a, a.Path, nil)
+}
+
+func (tp *taskPlugin) processGlob(result engines.ResultSet, a artifact) {
+	folder, pattern := splitGlob(a.Path)
+	if !validGlob(pattern) {
+		tp.mErrors.Lock()
+		tp.errors = append(tp.errors, runtime.NewMalformedPayloadError(
+			"Invalid glob pattern: '", a.Path, "'",
+		))
+		tp.mErrors.Unlock()
+		return
+	}
+	tp.processFolder(result, a, folder, func(p string) bool {
+		return matchGlob(pattern, p)
+	})
+}
+
+// processFolder uploads files from folder matching filter, or all files if
+// filter is nil.
+func (tp *taskPlugin) processFolder(result engines.ResultSet, a artifact, folder string, filter func(string) bool) {
+	debug("extracting directory from path: %s", folder)
 	semaphore := make(chan struct{}, maxUploadConcurrency)
-	err := result.ExtractFolder(a.Path, func(p string, r ioext.ReadSeekCloser) error {
-		debug(" - Found artifact: %s in %s", p, a.Path)
+	var matched int32
+	err := result.ExtractFolder(folder, func(p string, r ioext.ReadSeekCloser) error {
 		// Always close the reader
 		defer r.Close()
 
+		if filter != nil && !filter(p) {
+			return nil
+		}
+		atomic.AddInt32(&matched, 1)
+		debug(" - Found artifact: %s in %s", p, folder)
+
 		// Block until we can write to semaphore, then read when we're done uploading
 		// This way the capacity o the semaphore channel limits concurrency.
 		select {
@@ -425,18 +529,28 @@ func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 		// Construct artifact name
 		name := path.Join(a.Name, p)
 
+		// Skip upload, if the deadline is too close
+		if !tp.withinDeadline(name) {
+			return nil
+		}
+
 		var uerr error
 		// Compute artifact hash for chain-of-trust
-		if uerr = tp.hashArtifact(name, r); uerr == nil {
+		stream := tp.untilDeadline(r)
+		if uerr = tp.hashArtifact(name, stream); uerr == nil {
 			// Upload artifact
-			debug(" - Uploading %s from %s -> %s", p, a.Path, name)
+			debug(" - Uploading %s from %s -> %s", p, folder, name)
 			uerr = tp.context.UploadS3Artifact(runtime.S3Artifact{
 				Name:     name,
 				Expires:  a.Expires,
-				Stream:   r,
+				Stream:   stream,
 				Mimetype: mtype,
 			})
 		}
+		if errors.Cause(uerr) == errDeadlineReserve {
+			tp.notUploaded(name)
+			return nil
+		}
 
 		// If we have an upload error, that's just a internal non-fatal error.
 		// We ignore the error, if TaskContext was canceled, as requests should be
@@ -478,6 +592,21 @@ func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 		return
 	}
 
+	// If no files matched the glob, the task should fail like a missing folder
+	if err == nil && filter != nil && atomic.LoadInt32(&matched) == 0 {
+		tp.failed.Set(true)
+		if result.Success() {
+			tp.context.LogError(fmt.Sprintf("No files matching '%s' were found, artifact upload failed.", a.Path))
+		}
+		tp.context.CreateErrorArtifact(runtime.ErrorArtifact{
+			Name:    a.Name,
+			Reason:  reasonFileMissing,
+			Message: fmt.Sprintf("No files matching: '%s' were found on worker", a.Path),
+			Expires: a.Expires,
+		})
+		return
+	}
+
 	// If handler was interupted, then task was canceled or aborted...
 	if err == engines.ErrHandlerInterrupt {
 		tp.monitor.Debug("TaskContext cancellation interrupted artifact upload from folder")
@@ -130,3 +130,28 @@ func TestArtifactsDirectory(t *testing.T) {
 		},
 	}.Test()
 }
+
+func TestArtifactsGlob(t *testing.T) {
+	artifactTestCase{
+		Artifacts: []string{"public/logs/blah.txt", "public/logs/sub/foo.txt"},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/artifacts/blah.txt /artifacts/sub/foo.txt /artifacts/bar.json",
+				"artifacts": [
+					{
+						"type": "glob",
+						"path": "/artifacts/**/*.txt",
+						"name": "public/logs"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
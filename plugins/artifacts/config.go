@@ -1,14 +1,21 @@
 package artifacts
 
 import (
+	"time"
+
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
 type config struct {
-	PrivateKey string `json:"privateKey"`
+	PrivateKey      string        `json:"privateKey"`
+	DeadlineReserve time.Duration `json:"deadlineReserve"`
+	SigningKey      string        `json:"signingKey"`
 }
 
+// defaultDeadlineReserve is used if deadlineReserve isn't configured
+const defaultDeadlineReserve = 2 * time.Minute
+
 var configSchema = schematypes.Object{
 	Title: "Artifact Configuration",
 	Description: util.Markdown(`
@@ -25,5 +32,31 @@ var configSchema = schematypes.Object{
 				If not given, chain-of-trust signing will be disabled.
 			`),
 		},
+		"deadlineReserve": schematypes.Duration{
+			Title: "Deadline Reserve",
+			Description: util.Markdown(`
+				Time reserved before the task deadline for uploading the task log and
+				resolving the task. Artifacts are not uploaded when the task deadline
+				is closer than this, and uploads still in progress are aborted,
+				instead the task fails with a message in the task log. Otherwise,
+				the run would be resolved 'claim-expired' when the deadline is
+				exceeded during artifact upload.
+
+				Defaults to 2 minutes, set to zero to disable.
+			`),
+		},
+		"signingKey": schematypes.String{
+			Title: "Artifact Signing Key",
+			Description: util.Markdown(`
+				Base64 encoded ed25519 private key (or 32 byte seed) identifying this
+				worker. If given, the sha256 hash of every uploaded artifact is signed
+				with this key, and the signatures are uploaded as
+				'` + signaturesArtifactName + `' along with the public key.
+
+				Each signature covers the string '<taskId>/<runId>/<name>:<sha256>',
+				this gives consumers provenance of artifacts without requiring full
+				chain-of-trust.
+			`),
+		},
 	},
 }
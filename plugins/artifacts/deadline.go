@@ -0,0 +1,43 @@
+package artifacts
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// errDeadlineReserve is returned when reading an artifact after the deadline
+// reserve has been reached
+var errDeadlineReserve = errors.New("artifact upload aborted as the task deadline is near")
+
+// deadlineReader is a ReadSeekCloser that fails reads and seeks after a
+// deadline, this aborts uploads in progress when the deadline reserve is
+// reached, without retrying.
+type deadlineReader struct {
+	ioext.ReadSeekCloser
+	deadline time.Time
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if !time.Now().Before(r.deadline) {
+		return 0, errDeadlineReserve
+	}
+	return r.ReadSeekCloser.Read(p)
+}
+
+func (r *deadlineReader) Seek(offset int64, whence int) (int64, error) {
+	if !time.Now().Before(r.deadline) {
+		return 0, errDeadlineReserve
+	}
+	return r.ReadSeekCloser.Seek(offset, whence)
+}
+
+// untilDeadline returns r limited to reading before the deadline reserve is
+// reached, or r if there is no deadline reserve.
+func (tp *taskPlugin) untilDeadline(r ioext.ReadSeekCloser) ioext.ReadSeekCloser {
+	if tp.uploadBy.IsZero() {
+		return r
+	}
+	return &deadlineReader{ReadSeekCloser: r, deadline: tp.uploadBy}
+}
@@ -0,0 +1,32 @@
+package artifacts
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+func TestDeadlineReader(t *testing.T) {
+	r := ioext.NopCloser(bytes.NewReader([]byte("hello world")))
+
+	// Without a deadline reserve the reader isn't wrapped
+	tp := &taskPlugin{}
+	require.Equal(t, r, tp.untilDeadline(r))
+
+	tp.uploadBy = time.Now().Add(50 * time.Millisecond)
+	stream := tp.untilDeadline(r)
+	data, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(data))
+
+	// Reads and seeks fail after the deadline, so uploads aren't retried
+	time.Sleep(60 * time.Millisecond)
+	_, err = stream.Seek(0, 0)
+	require.Equal(t, errDeadlineReserve, err)
+	_, err = stream.Read(make([]byte, 1))
+	require.Equal(t, errDeadlineReserve, err)
+}
@@ -0,0 +1,62 @@
+package artifacts
+
+import (
+	"path"
+	"strings"
+)
+
+// splitGlob splits pattern into the folder before the first segment with a
+// wildcard and the remaining pattern, which is relative to the folder.
+func splitGlob(pattern string) (folder, rest string) {
+	segments := strings.Split(pattern, "/")
+	i := len(segments) - 1
+	for j, s := range segments {
+		if strings.ContainsAny(s, `*?[\`) {
+			i = j
+			break
+		}
+	}
+	folder = strings.Join(segments[:i], "/")
+	if folder == "" {
+		folder = "."
+		if strings.HasPrefix(pattern, "/") {
+			folder = "/"
+		}
+	}
+	return folder, strings.Join(segments[i:], "/")
+}
+
+// validGlob returns false, if pattern has a malformed segment
+func validGlob(pattern string) bool {
+	for _, s := range strings.Split(pattern, "/") {
+		if _, err := path.Match(s, ""); s != "**" && err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// matchGlob returns true, if the slash-separated name matches pattern
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		// Match any number of segments, including none
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchSegments(pattern[1:], name[1:])
+}
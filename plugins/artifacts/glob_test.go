@@ -0,0 +1,35 @@
+package artifacts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitGlob(t *testing.T) {
+	folder, rest := splitGlob("/home/worker/**/*.log")
+	assert.Equal(t, "/home/worker", folder)
+	assert.Equal(t, "**/*.log", rest)
+
+	folder, rest = splitGlob("/*.txt")
+	assert.Equal(t, "/", folder)
+	assert.Equal(t, "*.txt", rest)
+
+	folder, rest = splitGlob("build/output.zip")
+	assert.Equal(t, "build", folder)
+	assert.Equal(t, "output.zip", rest)
+}
+
+func TestMatchGlob(t *testing.T) {
+	assert.True(t, matchGlob("*.log", "test.log"))
+	assert.False(t, matchGlob("*.log", "logs/test.log"))
+	assert.True(t, matchGlob("**/*.log", "test.log"))
+	assert.True(t, matchGlob("**/*.log", "a/b/test.log"))
+	assert.True(t, matchGlob("a/**/c/*.txt", "a/c/x.txt"))
+	assert.True(t, matchGlob("a/**/c/*.txt", "a/b/b/c/x.txt"))
+	assert.False(t, matchGlob("a/**/c/*.txt", "a/b/x.txt"))
+	assert.True(t, matchGlob("report-?.json", "report-1.json"))
+
+	assert.True(t, validGlob("**/*.log"))
+	assert.False(t, validGlob("[a-.log"))
+}
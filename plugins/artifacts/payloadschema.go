@@ -23,6 +23,7 @@ type artifact struct {
 const (
 	typeFile      = "file"
 	typeDirectory = "directory"
+	typeGlob      = "glob"
 )
 
 var artifactSchema = schematypes.Array{
@@ -35,13 +36,19 @@ var artifactSchema = schematypes.Array{
 				Description: util.Markdown(`
 					Artifacts can be either an individual 'file' or a 'directory'
 					containing potentially multiple files with recursively included
-					subdirectories.
+					subdirectories, or a 'glob' pattern matching files.
+
+					Glob patterns use the syntax of 'path.Match' for each path segment,
+					and the segment '**' matches any number of subdirectories, such as
+					'/home/worker/**/*.log'. Files matching a glob are uploaded with the
+					path relative to the folder before the first wildcard appended to
+					'name'.
 				`),
-				Options: []string{typeFile, typeDirectory},
+				Options: []string{typeFile, typeDirectory, typeGlob},
 			},
 			"path": schematypes.String{
 				Title:       "Artifact Path",
-				Description: "File system path of the artifact",
+				Description: "File system path of the artifact, or glob pattern if 'type' is 'glob'",
 				Pattern:     `^.*[^/]$`,
 			},
 			"name": schematypes.String{
@@ -0,0 +1,97 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"golang.org/x/crypto/ed25519"
+)
+
+const signaturesArtifactName = "public/signatures.json"
+
+type signedArtifact struct {
+	Sha256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// artifactSignatures is the content of the signatures artifact
+type artifactSignatures struct {
+	Version     int                       `json:"version"`
+	TaskID      string                    `json:"taskId"`
+	RunID       int                       `json:"runId"`
+	WorkerGroup string                    `json:"workerGroup"`
+	WorkerID    string                    `json:"workerId"`
+	PublicKey   string                    `json:"publicKey"`
+	Artifacts   map[string]signedArtifact `json:"artifacts"`
+}
+
+// parseSigningKey parses a base64 encoded ed25519 private key or seed
+func parseSigningKey(key string) (ed25519.PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "signingKey isn't valid base64")
+	}
+	switch len(data) {
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(data), nil
+	case 32: // seed
+		_, priv, err := ed25519.GenerateKey(bytes.NewReader(data))
+		return priv, err
+	default:
+		return nil, fmt.Errorf("signingKey must be a 32 byte seed or 64 byte ed25519 private key, got %d bytes", len(data))
+	}
+}
+
+// signatureMessage returns the message signed for an artifact, this binds
+// the hash to the task, run and artifact name.
+func signatureMessage(taskID string, runID int, name, sha256 string) []byte {
+	return []byte(fmt.Sprintf("%s/%d/%s:%s", taskID, runID, name, sha256))
+}
+
+// uploadSignatures signs the hashes of uploaded artifacts with the worker
+// signing key, and uploads the signatures as a companion artifact.
+func (tp *taskPlugin) uploadSignatures() error {
+	key := tp.plugin.signingKey
+	S := artifactSignatures{
+		Version:     1,
+		TaskID:      tp.context.TaskID,
+		RunID:       tp.context.RunID,
+		WorkerGroup: tp.plugin.environment.WorkerGroup,
+		WorkerID:    tp.plugin.environment.WorkerID,
+		PublicKey:   base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Artifacts:   make(map[string]signedArtifact),
+	}
+	tp.mUploaded.Lock()
+	for name, hash := range tp.uploaded {
+		sha256 := hex.EncodeToString(hash)
+		signature := ed25519.Sign(key, signatureMessage(S.TaskID, S.RunID, name, sha256))
+		S.Artifacts[name] = signedArtifact{
+			Sha256:    sha256,
+			Signature: base64.StdEncoding.EncodeToString(signature),
+		}
+	}
+	tp.mUploaded.Unlock()
+
+	data, err := json.MarshalIndent(S, "", "  ")
+	if err != nil {
+		panic(errors.Wrap(err, "failed to serialize artifact signatures"))
+	}
+	err = tp.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     signaturesArtifactName,
+		Mimetype: "application/json",
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+		Expires:  tp.context.TaskInfo.Expires,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "failed to upload artifact signatures")
+		tp.monitor.Error(err)
+		return runtime.ErrNonFatalInternalError // We don't expect upload errors to be fatal
+	}
+	return nil
+}
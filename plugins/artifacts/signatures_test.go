@@ -0,0 +1,31 @@
+package artifacts
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseSigningKey(t *testing.T) {
+	seed := make([]byte, 32)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	fromSeed, err := parseSigningKey(base64.StdEncoding.EncodeToString(seed))
+	require.NoError(t, err)
+
+	fromKey, err := parseSigningKey(base64.StdEncoding.EncodeToString(fromSeed))
+	require.NoError(t, err)
+	require.Equal(t, fromSeed, fromKey)
+
+	msg := signatureMessage("abc", 0, "public/a.txt", "00ff")
+	sig := ed25519.Sign(fromKey, msg)
+	require.True(t, ed25519.Verify(fromSeed.Public().(ed25519.PublicKey), msg, sig))
+
+	_, err = parseSigningKey("not-base64!")
+	require.Error(t, err)
+	_, err = parseSigningKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	require.Error(t, err)
+}
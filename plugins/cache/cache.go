@@ -9,6 +9,7 @@ import (
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-client-go/purgecache"
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/mounts"
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
@@ -31,8 +32,10 @@ type plugin struct {
 	plugins.PluginBase
 	m              sync.Mutex
 	engine         engines.Engine
+	mounts         *mounts.Adapter
 	environment    *runtime.Environment
 	monitor        runtime.Monitor
+	stats          *statsTracker
 	sharedCache    *caching.Cache
 	exclusiveCache *caching.Cache
 	lastPurged     time.Time
@@ -44,7 +47,7 @@ type taskPlugin struct {
 	plugin         *plugin
 	monitor        runtime.Monitor
 	context        *runtime.TaskContext
-	payloadEntries []payloadEntry
+	payloadEntries []mounts.Mount    // with Options resolved for the engine
 	cacheHandles   []*caching.Handle // pointing to *cacheVolume
 	cachesError    error
 	cachesReady    atomics.Once
@@ -77,8 +80,10 @@ func (p *provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, err
 
 	return &plugin{
 		engine:         options.Engine,
+		mounts:         mounts.NewAdapter(options.Environment.Engine, options.Engine),
 		environment:    options.Environment,
 		monitor:        options.Monitor,
+		stats:          newStatsTracker(options.Monitor.WithPrefix("stats"), options.Environment.Metrics),
 		sharedCache:    caching.New(constructor, false, options.Environment.GarbageCollector),
 		exclusiveCache: caching.New(constructor, false, options.Environment.GarbageCollector),
 		lastPurged:     time.Now(),
@@ -86,28 +91,95 @@ func (p *provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, err
 	}, nil
 }
 
+func (p *plugin) Documentation() []runtime.Section {
+	return []runtime.Section{
+		{
+			Title: "Cache Access Control",
+			Content: util.Markdown(`
+				Named caches are shared between tasks, hence, a task that can write
+				to a named cache can poison it for all subsequent tasks using the
+				cache. To prevent untrusted tasks from tampering with caches used by
+				trusted tasks, a task must have the scope 'worker:cache:<name>' to
+				mount the cache with name '<name>'. This applies to read-only mounts
+				as well, as the cache may contain confidential data.
+
+				Caches without a 'name' are always mounted read-only and are never
+				shared with tasks writing to caches. If such a cache is pre-loaded,
+				the task must satisfy the scopes required to fetch the pre-load data.
+			`),
+		},
+		{
+			Title: "Concurrent Cache Access",
+			Content: util.Markdown(`
+				Tasks mounting a named cache read-write take turns having exclusive
+				access to the cache, waiting for other tasks using it to finish.
+				Tasks mounting a named cache with 'readOnly' share the cache with
+				other such tasks, but wait for any task writing to the cache.
+
+				Changes made to a read-only mount are never written back to the
+				cache. Depending on the engine, writes are either denied or made to
+				a private copy-on-write view of the cache, which is discarded when
+				the task is resolved.
+			`),
+		},
+		{
+			Title: "Cache Pre-loading",
+			Content: util.Markdown(`
+				A cache may be pre-loaded with data by specifying 'preload', the data
+				must be a TAR archive which may be gzip compressed. The archive is
+				extracted into a new volume when the cache is created, if the cache
+				already exists the 'preload' data is not fetched again.
+
+				If the worker has a content store and 'preload' references an
+				artifact from a specific run or a URL with a hash, a snapshot of the
+				extracted data is kept in the content store. New caches with the same
+				'preload' data are restored from the snapshot without fetching the
+				data again, also after the worker is restarted.
+			`),
+		},
+	}
+}
+
 func (p *plugin) PayloadSchema() schematypes.Object {
 	return schematypes.Object{
 		Properties: schematypes.Properties{
 			"caches": schematypes.Array{
-				Items: schematypes.Object{
-					Properties: schematypes.Properties{
-						"name": schematypes.String{ // name in the cache plugin
-							Pattern: "^[\\x20-\\x7e]{1,255}$", // printable ascii
-						},
-						"mountPoint": schematypes.String{},    // path for the engine
-						"options":    p.engine.VolumeSchema(), // engine options
-						"preload":    preloadFetcher.Schema(), // data to be preloaded
-					},
-					Required: []string{"mountPoint", "options"},
-				},
+				Items: p.mounts.Schema(preloadFetcher.Schema()),
 			},
 		},
 	}
 }
 
-func (p *plugin) getVolume(ctx *runtime.TaskContext, options payloadEntry) (*caching.Handle, error) {
-	readOnly := options.Name == ""
+func (p *plugin) PayloadVariables() map[string]plugins.PayloadVariable {
+	return map[string]plugins.PayloadVariable{
+		"CACHE_DIR": p.cacheDir,
+	}
+}
+
+// cacheDir resolves '${CACHE_DIR:<name>}' to the mountPoint of the cache
+// with the given name.
+func (p *plugin) cacheDir(options plugins.PayloadVariableOptions) (string, error) {
+	var P struct {
+		Caches []mounts.Mount `json:"caches"`
+	}
+	schematypes.MustValidateAndMap(p.PayloadSchema(), p.PayloadSchema().Filter(options.TaskPayload), &P)
+
+	if options.Argument == "" {
+		return "", runtime.NewMalformedPayloadError(
+			"'${CACHE_DIR}' must specify the name of a cache, as in '${CACHE_DIR:<name>}'",
+		)
+	}
+	for _, entry := range P.Caches {
+		if entry.Name == options.Argument {
+			return entry.MountPoint, nil
+		}
+	}
+	return "", runtime.NewMalformedPayloadError(fmt.Sprintf(
+		"'${CACHE_DIR:%s}' references a cache not declared in task.payload.caches", options.Argument,
+	))
+}
+
+func (p *plugin) getVolume(ctx *runtime.TaskContext, options mounts.Mount) (*caching.Handle, error) {
 
 	var err error
 	if options.Name != "" && !ctx.HasScopes([]string{cacheScope(options.Name)}) {
@@ -157,13 +229,7 @@ func (p *plugin) getVolume(ctx *runtime.TaskContext, options payloadEntry) (*cac
 		refHash = ref.HashKey()
 	}
 
-	// Pick a cache
-	cache := p.exclusiveCache
-	if readOnly {
-		cache = p.sharedCache
-	}
-
-	return cache.Require(&progressCtx, cacheOptions{
+	opts := cacheOptions{
 		Name:               options.Name,
 		Options:            options.Options,
 		Preload:            options.Preload,
@@ -171,7 +237,27 @@ func (p *plugin) getVolume(ctx *runtime.TaskContext, options payloadEntry) (*cac
 		Reference:          ref, // Not used as part of KEY for the hash
 		InitialTaskContext: ctx, // Not used as part of KEY for the hash
 		Plugin:             p,   // Not used as part of KEY for the hash
-	})
+	}
+
+	// Pick a cache, named caches mounted read-only are shared with other readers,
+	// while writers wait for their turn to have exclusive access.
+	var handle *caching.Handle
+	if options.Name == "" {
+		handle, err = p.sharedCache.Require(&progressCtx, opts)
+	} else if options.ReadOnly {
+		handle, err = p.exclusiveCache.RequireShared(&progressCtx, opts)
+	} else {
+		handle, err = p.exclusiveCache.RequireExclusive(&progressCtx, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Record usage statistics
+	if p.stats.Acquired(handle.Resource().(*cacheVolume)) && options.Name != "" {
+		ctx.Log(fmt.Sprintf("Reusing existing cache: '%s'", options.Name))
+	}
+	return handle, nil
 }
 
 func (p *plugin) PurgeCacheAsNeeded(ctx *runtime.TaskContext) {
@@ -240,10 +326,32 @@ func (p *plugin) PurgeCacheAsNeeded(ctx *runtime.TaskContext) {
 
 func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
 	var P struct {
-		Caches []payloadEntry `json:"caches"`
+		Caches []mounts.Mount `json:"caches"`
 	}
 	schematypes.MustValidateAndMap(p.PayloadSchema(), options.Payload, &P)
 
+	// Resolve volume options for the engine, ensuring they are valid
+	var errs []runtime.MalformedPayloadError
+	names := make(map[string]bool)
+	for i, entry := range P.Caches {
+		opts, err := p.mounts.VolumeOptions(entry)
+		if e, ok := runtime.IsMalformedPayloadError(err); ok {
+			errs = append(errs, e)
+		}
+		P.Caches[i].Options = opts
+
+		// A task would wait for itself, if it mounts a named cache twice
+		if entry.Name != "" && names[entry.Name] {
+			errs = append(errs, runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"cache '%s' is mounted more than once in task.payload.caches", entry.Name,
+			)))
+		}
+		names[entry.Name] = true
+	}
+	if len(errs) > 0 {
+		return nil, runtime.MergeMalformedPayload(errs...)
+	}
+
 	tp := &taskPlugin{
 		plugin:         p,
 		monitor:        options.Monitor,
@@ -256,6 +364,12 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskP
 }
 
 func (p *plugin) Dispose() error {
+	// Write cache usage statistics to system log
+	for _, s := range p.stats.Snapshot() {
+		p.monitor.Infof("cache: '%s' hits: %d, misses: %d, size: %d bytes, last used: %s",
+			s.Name, s.Hits, s.Misses, s.DiskSize, s.LastUsed.Format(time.RFC3339))
+	}
+
 	// Purge everything from caches
 	err1 := p.sharedCache.PurgeAll()
 	err2 := p.exclusiveCache.PurgeAll()
@@ -300,17 +414,28 @@ func (tp *taskPlugin) getCaches() {
 
 	// Release volumes, if there is an error
 	if tp.cachesError != nil {
-		tp.cachesDisposed.Do(func() {
-			for i, handle := range tp.cacheHandles {
-				if handle != nil {
-					handle.Release()
-				}
-				tp.cacheHandles[i] = nil
-			}
-		})
+		tp.cachesDisposed.Do(tp.releaseCaches)
 	}
 }
 
+// releaseCaches releases all cache handles held
+func (tp *taskPlugin) releaseCaches() {
+	for i, handle := range tp.cacheHandles {
+		if handle != nil {
+			tp.plugin.stats.Released(handle.Resource().(*cacheVolume))
+			handle.Release()
+		}
+		tp.cacheHandles[i] = nil
+	}
+
+	// Enforce size limits on named caches, now that volumes are idle
+	tp.plugin.stats.Enforce(
+		tp.plugin.exclusiveCache,
+		uint64(tp.plugin.config.MaxCacheSize),
+		uint64(tp.plugin.config.MaxTotalCacheSize),
+	)
+}
+
 func (tp *taskPlugin) BuildSandbox(sandboxBuilder engines.SandboxBuilder) error {
 	// Wait for volumes to be populated
 	select {
@@ -329,8 +454,7 @@ func (tp *taskPlugin) BuildSandbox(sandboxBuilder engines.SandboxBuilder) error
 	var malformedPayloadErrors []runtime.MalformedPayloadError
 	for i, entry := range tp.payloadEntries {
 		volume := tp.cacheHandles[i].Resource().(*cacheVolume).Volume
-		readOnly := entry.Name == ""
-		err := sandboxBuilder.AttachVolume(entry.MountPoint, volume, readOnly)
+		err := sandboxBuilder.AttachVolume(entry.MountPoint, volume, entry.IsReadOnly())
 
 		// Handle potential errors
 		switch err {
@@ -347,7 +471,7 @@ func (tp *taskPlugin) BuildSandbox(sandboxBuilder engines.SandboxBuilder) error
 				"omit the cache 'name' property to make the cache read-only")
 		case engines.ErrImmutableMountNotSupported:
 			err = runtime.NewMalformedPayloadError("this workerType doesn't support read-only caches, " +
-				"you must specify a cache 'name' property to make the cache read-write")
+				"you must specify a cache 'name' property and omit 'readOnly' to make the cache read-write")
 		case engines.ErrNamingConflict:
 			err = runtime.NewMalformedPayloadError(fmt.Sprintf(
 				"cache mountPoint '%s' is already in use", entry.MountPoint,
@@ -379,13 +503,6 @@ func (tp *taskPlugin) BuildSandbox(sandboxBuilder engines.SandboxBuilder) error
 
 func (tp *taskPlugin) Dispose() error {
 	tp.cachesReady.Wait()
-	tp.cachesDisposed.Do(func() {
-		for i, handle := range tp.cacheHandles {
-			if handle != nil {
-				handle.Release()
-			}
-			tp.cacheHandles[i] = nil
-		}
-	})
+	tp.cachesDisposed.Do(tp.releaseCaches)
 	return nil
 }
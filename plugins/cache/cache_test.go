@@ -299,6 +299,29 @@ func TestCacheScopeRequired(t *testing.T) {
 				Exception:       runtime.ReasonMalformedPayload,
 				Success:         false,
 			},
+			{
+				Title:  "Read-only access requires scope",
+				Scopes: []string{"worker:cache:dummy-garbage-wrong-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "read-volume",
+					"argument": "my-mount-point/my-folder/my-file.txt",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "my-mount-point",
+							"options": {},
+							"readOnly": true
+						}
+					]
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("worker:cache:dummy-garbage-my-cache-name"),
+				},
+				AllowAdditional: true,
+				Exception:       runtime.ReasonMalformedPayload,
+				Success:         false,
+			},
 			{
 				Title:  "Access with star-scope",
 				Scopes: []string{"worker:cache:dummy-garbage-my-cache-*"},
@@ -456,3 +479,203 @@ func TestPurgeCache(t *testing.T) {
 		},
 	}.TestWithFakeQueue(t) // TODO: Resolve scope issues and test against real queue
 }
+
+func TestCacheSizeLimit(t *testing.T) {
+	workertest.Case{
+		Concurrency:  0, // runs tasks sequentially
+		Engine:       "mock",
+		EngineConfig: `{}`,
+		PluginConfig: `{
+			"disabled": [],
+			"success": {},
+			"livelog": {},
+			"cache": {
+				"maxCacheSize": 5
+			}
+		}`,
+		Tasks: []workertest.Task{
+			{
+				Title:  "Write hello-world to empty cache volume",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "write-volume",
+					"argument": "my-mount-point/my-folder/my-file.txt:hello-world",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "my-mount-point",
+							"options": {}
+						}
+					]
+				}`,
+				AllowAdditional: true,
+				Success:         true,
+			},
+			{
+				Title:  "Read from cache volume exceeding size limit",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "read-volume",
+					"argument": "some-mount-point/my-folder/my-file.txt",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "some-mount-point",
+							"options": {}
+						}
+					]
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.NotGrepArtifact("hello-world"),
+				},
+				AllowAdditional: true,
+				Success:         false,
+			},
+		},
+	}.TestWithFakeQueue(t)
+}
+
+func TestReadOnlyNamedCache(t *testing.T) {
+	workertest.Case{
+		Concurrency:  0, // runs tasks sequentially
+		Engine:       "mock",
+		EngineConfig: `{}`,
+		PluginConfig: testPluginConfig,
+		Tasks: []workertest.Task{
+			{
+				Title:  "Write hello-world to empty cache volume",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "write-volume",
+					"argument": "my-mount-point/my-folder/my-file.txt:hello-world",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "my-mount-point",
+							"options": {}
+						}
+					]
+				}`,
+				AllowAdditional: true,
+				Success:         true,
+			},
+			{
+				Title:  "Read from cache volume mounted read-only",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "read-volume",
+					"argument": "some-mount-point/my-folder/my-file.txt",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "some-mount-point",
+							"options": {},
+							"readOnly": true
+						}
+					]
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("hello-world"),
+				},
+				AllowAdditional: true,
+				Success:         true,
+			},
+			{
+				Title:  "Write to cache volume mounted read-only fails",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "write-volume",
+					"argument": "my-mount-point/my-folder/my-file.txt:hello-world",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "my-mount-point",
+							"options": {},
+							"readOnly": true
+						}
+					]
+				}`,
+				AllowAdditional: true,
+				Success:         false,
+			},
+		},
+	}.TestWithFakeQueue(t)
+}
+
+func TestCacheEngineOptions(t *testing.T) {
+	workertest.Case{
+		Concurrency:  0, // runs tasks sequentially
+		Engine:       "mock",
+		EngineConfig: `{}`,
+		PluginConfig: testPluginConfig,
+		Tasks: []workertest.Task{
+			{
+				Title:  "Write with options for other engines",
+				Scopes: []string{"worker:cache:dummy-garbage-engine-options"},
+				Payload: `{
+					"delay": 5,
+					"function": "write-volume",
+					"argument": "my-mount-point/my-file.txt:hello-world",
+					"caches": [
+						{
+							"name": "dummy-garbage-engine-options",
+							"mountPoint": "my-mount-point",
+							"engineOptions": {
+								"docker": {"driver": "local"},
+								"mock": {}
+							}
+						}
+					]
+				}`,
+				AllowAdditional: true,
+				Success:         true,
+			},
+			{
+				Title:  "Read without options",
+				Scopes: []string{"worker:cache:dummy-garbage-engine-options"},
+				Payload: `{
+					"delay": 5,
+					"function": "read-volume",
+					"argument": "my-mount-point/my-file.txt",
+					"caches": [
+						{
+							"name": "dummy-garbage-engine-options",
+							"mountPoint": "my-mount-point"
+						}
+					]
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("hello-world"),
+				},
+				AllowAdditional: true,
+				Success:         true,
+			},
+			{
+				Title:  "Invalid options for the engine",
+				Scopes: []string{"worker:cache:dummy-garbage-engine-options"},
+				Payload: `{
+					"delay": 5,
+					"function": "true",
+					"argument": "whatever",
+					"caches": [
+						{
+							"name": "dummy-garbage-engine-options",
+							"mountPoint": "my-mount-point",
+							"engineOptions": {
+								"mock": {"driver": "local"}
+							}
+						}
+					]
+				}`,
+				AllowAdditional: true,
+				Exception:       runtime.ReasonMalformedPayload,
+				Success:         false,
+			},
+		},
+	}.Test(t)
+}
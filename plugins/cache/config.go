@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"math"
 	"time"
 
 	schematypes "github.com/taskcluster/go-schematypes"
@@ -10,6 +11,8 @@ import (
 type config struct {
 	MaxPurgeCacheDelay time.Duration `json:"maxPurgeCacheDelay"`
 	PurgeCacheBaseURL  string        `json:"purgeCacheBaseUrl"`
+	MaxCacheSize       int64         `json:"maxCacheSize"`
+	MaxTotalCacheSize  int64         `json:"maxTotalCacheSize"`
 }
 
 var configSchema = schematypes.Object{
@@ -42,5 +45,30 @@ var configSchema = schematypes.Object{
 				You do not need to set this in production.
 			`),
 		},
+		"maxCacheSize": schematypes.Integer{
+			Title: "Maximum Size per Cache",
+			Description: util.Markdown(`
+				Maximum disk space in bytes any named cache may use, if exceeded
+				idle volumes for the cache are purged in least-recently-used order.
+				This is enforced when tasks using the cache is resolved.
+
+				Only applies if the engine can report disk usage for volumes,
+				defaults to zero, meaning no limit.
+			`),
+			Minimum: 0,
+			Maximum: math.MaxInt64,
+		},
+		"maxTotalCacheSize": schematypes.Integer{
+			Title: "Maximum Total Cache Size",
+			Description: util.Markdown(`
+				Maximum disk space in bytes all named caches may use combined, if
+				exceeded idle volumes are purged in least-recently-used order.
+
+				Only applies if the engine can report disk usage for volumes,
+				defaults to zero, meaning no limit.
+			`),
+			Minimum: 0,
+			Maximum: math.MaxInt64,
+		},
 	},
 }
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/caching"
+	"github.com/taskcluster/taskcluster-worker/runtime/cas"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
 	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
 )
@@ -24,14 +26,32 @@ type cacheOptions struct {
 }
 
 type preloadFetchContext struct {
-	caching.Context
+	context.Context
+	progress           caching.Context
 	InitialTaskContext *runtime.TaskContext
 }
 
+func (c *preloadFetchContext) Progress(description string, percent float64) {
+	c.progress.Progress(description, percent)
+}
+
 func (c *preloadFetchContext) Queue() client.Queue {
 	return c.InitialTaskContext.Queue()
 }
 
+// contextReader is an io.Reader that fails with ctx.Err() once ctx is canceled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
 type progressContext struct {
 	*runtime.TaskContext
 	Name string
@@ -73,10 +93,32 @@ func constructor(ctx caching.Context, opts interface{}) (caching.Resource, error
 			Volume:  volume,
 			Name:    options.Name,
 			Created: created,
+			stats:   options.Plugin.stats,
 		}, nil
 	}
 	// the rest of this function deals with creating a pre-loaded cache
 
+	// Register pre-loading as in-flight operation, so garbage collection waits,
+	// and abort pre-loading if in-flight operations are canceled
+	op := options.Plugin.environment.Operations.Begin("cache-preload")
+	defer op.Done()
+	opCtx, cancel := op.WithContext(ctx)
+	defer cancel()
+
+	// Restore pre-load data from a snapshot in the content store, if we have one
+	store := preloadSnapshotStore(options)
+	if store != nil {
+		if volume := restorePreloadSnapshot(store, options); volume != nil {
+			ctx.Progress("Restored cache pre-load data from snapshot", 1)
+			return &cacheVolume{
+				Volume:  volume,
+				Name:    options.Name,
+				Created: created,
+				stats:   options.Plugin.stats,
+			}, nil
+		}
+	}
+
 	// Fetch pre-load data to temporary file
 	file, err := options.Plugin.environment.TemporaryStorage.NewFile()
 	if err != nil {
@@ -84,7 +126,8 @@ func constructor(ctx caching.Context, opts interface{}) (caching.Resource, error
 	}
 	defer file.Close() // remove the temporary file whatever happens
 	err = options.Reference.Fetch(&preloadFetchContext{
-		Context:            ctx,
+		Context:            opCtx,
+		progress:           ctx,
 		InitialTaskContext: options.InitialTaskContext,
 	}, &fetcher.FileReseter{File: file})
 	if err != nil {
@@ -92,6 +135,8 @@ func constructor(ctx caching.Context, opts interface{}) (caching.Resource, error
 			err = runtime.NewMalformedPayloadError(fmt.Sprintf(
 				"cache pre-loading error: %s", err.Error(),
 			))
+		} else if fetcher.IsUnavailableError(err) {
+			err = runtime.NewInfrastructureError("cache pre-loading error: ", err)
 		} else {
 			err = errors.Wrap(err, "failed to fetch cache preload data")
 		}
@@ -117,13 +162,34 @@ func constructor(ctx caching.Context, opts interface{}) (caching.Resource, error
 		return nil, errors.Wrap(err, "failed to create VolumeBuilder for a pre-loaded cache")
 	}
 
+	// Record a snapshot of the pre-load data while extracting, if we have a
+	// content store, so it doesn't have to be fetched again
+	var target fileSystem = volumeBuilder
+	var snapshot *cas.SnapshotBuilder
+	if store != nil {
+		if snapshot, err = store.NewSnapshot(); err != nil {
+			options.Plugin.monitor.ReportWarning(err, "failed to create snapshot of cache pre-load data")
+			snapshot = nil
+		} else {
+			target = &snapshotFileSystem{fileSystem: volumeBuilder, snapshot: snapshot}
+		}
+	}
+
 	// Extract the pre-load archive
-	if err = extractArchive(file, volumeBuilder); err != nil {
+	if err = extractArchive(&contextReader{ctx: opCtx, r: file}, target); err != nil {
 		if verr := volumeBuilder.Discard(); verr != nil {
 			options.Plugin.monitor.ReportError(verr, "VolumeBuilder.Discard() failed, after failed archive extraction")
 		}
+		if snapshot != nil {
+			snapshot.Discard()
+		}
 		return nil, err
 	}
+	if snapshot != nil {
+		if err = snapshot.Commit(options.ReferenceHash); err != nil {
+			options.Plugin.monitor.ReportWarning(err, "failed to store snapshot of cache pre-load data")
+		}
+	}
 
 	// Build the volume
 	volume, err := volumeBuilder.BuildVolume()
@@ -135,5 +201,6 @@ func constructor(ctx caching.Context, opts interface{}) (caching.Resource, error
 		Volume:  volume,
 		Name:    options.Name,
 		Created: created,
+		stats:   options.Plugin.stats,
 	}, nil
 }
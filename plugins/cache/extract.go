@@ -3,6 +3,8 @@ package cache
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 
@@ -17,6 +19,9 @@ type fileSystem interface {
 	WriteFile(name string) io.WriteCloser
 }
 
+// gzipMagic is the header of gzip compressed data, see RFC 1952
+var gzipMagic = []byte{0x1f, 0x8b}
+
 // extractArchive detects archive type from source and extracts to target
 // If this fails due to archive format then it returns MalformedPayloadError
 func extractArchive(source io.Reader, target fileSystem) error {
@@ -24,13 +29,35 @@ func extractArchive(source io.Reader, target fileSystem) error {
 	br := bufio.NewReaderSize(source, 4096)
 	head, _ := br.Peek(512)
 
+	// Wrap reader, so we can detect internal input errors, vs. archive errors
+	ebr := errorCapturingReader{Reader: br}
+	var r io.Reader = &ebr
+
+	// If gzip compressed, we decompress and detect archive type again
+	if bytes.HasPrefix(head, gzipMagic) {
+		zr, err := gzip.NewReader(&ebr)
+		if ebr.Err != nil {
+			return errors.Wrap(ebr.Err, "error reading from buffered archive")
+		}
+		if err != nil {
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"error reading gzip compressed data: %s", err.Error(),
+			))
+		}
+		zbr := bufio.NewReaderSize(zr, 4096)
+		head, _ = zbr.Peek(512)
+		if ebr.Err != nil {
+			return errors.Wrap(ebr.Err, "error reading from buffered archive")
+		}
+		r = zbr
+	}
+
 	// If not a TAR archive we return a MalformedPayloadError
 	// TODO: support other archive formats:
 	//        golang.org/pkg/archive/zip
 	//        github.com/nwaples/rardecode
 	//        github.com/mkrautz/goar
 	// TODO: support decompression from:
-	//        golang.org/pkg/compress/gzip/
 	//        golang.org/pkg/compress/bzip2/
 	//        github.com/DataDog/zstd
 	//        github.com/MediaMath/go-lzop
@@ -39,18 +66,16 @@ func extractArchive(source io.Reader, target fileSystem) error {
 		kind, _ := filetype.Match(head)
 		if kind.MIME.Value == "" {
 			return runtime.NewMalformedPayloadError(
-				"unable to detect cache preload data format, try TAR archives instead",
+				"unable to detect cache preload data format, try TAR or gzipped TAR archives instead",
 			)
 		}
 		return runtime.NewMalformedPayloadError(fmt.Sprintf(
-			"caches cannot be pre-loaded with '%s', try TAR archives instead",
+			"caches cannot be pre-loaded with '%s', try TAR or gzipped TAR archives instead",
 			kind.MIME.Value,
 		))
 	}
 
-	// Wrap reader, so we can detect internal input errors, vs. tar-ball errors
-	ebr := errorCapturingReader{Reader: br}
-	tr := tar.NewReader(&ebr)
+	tr := tar.NewReader(r)
 
 	// Extract tar-ball
 	for {
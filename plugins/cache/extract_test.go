@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// memoryFileSystem implements fileSystem recording files in memory
+type memoryFileSystem struct {
+	folders []string
+	files   map[string]*bytes.Buffer
+}
+
+type nopCloseBuffer struct {
+	*bytes.Buffer
+}
+
+func (nopCloseBuffer) Close() error { return nil }
+
+func (fs *memoryFileSystem) WriteFolder(name string) error {
+	fs.folders = append(fs.folders, name)
+	return nil
+}
+
+func (fs *memoryFileSystem) WriteFile(name string) io.WriteCloser {
+	if fs.files == nil {
+		fs.files = make(map[string]*bytes.Buffer)
+	}
+	fs.files[name] = bytes.NewBuffer(nil)
+	return nopCloseBuffer{fs.files[name]}
+}
+
+func makeTarArchive(t *testing.T, name, text string) []byte {
+	buf := bytes.NewBuffer(nil)
+	a := tar.NewWriter(buf)
+	err := a.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0777,
+		Size: int64(len(text)),
+	})
+	require.NoError(t, err, "failed to create file header in tar archive")
+	_, err = a.Write([]byte(text))
+	require.NoError(t, err, "failed to write file body in tar archive")
+	require.NoError(t, a.Close(), "failed to create tar archive")
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	rawtar := makeTarArchive(t, "min-mappe/min-fil.txt", "hej verden")
+
+	t.Run("tar", func(t *testing.T) {
+		fs := &memoryFileSystem{}
+		require.NoError(t, extractArchive(bytes.NewReader(rawtar), fs))
+		require.Contains(t, fs.files, "min-mappe/min-fil.txt")
+		require.Equal(t, "hej verden", fs.files["min-mappe/min-fil.txt"].String())
+	})
+
+	t.Run("tar.gz", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		zw := gzip.NewWriter(buf)
+		_, err := zw.Write(rawtar)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		fs := &memoryFileSystem{}
+		require.NoError(t, extractArchive(buf, fs))
+		require.Contains(t, fs.files, "min-mappe/min-fil.txt")
+		require.Equal(t, "hej verden", fs.files["min-mappe/min-fil.txt"].String())
+	})
+
+	t.Run("corrupt gzip", func(t *testing.T) {
+		data := append([]byte{}, gzipMagic...)
+		data = append(data, []byte("not really gzip data")...)
+		err := extractArchive(bytes.NewReader(data), &memoryFileSystem{})
+		_, ok := runtime.IsMalformedPayloadError(err)
+		require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		err := extractArchive(bytes.NewReader([]byte("hello world")), &memoryFileSystem{})
+		_, ok := runtime.IsMalformedPayloadError(err)
+		require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+	})
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime/cas"
+)
+
+// snapshotPreloadPattern matches the HashKey() of references from
+// preloadFetcher that always refer to the same data, that is artifacts from a
+// specific run and URLs with a hash. Snapshots of pre-load data is only stored
+// for such references, as data from a URL or index may change.
+var snapshotPreloadPattern = regexp.MustCompile(`^(?:1:[^/]+/[0-9]+/.+|3:(?:sha256|sha512)=[0-9a-f]+)$`)
+
+// preloadSnapshotStore returns the content store in which snapshots of
+// pre-load data should be stored, nil if no snapshot should be stored.
+func preloadSnapshotStore(options cacheOptions) *cas.Store {
+	if !snapshotPreloadPattern.MatchString(options.ReferenceHash) {
+		return nil
+	}
+	return options.Plugin.environment.ContentStore
+}
+
+// restorePreloadSnapshot returns a volume with pre-load data restored from a
+// snapshot in store, or nil if no snapshot could be restored.
+func restorePreloadSnapshot(store *cas.Store, options cacheOptions) engines.Volume {
+	if !store.HasSnapshot(options.ReferenceHash) {
+		return nil
+	}
+	volumeBuilder, err := options.Plugin.engine.NewVolumeBuilder(options.Options)
+	if err != nil {
+		return nil // engine errors are reported when pre-load data is fetched
+	}
+	ok, err := store.RestoreSnapshot(options.ReferenceHash, volumeBuilder)
+	if err != nil || !ok {
+		if verr := volumeBuilder.Discard(); verr != nil {
+			options.Plugin.monitor.ReportError(verr, "VolumeBuilder.Discard() failed, after failed snapshot restore")
+		}
+		if err != nil {
+			options.Plugin.monitor.ReportWarning(err, "failed to restore snapshot of cache pre-load data, removing it")
+			if err = store.RemoveSnapshot(options.ReferenceHash); err != nil {
+				options.Plugin.monitor.ReportWarning(err, "failed to remove snapshot of cache pre-load data")
+			}
+		}
+		return nil
+	}
+	volume, err := volumeBuilder.BuildVolume()
+	if err != nil {
+		options.Plugin.monitor.ReportWarning(err, "VolumeBuilder.BuildVolume() failed, after restoring snapshot")
+		return nil
+	}
+	debug("restored cache pre-load data for '%s' from snapshot", options.ReferenceHash)
+	return volume
+}
+
+// snapshotFileSystem writes to a fileSystem and a SnapshotBuilder, errors from
+// the SnapshotBuilder are ignored here, as they're returned by Commit().
+type snapshotFileSystem struct {
+	fileSystem
+	snapshot *cas.SnapshotBuilder
+}
+
+func (fs *snapshotFileSystem) WriteFolder(name string) error {
+	fs.snapshot.WriteFolder(name)
+	return fs.fileSystem.WriteFolder(name)
+}
+
+func (fs *snapshotFileSystem) WriteFile(name string) io.WriteCloser {
+	return &snapshotFile{
+		WriteCloser: fs.fileSystem.WriteFile(name),
+		snapshot:    fs.snapshot.WriteFile(name),
+	}
+}
+
+type snapshotFile struct {
+	io.WriteCloser
+	snapshot io.WriteCloser
+}
+
+func (f *snapshotFile) Write(p []byte) (int, error) {
+	f.snapshot.Write(p)
+	return f.WriteCloser.Write(p)
+}
+
+func (f *snapshotFile) Close() error {
+	f.snapshot.Close()
+	return f.WriteCloser.Close()
+}
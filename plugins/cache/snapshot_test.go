@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/cas"
+)
+
+func TestSnapshotPreloadPattern(t *testing.T) {
+	for hashKey, snapshot := range map[string]bool{
+		"1:H6SAIKUFT2mewKH-qHzXjQ/0/public/cache.tar.gz":                            true,
+		"3:sha256=b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9": true,
+		"0:https://example.com/cache.tar.gz":                                        false,
+		"2:garbage.my-project.latest/public/cache.tar.gz":                           false,
+		"3:sha256=B94D27B9934D3E08A52E52D7DA7DABFAC484EFE37A5380EE9088F7ACE2EFCDE9": false,
+		"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9":          false,
+		"": false,
+		"1:H6SAIKUFT2mewKH-qHzXjQ/latest/public/cache.tar.gz":                               false,
+		"3:sha512=b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9b94d27b9": true,
+	} {
+		require.Equal(t, snapshot, snapshotPreloadPattern.MatchString(hashKey), "unexpected result for '%s'", hashKey)
+	}
+}
+
+func TestSnapshotFileSystem(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cache-snapshot-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	store, err := cas.New(folder)
+	require.NoError(t, err)
+
+	// Extract an archive while recording a snapshot
+	rawtar := makeTarArchive(t, "min-mappe/min-fil.txt", "hej verden")
+	snapshot, err := store.NewSnapshot()
+	require.NoError(t, err)
+	fs := &memoryFileSystem{}
+	require.NoError(t, extractArchive(bytes.NewReader(rawtar), &snapshotFileSystem{
+		fileSystem: fs,
+		snapshot:   snapshot,
+	}))
+	require.NoError(t, snapshot.Commit("1:my-task/0/public/cache.tar"))
+	require.Equal(t, "hej verden", fs.files["min-mappe/min-fil.txt"].String())
+
+	// Restore the snapshot
+	restored := &memoryFileSystem{}
+	ok, err := store.RestoreSnapshot("1:my-task/0/public/cache.tar", restored)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, fs.folders, restored.folders)
+	require.Len(t, restored.files, 1)
+	require.Equal(t, "hej verden", restored.files["min-mappe/min-fil.txt"].String())
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/caching"
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
+)
+
+// cacheStats holds usage statistics for a named cache
+type cacheStats struct {
+	Name     string    `json:"name"`
+	Hits     int       `json:"hits"`
+	Misses   int       `json:"misses"`
+	DiskSize uint64    `json:"diskSize"`
+	LastUsed time.Time `json:"lastUsed"`
+	volumes  int       // number of volumes that have been used
+}
+
+// statsTracker tracks usage of named caches and the volumes backing them,
+// statistics for a cache are discarded when all its volumes are disposed.
+//
+// Totals are also exposed as metrics on the worker admin endpoint, these are
+// not labeled by cache name, as names are chosen by tasks.
+type statsTracker struct {
+	m        sync.Mutex
+	monitor  runtime.Monitor
+	stats    map[string]*cacheStats
+	hits     *metrics.Counter
+	misses   *metrics.Counter
+	diskSize *metrics.Gauge
+}
+
+func newStatsTracker(monitor runtime.Monitor, r *metrics.Registry) *statsTracker {
+	return &statsTracker{
+		monitor: monitor,
+		stats:   make(map[string]*cacheStats),
+		hits: r.Counter(
+			"taskcluster_worker_cache_hits_total",
+			"Number of times a named cache was reused.",
+		),
+		misses: r.Counter(
+			"taskcluster_worker_cache_misses_total",
+			"Number of times a named cache was created empty.",
+		),
+		diskSize: r.Gauge(
+			"taskcluster_worker_cache_disk_size_bytes",
+			"Disk space used by volumes of named caches.",
+		),
+	}
+}
+
+// get returns stats for name, must be called with s.m locked
+func (s *statsTracker) get(name string) *cacheStats {
+	c, ok := s.stats[name]
+	if !ok {
+		c = &cacheStats{Name: name}
+		s.stats[name] = c
+	}
+	return c
+}
+
+// Acquired records that volume have been taken for use by a task, returns
+// true if this was a cache hit.
+func (s *statsTracker) Acquired(volume *cacheVolume) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	hit := volume.uses > 0
+	volume.uses++
+	volume.inUse++
+	volume.lastUsed = time.Now()
+
+	if volume.Name == "" {
+		return hit
+	}
+	c := s.get(volume.Name)
+	c.LastUsed = volume.lastUsed
+	if hit {
+		c.Hits++
+		s.hits.Inc()
+		s.monitor.Count("hits", 1)
+	} else {
+		c.Misses++
+		c.volumes++
+		s.misses.Inc()
+		s.monitor.Count("misses", 1)
+	}
+	return hit
+}
+
+// Released records that volume is no longer used by a task
+func (s *statsTracker) Released(volume *cacheVolume) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	volume.inUse--
+	volume.lastUsed = time.Now()
+	if volume.Name != "" {
+		s.get(volume.Name).LastUsed = volume.lastUsed
+	}
+}
+
+// Disposed records that volume has been disposed, statistics for the cache
+// are discarded once all volumes used for it have been disposed.
+func (s *statsTracker) Disposed(volume *cacheVolume) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if volume.Name == "" || volume.uses == 0 {
+		return
+	}
+	c, ok := s.stats[volume.Name]
+	if !ok {
+		return
+	}
+	c.volumes--
+	if c.volumes <= 0 {
+		delete(s.stats, volume.Name)
+	}
+}
+
+// Snapshot returns a copy of the current statistics sorted by name
+func (s *statsTracker) Snapshot() []cacheStats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	result := make([]cacheStats, 0, len(s.stats))
+	for _, c := range s.stats {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Enforce updates disk usage statistics for named caches in cache, and purges
+// idle volumes in least-recently-used order until the per-cache limit and
+// total limit is satisfied. A limit of zero means no limit.
+func (s *statsTracker) Enforce(cache *caching.Cache, maxCacheSize, maxTotalSize uint64) {
+	// Collect volumes without purging anything
+	var volumes []*cacheVolume
+	cache.Purge(func(r caching.Resource) bool {
+		volumes = append(volumes, r.(*cacheVolume))
+		return false
+	})
+
+	s.m.Lock()
+
+	// Find sizes of all volumes
+	sizes := make(map[*cacheVolume]uint64, len(volumes))
+	perCache := make(map[string]uint64)
+	var total uint64
+	for _, v := range volumes {
+		size, err := v.DiskSize()
+		if err != nil {
+			continue // ignore volumes whose size we can't determine
+		}
+		sizes[v] = size
+		perCache[v.Name] += size
+		total += size
+	}
+	for name, c := range s.stats {
+		c.DiskSize = perCache[name]
+	}
+	s.diskSize.Set(float64(total))
+	s.monitor.Measure("disk-size", float64(total))
+
+	// Sort idle volumes by last use, so we evict least-recently-used first
+	var idle []*cacheVolume
+	for _, v := range volumes {
+		if _, ok := sizes[v]; ok && v.inUse == 0 {
+			idle = append(idle, v)
+		}
+	}
+	sort.Slice(idle, func(i, j int) bool {
+		return idle[i].lastUsed.Before(idle[j].lastUsed)
+	})
+
+	evict := make(map[*cacheVolume]bool)
+	for _, v := range idle {
+		overCache := maxCacheSize != 0 && perCache[v.Name] > maxCacheSize
+		overTotal := maxTotalSize != 0 && total > maxTotalSize
+		if !overCache && !overTotal {
+			continue
+		}
+		evict[v] = true
+		perCache[v.Name] -= sizes[v]
+		total -= sizes[v]
+		if c, ok := s.stats[v.Name]; ok {
+			c.DiskSize = perCache[v.Name]
+		}
+		s.diskSize.Set(float64(total))
+		s.monitor.Infof("evicting cache: '%s' with size: %d bytes", v.Name, sizes[v])
+		s.monitor.Count("evictions", 1)
+	}
+	s.m.Unlock()
+
+	if len(evict) > 0 {
+		err := cache.Purge(func(r caching.Resource) bool {
+			return evict[r.(*cacheVolume)]
+		})
+		if err != nil {
+			s.monitor.ReportError(err, "failed to evict caches exceeding size limits")
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestStatsTrackerMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	s := newStatsTracker(mocks.NewMockMonitor(true), r)
+
+	v := &cacheVolume{Name: "my-cache"}
+	require.False(t, s.Acquired(v))
+	s.Released(v)
+	require.True(t, s.Acquired(v))
+	s.Released(v)
+
+	var b bytes.Buffer
+	require.NoError(t, r.Collect(&b))
+	require.Contains(t, b.String(), "taskcluster_worker_cache_hits_total 1")
+	require.Contains(t, b.String(), "taskcluster_worker_cache_misses_total 1")
+	require.NotContains(t, b.String(), "my-cache", "cache names are chosen by tasks")
+	require.Equal(t, []cacheStats{{
+		Name: "my-cache", Hits: 1, Misses: 1, LastUsed: v.lastUsed, volumes: 1,
+	}}, s.Snapshot())
+
+	// Statistics are discarded when all volumes for the cache are disposed
+	v2 := &cacheVolume{Name: "my-cache"}
+	require.False(t, s.Acquired(v2))
+	s.Released(v2)
+	s.Disposed(v)
+	require.Len(t, s.Snapshot(), 1)
+	s.Disposed(v2)
+	require.Len(t, s.Snapshot(), 0)
+}
@@ -14,6 +14,11 @@ type cacheVolume struct {
 	Name     string
 	Created  time.Time
 	disposed atomics.Once
+	stats    *statsTracker // notified when disposed, may be nil
+	// Usage tracking, protected by statsTracker
+	uses     int
+	inUse    int
+	lastUsed time.Time
 }
 
 func (v *cacheVolume) MemorySize() (uint64, error) {
@@ -22,14 +27,20 @@ func (v *cacheVolume) MemorySize() (uint64, error) {
 }
 
 func (v *cacheVolume) DiskSize() (uint64, error) {
-	// TODO: Add disk size support to cache volumes
-	return 0, caching.ErrDisposableSizeNotSupported
+	size, err := v.Volume.DiskSize()
+	if err == engines.ErrFeatureNotSupported {
+		return 0, caching.ErrDisposableSizeNotSupported
+	}
+	return size, err
 }
 
 func (v *cacheVolume) Dispose() error {
 	var err error
 	v.disposed.Do(func() {
 		err = v.Volume.Dispose()
+		if v.stats != nil {
+			v.stats.Disposed(v)
+		}
 	})
 	return err
 }
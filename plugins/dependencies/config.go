@@ -0,0 +1,21 @@
+package dependencies
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+var configSchema = schematypes.Object{
+	Title: "Dependencies Plugin",
+	Description: util.Markdown(`
+		The dependencies plugin verifies that artifacts referenced in
+		'task.payload' from tasks listed in 'task.dependencies' exist and are
+		unexpired, before the task is executed.
+
+		Artifacts are referenced as objects with 'taskId', 'artifact' and
+		optionally 'runId' properties, such as images or cache preloads. If a
+		referenced artifact is missing, the task is resolved 'malformed-payload'
+		with an error explaining which artifact is missing, instead of failing
+		when the artifact is fetched.
+	`),
+}
@@ -0,0 +1,193 @@
+package dependencies
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+)
+
+type provider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	monitor    runtime.Monitor
+	context    *runtime.TaskContext
+	clockSkew  time.Duration
+	references []artifactReference
+}
+
+// artifactReference is an artifact referenced in task.payload
+type artifactReference struct {
+	TaskID   string
+	RunID    int // -1, if not specified
+	Artifact string
+}
+
+func (r artifactReference) String() string {
+	if r.RunID == -1 {
+		return fmt.Sprintf("'%s' from dependency task %s", r.Artifact, r.TaskID)
+	}
+	return fmt.Sprintf("'%s' from run %d of dependency task %s", r.Artifact, r.RunID, r.TaskID)
+}
+
+func init() {
+	plugins.Register("dependencies", provider{})
+}
+
+func (provider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
+func (provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, error) {
+	schematypes.MustValidate(configSchema, options.Config)
+	return &plugin{}, nil
+}
+
+func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	var dependencies []string
+	if task, ok := options.TaskInfo.Task.(map[string]interface{}); ok {
+		if deps, ok := task["dependencies"].([]interface{}); ok {
+			for _, d := range deps {
+				if taskID, ok := d.(string); ok {
+					dependencies = append(dependencies, taskID)
+				}
+			}
+		}
+	}
+
+	references := findReferences(options.TaskPayload, dependencies)
+	if len(references) == 0 {
+		return plugins.TaskPluginBase{}, nil
+	}
+	return &taskPlugin{
+		monitor:    options.Monitor,
+		context:    options.TaskContext,
+		clockSkew:  options.TaskInfo.ClockSkew,
+		references: references,
+	}, nil
+}
+
+// findReferences returns artifact references in value from tasks in
+// dependencies, an artifact reference is an object with 'taskId' and
+// 'artifact' properties, and an optional 'runId' property.
+func findReferences(value interface{}, dependencies []string) []artifactReference {
+	var refs []artifactReference
+	switch v := value.(type) {
+	case map[string]interface{}:
+		taskID, _ := v["taskId"].(string)
+		artifact, _ := v["artifact"].(string)
+		if taskID != "" && artifact != "" && contains(dependencies, taskID) {
+			ref := artifactReference{TaskID: taskID, RunID: -1, Artifact: artifact}
+			if runID, ok := v["runId"].(float64); ok {
+				ref.RunID = int(runID)
+			}
+			refs = append(refs, ref)
+		}
+		for _, val := range v {
+			refs = append(refs, findReferences(val, dependencies)...)
+		}
+	case []interface{}:
+		for _, val := range v {
+			refs = append(refs, findReferences(val, dependencies)...)
+		}
+	}
+	return refs
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (tp *taskPlugin) BuildSandbox(engines.SandboxBuilder) error {
+	var errs []runtime.MalformedPayloadError
+	for _, ref := range tp.references {
+		err := checkArtifact(tp.context.Queue(), ref, time.Now().Add(tp.clockSkew))
+		if e, ok := runtime.IsMalformedPayloadError(err); ok {
+			errs = append(errs, e)
+		} else if err != nil {
+			// If we can't check the artifact, we let the task fail when it's fetched
+			tp.monitor.ReportWarning(err, "failed to check artifact from dependency task")
+		}
+	}
+	if len(errs) > 0 {
+		return runtime.MergeMalformedPayload(errs...)
+	}
+	return nil
+}
+
+// checkArtifact returns a MalformedPayloadError, if ref doesn't exist or has
+// expired, now must be in queue time.
+func checkArtifact(q client.Queue, ref artifactReference, now time.Time) error {
+	// Find latest runId, if not specified
+	runID := ref.RunID
+	if runID == -1 {
+		result, err := q.Status(ref.TaskID)
+		if isNotFound(err) {
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"referenced artifact %s doesn't exist, the task doesn't exist", ref,
+			))
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch task status")
+		}
+		runID = len(result.Status.Runs) - 1
+	}
+
+	// List artifacts until we find the artifact
+	var continuationToken string
+	for {
+		debug("listing artifacts from %s/%d", ref.TaskID, runID)
+		result, err := q.ListArtifacts(ref.TaskID, strconv.Itoa(runID), continuationToken, "")
+		if isNotFound(err) {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to list artifacts")
+		}
+		for _, a := range result.Artifacts {
+			if a.Name != ref.Artifact {
+				continue
+			}
+			if expires := time.Time(a.Expires); expires.Before(now) {
+				return runtime.NewMalformedPayloadError(fmt.Sprintf(
+					"referenced artifact %s expired at %s", ref, expires.UTC().Format(time.RFC3339),
+				))
+			}
+			return nil
+		}
+		continuationToken = result.ContinuationToken
+		if continuationToken == "" {
+			break
+		}
+	}
+
+	return runtime.NewMalformedPayloadError(fmt.Sprintf(
+		"referenced artifact %s doesn't exist, dependency tasks must create all artifacts referenced in task.payload",
+		ref,
+	))
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(httpbackoff.BadHttpResponseCode)
+	return ok && e.HttpResponseCode == http.StatusNotFound
+}
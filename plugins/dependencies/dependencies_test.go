@@ -0,0 +1,92 @@
+package dependencies
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+)
+
+const (
+	dependencyID = "H6SAIKUFT2mewKH-qHzXjQ"
+	otherID      = "Vn8Q6HgCS0S5qW5tG2qB3A"
+)
+
+func TestFindReferences(t *testing.T) {
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"image": {"taskId": "`+dependencyID+`", "artifact": "public/image.tar.zst"},
+		"caches": [
+			{"mountPoint": "/a", "preload": {"taskId": "`+dependencyID+`", "runId": 1, "artifact": "public/a.tar"}},
+			{"mountPoint": "/b", "preload": {"taskId": "`+otherID+`", "artifact": "public/b.tar"}}
+		]
+	}`), &payload))
+
+	refs := findReferences(payload, []string{dependencyID})
+	require.Len(t, refs, 2)
+	require.Contains(t, refs, artifactReference{TaskID: dependencyID, RunID: -1, Artifact: "public/image.tar.zst"})
+	require.Contains(t, refs, artifactReference{TaskID: dependencyID, RunID: 1, Artifact: "public/a.tar"})
+
+	require.Empty(t, findReferences(payload, nil))
+}
+
+func unmarshal(t *testing.T, data string, v interface{}) {
+	require.NoError(t, json.Unmarshal([]byte(data), v))
+}
+
+func TestCheckArtifact(t *testing.T) {
+	now := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	var status queue.TaskStatusResponse
+	unmarshal(t, `{"status": {"runs": [{"runId": 0}, {"runId": 1}]}}`, &status)
+	var page1, page2 queue.ListArtifactsResponse
+	unmarshal(t, `{
+		"artifacts": [{"name": "public/a.tar", "expires": "2017-09-01T00:00:00.000Z"}],
+		"continuationToken": "next"
+	}`, &page1)
+	unmarshal(t, `{
+		"artifacts": [
+			{"name": "public/image.tar.zst", "expires": "2017-09-01T00:00:00.000Z"},
+			{"name": "public/old.tar", "expires": "2017-07-01T00:00:00.000Z"}
+		]
+	}`, &page2)
+
+	q := &client.MockQueue{}
+	q.On("Status", dependencyID).Return(&status, nil)
+	q.On("ListArtifacts", dependencyID, "1", "", "").Return(&page1, nil)
+	q.On("ListArtifacts", dependencyID, "1", "next", "").Return(&page2, nil)
+	q.On("ListArtifacts", dependencyID, "0", "", "").Return(
+		(*queue.ListArtifactsResponse)(nil), httpbackoff.BadHttpResponseCode{HttpResponseCode: http.StatusNotFound},
+	)
+
+	// Artifact on the second page of the latest run
+	err := checkArtifact(q, artifactReference{TaskID: dependencyID, RunID: -1, Artifact: "public/image.tar.zst"}, now)
+	require.NoError(t, err)
+
+	// Artifact in a specific run
+	err = checkArtifact(q, artifactReference{TaskID: dependencyID, RunID: 1, Artifact: "public/a.tar"}, now)
+	require.NoError(t, err)
+
+	// Expired artifact
+	err = checkArtifact(q, artifactReference{TaskID: dependencyID, RunID: 1, Artifact: "public/old.tar"}, now)
+	e, ok := runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+	require.Contains(t, e.Error(), "expired")
+
+	// Missing artifact
+	err = checkArtifact(q, artifactReference{TaskID: dependencyID, RunID: 1, Artifact: "public/missing.tar"}, now)
+	e, ok = runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+	require.Contains(t, e.Error(), "doesn't exist")
+
+	// Missing run
+	err = checkArtifact(q, artifactReference{TaskID: dependencyID, RunID: 0, Artifact: "public/a.tar"}, now)
+	_, ok = runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+}
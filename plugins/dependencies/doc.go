@@ -0,0 +1,8 @@
+// Package dependencies provides a plugin for taskcluster-worker that verifies
+// artifacts referenced from dependency tasks exist before the task is
+// executed.
+package dependencies
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("dependencies")
@@ -6,9 +6,18 @@
 // can be used to inject information such as instance type.
 //
 // Finally, this plugin will inject TASK_ID and RUN_ID as environment variables.
+//
+// Values in task.payload.env may also reference a secret on the form
+// {"$secret": "<name>", "key": "<property>"}, such secrets are read from the
+// secrets service using the task credentials, and redacted from the task log.
+//
+// When payload templating is enabled, this plugin also provides the payload
+// variable '${SECRET:<name>/<key>}', which is substituted with the property
+// key of the secret name in the same manner.
 package env
 
 import (
+	"fmt"
 	"strconv"
 
 	schematypes "github.com/taskcluster/go-schematypes"
@@ -18,13 +27,16 @@ import (
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
+var debug = util.Debug("env")
+
 type plugin struct {
 	plugins.PluginBase
 	extraVars map[string]string
+	rootURL   string
 }
 
 type payload struct {
-	Env map[string]string `json:"env"`
+	Env map[string]interface{} `json:"env"` // string or secretReference
 }
 
 type config struct {
@@ -38,6 +50,8 @@ type provider struct {
 type taskPlugin struct {
 	plugins.TaskPluginBase
 	variables map[string]string
+	secrets   map[string]secretReference
+	reader    *secretReader
 }
 
 func init() {
@@ -71,6 +85,7 @@ func (p *provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, err
 
 	return &plugin{
 		extraVars: c.Extra,
+		rootURL:   options.Environment.RootURL,
 	}, nil
 }
 
@@ -78,14 +93,47 @@ func (p *plugin) PayloadSchema() schematypes.Object {
 	return schematypes.Object{
 		Properties: schematypes.Properties{
 			"env": schematypes.Map{
-				Title:       "Environment Variables",
-				Description: "Mapping from environment variables to values",
-				Values:      schematypes.String{},
+				Title: "Environment Variables",
+				Description: util.Markdown(`
+					Mapping from environment variables to values, a value may be a
+					string or a reference to a property of a secret on the form
+					'{"$secret": "<name>", "key": "<property>"}'.
+				`),
+				Values: schematypes.OneOf{
+					schematypes.String{},
+					secretReferenceSchema,
+				},
 			},
 		},
 	}
 }
 
+func (p *plugin) PayloadVariables() map[string]plugins.PayloadVariable {
+	return map[string]plugins.PayloadVariable{
+		"SECRET": p.secretVariable,
+	}
+}
+
+// secretVariable resolves '${SECRET:<name>/<key>}' to the property key of the
+// secret name, read using the task credentials and redacted from the task log.
+func (p *plugin) secretVariable(options plugins.PayloadVariableOptions) (string, error) {
+	ref, ok := parseSecretPath(options.Argument)
+	if !ok {
+		return "", runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"'${SECRET:%s}' must reference a property of a secret, as in '${SECRET:<name>/<key>}'",
+			options.Argument,
+		))
+	}
+	r := &secretReader{
+		context: options.TaskContext,
+		client:  options.TaskContext.NewHTTPClient(runtime.HTTPClientOptions{}),
+		rootURL: p.rootURL,
+		source:  "task.payload",
+		cache:   make(map[string]map[string]interface{}),
+	}
+	return r.Resolve(ref)
+}
+
 func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
 	var P payload
 	schematypes.MustValidateAndMap(p.PayloadSchema(), options.Payload, &P)
@@ -101,16 +149,55 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskP
 		env[k] = v
 	}
 	// Set variables as configured per-task (overwriting globally config vars)
+	secrets := make(map[string]secretReference)
 	for k, v := range P.Env {
-		env[k] = v
+		if s, ok := v.(string); ok {
+			env[k] = s
+			continue
+		}
+		var ref secretReference
+		schematypes.MustValidateAndMap(secretReferenceSchema, v, &ref)
+		secrets[k] = ref
+		delete(env, k)
+	}
+
+	var reader *secretReader
+	if len(secrets) > 0 {
+		reader = &secretReader{
+			context: options.TaskContext,
+			client:  options.TaskContext.NewHTTPClient(runtime.HTTPClientOptions{}),
+			rootURL: p.rootURL,
+			source:  "task.payload.env",
+			cache:   make(map[string]map[string]interface{}),
+		}
 	}
 
 	return &taskPlugin{
 		variables: env,
+		secrets:   secrets,
+		reader:    reader,
 	}, nil
 }
 
 func (p *taskPlugin) BuildSandbox(sandboxBuilder engines.SandboxBuilder) error {
+	// Read secrets referenced in task.payload.env, reporting all malformed
+	// references at once
+	var errs []runtime.MalformedPayloadError
+	for k, ref := range p.secrets {
+		value, err := p.reader.Resolve(ref)
+		if e, ok := runtime.IsMalformedPayloadError(err); ok {
+			errs = append(errs, e)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		p.variables[k] = value
+	}
+	if len(errs) > 0 {
+		return runtime.MergeMalformedPayload(errs...)
+	}
+
 	for k, v := range p.variables {
 		err := sandboxBuilder.SetEnvironmentVariable(k, v)
 
@@ -1,10 +1,17 @@
 package env
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster-worker/plugins/plugintest"
+	"github.com/taskcluster/taskcluster-worker/runtime"
 )
 
 func TestEnvNone(*testing.T) {
@@ -133,3 +140,85 @@ func TestInjectsRunID(*testing.T) {
 		MatchLog:      "7",
 	}.Test()
 }
+
+func TestSecretReader(t *testing.T) {
+	requests := 0
+	signed := true
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if _, ok := r.Header["Authorization"]; !ok {
+			signed = false
+		}
+		switch r.URL.Path {
+		case "/api/secrets/v1/secret/project/my-secret":
+			w.Write([]byte(`{"secret": {"token": "my-secret-token", "count": 42}, "expires": "2030-01-01T00:00:00.000Z"}`))
+		case "/api/secrets/v1/secret/project/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/api/secrets/v1/secret/project/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	ctx, control, err := runtime.NewTaskContext(path, runtime.TaskInfo{})
+	require.NoError(t, err)
+	defer control.Dispose()
+	control.SetCredentials("my-client", "my-access-token", "")
+
+	r := &secretReader{
+		context: ctx,
+		client:  http.DefaultClient,
+		rootURL: s.URL,
+		source:  "task.payload.env",
+		cache:   make(map[string]map[string]interface{}),
+	}
+
+	value, err := r.Resolve(secretReference{Secret: "project/my-secret", Key: "token"})
+	require.NoError(t, err)
+	require.Equal(t, "my-secret-token", value)
+
+	// Secrets are only read once, and keys must be strings
+	_, err = r.Resolve(secretReference{Secret: "project/my-secret", Key: "count"})
+	_, ok := runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+	require.Equal(t, 1, requests)
+
+	_, err = r.Resolve(secretReference{Secret: "project/missing", Key: "token"})
+	_, ok = runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+
+	_, err = r.Resolve(secretReference{Secret: "project/forbidden", Key: "token"})
+	e, ok := runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+	require.Contains(t, e.Error(), "secrets:get:project/forbidden")
+	require.True(t, signed, "expected requests to be signed")
+
+	// Failures in the secrets service aren't the fault of the task
+	_, err = r.Resolve(secretReference{Secret: "project/broken", Key: "token"})
+	_, ok = runtime.IsInfrastructureError(err)
+	require.True(t, ok, "expected InfrastructureError, got: %v", err)
+
+	// Resolved values are redacted from the task log
+	ctx.Log("token is my-secret-token")
+	require.NoError(t, control.CloseLog())
+	log, err := ctx.ExtractLog()
+	require.NoError(t, err)
+	defer log.Close()
+	data, err := ioutil.ReadAll(log)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "my-secret-token")
+}
+
+func TestParseSecretPath(t *testing.T) {
+	ref, ok := parseSecretPath("project/my-secret/token")
+	require.True(t, ok)
+	require.Equal(t, secretReference{Secret: "project/my-secret", Key: "token"}, ref)
+
+	for _, path := range []string{"", "token", "/token", "project/my-secret/"} {
+		_, ok = parseSecretPath(path)
+		require.False(t, ok, "expected '%s' to be invalid", path)
+	}
+}
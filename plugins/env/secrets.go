@@ -0,0 +1,137 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// secretReference is an environment variable value to be read from a secret
+type secretReference struct {
+	Secret string `json:"$secret"`
+	Key    string `json:"key"`
+}
+
+// parseSecretPath parses '<name>/<key>' as given in '${SECRET:<name>/<key>}',
+// the secret name may contain slashes, so the key is the last path segment.
+func parseSecretPath(path string) (secretReference, bool) {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 || i == len(path)-1 {
+		return secretReference{}, false
+	}
+	return secretReference{Secret: path[:i], Key: path[i+1:]}, true
+}
+
+var secretReferenceSchema = schematypes.Object{
+	Title: "Secret Reference",
+	Description: util.Markdown(`
+		Reference to a property of a secret in the secrets service, the secret
+		is read using the task credentials, hence, the task must have the scope
+		'secrets:get:<secret>'. The value is redacted from the task log.
+	`),
+	Properties: schematypes.Properties{
+		"$secret": schematypes.String{
+			Title:         "Secret Name",
+			Description:   "Name of the secret to read from the secrets service.",
+			MinimumLength: 1,
+		},
+		"key": schematypes.String{
+			Title:         "Key",
+			Description:   "Property of the secret to use as value, the property must be a string.",
+			MinimumLength: 1,
+		},
+	},
+	Required: []string{"$secret", "key"},
+}
+
+// secretReader reads secrets using the task credentials, caching secrets
+// such that each secret is only read once per task.
+type secretReader struct {
+	context *runtime.TaskContext
+	client  *http.Client
+	rootURL string
+	source  string // where secrets are referenced, used in error messages
+	cache   map[string]map[string]interface{}
+}
+
+// Resolve returns the value referenced by ref and registers it with the
+// TaskContext for redaction.
+//
+// Returns a MalformedPayloadError, if the secret doesn't exist, can't be read
+// by the task, or the key isn't a string property of the secret. Returns an
+// InfrastructureError, if the secrets service can't be reached or fails.
+func (r *secretReader) Resolve(ref secretReference) (string, error) {
+	secret, ok := r.cache[ref.Secret]
+	if !ok {
+		var err error
+		secret, err = r.read(ref.Secret)
+		if err != nil {
+			return "", err
+		}
+		r.cache[ref.Secret] = secret
+	}
+	value, ok := secret[ref.Key].(string)
+	if !ok {
+		return "", runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"secret '%s' doesn't have a string property '%s'", ref.Secret, ref.Key,
+		))
+	}
+	r.context.AddSecret(value)
+	return value, nil
+}
+
+// read fetches the secret with given name from the secrets service
+func (r *secretReader) read(name string) (map[string]interface{}, error) {
+	u, err := url.Parse(client.ServiceURL(r.rootURL, "secrets", "v1") + "/secret/" + url.PathEscape(name))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to construct URL for secret")
+	}
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	signature, err := r.context.Authorizer().SignHeader(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "SignHeader failed")
+	}
+	req.Header.Set("Authorization", signature)
+
+	debug("reading secret: '%s'", name)
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, runtime.NewInfrastructureError(fmt.Sprintf(
+			"failed to read secret '%s' referenced in %s, error: %s", name, r.source, err,
+		))
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"secret '%s' referenced in %s doesn't exist", name, r.source,
+		))
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"task isn't authorized to read secret '%s' referenced in %s, "+
+				"this requires the scope 'secrets:get:%s'", name, r.source, name,
+		))
+	default:
+		return nil, runtime.NewInfrastructureError(fmt.Sprintf(
+			"failed to read secret '%s' referenced in %s, status: %d", name, r.source, res.StatusCode,
+		))
+	}
+
+	var result struct {
+		Secret map[string]interface{} `json:"secret"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse response for secret: '%s'", name)
+	}
+	return result.Secret, nil
+}
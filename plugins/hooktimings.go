@@ -0,0 +1,55 @@
+package plugins
+
+import (
+	"sync"
+	"time"
+)
+
+// HookTimings records how long each plugin spent in each hook while
+// processing a task.
+//
+// The PluginManager records the duration of every hook it invokes, plugins that
+// report on task execution can read these from TaskPluginOptions.HookTimings.
+// Methods are safe to call on a nil HookTimings.
+type HookTimings struct {
+	m       sync.Mutex
+	timings map[string]map[string]time.Duration
+}
+
+func newHookTimings() *HookTimings {
+	return &HookTimings{
+		timings: make(map[string]map[string]time.Duration),
+	}
+}
+
+func (h *HookTimings) record(plugin, hook string, duration time.Duration) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.timings[plugin] == nil {
+		h.timings[plugin] = make(map[string]time.Duration)
+	}
+	h.timings[plugin][hook] += duration
+}
+
+// Snapshot returns a mapping from plugin name to hook name to the time spent
+// in the hook. Hooks that are currently running are not included.
+func (h *HookTimings) Snapshot() map[string]map[string]time.Duration {
+	result := make(map[string]map[string]time.Duration)
+	if h == nil {
+		return result
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for plugin, hooks := range h.timings {
+		result[plugin] = make(map[string]time.Duration, len(hooks))
+		for hook, duration := range hooks {
+			result[plugin][hook] = duration
+		}
+	}
+	return result
+}
@@ -0,0 +1,17 @@
+// Package hostevents provides a taskcluster-worker plugin that correlates
+// host kernel log events with failed tasks.
+//
+// When a task fails, the plugin scans the kernel log for events since the task
+// started, such as OOM kills, I/O errors and KVM faults, and appends a short
+// summary to the task log. Kernel log messages are written to the worker log,
+// as they may contain details of other tasks, unless the plugin is configured
+// to include them in the task log. This attributes host-level problems that would
+// otherwise look like mysterious task failures.
+//
+// Reading the kernel log is only supported on linux, and requires permission
+// to read '/dev/kmsg'.
+package hostevents
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("hostevents")
@@ -0,0 +1,143 @@
+package hostevents
+
+import (
+	"strconv"
+	"time"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// defaultMaxEvents is the default maximum number of events written to the
+// task log.
+const defaultMaxEvents = 20
+
+type provider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+	maxEvents       int
+	includeMessages bool
+	monitor         runtime.Monitor
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	plugin  *plugin
+	context *runtime.TaskContext
+	monitor runtime.Monitor
+	since   time.Duration // time since boot when the task started, zero if unknown
+}
+
+type config struct {
+	MaxEvents       int  `json:"maxEvents"`
+	IncludeMessages bool `json:"includeMessages"`
+}
+
+var configSchema = schematypes.Object{
+	Title: "Host Events Plugin",
+	Description: util.Markdown(`
+		The hostevents plugin scans the host kernel log when a task fails, and
+		appends a summary of relevant events since the task started to the task
+		log. This includes OOM kills, I/O errors, KVM faults and hung tasks.
+
+		This is only supported on linux, and requires permission to read
+		'/dev/kmsg'.
+
+		Events are not attributed to a specific task, so events caused by
+		concurrently running tasks are also counted. Hence, the task log only
+		lists the number of events in each category, while the kernel log
+		messages are written to the worker log, unless 'includeMessages' is set.
+	`),
+	Properties: schematypes.Properties{
+		"maxEvents": schematypes.Integer{
+			Title: "Maximum Events",
+			Description: util.Markdown(`
+				Maximum number of kernel log events to write to the task log,
+				defaults to ` + strconv.Itoa(defaultMaxEvents) + `.
+			`),
+			Minimum: 1,
+			Maximum: 1000,
+		},
+		"includeMessages": schematypes.Boolean{
+			Title: "Include Messages in Task Log",
+			Description: util.Markdown(`
+				Write kernel log messages to the task log, rather than only the
+				number of events in each category. Messages may contain names of
+				processes from other tasks, so this should only be enabled if
+				tasks don't run concurrently, or tasks are allowed to see each
+				other. Defaults to false.
+			`),
+		},
+	},
+}
+
+func init() {
+	plugins.Register("hostevents", provider{})
+}
+
+func (provider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
+func (provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, error) {
+	var c config
+	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+	if c.MaxEvents == 0 {
+		c.MaxEvents = defaultMaxEvents
+	}
+	return &plugin{
+		maxEvents:       c.MaxEvents,
+		includeMessages: c.IncludeMessages,
+		monitor:         options.Monitor,
+	}, nil
+}
+
+func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	since, err := uptime()
+	if err != nil {
+		options.Monitor.Debug("unable to determine uptime, kernel log won't be scanned: ", err)
+	}
+	return &taskPlugin{
+		plugin:  p,
+		context: options.TaskContext,
+		monitor: options.Monitor,
+		since:   since,
+	}, nil
+}
+
+func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
+	if result.Success() || tp.since == 0 {
+		return true, nil
+	}
+
+	events, err := readKernelLog()
+	if err != nil {
+		tp.monitor.Warn("failed to read kernel log: ", err)
+		return true, nil
+	}
+	debug("read %d records from kernel log", len(events))
+
+	lines := summarize(events, tp.since, tp.plugin.maxEvents)
+	if len(lines) == 0 {
+		return true, nil
+	}
+	tp.monitor.Count("task-failed-with-host-events", 1)
+	if !tp.plugin.includeMessages {
+		// Messages may reveal other tasks, so they only go to the worker log
+		for _, line := range lines {
+			tp.monitor.Info("kernel log event since task started: ", line)
+		}
+		lines = summarizeCategories(events, tp.since)
+	}
+	tp.context.Log("Host kernel log has events since the task started, these may explain the failure:")
+	for _, line := range lines {
+		tp.context.Log("  ", line)
+	}
+	return true, nil
+}
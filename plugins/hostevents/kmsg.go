@@ -0,0 +1,116 @@
+package hostevents
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kernelEvent is a record from the kernel log
+type kernelEvent struct {
+	Time    time.Duration // time since boot
+	Message string
+}
+
+// eventCategories maps a category to a pattern matching kernel log messages
+// relevant for task failures, categories are checked in order.
+var eventCategories = []struct {
+	Name    string
+	Pattern *regexp.Regexp
+}{
+	{"oom", regexp.MustCompile(`(?i)out of memory|oom-kill|oom_reaper|killed process \d+`)},
+	{"io", regexp.MustCompile(`(?i)i/o error|blk_update_request|EXT4-fs error|XFS .*error|nvme.*timeout|ata\d+.*(failed|error)`)},
+	{"kvm", regexp.MustCompile(`(?i)\bkvm\b.*(fault|error|failed|unhandled)|kvm_.*(fault|error)`)},
+	{"hung", regexp.MustCompile(`(?i)blocked for more than \d+ seconds|soft lockup|hard lockup`)},
+	{"segfault", regexp.MustCompile(`(?i)segfault at|general protection fault`)},
+}
+
+// parseKmsgRecord parses a record read from /dev/kmsg, these have the form
+// '<priority>,<sequence>,<timestamp in µs>,<flags>[,...];<message>' followed
+// by continuation lines, which are ignored.
+func parseKmsgRecord(record string) (kernelEvent, bool) {
+	semicolon := strings.IndexByte(record, ';')
+	if semicolon == -1 {
+		return kernelEvent{}, false
+	}
+	fields := strings.Split(record[:semicolon], ",")
+	if len(fields) < 3 {
+		return kernelEvent{}, false
+	}
+	micros, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return kernelEvent{}, false
+	}
+	message := record[semicolon+1:]
+	if i := strings.IndexByte(message, '\n'); i != -1 {
+		message = message[:i]
+	}
+	return kernelEvent{
+		Time:    time.Duration(micros) * time.Microsecond,
+		Message: message,
+	}, true
+}
+
+// classify returns the category of a kernel log message, or empty string if
+// the message isn't relevant.
+func classify(message string) string {
+	for _, c := range eventCategories {
+		if c.Pattern.MatchString(message) {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// summarizeCategories returns a line for each category of relevant events
+// since the given time since boot, with the number of events and the time of
+// the first event. This doesn't include the messages, as these may contain
+// details of other tasks running on the host.
+func summarizeCategories(events []kernelEvent, since time.Duration) []string {
+	var lines []string
+	for _, c := range eventCategories {
+		count := 0
+		var first time.Duration
+		for _, e := range events {
+			if e.Time < since || classify(e.Message) != c.Name {
+				continue
+			}
+			if count == 0 {
+				first = e.Time
+			}
+			count++
+		}
+		if count > 0 {
+			lines = append(lines, fmt.Sprintf("[%s] %d events, first at +%.3fs", c.Name, count, (first-since).Seconds()))
+		}
+	}
+	return lines
+}
+
+// summarize returns lines describing relevant events since the given time
+// since boot, at most maxEvents lines are returned, keeping the earliest
+// events as later events are often a consequence of earlier events.
+func summarize(events []kernelEvent, since time.Duration, maxEvents int) []string {
+	var lines []string
+	skipped := 0
+	for _, e := range events {
+		if e.Time < since {
+			continue
+		}
+		category := classify(e.Message)
+		if category == "" {
+			continue
+		}
+		if len(lines) >= maxEvents {
+			skipped++
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("[%s] +%.3fs: %s", category, (e.Time-since).Seconds(), e.Message))
+	}
+	if skipped > 0 {
+		lines = append(lines, "... and "+strconv.Itoa(skipped)+" more events")
+	}
+	return lines
+}
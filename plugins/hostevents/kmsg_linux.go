@@ -0,0 +1,61 @@
+package hostevents
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// uptime returns the time since boot, this is the clock used for timestamps
+// in the kernel log.
+func uptime() (time.Duration, error) {
+	data, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read /proc/uptime")
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, errors.New("unable to parse /proc/uptime")
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to parse /proc/uptime")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// readKernelLog reads all records currently in the kernel log buffer
+func readKernelLog() ([]kernelEvent, error) {
+	fd, err := syscall.Open("/dev/kmsg", syscall.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open /dev/kmsg")
+	}
+	defer syscall.Close(fd)
+
+	// Each read returns one record, until EAGAIN when no more records are
+	// available. EPIPE means records were overwritten while reading.
+	var events []kernelEvent
+	buf := make([]byte, 8*1024)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN {
+			return events, nil
+		}
+		if err == syscall.EPIPE || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return events, errors.Wrap(err, "failed to read /dev/kmsg")
+		}
+		if n <= 0 {
+			return events, nil
+		}
+		if e, ok := parseKmsgRecord(string(buf[:n])); ok {
+			events = append(events, e)
+		}
+	}
+}
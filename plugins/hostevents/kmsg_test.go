@@ -0,0 +1,51 @@
+package hostevents
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKmsgRecord(t *testing.T) {
+	e, ok := parseKmsgRecord("3,1234,5000000,-;Out of memory: Killed process 42 (cc1plus)\n SUBSYSTEM=memory\n")
+	require.True(t, ok)
+	require.Equal(t, 5*time.Second, e.Time)
+	require.Equal(t, "Out of memory: Killed process 42 (cc1plus)", e.Message)
+
+	_, ok = parseKmsgRecord("not a record")
+	require.False(t, ok)
+}
+
+func TestSummarize(t *testing.T) {
+	events := []kernelEvent{
+		{Time: 1 * time.Second, Message: "Out of memory: Killed process 1 (before)"},
+		{Time: 11 * time.Second, Message: "eth0: link up"},
+		{Time: 12 * time.Second, Message: "Out of memory: Killed process 2 (make)"},
+		{Time: 13 * time.Second, Message: "blk_update_request: I/O error, dev sda, sector 42"},
+		{Time: 14 * time.Second, Message: "INFO: task jbd2 blocked for more than 120 seconds."},
+	}
+	lines := summarize(events, 10*time.Second, 2)
+	require.Len(t, lines, 3)
+	require.True(t, strings.HasPrefix(lines[0], "[oom] +2.000s:"), lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "[io] +3.000s:"), lines[1])
+	require.Equal(t, "... and 1 more events", lines[2])
+
+	require.Empty(t, summarize(events[:2], 10*time.Second, 10))
+}
+
+func TestSummarizeCategories(t *testing.T) {
+	events := []kernelEvent{
+		{Time: 1 * time.Second, Message: "Out of memory: Killed process 1 (before)"},
+		{Time: 12 * time.Second, Message: "Out of memory: Killed process 2 (make)"},
+		{Time: 13 * time.Second, Message: "blk_update_request: I/O error, dev sda, sector 42"},
+		{Time: 15 * time.Second, Message: "Out of memory: Killed process 3 (secret-build)"},
+	}
+	lines := summarizeCategories(events, 10*time.Second)
+	require.Equal(t, []string{
+		"[oom] 2 events, first at +2.000s",
+		"[io] 1 events, first at +3.000s",
+	}, lines)
+	require.Empty(t, summarizeCategories(events[:1], 10*time.Second))
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package hostevents
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func uptime() (time.Duration, error) {
+	return 0, errors.New("reading the kernel log is not supported on this platform")
+}
+
+func readKernelLog() ([]kernelEvent, error) {
+	return nil, errors.New("reading the kernel log is not supported on this platform")
+}
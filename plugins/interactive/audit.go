@@ -0,0 +1,196 @@
+package interactive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// maxTranscriptSize is the maximum number of bytes of input recorded in the
+// transcript of a shell session, further input is not recorded.
+const maxTranscriptSize = 1024 * 1024
+
+// sessionRecord describes an interactive session in the audit log uploaded as
+// 'sessions.json'.
+type sessionRecord struct {
+	ID         int       `json:"id"`
+	Type       string    `json:"type"` // "shell" or "display"
+	RemoteAddr string    `json:"remoteAddr"`
+	Command    []string  `json:"command,omitempty"`
+	Display    string    `json:"display,omitempty"`
+	Started    time.Time `json:"started"`
+	Ended      time.Time `json:"ended"`
+	Duration   float64   `json:"duration"` // seconds
+	Expired    bool      `json:"expired"`  // terminated by maxSessionLifetime
+	Transcript string    `json:"transcript,omitempty"`
+}
+
+// sessionAudit records interactive sessions, so they can be reported in the
+// task log and uploaded as artifacts when the task is resolved. A nil
+// sessionAudit records nothing, so servers can be used without auditing.
+type sessionAudit struct {
+	m           sync.Mutex
+	context     *runtime.TaskContext
+	transcripts bool
+	sessions    []*session
+	closed      bool
+}
+
+// session is an interactive session being recorded by sessionAudit
+type session struct {
+	record     sessionRecord
+	audit      *sessionAudit
+	transcript bytes.Buffer
+	truncated  bool
+	ended      bool
+}
+
+// begin records the start of a session of the given type from request r,
+// returns nil if sa is nil. Signed URLs are published as artifacts, so the
+// worker can't tell who opened a session, only where it was opened from.
+func (sa *sessionAudit) begin(sessionType string, r *http.Request) *session {
+	if sa == nil {
+		return nil
+	}
+	sa.m.Lock()
+	defer sa.m.Unlock()
+
+	s := &session{
+		audit: sa,
+		record: sessionRecord{
+			ID:         len(sa.sessions),
+			Type:       sessionType,
+			RemoteAddr: r.RemoteAddr,
+			Started:    time.Now(),
+		},
+	}
+	switch sessionType {
+	case "shell":
+		s.record.Command = r.URL.Query()["command"]
+	case "display":
+		s.record.Display = r.URL.Query().Get("display")
+	}
+	if sa.closed {
+		// Sessions opened after close are ended immediately, as servers abort them
+		s.ended = true
+		s.record.Ended = s.record.Started
+		return s
+	}
+	sa.sessions = append(sa.sessions, s)
+
+	sa.context.Log(fmt.Sprintf(
+		"Interactive %s session %d opened from %s", sessionType, s.record.ID, s.record.RemoteAddr,
+	))
+	return s
+}
+
+// recordsInput returns true, if input should be written to the session
+func (s *session) recordsInput() bool {
+	return s != nil && s.audit.transcripts && s.record.Type == "shell"
+}
+
+// Write records input to the transcript, input beyond maxTranscriptSize is
+// discarded. This never returns an error, so it's safe to use with a TeeReader.
+func (s *session) Write(p []byte) (int, error) {
+	s.audit.m.Lock()
+	defer s.audit.m.Unlock()
+
+	if s.ended {
+		return len(p), nil
+	}
+	if remaining := maxTranscriptSize - s.transcript.Len(); len(p) > remaining {
+		s.transcript.Write(p[:remaining])
+		s.truncated = true
+	} else {
+		s.transcript.Write(p)
+	}
+	return len(p), nil
+}
+
+// end records the end of the session, expired indicates that the session was
+// terminated because it exceeded maxSessionLifetime.
+func (s *session) end(expired bool) {
+	if s == nil {
+		return
+	}
+	sa := s.audit
+	sa.m.Lock()
+	defer sa.m.Unlock()
+
+	if s.ended {
+		return
+	}
+	s.endLocked(time.Now())
+	s.record.Expired = expired
+
+	reason := "closed"
+	if expired {
+		reason = "terminated, as it exceeded the maximum session lifetime,"
+	}
+	d := s.record.Ended.Sub(s.record.Started)
+	d -= d % time.Second
+	sa.context.Log(fmt.Sprintf(
+		"Interactive %s session %d %s after %s", s.record.Type, s.record.ID, reason, d,
+	))
+}
+
+func (s *session) endLocked(now time.Time) {
+	s.ended = true
+	s.record.Ended = now
+	s.record.Duration = now.Sub(s.record.Started).Seconds()
+}
+
+// upload ends all sessions and uploads 'sessions.json' and transcripts under
+// prefix, nothing is uploaded if no sessions were recorded.
+func (sa *sessionAudit) upload(prefix string) error {
+	sa.m.Lock()
+	sa.closed = true
+	now := time.Now()
+	records := make([]sessionRecord, len(sa.sessions))
+	transcripts := make(map[string][]byte)
+	for i, s := range sa.sessions {
+		if !s.ended {
+			s.endLocked(now)
+		}
+		if sa.transcripts && s.record.Type == "shell" {
+			s.record.Transcript = fmt.Sprintf("%stranscript-%d.log", prefix, s.record.ID)
+			transcript := s.transcript.Bytes()
+			if s.truncated {
+				transcript = append(transcript, []byte("\n[transcript truncated]\n")...)
+			}
+			transcripts[s.record.Transcript] = transcript
+		}
+		records[i] = s.record
+	}
+	sa.m.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	for name, transcript := range transcripts {
+		err := sa.context.UploadS3Artifact(runtime.S3Artifact{
+			Name:     name,
+			Mimetype: "text/plain; charset=utf-8",
+			Expires:  sa.context.TaskInfo.Expires,
+			Stream:   ioext.NopCloser(bytes.NewReader(transcript)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	data, _ := json.MarshalIndent(records, "", "  ")
+	return sa.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     prefix + "sessions.json",
+		Mimetype: "application/json",
+		Expires:  sa.context.TaskInfo.Expires,
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+	})
+}
@@ -15,6 +15,8 @@ type config struct {
 	DisableDisplay             bool   `json:"disableDisplay"`
 	ShellToolURL               string `json:"shellToolUrl"`
 	DisplayToolURL             string `json:"displayToolUrl"`
+	MaxSessionLifetime         int    `json:"maxSessionLifetime"`
+	ShellTranscripts           bool   `json:"shellTranscripts"`
 }
 
 var configSchema = schematypes.Object{
@@ -70,5 +72,27 @@ var configSchema = schematypes.Object{
 				'runId'.
 			`),
 		},
+		"maxSessionLifetime": schematypes.Integer{
+			Title: "Maximum Session Lifetime",
+			Description: util.Markdown(`
+				Maximum number of seconds an interactive shell or display session
+				may last, before it is terminated. Users may open a new session
+				afterwards. Defaults to 0, which imposes no limit.
+			`),
+			Minimum: 0,
+			Maximum: 7 * 24 * 60 * 60,
+		},
+		"shellTranscripts": schematypes.Boolean{
+			Title: "Shell Transcripts",
+			Description: util.Markdown(`
+				Record input to interactive shells, and upload it as
+				'transcript-<id>.log' under the artifact prefix, when the task is
+				resolved. At most 1 MiB of input is recorded per session.
+
+				Regardless of this option, interactive sessions are reported in
+				the task log and recorded in 'sessions.json' under the artifact
+				prefix, with remote address and duration.
+			`),
+		},
 	},
 }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/taskcluster/taskcluster-worker/engines"
@@ -25,11 +26,13 @@ type DisplayProvider interface {
 // A DisplayServer exposes a DisplayProvider over a websocket, tracks
 // connections and ensures they are all cleaned up.
 type DisplayServer struct {
-	m        sync.Mutex
-	provider DisplayProvider
-	monitor  runtime.Monitor
-	done     chan struct{}
-	handlers []*DisplayHandler
+	m           sync.Mutex
+	provider    DisplayProvider
+	monitor     runtime.Monitor
+	done        chan struct{}
+	handlers    []*DisplayHandler
+	audit       *sessionAudit // records sessions, if non-nil
+	maxLifetime time.Duration // aborts sessions after maxLifetime, if non-zero
 }
 
 // NewDisplayServer creates a DisplayServer for exposing the given provider
@@ -137,6 +140,28 @@ func (s *DisplayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Create new handler and add it to the list
 	h := NewDisplayHandler(ws, display, s.monitor.WithTag("display", displayName))
 	s.handlers = append(s.handlers, h)
+
+	// Record the session, and abort it when maxLifetime is exceeded
+	if s.audit != nil || s.maxLifetime > 0 {
+		sess := s.audit.begin("display", r)
+		go s.watchSession(h, sess)
+	}
+}
+
+func (s *DisplayServer) watchSession(h *DisplayHandler, sess *session) {
+	var timeout <-chan time.Time
+	if s.maxLifetime > 0 {
+		timer := time.NewTimer(s.maxLifetime)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-h.done:
+		sess.end(false)
+	case <-timeout:
+		sess.end(true)
+		h.Abort()
+	}
 }
 
 func (s *DisplayServer) listDisplays(w http.ResponseWriter, r *http.Request) {
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/engines"
@@ -141,6 +142,11 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (
 		opts:     o,
 		monitor:  options.Monitor,
 		parent:   p,
+		signer:   newURLSigner(),
+		audit: &sessionAudit{
+			context:     options.TaskContext,
+			transcripts: p.config.ShellTranscripts,
+		},
 	}, nil
 }
 
@@ -157,6 +163,8 @@ type taskPlugin struct {
 	displaysURL      string
 	displaySocketURL string
 	displayServer    *DisplayServer
+	audit            *sessionAudit
+	signer           *urlSigner
 }
 
 func (p *taskPlugin) Started(sandbox engines.Sandbox) error {
@@ -192,11 +200,33 @@ func (p *taskPlugin) Started(sandbox engines.Sandbox) error {
 }
 
 func (p *taskPlugin) Stopped(_ engines.ResultSet) (bool, error) {
-	return true, p.Dispose()
+	err := p.Dispose()
+	if uerr := p.uploadAudit(); err == nil {
+		err = uerr
+	}
+	return true, err
 }
 
 func (p *taskPlugin) Exception(_ runtime.ExceptionReason) error {
-	return p.Dispose()
+	err := p.Dispose()
+	if uerr := p.uploadAudit(); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// uploadAudit uploads the audit log of interactive sessions, this must be
+// called after the shell and display servers have been aborted.
+func (p *taskPlugin) uploadAudit() error {
+	if p.audit == nil {
+		return nil
+	}
+	err := p.audit.upload(p.opts.ArtifactPrefix)
+	p.audit = nil // ensure we don't upload twice
+	if err != nil {
+		return fmt.Errorf("Failed to upload audit log of interactive sessions, error: %s", err)
+	}
+	return nil
 }
 
 func (p *taskPlugin) Dispose() error {
@@ -232,8 +262,10 @@ func (p *taskPlugin) setupShell() error {
 	p.shellServer = NewShellServer(
 		p.sandbox.NewShell, p.monitor.WithPrefix("shell-server"),
 	)
-	u := p.webhooks.AttachHook(p.shellServer)
-	p.shellURL = urlProtocolToWebsocket(u)
+	p.shellServer.audit = p.audit
+	p.shellServer.maxLifetime = time.Duration(p.parent.config.MaxSessionLifetime) * time.Second
+	u := p.webhooks.AttachHook(p.signer.Handler(p.shellServer))
+	p.shellURL = urlProtocolToWebsocket(p.signer.Sign(u, p.context.TaskInfo.LocalDeadline()))
 
 	query := url.Values{}
 	query.Set("v", "2")
@@ -260,9 +292,11 @@ func (p *taskPlugin) setupDisplay() error {
 	p.displayServer = NewDisplayServer(
 		p.sandbox, p.monitor.WithPrefix("display-server"),
 	)
-	u := p.webhooks.AttachHook(p.displayServer)
-	p.displaysURL = u
-	p.displaySocketURL = urlProtocolToWebsocket(u)
+	p.displayServer.audit = p.audit
+	p.displayServer.maxLifetime = time.Duration(p.parent.config.MaxSessionLifetime) * time.Second
+	u := p.webhooks.AttachHook(p.signer.Handler(p.displayServer))
+	p.displaysURL = p.signer.Sign(u, p.context.TaskInfo.LocalDeadline())
+	p.displaySocketURL = urlProtocolToWebsocket(p.displaysURL)
 
 	query := url.Values{}
 	query.Set("v", "1")
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	vnc "github.com/mitchellh/go-vnc"
+	"github.com/stretchr/testify/require"
 	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster-worker/plugins/interactive/displayclient"
 	"github.com/taskcluster/taskcluster-worker/plugins/interactive/shellclient"
@@ -53,6 +54,8 @@ func TestInteractivePluginShell(t *testing.T) {
 	q := &client.MockQueue{}
 	shell := q.ExpectRedirectArtifact(taskID, 0, "private/interactive/shell.html")
 	sockets := q.ExpectS3Artifact(taskID, 0, "private/interactive/sockets.json")
+	sessions := q.ExpectS3Artifact(taskID, 0, "private/interactive/sessions.json")
+	transcript := q.ExpectS3Artifact(taskID, 0, "private/interactive/transcript-0.log")
 	plugintest.Case{
 		Payload: `{
 			"delay": 250,
@@ -63,7 +66,7 @@ func TestInteractivePluginShell(t *testing.T) {
 			}
 		}`,
 		Plugin:        "interactive",
-		PluginConfig:  `{}`,
+		PluginConfig:  `{"shellTranscripts": true}`,
 		PluginSuccess: true,
 		EngineSuccess: true,
 		QueueMock:     q,
@@ -110,6 +113,59 @@ func TestInteractivePluginShell(t *testing.T) {
 				panic("Shell didn't end successfully")
 			}
 		},
+		AfterStopped: func(plugintest.Options) {
+			var records []sessionRecord
+			require.NoError(t, json.Unmarshal(<-sessions, &records))
+			require.Len(t, records, 1)
+			require.Equal(t, "shell", records[0].Type)
+			require.NotEmpty(t, records[0].RemoteAddr)
+			require.False(t, records[0].Expired)
+			require.Equal(t, "private/interactive/transcript-0.log", records[0].Transcript)
+			require.Equal(t, "print-hello", string(<-transcript))
+		},
+		MatchLog: "Interactive shell session 0 closed",
+	}.Test()
+}
+
+func TestInteractivePluginShellLifetime(t *testing.T) {
+	taskID := slugid.V4()
+	q := &client.MockQueue{}
+	shell := q.ExpectRedirectArtifact(taskID, 0, "private/interactive/shell.html")
+	q.ExpectS3Artifact(taskID, 0, "private/interactive/sockets.json")
+	sessions := q.ExpectS3Artifact(taskID, 0, "private/interactive/sessions.json")
+	plugintest.Case{
+		Payload: `{
+			"delay": 250,
+			"function": "true",
+			"argument": "whatever",
+			"interactive": {
+				"disableDisplay": true
+			}
+		}`,
+		Plugin:        "interactive",
+		PluginConfig:  `{"maxSessionLifetime": 1}`,
+		PluginSuccess: true,
+		EngineSuccess: true,
+		QueueMock:     q,
+		TaskID:        taskID,
+		AfterStarted: func(plugintest.Options) {
+			u, _ := url.Parse(<-shell)
+			sh, err := shellclient.Dial(u.Query().Get("socketUrl"), nil, false)
+			require.NoError(t, err)
+
+			// Leave stdin open, so the shell runs until it is terminated
+			debug("Wait for shell to be terminated")
+			result, _ := sh.Wait()
+			require.False(t, result, "expected shell to be terminated")
+		},
+		AfterStopped: func(plugintest.Options) {
+			var records []sessionRecord
+			require.NoError(t, json.Unmarshal(<-sessions, &records))
+			require.Len(t, records, 1)
+			require.True(t, records[0].Expired)
+			require.True(t, records[0].Duration >= 1)
+		},
+		MatchLog: "exceeded the maximum session lifetime",
 	}.Test()
 }
 
@@ -118,6 +174,7 @@ func TestInteractivePluginDisplay(t *testing.T) {
 	q := &client.MockQueue{}
 	display := q.ExpectRedirectArtifact(taskID, 0, "private/interactive/display.html")
 	sockets := q.ExpectS3Artifact(taskID, 0, "private/interactive/sockets.json")
+	sessions := q.ExpectS3Artifact(taskID, 0, "private/interactive/sessions.json")
 	plugintest.Case{
 		Payload: `{
 			"delay": 250,
@@ -179,5 +236,12 @@ func TestInteractivePluginDisplay(t *testing.T) {
 				panic("width mismatch")
 			}
 		},
+		AfterStopped: func(plugintest.Options) {
+			var records []sessionRecord
+			require.NoError(t, json.Unmarshal(<-sessions, &records))
+			require.Len(t, records, 1)
+			require.Equal(t, "display", records[0].Type)
+			require.Equal(t, "MockDisplay", records[0].Display)
+		},
 	}.Test()
 }
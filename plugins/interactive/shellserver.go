@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/plugins/interactive/shellconsts"
 	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
@@ -27,6 +29,8 @@ type ShellServer struct {
 	refCount      int
 	instanceCount int
 	monitor       runtime.Monitor
+	audit         *sessionAudit // records sessions, if non-nil
+	maxLifetime   time.Duration // aborts sessions after maxLifetime, if non-zero
 }
 
 // NewShellServer returns a new ShellServer which creates shells using the
@@ -123,7 +127,8 @@ func (s *ShellServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go s.handleShell(ws, shell)
+	sess := s.audit.begin("shell", r)
+	go s.handleShell(ws, shell, sess)
 }
 
 func copyCloseDone(w io.WriteCloser, r io.Reader, wg *sync.WaitGroup) {
@@ -131,7 +136,7 @@ func copyCloseDone(w io.WriteCloser, r io.Reader, wg *sync.WaitGroup) {
 	wg.Done()
 }
 
-func (s *ShellServer) handleShell(ws *websocket.Conn, shell engines.Shell) {
+func (s *ShellServer) handleShell(ws *websocket.Conn, shell engines.Shell, sess *session) {
 	done := make(chan struct{})
 
 	// Create a shell handler
@@ -141,18 +146,32 @@ func (s *ShellServer) handleShell(ws *websocket.Conn, shell engines.Shell) {
 	// Connect pipes
 	wg := sync.WaitGroup{}
 	wg.Add(2)
-	go ioext.CopyAndClose(shell.StdinPipe(), handler.StdinPipe())
+	var stdin io.Reader = handler.StdinPipe()
+	if sess.recordsInput() {
+		stdin = io.TeeReader(stdin, sess)
+	}
+	go ioext.CopyAndClose(shell.StdinPipe(), stdin)
 	go copyCloseDone(handler.StdoutPipe(), shell.StdoutPipe(), &wg)
 	go copyCloseDone(handler.StderrPipe(), shell.StderrPipe(), &wg)
 
 	// Start streaming
 	handler.Communicate(shell.SetSize, shell.Abort)
 
-	// Wait for call to abort all shells
+	// Wait for call to abort all shells, or the session to expire
+	var expired atomics.Bool
 	go func() {
+		var timeout <-chan time.Time
+		if s.maxLifetime > 0 {
+			timer := time.NewTimer(s.maxLifetime)
+			defer timer.Stop()
+			timeout = timer.C
+		}
 		select {
 		case <-s.done:
 			shell.Abort()
+		case <-timeout:
+			expired.Set(true)
+			shell.Abort()
 		case <-done:
 		}
 	}()
@@ -161,6 +180,7 @@ func (s *ShellServer) handleShell(ws *websocket.Conn, shell engines.Shell) {
 	success, _ := shell.Wait()
 	wg.Wait() // Wait for pipes to be copied before terminating
 	handler.Terminated(success)
+	sess.end(expired.Get())
 	s.updateRefCount(-1)
 
 	// Close done so we stop waiting for abort on all shells
@@ -0,0 +1,67 @@
+package interactive
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// urlSigner signs socket URLs with an expiration time, and rejects requests
+// that aren't signed. Each task has its own key, so a signed URL can't be used
+// to access sockets of another task.
+type urlSigner struct {
+	key []byte
+}
+
+func newURLSigner() *urlSigner {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("Failed to generate key for signing URLs, error: " + err.Error())
+	}
+	return &urlSigner{key: key}
+}
+
+func (s *urlSigner) signature(expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns u with the querystring options 'expires' and 'signature'.
+func (s *urlSigner) Sign(u string, expires time.Time) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		panic("Failed to parse URL from webhookserver, error: " + err.Error())
+	}
+	e := strconv.FormatInt(expires.Unix(), 10)
+	q := parsed.Query()
+	q.Set("expires", e)
+	q.Set("signature", s.signature(e))
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// Handler wraps handler, such that requests are only forwarded if they carry a
+// valid signature that hasn't expired, otherwise 403 is returned.
+func (s *urlSigner) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		e := q.Get("expires")
+		expires, err := strconv.ParseInt(e, 10, 64)
+		valid := err == nil && time.Now().Unix() < expires && hmac.Equal(
+			[]byte(q.Get("signature")), []byte(s.signature(e)),
+		)
+		if !valid {
+			debug("Rejected request with invalid or expired signature")
+			setCORS(w)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,32 @@
+package interactive
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := newURLSigner()
+	s := httptest.NewServer(signer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer s.Close()
+
+	get := func(u string) int {
+		res, err := http.Get(u)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	u := signer.Sign(s.URL+"/?display=test", time.Now().Add(time.Hour))
+	require.Contains(t, u, "display=test", "existing options should be preserved")
+	require.Equal(t, http.StatusOK, get(u))
+	require.Equal(t, http.StatusForbidden, get(s.URL), "unsigned")
+	require.Equal(t, http.StatusForbidden, get(signer.Sign(s.URL, time.Now().Add(-time.Minute))), "expired")
+	require.Equal(t, http.StatusForbidden, get(newURLSigner().Sign(s.URL, time.Now().Add(time.Hour))), "wrong key")
+}
@@ -0,0 +1,43 @@
+package livelog
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+const (
+	defaultLogName        = "public/logs/live.log"
+	defaultBackingLogName = "public/logs/live_backing.log"
+)
+
+type config struct {
+	LogName        string `json:"logName"`
+	BackingLogName string `json:"backingLogName"`
+}
+
+var configSchema = schematypes.Object{
+	Title: "`livelog` Plugin",
+	Description: util.Markdown(`
+		The livelog plugin serves the task log while the task is running, and
+		uploads the task log when the task is resolved.
+	`),
+	Properties: schematypes.Properties{
+		"logName": schematypes.String{
+			Title: "Log Artifact Name",
+			Description: util.Markdown(`
+				Name of the artifact redirecting to the live log while the task is
+				running, and to the backing log once the task is resolved.
+				Defaults to '` + defaultLogName + `'.
+			`),
+			Pattern: `^[^/].*[^/]$`,
+		},
+		"backingLogName": schematypes.String{
+			Title: "Backing Log Artifact Name",
+			Description: util.Markdown(`
+				Name of the artifact to which the task log is uploaded when the task
+				is resolved. Defaults to '` + defaultBackingLogName + `'.
+			`),
+			Pattern: `^[^/].*[^/]$`,
+		},
+	},
+}
@@ -6,16 +6,21 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
 	tcclient "github.com/taskcluster/taskcluster-client-go"
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
@@ -27,6 +32,7 @@ type plugin struct {
 	plugins.PluginBase
 	monitor     runtime.Monitor
 	environment *runtime.Environment
+	config      config
 }
 
 type taskPlugin struct {
@@ -36,18 +42,32 @@ type taskPlugin struct {
 	detach      func()
 	log         *logrus.Entry
 	environment *runtime.Environment
+	config      config
 	expiration  tcclient.Time
 	monitor     runtime.Monitor
 	uploaded    atomics.Once
+	stream      *runtime.ArtifactStream // nil, if live log isn't available
 	setupDone   sync.WaitGroup
 	setupErr    error
 }
 
+func (pluginProvider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
 func (pluginProvider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, error) {
+	c := config{
+		LogName:        defaultLogName,
+		BackingLogName: defaultBackingLogName,
+	}
+	if options.Config != nil {
+		schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+	}
 	debug("Created livelog plugin")
 	return plugin{
 		monitor:     options.Monitor,
 		environment: options.Environment,
+		config:      c,
 	}, nil
 }
 
@@ -57,6 +77,7 @@ func (p plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPl
 		context:     options.TaskContext,
 		monitor:     options.Monitor,
 		environment: p.environment,
+		config:      p.config,
 	}
 	tp.setupDone.Add(1)
 	go tp.setup()
@@ -79,6 +100,10 @@ func (tp *taskPlugin) setup() {
 		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Expose-Headers", "X-Streaming")
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		// Clients resuming an interrupted stream may request 'bytes=<offset>-'
+		offset := parseRange(r.Header.Get("Range"))
 		if r.Method == http.MethodHead {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -94,7 +119,6 @@ func (tp *taskPlugin) setup() {
 			wf = ioext.NopFlusher(w)
 		}
 
-		// TODO (garndt): add support for range headers.  Might not be used at all currently
 		logReader, err := tp.context.NewLogReader()
 		if err != nil {
 			w.WriteHeader(500)
@@ -103,15 +127,28 @@ func (tp *taskPlugin) setup() {
 		}
 		defer logReader.Close()
 
-		w.WriteHeader(http.StatusOK)
+		// Skip to offset, this blocks until the log has reached offset, which is
+		// fine as we're streaming anyways.
+		if offset > 0 {
+			if _, err = io.CopyN(ioutil.Discard, logReader, offset); err != nil {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
 		ioext.CopyAndFlush(wf, logReader, 100*time.Millisecond)
 	}))
 
-	err := tp.context.CreateRedirectArtifact(runtime.RedirectArtifact{
-		Name:     "public/logs/live.log",
-		Mimetype: "text/plain; charset=utf-8",
-		URL:      tp.url,
-		Expires:  tp.context.TaskInfo.Expires,
+	var err error
+	tp.stream, err = tp.context.CreateStreamingArtifact(runtime.StreamingArtifact{
+		Name:        tp.config.LogName,
+		Mimetype:    "text/plain; charset=utf-8",
+		URL:         tp.url,
+		BackingName: tp.config.BackingLogName,
+		BackingURL:  tp.backingURL(),
+		Expires:     tp.context.TaskInfo.Expires,
 	})
 	if err != nil {
 		incidentID := tp.monitor.ReportError(err, "Failed to setup live logging")
@@ -188,31 +225,43 @@ func (tp *taskPlugin) uploadLog() error {
 		return errors.Wrap(err, "failed to reset temporary file to start")
 	}
 
-	debug("Uploading live_backing.log")
+	headers := map[string]string{
+		"Content-Encoding": "gzip",
+	}
+
+	// If the live log was available, we finish the streaming artifact, which
+	// uploads the backing log and redirects the log artifact to it.
+	if tp.stream != nil {
+		debug("Finishing %s, uploading %s", tp.config.LogName, tp.config.BackingLogName)
+		if err = tp.stream.Finish(tempFile, headers); err != nil {
+			tp.monitor.Error(err)
+			return runtime.ErrNonFatalInternalError // Upload error isn't fatal
+		}
+		return nil
+	}
+
+	debug("Uploading %s", tp.config.BackingLogName)
 	err = tp.context.UploadS3Artifact(runtime.S3Artifact{
-		Name:     "public/logs/live_backing.log",
-		Mimetype: "text/plain; charset=utf-8",
-		Expires:  tp.context.TaskInfo.Expires,
-		Stream:   tempFile,
-		AdditionalHeaders: map[string]string{
-			"Content-Encoding": "gzip",
-		},
+		Name:              tp.config.BackingLogName,
+		Mimetype:          "text/plain; charset=utf-8",
+		Expires:           tp.context.TaskInfo.Expires,
+		Stream:            tempFile,
+		AdditionalHeaders: headers,
 	})
 	if err != nil {
-		err = errors.Wrap(err, "failed to upload live_backing.log")
+		err = errors.Wrapf(err, "failed to upload %s", tp.config.BackingLogName)
 		tp.monitor.Error(err)
 		return err // Upload error isn't fatal
 	}
 
-	backingURL := fmt.Sprintf("https://queue.taskcluster.net/v1/task/%s/runs/%d/artifacts/public/logs/live_backing.log", tp.context.TaskInfo.TaskID, tp.context.TaskInfo.RunID)
 	err = tp.context.CreateRedirectArtifact(runtime.RedirectArtifact{
-		Name:     "public/logs/live.log",
+		Name:     tp.config.LogName,
 		Mimetype: "text/plain; charset=utf-8",
-		URL:      backingURL,
+		URL:      tp.backingURL(),
 		Expires:  tp.context.TaskInfo.Expires,
 	})
 	if err != nil {
-		err = errors.Wrap(err, "failed to update live.log")
+		err = errors.Wrapf(err, "failed to update %s", tp.config.LogName)
 		tp.monitor.Error(err)
 		return runtime.ErrNonFatalInternalError // Upload error isn't fatal
 	}
@@ -220,6 +269,33 @@ func (tp *taskPlugin) uploadLog() error {
 	return nil
 }
 
+// backingURL returns the URL for the backing log artifact
+func (tp *taskPlugin) backingURL() string {
+	queueURL := tp.environment.QueueBaseURL
+	if queueURL == "" {
+		queueURL = client.ServiceURL(tp.environment.RootURL, "queue", "v1")
+	}
+	return fmt.Sprintf("%s/task/%s/runs/%d/artifacts/%s",
+		queueURL, tp.context.TaskInfo.TaskID, tp.context.TaskInfo.RunID, tp.config.BackingLogName,
+	)
+}
+
+// parseRange parses a Range header on the form 'bytes=<offset>-' and returns
+// offset, the length of the log isn't known while streaming so other forms of
+// ranges aren't supported. As permitted by RFC 7233, ranges that aren't
+// supported or malformed are ignored, by returning offset = 0, such that the
+// entire log is served.
+func parseRange(header string) int64 {
+	if !strings.HasPrefix(header, "bytes=") || !strings.HasSuffix(header, "-") {
+		return 0
+	}
+	offset, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(header, "bytes="), "-"), 10, 64)
+	if err != nil || offset < 0 {
+		return 0
+	}
+	return offset
+}
+
 func init() {
 	plugins.Register("livelog", &pluginProvider{})
 }
@@ -1,6 +1,7 @@
 package livelog
 
 import (
+	"io"
 	"net/http"
 	"strings"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster-worker/plugins/plugintest"
+	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
 )
 
@@ -74,6 +76,36 @@ func TestLiveLogStreaming(t *testing.T) {
 					}
 				}
 
+				// Resume the livelog from an offset
+				if len(data) > 3 {
+					req, err = http.NewRequest("GET", u, nil)
+					require.NoError(t, err)
+					req.Header.Set("Range", "bytes=3-")
+					var res2 *http.Response
+					res2, err = http.DefaultClient.Do(req)
+					require.NoError(t, err)
+					defer res2.Body.Close()
+					require.Equal(t, http.StatusPartialContent, res2.StatusCode)
+					resumed := make([]byte, len(data)-3)
+					_, err = io.ReadFull(res2.Body, resumed)
+					require.NoError(t, err)
+					require.Equal(t, string(data[3:]), string(resumed))
+
+					// Unsupported ranges are ignored, serving the entire log
+					req, err = http.NewRequest("GET", u, nil)
+					require.NoError(t, err)
+					req.Header.Set("Range", "bytes=0-1,3-")
+					var res3 *http.Response
+					res3, err = http.DefaultClient.Do(req)
+					require.NoError(t, err)
+					defer res3.Body.Close()
+					require.Equal(t, http.StatusOK, res3.StatusCode)
+					full := make([]byte, len(data))
+					_, err = io.ReadFull(res3.Body, full)
+					require.NoError(t, err)
+					require.Equal(t, string(data), string(full))
+				}
+
 				// Reply so that we can continue
 				if strings.Contains(string(data), "Pinging") {
 					w.WriteHeader(http.StatusOK)
@@ -97,3 +129,25 @@ func TestLiveLogStreaming(t *testing.T) {
 		},
 	}.Test()
 }
+
+func TestParseRange(t *testing.T) {
+	require.EqualValues(t, 0, parseRange(""))
+	require.EqualValues(t, 42, parseRange("bytes=42-"))
+
+	// Unsupported and malformed ranges are ignored
+	for _, header := range []string{"bytes=0-10", "bytes=-10", "bytes=0-1,5-", "bytes=abc-", "items=1-"} {
+		require.EqualValues(t, 0, parseRange(header), "expected '%s' to be ignored", header)
+	}
+}
+
+func TestBackingURL(t *testing.T) {
+	tp := &taskPlugin{
+		context:     &runtime.TaskContext{TaskInfo: runtime.TaskInfo{TaskID: "H6SAIKUFT2mewKH-qHzXjQ", RunID: 1}},
+		environment: &runtime.Environment{RootURL: "https://tc.example.com"},
+		config:      config{BackingLogName: "public/logs/live_backing.log"},
+	}
+	require.Equal(t, "https://tc.example.com/api/queue/v1/task/H6SAIKUFT2mewKH-qHzXjQ/runs/1/artifacts/public/logs/live_backing.log", tp.backingURL())
+
+	tp.environment.QueueBaseURL = "http://localhost:8080/v1"
+	require.Equal(t, "http://localhost:8080/v1/task/H6SAIKUFT2mewKH-qHzXjQ/runs/1/artifacts/public/logs/live_backing.log", tp.backingURL())
+}
@@ -1,6 +1,7 @@
 package maxruntime
 
 import (
+	"fmt"
 	"time"
 
 	schematypes "github.com/taskcluster/go-schematypes"
@@ -110,7 +111,9 @@ func (p *taskPlugin) Started(sandbox engines.Sandbox) error {
 			// when maxRunTime has elapsed we kill the task
 			p.killed.Set(true)
 			p.monitor.Info("Killing task due to maxRunTime exceeded")
-			p.context.LogError("Task killed because maxRunTime was exceeded")
+			p.context.LogError(fmt.Sprintf(
+				"Task killed because maxRunTime: %s was exceeded", p.maxRunTime,
+			))
 			sandbox.Kill()
 		case <-p.context.Done():
 			// when task context is canceled, then we need not kill anything
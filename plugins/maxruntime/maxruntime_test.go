@@ -37,6 +37,7 @@ func TestMaxRunTimeExpired(t *testing.T) {
 			"maxRunTime": "1 minute",
 			"perTaskLimit": "allow"
 		}`,
+		MatchLog:      `\[taskcluster:error\]\s+Task killed because maxRunTime: 1s was exceeded`,
 		PluginSuccess: false,
 		EngineSuccess: false,
 	}.Test()
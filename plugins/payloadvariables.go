@@ -0,0 +1,154 @@
+package plugins
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// A PayloadVariable resolves the value of a variable in task.payload strings,
+// see Plugin.PayloadVariables().
+//
+// Non-fatal errors: MalformedPayloadError, InfrastructureError
+type PayloadVariable func(options PayloadVariableOptions) (string, error)
+
+// PayloadVariableOptions is given to a PayloadVariable when resolving a
+// variable.
+type PayloadVariableOptions struct {
+	Environment *runtime.Environment
+	TaskInfo    *runtime.TaskInfo
+	TaskContext *runtime.TaskContext
+	// Entire task.payload before variables are substituted, this must not be
+	// modified.
+	TaskPayload map[string]interface{}
+	// Argument is the text following ':' in '${NAME:argument}', empty string if
+	// no argument was given.
+	Argument string
+}
+
+// builtinPayloadVariables are variables provided by the worker itself, plugins
+// cannot declare variables with these names.
+var builtinPayloadVariables = map[string]PayloadVariable{
+	"TASK_ID": func(o PayloadVariableOptions) (string, error) {
+		return o.TaskInfo.TaskID, nil
+	},
+	"RUN_ID": func(o PayloadVariableOptions) (string, error) {
+		return strconv.Itoa(o.TaskInfo.RunID), nil
+	},
+	"PROVISIONER_ID": func(o PayloadVariableOptions) (string, error) {
+		return o.Environment.ProvisionerID, nil
+	},
+	"WORKER_TYPE": func(o PayloadVariableOptions) (string, error) {
+		return o.Environment.WorkerType, nil
+	},
+	"WORKER_GROUP": func(o PayloadVariableOptions) (string, error) {
+		return o.Environment.WorkerGroup, nil
+	},
+	"WORKER_ID": func(o PayloadVariableOptions) (string, error) {
+		return o.Environment.WorkerID, nil
+	},
+}
+
+// payloadVariablePattern matches '${NAME}', '${NAME:argument}' and the escaped
+// forms '$${NAME}' and '$${NAME:argument}'.
+var payloadVariablePattern = regexp.MustCompile(`\$(\$?)\{([A-Z][A-Z0-9_]*)(?::([^}]*))?\}`)
+
+// ExpandPayload returns a copy of payload where occurrences of '${NAME}' and
+// '${NAME:argument}' in strings are substituted with the value of the variable
+// NAME from variables. Occurrences of variables not in variables are left
+// as-is, and '$${NAME}' is replaced with '${NAME}', allowing a literal string
+// to be written.
+//
+// This should be applied after the payload has been validated, as values are
+// only substituted in strings, and not in object keys. If a variable fails
+// with an InfrastructureError, this error is returned, otherwise errors are
+// merged into a single MalformedPayloadError.
+func ExpandPayload(
+	payload map[string]interface{}, variables map[string]PayloadVariable, options PayloadVariableOptions,
+) (map[string]interface{}, error) {
+	options.TaskPayload = payload
+	var errs []runtime.MalformedPayloadError
+	var ierr error
+	expand := func(s string) string {
+		return payloadVariablePattern.ReplaceAllStringFunc(s, func(match string) string {
+			m := payloadVariablePattern.FindStringSubmatch(match)
+			escaped, name, argument := m[1] != "", m[2], m[3]
+			variable, ok := variables[name]
+			if !ok {
+				return match
+			}
+			if escaped {
+				return match[1:]
+			}
+			o := options
+			o.Argument = argument
+			value, err := variable(o)
+			if e, ok := runtime.IsMalformedPayloadError(err); ok {
+				errs = append(errs, e)
+			} else if _, ok := runtime.IsInfrastructureError(err); ok {
+				ierr = err
+			} else if err != nil {
+				errs = append(errs, runtime.NewMalformedPayloadError(
+					"unable to resolve ", match, " in task.payload, error: ", err,
+				))
+			}
+			return value
+		})
+	}
+	result := expandValue(payload, expand).(map[string]interface{})
+	if ierr != nil {
+		return nil, ierr
+	}
+	if len(errs) > 0 {
+		return nil, runtime.MergeMalformedPayload(errs...)
+	}
+	return result, nil
+}
+
+// expandValue returns a copy of value with expand applied to all strings
+func expandValue(value interface{}, expand func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expand(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			result[key] = expandValue(val, expand)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = expandValue(val, expand)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// mergePayloadVariables returns builtin variables and variables from plugins,
+// an error is returned if two plugins declare the same variable.
+func mergePayloadVariables(plugins []Plugin, names []string) (map[string]PayloadVariable, error) {
+	variables := make(map[string]PayloadVariable, len(builtinPayloadVariables))
+	owner := make(map[string]string)
+	for name, variable := range builtinPayloadVariables {
+		variables[name] = variable
+		owner[name] = "worker"
+	}
+	for i, plugin := range plugins {
+		for name, variable := range plugin.PayloadVariables() {
+			if !payloadVariablePattern.MatchString("${" + name + "}") {
+				return nil, fmt.Errorf("plugin '%s' declares invalid payload variable name '%s'", names[i], name)
+			}
+			if o, ok := owner[name]; ok {
+				return nil, fmt.Errorf("payload variable '%s' is declared by both '%s' and '%s'", name, o, names[i])
+			}
+			variables[name] = variable
+			owner[name] = names[i]
+		}
+	}
+	return variables, nil
+}
@@ -0,0 +1,69 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+func TestExpandPayload(t *testing.T) {
+	variables := map[string]PayloadVariable{
+		"TASK_ID": builtinPayloadVariables["TASK_ID"],
+		"ECHO": func(o PayloadVariableOptions) (string, error) {
+			return o.Argument, nil
+		},
+	}
+	payload := map[string]interface{}{
+		"command": []interface{}{"run", "--task=${TASK_ID}", "${ECHO:hello world}"},
+		"env": map[string]interface{}{
+			"HOME":    "${HOME}",
+			"LITERAL": "$${TASK_ID}",
+		},
+		"maxRunTime": 600,
+	}
+	result, err := ExpandPayload(payload, variables, PayloadVariableOptions{
+		TaskInfo: &runtime.TaskInfo{TaskID: "abc123"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"command": []interface{}{"run", "--task=abc123", "hello world"},
+		"env": map[string]interface{}{
+			"HOME":    "${HOME}",
+			"LITERAL": "${TASK_ID}",
+		},
+		"maxRunTime": 600,
+	}, result)
+
+	// Original payload must not be modified
+	require.Equal(t, "--task=${TASK_ID}", payload["command"].([]interface{})[1])
+}
+
+func TestExpandPayloadError(t *testing.T) {
+	variables := map[string]PayloadVariable{
+		"FAIL": func(o PayloadVariableOptions) (string, error) {
+			return "", runtime.NewMalformedPayloadError("no such thing: ", o.Argument)
+		},
+	}
+	_, err := ExpandPayload(map[string]interface{}{
+		"value": "${FAIL:x}",
+	}, variables, PayloadVariableOptions{})
+	_, ok := runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError")
+}
+
+func TestExpandPayloadInfrastructureError(t *testing.T) {
+	variables := map[string]PayloadVariable{
+		"FAIL": func(o PayloadVariableOptions) (string, error) {
+			return "", runtime.NewMalformedPayloadError("no such thing: ", o.Argument)
+		},
+		"BROKEN": func(o PayloadVariableOptions) (string, error) {
+			return "", runtime.NewInfrastructureError("service unavailable")
+		},
+	}
+	_, err := ExpandPayload(map[string]interface{}{
+		"value": []interface{}{"${FAIL:x}", "${BROKEN}"},
+	}, variables, PayloadVariableOptions{})
+	_, ok := runtime.IsInfrastructureError(err)
+	require.True(t, ok, "expected InfrastructureError")
+}
@@ -16,8 +16,15 @@ import (
 type TaskPluginOptions struct {
 	TaskInfo    *runtime.TaskInfo
 	TaskContext *runtime.TaskContext
-	Payload     map[string]interface{}
+	Payload     map[string]interface{} // Properties from PayloadSchema()
+	// Entire task.payload validated against the payload schema merged from
+	// engine and plugins, nil if task.payload isn't valid. This must not be
+	// modified, and plugins should only read properties they declare in
+	// PayloadSchema() from Payload.
+	TaskPayload map[string]interface{}
+	Scopes      []string // task.scopes, must not be modified
 	Monitor     runtime.Monitor
+	HookTimings *HookTimings // Time spent in hooks by each plugin, may be nil
 	// Note: This is passed by-value for efficiency (and to prohibit nil), if
 	// adding any large fields please consider adding them as pointers.
 	// Note: This is intended to be a simple argument wrapper, do not add methods
@@ -44,6 +51,11 @@ type Plugin interface {
 	// metadata will be discarded and additionalProperties will not be allowed.
 	PayloadSchema() schematypes.Object
 
+	// PayloadMigrations returns migrations for converting payloads declaring an
+	// older 'payloadVersion' to the format accepted by PayloadSchema(), see
+	// engines.Engine for details.
+	PayloadMigrations() []runtime.PayloadMigration
+
 	// NewTaskPlugin method will be called once for each task. The TaskPlugin
 	// instance returned will be called for each stage in the task execution.
 	//
@@ -63,6 +75,15 @@ type Plugin interface {
 	// Non-fatal errors: MalformedPayloadError
 	NewTaskPlugin(options TaskPluginOptions) (TaskPlugin, error)
 
+	// PayloadVariables returns a mapping from variable name to PayloadVariable
+	// for variables this plugin resolves in task.payload strings.
+	//
+	// If payload templating is enabled, occurrences of '${NAME}' and
+	// '${NAME:argument}' in task.payload strings are substituted after the
+	// payload has been validated. Names must match '[A-Z][A-Z0-9_]*' and
+	// cannot be declared by more than one plugin.
+	PayloadVariables() map[string]PayloadVariable
+
 	// ReportIdle is called if the worker is idle prior to polling for tasks.
 	// The durationSinceBusy is the time since the worker as last busy.
 	//
@@ -191,11 +212,22 @@ func (PluginBase) PayloadSchema() schematypes.Object {
 	return schematypes.Object{}
 }
 
+// PayloadMigrations returns no migrations, as the payload format has never
+// changed.
+func (PluginBase) PayloadMigrations() []runtime.PayloadMigration {
+	return nil
+}
+
 // NewTaskPlugin returns TaskPluginBase{} which ignores all the stages.
 func (PluginBase) NewTaskPlugin(TaskPluginOptions) (TaskPlugin, error) {
 	return TaskPluginBase{}, nil
 }
 
+// PayloadVariables returns no variables.
+func (PluginBase) PayloadVariables() map[string]PayloadVariable {
+	return nil
+}
+
 // ReportIdle does nothing
 func (PluginBase) ReportIdle(time.Duration) {}
 
@@ -2,6 +2,8 @@ package plugins
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -40,13 +42,19 @@ type PluginManager struct {
 	plugins       []Plugin
 	pluginNames   []string
 	monitors      []runtime.Monitor
+	variables     map[string]PayloadVariable
+	migrations    []runtime.PayloadMigration
+	features      map[string]bool // plugin name -> true, if tasks may use it
 }
 
 type taskPluginManager struct {
 	monitor     runtime.Monitor
 	taskPlugins []TaskPlugin
 	monitors    []runtime.Monitor
+	names       []string
+	timings     *HookTimings
 	context     *runtime.TaskContext
+	engine      string // name of the engine, used for error fingerprints
 	working     atomics.Bool
 }
 
@@ -87,8 +95,12 @@ func PluginManagerConfigSchema() schematypes.Object {
 	plugins := Plugins()
 
 	pluginNames := []string{}
+	features := schematypes.Properties{}
 	for name := range plugins {
 		pluginNames = append(pluginNames, name)
+		features[name] = schematypes.Boolean{
+			Title: fmt.Sprintf("Allow '%s' Feature", name),
+		}
 	}
 
 	s := schematypes.Object{
@@ -111,6 +123,21 @@ func PluginManagerConfigSchema() schematypes.Object {
 					Options: pluginNames,
 				},
 			},
+			"features": schematypes.Object{
+				Title: "Features",
+				Description: util.Markdown(`
+					Mapping from plugin name to a boolean indicating if tasks may
+					request the feature provided by the plugin, e.g.
+					'{"interactive": false, "reboot": true}'. Tasks that specify any
+					of the 'task.payload' properties of a plugin that is set to
+					'false' are resolved 'malformed-payload'.
+
+					This allows the security posture of a worker type to be expressed
+					in one place, without disabling the plugin. Plugins not listed
+					here may be used by all tasks.
+				`),
+				Properties: features,
+			},
 		},
 	}
 	for name, provider := range plugins {
@@ -124,6 +151,16 @@ func PluginManagerConfigSchema() schematypes.Object {
 	return s
 }
 
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // stringContains returns true if list contains element
 func stringContains(list []string, element string) bool {
 	for _, s := range list {
@@ -161,10 +198,16 @@ func NewPluginManager(options PluginOptions) (*PluginManager, error) {
 		schematypes.MustValidateAndMap(configSchema.Properties["disabled"], config["disabled"], &disabled)
 	}
 
+	// Find features tasks may request
+	features := make(map[string]bool)
+	if _, ok := config["features"]; ok {
+		schematypes.MustValidateAndMap(configSchema.Properties["features"], config["features"], &features)
+	}
+
 	// Find list of enabled plugins
 	for name := range config {
-		// Ignore disabled plugins as well as the 'disabled' key
-		if !stringContains(disabled, name) && name != "disabled" {
+		// Ignore disabled plugins as well as the 'disabled' and 'features' keys
+		if !stringContains(disabled, name) && name != "disabled" && name != "features" {
 			enabled = append(enabled, name)
 		}
 	}
@@ -216,16 +259,38 @@ func NewPluginManager(options PluginOptions) (*PluginManager, error) {
 		return nil, fmt.Errorf("Conflicting payload schema types, error: %s", err)
 	}
 
+	// Collect payload variables
+	variables, err := mergePayloadVariables(plugins, enabled)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect payload migrations, these are applied in order of version
+	var migrations []runtime.PayloadMigration
+	for _, plugin := range plugins {
+		migrations = append(migrations, plugin.PayloadMigrations()...)
+	}
+
 	return &PluginManager{
 		environment:   *options.Environment,
 		plugins:       plugins,
 		pluginNames:   enabled,
 		payloadSchema: schema,
+		variables:     variables,
+		migrations:    migrations,
+		features:      features,
 		monitors:      monitors,
 		monitor:       options.Monitor.WithPrefix("manager").WithTag("plugin", "manager"),
 	}, nil
 }
 
+// PluginNames returns the sorted list of names of the managed plugins.
+func (pm *PluginManager) PluginNames() []string {
+	names := append([]string{}, pm.pluginNames...)
+	sort.Strings(names)
+	return names
+}
+
 // Documentation will collect documentation from all managed plugins.
 func (pm *PluginManager) Documentation() []runtime.Section {
 	pluginDocs := make([][]runtime.Section, len(pm.plugins))
@@ -315,6 +380,17 @@ func (pm *PluginManager) PayloadSchema() schematypes.Object {
 	return pm.payloadSchema
 }
 
+// PayloadMigrations returns payload migrations from all managed plugins.
+func (pm *PluginManager) PayloadMigrations() []runtime.PayloadMigration {
+	return pm.migrations
+}
+
+// PayloadVariables returns the builtin payload variables combined with
+// variables from all managed plugins.
+func (pm *PluginManager) PayloadVariables() map[string]PayloadVariable {
+	return pm.variables
+}
+
 // NewTaskPlugin constructs a TaskPlugin wrapping all the managed plugins whose
 // PayloadSchema is satisfied by options.Payload.
 //
@@ -326,7 +402,10 @@ func (pm *PluginManager) NewTaskPlugin(options TaskPluginOptions) (TaskPlugin, e
 		monitor:     options.Monitor.WithPrefix("manager").WithTag("plugin", "manager"),
 		taskPlugins: make([]TaskPlugin, N),
 		monitors:    make([]runtime.Monitor, N),
+		names:       pm.pluginNames,
+		timings:     newHookTimings(),
 		context:     options.TaskContext,
+		engine:      pm.environment.Engine,
 	}
 
 	// Create monitors
@@ -337,6 +416,13 @@ func (pm *PluginManager) NewTaskPlugin(options TaskPluginOptions) (TaskPlugin, e
 	// Create taskPlugins
 	err := m.spawnEachPlugin("NewTaskPlugin", func(i int) error {
 		payload := pm.plugins[i].PayloadSchema().Filter(options.Payload)
+		if allowed, ok := pm.features[pm.pluginNames[i]]; ok && !allowed && len(payload) > 0 {
+			m.taskPlugins[i] = TaskPluginBase{}
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"the '%s' feature is not enabled on this worker type, task.payload must not specify: %s",
+				pm.pluginNames[i], strings.Join(sortedKeys(payload), ", "),
+			))
+		}
 		nerr := pm.plugins[i].PayloadSchema().Validate(payload)
 		if nerr != nil {
 			// Ensure that we always have a taskPlugin, even if we get an error.
@@ -349,7 +435,10 @@ func (pm *PluginManager) NewTaskPlugin(options TaskPluginOptions) (TaskPlugin, e
 			TaskInfo:    options.TaskInfo,
 			TaskContext: options.TaskContext,
 			Payload:     payload,
+			TaskPayload: options.TaskPayload,
+			Scopes:      options.Scopes,
 			Monitor:     m.monitors[i],
+			HookTimings: m.timings,
 		})
 		if m.taskPlugins[i] == nil {
 			m.taskPlugins[i] = TaskPluginBase{}
@@ -377,18 +466,22 @@ func (m *taskPluginManager) spawnEachPlugin(hook string, fn func(i int) error) e
 	errors := make([]error, N)
 	spawn(N, func(i int) {
 		monitor := m.monitors[i].WithTag("hook", hook)
+		start := time.Now()
 		incidentID := capturePanicOrTimeout(monitor, func() {
 			errors[i] = fn(i)
 		})
+		m.timings.record(m.names[i], hook, time.Since(start))
+		var fingerprint string
 		if _, ok := runtime.IsMalformedPayloadError(errors[i]); !ok && errors[i] != nil {
 			// Both of these errors assumes that the error has been logged and recorded
 			if errors[i] != runtime.ErrFatalInternalError && errors[i] != runtime.ErrNonFatalInternalError {
 				incidentID = monitor.ReportError(errors[i], "Unhandled error during ", hook, " hook")
+				fingerprint = runtime.ErrorFingerprint(errors[i], m.engine, 0)
 			}
 		}
 		if incidentID != "" {
 			errors[i] = runtime.ErrFatalInternalError
-			m.context.LogError("Unhandled worker error encountered incidentID=", incidentID)
+			m.context.LogError(runtime.IncidentMessage(incidentID, fingerprint))
 		}
 	})
 
@@ -483,7 +576,8 @@ func (m *taskPluginManager) Dispose() error {
 		// Errors are not allowed from Dispose()
 		if err != nil && err != runtime.ErrFatalInternalError && err != runtime.ErrNonFatalInternalError {
 			incidentID := m.monitors[i].WithTag("hook", "Dispose").ReportError(err, "Dispose() may not return errors")
-			m.context.LogError("Unhandled worker error encountered incidentID=", incidentID)
+			fingerprint := runtime.ErrorFingerprint(err, m.engine, 0)
+			m.context.LogError(runtime.IncidentMessage(incidentID, fingerprint))
 			err = runtime.ErrFatalInternalError
 		}
 		return err
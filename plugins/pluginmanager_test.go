@@ -0,0 +1,85 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+type featureTestProvider struct {
+	PluginProviderBase
+}
+
+func (featureTestProvider) NewPlugin(PluginOptions) (Plugin, error) {
+	return featureTestPlugin{}, nil
+}
+
+type featureTestPlugin struct {
+	PluginBase
+}
+
+func (featureTestPlugin) PayloadSchema() schematypes.Object {
+	return schematypes.Object{
+		Properties: schematypes.Properties{
+			"featureTest": schematypes.Boolean{},
+		},
+	}
+}
+
+func init() {
+	Register("feature-test", featureTestProvider{})
+}
+
+func TestPluginManagerFeatures(t *testing.T) {
+	monitor := mocks.NewMockMonitor(false)
+	newTaskPlugin := func(features, payload map[string]interface{}) error {
+		pm, err := NewPluginManager(PluginOptions{
+			Environment: &runtime.Environment{Monitor: monitor},
+			Monitor:     monitor,
+			Config: map[string]interface{}{
+				"feature-test": map[string]interface{}{},
+				"features":     features,
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"feature-test"}, pm.PluginNames())
+		_, err = pm.NewTaskPlugin(TaskPluginOptions{
+			TaskInfo:    &runtime.TaskInfo{},
+			TaskContext: &runtime.TaskContext{},
+			Payload:     payload,
+			Monitor:     monitor,
+		})
+		return err
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		err := newTaskPlugin(map[string]interface{}{"feature-test": true}, map[string]interface{}{
+			"featureTest": true,
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("not-listed", func(t *testing.T) {
+		err := newTaskPlugin(map[string]interface{}{}, map[string]interface{}{
+			"featureTest": true,
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		err := newTaskPlugin(map[string]interface{}{"feature-test": false}, map[string]interface{}{
+			"featureTest": true,
+		})
+		e, ok := runtime.IsMalformedPayloadError(err)
+		require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+		require.Contains(t, e.Error(), "'feature-test' feature is not enabled")
+	})
+
+	t.Run("forbidden-not-requested", func(t *testing.T) {
+		err := newTaskPlugin(map[string]interface{}{"feature-test": false}, map[string]interface{}{})
+		require.NoError(t, err)
+	})
+}
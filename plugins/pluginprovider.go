@@ -53,6 +53,7 @@ func (PluginProviderBase) ConfigSchema() schematypes.Schema {
 
 var reservedPluginNames = []string{
 	"disabled", // Config key used for configuration of disabled plugins
+	"features", // Config key used for configuration of allowed features
 	"manager",  // Used as monitor prefix for pluginManager
 }
 
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	rt "runtime"
 	"testing"
+	"time"
 
 	"github.com/taskcluster/slugid-go/slugid"
 
@@ -118,8 +119,11 @@ func (c Case) Test() {
 	}
 
 	context, controller, err := runtime.NewTaskContext(runtimeEnvironment.TemporaryStorage.NewFilePath(), runtime.TaskInfo{
-		TaskID: taskID,
-		RunID:  c.RunID,
+		TaskID:   taskID,
+		RunID:    c.RunID,
+		Created:  time.Now(),
+		Deadline: time.Now().Add(1 * time.Hour),
+		Expires:  time.Now().Add(24 * time.Hour),
 	})
 	nilOrPanic(err)
 
@@ -164,6 +168,8 @@ func (c Case) Test() {
 		TaskInfo:    &context.TaskInfo,
 		TaskContext: context,
 		Payload:     parsePluginPayload(p, c.Payload),
+		TaskPayload: parseTaskPayload(c.Payload),
+		Scopes:      context.Scopes,
 		Monitor:     runtimeEnvironment.Monitor.WithTag("plugin", c.Plugin).WithTag("taskId", taskID),
 	})
 	nilOrPanic(err, "plugin.NewTaskPlugin failed")
@@ -355,6 +361,13 @@ func parsePluginPayload(plugin plugins.Plugin, payload string) map[string]interf
 	return jsonPayload
 }
 
+func parseTaskPayload(payload string) map[string]interface{} {
+	var jsonPayload map[string]interface{}
+	err := json.Unmarshal([]byte(payload), &jsonPayload)
+	nilOrPanic(err, "Payload parsing failed: ", payload)
+	return jsonPayload
+}
+
 func nilOrPanic(err error, a ...interface{}) {
 	if err != nil {
 		log.Panic(append(a, err)...)
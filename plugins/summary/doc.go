@@ -0,0 +1,12 @@
+// Package summary provides a taskcluster-worker plugin that uploads a
+// machine-readable summary of the task run as 'public/summary.json'.
+//
+// The summary includes resolution, time spent in each phase of the task run,
+// time spent in each plugin hook, resource usage reported by the engine and
+// the list of artifacts created. This allows analytics to consume task runs
+// without parsing the task log.
+package summary
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("summary")
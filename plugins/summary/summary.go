@@ -0,0 +1,197 @@
+package summary
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+const artifactName = "public/summary.json"
+
+type pluginProvider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	context     *runtime.TaskContext
+	monitor     runtime.Monitor
+	hookTimings *plugins.HookTimings
+	m           sync.Mutex
+	phases      []phase
+	usage       *engines.ResourceUsage
+}
+
+// phase marks the start of a phase in the task run
+type phase struct {
+	name  string
+	start time.Time
+}
+
+// summary is the structure uploaded as artifact
+type summary struct {
+	TaskID        string                        `json:"taskId"`
+	RunID         int                           `json:"runId"`
+	State         string                        `json:"state"`
+	Reason        string                        `json:"reason,omitempty"`
+	Started       time.Time                     `json:"started"`
+	Resolved      time.Time                     `json:"resolved"`
+	Phases        map[string]float64            `json:"phases"`
+	Plugins       map[string]map[string]float64 `json:"plugins"`
+	ResourceUsage *resourceUsage                `json:"resourceUsage,omitempty"`
+	Artifacts     []string                      `json:"artifacts"`
+}
+
+type resourceUsage struct {
+	UserTime   float64 `json:"userTime"`
+	SystemTime float64 `json:"systemTime"`
+}
+
+func init() {
+	plugins.Register("summary", pluginProvider{})
+}
+
+func (pluginProvider) NewPlugin(plugins.PluginOptions) (plugins.Plugin, error) {
+	return plugin{}, nil
+}
+
+func (plugin) Documentation() []runtime.Section {
+	return []runtime.Section{
+		{
+			Title: "Task Run Summary",
+			Content: util.Markdown(`
+				When the task is resolved a machine-readable summary is uploaded as
+				'` + artifactName + `'. The summary contains the resolution ('state'
+				and 'reason'), the time in seconds spent in each phase ('prepare',
+				'build', 'execute', 'stop'), the time in seconds spent in each plugin
+				hook, CPU time consumed by the sandbox (if supported by the engine),
+				and the artifacts created before the summary was uploaded.
+			`),
+		},
+	}
+}
+
+func (plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	tp := &taskPlugin{
+		context:     options.TaskContext,
+		monitor:     options.Monitor,
+		hookTimings: options.HookTimings,
+	}
+	tp.mark("prepare")
+	return tp, nil
+}
+
+// mark the start of a new phase
+func (tp *taskPlugin) mark(name string) {
+	tp.m.Lock()
+	defer tp.m.Unlock()
+	tp.phases = append(tp.phases, phase{name: name, start: time.Now()})
+}
+
+func (tp *taskPlugin) BuildSandbox(engines.SandboxBuilder) error {
+	tp.mark("build")
+	return nil
+}
+
+func (tp *taskPlugin) Started(engines.Sandbox) error {
+	tp.mark("execute")
+	return nil
+}
+
+func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
+	tp.mark("stop")
+
+	usage, err := result.ResourceUsage()
+	if err == nil {
+		tp.m.Lock()
+		tp.usage = &usage
+		tp.m.Unlock()
+	} else if err != engines.ErrFeatureNotSupported {
+		tp.monitor.ReportWarning(err, "failed to get resource usage from ResultSet")
+	}
+	return true, nil
+}
+
+func (tp *taskPlugin) Finished(success bool) error {
+	if success {
+		return tp.upload("completed", "")
+	}
+	return tp.upload("failed", "")
+}
+
+func (tp *taskPlugin) Exception(reason runtime.ExceptionReason) error {
+	return tp.upload("exception", reason.String())
+}
+
+// build constructs the summary to be uploaded
+func (tp *taskPlugin) build(state, reason string) summary {
+	tp.m.Lock()
+	defer tp.m.Unlock()
+
+	now := time.Now()
+	s := summary{
+		TaskID:    tp.context.TaskID,
+		RunID:     tp.context.RunID,
+		State:     state,
+		Reason:    reason,
+		Resolved:  now,
+		Phases:    make(map[string]float64),
+		Plugins:   make(map[string]map[string]float64),
+		Artifacts: tp.context.Artifacts(),
+	}
+	for i, p := range tp.phases {
+		end := now
+		if i+1 < len(tp.phases) {
+			end = tp.phases[i+1].start
+		}
+		s.Phases[p.name] = end.Sub(p.start).Seconds()
+	}
+	if len(tp.phases) > 0 {
+		s.Started = tp.phases[0].start
+	}
+	for name, hooks := range tp.hookTimings.Snapshot() {
+		s.Plugins[name] = make(map[string]float64, len(hooks))
+		for hook, duration := range hooks {
+			s.Plugins[name][hook] = duration.Seconds()
+		}
+	}
+	if tp.usage != nil {
+		s.ResourceUsage = &resourceUsage{
+			UserTime:   tp.usage.UserTime.Seconds(),
+			SystemTime: tp.usage.SystemTime.Seconds(),
+		}
+	}
+	return s
+}
+
+func (tp *taskPlugin) upload(state, reason string) error {
+	data, err := json.MarshalIndent(tp.build(state, reason), "", "  ")
+	if err != nil {
+		panic(errors.Wrap(err, "failed to serialize summary as JSON"))
+	}
+
+	debug("uploading %s", artifactName)
+	err = tp.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     artifactName,
+		Mimetype: "application/json",
+		Expires:  tp.context.TaskInfo.Expires,
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+	})
+	if err != nil {
+		tp.monitor.ReportWarning(err, "failed to upload ", artifactName)
+		return runtime.ErrNonFatalInternalError
+	}
+	return nil
+}
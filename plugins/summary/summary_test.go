@@ -0,0 +1,83 @@
+package summary
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/worker/workertest"
+
+	_ "github.com/taskcluster/taskcluster-worker/engines/mock"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/livelog"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/success"
+)
+
+const testPluginConfig = `{
+	"disabled": [],
+	"success": {},
+	"livelog": {},
+	"summary": {}
+}`
+
+// summaryArtifact creates an assertion that parses the summary and checks
+// the resolution
+func summaryArtifact(state, reason string) func(t *testing.T, a workertest.Artifact) {
+	return func(t *testing.T, a workertest.Artifact) {
+		var s summary
+		require.NoError(t, json.Unmarshal(a.Data, &s), "failed to parse summary")
+		assert.Equal(t, state, s.State)
+		assert.Equal(t, reason, s.Reason)
+		assert.Contains(t, s.Phases, "prepare")
+		assert.Contains(t, s.Plugins, "livelog")
+		assert.Contains(t, s.Plugins["summary"], "NewTaskPlugin")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	workertest.Case{
+		Engine:       "mock",
+		Concurrency:  1,
+		EngineConfig: `{}`,
+		PluginConfig: testPluginConfig,
+		Tasks: []workertest.Task{
+			{
+				Title:   "Task Success",
+				Success: true,
+				Payload: `{
+					"delay": 10,
+					"function": "true",
+					"argument": ""
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/summary.json":          summaryArtifact("completed", ""),
+					"public/logs/live_backing.log": workertest.AnyArtifact(),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+				},
+			}, {
+				Title:   "Task Failure",
+				Success: false,
+				Payload: `{
+					"delay": 10,
+					"function": "false",
+					"argument": ""
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/summary.json":          summaryArtifact("failed", ""),
+					"public/logs/live_backing.log": workertest.AnyArtifact(),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+				},
+			}, {
+				Title:     "Task Malformed Payload",
+				Exception: runtime.ReasonMalformedPayload,
+				Payload:   `{}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/summary.json":          summaryArtifact("exception", "malformed-payload"),
+					"public/logs/live_backing.log": workertest.AnyArtifact(),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+				},
+			},
+		},
+	}.Test(t)
+}
@@ -18,6 +18,9 @@ var payloadSchema = schematypes.Object{
         proxy, often it is something like: 'http://<hostname>/<proxy>/<...>',
         hence, forwarding to the queue would be
         'http://<hostname>/tcproxy/queue.taskcluster.net/...'.
+        With the native and docker engines the URL of the proxy is given in
+        the environment variable 'TCPROXY_URL', such that forwarding to the
+        queue would be '${TCPROXY_URL}queue.taskcluster.net/...'.
       `),
 		},
 	},
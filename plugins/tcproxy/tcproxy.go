@@ -27,6 +27,7 @@ type taskPlugin struct {
 	plugins.TaskPluginBase
 	monitor runtime.Monitor
 	context *runtime.TaskContext
+	client  *http.Client
 }
 
 func init() {
@@ -53,6 +54,7 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskP
 	return &taskPlugin{
 		monitor: options.Monitor,
 		context: options.TaskContext,
+		client:  options.TaskContext.NewHTTPClient(runtime.HTTPClientOptions{}),
 	}, nil
 }
 
@@ -121,11 +123,8 @@ func (p *taskPlugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	req.Header.Set("Authorization", signature)
 
-	// Set TaskContext, so request can be aborted
-	req = req.WithContext(p.context)
-
-	// Send request
-	res, err := http.DefaultClient.Do(req)
+	// Send request, this is aborted if the task is resolved
+	res, err := p.client.Do(req)
 
 	// Handle task aborting
 	if p.context.Err() != nil {
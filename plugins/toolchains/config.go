@@ -0,0 +1,74 @@
+package toolchains
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type config struct {
+	MountPoint string      `json:"mountPoint"`
+	Options    interface{} `json:"options"`
+	Toolchains []toolchain `json:"toolchains"`
+}
+
+type toolchain struct {
+	Name      string      `json:"name"`
+	Reference interface{} `json:"reference"`
+	SHA256    string      `json:"sha256"`
+}
+
+var configSchema = schematypes.Object{
+	Title: "Toolchains Plugin",
+	Description: util.Markdown(`
+		Configuration for the toolchains plugin, which downloads toolchains when
+		the worker starts and exposes them read-only to all sandboxes.
+	`),
+	Properties: schematypes.Properties{
+		"mountPoint": schematypes.String{
+			Title: "Mount Point",
+			Description: util.Markdown(`
+				Mount point for the toolchains volume, the format depends on the
+				engine. Each toolchain is extracted into a folder with the name of
+				the toolchain, inside this volume.
+			`),
+		},
+		"options": schematypes.Object{
+			Title: "Volume Options",
+			Description: util.Markdown(`
+				Options for creating the toolchains volume, these must satisfy the
+				volume schema for the engine, which is also used for caches.
+			`),
+			AdditionalProperties: true,
+		},
+		"toolchains": schematypes.Array{
+			Title: "Toolchains",
+			Description: util.Markdown(`
+				List of toolchains to download when the worker starts, if any
+				toolchain cannot be downloaded the worker fails to start.
+			`),
+			Items: schematypes.Object{
+				Properties: schematypes.Properties{
+					"name": schematypes.String{
+						Title: "Name",
+						Description: util.Markdown(`
+							Name of the toolchain, this is the name of the folder the
+							toolchain is extracted to.
+						`),
+						Pattern: `^[a-zA-Z0-9_.-]{1,64}$`,
+					},
+					"reference": toolchainFetcher.Schema(),
+					"sha256": schematypes.String{
+						Title: "SHA256 as hex",
+						Description: util.Markdown(`
+							SHA256 hash of the toolchain archive, the worker fails to
+							start if the archive doesn't match this hash.
+						`),
+						Pattern: `^[0-9a-f]{64}$`,
+					},
+				},
+				Required: []string{"name", "reference", "sha256"},
+			},
+		},
+	},
+	Required: []string{"mountPoint", "toolchains"},
+}
@@ -0,0 +1,14 @@
+// Package toolchains provides a taskcluster-worker plugin that downloads
+// toolchains, such as compilers and SDKs, when the worker starts and exposes
+// them read-only to every sandbox.
+//
+// Toolchains are configured by the worker, not the task, hence, toolchains can
+// be shared between all tasks without being baked into every image or cache.
+// As toolchains are exposed to all tasks, only references that don't require
+// any scopes can be used, and each toolchain is verified against a sha256 hash
+// given in the configuration.
+package toolchains
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("toolchains")
@@ -0,0 +1,87 @@
+package toolchains
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+)
+
+// prefixFileSystem writes files and folders to a VolumeBuilder under prefix
+type prefixFileSystem struct {
+	engines.VolumeBuilder
+	prefix string
+}
+
+func (fs prefixFileSystem) WriteFolder(name string) error {
+	return fs.VolumeBuilder.WriteFolder(fs.prefix + name)
+}
+
+func (fs prefixFileSystem) WriteFile(name string) io.WriteCloser {
+	return fs.VolumeBuilder.WriteFile(fs.prefix + name)
+}
+
+// extractArchive extracts a TAR archive, which may be gzip compressed, from
+// source to target.
+func extractArchive(source io.Reader, target prefixFileSystem) error {
+	br := bufio.NewReader(source)
+	var r io.Reader = br
+	if head, _ := br.Peek(2); bytes.Equal(head, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return errors.Wrap(err, "error reading gzip compressed archive")
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "error reading TAR archive")
+		}
+
+		// Don't allow entries outside the folder for the toolchain
+		name := path.Clean(header.Name)
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("archive entry '%s' is outside the archive root", header.Name)
+		}
+
+		info := header.FileInfo()
+		if info.IsDir() {
+			debug("extracting folder: '%s'", name)
+			if err = target.WriteFolder(name); err != nil {
+				return errors.Wrap(err, "VolumeBuilder.WriteFolder() failed")
+			}
+		} else if info.Mode().IsRegular() {
+			debug("extracting file: '%s'", name)
+			w := target.WriteFile(name)
+			if _, err = io.Copy(w, tr); err != nil {
+				w.Close()
+				return errors.Wrapf(err, "failed to extract '%s'", name)
+			}
+			if err = w.Close(); err != nil {
+				return errors.Wrap(err, "VolumeBuilder.WriteFile().Close() failed")
+			}
+		} else {
+			return fmt.Errorf(
+				"archive entry '%s' with fileMode: %s is not supported",
+				header.Name, info.Mode().String(),
+			)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package toolchains
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// A fetcher for downloading toolchains
+var toolchainFetcher = fetcher.Combine(
+	// Allow fetching from URL
+	fetcher.URL,
+	// Allow fetching from queue artifacts
+	fetcher.Artifact,
+	// Allow fetching from queue referenced by index namespace
+	fetcher.Index,
+	// Allow fetching from URL + hash
+	fetcher.URLHash,
+)
+
+type provider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+	config config
+	volume engines.Volume // nil, if no toolchains are configured
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	plugin *plugin
+}
+
+// fetchContext implements fetcher.Context for fetching toolchains when the
+// worker starts, where there is no task context.
+type fetchContext struct {
+	context.Context
+	queue   client.Queue
+	monitor runtime.Monitor
+}
+
+func (c *fetchContext) Queue() client.Queue {
+	return c.queue
+}
+
+func (c *fetchContext) Progress(description string, percent float64) {
+	c.monitor.Infof("Fetching toolchain from: %s - %.0f %%", description, percent*100)
+}
+
+func init() {
+	plugins.Register("toolchains", &provider{})
+}
+
+func (p *provider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
+func (p *provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, error) {
+	var c config
+	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+	if c.Options == nil {
+		c.Options = map[string]interface{}{}
+	}
+	if err := options.Engine.VolumeSchema().Validate(c.Options); err != nil {
+		return nil, errors.Wrap(err, "toolchains volume 'options' doesn't satisfy the engine volume schema")
+	}
+
+	p2 := &plugin{config: c}
+	if len(c.Toolchains) == 0 {
+		return p2, nil
+	}
+
+	// Toolchains are fetched without credentials, this works for references
+	// that don't require any scopes, which are the only ones we allow.
+	q := queue.New(nil)
+	q.Authenticate = false
+	q.BaseURL = client.ServiceURL(options.Environment.RootURL, "queue", "v1")
+	ctx := &fetchContext{
+		Context: context.Background(),
+		queue:   q,
+		monitor: options.Monitor,
+	}
+
+	builder, err := options.Engine.NewVolumeBuilder(c.Options)
+	if err != nil {
+		if err == engines.ErrFeatureNotSupported {
+			return nil, errors.New("toolchains plugin requires an engine that supports volumes")
+		}
+		return nil, errors.Wrap(err, "failed to create VolumeBuilder for toolchains")
+	}
+	for _, tc := range c.Toolchains {
+		if err = fetchToolchain(ctx, options.Environment.TemporaryStorage, tc, builder); err != nil {
+			if derr := builder.Discard(); derr != nil {
+				options.Monitor.ReportError(derr, "VolumeBuilder.Discard() failed, after failed toolchain fetch")
+			}
+			return nil, err
+		}
+		options.Monitor.Infof("Loaded toolchain: '%s'", tc.Name)
+	}
+	p2.volume, err = builder.BuildVolume()
+	if err != nil {
+		return nil, errors.Wrap(err, "VolumeBuilder.BuildVolume() failed for toolchains")
+	}
+	return p2, nil
+}
+
+// fetchToolchain fetches tc, verifies the hash and extracts it into the folder
+// with the name of the toolchain in target.
+func fetchToolchain(ctx *fetchContext, storage runtime.TemporaryStorage, tc toolchain, target engines.VolumeBuilder) error {
+	ref, err := toolchainFetcher.NewReference(ctx, tc.Reference)
+	if err != nil {
+		return errors.Wrapf(err, "invalid reference for toolchain '%s'", tc.Name)
+	}
+	for _, scopes := range ref.Scopes() {
+		if len(scopes) != 0 {
+			return fmt.Errorf(
+				"toolchain '%s' requires scopes, only references that don't require scopes can be used for toolchains",
+				tc.Name,
+			)
+		}
+	}
+
+	file, err := storage.NewFile()
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file for toolchain")
+	}
+	defer file.Close()
+
+	if err = ref.Fetch(ctx, &fetcher.FileReseter{File: file}); err != nil {
+		return errors.Wrapf(err, "failed to fetch toolchain '%s'", tc.Name)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to start of temporary file")
+	}
+
+	// Verify hash of the toolchain
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return errors.Wrap(err, "failed to read temporary file")
+	}
+	if hash := hex.EncodeToString(h.Sum(nil)); hash != tc.SHA256 {
+		return fmt.Errorf("toolchain '%s' has sha256: %s, expected: %s", tc.Name, hash, tc.SHA256)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to start of temporary file")
+	}
+
+	return errors.Wrapf(
+		extractArchive(file, prefixFileSystem{target, tc.Name + "/"}),
+		"failed to extract toolchain '%s'", tc.Name,
+	)
+}
+
+func (p *plugin) Documentation() []runtime.Section {
+	if len(p.config.Toolchains) == 0 {
+		return nil
+	}
+	names := make([]string, len(p.config.Toolchains))
+	for i, tc := range p.config.Toolchains {
+		names[i] = "'" + tc.Name + "'"
+	}
+	return []runtime.Section{
+		{
+			Title: "Toolchains",
+			Content: util.Markdown(fmt.Sprintf(`
+				Toolchains provided by the worker are mounted read-only at '%s', each
+				toolchain is in a folder with the name of the toolchain. The following
+				toolchains are available: %s.
+			`, p.config.MountPoint, strings.Join(names, ", "))),
+		},
+	}
+}
+
+func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	if p.volume == nil {
+		return plugins.TaskPluginBase{}, nil
+	}
+	return &taskPlugin{plugin: p}, nil
+}
+
+func (p *plugin) Dispose() error {
+	if p.volume == nil {
+		return nil
+	}
+	return errors.Wrap(p.volume.Dispose(), "failed to dispose toolchains volume")
+}
+
+func (tp *taskPlugin) BuildSandbox(sandboxBuilder engines.SandboxBuilder) error {
+	err := sandboxBuilder.AttachVolume(tp.plugin.config.MountPoint, tp.plugin.volume, true)
+	if err == engines.ErrNamingConflict {
+		return runtime.NewMalformedPayloadError(fmt.Sprintf(
+			"the mount point '%s' is reserved for toolchains", tp.plugin.config.MountPoint,
+		))
+	}
+	return errors.Wrap(err, "failed to attach toolchains volume")
+}
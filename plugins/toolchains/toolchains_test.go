@@ -0,0 +1,160 @@
+package toolchains
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+	"github.com/taskcluster/taskcluster-worker/worker/workertest"
+
+	_ "github.com/taskcluster/taskcluster-worker/engines/mock"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/livelog"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/success"
+)
+
+// makeToolchain returns a gzipped TAR archive with a single file
+func makeToolchain(t *testing.T, name, text string) []byte {
+	buf := bytes.NewBuffer(nil)
+	zw := gzip.NewWriter(buf)
+	a := tar.NewWriter(zw)
+	err := a.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0755,
+		Size: int64(len(text)),
+	})
+	require.NoError(t, err, "failed to create file header in tar archive")
+	_, err = a.Write([]byte(text))
+	require.NoError(t, err, "failed to write file body in tar archive")
+	require.NoError(t, a.Close(), "failed to create tar archive")
+	require.NoError(t, zw.Close(), "failed to gzip tar archive")
+	return buf.Bytes()
+}
+
+func serveToolchain(data []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}))
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func TestToolchains(t *testing.T) {
+	data := makeToolchain(t, "bin/compiler", "hello-compiler")
+	s := serveToolchain(data)
+	defer s.Close()
+
+	workertest.Case{
+		Concurrency:  0, // runs tasks sequentially
+		Engine:       "mock",
+		EngineConfig: `{}`,
+		PluginConfig: `{
+			"disabled": [],
+			"success": {},
+			"livelog": {},
+			"toolchains": {
+				"mountPoint": "toolchains",
+				"toolchains": [{
+					"name": "my-toolchain",
+					"reference": {"url": "` + s.URL + `"},
+					"sha256": "` + sha256Hex(data) + `"
+				}]
+			}
+		}`,
+		Tasks: []workertest.Task{
+			{
+				Title: "Read from toolchain",
+				Payload: `{
+					"delay": 5,
+					"function": "read-volume",
+					"argument": "toolchains/my-toolchain/bin/compiler"
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("hello-compiler"),
+				},
+				AllowAdditional: true,
+				Success:         true,
+			},
+			{
+				Title: "Write to toolchain fails",
+				Payload: `{
+					"delay": 5,
+					"function": "write-volume",
+					"argument": "toolchains/my-toolchain/bin/compiler:hacked"
+				}`,
+				AllowAdditional: true,
+				Success:         false,
+			},
+			{
+				Title: "Toolchain is unmodified",
+				Payload: `{
+					"delay": 5,
+					"function": "read-volume",
+					"argument": "toolchains/my-toolchain/bin/compiler"
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("hello-compiler"),
+				},
+				AllowAdditional: true,
+				Success:         true,
+			},
+		},
+	}.TestWithFakeQueue(t)
+}
+
+func TestToolchainHashMismatch(t *testing.T) {
+	data := makeToolchain(t, "bin/compiler", "hello-compiler")
+	s := serveToolchain(data)
+	defer s.Close()
+
+	storage, err := runtime.NewTemporaryStorage(os.TempDir())
+	require.NoError(t, err)
+	environment := &runtime.Environment{
+		GarbageCollector: &gc.GarbageCollector{},
+		TemporaryStorage: storage,
+		Monitor:          mocks.NewMockMonitor(false),
+		ProvisionerID:    "dummy-provisioner",
+		WorkerType:       "dummy-worker-type",
+		WorkerGroup:      "dummy-worker-group",
+		WorkerID:         "dummy-worker-id",
+	}
+	engine, err := engines.Engines()["mock"].NewEngine(engines.EngineOptions{
+		Environment: environment,
+		Monitor:     environment.Monitor,
+	})
+	require.NoError(t, err)
+
+	_, err = (&provider{}).NewPlugin(plugins.PluginOptions{
+		Environment: environment,
+		Engine:      engine,
+		Monitor:     environment.Monitor,
+		Config: map[string]interface{}{
+			"mountPoint": "toolchains",
+			"toolchains": []interface{}{
+				map[string]interface{}{
+					"name":      "my-toolchain",
+					"reference": map[string]interface{}{"url": s.URL},
+					"sha256":    sha256Hex([]byte("something else")),
+				},
+			},
+		},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected: "+sha256Hex([]byte("something else")))
+}
@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// AdditionalLogPrefix is the prefix of artifact names for logs registered
+// with TaskContext.AddLog()
+const AdditionalLogPrefix = "public/logs/"
+
+var additionalLogNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// AdditionalLog is a log, other than the task log, which is uploaded as the
+// artifact AdditionalLogPrefix + Name when the task is resolved.
+//
+// This is useful for engines and plugins with logs that don't belong in the
+// task log, like the serial console of a virtual machine.
+type AdditionalLog struct {
+	Name     string // Name of the log, e.g. "serial.log"
+	Mimetype string // Defaults to "text/plain; charset=utf-8"
+	// Open the log for upload, this is called after the task log is closed, so
+	// no more data should be written to the log at this point.
+	Open func() (ioext.ReadSeekCloser, error)
+}
+
+// AddLog registers an additional log to be uploaded when the task is resolved,
+// returns an error if the name is invalid or already registered.
+func (c *TaskContext) AddLog(log AdditionalLog) error {
+	if !additionalLogNamePattern.MatchString(log.Name) {
+		return fmt.Errorf("invalid log name: '%s'", log.Name)
+	}
+	if log.Open == nil {
+		panic("AdditionalLog.Open must not be nil")
+	}
+	if log.Mimetype == "" {
+		log.Mimetype = "text/plain; charset=utf-8"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range c.additionalLogs {
+		if l.Name == log.Name {
+			return fmt.Errorf("log name: '%s' is already registered", log.Name)
+		}
+	}
+	c.additionalLogs = append(c.additionalLogs, log)
+	return nil
+}
+
+// AdditionalLogs returns logs registered with AddLog, in the order they were
+// registered.
+func (c *TaskContextController) AdditionalLogs() []AdditionalLog {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]AdditionalLog{}, c.additionalLogs...)
+}
@@ -0,0 +1,32 @@
+package runtime
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+func TestTaskContextAddLog(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	ctx, control, err := NewTaskContext(path, TaskInfo{})
+	require.NoError(t, err, "Failed to create context")
+	defer control.Dispose()
+	defer control.CloseLog()
+
+	open := func() (ioext.ReadSeekCloser, error) {
+		return ioext.NopCloser(bytes.NewReader([]byte("hello"))), nil
+	}
+	require.NoError(t, ctx.AddLog(AdditionalLog{Name: "serial.log", Open: open}))
+	require.Error(t, ctx.AddLog(AdditionalLog{Name: "serial.log", Open: open}), "duplicate name")
+	require.Error(t, ctx.AddLog(AdditionalLog{Name: "../serial.log", Open: open}), "invalid name")
+
+	logs := control.AdditionalLogs()
+	require.Len(t, logs, 1)
+	require.Equal(t, "serial.log", logs[0].Name)
+	require.Equal(t, "text/plain; charset=utf-8", logs[0].Mimetype)
+}
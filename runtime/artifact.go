@@ -1,19 +1,16 @@
 package runtime
 
 import (
-	"encoding/json"
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
 	got "github.com/taskcluster/go-got"
-	tcclient "github.com/taskcluster/taskcluster-client-go"
-	"github.com/taskcluster/taskcluster-client-go/queue"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
@@ -45,93 +42,56 @@ type RedirectArtifact struct {
 // UploadS3Artifact is responsible for creating new artifacts
 // in the queue and then performing the upload to s3.
 func (context *TaskContext) UploadS3Artifact(artifact S3Artifact) error {
-	req, err := json.Marshal(queue.S3ArtifactRequest{
-		ContentType: artifact.Mimetype,
-		Expires:     tcclient.Time(artifact.Expires),
-		StorageType: "s3",
-	})
-	if err != nil {
-		panic(errors.Wrap(err, "failed to Marshal json that should have worked"))
-	}
-
-	parsed, err := context.createArtifact(artifact.Name, req)
-	if err != nil {
-		return err
-	}
-	var resp queue.S3ArtifactResponse
-	if err = json.Unmarshal(parsed, &resp); err != nil {
-		panic(errors.Wrap(err, "failed to parse JSON that have been parsed before"))
-	}
-
-	return putArtifact(resp.PutURL, artifact.Mimetype, artifact.Stream, artifact.AdditionalHeaders)
+	return context.artifactUploader().UploadS3Artifact(context, artifact)
 }
 
 // CreateErrorArtifact is responsible for inserting error
 // artifacts into the queue.
 func (context *TaskContext) CreateErrorArtifact(artifact ErrorArtifact) error {
-	req, err := json.Marshal(queue.ErrorArtifactRequest{
-		Message:     artifact.Message,
-		Reason:      artifact.Reason,
-		Expires:     tcclient.Time(artifact.Expires),
-		StorageType: "error",
-	})
-	if err != nil {
-		return err
-	}
-
-	parsed, err := context.createArtifact(artifact.Name, req)
-	if err != nil {
-		return err
-	}
-
-	var resp queue.ErrorArtifactResponse
-	return json.Unmarshal(parsed, &resp)
+	return context.artifactUploader().CreateErrorArtifact(context, artifact)
 }
 
 // CreateRedirectArtifact is responsible for inserting redirect
 // artifacts into the queue.
 func (context *TaskContext) CreateRedirectArtifact(artifact RedirectArtifact) error {
-	req, err := json.Marshal(queue.RedirectArtifactRequest{
-		ContentType: artifact.Mimetype,
-		URL:         artifact.URL,
-		Expires:     tcclient.Time(artifact.Expires),
-		StorageType: "reference",
-	})
-	if err != nil {
-		return err
-	}
-
-	parsed, err := context.createArtifact(artifact.Name, req)
-	if err != nil {
-		return err
-	}
+	return context.artifactUploader().CreateRedirectArtifact(context, artifact)
+}
 
-	var resp queue.RedirectArtifactResponse
-	return json.Unmarshal(parsed, &resp)
+// SetArtifactUploader sets the ArtifactUploader used for creating artifacts,
+// if not set artifacts are uploaded with default settings.
+func (c *TaskContextController) SetArtifactUploader(uploader *ArtifactUploader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uploader = uploader
 }
 
-func (context *TaskContext) createArtifact(name string, req []byte) ([]byte, error) {
-	par := queue.PostArtifactRequest(req)
-	parsp, err := context.Queue().CreateArtifact(
-		context.TaskID,
-		strconv.Itoa(context.RunID),
-		name,
-		&par,
-	)
-	if err != nil {
-		return nil, err
+func (context *TaskContext) artifactUploader() *ArtifactUploader {
+	context.mu.RLock()
+	defer context.mu.RUnlock()
+	if context.uploader == nil {
+		return defaultArtifactUploader
 	}
-	return json.RawMessage(*parsp), nil
+	return context.uploader
 }
 
-func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArtifacts map[string]string) error {
+// Artifacts returns the names of artifacts created for the task so far, in
+// the order they were created.
+func (context *TaskContext) Artifacts() []string {
+	context.mu.RLock()
+	defer context.mu.RUnlock()
+	return append([]string{}, context.artifacts...)
+}
+
+// putArtifact uploads stream to urlStr with client making up to maxAttempts
+// attempts, returns the content-length and number of attempts made.
+func putArtifact(ctx context.Context, client *http.Client, urlStr, mime string, stream ioext.ReadSeekCloser, additionalArtifacts map[string]string, maxAttempts int) (int64, int, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
 		panic(errors.Wrap(err, "failed to parse URL"))
 	}
 	contentLength, err := stream.Seek(0, io.SeekEnd)
 	if err != nil {
-		return errors.Wrap(err, "failed to seek end of stream for content-length detection")
+		return 0, 0, errors.Wrap(err, "failed to seek end of stream for content-length detection")
 	}
 
 	header := make(http.Header)
@@ -143,14 +103,11 @@ func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArt
 
 	backoff := got.DefaultBackOff
 	attempts := 0
-	client := &http.Client{
-		Timeout: 10 * time.Minute, // There should be _some_ timeout, this seems like a good starting value.
-	}
 	for {
 		attempts++
 		_, err := stream.Seek(0, io.SeekStart)
 		if err != nil {
-			return errors.Wrap(err, "Failed to seek start before uploading stream")
+			return contentLength, attempts, errors.Wrap(err, "Failed to seek start before uploading stream")
 		}
 		req := &http.Request{
 			Method:        "PUT",
@@ -169,36 +126,45 @@ func putArtifact(urlStr, mime string, stream ioext.ReadSeekCloser, additionalArt
 				return ioutil.NopCloser(stream), nil
 			},
 		}
-		resp, err := client.Do(req)
+		resp, err := client.Do(req.WithContext(ctx))
 		if err != nil {
-			if attempts < 10 {
-				time.Sleep(backoff.Delay(attempts))
+			if attempts < maxAttempts && ctx.Err() == nil {
+				sleepContext(ctx, backoff.Delay(attempts))
 				continue
 			}
-			return errors.Wrap(err, "failed send request")
+			return contentLength, attempts, errors.Wrap(err, "failed send request")
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode/100 == 4 {
 			httpErr, err := httputil.DumpResponse(resp, true)
 			if err != nil {
-				return errors.Errorf("HTTP status: %d, and error dumping response: %s", resp.StatusCode, err)
+				return contentLength, attempts, errors.Errorf("HTTP status: %d, and error dumping response: %s", resp.StatusCode, err)
 			}
-			return errors.Errorf("HTTP status: %d, response: %s", resp.StatusCode, string(httpErr))
+			return contentLength, attempts, errors.Errorf("HTTP status: %d, response: %s", resp.StatusCode, string(httpErr))
 		}
 		if resp.StatusCode/100 == 5 {
-			// TODO: Make this configurable
-			if attempts < 10 {
-				time.Sleep(backoff.Delay(attempts))
+			if attempts < maxAttempts && ctx.Err() == nil {
+				sleepContext(ctx, backoff.Delay(attempts))
 				continue
 			} else {
 				httpErr, err := httputil.DumpResponse(resp, true)
 				if err != nil {
-					return errors.Errorf("HTTP status: %d, and error dumping response: %s", resp.StatusCode, err)
+					return contentLength, attempts, errors.Errorf("HTTP status: %d, and error dumping response: %s", resp.StatusCode, err)
 				}
-				return errors.Errorf("HTTP status: %d, response: %s", resp.StatusCode, string(httpErr))
+				return contentLength, attempts, errors.Errorf("HTTP status: %d, response: %s", resp.StatusCode, string(httpErr))
 			}
 		}
 		// If we've made it here, the upload has succeeded
-		return nil
+		return contentLength, attempts, nil
+	}
+}
+
+// sleepContext sleeps for duration, or until ctx is canceled
+func sleepContext(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
 	}
 }
@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -99,7 +100,7 @@ func TestPutArtifact200(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	err := putArtifact(ts.URL, "text/plain; charset=utf-8", ioext.NopCloser(&bytes.Reader{}), map[string]string{})
+	_, _, err := putArtifact(context.Background(), http.DefaultClient, ts.URL, "text/plain; charset=utf-8", ioext.NopCloser(&bytes.Reader{}), map[string]string{}, DefaultUploadAttempts)
 	if err != nil {
 		t.Error(err)
 	}
@@ -111,10 +112,13 @@ func TestPutArtifact400(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	err := putArtifact(ts.URL, "text/plain; charset=utf-8", ioext.NopCloser(&bytes.Reader{}), map[string]string{})
+	_, attempts, err := putArtifact(context.Background(), http.DefaultClient, ts.URL, "text/plain; charset=utf-8", ioext.NopCloser(&bytes.Reader{}), map[string]string{}, DefaultUploadAttempts)
 	if err == nil {
 		t.Fail()
 	}
+	if attempts != 1 {
+		t.Errorf("expected 4xx errors not to be retried, attempts: %d", attempts)
+	}
 }
 
 func TestPutArtifact500(t *testing.T) {
@@ -129,8 +133,47 @@ func TestPutArtifact500(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	err := putArtifact(ts.URL, "text/plain; charset=utf-8", ioext.NopCloser(&bytes.Reader{}), map[string]string{})
+	_, attempts, err := putArtifact(context.Background(), http.DefaultClient, ts.URL, "text/plain; charset=utf-8", ioext.NopCloser(&bytes.Reader{}), map[string]string{}, DefaultUploadAttempts)
 	if err != nil {
 		t.Error(err)
 	}
+	if attempts != 4 {
+		t.Errorf("expected 4 attempts, got: %d", attempts)
+	}
+}
+
+func TestPutArtifactMaxAttempts(t *testing.T) {
+	tries := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tries++
+		w.WriteHeader(500)
+	}))
+	defer ts.Close()
+
+	_, attempts, err := putArtifact(context.Background(), http.DefaultClient, ts.URL, "text/plain; charset=utf-8", ioext.NopCloser(&bytes.Reader{}), map[string]string{}, 2)
+	if err == nil {
+		t.Error("expected upload to fail")
+	}
+	if attempts != 2 || tries != 2 {
+		t.Errorf("expected 2 attempts, got: %d, tries: %d", attempts, tries)
+	}
+}
+
+func TestPutArtifactCanceled(t *testing.T) {
+	tries := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tries++
+		w.WriteHeader(500)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := putArtifact(ctx, http.DefaultClient, ts.URL, "text/plain; charset=utf-8", ioext.NopCloser(&bytes.Reader{}), map[string]string{}, DefaultUploadAttempts)
+	if err == nil {
+		t.Error("expected upload to fail")
+	}
+	if tries != 0 {
+		t.Errorf("expected no requests after cancel, got: %d", tries)
+	}
 }
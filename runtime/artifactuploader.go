@@ -0,0 +1,246 @@
+package runtime
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
+)
+
+// DefaultConcurrentUploads is the default maximum number of concurrent S3
+// artifact uploads across all tasks.
+const DefaultConcurrentUploads = 10
+
+// DefaultUploadAttempts is the default number of attempts made to upload an
+// S3 artifact, before giving up.
+const DefaultUploadAttempts = 10
+
+// uploadTimeout is the timeout for each attempt to upload an S3 artifact, there
+// should be _some_ timeout, this seems like a good starting value.
+const uploadTimeout = 10 * time.Minute
+
+// ArtifactUploaderOptions holds options for NewArtifactUploader.
+type ArtifactUploaderOptions struct {
+	// Monitor for reporting upload metrics, may be nil
+	Monitor Monitor
+	// Maximum number of concurrent S3 uploads, defaults to
+	// DefaultConcurrentUploads if zero.
+	ConcurrentUploads int
+	// Number of attempts made to upload an S3 artifact, defaults to
+	// DefaultUploadAttempts if zero.
+	Attempts int
+	// Maximum aggregate upload bandwidth in bytes per second, across all
+	// concurrent S3 uploads, zero means unlimited.
+	MaxBandwidth int64
+	// OperationTracker with which S3 uploads are registered, may be nil
+	Operations *OperationTracker
+	// Function to be called when an artifact has been created, and uploaded in
+	// the case of S3 artifacts, may be nil.
+	OnCreated func(context *TaskContext, name string)
+	// Metrics Registry in which upload sizes are recorded, may be nil
+	Metrics *metrics.Registry
+}
+
+// An ArtifactUploader creates artifacts with the queue and uploads S3
+// artifacts, retrying failed uploads and limiting the number of concurrent
+// uploads and upload bandwidth across all tasks sharing the ArtifactUploader.
+//
+// Engines and plugins should upload artifacts using the methods on
+// TaskContext, which uses the ArtifactUploader given to the
+// TaskContextController.
+type ArtifactUploader struct {
+	monitor  Monitor
+	slots    chan struct{}
+	attempts int
+	limiter  *ioext.RateLimiter // nil, if bandwidth is unlimited
+	ops      *OperationTracker  // nil, if operations aren't tracked
+	created  func(context *TaskContext, name string)
+	size     *metrics.Histogram
+}
+
+// defaultArtifactUploader is used by TaskContexts without an ArtifactUploader
+var defaultArtifactUploader = NewArtifactUploader(ArtifactUploaderOptions{})
+
+// NewArtifactUploader returns a new ArtifactUploader
+func NewArtifactUploader(options ArtifactUploaderOptions) *ArtifactUploader {
+	if options.ConcurrentUploads == 0 {
+		options.ConcurrentUploads = DefaultConcurrentUploads
+	}
+	if options.Attempts == 0 {
+		options.Attempts = DefaultUploadAttempts
+	}
+	u := &ArtifactUploader{
+		monitor:  options.Monitor,
+		slots:    make(chan struct{}, options.ConcurrentUploads),
+		attempts: options.Attempts,
+		ops:      options.Operations,
+		created:  options.OnCreated,
+		size: options.Metrics.Histogram(
+			"taskcluster_worker_artifact_upload_bytes",
+			"Size of S3 artifacts uploaded.",
+			metrics.ExponentialBuckets(1024, 4, 12),
+		),
+	}
+	if options.MaxBandwidth > 0 {
+		u.limiter = ioext.NewRateLimiter(options.MaxBandwidth)
+	}
+	return u
+}
+
+// UploadS3Artifact creates an S3 artifact for the task and uploads the stream.
+func (u *ArtifactUploader) UploadS3Artifact(context *TaskContext, artifact S3Artifact) error {
+	req, err := json.Marshal(queue.S3ArtifactRequest{
+		ContentType: artifact.Mimetype,
+		Expires:     tcclient.Time(artifact.Expires),
+		StorageType: "s3",
+	})
+	if err != nil {
+		panic(errors.Wrap(err, "failed to Marshal json that should have worked"))
+	}
+
+	// Wait for an upload slot before creating the artifact, so the signed
+	// PUT URL doesn't expire while waiting for other uploads. Stop waiting if
+	// the task is canceled, unless it was canceled before the upload started,
+	// as the task log is uploaded after the task has been canceled.
+	done := context.Done()
+	if context.Err() != nil {
+		done = nil
+	}
+	select {
+	case u.slots <- struct{}{}:
+		defer func() { <-u.slots }()
+	case <-done:
+		return context.Err()
+	}
+
+	parsed, err := u.createArtifact(context, artifact.Name, req)
+	if err != nil {
+		return err
+	}
+	var resp queue.S3ArtifactResponse
+	if err = json.Unmarshal(parsed, &resp); err != nil {
+		panic(errors.Wrap(err, "failed to parse JSON that have been parsed before"))
+	}
+
+	// Register the upload, so the stream isn't deleted while uploading
+	op := u.ops.Begin("artifact-upload")
+	defer op.Done()
+
+	stream := artifact.Stream
+	if u.limiter != nil {
+		stream = u.limiter.ReadSeekCloser(stream)
+	}
+
+	// Uploads are detached from the task, as the task log is uploaded after the
+	// task has been canceled
+	client := context.NewHTTPClient(HTTPClientOptions{
+		Timeout:  uploadTimeout,
+		Detached: true,
+	})
+
+	started := time.Now()
+	size, attempts, err := putArtifact(op.Context, client, resp.PutURL, artifact.Mimetype, stream, artifact.AdditionalHeaders, u.attempts)
+	if u.monitor != nil {
+		u.monitor.Count("upload.retries", float64(attempts-1))
+		if err != nil {
+			u.monitor.Count("upload.failed", 1)
+		} else {
+			u.monitor.Measure("upload.duration", time.Since(started).Seconds())
+			u.monitor.Count("upload.bytes", float64(size))
+		}
+	}
+	if err == nil {
+		u.size.Observe(float64(size))
+		u.notifyCreated(context, artifact.Name)
+	}
+	return err
+}
+
+// CreateErrorArtifact creates an error artifact for the task.
+func (u *ArtifactUploader) CreateErrorArtifact(context *TaskContext, artifact ErrorArtifact) error {
+	req, err := json.Marshal(queue.ErrorArtifactRequest{
+		Message:     artifact.Message,
+		Reason:      artifact.Reason,
+		Expires:     tcclient.Time(artifact.Expires),
+		StorageType: "error",
+	})
+	if err != nil {
+		return err
+	}
+
+	parsed, err := u.createArtifact(context, artifact.Name, req)
+	if err != nil {
+		return err
+	}
+
+	var resp queue.ErrorArtifactResponse
+	if err = json.Unmarshal(parsed, &resp); err != nil {
+		return err
+	}
+	u.notifyCreated(context, artifact.Name)
+	return nil
+}
+
+// CreateRedirectArtifact creates a redirect artifact for the task.
+func (u *ArtifactUploader) CreateRedirectArtifact(context *TaskContext, artifact RedirectArtifact) error {
+	req, err := json.Marshal(queue.RedirectArtifactRequest{
+		ContentType: artifact.Mimetype,
+		URL:         artifact.URL,
+		Expires:     tcclient.Time(artifact.Expires),
+		StorageType: "reference",
+	})
+	if err != nil {
+		return err
+	}
+
+	parsed, err := u.createArtifact(context, artifact.Name, req)
+	if err != nil {
+		return err
+	}
+
+	var resp queue.RedirectArtifactResponse
+	if err = json.Unmarshal(parsed, &resp); err != nil {
+		return err
+	}
+	u.notifyCreated(context, artifact.Name)
+	return nil
+}
+
+// notifyCreated calls the OnCreated function given in options, if any
+func (u *ArtifactUploader) notifyCreated(context *TaskContext, name string) {
+	if u.created != nil {
+		u.created(context, name)
+	}
+}
+
+// createArtifact calls queue.createArtifact, the queue client retries
+// requests that fail with 5xx errors.
+func (u *ArtifactUploader) createArtifact(context *TaskContext, name string, req []byte) ([]byte, error) {
+	par := queue.PostArtifactRequest(req)
+	parsp, err := context.Queue().CreateArtifact(
+		context.TaskID,
+		strconv.Itoa(context.RunID),
+		name,
+		&par,
+	)
+	if err != nil {
+		if u.monitor != nil {
+			u.monitor.Count("create.failed", 1)
+		}
+		return nil, err
+	}
+	if u.monitor != nil {
+		u.monitor.Count("create.success", 1)
+	}
+
+	context.mu.Lock()
+	context.artifacts = append(context.artifacts, name)
+	context.mu.Unlock()
+
+	return json.RawMessage(*parsp), nil
+}
@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"bytes"
+	goctx "context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+func TestArtifactUploaderConcurrency(t *testing.T) {
+	var m sync.Mutex
+	active := 0
+	maxActive := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		m.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		m.Lock()
+		active--
+		m.Unlock()
+	}))
+	defer ts.Close()
+
+	s3resp, _ := json.Marshal(queue.S3ArtifactResponse{
+		PutURL: ts.URL,
+	})
+
+	uploader := NewArtifactUploader(ArtifactUploaderOptions{ConcurrentUploads: 1})
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		context, mockedQueue := setupArtifactTest("public/test.txt", s3resp)
+		controller := &TaskContextController{context}
+		controller.SetArtifactUploader(uploader)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := context.UploadS3Artifact(S3Artifact{
+				Name:     "public/test.txt",
+				Mimetype: "text/plain; charset=utf-8",
+				Stream:   ioext.NopCloser(&bytes.Reader{}),
+			})
+			require.NoError(t, err)
+			mockedQueue.AssertExpectations(t)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 1, maxActive, "expected at most one concurrent upload")
+}
+
+func TestArtifactUploaderWaitCanceled(t *testing.T) {
+	uploader := NewArtifactUploader(ArtifactUploaderOptions{ConcurrentUploads: 1})
+	uploader.slots <- struct{}{} // occupy the only upload slot
+
+	// The artifact isn't created while waiting, so the mocked queue has no calls
+	context := &TaskContext{done: make(chan struct{})}
+	mockedQueue := &client.MockQueue{}
+	controller := &TaskContextController{context}
+	controller.SetQueueClient(mockedQueue)
+	controller.SetArtifactUploader(uploader)
+
+	done := make(chan error)
+	go func() {
+		done <- context.UploadS3Artifact(S3Artifact{
+			Name:     "public/test.txt",
+			Mimetype: "text/plain; charset=utf-8",
+			Stream:   ioext.NopCloser(&bytes.Reader{}),
+		})
+	}()
+	select {
+	case err := <-done:
+		t.Fatal("upload returned while waiting for a slot, error: ", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	context.Cancel()
+	require.Equal(t, goctx.Canceled, <-done)
+	mockedQueue.AssertNotCalled(t, "CreateArtifact", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Uploads started after the task was canceled wait for a slot
+	mockedQueue.On("CreateArtifact", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		(*queue.PostArtifactResponse)(nil), errors.New("queue unavailable"),
+	)
+	go func() {
+		done <- context.UploadS3Artifact(S3Artifact{
+			Name:     "public/logs/live_backing.log",
+			Mimetype: "text/plain; charset=utf-8",
+			Stream:   ioext.NopCloser(&bytes.Reader{}),
+		})
+	}()
+	select {
+	case err := <-done:
+		t.Fatal("upload returned while waiting for a slot, error: ", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-uploader.slots // free the upload slot
+	require.EqualError(t, <-done, "queue unavailable")
+}
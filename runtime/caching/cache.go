@@ -24,6 +24,8 @@ type Cache struct {
 	entries     []*cacheEntry
 	constructor Constructor
 	tracker     gc.ResourceTracker
+	released    chan struct{}  // closed when an entry is released or removed
+	writers     map[string]int // optionsHash -> number of RequireExclusive waiting
 }
 
 // New returns a Cache wrapping constructor such that resources
@@ -34,6 +36,8 @@ func New(constructor Constructor, shared bool, tracker gc.ResourceTracker) *Cach
 		constructor: constructor,
 		tracker:     tracker,
 		shared:      shared,
+		released:    make(chan struct{}),
+		writers:     make(map[string]int),
 	}
 }
 
@@ -50,6 +54,16 @@ func (c *Cache) remove(e *cacheEntry) {
 		}
 	}
 	c.entries = entries
+
+	// Wake up anyone waiting for the entry, so they can create a new one
+	c.notifyReleased()
+}
+
+// notifyReleased wakes up anyone waiting for an entry to be released, must be
+// called with c.m locked.
+func (c *Cache) notifyReleased() {
+	close(c.released)
+	c.released = make(chan struct{})
 }
 
 // Require returns a resource for the given options
@@ -59,41 +73,112 @@ func (c *Cache) remove(e *cacheEntry) {
 // will only every create one instance of the resource, unless purged or freed
 // by the ResourceTracker.
 func (c *Cache) Require(ctx Context, options interface{}) (*Handle, error) {
+	return c.require(ctx, options, c.shared, false)
+}
+
+// RequireShared returns a resource for the given options, which may be shared
+// with other callers of RequireShared, even if the Cache is exclusive.
+//
+// For an exclusive cache this is useful when the resource is used in a
+// read-only manner. A resource returned from RequireShared will never be
+// returned from Require before all handles using it have been released, and
+// RequireShared will not return resources that have been taken by Require.
+// Thus, readers can share a resource, while writers have exclusive access.
+//
+// If the resource exists, but is in exclusive use, or callers of
+// RequireExclusive are waiting for it, RequireShared waits for the resource
+// to be released, rather than creating a new resource.
+func (c *Cache) RequireShared(ctx Context, options interface{}) (*Handle, error) {
+	return c.require(ctx, options, true, true)
+}
+
+// RequireExclusive returns a resource for the given options, which will not
+// be shared with others until it is released.
+//
+// Unlike Require on an exclusive Cache, RequireExclusive waits for the
+// resource to be released, if it exists and is in use, rather than creating a
+// new resource. Together with RequireShared this ensures that writers take
+// turns using the same resource, while readers share it between turns.
+func (c *Cache) RequireExclusive(ctx Context, options interface{}) (*Handle, error) {
+	return c.require(ctx, options, false, true)
+}
+
+func (c *Cache) require(ctx Context, options interface{}, shared, wait bool) (*Handle, error) {
 	optionsHash := hashJSON(options)
 
 	// Lock the entries list
 	c.m.Lock()
 
-	// find cache entry, if present
-	var entry *cacheEntry
-	for _, e := range c.entries {
-		e.m.Lock()
-		// Ignore if: scheduled to be purged, disposed or options mismatch
-		if e.purge || e.disposed || e.optionsHash != optionsHash {
-			e.m.Unlock()
-			continue
+	// Register as waiting writer, so readers won't keep the resource from us
+	if wait && !shared {
+		c.writers[optionsHash]++
+	}
+	defer func() {
+		if wait && !shared {
+			c.m.Lock()
+			c.writers[optionsHash]--
+			if c.writers[optionsHash] == 0 {
+				delete(c.writers, optionsHash)
+				c.notifyReleased() // wake up readers waiting for writers to go first
+			}
+			c.m.Unlock()
 		}
-		// Skip if this isn't a shared cache and entry is in-use
-		if !c.shared && e.refCount > 0 {
+	}()
+
+	// find cache entry, if present, waiting for it to be released if requested
+	var entry *cacheEntry
+	for {
+		inUse := false
+		for _, e := range c.entries {
+			e.m.Lock()
+			// Ignore if: scheduled to be purged, disposed or options mismatch
+			if e.purge || e.disposed || e.optionsHash != optionsHash {
+				e.m.Unlock()
+				continue
+			}
+			// Skip if this isn't a shared request and entry is in-use, or if this
+			// is a shared request and the entry is in exclusive use. Readers waiting
+			// their turn also let waiting writers go first.
+			if (e.refCount > 0 && (!shared || !e.shared)) || (shared && wait && c.writers[optionsHash] > 0) {
+				inUse = true
+				e.m.Unlock()
+				continue
+			}
+			// Skip if we are too late to join the context (ie. it was canceled), and
+			// the resource haven't been created. There is a race here that could
+			// cause us to ignore a successfully created resource, but it's unlikely,
+			// mostly this is ignoring resource creations that haven't finished, but
+			// have been canceled (since we can't uncancel)
+			if !e.ctx.AddContext(ctx) && !e.created.IsDone() {
+				e.m.Unlock()
+				continue
+			}
+
+			// Take the entry
+			debug("cache entry '%s' found in cache, refCount: %d", optionsHash, e.refCount+1)
+			entry = e
+			e.refCount++
+			e.shared = shared
 			e.m.Unlock()
-			continue
+			break
 		}
-		// Skip if we are too late to join the context (ie. it was canceled), and
-		// the resource haven't been created. There is a race here that could
-		// cause us to ignore a successfully created resource, but it's unlikely,
-		// mostly this is ignoring resource creations that haven't finished, but
-		// have been canceled (since we can't uncancel)
-		if !e.ctx.AddContext(ctx) && !e.created.IsDone() {
-			e.m.Unlock()
-			continue
+		if entry != nil || !inUse || !wait {
+			break
 		}
 
-		// Take the entry
-		debug("cache entry '%s' found in cache, refCount: %d", optionsHash, e.refCount+1)
-		entry = e
-		e.refCount++
-		e.m.Unlock()
-		break
+		// Wait for an entry to be released, before trying again
+		debug("cache entry '%s' is in use, waiting for it to be released", optionsHash)
+		released := c.released
+		c.m.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			panic(errors.New("expected context.Err() != nil when context.Done() is closed"))
+		}
+		c.m.Lock()
 	}
 
 	// Create new resource
@@ -102,6 +187,7 @@ func (c *Cache) Require(ctx Context, options interface{}) (*Handle, error) {
 		entry = &cacheEntry{
 			optionsHash: optionsHash,
 			refCount:    1,
+			shared:      shared,
 			lastUsed:    time.Now(),
 			ctx:         newContextConjunction(ctx),
 			cache:       c,
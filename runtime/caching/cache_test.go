@@ -468,4 +468,76 @@ func TestExclusiveCache(t *testing.T) {
 		require.Equal(t, 0, len(tr.resources), "expected zero resources")
 		tr.Unlock()
 	})
+
+	t.Run("shared resource in exclusive cache", func(t *testing.T) {
+		debug("creating shared resources")
+		hA, err := c.RequireShared(&mockctx{context.Background()}, opts{Value: 42})
+		require.NoError(t, err)
+		hB, err := c.RequireShared(&mockctx{context.Background()}, opts{Value: 42})
+		require.NoError(t, err)
+		require.True(t, hA.Resource() == hB.Resource(), "expected shared resource")
+
+		debug("creating exclusive resource while shared is in use")
+		hC, err := c.Require(&mockctx{context.Background()}, opts{Value: 42})
+		require.NoError(t, err)
+		require.False(t, hA.Resource() == hC.Resource(), "expected new resource")
+
+		debug("creating shared resource while exclusive is in use")
+		hD, err := c.RequireShared(&mockctx{context.Background()}, opts{Value: 42})
+		require.NoError(t, err)
+		require.True(t, hA.Resource() == hD.Resource(), "expected shared resource")
+
+		hA.Release()
+		hB.Release()
+		hD.Release()
+
+		debug("reuse resource exclusively after it was released")
+		hE, err := c.Require(&mockctx{context.Background()}, opts{Value: 42})
+		require.NoError(t, err)
+		require.False(t, hC.Resource() == hE.Resource(), "expected resource not in-use")
+		hC.Release()
+		hE.Release()
+	})
+
+	t.Run("readers and writers take turns", func(t *testing.T) {
+		debug("creating exclusive resource")
+		hA, err := c.RequireExclusive(&mockctx{context.Background()}, opts{Value: 7})
+		require.NoError(t, err)
+
+		debug("readers and writers wait for the resource to be released")
+		var hB, hC *Handle
+		var readerDone, writerDone atomics.Once
+		go readerDone.Do(func() {
+			var rerr error
+			hB, rerr = c.RequireShared(&mockctx{context.Background()}, opts{Value: 7})
+			require.NoError(t, rerr)
+		})
+		go writerDone.Do(func() {
+			var werr error
+			hC, werr = c.RequireExclusive(&mockctx{context.Background()}, opts{Value: 7})
+			require.NoError(t, werr)
+		})
+		time.Sleep(10 * time.Millisecond)
+		require.False(t, readerDone.IsDone(), "reader shouldn't get resource in exclusive use")
+		require.False(t, writerDone.IsDone(), "writer shouldn't get resource in exclusive use")
+
+		debug("releasing the resource, the waiting writer goes first")
+		hA.Release()
+		writerDone.Wait()
+		require.True(t, hA.entry.resource == hC.Resource(), "expected the same resource")
+		time.Sleep(10 * time.Millisecond)
+		require.False(t, readerDone.IsDone(), "reader shouldn't get resource in exclusive use")
+
+		debug("releasing the resource, the waiting reader gets it")
+		hC.Release()
+		readerDone.Wait()
+		require.True(t, hA.entry.resource == hB.Resource(), "expected the same resource")
+
+		debug("writer waiting for reader is canceled")
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err = c.RequireExclusive(&mockctx{ctx}, opts{Value: 7})
+		require.Equal(t, context.Canceled, err)
+		hB.Release()
+	})
 }
@@ -14,6 +14,7 @@ type cacheEntry struct {
 	optionsHash string
 	created     atomics.Once
 	refCount    uint32
+	shared      bool // true, if references held may be shared
 	lastUsed    time.Time
 	ctx         *contextConjunction
 	resource    Resource
@@ -62,7 +63,14 @@ func (e *cacheEntry) Dispose() error {
 
 func (e *cacheEntry) release() {
 	e.m.Lock()
-	defer e.m.Unlock()
+	defer func() {
+		e.m.Unlock()
+
+		// Wake up anyone waiting for the entry to be released
+		e.cache.m.Lock()
+		e.cache.notifyReleased()
+		e.cache.m.Unlock()
+	}()
 
 	debug("cache entry '%s' released to cache, refCount: %d", e.optionsHash, e.refCount-1)
 
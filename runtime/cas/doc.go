@@ -0,0 +1,17 @@
+// Package cas implements a content-addressed store for files, such as images
+// and fetched artifacts, which are stored by their sha256 hash.
+//
+// Files in the store are read-only and shared by hard-linking them into place,
+// hence, identical content is only stored once, even if the store is shared by
+// multiple workers on the same host. Consumers that need a writable copy can
+// clone an object, which uses a reflink on file systems that support it.
+//
+// Folder structures, such as the contents of a pre-loaded cache, can be stored
+// as snapshots under a key, files in a snapshot are stored as objects, so
+// identical files are shared between snapshots. Snapshots not restored for a
+// week are removed by Store.Collect().
+package cas
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("cas")
@@ -0,0 +1,16 @@
+// +build !windows
+
+package cas
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkCount returns the number of hard-links to the file
+func linkCount(info os.FileInfo) (uint64, bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink), true
+	}
+	return 0, false
+}
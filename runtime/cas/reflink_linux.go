@@ -0,0 +1,31 @@
+package cas
+
+import (
+	"os"
+	"syscall"
+)
+
+// ioctl request for cloning a file, see ioctl_ficlone(2)
+const ficlone = 0x40049409
+
+// reflink creates target as a copy-on-write clone of source
+func reflink(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd())
+	err = out.Close()
+	if errno != 0 {
+		err = errno
+	}
+	if err != nil {
+		os.Remove(target)
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package cas
+
+import "errors"
+
+// reflink isn't supported on this platform, so objects are always copied
+func reflink(source, target string) error {
+	return errors.New("reflink is not supported on this platform")
+}
@@ -0,0 +1,281 @@
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Snapshots not restored for this long are removed by Collect(), allowing
+// objects only referenced by such snapshots to be collected.
+const unusedSnapshotAge = 7 * 24 * time.Hour
+
+// manifestName is the name of the manifest file in a snapshot folder
+const manifestName = "manifest.json"
+
+// A FileSystem can be written to when restoring a snapshot, this is satisfied
+// by engines.VolumeBuilder.
+type FileSystem interface {
+	WriteFolder(name string) error
+	WriteFile(name string) io.WriteCloser
+}
+
+// snapshotEntry is a folder, or a file if Hash is given, in a snapshot
+type snapshotEntry struct {
+	Name string `json:"name"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// A SnapshotBuilder records folders and files written to it, such that they
+// can be stored as a snapshot using Commit(). Files are written to the store
+// as they are closed, hence, files with identical content are only stored
+// once.
+//
+// A SnapshotBuilder implements FileSystem, and may be written to concurrently.
+type SnapshotBuilder struct {
+	store   *Store
+	folder  string // temporary folder holding the manifest and pinned objects
+	m       sync.Mutex
+	entries []snapshotEntry
+	err     error
+}
+
+// NewSnapshot returns a SnapshotBuilder for creating a snapshot of a folder
+// structure, such as the contents of a cache.
+func (s *Store) NewSnapshot() (*SnapshotBuilder, error) {
+	folder := s.tempPath()
+	if err := os.Mkdir(folder, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary folder for snapshot")
+	}
+	return &SnapshotBuilder{store: s, folder: folder}, nil
+}
+
+// WriteFolder records a folder in the snapshot
+func (b *SnapshotBuilder) WriteFolder(name string) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.entries = append(b.entries, snapshotEntry{Name: name})
+	return nil
+}
+
+// WriteFile returns an io.WriteCloser for writing a file to the snapshot, the
+// file is recorded when closed.
+func (b *SnapshotBuilder) WriteFile(name string) io.WriteCloser {
+	tmp := b.store.tempPath()
+	f, err := os.Create(tmp)
+	if err != nil {
+		err = errors.Wrap(err, "failed to create temporary file")
+		b.fail(err)
+	}
+	return &snapshotFile{builder: b, name: name, tmp: tmp, file: f, err: err}
+}
+
+func (b *SnapshotBuilder) fail(err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// addFile pins the object with given hash in the snapshot being built, and
+// records it as file with given name.
+func (b *SnapshotBuilder) addFile(name, hash string) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	// Hard-link the object into the snapshot folder, so it's not collected
+	pin := filepath.Join(b.folder, hash)
+	if err := os.Link(b.store.Path(hash), pin); err != nil && !os.IsExist(err) {
+		return errors.Wrap(err, "failed to pin object in snapshot")
+	}
+	b.entries = append(b.entries, snapshotEntry{Name: name, Hash: hash})
+	return nil
+}
+
+// Commit stores the snapshot under key, replacing any existing snapshot with
+// the same key. This invalidates the SnapshotBuilder.
+func (b *SnapshotBuilder) Commit(key string) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.err != nil {
+		os.RemoveAll(b.folder)
+		return b.err
+	}
+	data, err := json.Marshal(b.entries)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(b.folder, manifestName), data, 0400)
+	}
+	if err != nil {
+		os.RemoveAll(b.folder)
+		return errors.Wrap(err, "failed to write snapshot manifest")
+	}
+
+	target := b.store.snapshotPath(key)
+	if err = os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		os.RemoveAll(b.folder)
+		return errors.Wrap(err, "failed to create snapshots folder")
+	}
+	// Move any existing snapshot out of the way, before renaming into place
+	if _, err = os.Stat(target); err == nil {
+		old := b.store.tempPath()
+		if err = os.Rename(target, old); err == nil {
+			defer os.RemoveAll(old)
+		}
+	}
+	if err = os.Rename(b.folder, target); err != nil {
+		os.RemoveAll(b.folder)
+		return errors.Wrap(err, "failed to move snapshot into store")
+	}
+	debug("committed snapshot of %d entries for '%s'", len(b.entries), key)
+	return nil
+}
+
+// Discard releases resources held by the SnapshotBuilder. This invalidates
+// the SnapshotBuilder.
+func (b *SnapshotBuilder) Discard() error {
+	return os.RemoveAll(b.folder)
+}
+
+// snapshotFile is the io.WriteCloser returned by SnapshotBuilder.WriteFile()
+type snapshotFile struct {
+	builder *SnapshotBuilder
+	name    string
+	tmp     string
+	file    *os.File
+	err     error
+}
+
+func (f *snapshotFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	n, err := f.file.Write(p)
+	if err != nil {
+		f.err = errors.Wrap(err, "failed to write temporary file")
+	}
+	return n, f.err
+}
+
+func (f *snapshotFile) Close() error {
+	if f.file == nil {
+		return f.err
+	}
+	err := f.file.Close()
+	f.file = nil
+	if f.err == nil && err != nil {
+		f.err = errors.Wrap(err, "failed to write temporary file")
+	}
+	var hash string
+	if f.err == nil {
+		hash, f.err = f.builder.store.Import(f.tmp)
+	}
+	if f.err == nil {
+		f.err = f.builder.addFile(f.name, hash)
+	}
+	if f.err != nil {
+		os.Remove(f.tmp)
+		f.builder.fail(f.err)
+	}
+	return f.err
+}
+
+// HasSnapshot returns true, if the store holds a snapshot with given key.
+func (s *Store) HasSnapshot(key string) bool {
+	_, err := os.Stat(filepath.Join(s.snapshotPath(key), manifestName))
+	return err == nil
+}
+
+// RestoreSnapshot writes the folders and files of the snapshot with given key
+// to target. Returns false, if the store doesn't hold a snapshot with the key.
+func (s *Store) RestoreSnapshot(key string, target FileSystem) (bool, error) {
+	folder := s.snapshotPath(key)
+	data, err := ioutil.ReadFile(filepath.Join(folder, manifestName))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to read snapshot manifest")
+	}
+	var entries []snapshotEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return false, errors.Wrap(err, "failed to parse snapshot manifest")
+	}
+
+	// Mark the snapshot as used, so it's not removed by Collect()
+	now := time.Now()
+	os.Chtimes(folder, now, now)
+
+	for _, entry := range entries {
+		if entry.Hash == "" {
+			if err = target.WriteFolder(entry.Name); err != nil {
+				return false, errors.Wrapf(err, "failed to restore folder '%s'", entry.Name)
+			}
+			continue
+		}
+		if err = restoreFile(filepath.Join(folder, entry.Hash), entry.Name, target); err != nil {
+			return false, err
+		}
+	}
+	debug("restored snapshot of %d entries for '%s'", len(entries), key)
+	return true, nil
+}
+
+// restoreFile copies the pinned object to name in target
+func restoreFile(pin, name string, target FileSystem) error {
+	in, err := os.Open(pin)
+	if err != nil {
+		return errors.Wrap(err, "failed to open object pinned by snapshot")
+	}
+	defer in.Close()
+	w := target.WriteFile(name)
+	if _, err = io.Copy(w, in); err != nil {
+		w.Close()
+		return errors.Wrapf(err, "failed to restore file '%s'", name)
+	}
+	return errors.Wrapf(w.Close(), "failed to restore file '%s'", name)
+}
+
+// RemoveSnapshot removes the snapshot with given key, if any, objects only
+// referenced by the snapshot are removed by the next Collect().
+func (s *Store) RemoveSnapshot(key string) error {
+	return errors.Wrap(os.RemoveAll(s.snapshotPath(key)), "failed to remove snapshot")
+}
+
+// collectSnapshots removes snapshots that haven't been used recently
+func (s *Store) collectSnapshots() error {
+	folders, err := ioutil.ReadDir(filepath.Join(s.folder, "snapshots"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to list snapshots")
+	}
+	for _, info := range folders {
+		if time.Since(info.ModTime()) > unusedSnapshotAge {
+			debug("removing unused snapshot %s", info.Name())
+			if err = os.RemoveAll(filepath.Join(s.folder, "snapshots", info.Name())); err != nil {
+				return errors.Wrap(err, "failed to remove unused snapshot")
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotPath returns the folder for the snapshot with given key, keys are
+// hashed so that any string can be used as key.
+func (s *Store) snapshotPath(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(s.folder, "snapshots", hex.EncodeToString(h[:]))
+}
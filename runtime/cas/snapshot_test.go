@@ -0,0 +1,119 @@
+package cas
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryFileSystem records folders and files written to it
+type memoryFileSystem struct {
+	folders []string
+	files   map[string]string
+}
+
+func (fs *memoryFileSystem) WriteFolder(name string) error {
+	fs.folders = append(fs.folders, name)
+	return nil
+}
+
+func (fs *memoryFileSystem) WriteFile(name string) io.WriteCloser {
+	return &memoryFile{fs: fs, name: name}
+}
+
+type memoryFile struct {
+	bytes.Buffer
+	fs   *memoryFileSystem
+	name string
+}
+
+func (f *memoryFile) Close() error {
+	f.fs.files[f.name] = f.String()
+	return nil
+}
+
+func writeFile(t *testing.T, fs FileSystem, name, content string) {
+	w := fs.WriteFile(name)
+	_, err := w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func TestSnapshot(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cas-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	s, err := New(filepath.Join(folder, "store"))
+	require.NoError(t, err)
+
+	ok, err := s.RestoreSnapshot("my-key", &memoryFileSystem{})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Create a snapshot with two identical files
+	b, err := s.NewSnapshot()
+	require.NoError(t, err)
+	require.NoError(t, b.WriteFolder("bin"))
+	writeFile(t, b, "bin/hello.sh", "echo hello")
+	writeFile(t, b, "hello.sh", "echo hello")
+	writeFile(t, b, "README", "read me")
+	require.NoError(t, b.Commit("my-key"))
+	require.True(t, s.HasSnapshot("my-key"))
+
+	// Restore the snapshot
+	fs := &memoryFileSystem{files: make(map[string]string)}
+	ok, err = s.RestoreSnapshot("my-key", fs)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []string{"bin"}, fs.folders)
+	require.Equal(t, map[string]string{
+		"bin/hello.sh": "echo hello",
+		"hello.sh":     "echo hello",
+		"README":       "read me",
+	}, fs.files)
+
+	// Discarded snapshots are not stored
+	b, err = s.NewSnapshot()
+	require.NoError(t, err)
+	writeFile(t, b, "other", "discarded")
+	require.NoError(t, b.Discard())
+	require.False(t, s.HasSnapshot("other-key"))
+
+	if runtime.GOOS == "windows" {
+		return // objects are never collected on windows
+	}
+
+	// Objects pinned by a snapshot aren't collected
+	_, err = s.Collect()
+	require.NoError(t, err)
+	fs = &memoryFileSystem{files: make(map[string]string)}
+	ok, err = s.RestoreSnapshot("my-key", fs)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, fs.files, 3)
+
+	// Unused snapshots are removed, and their objects collected
+	old := time.Now().Add(-2 * unusedSnapshotAge)
+	require.NoError(t, os.Chtimes(s.snapshotPath("my-key"), old, old))
+	freed, err := s.Collect()
+	require.NoError(t, err)
+	require.EqualValues(t, len("echo hello")+len("read me"), freed)
+	require.False(t, s.HasSnapshot("my-key"))
+
+	// Removed snapshots can't be restored
+	b, err = s.NewSnapshot()
+	require.NoError(t, err)
+	require.NoError(t, b.Commit("my-key"))
+	require.NoError(t, s.RemoveSnapshot("my-key"))
+	ok, err = s.RestoreSnapshot("my-key", &memoryFileSystem{})
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,230 @@
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/slugid-go/slugid"
+)
+
+// Temporary files older than this are assumed to be left over from a crashed
+// process, and removed by Collect().
+const staleTempFileAge = 24 * time.Hour
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// A Store holds files by the sha256 hash of their content.
+//
+// A Store is safe for concurrent use, also by multiple processes sharing the
+// same folder.
+type Store struct {
+	folder string
+}
+
+// New returns a Store in folder, creating the folder if it doesn't exist.
+func New(folder string) (*Store, error) {
+	for _, f := range []string{"objects", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(folder, f), 0700); err != nil {
+			return nil, errors.Wrap(err, "failed to create content store folder")
+		}
+	}
+	return &Store{folder: folder}, nil
+}
+
+// Path returns the path to the object with given hash, the object may not
+// exist and must not be modified.
+func (s *Store) Path(hash string) string {
+	if !hashPattern.MatchString(hash) {
+		panic(fmt.Sprintf("cas: invalid hash: '%s'", hash))
+	}
+	return filepath.Join(s.folder, "objects", hash[:2], hash)
+}
+
+// Has returns true, if the store holds an object with given hash.
+func (s *Store) Has(hash string) bool {
+	_, err := os.Stat(s.Path(hash))
+	return err == nil
+}
+
+// Import moves file into the store and returns the hash of its content. If the
+// store already holds the content, file is removed.
+func (s *Store) Import(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open file for import")
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to hash file for import")
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	target := s.Path(hash)
+	if _, err = os.Stat(target); err == nil {
+		debug("already have %s, removing %s", hash, file)
+		return hash, os.Remove(file)
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", errors.Wrap(err, "failed to create object folder")
+	}
+	if err = os.Chmod(file, 0444); err != nil {
+		return "", errors.Wrap(err, "failed to make file read-only")
+	}
+	// Renaming is atomic, so concurrent imports of the same content is safe
+	if err = os.Rename(file, target); err != nil {
+		// If file is on another device, we copy it instead
+		tmp := s.tempPath()
+		if err = copyFile(file, tmp); err != nil {
+			os.Remove(tmp)
+			return "", errors.Wrap(err, "failed to copy file into store")
+		}
+		if err = os.Rename(tmp, target); err != nil {
+			os.Remove(tmp)
+			return "", errors.Wrap(err, "failed to move file into store")
+		}
+		os.Remove(file)
+	}
+	debug("imported %s as %s", file, hash)
+	return hash, nil
+}
+
+// Write copies r into the store and returns the hash of the content.
+func (s *Store) Write(r io.Reader) (string, error) {
+	tmp := s.tempPath()
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temporary file")
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", errors.Wrap(err, "failed to write temporary file")
+	}
+	hash, err := s.Import(tmp)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return hash, err
+}
+
+// Link creates target as a hard-link to the object with given hash. The target
+// shares content with the store and must not be modified. If a hard-link
+// can't be created, because target is on another device, the object is cloned.
+func (s *Store) Link(hash, target string) error {
+	err := os.Link(s.Path(hash), target)
+	if err != nil && s.Has(hash) {
+		debug("failed to link %s to %s, cloning instead, error: %s", hash, target, err)
+		return s.Clone(hash, target)
+	}
+	return err
+}
+
+// Clone creates target as a writable copy of the object with given hash, the
+// copy is a reflink on file systems that supports it.
+func (s *Store) Clone(hash, target string) error {
+	source := s.Path(hash)
+	if err := reflink(source, target); err == nil {
+		return os.Chmod(target, 0644)
+	}
+	if err := copyFile(source, target); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return os.Chmod(target, 0644)
+}
+
+// Release removes the object with given hash, if it's no longer linked from
+// outside the store. This should be called after removing a file created with
+// Link(), so content is freed without waiting for Collect().
+func (s *Store) Release(hash string) error {
+	p := s.Path(hash)
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to stat object")
+	}
+	if n, ok := linkCount(info); ok && n <= 1 {
+		debug("released %s", hash)
+		if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to remove object")
+		}
+	}
+	return nil
+}
+
+// Collect removes snapshots that haven't been restored recently, objects that
+// aren't linked from outside the store or pinned by a snapshot, and stale
+// temporary files, returning the number of bytes freed.
+//
+// Objects are only removed if they have no other hard-links, so objects that
+// were cloned, or linked across devices, are collected even if still in use.
+func (s *Store) Collect() (int64, error) {
+	var freed int64
+	if err := s.collectSnapshots(); err != nil {
+		return freed, err
+	}
+	err := filepath.Walk(filepath.Join(s.folder, "objects"), func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if n, ok := linkCount(info); ok && n <= 1 {
+			if err = os.Remove(p); err == nil {
+				debug("collected %s", filepath.Base(p))
+				freed += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return freed, errors.Wrap(err, "failed to collect objects")
+	}
+
+	err = filepath.Walk(filepath.Join(s.folder, "tmp"), func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if time.Since(info.ModTime()) > staleTempFileAge {
+			if err = os.Remove(p); err == nil {
+				freed += info.Size()
+			}
+		}
+		return nil
+	})
+	return freed, errors.Wrap(err, "failed to collect temporary files")
+}
+
+func (s *Store) tempPath() string {
+	return filepath.Join(s.folder, "tmp", slugid.Nice())
+}
+
+// copyFile copies source to a new file target
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package cas
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cas-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	s, err := New(filepath.Join(folder, "store"))
+	require.NoError(t, err)
+
+	// Write the same content twice, to check that it's only stored once
+	hash, err := s.Write(bytes.NewBufferString("hello world"))
+	require.NoError(t, err)
+	require.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", hash)
+	file := filepath.Join(folder, "hello.txt")
+	require.NoError(t, ioutil.WriteFile(file, []byte("hello world"), 0644))
+	hash2, err := s.Import(file)
+	require.NoError(t, err)
+	require.Equal(t, hash, hash2)
+	_, err = os.Stat(file)
+	require.True(t, os.IsNotExist(err), "expected imported file to be removed")
+	require.True(t, s.Has(hash))
+
+	// Link and clone the object
+	linked := filepath.Join(folder, "linked.txt")
+	require.NoError(t, s.Link(hash, linked))
+	cloned := filepath.Join(folder, "cloned.txt")
+	require.NoError(t, s.Clone(hash, cloned))
+	for _, p := range []string{linked, cloned} {
+		data, rerr := ioutil.ReadFile(p)
+		require.NoError(t, rerr)
+		require.Equal(t, "hello world", string(data))
+	}
+	require.NoError(t, ioutil.WriteFile(cloned, []byte("modified"), 0644))
+	data, err := ioutil.ReadFile(s.Path(hash))
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(data), "clone must not share writes with the store")
+
+	if runtime.GOOS == "windows" {
+		return // objects are never collected on windows
+	}
+
+	// Objects that are linked aren't collected
+	_, err = s.Collect()
+	require.NoError(t, err)
+	require.True(t, s.Has(hash))
+
+	// Objects that are no longer linked are collected
+	require.NoError(t, os.Remove(linked))
+	freed, err := s.Collect()
+	require.NoError(t, err)
+	require.EqualValues(t, len("hello world"), freed)
+	require.False(t, s.Has(hash))
+
+	// Released objects are removed, when no longer linked
+	hash, err = s.Write(bytes.NewBufferString("hello again"))
+	require.NoError(t, err)
+	require.NoError(t, s.Link(hash, linked))
+	require.NoError(t, s.Release(hash))
+	require.True(t, s.Has(hash), "linked object must not be released")
+	require.NoError(t, os.Remove(linked))
+	require.NoError(t, s.Release(hash))
+	require.False(t, s.Has(hash))
+}
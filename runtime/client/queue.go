@@ -28,10 +28,12 @@ type Queue interface {
 	ReportFailed(string, string) (*queue.TaskStatusResponse, error)
 	ClaimTask(string, string, *queue.TaskClaimRequest) (*queue.TaskClaimResponse, error)
 	ClaimWork(provisionerID, workerType string, payload *queue.ClaimWorkRequest) (*queue.ClaimWorkResponse, error)
+	ListTaskGroup(taskGroupID, continuationToken, limit string) (*queue.ListTaskGroupResponse, error)
 	ReclaimTask(string, string) (*queue.TaskReclaimResponse, error)
 	PollTaskUrls(string, string) (*queue.PollTaskUrlsResponse, error)
 	CancelTask(string) (*queue.TaskStatusResponse, error)
 	CreateArtifact(string, string, string, *queue.PostArtifactRequest) (*queue.PostArtifactResponse, error)
+	ListArtifacts(taskID, runID, continuationToken, limit string) (*queue.ListArtifactsResponse, error)
 	GetArtifact_SignedURL(string, string, string, time.Duration) (*url.URL, error) // nolint
 }
 
@@ -87,6 +89,12 @@ func (m *MockQueue) ClaimWork(provisionerID, workerType string, payload *queue.C
 	return args.Get(0).(*queue.ClaimWorkResponse), args.Error(1)
 }
 
+// ListTaskGroup is a mock implementation of github.com/taskcluster/taskcluster-client-go/queue#Queue.ListTaskGroup
+func (m *MockQueue) ListTaskGroup(taskGroupID, continuationToken, limit string) (*queue.ListTaskGroupResponse, error) {
+	args := m.Called(taskGroupID, continuationToken, limit)
+	return args.Get(0).(*queue.ListTaskGroupResponse), args.Error(1)
+}
+
 // ReportFailed is a mock implementation of github.com/taskcluster/taskcluster-client-go/queue.ReportFailed
 func (m *MockQueue) ReportFailed(taskID, runID string) (*queue.TaskStatusResponse, error) {
 	args := m.Called(taskID, runID)
@@ -105,6 +113,12 @@ func (m *MockQueue) CreateArtifact(taskID, runID, name string, payload *queue.Po
 	return args.Get(0).(*queue.PostArtifactResponse), args.Error(1)
 }
 
+// ListArtifacts is a mock implementation of github.com/taskcluster/taskcluster-client-go/queue.ListArtifacts
+func (m *MockQueue) ListArtifacts(taskID, runID, continuationToken, limit string) (*queue.ListArtifactsResponse, error) {
+	args := m.Called(taskID, runID, continuationToken, limit)
+	return args.Get(0).(*queue.ListArtifactsResponse), args.Error(1)
+}
+
 // GetArtifact_SignedURL is a mock implementation of github.com/taskcluster/taskcluster-client-go/queue.GetArtifact_SignedURL
 func (m *MockQueue) GetArtifact_SignedURL(taskID, runID, name string, duration time.Duration) (*url.URL, error) { // nolint
 	args := m.Called(taskID, runID, name, duration)
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/auth"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-client-go/secrets"
+)
+
+// LegacyRootURL is the root URL of the Taskcluster deployment where each
+// service has its own hostname, e.g. https://queue.taskcluster.net/v1
+const LegacyRootURL = "https://taskcluster.net"
+
+// ServiceURL returns the base URL for the API of a service given the root URL
+// of a Taskcluster deployment.
+//
+// For LegacyRootURL this is 'https://<service>.taskcluster.net/<version>', for
+// other deployments this is '<rootURL>/api/<service>/<version>'.
+func ServiceURL(rootURL, service, version string) string {
+	rootURL = strings.TrimRight(rootURL, "/")
+	if rootURL == "" || rootURL == LegacyRootURL {
+		return fmt.Sprintf("https://%s.taskcluster.net/%s", service, version)
+	}
+	return fmt.Sprintf("%s/api/%s/%s", rootURL, service, version)
+}
+
+// Options for creating clients with NewQueue and NewAuth.
+type Options struct {
+	Credentials *tcclient.Credentials
+	RootURL     string          // Root URL of the deployment, defaults to LegacyRootURL
+	BaseURL     string          // Base URL of the service, overrides RootURL if given
+	Context     context.Context // Context for requests, may be nil
+}
+
+func (o Options) baseURL(service, version string) string {
+	if o.BaseURL != "" {
+		return o.BaseURL
+	}
+	return ServiceURL(o.RootURL, service, version)
+}
+
+// NewQueue returns a Queue client for the deployment given in options.
+func NewQueue(options Options) Queue {
+	q := queue.New(options.Credentials)
+	q.BaseURL = options.baseURL("queue", "v1")
+	if options.Context != nil {
+		q.Context = options.Context
+	}
+	return q
+}
+
+// NewAuth returns an auth client for the deployment given in options.
+func NewAuth(options Options) *auth.Auth {
+	a := auth.New(options.Credentials)
+	a.BaseURL = options.baseURL("auth", "v1")
+	if options.Context != nil {
+		a.Context = options.Context
+	}
+	return a
+}
+
+// NewSecrets returns a secrets client for the deployment given in options.
+func NewSecrets(options Options) *secrets.Secrets {
+	s := secrets.New(options.Credentials)
+	s.BaseURL = options.baseURL("secrets", "v1")
+	if options.Context != nil {
+		s.Context = options.Context
+	}
+	return s
+}
@@ -0,0 +1,14 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceURL(t *testing.T) {
+	require.Equal(t, "https://queue.taskcluster.net/v1", ServiceURL("", "queue", "v1"))
+	require.Equal(t, "https://queue.taskcluster.net/v1", ServiceURL(LegacyRootURL, "queue", "v1"))
+	require.Equal(t, "https://tc.example.com/api/queue/v1", ServiceURL("https://tc.example.com", "queue", "v1"))
+	require.Equal(t, "https://tc.example.com/api/auth/v1", ServiceURL("https://tc.example.com/", "auth", "v1"))
+}
@@ -1,7 +1,9 @@
 package runtime
 
 import (
+	"github.com/taskcluster/taskcluster-worker/runtime/cas"
 	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
 	"github.com/taskcluster/taskcluster-worker/runtime/webhookserver"
 )
 
@@ -19,4 +21,19 @@ type Environment struct {
 	WorkerType    string
 	WorkerGroup   string
 	WorkerID      string
+	RootURL       string // Root URL of the Taskcluster deployment, may be empty
+	QueueBaseURL  string // Base URL of the queue, overrides RootURL if given
+	Engine        string // Name of the engine, may be empty
+	// ArtifactUploader shared by all tasks, may be nil in which case artifacts
+	// are uploaded with default settings.
+	ArtifactUploader *ArtifactUploader
+	// ContentStore for sharing images and fetched files by content hash, may be
+	// nil if not configured.
+	ContentStore *cas.Store
+	// Operations tracks long running operations that write files, such that
+	// garbage collection and shutdown can wait for them, may be nil.
+	Operations *OperationTracker
+	// Metrics exposed on the '/metrics' endpoint, engines and plugins may add
+	// their own metrics, may be nil.
+	Metrics *metrics.Registry
 }
@@ -1,11 +1,25 @@
 package runtime
 
 import (
-	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
+// Errors returned by engines and plugins are classified by the worker as one
+// of the following:
+//  * MalformedPayloadError, resolved exception with 'malformed-payload',
+//  * ResourceExhaustedError, resolved exception with 'resource-unavailable',
+//  * InfrastructureError, resolved exception with 'intermittent-task',
+//  * ErrNonFatalInternalError or ErrFatalInternalError, resolved exception
+//    with 'internal-error'.
+// Any other error is reported as an unhandled error, and treated as
+// ErrFatalInternalError.
+//
+// These errors may be wrapped with errors.Wrap() from 'github.com/pkg/errors'
+// to add context, the worker classifies errors using errors.Cause().
+
 // ErrNonFatalInternalError is used to indicate that the operation failed
 // because of internal error that isn't expected to affect other tasks.
 //
@@ -75,6 +89,89 @@ func MergeMalformedPayload(errors ...MalformedPayloadError) MalformedPayloadErro
 // This is mostly because it's hard to remember that error isn't supposed to be
 // cast to *MalformedPayloadError.
 func IsMalformedPayloadError(err error) (e MalformedPayloadError, ok bool) {
-	e, ok = err.(MalformedPayloadError)
+	e, ok = errors.Cause(err).(MalformedPayloadError)
+	return
+}
+
+// The ResourceExhaustedError error type is used to indicate that some
+// operation failed because the task needs more of some resource than the
+// worker has available.
+//
+// For example the task requires more disk space or memory than the worker
+// has, or an image is too large to be extracted.
+//
+// The worker will resolve tasks that fail with a ResourceExhaustedError as
+// exception with reason 'resource-unavailable'.
+type ResourceExhaustedError struct {
+	message string
+}
+
+// Error returns the error message and adheres to the Error interface
+func (e ResourceExhaustedError) Error() string {
+	return fmt.Sprintf("resource exhausted: %s", e.message)
+}
+
+// Message returns the message explaining what resource was exhausted
+func (e ResourceExhaustedError) Message() string {
+	return e.message
+}
+
+// NewResourceExhaustedError creates a ResourceExhaustedError object, the
+// message will be printed in the task log.
+func NewResourceExhaustedError(a ...interface{}) ResourceExhaustedError {
+	return ResourceExhaustedError{message: fmt.Sprint(a...)}
+}
+
+// IsResourceExhaustedError casts error to ResourceExhaustedError.
+func IsResourceExhaustedError(err error) (e ResourceExhaustedError, ok bool) {
+	e, ok = errors.Cause(err).(ResourceExhaustedError)
 	return
 }
+
+// The InfrastructureError error type is used to indicate that some operation
+// failed because of an intermittent infrastructure failure, which is unlikely
+// to reoccur if the task is retried on another worker.
+//
+// For example a 5xx error from a server that persisted after retries, or a
+// failure to read/write to local disk.
+//
+// The worker will resolve tasks that fail with an InfrastructureError as
+// exception with reason 'intermittent-task', if the task has retries left,
+// causing the queue to automatically retry the task.
+type InfrastructureError struct {
+	message string
+}
+
+// Error returns the error message and adheres to the Error interface
+func (e InfrastructureError) Error() string {
+	return fmt.Sprintf("infrastructure error: %s", e.message)
+}
+
+// Message returns the message explaining the infrastructure failure
+func (e InfrastructureError) Message() string {
+	return e.message
+}
+
+// NewInfrastructureError creates an InfrastructureError object, the message
+// will be printed in the task log.
+func NewInfrastructureError(a ...interface{}) InfrastructureError {
+	return InfrastructureError{message: fmt.Sprint(a...)}
+}
+
+// IsInfrastructureError casts error to InfrastructureError.
+func IsInfrastructureError(err error) (e InfrastructureError, ok bool) {
+	e, ok = errors.Cause(err).(InfrastructureError)
+	return
+}
+
+// IsInternalError returns true, if err is ErrFatalInternalError or
+// ErrNonFatalInternalError, fatal is true if err is ErrFatalInternalError.
+func IsInternalError(err error) (fatal bool, ok bool) {
+	switch errors.Cause(err) {
+	case ErrFatalInternalError:
+		return true, true
+	case ErrNonFatalInternalError:
+		return false, true
+	}
+	return false, false
+}
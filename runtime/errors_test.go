@@ -3,6 +3,7 @@ package runtime
 import (
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,3 +12,29 @@ func TestIsMalformedPayloadError(t *testing.T) {
 	_, ok := IsMalformedPayloadError(err)
 	assert.True(t, ok)
 }
+
+func TestWrappedErrors(t *testing.T) {
+	e1, ok := IsMalformedPayloadError(errors.Wrap(NewMalformedPayloadError("bad"), "context"))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"bad"}, e1.Messages())
+
+	e2, ok := IsResourceExhaustedError(errors.Wrap(NewResourceExhaustedError("disk"), "context"))
+	assert.True(t, ok)
+	assert.Equal(t, "disk", e2.Message())
+
+	_, ok = IsInfrastructureError(errors.Wrap(NewInfrastructureError("503"), "context"))
+	assert.True(t, ok)
+	_, ok = IsInfrastructureError(NewResourceExhaustedError("disk"))
+	assert.False(t, ok)
+
+	fatal, ok := IsInternalError(errors.Wrap(ErrFatalInternalError, "context"))
+	assert.True(t, ok)
+	assert.True(t, fatal)
+	fatal, ok = IsInternalError(ErrNonFatalInternalError)
+	assert.True(t, ok)
+	assert.False(t, fatal)
+	_, ok = IsInternalError(errors.New("unknown"))
+	assert.False(t, ok)
+	_, ok = IsInternalError(nil)
+	assert.False(t, ok)
+}
@@ -16,6 +16,7 @@ const (
 	ReasonInternalError
 	ReasonSuperseded
 	ReasonIntermittentTask
+	ReasonClaimExpired
 )
 
 // String returns a string repesentation of the ExceptionReason for use with the
@@ -38,6 +39,8 @@ func (e ExceptionReason) String() string {
 		return "superseded"
 	case ReasonIntermittentTask:
 		return "intermittent-task"
+	case ReasonClaimExpired:
+		return "claim-expired"
 	}
 	panic(fmt.Sprintf("Unknown ExceptionReason: %d", e))
 }
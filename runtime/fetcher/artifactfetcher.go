@@ -92,19 +92,16 @@ func (r *artifactReference) Scopes() [][]string {
 }
 
 func (r *artifactReference) Fetch(ctx Context, target WriteReseter) error {
-	// Construct URL
-	var u string
+	// Construct URL from the queue client, so the configured queue is used
+	u, err := ctx.Queue().GetArtifact_SignedURL(r.TaskID, strconv.Itoa(r.RunID), r.Artifact, 25*time.Minute)
+	if err != nil {
+		return errors.Wrap(err, "failed to construct URL for artifact")
+	}
 	if r.isPublic() {
-		// TODO: Get queueBaseUrl from TaskContext somehow... and facilitate mocking in tests
-		u = fmt.Sprintf("https://queue.taskcluster.net/v1/task/%s/runs/%d/artifacts/%s", r.TaskID, r.RunID, r.Artifact)
-	} else {
-		u2, err := ctx.Queue().GetArtifact_SignedURL(r.TaskID, strconv.Itoa(r.RunID), r.Artifact, 25*time.Minute)
-		if err != nil {
-			panic(errors.Wrap(err, "Client library shouldn't be able to fail here"))
-		}
-		u = u2.String()
+		// Public artifacts can be fetched without credentials
+		u.RawQuery = ""
 	}
 
 	subject := fmt.Sprintf("artifact %s from %s/%d", r.Artifact, r.TaskID, r.RunID)
-	return fetchURLWithRetries(ctx, subject, u, target)
+	return fetchURLWithRetries(ctx, subject, u.String(), target)
 }
@@ -2,9 +2,15 @@ package fetcher
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/queue"
 )
 
 func TestArtifactFetcherScopesPublic(t *testing.T) {
@@ -28,3 +34,34 @@ func TestArtifactFetcherScopesPrivate(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, [][]string{{"queue:get-artifact:private/logs/live.log"}}, ref.Scopes())
 }
+
+func TestArtifactFetcherQueueBaseURL(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/task/H6SAIKUFT2mewKH-qHzXjQ/runs/0/artifacts/public/data.txt":
+			assert.NotContains(t, r.URL.Query(), "bewit", "public artifacts shouldn't be signed")
+			w.Write([]byte("public-data"))
+		case "/v1/task/H6SAIKUFT2mewKH-qHzXjQ/runs/0/artifacts/private/data.txt":
+			assert.Contains(t, r.URL.Query(), "bewit", "private artifacts should be signed")
+			w.Write([]byte("private-data"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	q := queue.New(&tcclient.Credentials{ClientID: "test-client", AccessToken: "test-token"})
+	q.BaseURL = s.URL + "/v1"
+	ctx := &mockContext{Context: context.Background(), queue: q}
+	for _, name := range []string{"public/data.txt", "private/data.txt"} {
+		ref, err := Artifact.NewReference(ctx, map[string]interface{}{
+			"taskId":   "H6SAIKUFT2mewKH-qHzXjQ",
+			"runId":    0,
+			"artifact": name,
+		})
+		require.NoError(t, err)
+		w := &mockWriteReseter{}
+		require.NoError(t, ref.Fetch(ctx, w))
+		require.Equal(t, strings.Split(name, "/")[0]+"-data", w.String())
+	}
+}
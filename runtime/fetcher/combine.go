@@ -16,6 +16,10 @@ type fetcherSet struct {
 // For this to work well, the reference schemas should all be distinct such
 // that no reference matches more than one fetcher. If there is ambiguity the
 // first Fetcher whose schema matches will be used.
+//
+// References resolved by Index are given the same HashKey as the artifact
+// reference they resolve to, if Artifact is also combined, such that resources
+// are cached once, whether referenced by index namespace or taskId.
 func Combine(fetchers ...Fetcher) Fetcher {
 	schema := schematypes.OneOf{}
 	for _, f := range fetchers {
@@ -55,5 +59,14 @@ func (fs *fetcherSet) NewReference(ctx Context, options interface{}) (Reference,
 	if err != nil {
 		return nil, err
 	}
+	// Key references resolved to an artifact as if given to the Artifact fetcher
+	if _, ok := ref.(*artifactReference); ok {
+		for j, f := range fs.fetchers {
+			if f == Artifact {
+				i = j
+				break
+			}
+		}
+	}
 	return &wrappedReference{Reference: ref, index: i}, nil
 }
@@ -0,0 +1,55 @@
+package fetcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	schematypes "github.com/taskcluster/go-schematypes"
+)
+
+// resolvingFetcher resolves references to an artifact, like Index does
+type resolvingFetcher struct{}
+
+func (resolvingFetcher) Schema() schematypes.Schema {
+	return schematypes.Object{
+		Properties: schematypes.Properties{
+			"namespace": schematypes.String{},
+		},
+		Required: []string{"namespace"},
+	}
+}
+
+func (resolvingFetcher) NewReference(ctx Context, options interface{}) (Reference, error) {
+	return &artifactReference{
+		TaskID:   "H6SAIKUFT2mewKH-qHzXjQ",
+		RunID:    0,
+		Artifact: "public/image.tar.zst",
+	}, nil
+}
+
+func TestCombineResolvedArtifactHashKey(t *testing.T) {
+	ctx := &mockContext{Context: context.Background()}
+	f := Combine(URL, Artifact, resolvingFetcher{})
+
+	artifact, err := f.NewReference(ctx, map[string]interface{}{
+		"taskId":   "H6SAIKUFT2mewKH-qHzXjQ",
+		"runId":    0,
+		"artifact": "public/image.tar.zst",
+	})
+	require.NoError(t, err)
+	resolved, err := f.NewReference(ctx, map[string]interface{}{
+		"namespace": "project.images.latest",
+	})
+	require.NoError(t, err)
+	require.Equal(t, artifact.HashKey(), resolved.HashKey())
+	require.Equal(t, "1:H6SAIKUFT2mewKH-qHzXjQ/0/public/image.tar.zst", resolved.HashKey())
+
+	// Without Artifact the index of the resolving fetcher is used
+	f = Combine(URL, URLHash, resolvingFetcher{})
+	resolved, err = f.NewReference(ctx, map[string]interface{}{
+		"namespace": "project.images.latest",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2:H6SAIKUFT2mewKH-qHzXjQ/0/public/image.tar.zst", resolved.HashKey())
+}
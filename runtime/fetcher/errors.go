@@ -28,3 +28,29 @@ func IsBrokenReferenceError(err error) bool {
 	_, ok := err.(BrokenReferenceError)
 	return ok
 }
+
+// UnavailableError is used to communicate that a resource could not be
+// fetched because of errors that persisted after retries, such as 5xx
+// responses or broken connections. Unlike BrokenReferenceError it is not
+// expected to fail consistently.
+type UnavailableError struct {
+	subject string // thing we failed to fetch
+	reason  string // reason we failed
+}
+
+func newUnavailableError(subject, reason string) UnavailableError {
+	return UnavailableError{
+		subject: subject,
+		reason:  reason,
+	}
+}
+
+func (e UnavailableError) Error() string {
+	return fmt.Sprintf("failed to fetch %s, %s", e.subject, e.reason)
+}
+
+// IsUnavailableError returns true, if err is an UnavailableError error.
+func IsUnavailableError(err error) bool {
+	_, ok := err.(UnavailableError)
+	return ok
+}
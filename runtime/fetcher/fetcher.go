@@ -3,9 +3,11 @@ package fetcher
 import (
 	"context"
 	"io"
+	"net/http"
 	"time"
 
 	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
 )
 
@@ -25,6 +27,20 @@ type Context interface {
 	Progress(description string, percent float64)
 }
 
+// httpClientFactory is implemented by runtime.TaskContext, if the Context
+// embeds a TaskContext, requests are made with TaskContext.NewHTTPClient(),
+// otherwise http.DefaultClient is used.
+type httpClientFactory interface {
+	NewHTTPClient(options runtime.HTTPClientOptions) *http.Client
+}
+
+func httpClient(ctx Context) *http.Client {
+	if f, ok := ctx.(httpClientFactory); ok {
+		return f.NewHTTPClient(runtime.HTTPClientOptions{})
+	}
+	return http.DefaultClient
+}
+
 // WriteReseter is a io.Writer with Reset()
 // method that discards everything written and starts over from scratch.
 //
@@ -50,7 +66,8 @@ type Reference interface {
 
 	// Fetch a reference to a target, sending progress to Context as well
 	// as returning a human readable error message, if fetching fails.
-	// If the referenced resource doesn't exist it returns a BrokenReferenceError.
+	// If the referenced resource doesn't exist it returns a BrokenReferenceError,
+	// if it couldn't be fetched after retries it returns an UnavailableError.
 	Fetch(context Context, target WriteReseter) error
 }
 
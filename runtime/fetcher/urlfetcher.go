@@ -78,7 +78,7 @@ func fetchURLWithRetries(ctx Context, subject, u string, target WriteReseter) er
 			return err
 		}
 		if retry > maxRetries {
-			return newBrokenReferenceError(subject, fmt.Sprintf("exhausted retries with last error: %s", err))
+			return newUnavailableError(subject, fmt.Sprintf("exhausted retries with last error: %s", err))
 		}
 
 		// Sleep before we retry
@@ -99,7 +99,7 @@ func fetchURL(ctx Context, subject, u string, target io.Writer) error {
 
 	// Do the request with context
 	req = req.WithContext(ctx)
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient(ctx).Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %s", err)
 	}
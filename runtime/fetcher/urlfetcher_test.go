@@ -177,6 +177,7 @@ func TestUrlFetcher(t *testing.T) {
 		err = ref.Fetch(ctx, w)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "server-error")
+		require.True(t, IsUnavailableError(err))
 		require.Equal(t, "", w.String())
 		require.Equal(t, maxRetries+1, count)
 	})
@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Maximum number of stack frames included in a fingerprint
+const maxFingerprintFrames = 32
+
+// ErrorFingerprint returns a stable fingerprint for err, such that reports of
+// the same error can be grouped, even if error messages differ.
+//
+// The fingerprint is computed from the type of the underlying error, the
+// functions in the stack trace and the engine. If err wasn't created with a
+// stack trace by github.com/pkg/errors, the stack of the caller is used, skip
+// is the number of stack frames to skip, with 0 identifying the caller of
+// ErrorFingerprint. Hence, to get the same fingerprint as Monitor.ReportError()
+// this must be called from the same function with skip = 0.
+func ErrorFingerprint(err error, engine string, skip int) string {
+	type stackTracer interface {
+		StackTrace() errors.StackTrace
+	}
+	type causer interface {
+		Cause() error
+	}
+
+	// Find the stack trace closest to where the error originated
+	var pcs []uintptr
+	for e := err; e != nil; {
+		if st, ok := e.(stackTracer); ok {
+			pcs = pcs[:0]
+			for _, f := range st.StackTrace() {
+				pcs = append(pcs, uintptr(f))
+			}
+		}
+		c, ok := e.(causer)
+		if !ok {
+			break
+		}
+		e = c.Cause()
+	}
+	if pcs == nil {
+		pcs = make([]uintptr, maxFingerprintFrames)
+		pcs = pcs[:goruntime.Callers(2+skip, pcs)]
+	}
+	return fingerprint(fmt.Sprintf("%T", errors.Cause(err)), pcs, engine)
+}
+
+// PanicFingerprint returns a stable fingerprint for a panic with value crash,
+// see ErrorFingerprint. This must be called from the deferred function that
+// recovered the panic, as the fingerprint includes the current stack.
+func PanicFingerprint(crash interface{}, engine string) string {
+	pcs := make([]uintptr, maxFingerprintFrames)
+	pcs = pcs[:goruntime.Callers(2, pcs)]
+	return fingerprint(fmt.Sprintf("panic %T", crash), pcs, engine)
+}
+
+// fingerprint hashes kind, the names of functions in pcs and engine
+func fingerprint(kind string, pcs []uintptr, engine string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", kind, engine)
+	if len(pcs) > 0 {
+		// Use CallersFrames, as it expands inlined calls
+		frames := goruntime.CallersFrames(pcs)
+		for i := 0; i < maxFingerprintFrames; i++ {
+			frame, more := frames.Next()
+			// Frames from the go runtime depend on how the panic or goroutine was
+			// started, and doesn't help identify the error
+			if !strings.HasPrefix(frame.Function, "runtime.") {
+				fmt.Fprintln(h, frame.Function)
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// IncidentMessage returns the message written to the task log when an
+// unhandled worker error has been reported, fingerprint may be empty.
+func IncidentMessage(incidentID, fingerprint string) string {
+	if fingerprint == "" {
+		return "Unhandled worker error encountered incidentID=" + incidentID
+	}
+	return "Unhandled worker error encountered incidentID=" + incidentID + " fingerprint=" + fingerprint
+}
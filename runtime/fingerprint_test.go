@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newFingerprintTestError(message string) error {
+	return errors.Errorf("download failed: %s", message)
+}
+
+func TestErrorFingerprint(t *testing.T) {
+	// Errors from the same place have the same fingerprint, even if messages differ
+	fp1 := ErrorFingerprint(newFingerprintTestError("timeout after 30s"), "qemu", 0)
+	fp2 := ErrorFingerprint(errors.Wrap(newFingerprintTestError("timeout after 45s"), "failed"), "qemu", 0)
+	require.Equal(t, fp1, fp2)
+	require.Len(t, fp1, 16)
+
+	// Engine is part of the fingerprint
+	fp3 := ErrorFingerprint(newFingerprintTestError("timeout after 30s"), "docker", 0)
+	require.NotEqual(t, fp1, fp3)
+
+	// Errors without stack trace use the stack of the caller
+	report := func(err error) string {
+		return ErrorFingerprint(err, "qemu", 0)
+	}
+	require.Equal(t, report(io.EOF), report(io.ErrUnexpectedEOF))
+	require.NotEqual(t, report(io.EOF), ErrorFingerprint(io.EOF, "qemu", 0))
+
+	// Different error types have different fingerprints
+	require.NotEqual(t, report(io.EOF), report(NewMalformedPayloadError("bad")))
+}
+
+func TestPanicFingerprint(t *testing.T) {
+	capture := func(value interface{}) (fp string) {
+		defer func() {
+			fp = PanicFingerprint(recover(), "qemu")
+		}()
+		panic(value)
+	}
+	require.Equal(t, capture("first"), capture("second"))
+	require.NotEqual(t, capture("first"), capture(errors.New("error")))
+}
+
+func TestIncidentMessage(t *testing.T) {
+	require.Equal(t, "Unhandled worker error encountered incidentID=abc", IncidentMessage("abc", ""))
+	require.Equal(t, "Unhandled worker error encountered incidentID=abc fingerprint=0123",
+		IncidentMessage("abc", "0123"))
+}
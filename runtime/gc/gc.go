@@ -128,7 +128,7 @@ func (gc *GarbageCollector) Collect() error {
 		}
 
 		if abort {
-			gc.resources = append(resources, gc.resources[i-1:]...)
+			gc.resources = append(resources, gc.resources[i:]...)
 			return err
 		}
 
@@ -136,7 +136,7 @@ func (gc *GarbageCollector) Collect() error {
 			err = r.Dispose()
 			if err != nil {
 				if err != ErrDisposableInUse {
-					gc.resources = append(resources, gc.resources[i-1:]...)
+					gc.resources = append(resources, gc.resources[i:]...)
 					return err
 				}
 				resources = append(resources, r)
@@ -163,7 +163,7 @@ func (gc *GarbageCollector) CollectAll() error {
 		err := resource.Dispose()
 		if err != nil {
 			if err != ErrDisposableInUse {
-				gc.resources = append(resources, gc.resources[i-1:]...)
+				gc.resources = append(resources, gc.resources[i:]...)
 				return err
 			}
 			resources = append(resources, resource)
@@ -1,6 +1,7 @@
 package gc
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"os"
@@ -192,3 +193,35 @@ func TestCollectMemoryOnly(t *testing.T) {
 	assert(r1.disposed, "Expected r1 to be disposed")
 	assert(!r2.disposed, "Didn't expect r2 to be disposed")
 }
+
+func TestCollectDisposeError(t *testing.T) {
+	gc := &GarbageCollector{}
+
+	// r1 is least-recently-used and fails to dispose, r2 must remain tracked
+	r1 := &testResource{
+		disk:         10,
+		lastUsed:     time.Now().Add(-time.Minute),
+		disposeError: errors.New("dispose failed"),
+	}
+	gc.Register(r1)
+	r2 := &testResource{
+		disk:     10,
+		lastUsed: time.Now(),
+	}
+	gc.Register(r2)
+
+	err := gc.Collect()
+	assert(err == r1.disposeError, "Expected error from r1.Dispose()")
+	assert(!r2.disposed, "Didn't expect r2 to be disposed")
+	assert(len(gc.resources) == 2, "Expected r1 and r2 to remain tracked")
+
+	err = gc.CollectAll()
+	assert(err == r1.disposeError, "Expected error from r1.Dispose()")
+	assert(len(gc.resources) == 2, "Expected r1 and r2 to remain tracked")
+
+	// Once r1 can be disposed, both are disposed
+	r1.disposeError = nil
+	assert(gc.CollectAll() == nil, "Didn't expect an error")
+	assert(r1.disposed && r2.disposed, "Expected r1 and r2 to be disposed")
+	assert(len(gc.resources) == 0, "Expected no resources to be tracked")
+}
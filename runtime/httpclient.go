@@ -0,0 +1,132 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/commands/version"
+)
+
+// HTTPClientOptions holds optional settings for TaskContext.NewHTTPClient.
+type HTTPClientOptions struct {
+	// Timeout for each request including reading the response body, zero means
+	// no timeout other than the task deadline.
+	Timeout time.Duration
+	// Proxy to use for requests, if nil the proxy from the HTTP_PROXY and
+	// HTTPS_PROXY environment variables is used.
+	Proxy *url.URL
+	// Detached requests aren't canceled with the TaskContext or at the task
+	// deadline, this is for requests that must complete after the task is
+	// canceled, such as uploading the task log.
+	Detached bool
+}
+
+// defaultTransport is shared by clients that don't specify a proxy, such that
+// connections can be reused across tasks.
+var defaultTransport = newTransport(http.ProxyFromEnvironment)
+
+func newTransport(proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	// Same settings as http.DefaultTransport
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// NewHTTPClient returns an http.Client for outgoing requests on behalf of the
+// task. Requests made with the client are canceled when the TaskContext is
+// canceled or aborted, or when the task deadline is exceeded. Requests without
+// a User-Agent header are given one identifying the worker and the task.
+//
+// Engines and plugins should use this rather than http.DefaultClient, such
+// that outgoing requests stop promptly when a task is canceled.
+func (c *TaskContext) NewHTTPClient(options HTTPClientOptions) *http.Client {
+	transport := defaultTransport
+	if options.Proxy != nil {
+		transport = newTransport(http.ProxyURL(options.Proxy))
+	}
+	userAgent := fmt.Sprintf("taskcluster-worker (taskId: %s, runId: %d)", c.TaskID, c.RunID)
+	if v := version.Version(); v != "" {
+		userAgent = fmt.Sprintf("taskcluster-worker/%s (taskId: %s, runId: %d)", v, c.TaskID, c.RunID)
+	}
+	return &http.Client{
+		Timeout: options.Timeout,
+		Transport: &taskTransport{
+			transport: transport,
+			context:   c,
+			userAgent: userAgent,
+			detached:  options.Detached,
+		},
+	}
+}
+
+// taskTransport binds requests to a TaskContext
+type taskTransport struct {
+	transport http.RoundTripper
+	context   *TaskContext
+	userAgent string
+	detached  bool
+}
+
+func (t *taskTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Create a context that is canceled if the request context is canceled,
+	// the task deadline is exceeded, or the TaskContext is canceled.
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if deadline := t.context.TaskInfo.LocalDeadline(); !deadline.IsZero() && !t.detached {
+		ctx, cancel = context.WithDeadline(req.Context(), deadline)
+	} else {
+		ctx, cancel = context.WithCancel(req.Context())
+	}
+	if !t.detached {
+		go func() {
+			select {
+			case <-t.context.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	// Clone request, as RoundTrippers must not modify the request
+	r := req.WithContext(ctx)
+	if r.Header.Get("User-Agent") == "" {
+		r.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		r.Header.Set("User-Agent", t.userAgent)
+	}
+
+	res, err := t.transport.RoundTrip(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// Release the context when the body is closed
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
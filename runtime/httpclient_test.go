@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+)
+
+func TestTaskContextHTTPClient(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			<-done
+			return
+		}
+		w.Write([]byte(r.Header.Get("User-Agent")))
+	}))
+	defer s.Close()
+	defer close(done) // unblock handlers before closing the server
+
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	ctx, control, err := NewTaskContext(path, TaskInfo{TaskID: "abc", RunID: 2})
+	require.NoError(t, err, "Failed to create context")
+	defer control.Dispose()
+	defer control.CloseLog()
+
+	client := ctx.NewHTTPClient(HTTPClientOptions{})
+
+	t.Run("user-agent", func(t *testing.T) {
+		res, err := client.Get(s.URL)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		buf := make([]byte, 1024)
+		n, _ := res.Body.Read(buf)
+		require.True(t, strings.Contains(string(buf[:n]), "taskId: abc, runId: 2"), "got: %s", buf[:n])
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			ctx.Cancel()
+		}()
+		_, err := client.Get(s.URL + "/block")
+		require.Error(t, err)
+	})
+
+	t.Run("detached", func(t *testing.T) {
+		// ctx was canceled above, detached requests still work
+		detached := ctx.NewHTTPClient(HTTPClientOptions{Detached: true})
+		res, err := detached.Get(s.URL)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
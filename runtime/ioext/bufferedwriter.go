@@ -0,0 +1,132 @@
+package ioext
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrWriterClosed is returned from BufferedWriter.Write after Close() has been
+// called.
+var ErrWriterClosed = errors.New("write to closed BufferedWriter")
+
+// BufferedWriter buffers writes to an underlying io.Writer, the buffer is
+// flushed when it would exceed its capacity, when data has been buffered for
+// the given interval, or when Flush() is called.
+//
+// Unlike bufio.Writer it is safe for concurrent use, and data will never sit
+// in the buffer for more than the flush interval. Writes are never split, so
+// concurrent writers writing a line at the time won't have lines interleaved.
+type BufferedWriter struct {
+	m        sync.Mutex
+	w        io.Writer
+	buffer   []byte
+	capacity int
+	interval time.Duration
+	timer    *time.Timer
+	err      error
+	closed   bool
+}
+
+// NewBufferedWriter returns a BufferedWriter writing to w, buffering at most
+// capacity bytes for at most interval.
+func NewBufferedWriter(w io.Writer, capacity int, interval time.Duration) *BufferedWriter {
+	return &BufferedWriter{
+		w:        w,
+		buffer:   make([]byte, 0, capacity),
+		capacity: capacity,
+		interval: interval,
+	}
+}
+
+// Write buffers p, writing directly to the underlying writer if p doesn't fit
+// in the buffer. Errors from previous flushes are returned here.
+func (w *BufferedWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	// Flush if p doesn't fit in the buffer
+	if len(w.buffer)+len(p) > w.capacity {
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	// Write directly, if p is larger than the buffer
+	if len(p) > w.capacity {
+		n, err := w.w.Write(p)
+		if err != nil {
+			w.err = err
+		}
+		return n, err
+	}
+
+	// Start the flush timer when the first bytes are buffered
+	if len(w.buffer) == 0 && len(p) > 0 {
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.interval, w.onTimer)
+		} else {
+			w.timer.Reset(w.interval)
+		}
+	}
+	w.buffer = append(w.buffer, p...)
+	return len(p), nil
+}
+
+func (w *BufferedWriter) onTimer() {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if !w.closed {
+		w.flush()
+	}
+}
+
+// flush writes the buffer to the underlying writer, must be called with lock
+func (w *BufferedWriter) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	_, err := w.w.Write(w.buffer)
+	w.buffer = w.buffer[:0]
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (w *BufferedWriter) Flush() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.flush()
+}
+
+// Close flushes buffered data and stops the flush timer, further writes will
+// return ErrWriterClosed. This doesn't close the underlying writer.
+func (w *BufferedWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.closed {
+		return nil
+	}
+	err := w.flush()
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	return err
+}
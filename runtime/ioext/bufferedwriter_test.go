@@ -0,0 +1,78 @@
+package ioext
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type syncBuffer struct {
+	m      sync.Mutex
+	b      bytes.Buffer
+	writes int
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.writes++
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.b.String()
+}
+
+func TestBufferedWriter(t *testing.T) {
+	t.Run("Flush", func(t *testing.T) {
+		b := &syncBuffer{}
+		w := NewBufferedWriter(b, 1024, time.Hour)
+		w.Write([]byte("hello "))
+		w.Write([]byte("world"))
+		require.Equal(t, "", b.String())
+		require.NoError(t, w.Flush())
+		require.Equal(t, "hello world", b.String())
+		require.Equal(t, 1, b.writes)
+		require.NoError(t, w.Close())
+	})
+
+	t.Run("Capacity", func(t *testing.T) {
+		b := &syncBuffer{}
+		w := NewBufferedWriter(b, 8, time.Hour)
+		w.Write([]byte("12345"))
+		w.Write([]byte("6789"))
+		require.Equal(t, "12345", b.String())
+		w.Write([]byte("this-is-too-large"))
+		require.Equal(t, "123456789this-is-too-large", b.String())
+		require.NoError(t, w.Close())
+	})
+
+	t.Run("Interval", func(t *testing.T) {
+		b := &syncBuffer{}
+		w := NewBufferedWriter(b, 1024, 5*time.Millisecond)
+		w.Write([]byte("hello"))
+		for b.String() != "hello" {
+			time.Sleep(1 * time.Millisecond)
+		}
+		w.Write([]byte(" world"))
+		for b.String() != "hello world" {
+			time.Sleep(1 * time.Millisecond)
+		}
+		require.NoError(t, w.Close())
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		b := &syncBuffer{}
+		w := NewBufferedWriter(b, 1024, time.Hour)
+		w.Write([]byte("hello"))
+		require.NoError(t, w.Close())
+		require.Equal(t, "hello", b.String())
+		_, err := w.Write([]byte("world"))
+		require.Equal(t, ErrWriterClosed, err)
+	})
+}
@@ -0,0 +1,21 @@
+package ioext
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DiskUsage returns the number of bytes of disk space used by files in the
+// folder at path, similar to 'du'. Hard-linked files are counted once for each
+// link, and symbolic links are not followed.
+func DiskUsage(path string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		size += diskUsage(info)
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,16 @@
+// +build !windows
+
+package ioext
+
+import (
+	"os"
+	"syscall"
+)
+
+// diskUsage returns the disk space allocated for a file
+func diskUsage(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Blocks) * 512
+	}
+	return uint64(info.Size())
+}
@@ -0,0 +1,33 @@
+package ioext
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskUsage(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ioext-diskusage-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	empty, err := DiskUsage(folder)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(folder, "a", "b"), 0777))
+	data := make([]byte, 64*1024)
+	for i := range data {
+		data[i] = byte(i) // not sparse
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "a", "b", "file"), data, 0666))
+
+	size, err := DiskUsage(folder)
+	require.NoError(t, err)
+	require.True(t, size >= empty+uint64(len(data)), "expected at least %d bytes, got %d", empty+uint64(len(data)), size)
+
+	_, err = DiskUsage(filepath.Join(folder, "missing"))
+	require.Error(t, err)
+}
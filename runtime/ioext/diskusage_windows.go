@@ -0,0 +1,12 @@
+package ioext
+
+import "os"
+
+// diskUsage returns the size of a file, as allocated disk space isn't
+// available from os.FileInfo on windows
+func diskUsage(info os.FileInfo) uint64 {
+	if info.IsDir() {
+		return 0
+	}
+	return uint64(info.Size())
+}
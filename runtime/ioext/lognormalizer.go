@@ -0,0 +1,224 @@
+package ioext
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxEscapeSequenceLength is the maximum length of an escape sequence passed
+// through by LogNormalizer, longer sequences are discarded.
+const maxEscapeSequenceLength = 64
+
+// States for the escape sequence parser in LogNormalizer
+const (
+	stateText         = iota
+	stateEscape       // after ESC
+	stateCSI          // after ESC [
+	stateString       // inside OSC, DCS, SOS, PM or APC string
+	stateStringEscape // after ESC inside a string
+)
+
+// LogNormalizer is an io.Writer that normalizes output written to it, such that
+// it renders correctly in log viewers, regardless of the platform it's from.
+//
+// LogNormalizer converts CRLF line endings to LF, and passes through ANSI
+// escape sequences for colors and text styles (SGR). Other escape sequences,
+// like cursor movement, are removed and other control characters are written
+// in caret notation, such that "\x07" becomes "^G". Tabs, line feeds and
+// carriage returns not followed by a line feed are passed through.
+//
+// If the first write starts with a UTF-16 byte order mark or looks like ASCII
+// encoded as UTF-16LE, which is common on Windows, the output is converted to
+// UTF-8. A UTF-8 byte order mark is removed.
+//
+// Incomplete sequences at the end of a write are held until the next write,
+// hence, an incomplete sequence at the end of the output is discarded.
+type LogNormalizer struct {
+	m         sync.Mutex
+	w         io.Writer
+	started   bool             // true, if encoding has been detected
+	order     binary.ByteOrder // byte order, if output is UTF-16
+	unit      []byte           // incomplete UTF-16 code unit
+	surrogate rune             // high surrogate awaiting low surrogate
+	state     int
+	sequence  []byte // escape sequence being parsed
+	cr        bool   // true, if last byte was a carriage return
+}
+
+// NewLogNormalizer returns a LogNormalizer that writes normalized output to w.
+func NewLogNormalizer(w io.Writer) *LogNormalizer {
+	return &LogNormalizer{w: w}
+}
+
+func (n *LogNormalizer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	data := p
+	if !n.started {
+		n.started = true
+		data = n.detectEncoding(data)
+	}
+	if n.order != nil {
+		data = n.decodeUTF16(data)
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(data))
+	for _, c := range data {
+		n.normalize(&b, c)
+	}
+	if b.Len() > 0 {
+		if _, err := n.w.Write(b.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// detectEncoding sets order if data is UTF-16 and returns data without any
+// byte order mark.
+func (n *LogNormalizer) detectEncoding(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		n.order = binary.LittleEndian
+		return data[2:]
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		n.order = binary.BigEndian
+		return data[2:]
+	}
+	// Output from Windows is often UTF-16LE without byte order mark, we detect
+	// this if the first two characters are ASCII.
+	if len(data) >= 4 && data[1] == 0 && data[3] == 0 &&
+		data[0] != 0 && data[0] < utf8.RuneSelf &&
+		data[2] != 0 && data[2] < utf8.RuneSelf {
+		n.order = binary.LittleEndian
+	}
+	return data
+}
+
+// decodeUTF16 returns data decoded from UTF-16 and encoded as UTF-8
+func (n *LogNormalizer) decodeUTF16(data []byte) []byte {
+	if len(n.unit) > 0 {
+		data = append(n.unit, data...)
+		n.unit = nil
+	}
+	if len(data)%2 != 0 {
+		n.unit = []byte{data[len(data)-1]}
+		data = data[:len(data)-1]
+	}
+
+	result := make([]byte, 0, len(data))
+	var buf [utf8.UTFMax]byte
+	for i := 0; i < len(data); i += 2 {
+		r := rune(n.order.Uint16(data[i:]))
+		if n.surrogate != 0 {
+			pair := utf16.DecodeRune(n.surrogate, r)
+			n.surrogate = 0
+			if pair != unicode.ReplacementChar {
+				result = append(result, buf[:utf8.EncodeRune(buf[:], pair)]...)
+				continue
+			}
+			result = append(result, buf[:utf8.EncodeRune(buf[:], unicode.ReplacementChar)]...)
+		}
+		if r >= 0xD800 && r < 0xDC00 { // high surrogate
+			n.surrogate = r
+			continue
+		}
+		// Lone low surrogates are encoded as unicode.ReplacementChar
+		result = append(result, buf[:utf8.EncodeRune(buf[:], r)]...)
+	}
+	return result
+}
+
+// normalize writes c to b, given the current state
+func (n *LogNormalizer) normalize(b *bytes.Buffer, c byte) {
+	switch n.state {
+	case stateText:
+		if n.cr {
+			n.cr = false
+			if c != '\n' {
+				b.WriteByte('\r')
+			}
+		}
+		switch {
+		case c == '\r':
+			n.cr = true
+		case c == 0x1B:
+			n.state = stateEscape
+			n.sequence = append(n.sequence[:0], c)
+		case c == '\n' || c == '\t':
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7F:
+			b.WriteByte('^')
+			b.WriteByte(c ^ 0x40)
+		default:
+			b.WriteByte(c)
+		}
+	case stateEscape:
+		switch {
+		case c == '[':
+			n.state = stateCSI
+			n.sequence = append(n.sequence, c)
+		case c == ']' || c == 'P' || c == 'X' || c == '^' || c == '_':
+			n.state = stateString
+		case c >= 0x20 && c <= 0x2F: // intermediate bytes, like ESC ( B
+		case c >= 0x30 && c <= 0x7E: // end of escape sequence, discarded
+			n.state = stateText
+		default: // sequence aborted
+			n.state = stateText
+			n.normalize(b, c)
+		}
+	case stateCSI:
+		switch {
+		case c >= 0x20 && c <= 0x3F: // parameter and intermediate bytes
+			if len(n.sequence) < maxEscapeSequenceLength {
+				n.sequence = append(n.sequence, c)
+			}
+		case c >= 0x40 && c <= 0x7E: // end of control sequence
+			n.state = stateText
+			if c == 'm' && isSGRParameters(n.sequence[2:]) && len(n.sequence) < maxEscapeSequenceLength {
+				b.Write(n.sequence)
+				b.WriteByte(c)
+			}
+		default: // sequence aborted
+			n.state = stateText
+			n.normalize(b, c)
+		}
+	case stateString:
+		if c == 0x07 { // BEL terminates strings like OSC
+			n.state = stateText
+		} else if c == 0x1B {
+			n.state = stateStringEscape
+		}
+	case stateStringEscape:
+		if c == '\\' { // ESC \ terminates strings
+			n.state = stateText
+		} else {
+			n.state = stateEscape
+			n.sequence = append(n.sequence[:0], 0x1B)
+			n.normalize(b, c)
+		}
+	}
+}
+
+// isSGRParameters returns true, if p is parameters for SGR (Select Graphic
+// Rendition) sequence, which only contains digits and separators.
+func isSGRParameters(p []byte) bool {
+	for _, c := range p {
+		if (c < '0' || c > '9') && c != ';' && c != ':' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package ioext
+
+import (
+	"bytes"
+	"testing"
+)
+
+func normalizeLog(t *testing.T, chunks ...[]byte) string {
+	var b bytes.Buffer
+	w := NewLogNormalizer(&b)
+	for _, chunk := range chunks {
+		n, err := w.Write(chunk)
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if n != len(chunk) {
+			t.Errorf("expected to write %d bytes, wrote %d", len(chunk), n)
+		}
+	}
+	return b.String()
+}
+
+func TestLogNormalizer(t *testing.T) {
+	testCases := []struct {
+		name     string
+		chunks   []string
+		expected string
+	}{
+		{"text", []string{"hello\n", "world\n"}, "hello\nworld\n"},
+		{"crlf", []string{"hello\r\nworld\r\n"}, "hello\nworld\n"},
+		{"crlf split", []string{"hello\r", "\nworld"}, "hello\nworld"},
+		{"progress", []string{"10%\r20%\r", "30%\n"}, "10%\r20%\r30%\n"},
+		{"colors", []string{"\x1b[1;31mred\x1b[0m\n"}, "\x1b[1;31mred\x1b[0m\n"},
+		{"colors split", []string{"\x1b[3", "2mgreen\x1b", "[m"}, "\x1b[32mgreen\x1b[m"},
+		{"cursor movement", []string{"a\x1b[2Jb\x1b[10;10Hc\x1b[?25l"}, "abc"},
+		{"charset", []string{"a\x1b(Bb"}, "ab"},
+		{"osc title", []string{"a\x1b]0;title\x07b\x1b]2;title\x1b\\c"}, "abc"},
+		{"control characters", []string{"bell\x07\x00tab\t\x7f"}, "bell^G^@tab\t^?"},
+		{"aborted sequence", []string{"a\x1b[1\nb"}, "a\nb"},
+		{"utf-8", []string{"blåbærgrød ☃\n"}, "blåbærgrød ☃\n"},
+		{"utf-8 bom", []string{"\xef\xbb\xbfhello"}, "hello"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var chunks [][]byte
+			for _, s := range tc.chunks {
+				chunks = append(chunks, []byte(s))
+			}
+			if result := normalizeLog(t, chunks...); result != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestLogNormalizerUTF16(t *testing.T) {
+	// "hi ☃\r\n" and a surrogate pair for U+1F600 in UTF-16LE
+	le := []byte{'h', 0, 'i', 0, ' ', 0, 0x03, 0x26, '\r', 0, '\n', 0, 0x3D, 0xD8, 0x00, 0xDE}
+	expected := "hi ☃\n\U0001F600"
+
+	t.Run("little endian", func(t *testing.T) {
+		if result := normalizeLog(t, le); result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("little endian with bom", func(t *testing.T) {
+		data := append([]byte{0xFF, 0xFE}, le...)
+		if result := normalizeLog(t, data); result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("big endian with bom", func(t *testing.T) {
+		data := []byte{0xFE, 0xFF}
+		for i := 0; i < len(le); i += 2 {
+			data = append(data, le[i+1], le[i])
+		}
+		if result := normalizeLog(t, data); result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("split chunks", func(t *testing.T) {
+		// Split in the middle of code units and the surrogate pair
+		if result := normalizeLog(t, le[:5], le[5:13], le[13:]); result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package ioext
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter is an io.Writer that writes prefix at the start of each line
+// written to the underlying writer.
+//
+// Each call to Write results in a single call to Write on the underlying
+// writer, so lines written in one chunk stay together when multiple writers
+// share the same underlying writer.
+type PrefixWriter struct {
+	m         sync.Mutex
+	w         io.Writer
+	prefix    []byte
+	midstream bool // true, if the last byte written wasn't a newline
+}
+
+// NewPrefixWriter returns a PrefixWriter that prefixes lines written to w.
+func NewPrefixWriter(w io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	var b bytes.Buffer
+	b.Grow(len(p) + len(w.prefix))
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !w.midstream {
+			b.Write(w.prefix)
+		}
+		b.Write(line)
+		w.midstream = line[len(line)-1] != '\n'
+	}
+	if _, err := w.w.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,24 @@
+package ioext
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewPrefixWriter(&b, "[test] ")
+	for _, s := range []string{"hello\nwor", "ld\n", "", "\n", "a\nb\nc"} {
+		n, err := w.Write([]byte(s))
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if n != len(s) {
+			t.Errorf("expected to write %d bytes, wrote %d", len(s), n)
+		}
+	}
+	expected := "[test] hello\n[test] world\n[test] \n[test] a\n[test] b\n[test] c"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,62 @@
+package ioext
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitChunkSize is the maximum number of bytes read from a rate limited
+// reader at once, this keeps readers sharing a RateLimiter fair.
+const rateLimitChunkSize = 32 * 1024
+
+// A RateLimiter limits the aggregate rate at which data is read through all
+// readers wrapped with it.
+type RateLimiter struct {
+	m    sync.Mutex
+	rate int64     // bytes per second
+	next time.Time // time at which the next bytes may be read
+}
+
+// NewRateLimiter returns a RateLimiter that allows bytesPerSecond to be read
+// across all readers wrapped with it.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		panic("ioext: NewRateLimiter requires a positive rate")
+	}
+	return &RateLimiter{rate: bytesPerSecond}
+}
+
+// Wait blocks until n bytes may be transferred without exceeding the rate.
+func (l *RateLimiter) Wait(n int) {
+	l.m.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.m.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// ReadSeekCloser wraps r such that reads are limited by the RateLimiter.
+func (l *RateLimiter) ReadSeekCloser(r ReadSeekCloser) ReadSeekCloser {
+	return &rateLimitedReader{ReadSeekCloser: r, limiter: l}
+}
+
+type rateLimitedReader struct {
+	ReadSeekCloser
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitChunkSize {
+		p = p[:rateLimitChunkSize]
+	}
+	n, err := r.ReadSeekCloser.Read(p)
+	r.limiter.Wait(n)
+	return n, err
+}
@@ -0,0 +1,33 @@
+package ioext
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(400 * 1024)
+
+	// Read 200 KiB through each of two readers, which should take at least
+	// 750 ms, as the limit is shared and the first chunk isn't delayed.
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := l.ReadSeekCloser(NopCloser(bytes.NewReader(make([]byte, 200*1024))))
+			n, err := io.Copy(ioutil.Discard, r)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 200*1024, n)
+		}()
+	}
+	wg.Wait()
+	assert.True(t, time.Since(started) >= 750*time.Millisecond, "expected reads to be rate limited")
+}
@@ -0,0 +1,93 @@
+package ioext
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// RedactedText replaces secrets written to a Redactor.
+const RedactedText = "[redacted]"
+
+// Redactor is an io.Writer that replaces secrets written to it with
+// RedactedText, before writing to the underlying writer.
+//
+// Secrets are obtained from the secrets function on each write, so secrets
+// added after the Redactor was created are also redacted. Secrets must be
+// ordered longest first, and must not contain line breaks.
+//
+// If a write ends with the start of a secret, the end is held until the next
+// write or Flush(), hence, Flush() must be called when no more output will be
+// written. As secrets don't contain line breaks, output is never held past the
+// end of a line.
+type Redactor struct {
+	m       sync.Mutex
+	w       io.Writer
+	secrets func() []string
+	pending []byte
+}
+
+// NewRedactor returns a Redactor that writes to w with secrets redacted.
+func NewRedactor(w io.Writer, secrets func() []string) *Redactor {
+	return &Redactor{w: w, secrets: secrets}
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	secrets := r.secrets()
+	if len(secrets) == 0 && len(r.pending) == 0 {
+		if _, err := r.w.Write(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	data := append(r.pending, p...)
+	for _, s := range secrets {
+		data = bytes.Replace(data, []byte(s), []byte(RedactedText), -1)
+	}
+
+	// Hold the longest suffix that could be the start of a secret
+	hold := 0
+	for _, s := range secrets {
+		for n := min(len(s)-1, len(data)); n > hold; n-- {
+			if bytes.HasPrefix([]byte(s), data[len(data)-n:]) {
+				hold = n
+				break
+			}
+		}
+	}
+	r.pending = append([]byte(nil), data[len(data)-hold:]...)
+
+	if len(data) > hold {
+		if _, err := r.w.Write(data[:len(data)-hold]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes output held back, because it could be the start of a secret.
+func (r *Redactor) Flush() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if len(r.pending) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(r.pending)
+	r.pending = nil
+	return err
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
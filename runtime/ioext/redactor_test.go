@@ -0,0 +1,47 @@
+package ioext
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	var b bytes.Buffer
+	secrets := []string{"secret-token"}
+	w := NewRedactor(&b, func() []string { return secrets })
+	for _, s := range []string{"token: secret-token\n", "split: secr", "et-token\n", "not a secre", "t\n", "end: secr"} {
+		n, err := w.Write([]byte(s))
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if n != len(s) {
+			t.Errorf("expected to write %d bytes, wrote %d", len(s), n)
+		}
+	}
+	expected := "token: [redacted]\nsplit: [redacted]\nnot a secret\nend: "
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+
+	// Secrets added later are also redacted
+	secrets = []string{"long-secret-value", "other-secret"}
+	w.Write([]byte("\nlong-secret-value other-secret secret-token\n"))
+	expected += "secr\n[redacted] [redacted] secret-token\n"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+
+	// Flush writes output held back, if the output ends with a partial match
+	w.Write([]byte("partial: long-secret"))
+	expected += "partial: "
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	expected += "long-secret"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,14 @@
+// Package ipc provides authenticated local IPC between the worker and helper
+// processes, such as guest agents, image converters and privileged network
+// helpers.
+//
+// The worker calls Listen() and passes Listener.Environment() to the helper
+// process it starts, the helper calls DialEnvironment() to connect. On
+// windows connections use named pipes, on other platforms unix domain sockets.
+//
+// Both sides of a connection prove knowledge of a shared secret using a
+// challenge-response handshake, the secret itself is never sent over the
+// connection. This allows a privilege-separated architecture where only a
+// small helper runs as root, without other local users being able to talk to
+// either side.
+package ipc
@@ -0,0 +1,212 @@
+package ipc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Environment variables used to pass address and secret to helper processes
+const (
+	EnvAddress = "TASKCLUSTER_WORKER_IPC_ADDRESS"
+	EnvSecret  = "TASKCLUSTER_WORKER_IPC_SECRET"
+)
+
+// Maximum time allowed for the handshake, before the connection is closed.
+const handshakeTimeout = 10 * time.Second
+
+// Size of secret and nonces in bytes
+const (
+	secretSize = 32
+	nonceSize  = 32
+)
+
+// ErrAuthenticationFailed is returned if the other side of a connection
+// failed to prove knowledge of the shared secret.
+var ErrAuthenticationFailed = errors.New("ipc: peer failed to authenticate")
+
+// ErrListenerClosed is returned from Listener.Accept() when the Listener
+// has been closed.
+var ErrListenerClosed = errors.New("ipc: listener closed")
+
+// NewSecret returns a new random secret for use with Listen and Dial
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrap(err, "failed to generate random secret")
+	}
+	return secret, nil
+}
+
+// A Listener accepts authenticated connections from helper processes.
+type Listener struct {
+	listener net.Listener
+	address  string
+	secret   []byte
+}
+
+// Listen returns a Listener on address, authenticating connections with
+// secret. Use NewAddress() to create an address and NewSecret() to create a
+// secret.
+func Listen(address string, secret []byte) (*Listener, error) {
+	if len(secret) == 0 {
+		panic("ipc.Listen() requires a non-empty secret")
+	}
+	l, err := listen(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on '%s'", address)
+	}
+	return &Listener{
+		listener: l,
+		address:  address,
+		secret:   secret,
+	}, nil
+}
+
+// NewAddress returns a new random address, folder is ignored on platforms
+// where addresses aren't files. Folder should only be writable by the current
+// user, and short, as unix socket paths are limited to about 100 characters.
+func NewAddress(folder string) (string, error) {
+	name := make([]byte, 8)
+	if _, err := rand.Read(name); err != nil {
+		return "", errors.Wrap(err, "failed to generate random address")
+	}
+	return newAddress(folder, "tc-worker-"+hex.EncodeToString(name)), nil
+}
+
+// Address returns the address the Listener is listening on.
+func (l *Listener) Address() string {
+	return l.address
+}
+
+// Environment returns environment variables, in the format used by
+// exec.Cmd.Env, which allows a helper process to connect with
+// DialEnvironment().
+func (l *Listener) Environment() []string {
+	return []string{
+		fmt.Sprintf("%s=%s", EnvAddress, l.address),
+		fmt.Sprintf("%s=%s", EnvSecret, hex.EncodeToString(l.secret)),
+	}
+}
+
+// Accept waits for a connection and authenticates it. Connections that fail to
+// authenticate are closed and ErrAuthenticationFailed is returned, callers
+// should generally log such errors and keep accepting.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if err = handshake(conn, l.secret, false); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Close stops listening, pending calls to Accept() will return an error.
+func (l *Listener) Close() error {
+	return l.listener.Close()
+}
+
+// Dial connects to a Listener on address and authenticates with secret.
+func Dial(address string, secret []byte) (net.Conn, error) {
+	conn, err := dial(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to '%s'", address)
+	}
+	if err = handshake(conn, secret, true); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// DialEnvironment connects to the Listener given by the environment variables
+// set from Listener.Environment(). The secret is removed from the environment,
+// so it isn't inherited by sub-processes.
+func DialEnvironment() (net.Conn, error) {
+	address := os.Getenv(EnvAddress)
+	secret, err := hex.DecodeString(os.Getenv(EnvSecret))
+	if address == "" || err != nil || len(secret) == 0 {
+		return nil, fmt.Errorf("ipc: environment variables %s and %s must be set", EnvAddress, EnvSecret)
+	}
+	os.Unsetenv(EnvSecret)
+	return Dial(address, secret)
+}
+
+// handshake authenticates both sides of conn, by each side proving knowledge
+// of secret with an HMAC over nonces from both sides. The client sends a
+// nonce, the server responds with its nonce and HMAC("server" || nonces),
+// finally the client sends HMAC("client" || nonces).
+func handshake(conn net.Conn, secret []byte, client bool) error {
+	// Close the connection if the handshake takes too long, this works on all
+	// platforms, unlike deadlines.
+	timer := time.AfterFunc(handshakeTimeout, func() { conn.Close() })
+	err := doHandshake(conn, secret, client)
+	if !timer.Stop() {
+		return errors.New("ipc: handshake timed out")
+	}
+	return err
+}
+
+func doHandshake(conn io.ReadWriter, secret []byte, client bool) error {
+	nonces := make([]byte, 2*nonceSize)
+	clientNonce, serverNonce := nonces[:nonceSize], nonces[nonceSize:]
+	mine, theirs := serverNonce, clientNonce
+	if client {
+		mine, theirs = clientNonce, serverNonce
+	}
+	if _, err := rand.Read(mine); err != nil {
+		return errors.Wrap(err, "failed to generate nonce")
+	}
+
+	if client {
+		if _, err := conn.Write(clientNonce); err != nil {
+			return errors.Wrap(err, "ipc: handshake failed")
+		}
+		msg := make([]byte, nonceSize+sha256.Size)
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return errors.Wrap(err, "ipc: handshake failed")
+		}
+		copy(theirs, msg[:nonceSize])
+		if !hmac.Equal(msg[nonceSize:], sign(secret, "server", nonces)) {
+			return ErrAuthenticationFailed
+		}
+		if _, err := conn.Write(sign(secret, "client", nonces)); err != nil {
+			return errors.Wrap(err, "ipc: handshake failed")
+		}
+		return nil
+	}
+
+	if _, err := io.ReadFull(conn, theirs); err != nil {
+		return errors.Wrap(err, "ipc: handshake failed")
+	}
+	if _, err := conn.Write(append(append([]byte{}, mine...), sign(secret, "server", nonces)...)); err != nil {
+		return errors.Wrap(err, "ipc: handshake failed")
+	}
+	mac := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, mac); err != nil {
+		return errors.Wrap(err, "ipc: handshake failed")
+	}
+	if !hmac.Equal(mac, sign(secret, "client", nonces)) {
+		return ErrAuthenticationFailed
+	}
+	return nil
+}
+
+// sign returns HMAC(secret, role || nonces)
+func sign(secret []byte, role string, nonces []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(role))
+	h.Write(nonces)
+	return h.Sum(nil)
+}
@@ -0,0 +1,38 @@
+// +build !windows
+
+package ipc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+func newAddress(folder, name string) string {
+	return filepath.Join(folder, name+".sock")
+}
+
+// listen listens on a unix domain socket only accessible to the current user
+func listen(address string) (net.Listener, error) {
+	// Remove stale socket, but never anything that isn't a socket
+	if info, err := os.Lstat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(address); err != nil {
+			return nil, errors.Wrap(err, "failed to remove stale socket")
+		}
+	}
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(address, 0600); err != nil {
+		l.Close()
+		return nil, errors.Wrap(err, "failed to restrict socket permissions")
+	}
+	return l, nil
+}
+
+func dial(address string) (net.Conn, error) {
+	return net.Dial("unix", address)
+}
@@ -0,0 +1,90 @@
+package ipc
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setupListener(t *testing.T) (*Listener, func()) {
+	folder, err := ioutil.TempDir("", "ipc-test")
+	require.NoError(t, err)
+	address, err := NewAddress(folder)
+	require.NoError(t, err)
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	l, err := Listen(address, secret)
+	require.NoError(t, err)
+	return l, func() {
+		l.Close()
+		os.RemoveAll(folder)
+	}
+}
+
+func TestDialAndEcho(t *testing.T) {
+	l, cleanup := setupListener(t)
+	defer cleanup()
+
+	go func() {
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	conn, err := Dial(l.Address(), l.secret)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("hello helper"))
+	require.NoError(t, err)
+	buf := make([]byte, 12)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello helper", string(buf))
+}
+
+func TestDialWrongSecret(t *testing.T) {
+	l, cleanup := setupListener(t)
+	defer cleanup()
+
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		accepted <- err
+	}()
+
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	_, err = Dial(l.Address(), secret)
+	require.Equal(t, ErrAuthenticationFailed, err)
+	require.Error(t, <-accepted)
+}
+
+func TestDialEnvironment(t *testing.T) {
+	l, cleanup := setupListener(t)
+	defer cleanup()
+
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	for _, env := range l.Environment() {
+		for i := range env {
+			if env[i] == '=' {
+				os.Setenv(env[:i], env[i+1:])
+				break
+			}
+		}
+	}
+	conn, err := DialEnvironment()
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, "", os.Getenv(EnvSecret), "expected secret to be removed")
+}
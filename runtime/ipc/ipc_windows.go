@@ -0,0 +1,281 @@
+package ipc
+
+import (
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW    = kernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe    = kernel32.NewProc("ConnectNamedPipe")
+	procDisconnectNamedPipe = kernel32.NewProc("DisconnectNamedPipe")
+	procGetOverlappedResult = kernel32.NewProc("GetOverlappedResult")
+	procCreateEventW        = kernel32.NewProc("CreateEventW")
+)
+
+const (
+	pipeAccessDuplex          = 0x3
+	fileFlagFirstPipeInstance = 0x80000
+	pipeRejectRemoteClients   = 0x8
+	pipeUnlimitedInstances    = 255
+	pipeBufferSize            = 64 * 1024
+	securitySqosPresent       = 0x100000
+	securityIdentification    = 0x10000
+)
+
+const (
+	errPipeBusy         = syscall.Errno(231)
+	errPipeNotConnected = syscall.Errno(233)
+	errPipeConnected    = syscall.Errno(535)
+)
+
+// Time to wait for a pipe instance to become available in dial()
+const dialTimeout = 5 * time.Second
+
+var errConnClosed = errors.New("ipc: use of closed connection")
+
+func newAddress(folder, name string) string {
+	return `\\.\pipe\` + name
+}
+
+// pipeListener listens on a named pipe, always keeping one pipe instance
+// waiting for the next client.
+type pipeListener struct {
+	address string
+	accept  sync.Mutex // held while accepting, allowing only one Accept() at a time
+	m       sync.Mutex // protects next and closed
+	next    syscall.Handle
+	closed  bool
+}
+
+// listen creates the first instance of a named pipe, failing if the pipe
+// already exists, so another process can't squat the address.
+func listen(address string) (net.Listener, error) {
+	h, err := createNamedPipe(address, true)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeListener{address: address, next: h}, nil
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.accept.Lock()
+	defer l.accept.Unlock()
+
+	l.m.Lock()
+	if l.closed {
+		l.m.Unlock()
+		return nil, ErrListenerClosed
+	}
+	h := l.next
+	l.m.Unlock()
+
+	// Wait for a client, Close() aborts this by closing the handle
+	_, err := overlappedIO(h, func(o *syscall.Overlapped, done *uint32) error {
+		r, _, err := procConnectNamedPipe.Call(uintptr(h), uintptr(unsafe.Pointer(o)))
+		if r != 0 {
+			return nil
+		}
+		return err
+	})
+	if err == errPipeConnected {
+		err = nil // client connected before ConnectNamedPipe was called
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.closed {
+		return nil, ErrListenerClosed
+	}
+	if err != nil {
+		procDisconnectNamedPipe.Call(uintptr(h))
+		return nil, err
+	}
+	next, err := createNamedPipe(l.address, false)
+	if err != nil {
+		// Keep the instance for the next call to Accept()
+		procDisconnectNamedPipe.Call(uintptr(h))
+		return nil, err
+	}
+	l.next = next
+	return &pipeConn{handle: h, address: pipeAddr(l.address)}, nil
+}
+
+func (l *pipeListener) Close() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return syscall.CloseHandle(l.next)
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.address)
+}
+
+func createNamedPipe(address string, first bool) (syscall.Handle, error) {
+	name, err := syscall.UTF16PtrFromString(address)
+	if err != nil {
+		return syscall.InvalidHandle, err
+	}
+	mode := uint32(pipeAccessDuplex | syscall.FILE_FLAG_OVERLAPPED)
+	if first {
+		mode |= fileFlagFirstPipeInstance
+	}
+	r, _, err := procCreateNamedPipeW.Call(
+		uintptr(unsafe.Pointer(name)),
+		uintptr(mode),
+		uintptr(pipeRejectRemoteClients), // byte-mode, blocking, local clients
+		uintptr(pipeUnlimitedInstances),
+		uintptr(pipeBufferSize),
+		uintptr(pipeBufferSize),
+		0, // default timeout
+		0, // default security descriptor
+	)
+	if syscall.Handle(r) == syscall.InvalidHandle {
+		return syscall.InvalidHandle, err
+	}
+	return syscall.Handle(r), nil
+}
+
+// dial opens a named pipe, using identification level impersonation such that
+// the server can't act on behalf of a privileged client.
+func dial(address string) (net.Conn, error) {
+	name, err := syscall.UTF16PtrFromString(address)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(dialTimeout)
+	for {
+		h, err := syscall.CreateFile(
+			name,
+			syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+			0, nil,
+			syscall.OPEN_EXISTING,
+			syscall.FILE_FLAG_OVERLAPPED|securitySqosPresent|securityIdentification,
+			0,
+		)
+		if err == nil {
+			return &pipeConn{handle: h, address: pipeAddr(address)}, nil
+		}
+		// All instances are busy, if the listener is between calls to Accept()
+		if err != errPipeBusy || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// overlappedIO starts an overlapped operation with fn and waits for it to
+// complete, this allows concurrent reads and writes on the same handle.
+func overlappedIO(h syscall.Handle, fn func(o *syscall.Overlapped, done *uint32) error) (int, error) {
+	r, _, err := procCreateEventW.Call(0, 1, 0, 0)
+	if r == 0 {
+		return 0, errors.Wrap(err, "failed to create event")
+	}
+	event := syscall.Handle(r)
+	defer syscall.CloseHandle(event)
+
+	o := &syscall.Overlapped{HEvent: event}
+	var done uint32
+	err = fn(o, &done)
+	if err == syscall.ERROR_IO_PENDING {
+		r, _, err = procGetOverlappedResult.Call(
+			uintptr(h), uintptr(unsafe.Pointer(o)), uintptr(unsafe.Pointer(&done)), 1,
+		)
+		if r != 0 {
+			err = nil
+		}
+	}
+	return int(done), err
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a pipeAddr) String() string {
+	return string(a)
+}
+
+// pipeConn implements net.Conn for a named pipe opened for overlapped IO
+type pipeConn struct {
+	handle  syscall.Handle
+	address pipeAddr
+	closed  atomics.Bool
+}
+
+func (c *pipeConn) Read(p []byte) (int, error) {
+	if c.closed.Get() {
+		return 0, errConnClosed
+	}
+	n, err := overlappedIO(c.handle, func(o *syscall.Overlapped, done *uint32) error {
+		return syscall.ReadFile(c.handle, p, done, o)
+	})
+	return n, c.mapError(err)
+}
+
+func (c *pipeConn) Write(p []byte) (int, error) {
+	if c.closed.Get() {
+		return 0, errConnClosed
+	}
+	n, err := overlappedIO(c.handle, func(o *syscall.Overlapped, done *uint32) error {
+		return syscall.WriteFile(c.handle, p, done, o)
+	})
+	return n, c.mapError(err)
+}
+
+func (c *pipeConn) mapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case c.closed.Get():
+		return errConnClosed
+	case err == syscall.ERROR_BROKEN_PIPE, err == errPipeNotConnected:
+		return io.EOF
+	default:
+		return err
+	}
+}
+
+// Close closes the handle, aborting pending reads and writes
+func (c *pipeConn) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	return syscall.CloseHandle(c.handle)
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.address
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.address
+}
+
+var errNoDeadline = errors.New("ipc: deadlines are not supported on named pipes")
+
+func (c *pipeConn) SetDeadline(time.Time) error {
+	return errNoDeadline
+}
+
+func (c *pipeConn) SetReadDeadline(time.Time) error {
+	return errNoDeadline
+}
+
+func (c *pipeConn) SetWriteDeadline(time.Time) error {
+	return errNoDeadline
+}
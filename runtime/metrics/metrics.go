@@ -0,0 +1,365 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text format.
+//
+// The worker creates a Registry which is available to engines and plugins as
+// runtime.Environment.Metrics, such that they can add their own metrics or
+// register custom Collectors. All methods are safe to call on a nil Registry
+// and on the nil metrics it returns, so code using metrics need not check if
+// metrics are enabled.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType of the Prometheus text format written by Registry
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// A Collector writes metrics in the Prometheus text format, custom
+// Collectors can be added to a Registry with Registry.Register().
+type Collector interface {
+	Collect(w io.Writer) error
+}
+
+// A Registry holds metrics and collectors exposed by ServeHTTP.
+type Registry struct {
+	m          sync.Mutex
+	metrics    map[string]Collector
+	names      []string
+	collectors []Collector
+}
+
+// NewRegistry returns a new empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]Collector),
+	}
+}
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// lookup returns the metric with given name, or adds the metric returned by
+// create. This panics if name is invalid or already used by another kind of
+// metric, as this is a programming error.
+func (r *Registry) lookup(name string, create func() Collector) Collector {
+	if !namePattern.MatchString(name) {
+		panic(fmt.Sprintf("invalid metric name: '%s'", name))
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if c, ok := r.metrics[name]; ok {
+		return c
+	}
+	c := create()
+	r.metrics[name] = c
+	r.names = append(r.names, name)
+	sort.Strings(r.names)
+	return c
+}
+
+// Counter returns the counter with given name, creating it if it doesn't
+// exist. Labels are the names of the labels values must be given for when
+// the counter is incremented.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+	c, ok := r.lookup(name, func() Collector {
+		return &Counter{series: newSeries(name, help, "counter", labels)}
+	}).(*Counter)
+	if !ok {
+		panic(fmt.Sprintf("metric '%s' is not a counter", name))
+	}
+	return c
+}
+
+// Gauge returns the gauge with given name, creating it if it doesn't exist.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	if r == nil {
+		return nil
+	}
+	g, ok := r.lookup(name, func() Collector {
+		return &Gauge{series: newSeries(name, help, "gauge", labels)}
+	}).(*Gauge)
+	if !ok {
+		panic(fmt.Sprintf("metric '%s' is not a gauge", name))
+	}
+	return g
+}
+
+// Histogram returns the histogram with given name, creating it with the
+// given upper bounds for buckets if it doesn't exist.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+	h, ok := r.lookup(name, func() Collector {
+		b := append([]float64{}, buckets...)
+		sort.Float64s(b)
+		return &Histogram{series: newSeries(name, help, "histogram", labels), buckets: b}
+	}).(*Histogram)
+	if !ok {
+		panic(fmt.Sprintf("metric '%s' is not a histogram", name))
+	}
+	return h
+}
+
+// Register a custom Collector, collectors are written after the metrics
+// created with Counter(), Gauge() and Histogram().
+func (r *Registry) Register(c Collector) {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// Collect writes all metrics and registered collectors to w
+func (r *Registry) Collect(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.m.Lock()
+	collectors := make([]Collector, 0, len(r.names)+len(r.collectors))
+	for _, name := range r.names {
+		collectors = append(collectors, r.metrics[name])
+	}
+	collectors = append(collectors, r.collectors...)
+	r.m.Unlock()
+
+	for _, c := range collectors {
+		if err := c.Collect(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", ContentType)
+	r.Collect(res)
+}
+
+// ExponentialBuckets returns count bucket bounds, starting at start and each
+// factor times larger than the previous.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// series holds the values of a metric for each combination of label values
+type series struct {
+	m      sync.Mutex
+	name   string
+	help   string
+	kind   string
+	labels []string
+	keys   []string               // sorted keys of values
+	values map[string]interface{} // key -> value specific to kind of metric
+	label  map[string][]string    // key -> label values
+}
+
+func newSeries(name, help, kind string, labels []string) series {
+	return series{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string]interface{}),
+		label:  make(map[string][]string),
+	}
+}
+
+// get returns the value for labelValues, calling create if it doesn't exist,
+// the caller must hold s.m
+func (s *series) get(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf(
+			"metric '%s' has %d labels, got %d label values",
+			s.name, len(s.labels), len(labelValues),
+		))
+	}
+	key := strings.Join(labelValues, "\xff")
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+	v := create()
+	s.values[key] = v
+	s.label[key] = append([]string{}, labelValues...)
+	s.keys = append(s.keys, key)
+	sort.Strings(s.keys)
+	return v
+}
+
+// collect writes the HELP and TYPE lines followed by the lines returned from
+// format for each combination of label values.
+func (s *series) collect(w io.Writer, format func(labels []string, v interface{}) string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	text := fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", s.name, escapeHelp(s.help), s.name, s.kind)
+	for _, key := range s.keys {
+		text += format(s.labelPairs(s.label[key]), s.values[key])
+	}
+	_, err := io.WriteString(w, text)
+	return err
+}
+
+// labelPairs returns label="value" for the given label values
+func (s *series) labelPairs(values []string) []string {
+	pairs := make([]string, len(values))
+	for i, v := range values {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, s.labels[i], escapeLabel(v))
+	}
+	return pairs
+}
+
+// sample returns a line for the sample with given name suffix and labels
+func (s *series) sample(suffix string, labels []string, value float64) string {
+	name := s.name + suffix
+	if len(labels) > 0 {
+		name += "{" + strings.Join(labels, ",") + "}"
+	}
+	return name + " " + formatFloat(value) + "\n"
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// A Counter is a metric that only increases
+type Counter struct {
+	series
+}
+
+// Add v to the counter for the given label values, v must not be negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+	if v < 0 {
+		panic(fmt.Sprintf("counter '%s' cannot be decreased", c.name))
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	value := c.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+	*value += v
+}
+
+// Inc increments the counter for the given label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Collect implements Collector
+func (c *Counter) Collect(w io.Writer) error {
+	return c.collect(w, func(labels []string, v interface{}) string {
+		return c.sample("", labels, *v.(*float64))
+	})
+}
+
+// A Gauge is a metric that can increase and decrease
+type Gauge struct {
+	series
+}
+
+// Set the gauge to v for the given label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	value := g.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+	*value = v
+}
+
+// Add v to the gauge for the given label values, v may be negative
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	value := g.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+	*value += v
+}
+
+// Collect implements Collector
+func (g *Gauge) Collect(w io.Writer) error {
+	return g.collect(w, func(labels []string, v interface{}) string {
+		return g.sample("", labels, *v.(*float64))
+	})
+}
+
+// A Histogram counts observations in buckets
+type Histogram struct {
+	series
+	buckets []float64
+}
+
+type histogramValue struct {
+	counts []uint64 // count for each bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe adds v to the histogram for the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	value := h.get(labelValues, func() interface{} {
+		return &histogramValue{counts: make([]uint64, len(h.buckets))}
+	}).(*histogramValue)
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		value.counts[i]++
+	}
+	value.count++
+	value.sum += v
+}
+
+// Collect implements Collector
+func (h *Histogram) Collect(w io.Writer) error {
+	return h.collect(w, func(labels []string, v interface{}) string {
+		value := v.(*histogramValue)
+		text := ""
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += value.counts[i]
+			le := fmt.Sprintf(`le="%s"`, formatFloat(bound))
+			text += h.sample("_bucket", append(labels[:len(labels):len(labels)], le), float64(cumulative))
+		}
+		text += h.sample("_bucket", append(labels[:len(labels):len(labels)], `le="+Inf"`), float64(value.count))
+		text += h.sample("_sum", labels, value.sum)
+		text += h.sample("_count", labels, float64(value.count))
+		return text
+	})
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("tasks_resolved_total", "Tasks resolved", "outcome").Inc("completed")
+	r.Counter("tasks_resolved_total", "Tasks resolved", "outcome").Add(2, "failed")
+	r.Gauge("sandboxes", "Running sandboxes").Add(2)
+	r.Gauge("sandboxes", "Running sandboxes").Add(-1)
+	h := r.Histogram("task_duration_seconds", "Task duration", []float64{10, 1})
+	h.Observe(0.5)
+	h.Observe(5)
+	h.Observe(50)
+
+	var b bytes.Buffer
+	require.NoError(t, r.Collect(&b))
+	require.Equal(t, `# HELP sandboxes Running sandboxes
+# TYPE sandboxes gauge
+sandboxes 1
+# HELP task_duration_seconds Task duration
+# TYPE task_duration_seconds histogram
+task_duration_seconds_bucket{le="1"} 1
+task_duration_seconds_bucket{le="10"} 2
+task_duration_seconds_bucket{le="+Inf"} 3
+task_duration_seconds_sum 55.5
+task_duration_seconds_count 3
+# HELP tasks_resolved_total Tasks resolved
+# TYPE tasks_resolved_total counter
+tasks_resolved_total{outcome="completed"} 1
+tasks_resolved_total{outcome="failed"} 2
+`, b.String())
+}
+
+func TestRegistryLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("downloads_total", "Downloads\nby source", "source").Inc(`a "b" \c`)
+
+	var b bytes.Buffer
+	require.NoError(t, r.Collect(&b))
+	require.Contains(t, b.String(), `# HELP downloads_total Downloads\nby source`)
+	require.Contains(t, b.String(), `downloads_total{source="a \"b\" \\c"} 1`)
+}
+
+type staticCollector string
+
+func (c staticCollector) Collect(w io.Writer) error {
+	_, err := io.WriteString(w, string(c))
+	return err
+}
+
+func TestRegistryCollector(t *testing.T) {
+	r := NewRegistry()
+	r.Register(staticCollector("# TYPE custom gauge\ncustom 42\n"))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	require.Equal(t, "# TYPE custom gauge\ncustom 42\n", rec.Body.String())
+}
+
+func TestRegistryMisuse(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("things_total", "Things", "kind")
+	require.Panics(t, func() { r.Gauge("things_total", "Things") })
+	require.Panics(t, func() { r.Counter("things_total", "Things", "kind").Inc() })
+	require.Panics(t, func() { r.Counter("things_total", "Things", "kind").Add(-1, "a") })
+	require.Panics(t, func() { r.Counter("invalid-name", "Invalid") })
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	r.Counter("things_total", "Things").Inc()
+	r.Gauge("things", "Things").Set(1)
+	r.Histogram("things_seconds", "Things", ExponentialBuckets(1, 2, 4)).Observe(1)
+	r.Register(staticCollector(""))
+	require.NoError(t, r.Collect(&bytes.Buffer{}))
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	require.Equal(t, []float64{1, 2, 4, 8}, ExponentialBuckets(1, 2, 4))
+}
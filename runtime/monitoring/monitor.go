@@ -133,8 +133,9 @@ func (m *monitor) CapturePanic(fn func()) (incidentID string) {
 			message := fmt.Sprint(crash)
 			id := uuid.NewRandom()
 			incidentID = id.String()
-			m.Entry.WithField("incidentId", incidentID).WithField("panic", crash).Error("Recovered from panic:\n " + message)
-			m.submitError(fmt.Errorf("PANIC: %s", message), fmt.Sprint("Recovered from panic", message), raven.ERROR, id, 1)
+			fingerprint := runtime.PanicFingerprint(crash, m.tags["engine"])
+			m.Entry.WithField("incidentId", incidentID).WithField("fingerprint", fingerprint).WithField("panic", crash).Error("Recovered from panic:\n " + message)
+			m.submitError(fmt.Errorf("PANIC: %s", message), fmt.Sprint("Recovered from panic", message), raven.ERROR, id, fingerprint, 1)
 		}
 	}()
 	fn()
@@ -143,19 +144,21 @@ func (m *monitor) CapturePanic(fn func()) (incidentID string) {
 
 func (m *monitor) ReportError(err error, message ...interface{}) string {
 	incidentID := uuid.NewRandom()
-	m.Entry.WithField("incidentId", incidentID.String()).WithError(err).Error(message...)
-	m.submitError(err, fmt.Sprint(message...), raven.ERROR, incidentID, 1)
+	fingerprint := runtime.ErrorFingerprint(err, m.tags["engine"], 1)
+	m.Entry.WithField("incidentId", incidentID.String()).WithField("fingerprint", fingerprint).WithError(err).Error(message...)
+	m.submitError(err, fmt.Sprint(message...), raven.ERROR, incidentID, fingerprint, 1)
 	return incidentID.String()
 }
 
 func (m *monitor) ReportWarning(err error, message ...interface{}) string {
 	incidentID := uuid.NewRandom()
-	m.Entry.WithField("incidentId", incidentID.String()).WithError(err).Warn(message...)
-	m.submitError(err, fmt.Sprint(message...), raven.WARNING, incidentID, 1)
+	fingerprint := runtime.ErrorFingerprint(err, m.tags["engine"], 1)
+	m.Entry.WithField("incidentId", incidentID.String()).WithField("fingerprint", fingerprint).WithError(err).Warn(message...)
+	m.submitError(err, fmt.Sprint(message...), raven.WARNING, incidentID, fingerprint, 1)
 	return incidentID.String()
 }
 
-func (m *monitor) submitError(err error, message string, level raven.Severity, incidentID uuid.UUID, skipFrames int) {
+func (m *monitor) submitError(err error, message string, level raven.Severity, incidentID uuid.UUID, fingerprint string, skipFrames int) {
 	// Capture stack trace
 	exception := raven.NewException(err, raven.NewStacktrace(1+skipFrames, 5, []string{
 		"github.com/taskcluster/",
@@ -166,6 +169,9 @@ func (m *monitor) submitError(err error, message string, level raven.Severity, i
 	packet := raven.NewPacket(text, nil, exception)
 	packet.Level = level
 	packet.EventID = hex.EncodeToString(incidentID)
+	// Group reports by fingerprint, rather than by message which often contains
+	// task specific details
+	packet.Fingerprint = []string{fingerprint}
 
 	// Add incidentID and prefix to tags
 	tags := make(map[string]string, len(m.tags)+2)
@@ -173,6 +179,7 @@ func (m *monitor) submitError(err error, message string, level raven.Severity, i
 		tags[tag] = value
 	}
 	tags["incidentId"] = incidentID.String()
+	tags["fingerprint"] = fingerprint
 	tags["prefix"] = m.prefix
 	tags["version"] = "unknown"
 	tags["revision"] = "unknown"
@@ -0,0 +1,161 @@
+package runtime
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// An OperationTracker tracks long running operations, such as image downloads,
+// artifact uploads and cache pre-loading, that write files while in-flight.
+//
+// Before running garbage collection or disposing resources during shutdown,
+// the worker waits for in-flight operations to finish, or cancels them, such
+// that files aren't deleted while being written.
+//
+// A nil *OperationTracker is valid, operations started with it are not tracked.
+type OperationTracker struct {
+	m         sync.Mutex
+	ops       map[*Operation]struct{}
+	idle      chan struct{} // closed when there is no operations in-flight
+	cancelled bool
+}
+
+// An Operation is a long running operation registered with an
+// OperationTracker. The context.Context embedded is cancelled if the
+// OperationTracker is cancelled, operations should abort when this happens.
+//
+// Operation.Done() must be called when the operation is finished.
+type Operation struct {
+	context.Context
+	Kind    string
+	Started time.Time
+	cancel  context.CancelFunc
+	tracker *OperationTracker
+	once    sync.Once
+}
+
+// NewOperationTracker returns a new OperationTracker
+func NewOperationTracker() *OperationTracker {
+	idle := make(chan struct{})
+	close(idle)
+	return &OperationTracker{
+		ops:  make(map[*Operation]struct{}),
+		idle: idle,
+	}
+}
+
+// Begin registers a new in-flight operation of the given kind, for example
+// "image-download". If t has been cancelled the context of the Operation
+// returned is already cancelled.
+func (t *OperationTracker) Begin(kind string) *Operation {
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &Operation{
+		Context: ctx,
+		Kind:    kind,
+		Started: time.Now(),
+		cancel:  cancel,
+		tracker: t,
+	}
+	if t == nil {
+		return op
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.cancelled {
+		cancel()
+	}
+	if len(t.ops) == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.ops[op] = struct{}{}
+	return op
+}
+
+// WithContext returns a context that is canceled when ctx or the operation is
+// canceled, cancel must be called when the context is no longer needed.
+func (op *Operation) WithContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	merged, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-op.Context.Done():
+			cancel()
+		case <-merged.Done():
+		}
+	}()
+	return merged, cancel
+}
+
+// Done marks the operation as finished, it is safe to call this more than once.
+func (op *Operation) Done() {
+	op.once.Do(func() {
+		op.cancel()
+		t := op.tracker
+		if t == nil {
+			return
+		}
+		t.m.Lock()
+		defer t.m.Unlock()
+		delete(t.ops, op)
+		if len(t.ops) == 0 {
+			close(t.idle)
+		}
+	})
+}
+
+// InFlight returns the kinds of operations currently in-flight, sorted by
+// kind.
+func (t *OperationTracker) InFlight() []string {
+	if t == nil {
+		return nil
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	kinds := make([]string, 0, len(t.ops))
+	for op := range t.ops {
+		kinds = append(kinds, op.Kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Wait blocks until there are no operations in-flight, or timeout has expired.
+// Returns true, if there are no operations in-flight.
+func (t *OperationTracker) Wait(timeout time.Duration) bool {
+	if t == nil {
+		return true
+	}
+	t.m.Lock()
+	idle := t.idle
+	t.m.Unlock()
+
+	select {
+	case <-idle:
+		return true
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Cancel cancels the context of all in-flight operations, and all operations
+// started after this call.
+func (t *OperationTracker) Cancel() {
+	if t == nil {
+		return
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.cancelled = true
+	for op := range t.ops {
+		op.cancel()
+	}
+}
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationTracker(t *testing.T) {
+	tracker := NewOperationTracker()
+	require.True(t, tracker.Wait(0), "expected no operations in-flight")
+
+	op1 := tracker.Begin("image-download")
+	op2 := tracker.Begin("artifact-upload")
+	require.Equal(t, []string{"artifact-upload", "image-download"}, tracker.InFlight())
+	require.False(t, tracker.Wait(10*time.Millisecond), "expected operations in-flight")
+
+	op1.Done()
+	op1.Done() // calling twice is harmless
+	require.Equal(t, []string{"artifact-upload"}, tracker.InFlight())
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		op2.Done()
+	}()
+	require.True(t, tracker.Wait(5*time.Second), "expected operations to finish")
+	require.Empty(t, tracker.InFlight())
+}
+
+func TestOperationTrackerCancel(t *testing.T) {
+	tracker := NewOperationTracker()
+	op := tracker.Begin("cache-preload")
+	require.NoError(t, op.Err())
+
+	tracker.Cancel()
+	<-op.Context.Done()
+	require.False(t, tracker.Wait(0), "cancelled operations are in-flight until Done()")
+	op.Done()
+	require.True(t, tracker.Wait(0))
+
+	// Operations started after Cancel() are cancelled
+	op = tracker.Begin("cache-preload")
+	require.Error(t, op.Err())
+	op.Done()
+}
+
+func TestOperationWithContext(t *testing.T) {
+	tracker := NewOperationTracker()
+	op := tracker.Begin("artifact-upload")
+	defer op.Done()
+
+	ctx, cancel := op.WithContext(context.Background())
+	defer cancel()
+	require.NoError(t, ctx.Err())
+
+	tracker.Cancel()
+	<-ctx.Done()
+	require.Equal(t, context.Canceled, ctx.Err())
+
+	// The context is also canceled with the parent
+	parent, cancelParent := context.WithCancel(context.Background())
+	op = NewOperationTracker().Begin("cache-preload")
+	defer op.Done()
+	ctx, cancel = op.WithContext(parent)
+	defer cancel()
+	cancelParent()
+	<-ctx.Done()
+}
+
+func TestOperationTrackerNil(t *testing.T) {
+	var tracker *OperationTracker
+	op := tracker.Begin("image-download")
+	require.NoError(t, op.Err())
+	require.Empty(t, tracker.InFlight())
+	require.True(t, tracker.Wait(0))
+	tracker.Cancel()
+	op.Done()
+	require.Error(t, op.Err())
+}
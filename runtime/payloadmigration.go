@@ -0,0 +1,132 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// PayloadVersionProperty is the name of the 'task.payload' property declaring
+// the version of the payload format, payloads without it are version 1.
+const PayloadVersionProperty = "payloadVersion"
+
+// A PayloadMigration converts a payload from version Version to Version+1,
+// allowing engines and plugins to change their payload format without breaking
+// existing task definitions.
+//
+// Before Migrate is called the properties declared in Schema are validated,
+// hence, Schema should declare the properties in the format of Version.
+type PayloadMigration struct {
+	Version int
+	Schema  schematypes.Object
+	// Migrate returns the payload converted to Version+1, payload may be
+	// modified. Properties not owned by the engine/plugin must be left
+	// unchanged.
+	Migrate func(payload map[string]interface{}) (map[string]interface{}, error)
+}
+
+// CurrentPayloadVersion returns the current payload version given migrations,
+// this is 1 if there is no migrations.
+func CurrentPayloadVersion(migrations []PayloadMigration) int {
+	version := 1
+	for _, m := range migrations {
+		if m.Version+1 > version {
+			version = m.Version + 1
+		}
+	}
+	return version
+}
+
+// PayloadVersionSchema returns a schema declaring the PayloadVersionProperty,
+// this should be merged with the payload schemas from engine and plugins.
+func PayloadVersionSchema(current int) schematypes.Object {
+	return schematypes.Object{
+		Properties: schematypes.Properties{
+			PayloadVersionProperty: schematypes.Integer{
+				Title: "Payload Version",
+				Description: util.Markdown(fmt.Sprintf(`
+					Version of the payload format, payloads without 'payloadVersion'
+					are version 1. Payloads in older versions are converted to the
+					current version %d, before the payload is validated.
+				`, current)),
+				Minimum: 1,
+				Maximum: int64(current),
+			},
+		},
+	}
+}
+
+// MigratePayload converts payload to the current version given migrations, by
+// applying migrations in order of version. Properties for each version are
+// validated before migrations from the version are applied.
+//
+// Returns a MalformedPayloadError, if the payload version is invalid or the
+// payload doesn't satisfy the schema for the version it's in.
+func MigratePayload(payload map[string]interface{}, migrations []PayloadMigration) (map[string]interface{}, error) {
+	current := CurrentPayloadVersion(migrations)
+
+	// Find the version of the payload
+	version := 1
+	if v, ok := payload[PayloadVersionProperty]; ok {
+		f, isNumber := v.(float64)
+		if i, isInt := v.(int); isInt {
+			f, isNumber = float64(i), true
+		}
+		if !isNumber || f != math.Trunc(f) || f < 1 || f > float64(current) {
+			return nil, NewMalformedPayloadError(fmt.Sprintf(
+				"task.payload.%s must be an integer between 1 and %d, got: %v",
+				PayloadVersionProperty, current, v,
+			))
+		}
+		version = int(f)
+	}
+	if version == current {
+		return payload, nil
+	}
+
+	// Copy payload, so we don't modify the original
+	result := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		result[k] = v
+	}
+
+	for ; version < current; version++ {
+		for _, m := range migrations {
+			if m.Version != version {
+				continue
+			}
+			if err := m.Schema.Validate(m.Schema.Filter(result)); err != nil {
+				return nil, payloadVersionError(version, err)
+			}
+			var err error
+			result, err = m.Migrate(result)
+			if err != nil {
+				if _, ok := IsMalformedPayloadError(err); ok {
+					return nil, err
+				}
+				return nil, fmt.Errorf("failed to migrate task.payload from version %d, error: %s", version, err)
+			}
+		}
+	}
+	// Numbers are float64 in payloads decoded from JSON
+	result[PayloadVersionProperty] = float64(current)
+	return result, nil
+}
+
+// payloadVersionError returns a MalformedPayloadError for validation error err
+// from validating a payload in given version.
+func payloadVersionError(version int, err error) MalformedPayloadError {
+	prefix := fmt.Sprintf("task.payload (payloadVersion: %d)", version)
+	e, ok := err.(*schematypes.ValidationError)
+	if !ok {
+		return NewMalformedPayloadError(prefix, " schema violation: ", err)
+	}
+	issues := e.Issues(prefix)
+	errs := make([]MalformedPayloadError, len(issues))
+	for i, issue := range issues {
+		errs[i] = NewMalformedPayloadError(issue.String())
+	}
+	return MergeMalformedPayload(errs...)
+}
@@ -0,0 +1,82 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	schematypes "github.com/taskcluster/go-schematypes"
+)
+
+// migrations renaming 'cmd' (string) to 'command' (list), and then adding
+// 'env' with a default value.
+var testMigrations = []PayloadMigration{
+	{
+		Version: 1,
+		Schema: schematypes.Object{
+			Properties: schematypes.Properties{
+				"cmd": schematypes.String{},
+			},
+			Required: []string{"cmd"},
+		},
+		Migrate: func(payload map[string]interface{}) (map[string]interface{}, error) {
+			payload["command"] = []interface{}{payload["cmd"]}
+			delete(payload, "cmd")
+			return payload, nil
+		},
+	}, {
+		Version: 2,
+		Migrate: func(payload map[string]interface{}) (map[string]interface{}, error) {
+			payload["env"] = map[string]interface{}{}
+			return payload, nil
+		},
+	},
+}
+
+func TestMigratePayload(t *testing.T) {
+	require.Equal(t, 1, CurrentPayloadVersion(nil))
+	require.Equal(t, 3, CurrentPayloadVersion(testMigrations))
+
+	t.Run("version 1", func(t *testing.T) {
+		original := map[string]interface{}{"cmd": "ls"}
+		payload, err := MigratePayload(original, testMigrations)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"command":        []interface{}{"ls"},
+			"env":            map[string]interface{}{},
+			"payloadVersion": float64(3),
+		}, payload)
+		require.Equal(t, map[string]interface{}{"cmd": "ls"}, original, "original was modified")
+	})
+
+	t.Run("version 2", func(t *testing.T) {
+		payload, err := MigratePayload(map[string]interface{}{
+			"command":        []interface{}{"ls"},
+			"payloadVersion": float64(2),
+		}, testMigrations)
+		require.NoError(t, err)
+		require.Contains(t, payload, "env")
+		require.Equal(t, float64(3), payload["payloadVersion"])
+	})
+
+	t.Run("current version", func(t *testing.T) {
+		original := map[string]interface{}{"payloadVersion": float64(3)}
+		payload, err := MigratePayload(original, testMigrations)
+		require.NoError(t, err)
+		require.Equal(t, original, payload)
+	})
+
+	t.Run("invalid version 1 payload", func(t *testing.T) {
+		_, err := MigratePayload(map[string]interface{}{"cmd": 42}, testMigrations)
+		e, ok := IsMalformedPayloadError(err)
+		require.True(t, ok, "expected MalformedPayloadError")
+		require.Contains(t, e.Messages()[0], "payloadVersion: 1")
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		for _, v := range []interface{}{float64(0), float64(4), 1.5, "2"} {
+			_, err := MigratePayload(map[string]interface{}{"payloadVersion": v}, testMigrations)
+			_, ok := IsMalformedPayloadError(err)
+			require.True(t, ok, "expected MalformedPayloadError for %v", v)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// StreamingArtifact wraps all of the needed fields to create an artifact that
+// is streamed while the task is running.
+//
+// The artifact is created as a redirect artifact pointing to URL, when the
+// task is done the content is uploaded to an S3 artifact with BackingName and
+// the redirect artifact is updated to point to BackingURL.
+type StreamingArtifact struct {
+	Name        string
+	Mimetype    string
+	URL         string // URL serving the content while streaming
+	BackingName string // Name of the S3 artifact the content is uploaded to
+	BackingURL  string // URL of the S3 artifact with BackingName
+	Expires     time.Time
+}
+
+// States of an ArtifactStream
+const (
+	ArtifactStreaming = "streaming"
+	ArtifactUploading = "uploading"
+	ArtifactFinished  = "finished"
+	ArtifactFailed    = "failed"
+)
+
+// ErrArtifactStreamNotStreaming is returned from ArtifactStream.Finish(), if
+// Finish() has already been called.
+var ErrArtifactStreamNotStreaming = errors.New("artifact stream isn't in the streaming state")
+
+// An ArtifactStream is a StreamingArtifact created with
+// TaskContext.CreateStreamingArtifact().
+//
+// An ArtifactStream starts in the 'streaming' state, calling Finish() moves
+// it to the 'uploading' state, and then to 'finished' when the content is
+// uploaded and the artifact updated, or to 'failed' if this fails.
+type ArtifactStream struct {
+	context  *TaskContext
+	artifact StreamingArtifact
+	m        sync.Mutex
+	state    string
+}
+
+// CreateStreamingArtifact creates a redirect artifact pointing to
+// artifact.URL and returns an ArtifactStream in the 'streaming' state.
+func (context *TaskContext) CreateStreamingArtifact(artifact StreamingArtifact) (*ArtifactStream, error) {
+	err := context.CreateRedirectArtifact(RedirectArtifact{
+		Name:     artifact.Name,
+		Mimetype: artifact.Mimetype,
+		URL:      artifact.URL,
+		Expires:  artifact.Expires,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create streaming artifact: %s", artifact.Name)
+	}
+	return &ArtifactStream{
+		context:  context,
+		artifact: artifact,
+		state:    ArtifactStreaming,
+	}, nil
+}
+
+// State returns the current state of the ArtifactStream
+func (s *ArtifactStream) State() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.state
+}
+
+// Finish uploads the content from stream to the backing S3 artifact, and
+// updates the artifact to redirect to the backing artifact.
+//
+// Returns ErrArtifactStreamNotStreaming, if Finish() has already been called.
+// If an error is returned the state is 'failed', and the artifact still
+// redirects to the URL used while streaming.
+func (s *ArtifactStream) Finish(stream ioext.ReadSeekCloser, additionalHeaders map[string]string) error {
+	s.m.Lock()
+	if s.state != ArtifactStreaming {
+		s.m.Unlock()
+		return ErrArtifactStreamNotStreaming
+	}
+	s.state = ArtifactUploading
+	s.m.Unlock()
+
+	err := s.finish(stream, additionalHeaders)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if err != nil {
+		s.state = ArtifactFailed
+	} else {
+		s.state = ArtifactFinished
+	}
+	return err
+}
+
+func (s *ArtifactStream) finish(stream ioext.ReadSeekCloser, additionalHeaders map[string]string) error {
+	err := s.context.UploadS3Artifact(S3Artifact{
+		Name:              s.artifact.BackingName,
+		Mimetype:          s.artifact.Mimetype,
+		Expires:           s.artifact.Expires,
+		Stream:            stream,
+		AdditionalHeaders: additionalHeaders,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload %s", s.artifact.BackingName)
+	}
+
+	err = s.context.CreateRedirectArtifact(RedirectArtifact{
+		Name:     s.artifact.Name,
+		Mimetype: s.artifact.Mimetype,
+		URL:      s.artifact.BackingURL,
+		Expires:  s.artifact.Expires,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update %s", s.artifact.Name)
+	}
+	return nil
+}
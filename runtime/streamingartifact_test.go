@@ -0,0 +1,100 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+func TestStreamingArtifact(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	redirResp, _ := json.Marshal(queue.RedirectArtifactResponse{
+		StorageType: "reference",
+	})
+	s3resp, _ := json.Marshal(queue.S3ArtifactResponse{
+		PutURL: ts.URL,
+	})
+
+	artifact := StreamingArtifact{
+		Name:        "public/logs/live.log",
+		Mimetype:    "text/plain; charset=utf-8",
+		URL:         "https://livelog.example.com/log",
+		BackingName: "public/logs/live_backing.log",
+		BackingURL:  "https://queue.example.com/backing.log",
+	}
+
+	context, mockedQueue := setupArtifactTest(artifact.Name, redirResp)
+	s3 := queue.PostArtifactResponse(s3resp)
+	mockedQueue.On(
+		"CreateArtifact",
+		context.TaskInfo.TaskID,
+		"0",
+		artifact.BackingName,
+		client.PostAnyArtifactRequest,
+	).Return(&s3, nil)
+
+	s, err := context.CreateStreamingArtifact(artifact)
+	require.NoError(t, err)
+	require.Equal(t, ArtifactStreaming, s.State())
+
+	err = s.Finish(ioext.NopCloser(bytes.NewReader([]byte("hello"))), nil)
+	require.NoError(t, err)
+	require.Equal(t, ArtifactFinished, s.State())
+	mockedQueue.AssertNumberOfCalls(t, "CreateArtifact", 3)
+
+	err = s.Finish(ioext.NopCloser(bytes.NewReader([]byte("hello"))), nil)
+	require.Equal(t, ErrArtifactStreamNotStreaming, err)
+	require.Equal(t, ArtifactFinished, s.State())
+}
+
+func TestStreamingArtifactUploadFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	redirResp, _ := json.Marshal(queue.RedirectArtifactResponse{
+		StorageType: "reference",
+	})
+	s3resp, _ := json.Marshal(queue.S3ArtifactResponse{
+		PutURL: ts.URL,
+	})
+
+	artifact := StreamingArtifact{
+		Name:        "public/logs/live.log",
+		Mimetype:    "text/plain; charset=utf-8",
+		URL:         "https://livelog.example.com/log",
+		BackingName: "public/logs/live_backing.log",
+		BackingURL:  "https://queue.example.com/backing.log",
+	}
+
+	context, mockedQueue := setupArtifactTest(artifact.Name, redirResp)
+	s3 := queue.PostArtifactResponse(s3resp)
+	mockedQueue.On(
+		"CreateArtifact",
+		context.TaskInfo.TaskID,
+		"0",
+		artifact.BackingName,
+		client.PostAnyArtifactRequest,
+	).Return(&s3, nil)
+
+	s, err := context.CreateStreamingArtifact(artifact)
+	require.NoError(t, err)
+
+	err = s.Finish(ioext.NopCloser(bytes.NewReader([]byte("hello"))), nil)
+	require.Error(t, err)
+	require.Equal(t, ArtifactFailed, s.State())
+	// The artifact isn't redirected to the backing artifact
+	mockedQueue.AssertNumberOfCalls(t, "CreateArtifact", 2)
+}
@@ -1,10 +1,10 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 	"time"
 
@@ -13,10 +13,24 @@ import (
 	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
-
-	"gopkg.in/djherbis/stream.v1"
 )
 
+// maxDiagnosticsSize is the maximum number of bytes of diagnostic output held
+// by a TaskContext, further diagnostics are discarded.
+const maxDiagnosticsSize = 1024 * 1024
+
+// logBufferSize is the maximum number of bytes written to the task log that
+// is buffered in memory, before being written to the log file.
+const logBufferSize = 64 * 1024
+
+// logFlushInterval is the maximum time data written to the task log is
+// buffered in memory, before being written to the log file.
+const logFlushInterval = 250 * time.Millisecond
+
+// minSecretLength is the minimum length of secrets redacted from the task log,
+// shorter values are ignored as redacting them would mangle the log.
+const minSecretLength = 6
+
 // ErrLogNotClosed represents an invalid attempt to extract a log
 // while it is still open.
 var ErrLogNotClosed = errors.New("Log is still open")
@@ -43,13 +57,37 @@ const (
 // should be exposed and nothing more.  One such anti-pattern could be for a
 // plugin to look at task.extra instead of adding data to task.payload.
 type TaskInfo struct {
-	TaskID   string
-	RunID    int
-	Created  time.Time
-	Deadline time.Time
-	Expires  time.Time
-	Scopes   []string
-	Task     interface{} // task definition in map[string]interface{} types..
+	TaskID        string
+	RunID         int
+	ProvisionerID string
+	WorkerType    string
+	Created       time.Time
+	Deadline      time.Time
+	Expires       time.Time
+	Scopes        []string
+	Routes        []string
+	Metadata      TaskMetadata
+	Task          interface{} // task definition in map[string]interface{} types..
+	// ClockSkew is the queue clock minus the local clock, as measured when the
+	// task was claimed. Created, Deadline and Expires are in queue time.
+	ClockSkew time.Duration
+}
+
+// LocalDeadline returns Deadline in local time, adjusted for ClockSkew. This
+// should be used when comparing the deadline to time.Now().
+func (t TaskInfo) LocalDeadline() time.Time {
+	if t.Deadline.IsZero() {
+		return t.Deadline
+	}
+	return t.Deadline.Add(-t.ClockSkew)
+}
+
+// TaskMetadata holds the human readable task.metadata properties.
+type TaskMetadata struct {
+	Name        string
+	Description string
+	Owner       string
+	Source      string
 }
 
 // The TaskContext exposes generic properties and functionality related to a
@@ -61,8 +99,10 @@ type TaskInfo struct {
 // properties, and abortion notifications.
 type TaskContext struct {
 	TaskInfo
-	logStream   *stream.Stream
-	logLocation string // Absolute path to log file
+	log         *taskLog
+	logWriter   *ioext.BufferedWriter
+	logRedactor *ioext.Redactor   // for messages written by the worker
+	redactors   []*ioext.Redactor // flushed when the log is closed
 	logClosed   bool
 	mu          sync.RWMutex
 	queue       client.Queue
@@ -72,6 +112,19 @@ type TaskContext struct {
 	clientID    string
 	accessToken string
 	certificate string
+	takenUntil  time.Time // in queue time, zero if unknown
+	diagnostics bytes.Buffer
+	artifacts   []string
+	secrets     []string // redacted from the task log, longest first
+	// Timer closing done when the task deadline is exceeded, nil if no deadline
+	deadlineTimer    *time.Timer
+	deadlineExceeded bool
+	// Logs to be uploaded when the task is resolved
+	additionalLogs []AdditionalLog
+	// Per-task temporary storage, nil if not set
+	storage TemporaryStorage
+	// ArtifactUploader used for creating artifacts, nil if not set
+	uploader *ArtifactUploader
 }
 
 // TaskContextController exposes logic for controlling the TaskContext.
@@ -82,18 +135,31 @@ type TaskContextController struct {
 	*TaskContext
 }
 
-// NewTaskContext creates a TaskContext and associated TaskContextController
+// NewTaskContext creates a TaskContext and associated TaskContextController,
+// holding up to DefaultMemoryLogSize bytes of log in memory.
 func NewTaskContext(tempLogFile string, task TaskInfo) (*TaskContext, *TaskContextController, error) {
-	logStream, err := stream.New(tempLogFile)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to create temporary file for storing log")
-	}
+	return NewTaskContextWithMemoryLog(tempLogFile, task, DefaultMemoryLogSize)
+}
+
+// NewTaskContextWithMemoryLog creates a TaskContext and associated
+// TaskContextController, the task log is held in memory until it exceeds
+// memoryLogSize bytes, at which point it is written to tempLogFile.
+func NewTaskContextWithMemoryLog(tempLogFile string, task TaskInfo, memoryLogSize int) (*TaskContext, *TaskContextController, error) {
+	return NewTaskContextWithLogStorage(tempLogFile, task, memoryLogSize, FileLogStorage)
+}
+
+// NewTaskContextWithLogStorage creates a TaskContext and associated
+// TaskContextController, the task log is held in memory until it exceeds
+// memoryLogSize bytes, at which point it is written to tempLogFile in storage.
+func NewTaskContextWithLogStorage(tempLogFile string, task TaskInfo, memoryLogSize int, storage LogStorage) (*TaskContext, *TaskContextController, error) {
+	log := newTaskLog(tempLogFile, storage, memoryLogSize)
 	ctx := &TaskContext{
-		logStream:   logStream,
-		logLocation: tempLogFile,
-		TaskInfo:    task,
-		done:        make(chan struct{}),
+		log:       log,
+		logWriter: ioext.NewBufferedWriter(log, logBufferSize, logFlushInterval),
+		TaskInfo:  task,
+		done:      make(chan struct{}),
 	}
+	ctx.logRedactor = ctx.newRedactor()
 	ctx.authorizer = client.NewAuthorizer(func() (string, string, string, error) {
 		ctx.mu.RLock()
 		defer ctx.mu.RUnlock()
@@ -103,11 +169,26 @@ func NewTaskContext(tempLogFile string, task TaskInfo) (*TaskContext, *TaskConte
 		}
 		return ctx.clientID, ctx.accessToken, ctx.certificate, nil
 	})
+	if deadline, ok := ctx.Deadline(); ok {
+		ctx.deadlineTimer = time.AfterFunc(time.Until(deadline), ctx.exceedDeadline)
+	}
 	return ctx, &TaskContextController{ctx}, nil
 }
 
 // CloseLog will close the log so no more messages can be written.
 func (c *TaskContextController) CloseLog() error {
+	// Write output held back by redactors, this must happen before c.mu is
+	// locked, as redactors read secrets while holding their own lock
+	c.mu.RLock()
+	redactors := c.redactors
+	c.mu.RUnlock()
+	var err error
+	for _, r := range redactors {
+		if ferr := r.Flush(); err == nil {
+			err = ferr
+		}
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.logClosed {
@@ -116,13 +197,57 @@ func (c *TaskContextController) CloseLog() error {
 
 	debug("closing log on TaskContext")
 	c.logClosed = true
-	return c.logStream.Close()
+	// Flush buffered log data before closing the stream
+	if cerr := c.logWriter.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := c.log.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// FlushLog writes log data buffered in memory to the log file, such that it
+// is visible to readers from NewLogReader(). Log data is flushed periodically
+// and when the log is closed, so calling this is rarely necessary.
+func (c *TaskContext) FlushLog() error {
+	return c.logWriter.Flush()
 }
 
 // Dispose will clean-up all resources held by the TaskContext
 func (c *TaskContextController) Dispose() error {
 	debug("disposing TaskContext")
-	return c.logStream.Remove()
+	if c.deadlineTimer != nil {
+		c.deadlineTimer.Stop()
+	}
+	c.logWriter.Close()
+	return c.log.Remove()
+}
+
+// SetTemporaryStorage sets the per-task temporary storage returned by
+// TaskContext.TemporaryStorage(). The storage is not removed by Dispose().
+func (c *TaskContextController) SetTemporaryStorage(storage TemporaryStorage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storage = storage
+}
+
+// TemporaryStorage returns temporary storage for files and folders that belong
+// to this task, returns nil if the TaskContext has no per-task storage.
+//
+// Usage of this storage counts towards the disk quota of the task, so engines
+// and plugins should prefer it over Environment.TemporaryStorage for files
+// created on behalf of the task.
+func (c *TaskContext) TemporaryStorage() TemporaryStorage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.storage
+}
+
+// LogSize returns the number of bytes written to the task log, excluding
+// data buffered in memory that hasn't been flushed yet.
+func (c *TaskContextController) LogSize() int64 {
+	return c.log.Size()
 }
 
 // SetQueueClient will set a client for the TaskCluster Queue.  This client
@@ -164,23 +289,62 @@ func (c *TaskContextController) SetCredentials(clientID, accessToken, certificat
 	c.clientID = clientID
 	c.accessToken = accessToken
 	c.certificate = certificate
+	c.addSecret(accessToken)
 }
 
-// Deadline returns empty time and false, this is implemented to satisfy
-// context.Context.
+// SetTakenUntil is used to provide the time until which the current run is
+// claimed, and update it whenever the task is reclaimed. This is in queue time.
+func (c *TaskContextController) SetTakenUntil(takenUntil time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.takenUntil = takenUntil
+}
+
+// TakenUntil returns the time until which the current run is claimed, in queue
+// time. This is updated whenever the task is reclaimed, and zero if unknown.
+func (c *TaskContext) TakenUntil() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.takenUntil
+}
+
+// RemainingClaimTime returns the time left before the claim on the current run
+// expires, adjusted for ClockSkew. Returns zero if the claim has expired or
+// TakenUntil() is unknown.
+//
+// The task is reclaimed before the claim expires, so this is not the time
+// remaining for the task. But plugins doing expensive operations, like large
+// uploads, can use this to decide if an operation should be started.
+func (c *TaskContext) RemainingClaimTime() time.Duration {
+	takenUntil := c.TakenUntil()
+	if takenUntil.IsZero() {
+		return 0
+	}
+	remaining := takenUntil.Sub(time.Now().Add(c.ClockSkew))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Deadline returns the task deadline in local time, this is implemented to
+// satisfy context.Context. Returns false, if the task has no deadline.
 func (c *TaskContext) Deadline() (deadline time.Time, ok bool) {
-	return time.Time{}, false
+	deadline = c.TaskInfo.LocalDeadline()
+	return deadline, !deadline.IsZero()
 }
 
-// Done returns a channel that is closed when to TaskContext is aborted or
-// canceled.
+// Done returns a channel that is closed when to TaskContext is aborted,
+// canceled or the task deadline is exceeded.
 //
 // Implemented in compliance with context.Context.
 func (c *TaskContext) Done() <-chan struct{} {
 	return c.done
 }
 
-// Err returns context.Canceled, if task as canceled or aborted.
+// Err returns context.Canceled, if task as canceled or aborted, and
+// context.DeadlineExceeded, if the task deadline was exceeded.
 //
 // Implemented in compliance with context.Context.
 func (c *TaskContext) Err() error {
@@ -192,9 +356,24 @@ func (c *TaskContext) Err() error {
 	if c.status == Aborted || c.status == Cancelled {
 		return context.Canceled
 	}
+	if c.deadlineExceeded {
+		return context.DeadlineExceeded
+	}
 	return nil
 }
 
+// exceedDeadline closes done, when the task deadline has been exceeded
+func (c *TaskContext) exceedDeadline() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		c.deadlineExceeded = true
+		close(c.done)
+	}
+}
+
 // Value returns nil, this is implemented to satisfy context.Context
 func (c *TaskContext) Value(key interface{}) interface{} {
 	return nil
@@ -246,7 +425,7 @@ func (c *TaskContext) IsCancelled() bool {
 // These log messages will be prefixed "[taskcluster]" so it's easy to see to
 // that they are worker logs.
 func (c *TaskContext) Log(a ...interface{}) {
-	c.log("[taskcluster] ", a...)
+	c.writeLog("[taskcluster] ", a...)
 }
 
 // LogError writes a log error message from the worker
@@ -255,34 +434,174 @@ func (c *TaskContext) Log(a ...interface{}) {
 // that they are worker logs.  These errors are also easy to grep from the logs in
 // case of failure.
 func (c *TaskContext) LogError(a ...interface{}) {
-	c.log("[taskcluster:error] ", a...)
+	c.writeLog("[taskcluster:error] ", a...)
+}
+
+// LogSectionStart writes a marker indicating the start of a section to the
+// task log. Log viewers may use these markers to fold sections of the log.
+//
+// The marker is on the form "[taskcluster:section-start:<name>]", name should
+// be lower-case alpha-numeric and dashes, e.g. "setup" or "artifact-upload".
+// Sections may be nested, but must be ended in reverse order.
+func (c *TaskContext) LogSectionStart(name string) {
+	c.writeLog("[taskcluster:section-start:" + name + "]")
+}
+
+// LogSectionEnd writes a marker indicating the end of a section started with
+// LogSectionStart.
+func (c *TaskContext) LogSectionEnd(name string) {
+	c.writeLog("[taskcluster:section-end:" + name + "]")
 }
 
-func (c *TaskContext) log(prefix string, a ...interface{}) {
+// LogTiming writes a line with the time spent in a phase of the task run, such
+// as "image-fetch" or "artifact-upload", so task authors can distinguish worker
+// overhead from time spent running their code.
+//
+// The line is on the form "[taskcluster:timing] <phase>: <seconds>s".
+func (c *TaskContext) LogTiming(phase string, elapsed time.Duration) {
+	c.writeLog("[taskcluster:timing]", phase+":", fmt.Sprintf("%.3fs", elapsed.Seconds()))
+}
+
+func (c *TaskContext) writeLog(prefix string, a ...interface{}) {
 	a = append([]interface{}{prefix}, a...)
-	_, err := fmt.Fprintln(c.logStream, a...)
+	_, err := fmt.Fprintln(c.logRedactor, a...)
 	if err != nil {
 		_ = err //TODO: Forward this to the system log, it's not a critical error
 	}
 }
 
+// LogDiagnostic writes diagnostic output from the worker, engine or plugins.
+//
+// Diagnostics are not written to the task log, but kept separately and
+// uploaded as 'public/logs/worker.txt' if the task is resolved with reason
+// 'internal-error'. This is useful for output that explains an internal
+// failure, like stderr from a process that failed to start, but which is too
+// noisy to include in the task log.
+func (c *TaskContext) LogDiagnostic(a ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.diagnostics.Len() < maxDiagnosticsSize {
+		fmt.Fprintln(&c.diagnostics, a...)
+	}
+}
+
+// Diagnostics returns diagnostic output written with LogDiagnostic, returns
+// nil if nothing was written.
+func (c *TaskContextController) Diagnostics() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.diagnostics.Len() == 0 {
+		return nil
+	}
+	return append([]byte{}, c.diagnostics.Bytes()...)
+}
+
 // LogDrain returns a drain to which log message can be written.
 //
 // Users should note that multiple writers are writing to this drain
 // concurrently, and it is recommend that writers write in chunks of one line.
+//
+// Data written to the drain is buffered in memory and flushed to the log file
+// periodically, see FlushLog().
+//
+// Output written to the drain is normalized, such that CRLF line endings,
+// UTF-16 output and terminal control sequences from Windows and other
+// platforms render correctly, see ioext.LogNormalizer. Each drain detects the
+// encoding from the first write, so a new drain should be used for each
+// stream of output, such as stdout from a process.
+//
+// Secrets registered with AddSecret() are redacted from output written to the
+// drain, see ioext.Redactor.
 func (c *TaskContext) LogDrain() io.Writer {
-	return c.logStream
+	return ioext.NewLogNormalizer(c.newRedactor())
+}
+
+// LogDrainWithPrefix returns a drain to which log messages can be written,
+// each line written is prefixed "[<name>] ".
+//
+// Engines and plugins should use this for output that isn't from the task,
+// such as progress when pulling images, so it's easy to tell apart from output
+// written by the task. Combined with LogSectionStart() and LogSectionEnd() log
+// viewers can fold such output away.
+func (c *TaskContext) LogDrainWithPrefix(name string) io.Writer {
+	return ioext.NewLogNormalizer(ioext.NewPrefixWriter(
+		c.newRedactor(), "["+name+"] ",
+	))
+}
+
+// newRedactor returns an ioext.Redactor writing to the task log, output held
+// back by the redactor is written when the log is closed.
+func (c *TaskContext) newRedactor() *ioext.Redactor {
+	r := ioext.NewRedactor(c.logWriter, c.secretValues)
+	c.mu.Lock()
+	c.redactors = append(c.redactors, r)
+	c.mu.Unlock()
+	return r
+}
+
+// AddSecret registers a secret value, such as a token fetched by a plugin, to
+// be redacted from the task log. Secrets should be registered before they are
+// given to the task, typically when the plugin is created.
+//
+// Values shorter than 6 bytes are ignored, as are values containing line
+// breaks, as these can't be reliably redacted.
+func (c *TaskContext) AddSecret(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addSecret(value)
+}
+
+// addSecret adds value to secrets, c.mu must be held
+func (c *TaskContext) addSecret(value string) {
+	if len(value) < minSecretLength || strings.ContainsAny(value, "\r\n") {
+		return
+	}
+	// Copy secrets, as secretValues() returns the slice without holding the lock
+	secrets := make([]string, 0, len(c.secrets)+1)
+	for _, s := range c.secrets {
+		if s == value {
+			return
+		}
+		if len(s) >= len(value) {
+			secrets = append(secrets, s)
+		}
+	}
+	secrets = append(secrets, value)
+	for _, s := range c.secrets {
+		if len(s) < len(value) {
+			secrets = append(secrets, s)
+		}
+	}
+	c.secrets = secrets
+}
+
+// RedactSecrets returns text with secrets registered with AddSecret() replaced
+// by ioext.RedactedText, for output that doesn't go through the task log.
+func (c *TaskContext) RedactSecrets(text string) string {
+	for _, s := range c.secretValues() {
+		text = strings.Replace(text, s, ioext.RedactedText, -1)
+	}
+	return text
+}
+
+// secretValues returns secrets to be redacted from the task log
+func (c *TaskContext) secretValues() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.secrets
 }
 
 // NewLogReader returns a ReadCloser that reads the log from the start as the
 // log is written.
 //
 // Calls to Read() on the resulting ReadCloser are blocking. They will return
-// when data is written or EOF is reached.
+// when data is flushed to the log file or EOF is reached.
 //
 // Consumers should ensure the ReadCloser is closed before discarding it.
 func (c *TaskContext) NewLogReader() (io.ReadCloser, error) {
-	return c.logStream.NextReader()
+	return c.log.NextReader()
 }
 
 // ExtractLog returns an IO object to read the log.
@@ -294,12 +613,7 @@ func (c *TaskContext) ExtractLog() (ioext.ReadSeekCloser, error) {
 		return nil, ErrLogNotClosed
 	}
 
-	file, err := os.Open(c.logLocation)
-	if err != nil {
-		return nil, err
-	}
-
-	return file, nil
+	return c.log.Extract()
 }
 
 // HasScopes returns true, if task.scopes covers one of the scopeSets given
@@ -1,12 +1,14 @@
 package runtime
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,8 +34,67 @@ func TestTaskContextLogging(t *testing.T) {
 		panic("Couldn't find 'Hello World' in the log")
 	}
 	require.NoError(t, reader.Close(), "Failed to close log file")
-	err = context.logStream.Remove()
-	require.NoError(t, err, "Failed to remove logStream")
+	err = context.log.Remove()
+	require.NoError(t, err, "Failed to remove log")
+}
+
+func TestTaskContextLogDrainNormalization(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	context, control, err := NewTaskContext(path, TaskInfo{})
+	require.NoError(t, err, "Failed to create context")
+
+	_, err = context.LogDrain().Write([]byte("hello\r\n\x1b[2Jworld\r\n"))
+	require.NoError(t, err, "Failed to write to LogDrain")
+	// UTF-16LE output, as written by some Windows processes
+	_, err = context.LogDrainWithPrefix("windows").Write([]byte{'h', 0, 'i', 0, '\r', 0, '\n', 0})
+	require.NoError(t, err, "Failed to write to LogDrainWithPrefix")
+	err = control.CloseLog()
+	require.NoError(t, err, "Failed to close log file")
+
+	reader, err := context.NewLogReader()
+	require.NoError(t, err, "Failed to open log file")
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err, "Failed to read log file")
+	require.Equal(t, "hello\nworld\n[windows] hi\n", string(data))
+	require.NoError(t, reader.Close(), "Failed to close log file")
+	err = context.log.Remove()
+	require.NoError(t, err, "Failed to remove log")
+}
+
+func TestTaskContextRedactSecrets(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	context, control, err := NewTaskContext(path, TaskInfo{})
+	require.NoError(t, err, "Failed to create context")
+
+	// Drains created before secrets are registered also redact them
+	drain := context.LogDrain()
+	control.SetCredentials("my-client", "my-access-token", "")
+	context.AddSecret("plugin-secret")
+	context.AddSecret("short") // ignored
+
+	_, err = drain.Write([]byte("token: my-acc"))
+	require.NoError(t, err, "Failed to write to LogDrain")
+	_, err = drain.Write([]byte("ess-token, short\n"))
+	require.NoError(t, err, "Failed to write to LogDrain")
+	_, err = context.LogDrainWithPrefix("plugin").Write([]byte("fetched plugin-secret\n"))
+	require.NoError(t, err, "Failed to write to LogDrainWithPrefix")
+	context.Log("using my-access-token")
+	// Output held back as a partial match is written when the log is closed
+	_, err = context.LogDrain().Write([]byte("end: my-access"))
+	require.NoError(t, err, "Failed to write to LogDrain")
+	err = control.CloseLog()
+	require.NoError(t, err, "Failed to close log file")
+
+	reader, err := context.NewLogReader()
+	require.NoError(t, err, "Failed to open log file")
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err, "Failed to read log file")
+	require.Equal(t, "token: [redacted], short\n[plugin] fetched [redacted]\n[taskcluster]  using [redacted]\nend: my-access", string(data))
+	require.NoError(t, reader.Close(), "Failed to close log file")
+	err = context.log.Remove()
+	require.NoError(t, err, "Failed to remove log")
 }
 
 func TestTaskContextConcurrentLogging(t *testing.T) {
@@ -62,8 +123,8 @@ func TestTaskContextConcurrentLogging(t *testing.T) {
 		panic("Couldn't find 'Cheese' in the log")
 	}
 	require.NoError(t, reader.Close(), "Failed to close log file")
-	err = context.logStream.Remove()
-	require.NoError(t, err, "Failed to remove logStream")
+	err = context.log.Remove()
+	require.NoError(t, err, "Failed to remove log")
 }
 
 func TestTaskContextHasScopes(t *testing.T) {
@@ -110,3 +171,72 @@ func TestTaskContextHasScopes(t *testing.T) {
 		"false:*",
 	}), "star false")
 }
+
+func TestTaskContextTakenUntil(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	ctx, control, err := NewTaskContext(path, TaskInfo{
+		ClockSkew: 10 * time.Minute,
+	})
+	require.NoError(t, err, "Failed to create context")
+	defer control.Dispose()
+	defer control.CloseLog()
+
+	require.True(t, ctx.TakenUntil().IsZero())
+	require.Equal(t, time.Duration(0), ctx.RemainingClaimTime())
+
+	// takenUntil is in queue time, which is 10 min ahead of local time
+	takenUntil := time.Now().Add(30 * time.Minute)
+	control.SetTakenUntil(takenUntil)
+	require.Equal(t, takenUntil, ctx.TakenUntil())
+	remaining := ctx.RemainingClaimTime()
+	require.True(t, remaining <= 20*time.Minute && remaining > 19*time.Minute, "remaining: %s", remaining)
+
+	control.SetTakenUntil(time.Now().Add(5 * time.Minute))
+	require.Equal(t, time.Duration(0), ctx.RemainingClaimTime())
+}
+
+func TestTaskContextDeadline(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	ctx, control, err := NewTaskContext(path, TaskInfo{})
+	require.NoError(t, err, "Failed to create context")
+	_, ok := ctx.Deadline()
+	require.False(t, ok, "expected no deadline")
+	control.CloseLog()
+	control.Dispose()
+
+	// deadline is in queue time, which is 10 min ahead of local time
+	deadline := time.Now().Add(30 * time.Minute)
+	path = filepath.Join(os.TempDir(), slugid.Nice())
+	ctx, control, err = NewTaskContext(path, TaskInfo{
+		Deadline:  deadline,
+		ClockSkew: 10 * time.Minute,
+	})
+	require.NoError(t, err, "Failed to create context")
+	defer control.Dispose()
+	defer control.CloseLog()
+	d, ok := ctx.Deadline()
+	require.True(t, ok, "expected a deadline")
+	require.Equal(t, deadline.Add(-10*time.Minute), d)
+	require.NoError(t, ctx.Err())
+}
+
+func TestTaskContextDeadlineExceeded(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	ctx, control, err := NewTaskContext(path, TaskInfo{
+		Deadline: time.Now().Add(50 * time.Millisecond),
+	})
+	require.NoError(t, err, "Failed to create context")
+	defer control.Dispose()
+	defer control.CloseLog()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Done() to be closed when the deadline is exceeded")
+	}
+	require.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+	// Cancel after deadline exceeded doesn't panic, and takes precedence
+	ctx.Cancel()
+	require.Equal(t, context.Canceled, ctx.Err())
+}
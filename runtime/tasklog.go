@@ -0,0 +1,373 @@
+package runtime
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"gopkg.in/djherbis/stream.v1"
+)
+
+// DefaultMemoryLogSize is the default number of bytes a task log may grow to
+// before it is spilled from memory to a temporary file.
+const DefaultMemoryLogSize = 256 * 1024
+
+// errLogClosed is returned when writing to a taskLog that has been closed
+var errLogClosed = errors.New("write to closed task log")
+
+// ErrLogRemoved is returned from readers created with NewLogReader(), if the
+// task log is removed before the reader has reached EOF. This happens when the
+// TaskContext is disposed, typically because the task was aborted.
+var ErrLogRemoved = errors.New("task log has been removed")
+
+// DefaultMemoryLogStorageSize is the default number of bytes of task logs a
+// LogStorage from NewMemoryLogStorage() may hold.
+const DefaultMemoryLogStorageSize = 64 * 1024 * 1024
+
+// ErrLogStorageFull is returned when writing to a task log in a LogStorage
+// from NewMemoryLogStorage(), if the storage is full.
+var ErrLogStorageFull = errors.New("log storage is full")
+
+// LogStorage stores task logs that are spilled from memory, files are created
+// with the temporary file path given to NewTaskContext(). A LogStorage must
+// support reading from files while they are being written.
+//
+// Only local storage is supported, task logs are uploaded when the task is
+// resolved, and are available through the livelog plugin while it's running.
+type LogStorage stream.FileSystem
+
+// FileLogStorage stores spilled task logs in temporary files, this is the
+// default LogStorage.
+var FileLogStorage LogStorage = stream.StdFileSystem
+
+// NewMemoryLogStorage returns a LogStorage that keeps spilled task logs in
+// memory, for hosts without writable disk space. Logs are removed from memory
+// when the TaskContext is disposed.
+//
+// At most maxSize bytes of task logs are held across all tasks, when this is
+// exceeded writes to task logs fail with ErrLogStorageFull.
+func NewMemoryLogStorage(maxSize int64) LogStorage {
+	return &memoryLogStorage{
+		FileSystem: stream.NewMemFS(),
+		maxSize:    maxSize,
+		sizes:      make(map[string]int64),
+	}
+}
+
+// memoryLogStorage limits the size of files in a stream.FileSystem in memory
+type memoryLogStorage struct {
+	stream.FileSystem
+	m       sync.Mutex
+	size    int64
+	maxSize int64
+	sizes   map[string]int64 // size of each file
+}
+
+func (s *memoryLogStorage) Create(name string) (stream.File, error) {
+	f, err := s.FileSystem.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryLogFile{File: f, storage: s}, nil
+}
+
+func (s *memoryLogStorage) Remove(name string) error {
+	s.m.Lock()
+	s.size -= s.sizes[name]
+	delete(s.sizes, name)
+	s.m.Unlock()
+	return s.FileSystem.Remove(name)
+}
+
+// memoryLogFile is a file in memoryLogStorage, counting bytes written
+type memoryLogFile struct {
+	stream.File
+	storage *memoryLogStorage
+}
+
+func (f *memoryLogFile) Write(p []byte) (int, error) {
+	s := f.storage
+	s.m.Lock()
+	if s.size+int64(len(p)) > s.maxSize {
+		s.m.Unlock()
+		return 0, ErrLogStorageFull
+	}
+	s.size += int64(len(p))
+	s.sizes[f.Name()] += int64(len(p))
+	s.m.Unlock()
+
+	n, err := f.File.Write(p)
+	if n < len(p) {
+		s.m.Lock()
+		s.size -= int64(len(p) - n)
+		s.sizes[f.Name()] -= int64(len(p) - n)
+		s.m.Unlock()
+	}
+	return n, err
+}
+
+// taskLog holds the task log in memory, until it exceeds maxMemorySize, at
+// which point the log is spilled to a stream in storage, typically backed by
+// a temporary file.
+//
+// Most tasks have small logs, so this avoids temporary file I/O entirely for
+// the majority of tasks.
+type taskLog struct {
+	m             sync.Mutex
+	c             sync.Cond // broadcast when data is written or log is closed
+	path          string
+	storage       LogStorage
+	maxMemorySize int
+	buffer        []byte         // log data, while held in memory
+	stream        *stream.Stream // log stream, once spilled to file
+	size          int64          // number of bytes written
+	closed        bool
+	removed       bool
+	readers       map[*taskLogReader]bool // readers not yet closed
+}
+
+func newTaskLog(path string, storage LogStorage, maxMemorySize int) *taskLog {
+	l := &taskLog{
+		path:          path,
+		storage:       storage,
+		maxMemorySize: maxMemorySize,
+		readers:       make(map[*taskLogReader]bool),
+	}
+	l.c.L = &l.m
+	return l
+}
+
+func (l *taskLog) Write(p []byte) (int, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.closed {
+		return 0, errLogClosed
+	}
+	if l.stream != nil {
+		n, err := l.stream.Write(p)
+		l.size += int64(n)
+		return n, err
+	}
+
+	// Spill to file, if p doesn't fit in memory
+	if len(l.buffer)+len(p) > l.maxMemorySize {
+		if err := l.spill(); err != nil {
+			return 0, err
+		}
+		defer l.c.Broadcast() // readers must switch to the stream
+		n, err := l.stream.Write(p)
+		l.size += int64(n)
+		return n, err
+	}
+
+	l.buffer = append(l.buffer, p...)
+	l.size += int64(len(p))
+	l.c.Broadcast()
+	return len(p), nil
+}
+
+// Size returns the number of bytes written to the log
+func (l *taskLog) Size() int64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.size
+}
+
+// spill moves the buffer to a stream backed by a file, must be called with lock
+func (l *taskLog) spill() error {
+	debug("spilling task log to file: %s", l.path)
+	s, err := stream.NewStream(l.path, l.storage)
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file for storing log")
+	}
+	if _, err = s.Write(l.buffer); err != nil {
+		s.Close()
+		s.Remove()
+		return errors.Wrap(err, "failed to write log to temporary file")
+	}
+	l.stream = s
+	l.buffer = nil
+	return nil
+}
+
+// Close the log, such that readers will reach EOF
+func (l *taskLog) Close() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.close()
+}
+
+// close the log, must be called with lock
+func (l *taskLog) close() error {
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	l.c.Broadcast()
+	if l.stream != nil {
+		return l.stream.Close()
+	}
+	return nil
+}
+
+// Remove the log, and the temporary file if the log was spilled to file.
+//
+// If the log hasn't been closed it is closed, and outstanding readers are
+// forcibly closed, such that blocked calls to Read() return ErrLogRemoved.
+func (l *taskLog) Remove() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.removed {
+		return nil
+	}
+	err := l.close()
+	l.removed = true
+	l.buffer = nil
+	for r := range l.readers {
+		if rerr := r.closeStream(); err == nil {
+			err = rerr
+		}
+	}
+	l.readers = nil
+	l.c.Broadcast()
+	if l.stream != nil {
+		if rerr := l.stream.Remove(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Extract returns the log, this should only be called after Close()
+func (l *taskLog) Extract() (ioext.ReadSeekCloser, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.stream != nil {
+		f, err := l.storage.Open(l.path)
+		if err != nil {
+			return nil, err
+		}
+		return &storedLog{
+			SectionReader: io.NewSectionReader(f, 0, l.size),
+			Closer:        f,
+		}, nil
+	}
+	return ioext.NopCloser(bytes.NewReader(l.buffer)), nil
+}
+
+// storedLog reads a log spilled to LogStorage
+type storedLog struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// NextReader returns a reader that reads the log from the start, blocking
+// until data is written or the log is closed.
+func (l *taskLog) NextReader() (io.ReadCloser, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.removed {
+		return nil, ErrLogRemoved
+	}
+	r := &taskLogReader{log: l}
+	l.readers[r] = true
+	return r, nil
+}
+
+type taskLogReader struct {
+	log          *taskLog
+	offset       int64
+	reader       io.ReadCloser // reader from stream, once log is spilled to file
+	readerClosed bool          // true, if reader has been closed
+	closed       bool
+}
+
+// closeStream closes the reader from the stream, if any, must be called with
+// lock held on the log.
+func (r *taskLogReader) closeStream() error {
+	if r.reader == nil || r.readerClosed {
+		return nil
+	}
+	r.readerClosed = true
+	return r.reader.Close()
+}
+
+func (r *taskLogReader) Read(p []byte) (int, error) {
+	l := r.log
+	l.m.Lock()
+	if r.reader != nil {
+		reader := r.reader
+		l.m.Unlock()
+		return r.translate(reader.Read(p))
+	}
+	for l.stream == nil && int64(len(l.buffer)) <= r.offset && !l.closed && !r.closed {
+		l.c.Wait()
+	}
+	if r.closed {
+		l.m.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	if l.removed {
+		l.m.Unlock()
+		return 0, ErrLogRemoved
+	}
+
+	// Read from stream, skipping what we've already read from memory
+	if l.stream != nil {
+		reader, err := l.stream.NextReader()
+		if err != nil {
+			l.m.Unlock()
+			return 0, err
+		}
+		r.reader = reader
+		l.m.Unlock()
+		if _, err = io.CopyN(ioutil.Discard, reader, r.offset); err != nil {
+			return r.translate(0, err)
+		}
+		return r.translate(reader.Read(p))
+	}
+	defer l.m.Unlock()
+
+	if int64(len(l.buffer)) <= r.offset {
+		return 0, io.EOF
+	}
+	n := copy(p, l.buffer[r.offset:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// translate returns ErrLogRemoved instead of errors caused by the log being
+// removed while reading from the stream.
+func (r *taskLogReader) translate(n int, err error) (int, error) {
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	l := r.log
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.removed && !r.closed {
+		return n, ErrLogRemoved
+	}
+	return n, err
+}
+
+func (r *taskLogReader) Close() error {
+	l := r.log
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	r.closed = true
+	if l.readers != nil {
+		delete(l.readers, r)
+	}
+	l.c.Broadcast()
+	return r.closeStream()
+}
@@ -0,0 +1,241 @@
+package runtime
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+)
+
+func TestTaskLogInMemory(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	l := newTaskLog(path, FileLogStorage, 1024)
+	defer l.Remove()
+
+	reader, err := l.NextReader()
+	require.NoError(t, err)
+	defer reader.Close()
+
+	_, err = l.Write([]byte("hello world\n"))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "hello world\n", string(data))
+
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "expected log to be held in memory")
+
+	extracted, err := l.Extract()
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(extracted)
+	require.NoError(t, err)
+	require.Equal(t, "hello world\n", string(data))
+}
+
+func TestTaskLogSpill(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	l := newTaskLog(path, FileLogStorage, 16)
+	defer l.Remove()
+
+	reader, err := l.NextReader()
+	require.NoError(t, err)
+	defer reader.Close()
+
+	// Read part of the log before it is spilled to file
+	_, err = l.Write([]byte("hello "))
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	n, err := reader.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "hel", string(buf[:n]))
+
+	_, err = l.Write([]byte("world, this is too large\n"))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	require.Equal(t, int64(len("hello world, this is too large\n")), l.Size())
+
+	_, err = os.Stat(path)
+	require.NoError(t, err, "expected log to be spilled to file")
+
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "lo world, this is too large\n", string(data))
+
+	extracted, err := l.Extract()
+	require.NoError(t, err)
+	defer extracted.Close()
+	data, err = ioutil.ReadAll(extracted)
+	require.NoError(t, err)
+	require.Equal(t, "hello world, this is too large\n", string(data))
+}
+
+func TestTaskLogMemoryStorage(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	l := newTaskLog(path, NewMemoryLogStorage(DefaultMemoryLogStorageSize), 16)
+	defer l.Remove()
+
+	reader, err := l.NextReader()
+	require.NoError(t, err)
+	defer reader.Close()
+
+	_, err = l.Write([]byte("hello world, this is too large\n"))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "expected log to be spilled to memory")
+
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "hello world, this is too large\n", string(data))
+
+	extracted, err := l.Extract()
+	require.NoError(t, err)
+	defer extracted.Close()
+	_, err = extracted.Seek(6, io.SeekStart)
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(extracted)
+	require.NoError(t, err)
+	require.Equal(t, "world, this is too large\n", string(data))
+}
+
+func TestTaskLogMemoryStorageFull(t *testing.T) {
+	storage := NewMemoryLogStorage(48)
+	l1 := newTaskLog(filepath.Join(os.TempDir(), slugid.Nice()), storage, 0)
+	l2 := newTaskLog(filepath.Join(os.TempDir(), slugid.Nice()), storage, 0)
+	defer l2.Remove()
+
+	// Limit applies to logs from all tasks
+	_, err := l1.Write([]byte("hello world, this is 32 bytes..\n"))
+	require.NoError(t, err)
+	_, err = l2.Write([]byte("hello world, this is 32 bytes..\n"))
+	require.Equal(t, ErrLogStorageFull, err)
+	_, err = l2.Write([]byte("this fits\n"))
+	require.NoError(t, err)
+
+	// Removing a log frees space
+	require.NoError(t, l1.Remove())
+	_, err = l2.Write([]byte("hello world, this is 32 bytes..\n"))
+	require.NoError(t, err)
+	require.NoError(t, l2.Close())
+	require.Equal(t, int64(42), l2.Size())
+}
+
+// readAll reads from r in a go-routine, and returns a channel that receives
+// the error once reading has stopped.
+func readAll(r io.Reader) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(r)
+		done <- err
+	}()
+	return done
+}
+
+func waitForReader(t *testing.T, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader is still blocked")
+	}
+	return nil
+}
+
+func TestTaskLogRemoveUnblocksMemoryReader(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	l := newTaskLog(path, FileLogStorage, 1024)
+
+	reader, err := l.NextReader()
+	require.NoError(t, err)
+	defer reader.Close()
+
+	_, err = l.Write([]byte("hello "))
+	require.NoError(t, err)
+	done := readAll(reader)
+
+	require.NoError(t, l.Remove())
+	require.Equal(t, ErrLogRemoved, waitForReader(t, done))
+
+	_, err = l.NextReader()
+	require.Equal(t, ErrLogRemoved, err)
+}
+
+func TestTaskLogRemoveUnblocksSpilledReader(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	l := newTaskLog(path, FileLogStorage, 16)
+
+	reader, err := l.NextReader()
+	require.NoError(t, err)
+	defer reader.Close()
+
+	_, err = l.Write([]byte("hello world, this is too large\n"))
+	require.NoError(t, err)
+	done := readAll(reader)
+
+	// Remove must not block on the reader that was never closed
+	removed := make(chan error, 1)
+	go func() { removed <- l.Remove() }()
+	select {
+	case err = <-removed:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Remove() is blocked by outstanding reader")
+	}
+
+	err = waitForReader(t, done)
+	require.True(t, err == nil || err == ErrLogRemoved, "unexpected error: %v", err)
+
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "expected log file to be removed")
+}
+
+func TestTaskLogReaderLifecycle(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	l := newTaskLog(path, FileLogStorage, 1024)
+	defer l.Remove()
+
+	reader, err := l.NextReader()
+	require.NoError(t, err)
+
+	// Closing a blocked reader unblocks it
+	done := readAll(reader)
+	require.NoError(t, reader.Close())
+	require.Equal(t, io.ErrClosedPipe, waitForReader(t, done))
+
+	// Readers of a closed log reach EOF, also after the log is removed
+	reader, err = l.NextReader()
+	require.NoError(t, err)
+	_, err = l.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	require.NoError(t, l.Remove())
+	require.NoError(t, reader.Close())
+}
+
+func TestTaskContextDisposeUnblocksLogReader(t *testing.T) {
+	path := filepath.Join(os.TempDir(), slugid.Nice())
+	ctx, control, err := NewTaskContext(path, TaskInfo{})
+	require.NoError(t, err)
+
+	reader, err := ctx.NewLogReader()
+	require.NoError(t, err)
+	defer reader.Close()
+	done := readAll(reader)
+
+	ctx.Log("hello world")
+	control.Cancel()
+	require.NoError(t, control.Dispose())
+	err = waitForReader(t, done)
+	require.True(t, err == nil || err == ErrLogRemoved, "unexpected error: %v", err)
+}
@@ -3,10 +3,14 @@ package runtime
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	"github.com/pkg/errors"
 	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
 // TemporaryStorage can create temporary folders and files.
@@ -71,6 +75,59 @@ func NewTemporaryStorage(path string) (TemporaryFolder, error) {
 	return &temporaryFolder{path: path}, nil
 }
 
+// temporaryLeftovers is a gc.Disposable for files and folders left in the
+// temporary storage by a previous process.
+type temporaryLeftovers struct {
+	gc.DisposableResource
+	paths []string
+}
+
+// TemporaryLeftovers returns a gc.Disposable for the files and folders in the
+// temporary storage at path, such that the GarbageCollector can remove files
+// left behind by a previous process that crashed, when disk space is needed.
+//
+// This must be called before the temporary storage is used, returns nil if
+// there are no leftovers.
+func TemporaryLeftovers(path string) (gc.Disposable, error) {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list temporary storage")
+	}
+	if len(infos) == 0 {
+		return nil, nil
+	}
+	l := &temporaryLeftovers{}
+	for _, info := range infos {
+		l.paths = append(l.paths, filepath.Join(path, info.Name()))
+	}
+	return l, nil
+}
+
+func (l *temporaryLeftovers) MemorySize() (uint64, error) {
+	return 0, nil
+}
+
+func (l *temporaryLeftovers) DiskSize() (uint64, error) {
+	var size uint64
+	for _, p := range l.paths {
+		n, err := ioext.DiskUsage(p)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+func (l *temporaryLeftovers) Dispose() error {
+	for _, p := range l.paths {
+		if err := os.RemoveAll(p); err != nil {
+			return errors.Wrap(err, "failed to remove leftovers from temporary storage")
+		}
+	}
+	return nil
+}
+
 func (s *temporaryFolder) Path() string {
 	return s.path
 }
@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemporaryLeftovers(t *testing.T) {
+	folder, err := ioutil.TempDir("", "tempfolder-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	leftovers, err := TemporaryLeftovers(folder)
+	require.NoError(t, err)
+	require.Nil(t, leftovers, "expected no leftovers in empty folder")
+
+	require.NoError(t, os.Mkdir(filepath.Join(folder, "old-folder"), 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "old-folder", "data"), []byte("hello"), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "old-file"), []byte("world"), 0666))
+
+	leftovers, err = TemporaryLeftovers(folder)
+	require.NoError(t, err)
+	require.NotNil(t, leftovers)
+
+	// Files created after leftovers were found aren't touched
+	storage, err := NewTemporaryStorage(folder)
+	require.NoError(t, err)
+	current, err := storage.NewFolder()
+	require.NoError(t, err)
+
+	size, err := leftovers.DiskSize()
+	require.NoError(t, err)
+	require.True(t, size > 0, "expected leftovers to use disk space")
+
+	require.NoError(t, leftovers.Dispose())
+	infos, err := ioutil.ReadDir(folder)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, current.Path(), filepath.Join(folder, infos[0].Name()))
+}
@@ -0,0 +1,67 @@
+package termination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// awsMetaDataURL is the base URL for the EC2 instance meta-data service
+const awsMetaDataURL = "http://169.254.169.254/latest/meta-data"
+
+// awsProvider checks for EC2 spot instance interruption notices
+type awsProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func init() {
+	Register("aws", &awsProvider{
+		baseURL: awsMetaDataURL,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	})
+}
+
+func (p *awsProvider) Check(ctx context.Context) (Notice, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+"/spot/instance-action", nil)
+	if err != nil {
+		return Notice{}, false, errors.Wrap(err, "failed to create request for spot instance-action")
+	}
+	res, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Notice{}, false, errors.Wrap(err, "failed to fetch spot instance-action")
+	}
+	defer res.Body.Close()
+
+	// The meta-data service responds 404, if there is no interruption notice
+	if res.StatusCode == http.StatusNotFound {
+		return Notice{}, false, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return Notice{}, false, fmt.Errorf("spot instance-action returned status: %d", res.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return Notice{}, false, errors.Wrap(err, "failed to read spot instance-action")
+	}
+	var action struct {
+		Action string    `json:"action"`
+		Time   time.Time `json:"time"`
+	}
+	if err = json.Unmarshal(data, &action); err != nil {
+		// We have a notice, even if we can't parse it
+		return Notice{Description: "spot instance interruption"}, true, errors.Wrap(
+			err, "failed to parse spot instance-action",
+		)
+	}
+	return Notice{
+		Time:        action.Time,
+		Description: "spot instance interruption, action: " + action.Action,
+	}, true, nil
+}
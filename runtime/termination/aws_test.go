@@ -0,0 +1,55 @@
+package termination
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestAWSProvider(t *testing.T) {
+	var polls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/spot/instance-action", r.URL.Path)
+		if atomic.AddInt32(&polls, 1) < 3 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"action": "terminate", "time": "2017-09-18T08:22:00Z"}`))
+	}))
+	defer s.Close()
+
+	p := &awsProvider{baseURL: s.URL, client: http.DefaultClient}
+	notice, ok := Watch(context.Background(), p, 10*time.Millisecond, mocks.NewMockMonitor(true))
+	require.True(t, ok, "expected a termination notice")
+	require.Equal(t, int32(3), atomic.LoadInt32(&polls))
+	require.Equal(t, time.Date(2017, 9, 18, 8, 22, 0, 0, time.UTC), notice.Time)
+	require.Contains(t, notice.Description, "terminate")
+}
+
+func TestWatchCanceled(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	p := &awsProvider{baseURL: s.URL, client: http.DefaultClient}
+	_, ok := Watch(ctx, p, 10*time.Millisecond, mocks.NewMockMonitor(true))
+	require.False(t, ok, "expected no termination notice")
+}
+
+func TestProviderNames(t *testing.T) {
+	require.Contains(t, ProviderNames(), "aws")
+}
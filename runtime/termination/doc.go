@@ -0,0 +1,13 @@
+// Package termination provides detection of notices that the host is about to
+// be terminated, such as EC2 spot termination notices.
+//
+// Providers are registered with Register() and polled using Watch(), such that
+// the worker can stop gracefully, resolving running tasks exception with reason
+// 'worker-shutdown', before the host disappears. Notices from other clouds,
+// such as GCP preemption or Azure eviction, can be supported by registering
+// additional providers.
+package termination
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("termination")
@@ -0,0 +1,84 @@
+package termination
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// A Notice is a notice that the host is about to be terminated
+type Notice struct {
+	// Time at which the host will be terminated, zero if unknown
+	Time time.Time
+	// Human readable description of the notice, such as the action announced
+	Description string
+}
+
+// A Provider checks for termination notices
+type Provider interface {
+	// Check returns a Notice and true, if a termination notice has been issued.
+	Check(ctx context.Context) (Notice, bool, error)
+}
+
+var (
+	mProviders sync.Mutex
+	providers  = make(map[string]Provider)
+)
+
+// Register a Provider with given name, this will panic if a Provider with the
+// same name is already registered. This should be called from init().
+func Register(name string, provider Provider) {
+	mProviders.Lock()
+	defer mProviders.Unlock()
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("termination provider: '%s' is already registered", name))
+	}
+	providers[name] = provider
+}
+
+// Providers returns a map of registered providers
+func Providers() map[string]Provider {
+	mProviders.Lock()
+	defer mProviders.Unlock()
+	result := make(map[string]Provider, len(providers))
+	for name, provider := range providers {
+		result[name] = provider
+	}
+	return result
+}
+
+// ProviderNames returns a sorted list of the names of registered providers
+func ProviderNames() []string {
+	var names []string
+	for name := range Providers() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Watch checks provider for termination notices every interval until a notice
+// is found or ctx is done. Returns the Notice and true, if a termination notice
+// was found. Errors from the provider are reported to monitor as warnings.
+func Watch(ctx context.Context, provider Provider, interval time.Duration, monitor runtime.Monitor) (Notice, bool) {
+	for {
+		notice, ok, err := provider.Check(ctx)
+		if err != nil && ctx.Err() == nil {
+			monitor.ReportWarning(err, "failed to check for termination notice")
+		}
+		if ok {
+			return notice, true
+		}
+		debug("no termination notice, checking again in %s", interval)
+
+		select {
+		case <-ctx.Done():
+			return Notice{}, false
+		case <-time.After(interval):
+		}
+	}
+}
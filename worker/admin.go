@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// adminOptions configures the admin endpoint used for diagnosing the worker
+type adminOptions struct {
+	Address       string `json:"address"`
+	Token         string `json:"token"`
+	ProfileFolder string `json:"profileFolder"`
+}
+
+// profiles written by the dump-profiles admin action
+var dumpedProfiles = []string{"heap", "goroutine"}
+
+// adminHandler returns an http.Handler exposing net/http/pprof and admin
+// actions, all requests except '/health' and '/metrics' must carry the
+// configured token as bearer token.
+func (w *Worker) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/admin/v1/dump-profiles", w.handleDumpProfiles)
+	mux.HandleFunc("/admin/v1/drain", w.handleDrain)
+
+	token := []byte("Bearer " + w.options.Admin.Token)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// Health is public, so deployment tooling can poll it without the token
+		if req.URL.Path == "/health" {
+			w.handleHealth(res, req)
+			return
+		}
+		// Metrics are public, so Prometheus can scrape them without the token
+		if req.URL.Path == "/metrics" {
+			w.metrics.ServeHTTP(res, req)
+			return
+		}
+		auth := []byte(req.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(auth, token) != 1 {
+			http.Error(res, "invalid or missing admin token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(res, req)
+	})
+}
+
+// handleDumpProfiles writes heap and goroutine profiles to the profileFolder
+// and responds with the paths of the files written.
+func (w *Worker) handleDumpProfiles(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(res, "method not allowed, use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	files, err := w.dumpProfiles()
+	if err != nil {
+		w.monitor.ReportWarning(err, "failed to dump profiles")
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(map[string]interface{}{
+		"files": files,
+	})
+}
+
+// dumpProfiles writes heap and goroutine profiles to the profileFolder, and
+// returns the paths of the files written.
+func (w *Worker) dumpProfiles() ([]string, error) {
+	folder := w.options.Admin.ProfileFolder
+	if folder == "" {
+		folder = os.TempDir()
+	}
+	if err := os.MkdirAll(folder, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create profile folder")
+	}
+
+	// Run GC first, so the heap profile is up-to-date
+	goruntime.GC()
+
+	prefix := time.Now().UTC().Format("20060102T150405")
+	var files []string
+	for _, name := range dumpedProfiles {
+		file := filepath.Join(folder, fmt.Sprintf("%s-%s.pprof", prefix, name))
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return files, errors.Wrapf(err, "failed to create file for %s profile", name)
+		}
+		err = rpprof.Lookup(name).WriteTo(f, 0)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return files, errors.Wrapf(err, "failed to write %s profile", name)
+		}
+		files = append(files, file)
+	}
+	w.monitor.Info("wrote profiles: ", strings.Join(files, ", "))
+	return files, nil
+}
+
+// serveAdmin starts the admin endpoint, if configured, and stops it when
+// done is closed.
+func (w *Worker) serveAdmin(done <-chan struct{}) error {
+	if w.options.Admin == nil {
+		return nil
+	}
+	listener, err := net.Listen("tcp", w.options.Admin.Address)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for admin endpoint")
+	}
+	server := &http.Server{Handler: w.adminHandler()}
+	go func() {
+		err := server.Serve(listener)
+		select {
+		case <-done:
+		default:
+			w.monitor.ReportError(err, "admin endpoint stopped unexpectedly")
+		}
+	}()
+	go func() {
+		<-done
+		server.Close()
+	}()
+	w.monitor.Info("admin endpoint listening on ", listener.Addr())
+	return nil
+}
@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestAdminHandler(t *testing.T) {
+	folder, err := ioutil.TempDir("", "admin-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	w := &Worker{monitor: mocks.NewMockMonitor(false), metrics: metrics.NewRegistry()}
+	w.stats = newWorkerMetrics(w.metrics)
+	w.options.Admin = &adminOptions{
+		Token:         "secret-token-secret-token",
+		ProfileFolder: folder,
+	}
+	s := httptest.NewServer(w.adminHandler())
+	defer s.Close()
+
+	request := func(method, path, token string) *http.Response {
+		req, err := http.NewRequest(method, s.URL+path, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		res := request("GET", "/debug/pprof/", "")
+		res.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		res = request("GET", "/debug/pprof/", "wrong-token")
+		res.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("pprof", func(t *testing.T) {
+		res := request("GET", "/debug/pprof/", w.options.Admin.Token)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("dump-profiles", func(t *testing.T) {
+		res := request("POST", "/admin/v1/dump-profiles", w.options.Admin.Token)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var result struct {
+			Files []string `json:"files"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+		require.Len(t, result.Files, len(dumpedProfiles))
+		for _, file := range result.Files {
+			info, err := os.Stat(file)
+			require.NoError(t, err)
+			require.True(t, info.Size() > 0, "expected non-empty profile")
+		}
+	})
+	t.Run("metrics", func(t *testing.T) {
+		w.stats.tasksResolved.Inc("completed")
+		res := request("GET", "/metrics", "") // no token required
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, metrics.ContentType, res.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), `taskcluster_worker_tasks_resolved_total{outcome="completed"} 1`)
+	})
+}
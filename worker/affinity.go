@@ -0,0 +1,170 @@
+package worker
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+// affinityPageSize is the number of tasks requested per page when listing a
+// task group for pending tasks.
+const affinityPageSize = "100"
+
+// affinityMaxPages is the maximum number of pages listed per task group, each
+// time it's listed. This bounds the number of requests for
+// very large task groups.
+const affinityMaxPages = 3
+
+// affinityListingTTL is how long pending tasks found when listing a task group
+// are used, before the task group is listed again. This avoids listing every
+// recent task group in each iteration of the claim loop.
+const affinityListingTTL = 30 * time.Second
+
+// pendingTask is a pending run of a task, that may be claimed
+type pendingTask struct {
+	TaskID string
+	RunID  int
+}
+
+// taskGroupListing is the pending tasks found when a task group was listed
+type taskGroupListing struct {
+	listed  time.Time
+	pending []pendingTask
+}
+
+// recentTaskGroups tracks the most recently executed task groups, the zero
+// value has size zero and tracks nothing.
+type recentTaskGroups struct {
+	m        sync.Mutex
+	size     int
+	groups   []string // most recent first
+	listings map[string]taskGroupListing
+}
+
+// Add taskGroupID as the most recently executed task group
+func (r *recentTaskGroups) Add(taskGroupID string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.size == 0 || taskGroupID == "" {
+		return
+	}
+	groups := []string{taskGroupID}
+	for _, g := range r.groups {
+		if g != taskGroupID && len(groups) < r.size {
+			groups = append(groups, g)
+		} else if g != taskGroupID {
+			delete(r.listings, g)
+		}
+	}
+	r.groups = groups
+}
+
+// List returns task groups, most recently executed first
+func (r *recentTaskGroups) List() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]string{}, r.groups...)
+}
+
+// Listing returns the last listing of taskGroupID, false if the task group
+// hasn't been listed within affinityListingTTL.
+func (r *recentTaskGroups) Listing(taskGroupID string) (taskGroupListing, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	l, ok := r.listings[taskGroupID]
+	if !ok || time.Since(l.listed) > affinityListingTTL {
+		return taskGroupListing{}, false
+	}
+	return l, true
+}
+
+// SetListing records the pending tasks in taskGroupID that haven't been
+// claimed yet, ignored if taskGroupID is no longer a recent task group.
+func (r *recentTaskGroups) SetListing(taskGroupID string, l taskGroupListing) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for _, g := range r.groups {
+		if g == taskGroupID {
+			if r.listings == nil {
+				r.listings = make(map[string]taskGroupListing)
+			}
+			r.listings[taskGroupID] = l
+			return
+		}
+	}
+}
+
+// claimFromRecentTaskGroups claims up to N pending tasks on queues this worker
+// claims from, from recently executed task groups. Tasks from these groups are
+// likely to benefit from caches and images already present on this worker.
+//
+// Task groups are listed at most once per affinityListingTTL, in between the
+// pending tasks found by the last listing are claimed.
+func (w *Worker) claimFromRecentTaskGroups(N int) []taskClaim {
+	var claims []taskClaim
+	for _, taskGroupID := range w.recentTaskGroups.List() {
+		if len(claims) >= N {
+			break
+		}
+		l, ok := w.recentTaskGroups.Listing(taskGroupID)
+		if !ok {
+			l = taskGroupListing{listed: time.Now(), pending: w.listPendingTasks(taskGroupID)}
+		}
+		// Claimed tasks and tasks that fail to be claimed are not retried
+		for len(l.pending) > 0 && len(claims) < N {
+			t := l.pending[0]
+			l.pending = l.pending[1:]
+			c, err := w.queue.ClaimTask(t.TaskID, strconv.Itoa(t.RunID), &queue.TaskClaimRequest{
+				WorkerID:    w.options.WorkerID,
+				WorkerGroup: w.options.WorkerGroup,
+			})
+			if err != nil {
+				// Typically another worker claimed the task first
+				debug("unable to claimTask(%s, %d) from task group, error: %s", t.TaskID, t.RunID, err)
+				continue
+			}
+			w.monitor.Count("task-group-affinity.claimed", 1)
+			claims = append(claims, taskClaim(*c))
+		}
+		w.recentTaskGroups.SetListing(taskGroupID, l)
+	}
+	return claims
+}
+
+// listPendingTasks lists up to affinityMaxPages pages of taskGroupID, and
+// returns the pending tasks on queues this worker claims from.
+func (w *Worker) listPendingTasks(taskGroupID string) []pendingTask {
+	isOurQueue := make(map[string]bool)
+	for _, q := range w.options.queues() {
+		isOurQueue[q.ProvisionerID+"/"+q.WorkerType] = true
+	}
+
+	var pending []pendingTask
+	continuationToken := ""
+	for page := 0; page < affinityMaxPages; page++ {
+		debug("queue.listTaskGroup(%s) looking for pending tasks", taskGroupID)
+		result, err := w.queue.ListTaskGroup(taskGroupID, continuationToken, affinityPageSize)
+		if err != nil {
+			w.monitor.WithTag("taskGroupId", taskGroupID).Debug("failed to list task group, error: ", err)
+			break
+		}
+		for _, t := range result.Tasks {
+			s := t.Status
+			runID := len(s.Runs) - 1
+			if runID < 0 || s.Runs[runID].State != "pending" || !isOurQueue[s.ProvisionerID+"/"+s.WorkerType] {
+				continue
+			}
+			pending = append(pending, pendingTask{TaskID: s.TaskID, RunID: runID})
+		}
+		continuationToken = result.ContinuationToken
+		if continuationToken == "" {
+			break
+		}
+	}
+	return pending
+}
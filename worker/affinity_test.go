@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestRecentTaskGroups(t *testing.T) {
+	r := recentTaskGroups{size: 2}
+	r.Add("a")
+	r.Add("b")
+	r.Add("a")
+	require.Equal(t, []string{"a", "b"}, r.List())
+	r.Add("c")
+	require.Equal(t, []string{"c", "a"}, r.List())
+
+	var disabled recentTaskGroups
+	disabled.Add("a")
+	require.Empty(t, disabled.List())
+}
+
+func TestClaimFromRecentTaskGroups(t *testing.T) {
+	var tasks queue.ListTaskGroupResponse
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"taskGroupId": "group",
+		"tasks": [
+			{"status": {"taskId": "running", "provisionerId": "p", "workerType": "w",
+				"runs": [{"runId": 0, "state": "running"}]}},
+			{"status": {"taskId": "other-queue", "provisionerId": "p", "workerType": "x",
+				"runs": [{"runId": 0, "state": "pending"}]}},
+			{"status": {"taskId": "pending", "provisionerId": "p", "workerType": "w",
+				"runs": [{"runId": 0, "state": "exception"}, {"runId": 1, "state": "pending"}]}}
+		]
+	}`), &tasks))
+
+	q := &client.MockQueue{}
+	q.On("ListTaskGroup", "group", "", affinityPageSize).Return(&tasks, nil).Once()
+	q.On("ClaimTask", "pending", "1", mock.Anything).Return(&queue.TaskClaimResponse{RunID: 1}, nil).Once()
+
+	w := &Worker{
+		queue:            q,
+		monitor:          mocks.NewMockMonitor(false),
+		recentTaskGroups: recentTaskGroups{size: 1},
+	}
+	w.options.ProvisionerID = "p"
+	w.options.WorkerType = "w"
+	w.recentTaskGroups.Add("group")
+
+	claims := w.claimFromRecentTaskGroups(2)
+	require.Len(t, claims, 1)
+	require.Equal(t, 1, claims[0].RunID)
+	q.AssertExpectations(t)
+
+	// The task group isn't listed again until the listing expires
+	require.Empty(t, w.claimFromRecentTaskGroups(2))
+	q.AssertNumberOfCalls(t, "ListTaskGroup", 1)
+
+	l, ok := w.recentTaskGroups.Listing("group")
+	require.True(t, ok)
+	l.listed = l.listed.Add(-2 * affinityListingTTL)
+	w.recentTaskGroups.SetListing("group", l)
+	q.On("ListTaskGroup", "group", "", affinityPageSize).Return(&tasks, nil).Once()
+	q.On("ClaimTask", "pending", "1", mock.Anything).Return((*queue.TaskClaimResponse)(nil), errors.New("already claimed")).Once()
+	require.Empty(t, w.claimFromRecentTaskGroups(2))
+	q.AssertNumberOfCalls(t, "ListTaskGroup", 2)
+
+	// Listings are discarded when the task group is no longer recent
+	w.recentTaskGroups.Add("other-group")
+	_, ok = w.recentTaskGroups.Listing("group")
+	require.False(t, ok)
+}
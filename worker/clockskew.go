@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clockSkewInterval is the interval between measurements of clock skew
+// against the queue.
+const clockSkewInterval = 15 * time.Minute
+
+// clockSkewWarning is the skew beyond which a warning is reported, as the
+// host clock is likely misconfigured.
+const clockSkewWarning = 30 * time.Second
+
+// clockSkew holds the last measured offset between the queue clock and the
+// local clock, the zero value is ready to use and assumes no skew.
+type clockSkew struct {
+	m      sync.Mutex
+	offset time.Duration
+}
+
+// Offset returns the queue clock minus the local clock, such that
+// time.Now().Add(Offset()) approximates the time at the queue.
+func (c *clockSkew) Offset() time.Duration {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.offset
+}
+
+func (c *clockSkew) set(offset time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.offset = offset
+}
+
+// measureClockSkew sends a request to url and returns the difference between
+// the Date header of the response and the local time half-way through the
+// request. The Date header only has second precision, so the result is only
+// accurate to about a second.
+func measureClockSkew(client *http.Client, url string) (time.Duration, error) {
+	sent := time.Now()
+	res, err := client.Get(url)
+	if err != nil {
+		return 0, errors.Wrap(err, "request to measure clock skew failed")
+	}
+	res.Body.Close()
+	received := time.Now()
+
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return 0, errors.Wrap(err, "response didn't have a valid Date header")
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	return date.Sub(local), nil
+}
+
+// updateClockSkew measures clock skew against the queue and stores it, a
+// warning is reported if the skew is large.
+func (w *Worker) updateClockSkew(client *http.Client) {
+	monitor := w.monitor.WithPrefix("clock-skew")
+	offset, err := measureClockSkew(client, w.queueURL()+"/ping")
+	if err != nil {
+		monitor.Warn("failed to measure clock skew: ", err)
+		return
+	}
+	w.clockSkew.set(offset)
+	monitor.Measure("offset", offset.Seconds())
+	if offset > clockSkewWarning || offset < -clockSkewWarning {
+		monitor.ReportWarning(errors.Errorf(
+			"local clock differs from queue by %s", offset,
+		), "clock skew detected, is the host clock synchronized?")
+	} else {
+		debug("clock skew against queue: %s", offset)
+	}
+}
+
+// monitorClockSkew measures clock skew immediately and every
+// clockSkewInterval until done is closed.
+func (w *Worker) monitorClockSkew(done <-chan struct{}) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for {
+		w.updateClockSkew(client)
+		select {
+		case <-done:
+			return
+		case <-time.After(clockSkewInterval):
+		}
+	}
+}
+
+// queueNow returns the current time according to the queue clock, as
+// estimated from the last clock skew measurement.
+func (w *Worker) queueNow() time.Time {
+	return time.Now().Add(w.clockSkew.Offset())
+}
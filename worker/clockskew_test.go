@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasureClockSkew(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(5*time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	offset, err := measureClockSkew(http.DefaultClient, s.URL+"/ping")
+	require.NoError(t, err)
+	// Date header only has second precision
+	require.True(t, offset > 5*time.Minute-2*time.Second, "offset: %s", offset)
+	require.True(t, offset < 5*time.Minute+2*time.Second, "offset: %s", offset)
+
+	var c clockSkew
+	require.Equal(t, time.Duration(0), c.Offset())
+	c.set(offset)
+	require.Equal(t, offset, c.Offset())
+}
@@ -8,20 +8,61 @@ import (
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
+	"github.com/taskcluster/taskcluster-worker/runtime/termination"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 	"github.com/taskcluster/taskcluster-worker/runtime/webhookserver"
 )
 
 type options struct {
-	ProvisionerID       string `json:"provisionerId"`
-	WorkerType          string `json:"workerType"`
-	WorkerGroup         string `json:"workerGroup"`
-	WorkerID            string `json:"workerId"`
-	PollingInterval     int    `json:"pollingInterval"`
-	ReclaimOffset       int    `json:"reclaimOffset"`
-	MinimumReclaimDelay int    `json:"minimumReclaimDelay"`
-	Concurrency         int    `json:"concurrency"`
-	EnableSuperseding   bool   `json:"enableSuperseding"`
+	ProvisionerID       string               `json:"provisionerId"`
+	WorkerType          string               `json:"workerType"`
+	WorkerGroup         string               `json:"workerGroup"`
+	WorkerID            string               `json:"workerId"`
+	PollingInterval     int                  `json:"pollingInterval"`
+	MaxPollingInterval  int                  `json:"maxPollingInterval"`
+	ReclaimOffset       int                  `json:"reclaimOffset"`
+	MinimumReclaimDelay int                  `json:"minimumReclaimDelay"`
+	Concurrency         int                  `json:"concurrency"`
+	ClaimAhead          int                  `json:"claimAhead"`
+	EnableSuperseding   bool                 `json:"enableSuperseding"`
+	InstanceType        string               `json:"instanceType"`
+	ImageID             string               `json:"imageId"`
+	Weight              int                  `json:"weight"`
+	AdditionalQueues    []queueOptions       `json:"additionalQueues"`
+	SelfTest            *selfTestOptions     `json:"selfTest"`
+	QuarantineThreshold int                  `json:"quarantineThreshold"`
+	MemoryLogSize       int                  `json:"memoryLogSize"`
+	LogStorage          string               `json:"logStorage"`
+	LogStorageSize      int64                `json:"logStorageSize"`
+	Admin               *adminOptions        `json:"admin"`
+	TaskDiskQuota       int64                `json:"taskDiskQuota"`
+	TaskGroupAffinity   int                  `json:"taskGroupAffinity"`
+	ConcurrentUploads   int                  `json:"concurrentUploads"`
+	MaxUploadBandwidth  int64                `json:"maxUploadBandwidth"`
+	PayloadTemplating   bool                 `json:"payloadTemplating"`
+	IntegrityCheck      map[string]string    `json:"integrityCheck"`
+	ReplayBundles       *replayOptions       `json:"replayBundles"`
+	HostVerification    hostVerification     `json:"hostVerification"`
+	ShutdownGracePeriod int                  `json:"shutdownGracePeriod"`
+	EventWebhooks       *eventWebhookOptions `json:"eventWebhooks"`
+	TerminationNotices  *terminationOptions  `json:"terminationNotices"`
+	KillSwitch          *killSwitchOptions   `json:"killSwitch"`
+}
+
+type hostVerification struct {
+	Threshold int  `json:"threshold"`
+	Exit      bool `json:"exit"`
+}
+
+type replayOptions struct {
+	Folder string `json:"folder"`
+	Upload bool   `json:"upload"`
+}
+
+type queueOptions struct {
+	ProvisionerID string `json:"provisionerId"`
+	WorkerType    string `json:"workerType"`
+	Weight        int    `json:"weight"`
 }
 
 type configType struct {
@@ -30,10 +71,12 @@ type configType struct {
 	Plugins          interface{}            `json:"plugins"`
 	WebHookServer    interface{}            `json:"webHookServer"`
 	TemporaryFolder  string                 `json:"temporaryFolder"`
+	ContentStore     string                 `json:"contentStoreFolder"`
 	MinimumDiskSpace int64                  `json:"minimumDiskSpace"`
 	MinimumMemory    int64                  `json:"minimumMemory"`
 	Monitor          interface{}            `json:"monitor"`
 	Credentials      tcclient.Credentials   `json:"credentials"`
+	RootURL          string                 `json:"rootUrl"`
 	QueueBaseURL     string                 `json:"queueBaseUrl"`
 	AuthBaseURL      string                 `json:"authBaseUrl"`
 	WorkerOptions    options                `json:"worker"`
@@ -85,6 +128,23 @@ var optionsSchema schematypes.Schema = schematypes.Object{
 			Minimum: 0,
 			Maximum: 10 * 60,
 		},
+		"maxPollingInterval": schematypes.Integer{
+			Title: "Maximum Task Polling Interval",
+			Description: util.Markdown(`
+				Maximum number of seconds to wait between task polling iterations.
+				When 'claimWork' repeatedly returns no tasks, the polling interval
+				is doubled for each empty poll, starting from 'pollingInterval',
+				until it reaches this maximum. Random jitter is applied, so idle
+				workers don't poll in lock-step. As soon as a task is claimed the
+				interval is reset to 'pollingInterval'.
+
+				This reduces load on the queue from large idle fleets, while keeping
+				claim latency low when work appears. Defaults to 0, which disables
+				backoff.
+			`),
+			Minimum: 0,
+			Maximum: 60 * 60,
+		},
 		"reclaimOffset": schematypes.Integer{
 			Title: "Reclaim Offset",
 			Description: util.Markdown(`
@@ -105,10 +165,30 @@ var optionsSchema schematypes.Schema = schematypes.Object{
 			Maximum: 10 * 60,
 		},
 		"concurrency": schematypes.Integer{
-			Title:       "Concurrency",
-			Description: "The number of tasks that this worker supports running in parallel.",
-			Minimum:     1,
-			Maximum:     1000,
+			Title: "Concurrency",
+			Description: util.Markdown(`
+				The number of tasks that this worker supports running in parallel.
+				If the engine declares a maximum concurrency, such as the number of
+				virtual machines the 'qemu' engine can run, this is limited to the
+				maximum concurrency of the engine.
+			`),
+			Minimum: 1,
+			Maximum: 1000,
+		},
+		"claimAhead": schematypes.Integer{
+			Title: "Claim Ahead",
+			Description: util.Markdown(`
+				The number of tasks to claim in addition to 'concurrency', these
+				tasks are queued and reclaimed until there is capacity to run them.
+
+				Queued tasks are started most urgent first, ordered by
+				'task.priority' and then 'task.deadline', hence, a more urgent task
+				claimed later will be started before less urgent queued tasks.
+				Defaults to zero, in which case all claimed tasks are started
+				immediately.
+			`),
+			Minimum: 0,
+			Maximum: 1000,
 		},
 		"enableSuperseding": schematypes.Boolean{
 			Title: "Enable Superseding",
@@ -120,6 +200,460 @@ var optionsSchema schematypes.Schema = schematypes.Object{
 				`/reference/platform/taskcluster-queue/docs/superseding).
 			`),
 		},
+		"weight": schematypes.Integer{
+			Title: "Queue Weight",
+			Description: util.Markdown(`
+				Weight of the 'provisionerId'/'workerType' queue relative to queues
+				in 'additionalQueues', defaults to 1. This is only relevant if
+				'additionalQueues' is specified.
+			`),
+			Minimum: 1,
+			Maximum: 1000,
+		},
+		"additionalQueues": schematypes.Array{
+			Title: "Additional Queues",
+			Description: util.Markdown(`
+				Additional 'provisionerId'/'workerType' pairs to claim tasks from.
+				This is useful for small deployments that cannot dedicate a machine
+				to each workerType.
+
+				When claiming tasks the worker polls all queues in random order,
+				until it has no more capacity. The probability of a queue being
+				polled before another queue is proportional to its 'weight'.
+				Thus, a queue with higher weight gets first pick of the available
+				capacity more often.
+			`),
+			Items: schematypes.Object{
+				Properties: schematypes.Properties{
+					"provisionerId": schematypes.String{
+						Title:   "ProvisionerId",
+						Pattern: `^[a-zA-Z0-9_-]{1,22}$`,
+					},
+					"workerType": schematypes.String{
+						Title:   "WorkerType",
+						Pattern: `^[a-zA-Z0-9_-]{1,22}$`,
+					},
+					"weight": schematypes.Integer{
+						Title:       "Queue Weight",
+						Description: "Weight of this queue, defaults to 1.",
+						Minimum:     1,
+						Maximum:     1000,
+					},
+				},
+				Required: []string{"provisionerId", "workerType"},
+			},
+		},
+		"instanceType": schematypes.String{
+			Title: "Instance Type",
+			Description: util.Markdown(`
+				Type of machine the worker is running on, this is written to the
+				header of each task log, and is typically loaded from instance
+				meta-data using a configuration transform, e.g.
+				'{"$packet": "instance-type"}'.
+			`),
+		},
+		"imageId": schematypes.String{
+			Title: "Image Identifier",
+			Description: util.Markdown(`
+				Identifier for the machine image the worker is running from, this is
+				written to the header of each task log, such that failures can be
+				correlated with image deployments.
+			`),
+		},
+		"selfTest": schematypes.Object{
+			Title: "Self-Test",
+			Description: util.Markdown(`
+				Periodically run a canary payload locally, without claiming a task
+				from the queue, and report failures as errors. This detects hosts
+				that are unable to run tasks (full disk, broken KVM, etc.) before
+				they cause real tasks to fail.
+
+				The self-test occupies one unit of 'concurrency' while running, and
+				the payload is given to the engine directly, so plugins are not
+				involved.
+			`),
+			Properties: schematypes.Properties{
+				"payload": schematypes.Object{
+					Title: "Self-Test Payload",
+					Description: util.Markdown(`
+						Payload for the self-test, this must satisfy the payload schema of
+						the engine. Keys not handled by the engine are ignored.
+					`),
+					AdditionalProperties: true,
+				},
+				"interval": schematypes.Integer{
+					Title:       "Self-Test Interval",
+					Description: "Number of seconds between the start of each self-test.",
+					Minimum:     60,
+					Maximum:     7 * 24 * 60 * 60,
+				},
+				"maxRunTime": schematypes.Integer{
+					Title: "Self-Test Max Run-Time",
+					Description: util.Markdown(`
+						Number of seconds the self-test may run before it is aborted and
+						considered failed.
+					`),
+					Minimum: 1,
+					Maximum: 24 * 60 * 60,
+				},
+			},
+			Required: []string{"payload", "interval", "maxRunTime"},
+		},
+		"quarantineThreshold": schematypes.Integer{
+			Title: "Quarantine Threshold",
+			Description: util.Markdown(`
+				Number of consecutive tasks resolved 'internal-error' after which the
+				worker is quarantined. A quarantined worker stops claiming tasks and
+				reports an error, so that a broken host doesn't resolve an entire
+				queue as 'internal-error'. Failed self-tests also count towards this
+				threshold. Defaults to 0, which disables quarantining.
+			`),
+			Minimum: 0,
+			Maximum: 1000,
+		},
+		"memoryLogSize": schematypes.Integer{
+			Title: "Memory Log Size",
+			Description: util.Markdown(`
+				Number of bytes of task log to hold in memory, before the log is
+				written to a file in the 'temporaryFolder'. Most tasks have small
+				logs, so this avoids writing the log to disk for most tasks, at the
+				expense of memory for each concurrently running task.
+				Defaults to 256 KiB, if not given. Use a small value like 1 to
+				write all logs to file.
+			`),
+			Minimum: 1,
+			Maximum: 64 * 1024 * 1024,
+		},
+		"logStorage": schematypes.StringEnum{
+			Title: "Log Storage",
+			Description: util.Markdown(`
+				Where task logs exceeding 'memoryLogSize' are stored while the task
+				is running. 'file' writes the log to a file in the
+				'temporaryFolder', 'memory' keeps the entire log in memory, allowing
+				logs to be captured on hosts without writable disk space, up to
+				'logStorageSize'. Defaults to 'file'.
+			`),
+			Options: []string{"file", "memory"},
+		},
+		"logStorageSize": schematypes.Integer{
+			Title: "Log Storage Size",
+			Description: util.Markdown(`
+				Number of bytes of task logs that can be held in memory across all
+				running tasks, when 'logStorage' is 'memory'. Once this is exceeded
+				further output is dropped from task logs, so this should leave room
+				for the log of each concurrently running task. This doesn't include
+				the first 'memoryLogSize' bytes of each log. Defaults to 64 MiB.
+			`),
+			Minimum: 1024 * 1024,
+			Maximum: 64 * 1024 * 1024 * 1024,
+		},
+		"taskDiskQuota": schematypes.Integer{
+			Title: "Task Disk Quota",
+			Description: util.Markdown(`
+				Maximum number of bytes a task may use for its task log and per-task
+				temporary files, before it is aborted and resolved
+				'resource-unavailable'. This protects concurrent tasks on the same
+				host from a runaway log writer. Defaults to 0, which disables the
+				quota.
+
+				Disk usage is checked every 5 seconds, so tasks may exceed the quota
+				briefly. Caches and images shared between tasks are not counted.
+
+				Only the native and script engines store task files in per-task
+				temporary storage. With the qemu and docker engines only the task
+				log counts towards the quota, as virtual machine disks and container
+				filesystems are managed by the engine and are not counted.
+			`),
+			Minimum: 0,
+			Maximum: math.MaxInt64,
+		},
+		"taskGroupAffinity": schematypes.Integer{
+			Title: "Task-Group Affinity",
+			Description: util.Markdown(`
+				Number of recently executed task groups to prefer claiming tasks
+				from. Before polling with 'claimWork', the worker lists these task
+				groups for pending tasks on its queues and claims them directly.
+				Tasks from the same task group often use the same caches and images,
+				so this improves cache hit rates on large multi-task pushes, at the
+				expense of additional requests to the queue.
+				Defaults to 0, which disables task-group affinity.
+			`),
+			Minimum: 0,
+			Maximum: 100,
+		},
+		"concurrentUploads": schematypes.Integer{
+			Title: "Concurrent Uploads",
+			Description: util.Markdown(`
+				Maximum number of artifacts uploaded concurrently, across all tasks
+				running on the worker. Uploads beyond this limit wait for an ongoing
+				upload to finish. Defaults to 10.
+
+				Lowering this ensures a burst of large artifacts doesn't saturate
+				the uplink, delaying queue API calls such as reclaims.
+			`),
+			Minimum: 0,
+			Maximum: 1000,
+		},
+		"maxUploadBandwidth": schematypes.Integer{
+			Title: "Maximum Upload Bandwidth",
+			Description: util.Markdown(`
+				Maximum aggregate bandwidth in KiB per second used for uploading
+				artifacts, across all tasks running on the worker. This leaves
+				room for queue API calls and live log streaming on constrained
+				uplinks. Defaults to 0, which means unlimited.
+			`),
+			Minimum: 0,
+			Maximum: 100 * 1024 * 1024,
+		},
+		"payloadTemplating": schematypes.Boolean{
+			Title: "Payload Templating",
+			Description: util.Markdown(`
+				If enabled, occurrences of '${NAME}' and '${NAME:argument}' in
+				strings in 'task.payload' are substituted with worker-provided
+				values after the payload has been validated. This allows task
+				definitions to reference worker-specific values without hardcoding
+				them, e.g. '${TASK_ID}', '${RUN_ID}', '${WORKER_ID}',
+				'${CACHE_DIR:<name>}' if the 'cache' plugin is enabled, and
+				'${SECRET:<name>/<key>}' if the 'env' plugin is enabled.
+
+				Variables not provided by the worker or its plugins are left as-is,
+				and '$${NAME}' can be used to write a literal '${NAME}'.
+				Defaults to false.
+			`),
+		},
+		"integrityCheck": schematypes.Map{
+			Title: "Integrity Check",
+			Description: util.Markdown(`
+				Mapping from paths of critical host files, such as the worker
+				binary and configuration, to their expected hex encoded SHA-256
+				hashes. If given, the worker verifies these files at startup and
+				after each task. If any file is missing or doesn't match, an error
+				is reported and the worker stops claiming tasks, as is the case
+				when quarantined.
+
+				This is intended for high-trust workers, where tampering with the
+				host should never go unnoticed. The hashes must come from a trusted
+				source, such as the release process building the host image.
+				Defaults to no integrity check.
+			`),
+			Values: schematypes.String{
+				Pattern: `^[0-9a-fA-F]{64}$`,
+			},
+		},
+		"admin": schematypes.Object{
+			Title: "Admin Endpoint",
+			Description: util.Markdown(`
+				HTTP endpoint for diagnosing hangs and memory growth in long-lived
+				workers. This exposes 'net/http/pprof' under '/debug/pprof/' and
+				the action 'POST /admin/v1/dump-profiles', which writes heap and
+				goroutine profiles to 'profileFolder'.
+
+				The action 'POST /admin/v1/drain' puts the worker in lame-duck mode,
+				it stops claiming tasks and exits with exit code 3 when current tasks
+				are done. The state of the worker is reported by 'GET /health',
+				which responds 503 when the worker isn't claiming tasks.
+
+				Metrics for tasks claimed and resolved, task duration, queue polling,
+				image downloads, artifact uploads and running sandboxes are exposed
+				in the Prometheus text format by 'GET /metrics'.
+
+				All requests, except '/health' and '/metrics', must carry the header
+				'Authorization: Bearer <token>'.
+				The endpoint should not be exposed to the internet.
+			`),
+			Properties: schematypes.Properties{
+				"address": schematypes.String{
+					Title: "Listen Address",
+					Description: util.Markdown(`
+						Address to listen on, e.g. 'localhost:60099'.
+					`),
+				},
+				"token": schematypes.String{
+					Title:       "Admin Token",
+					Description: "Secret token required to access the admin endpoint.",
+					Pattern:     `^\S{22,}$`,
+				},
+				"profileFolder": schematypes.String{
+					Title: "Profile Folder",
+					Description: util.Markdown(`
+						Folder to write profiles to, defaults to the system temporary
+						folder. This should not be inside 'temporaryFolder', as it is
+						cleared when the worker starts.
+					`),
+				},
+			},
+			Required: []string{"address", "token"},
+		},
+		"replayBundles": schematypes.Object{
+			Title: "Replay Bundles",
+			Description: util.Markdown(`
+				Write a replay bundle when a task is resolved exception, except for
+				'canceled', 'worker-shutdown' and 'superseded'. A replay bundle is a
+				JSON file with the task definition, payload, engine configuration,
+				diagnostics and the task log. Replay bundles can be executed locally
+				using 'taskcluster-worker exec <bundle>'.
+
+				Engine configuration properties that may hold secrets, such as
+				passwords, keys and tokens, are removed and plugin configuration is
+				not included, secrets registered for the task are redacted.
+				Uploaded bundles are stored as the private artifact
+				'private/logs/replay-bundle.json'.
+			`),
+			Properties: schematypes.Properties{
+				"folder": schematypes.String{
+					Title: "Replay Bundle Folder",
+					Description: util.Markdown(`
+						Folder to write replay bundles to, as '<taskId>-<runId>.json'.
+						Bundles are not written to disk, if this is omitted. This should
+						not be inside 'temporaryFolder', as it is cleared when the worker
+						starts.
+					`),
+				},
+				"upload": schematypes.Boolean{
+					Title:       "Upload Replay Bundles",
+					Description: "Upload replay bundles as a private artifact.",
+				},
+			},
+		},
+		"hostVerification": schematypes.Object{
+			Title: "Host Verification",
+			Description: util.Markdown(`
+				After each task the engine verifies that the host hasn't been
+				contaminated, such as leftover processes, leaked mounts or modified
+				network configuration. Contamination is always reported, and the
+				engine repairs what it can, followed by garbage collection of
+				cached resources.
+
+				If verification fails for 'threshold' consecutive tasks the worker
+				stops claiming tasks, as is the case when quarantined. If 'exit' is
+				also given the worker stops when current tasks are done, and exits
+				with exit code 4, so that deployment tooling can reboot the host.
+			`),
+			Properties: schematypes.Properties{
+				"threshold": schematypes.Integer{
+					Title: "Verification Threshold",
+					Description: util.Markdown(`
+						Number of consecutive failed host verifications after which
+						the worker stops claiming tasks. Defaults to 0, which disables
+						this.
+					`),
+					Minimum: 0,
+					Maximum: 1000,
+				},
+				"exit": schematypes.Boolean{
+					Title:       "Exit on Contamination",
+					Description: "Exit with exit code 4 when 'threshold' is reached.",
+				},
+			},
+		},
+		"shutdownGracePeriod": schematypes.Integer{
+			Title: "Shutdown Grace Period",
+			Description: util.Markdown(`
+				Number of seconds to let running tasks finish when the worker
+				receives SIGTERM or SIGINT. The worker stops claiming tasks when
+				the signal is received, and when the grace period has elapsed, or
+				a second signal is received, running tasks are resolved
+				'exception' with reason 'worker-shutdown' and engine resources are
+				cleaned up. Defaults to 0, which resolves running tasks immediately.
+			`),
+			Minimum: 0,
+			Maximum: 24 * 60 * 60,
+		},
+		"eventWebhooks": schematypes.Object{
+			Title: "Event Webhooks",
+			Description: util.Markdown(`
+				URLs to which the worker posts JSON events when a task is started,
+				resolved and when an artifact is uploaded, such that external
+				dashboards and autoscalers can follow worker activity without
+				polling the queue.
+
+				Events have the form
+				'{"event": "task-started", "time": ..., "taskId": ..., "runId": ..., ...}',
+				where 'event' is 'task-started', 'task-resolved' or
+				'artifact-uploaded'. Events for resolved tasks have 'resolution'
+				and 'reason' properties, and events for uploaded artifacts have an
+				'artifact' property with the name of the artifact.
+
+				Requests carry an 'X-Taskcluster-Worker-Signature' header on the
+				form 'sha256=<hex>', where '<hex>' is the HMAC-SHA256 of the request
+				body using 'secret' as key. Events are delivered in the background,
+				failed deliveries are retried a few times before the event is
+				dropped.
+			`),
+			Properties: schematypes.Properties{
+				"urls": schematypes.Array{
+					Title: "Webhook URLs",
+					Items: schematypes.URI{},
+				},
+				"secret": schematypes.String{
+					Title:       "Signing Secret",
+					Description: "Secret used as key when signing event bodies with HMAC-SHA256.",
+				},
+			},
+			Required: []string{"urls", "secret"},
+		},
+		"terminationNotices": schematypes.Object{
+			Title: "Termination Notices",
+			Description: util.Markdown(`
+				Check for notices that the host is about to be terminated, such as
+				EC2 spot instance interruptions. When a notice is found the worker
+				stops claiming tasks, and running tasks are resolved 'exception'
+				with reason 'worker-shutdown' when 'shutdownGracePeriod' has
+				elapsed, or 30 seconds before the announced termination time,
+				whichever comes first.
+			`),
+			Properties: schematypes.Properties{
+				"provider": schematypes.StringEnum{
+					Title: "Provider",
+					Description: util.Markdown(`
+						Provider to check for termination notices, 'aws' polls the EC2
+						meta-data service for spot instance interruption notices.
+					`),
+					Options: termination.ProviderNames(),
+				},
+				"pollingInterval": schematypes.Integer{
+					Title: "Polling Interval",
+					Description: util.Markdown(`
+						Number of seconds between checks for termination notices,
+						defaults to 5.
+					`),
+					Minimum: 1,
+					Maximum: 5 * 60,
+				},
+			},
+			Required: []string{"provider"},
+		},
+		"killSwitch": schematypes.Object{
+			Title: "Kill-Switch",
+			Description: util.Markdown(`
+				Taskcluster secret used to pause all workers reading it, such that
+				operators can halt a misbehaving fleet without access to the hosts.
+				When the secret holds '{"paused": true, "reason": "..."}' the worker
+				stops claiming tasks and 'GET /health' on the admin endpoint reports
+				the state 'paused'. Running tasks are not affected, and the worker
+				resumes claiming tasks when 'paused' is false or the secret is
+				removed.
+
+				The worker credentials must have the scope 'secrets:get:<secret>'.
+				If the secret can't be read, the worker remains in its current state.
+			`),
+			Properties: schematypes.Properties{
+				"secret": schematypes.String{
+					Title:       "Secret",
+					Description: "Name of the secret holding the kill-switch.",
+				},
+				"pollingInterval": schematypes.Integer{
+					Title: "Polling Interval",
+					Description: util.Markdown(`
+						Number of seconds between reads of the kill-switch secret,
+						defaults to 60.
+					`),
+					Minimum: 1,
+					Maximum: 60 * 60,
+				},
+			},
+			Required: []string{"secret"},
+		},
 	},
 	Required: []string{
 		"provisionerId",
@@ -204,6 +738,21 @@ func ConfigSchema() schematypes.Object {
 					will be overwritten.
 				`),
 			},
+			"contentStoreFolder": schematypes.String{
+				Title: "Content Store Folder",
+				Description: util.Markdown(`
+					Path to folder for storing images, fetched artifacts and snapshots
+					of pre-loaded caches by their sha256 hash. Identical content is
+					only stored once and shared using hard-links, this folder may be
+					shared by multiple workers on the same host, and must be on the same
+					file system as 'temporaryFolder' to avoid copying.
+
+					Content no longer in use, and snapshots not used for a week, are
+					removed when the worker starts. This must not be inside
+					'temporaryFolder', as it is cleared when the worker starts.
+					Defaults to no content store.
+				`),
+			},
 			"minimumDiskSpace": schematypes.Integer{
 				Title: "Minimum Disk Space",
 				Description: util.Markdown(`
@@ -224,11 +773,26 @@ func ConfigSchema() schematypes.Object {
 				Minimum: 0,
 				Maximum: math.MaxInt64,
 			},
-			"monitor":      monitoring.ConfigSchema,
-			"credentials":  credentialsSchema,
-			"queueBaseUrl": schematypes.String{},
-			"authBaseUrl":  schematypes.String{},
-			"worker":       optionsSchema,
+			"monitor":     monitoring.ConfigSchema,
+			"credentials": credentialsSchema,
+			"rootUrl": schematypes.URI{
+				Title: "Taskcluster Root URL",
+				Description: util.Markdown(`
+					Root URL of the Taskcluster deployment, service URLs are derived
+					from this, e.g. the queue is at '<rootUrl>/api/queue/v1'. Defaults
+					to 'https://taskcluster.net', where each service has its own
+					hostname, e.g. 'https://queue.taskcluster.net/v1'.
+				`),
+			},
+			"queueBaseUrl": schematypes.String{
+				Title:       "Queue Base URL",
+				Description: "Base URL for the queue, overrides the URL derived from 'rootUrl'.",
+			},
+			"authBaseUrl": schematypes.String{
+				Title:       "Auth Base URL",
+				Description: "Base URL for auth, overrides the URL derived from 'rootUrl'.",
+			},
+			"worker": optionsSchema,
 		},
 		Required: []string{
 			"engine",
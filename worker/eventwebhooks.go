@@ -0,0 +1,146 @@
+package worker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	got "github.com/taskcluster/go-got"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// Events posted to event webhooks
+const (
+	eventTaskStarted      = "task-started"
+	eventTaskResolved     = "task-resolved"
+	eventArtifactUploaded = "artifact-uploaded"
+)
+
+// Header carrying the HMAC-SHA256 signature of the request body
+const eventSignatureHeader = "X-Taskcluster-Worker-Signature"
+
+// Maximum number of events buffered for delivery, further events are dropped
+const maxPendingEvents = 1000
+
+// Maximum time to wait for pending events to be delivered when disposing
+const eventFlushTimeout = 30 * time.Second
+
+type eventWebhookOptions struct {
+	URLs   []string `json:"urls"`
+	Secret string   `json:"secret"`
+}
+
+// taskEvent is the JSON body posted to event webhooks
+type taskEvent struct {
+	Event         string    `json:"event"`
+	Time          time.Time `json:"time"`
+	ProvisionerID string    `json:"provisionerId"`
+	WorkerType    string    `json:"workerType"`
+	WorkerGroup   string    `json:"workerGroup"`
+	WorkerID      string    `json:"workerId"`
+	TaskID        string    `json:"taskId"`
+	RunID         int       `json:"runId"`
+	Resolution    string    `json:"resolution,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	Artifact      string    `json:"artifact,omitempty"`
+}
+
+// newTaskEvent returns a taskEvent for the task run, identifying this worker
+func (w *Worker) newTaskEvent(event, taskID string, runID int) taskEvent {
+	return taskEvent{
+		Event:         event,
+		ProvisionerID: w.options.ProvisionerID,
+		WorkerType:    w.options.WorkerType,
+		WorkerGroup:   w.options.WorkerGroup,
+		WorkerID:      w.options.WorkerID,
+		TaskID:        taskID,
+		RunID:         runID,
+	}
+}
+
+// eventPublisher posts signed taskEvents to webhook URLs in the background,
+// such that slow webhooks doesn't delay task processing.
+type eventPublisher struct {
+	options eventWebhookOptions
+	got     *got.Got
+	monitor runtime.Monitor
+	events  chan taskEvent
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newEventPublisher(options eventWebhookOptions, monitor runtime.Monitor) *eventPublisher {
+	g := got.New()
+	g.Retries = 3
+	p := &eventPublisher{
+		options: options,
+		got:     g,
+		monitor: monitor,
+		events:  make(chan taskEvent, maxPendingEvents),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Publish queues event for delivery, it is safe to call this on a nil
+// eventPublisher, in which case the event is ignored.
+func (p *eventPublisher) Publish(event taskEvent) {
+	if p == nil {
+		return
+	}
+	event.Time = time.Now()
+	select {
+	case p.events <- event:
+	default:
+		p.monitor.Count("dropped", 1)
+		p.monitor.Warnf("dropping '%s' event for taskId: %s, too many events pending", event.Event, event.TaskID)
+	}
+}
+
+// Close stops accepting events and waits for pending events to be delivered,
+// up to eventFlushTimeout.
+func (p *eventPublisher) Close() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		close(p.events)
+	})
+	select {
+	case <-p.done:
+	case <-time.After(eventFlushTimeout):
+		p.monitor.Warn("timed out delivering pending events to event webhooks")
+	}
+}
+
+func (p *eventPublisher) run() {
+	defer close(p.done)
+	for event := range p.events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			panic(errors.Wrap(err, "failed to serialize taskEvent as JSON"))
+		}
+		signature := p.sign(body)
+		for _, u := range p.options.URLs {
+			req := p.got.Post(u, body)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(eventSignatureHeader, signature)
+			if _, err = req.Send(); err != nil {
+				p.monitor.Count("failed", 1)
+				p.monitor.Warnf("failed to post '%s' event to webhook: %s, error: %s", event.Event, u, err)
+			}
+		}
+	}
+}
+
+// sign returns 'sha256=<hex>' where hex is the HMAC-SHA256 of body
+func (p *eventPublisher) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.options.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
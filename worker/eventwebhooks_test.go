@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestEventPublisher(t *testing.T) {
+	var m sync.Mutex
+	var events []taskEvent
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		// Verify signature
+		mac := hmac.New(sha256.New, []byte("my-secret"))
+		mac.Write(body)
+		signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		require.Equal(t, signature, r.Header.Get(eventSignatureHeader))
+
+		var event taskEvent
+		require.NoError(t, json.Unmarshal(body, &event))
+		m.Lock()
+		events = append(events, event)
+		m.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	p := newEventPublisher(eventWebhookOptions{
+		URLs:   []string{s.URL},
+		Secret: "my-secret",
+	}, mocks.NewMockMonitor(true))
+	p.Publish(taskEvent{Event: eventTaskStarted, TaskID: "abc", RunID: 1})
+	p.Publish(taskEvent{Event: eventArtifactUploaded, TaskID: "abc", RunID: 1, Artifact: "public/x.txt"})
+	p.Publish(taskEvent{Event: eventTaskResolved, TaskID: "abc", RunID: 1, Resolution: "completed"})
+	p.Close()
+
+	m.Lock()
+	defer m.Unlock()
+	require.Len(t, events, 3)
+	require.Equal(t, eventTaskStarted, events[0].Event)
+	require.Equal(t, "public/x.txt", events[1].Artifact)
+	require.Equal(t, "completed", events[2].Resolution)
+	require.False(t, events[0].Time.IsZero(), "expected time to be set")
+}
+
+func TestEventPublisherNil(t *testing.T) {
+	var p *eventPublisher
+	p.Publish(taskEvent{Event: eventTaskStarted})
+	p.Close()
+}
@@ -0,0 +1,44 @@
+package worker
+
+import "github.com/pkg/errors"
+
+// ExitCodeContaminated is the exit code used by the 'work' command when the
+// worker stopped because host verification failed repeatedly, such that
+// deployment tooling can reboot the host.
+const ExitCodeContaminated = 4
+
+// verifyHost asks the engine to verify that the host hasn't been contaminated
+// by a task, and runs garbage collection if it has. If verification fails
+// repeatedly the worker stops claiming tasks, and stops if configured to exit.
+func (w *Worker) verifyHost() {
+	err := w.engine.VerifyHost()
+	if err != nil {
+		w.monitor.Count("host-contamination", 1)
+		w.monitor.ReportWarning(err, "host verification failed, running garbage collection")
+		// Other tasks may have operations in-flight, skip garbage collection
+		// rather than deleting files that are being written.
+		if !w.awaitOperations(operationsTimeout) {
+			w.monitor.Warn("skipping garbage collection, operations are still in-flight")
+		} else if cerr := w.garbageCollector.CollectAll(); cerr != nil {
+			w.monitor.ReportWarning(cerr, "garbage collection failed after host verification")
+		}
+	}
+
+	if !w.hostHealth.Record(err != nil) {
+		return
+	}
+	w.monitor.ReportError(errors.Errorf(
+		"host verification failed after %d consecutive tasks",
+		w.options.HostVerification.Threshold,
+	), "host is contaminated and worker will not claim any more tasks")
+	if w.options.HostVerification.Exit {
+		w.hostFailed.Set(true)
+		w.StopGracefully()
+	}
+}
+
+// IsContaminated returns true, if the worker stopped because host verification
+// failed repeatedly and 'hostVerification.exit' is configured.
+func (w *Worker) IsContaminated() bool {
+	return w.hostFailed.Get()
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+type contaminatedEngine struct {
+	engines.Engine
+	err error
+}
+
+func (e *contaminatedEngine) VerifyHost() error {
+	return e.err
+}
+
+func TestVerifyHost(t *testing.T) {
+	e := &contaminatedEngine{}
+	w := &Worker{
+		engine:           e,
+		garbageCollector: gc.New("", 0, 0),
+		monitor:          mocks.NewMockMonitor(false),
+		hostHealth:       circuitBreaker{threshold: 2},
+	}
+	w.options.HostVerification.Threshold = 2
+	w.options.HostVerification.Exit = true
+
+	w.verifyHost()
+	require.False(t, w.isQuarantined())
+
+	e.err = errors.New("leftover processes")
+	w.verifyHost()
+	require.False(t, w.isQuarantined(), "one failure shouldn't quarantine")
+
+	e.err = nil
+	w.verifyHost()
+	e.err = errors.New("leftover processes")
+	w.verifyHost()
+	require.False(t, w.isQuarantined(), "success should reset the count")
+
+	w.verifyHost()
+	require.True(t, w.isQuarantined(), "two consecutive failures should quarantine")
+	require.True(t, w.IsContaminated())
+	require.True(t, w.lifeCycleTracker.StoppingGracefully.IsDone())
+}
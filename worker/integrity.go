@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// integrityCheck verifies that critical host files match the SHA-256 hashes
+// given in the worker configuration. Once tampering is detected it stays
+// tampered, the zero value has no files and never detects tampering.
+//
+// Expected hashes are given in configuration rather than recorded when the
+// worker starts, as the host may have been tampered with before the worker
+// started.
+type integrityCheck struct {
+	m        sync.Mutex
+	hashes   map[string]string // file path to hex encoded SHA-256
+	tampered bool
+}
+
+// Expect sets the expected hex encoded SHA-256 hashes of files.
+func (c *integrityCheck) Expect(hashes map[string]string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.hashes = hashes
+}
+
+// Verify hashes the files given to Expect, and returns an error describing
+// any differences, in which case the integrityCheck becomes tampered. Once
+// tampered this returns nil, as there is nothing new to report.
+func (c *integrityCheck) Verify() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if len(c.hashes) == 0 || c.tampered {
+		return nil
+	}
+
+	var changes []string
+	for p, expected := range c.hashes {
+		h, err := hashFile(p)
+		switch {
+		case os.IsNotExist(err):
+			changes = append(changes, "removed: "+p)
+		case err != nil:
+			changes = append(changes, "unreadable: "+p)
+		case hex.EncodeToString(h) != strings.ToLower(expected):
+			changes = append(changes, "modified: "+p)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	c.tampered = true
+	sort.Strings(changes)
+	return errors.Errorf("host files don't match expected hashes:\n - %s", strings.Join(changes, "\n - "))
+}
+
+// Tampered returns true, if Verify() has detected changes
+func (c *integrityCheck) Tampered() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.tampered
+}
+
+func hashFile(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// verifyIntegrity checks that critical host files haven't changed, and stops
+// the worker from claiming tasks if they have.
+func (w *Worker) verifyIntegrity() {
+	err := w.integrity.Verify()
+	if err == nil {
+		return
+	}
+	w.monitor.Count("integrity-violation", 1)
+	w.monitor.ReportError(err, "host integrity check failed, worker will not claim any more tasks")
+}
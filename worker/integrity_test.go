@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(data string) string {
+	h := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(h[:])
+}
+
+func TestIntegrityCheck(t *testing.T) {
+	folder, err := ioutil.TempDir("", "integrity-check")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	config := filepath.Join(folder, "config.yml")
+	require.NoError(t, ioutil.WriteFile(config, []byte("engine: native"), 0644))
+	binary := filepath.Join(folder, "taskcluster-worker")
+	require.NoError(t, ioutil.WriteFile(binary, []byte("binary"), 0755))
+
+	var c integrityCheck
+	require.NoError(t, c.Verify(), "zero value should never detect tampering")
+	c.Expect(map[string]string{
+		config: sha256Hex("engine: native"),
+		binary: sha256Hex("binary"),
+	})
+	require.NoError(t, c.Verify())
+	require.False(t, c.Tampered())
+
+	// Modifying a file is detected
+	require.NoError(t, ioutil.WriteFile(config, []byte("engine: docker"), 0644))
+	err = c.Verify()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "modified: "+config)
+	require.True(t, c.Tampered())
+	require.NoError(t, c.Verify(), "tampering should only be reported once")
+	require.True(t, c.Tampered(), "should stay tampered")
+}
+
+func TestIntegrityCheckTamperedBeforeStart(t *testing.T) {
+	folder, err := ioutil.TempDir("", "integrity-check")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	// Files that don't match when the worker starts are detected
+	config := filepath.Join(folder, "config.yml")
+	require.NoError(t, ioutil.WriteFile(config, []byte("engine: docker"), 0644))
+	var c integrityCheck
+	c.Expect(map[string]string{config: sha256Hex("engine: native")})
+	require.Error(t, c.Verify())
+	require.True(t, c.Tampered())
+
+	var c2 integrityCheck
+	c2.Expect(map[string]string{filepath.Join(folder, "missing"): sha256Hex("")})
+	err = c2.Verify()
+	require.Error(t, err, "missing files should be detected")
+	require.Contains(t, err.Error(), "removed: ")
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/secrets"
+)
+
+// Default number of seconds between checks of the kill-switch secret
+const defaultKillSwitchPollingInterval = 60
+
+type killSwitchOptions struct {
+	Secret          string `json:"secret"`
+	PollingInterval int    `json:"pollingInterval"`
+}
+
+// killSwitchValue is the value of the kill-switch secret, a missing secret is
+// the same as {paused: false}.
+type killSwitchValue struct {
+	Paused bool   `json:"paused"`
+	Reason string `json:"reason"`
+}
+
+// killSwitch holds the last value read from the kill-switch secret, the zero
+// value is ready to use and isn't paused.
+type killSwitch struct {
+	m     sync.Mutex
+	value killSwitchValue
+}
+
+// Paused returns true, if the worker should not claim tasks
+func (k *killSwitch) Paused() bool {
+	k.m.Lock()
+	defer k.m.Unlock()
+	return k.value.Paused
+}
+
+// set value and return true, if this changed whether or not we're paused
+func (k *killSwitch) set(value killSwitchValue) bool {
+	k.m.Lock()
+	defer k.m.Unlock()
+	changed := k.value.Paused != value.Paused
+	k.value = value
+	return changed
+}
+
+// readKillSwitch reads the kill-switch secret with given name
+func readKillSwitch(s *secrets.Secrets, name string) (killSwitchValue, error) {
+	var value killSwitchValue
+	secret, err := s.Get(name)
+	if e, ok := err.(httpbackoff.BadHttpResponseCode); ok && e.HttpResponseCode == http.StatusNotFound {
+		return value, nil
+	}
+	if err != nil {
+		return value, errors.Wrapf(err, "failed to read kill-switch secret: %s", name)
+	}
+	if err = json.Unmarshal(secret.Secret, &value); err != nil {
+		return value, errors.Wrapf(err, "kill-switch secret: %s isn't on the form {paused: bool, reason: string}", name)
+	}
+	return value, nil
+}
+
+// watchKillSwitch reads the kill-switch secret immediately and every
+// 'pollingInterval' until done is closed. If the secret can't be read, the
+// worker remains in its current state.
+func (w *Worker) watchKillSwitch(done <-chan struct{}) {
+	o := w.options.KillSwitch
+	if o == nil {
+		return
+	}
+	interval := time.Duration(o.PollingInterval) * time.Second
+	if interval == 0 {
+		interval = defaultKillSwitchPollingInterval * time.Second
+	}
+
+	monitor := w.monitor.WithPrefix("kill-switch")
+	for {
+		value, err := readKillSwitch(w.secrets, o.Secret)
+		if err != nil {
+			monitor.Warn(err)
+		} else if w.killSwitch.set(value) {
+			if value.Paused {
+				monitor.Count("paused", 1)
+				monitor.Infof("worker paused by kill-switch, no new tasks will be claimed, reason: %s", value.Reason)
+			} else {
+				monitor.Info("worker resumed by kill-switch")
+			}
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
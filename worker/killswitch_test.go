@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/secrets"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestReadKillSwitch(t *testing.T) {
+	var m sync.Mutex
+	var value interface{} // nil, if the secret doesn't exist
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/secret/my-fleet-kill-switch", r.URL.Path)
+		m.Lock()
+		defer m.Unlock()
+		if value == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"secret":  value,
+			"expires": "3000-01-01T00:00:00.000Z",
+		})
+	}))
+	defer s.Close()
+
+	c := secrets.New(&tcclient.Credentials{ClientID: "tester", AccessToken: "no-secret"})
+	c.BaseURL = s.URL
+
+	v, err := readKillSwitch(c, "my-fleet-kill-switch")
+	require.NoError(t, err)
+	require.False(t, v.Paused, "expected missing secret not to pause")
+
+	m.Lock()
+	value = map[string]interface{}{"paused": true, "reason": "bad image"}
+	m.Unlock()
+	v, err = readKillSwitch(c, "my-fleet-kill-switch")
+	require.NoError(t, err)
+	require.True(t, v.Paused)
+	require.Equal(t, "bad image", v.Reason)
+
+	m.Lock()
+	value = "not-an-object"
+	m.Unlock()
+	_, err = readKillSwitch(c, "my-fleet-kill-switch")
+	require.Error(t, err)
+}
+
+func TestKillSwitchPausesWorker(t *testing.T) {
+	w := &Worker{monitor: mocks.NewMockMonitor(false)}
+	require.True(t, w.canClaim())
+	require.Equal(t, stateRunning, w.state())
+
+	require.True(t, w.killSwitch.set(killSwitchValue{Paused: true, Reason: "testing"}))
+	require.False(t, w.killSwitch.set(killSwitchValue{Paused: true, Reason: "still testing"}))
+	require.False(t, w.canClaim())
+	require.Equal(t, statePaused, w.state())
+
+	require.True(t, w.killSwitch.set(killSwitchValue{}))
+	require.True(t, w.canClaim())
+	require.Equal(t, stateRunning, w.state())
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ExitCodeDrained is the exit code used by the 'work' command when the worker
+// exits after being drained, such that deployment tooling can distinguish a
+// drained worker from a worker that crashed or was stopped.
+const ExitCodeDrained = 3
+
+// Worker states reported by the health endpoint
+const (
+	stateRunning     = "running"
+	stateQuarantined = "quarantined"
+	statePaused      = "paused"
+	stateDraining    = "draining"
+	stateDrained     = "drained"
+	stateStopping    = "stopping"
+)
+
+// Drain puts the worker in lame-duck mode, it stops claiming tasks and stops
+// gracefully when current tasks are done. Use IsDraining() to determine if
+// the worker was drained after Start() returns.
+func (w *Worker) Drain() {
+	if !w.draining.Swap(true) {
+		w.monitor.Info("draining worker, no new tasks will be claimed")
+	}
+	w.StopGracefully()
+}
+
+// IsDraining returns true, if Drain() has been called
+func (w *Worker) IsDraining() bool {
+	return w.draining.Get()
+}
+
+// markDrained reports the worker as drained on the health endpoint, if Drain()
+// has been called, this must only be called once the worker is idle.
+func (w *Worker) markDrained() {
+	if w.draining.Get() && !w.drained.Swap(true) {
+		w.monitor.Info("worker drained, all tasks have been resolved")
+	}
+}
+
+// state returns the current state of the worker, as reported by the health
+// endpoint.
+func (w *Worker) state() string {
+	switch {
+	case w.drained.Get():
+		return stateDrained
+	case w.draining.Get():
+		return stateDraining
+	case w.lifeCycleTracker.StoppingGracefully.IsDone():
+		return stateStopping
+	case w.isQuarantined():
+		return stateQuarantined
+	case w.killSwitch.Paused():
+		return statePaused
+	default:
+		return stateRunning
+	}
+}
+
+// handleHealth reports the state of the worker, responding 503 if the worker
+// isn't claiming tasks.
+func (w *Worker) handleHealth(res http.ResponseWriter, req *http.Request) {
+	state := w.state()
+	if state != stateRunning {
+		w.writeState(res, state, http.StatusServiceUnavailable)
+	} else {
+		w.writeState(res, state, http.StatusOK)
+	}
+}
+
+// handleDrain puts the worker in lame-duck mode, see Drain()
+func (w *Worker) handleDrain(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(res, "method not allowed, use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Drain()
+	w.writeState(res, w.state(), http.StatusOK)
+}
+
+func (w *Worker) writeState(res http.ResponseWriter, state string, statusCode int) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(statusCode)
+	json.NewEncoder(res).Encode(map[string]interface{}{
+		"state":       state,
+		"activeTasks": w.activeTasks.Value(),
+		"queuedTasks": w.queued.Len(),
+	})
+}
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestDrain(t *testing.T) {
+	w := &Worker{monitor: mocks.NewMockMonitor(false)}
+	w.options.Admin = &adminOptions{Token: "secret-token-secret-token"}
+	s := httptest.NewServer(w.adminHandler())
+	defer s.Close()
+
+	health := func() (int, string) {
+		res, err := http.Get(s.URL + "/health")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var result struct {
+			State string `json:"state"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+		return res.StatusCode, result.State
+	}
+
+	code, state := health()
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, stateRunning, state)
+
+	// Drain while a task is running
+	w.activeTasks.Increment()
+	req, err := http.NewRequest("POST", s.URL+"/admin/v1/drain", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+w.options.Admin.Token)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.True(t, w.IsDraining())
+	require.True(t, w.lifeCycleTracker.StoppingGracefully.IsDone())
+
+	code, state = health()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, stateDraining, state)
+
+	// Still draining when idle, until the worker is marked drained
+	w.activeTasks.Decrement()
+	_, state = health()
+	require.Equal(t, stateDraining, state)
+
+	w.activeTasks.WaitForIdle()
+	w.markDrained()
+	code, state = health()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, stateDrained, state)
+}
+
+func TestWorkerDrained(t *testing.T) {
+	q := client.MockQueue{}
+	s := httptest.NewServer(&q)
+	defer s.Close()
+	w := setupTestWorker(t, s.URL, 1)
+
+	w.Drain()
+	require.Equal(t, stateDraining, w.state())
+	require.NoError(t, w.Start())
+	require.Equal(t, stateDrained, w.state())
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/commands/version"
+)
+
+const logHeaderDivider = "------------------------------------------------------------"
+
+// newLogHeader returns the static lines of the header written at the top of
+// each task log.
+func newLogHeader(c configType, pluginNames []string) []string {
+	ver := version.Version()
+	if ver == "" {
+		ver = "unknown"
+	}
+	if rev := version.Revision(); rev != "" {
+		ver += " (revision: " + rev + ")"
+	}
+	o := c.WorkerOptions
+	header := []string{
+		"worker version: " + ver,
+		fmt.Sprintf("worker type: %s/%s", o.ProvisionerID, o.WorkerType),
+		fmt.Sprintf("worker: %s/%s", o.WorkerGroup, o.WorkerID),
+	}
+	if o.InstanceType != "" {
+		header = append(header, "instance type: "+o.InstanceType)
+	}
+	if o.ImageID != "" {
+		header = append(header, "image: "+o.ImageID)
+	}
+	return append(header,
+		"engine: "+c.Engine,
+		"plugins: "+strings.Join(pluginNames, ", "),
+	)
+}
+
+// taskLogHeader returns the header to be written at the top of the task log
+// for a task started at the given time.
+func (w *Worker) taskLogHeader(started time.Time) []string {
+	header := []string{logHeaderDivider}
+	header = append(header, w.logHeader...)
+	return append(header,
+		"started: "+started.UTC().Format(time.RFC3339),
+		logHeaderDivider,
+	)
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
+)
+
+// workerMetrics holds the metrics recorded by the worker, engines and plugins
+// record their own metrics in the same Registry.
+type workerMetrics struct {
+	tasksClaimed  *metrics.Counter
+	tasksResolved *metrics.Counter   // labels: outcome
+	taskDuration  *metrics.Histogram // labels: outcome
+	pollLatency   *metrics.Histogram
+}
+
+func newWorkerMetrics(r *metrics.Registry) workerMetrics {
+	return workerMetrics{
+		tasksClaimed: r.Counter(
+			"taskcluster_worker_tasks_claimed_total",
+			"Number of tasks claimed.",
+		),
+		tasksResolved: r.Counter(
+			"taskcluster_worker_tasks_resolved_total",
+			"Number of tasks resolved, by outcome: completed, failed or the exception reason.",
+			"outcome",
+		),
+		taskDuration: r.Histogram(
+			"taskcluster_worker_task_duration_seconds",
+			"Time from a task was claimed until it was resolved, by outcome.",
+			metrics.ExponentialBuckets(1, 2, 16),
+			"outcome",
+		),
+		pollLatency: r.Histogram(
+			"taskcluster_worker_queue_poll_seconds",
+			"Latency of claimWork requests to the queue.",
+			metrics.ExponentialBuckets(0.05, 2, 12),
+		),
+	}
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"math/rand"
+	"time"
+)
+
+// pollingJitter is the fraction by which the polling delay is randomly
+// reduced, when backing off, such that idle workers don't poll in lock-step.
+const pollingJitter = 0.2
+
+// pollingDelay returns the delay before polling again after emptyPolls
+// consecutive polls that didn't return any tasks.
+//
+// The delay doubles for each empty poll, starting from base, until it reaches
+// max. If max is not larger than base, this always returns base.
+func pollingDelay(base, max time.Duration, emptyPolls int) time.Duration {
+	if max <= base || emptyPolls <= 1 {
+		return base
+	}
+	delay := base
+	for i := 1; i < emptyPolls && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	// Subtract jitter, but never go below base
+	delay -= time.Duration(rand.Float64() * pollingJitter * float64(delay))
+	if delay < base {
+		delay = base
+	}
+	return delay
+}
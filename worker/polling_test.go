@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollingDelay(t *testing.T) {
+	base := 5 * time.Second
+	max := 60 * time.Second
+
+	// Without backoff configured the base interval is always used
+	require.Equal(t, base, pollingDelay(base, 0, 10))
+	require.Equal(t, base, pollingDelay(base, base, 10))
+
+	// First empty poll uses the base interval
+	require.Equal(t, base, pollingDelay(base, max, 0))
+	require.Equal(t, base, pollingDelay(base, max, 1))
+
+	// Delay doubles with jitter, and is capped by max
+	for i := 0; i < 100; i++ {
+		d := pollingDelay(base, max, 2)
+		require.True(t, d <= 10*time.Second && d >= 8*time.Second, "delay: %s", d)
+		d = pollingDelay(base, max, 50)
+		require.True(t, d <= max && d >= 48*time.Second, "delay: %s", d)
+	}
+}
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/httpbackoff"
+)
+
+// priorityRank maps task.priority to a rank, higher rank is more urgent
+var priorityRank = map[string]int{
+	"highest":   7,
+	"very-high": 6,
+	"high":      5,
+	"medium":    4,
+	"low":       3,
+	"very-low":  2,
+	"lowest":    1,
+	"normal":    1, // deprecated alias for lowest
+}
+
+// moreUrgent returns true, if a should be started before b, ordered by
+// task.priority and then task.deadline.
+func moreUrgent(a, b taskClaim) bool {
+	pa := priorityRank[a.Task.Priority]
+	pb := priorityRank[b.Task.Priority]
+	if pa != pb {
+		return pa > pb
+	}
+	return time.Time(a.Task.Deadline).Before(time.Time(b.Task.Deadline))
+}
+
+// sortClaims orders claims by task.priority, such that the most urgent task is
+// first, and tasks with equal priority are ordered by deadline.
+func sortClaims(claims []taskClaim) {
+	sort.SliceStable(claims, func(i, j int) bool {
+		return moreUrgent(claims[i], claims[j])
+	})
+}
+
+// claimQueue holds claimed tasks waiting for capacity to run, ordered such
+// that the most urgent task is started first. Hence, an urgent claim preempts
+// less urgent claims that haven't been started yet.
+type claimQueue struct {
+	m      sync.Mutex
+	claims []*queuedClaim
+}
+
+// queuedClaim is a claim in claimQueue, the claim is reclaimed by
+// Worker.holdClaim until stop is closed.
+type queuedClaim struct {
+	claim   taskClaim
+	dropped bool // true, if the claim was canceled or expired while queued
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Len returns the number of queued claims
+func (q *claimQueue) Len() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return len(q.claims)
+}
+
+// Push adds qc to the queue
+func (q *claimQueue) Push(qc *queuedClaim) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.claims = append(q.claims, qc)
+	sort.SliceStable(q.claims, func(i, j int) bool {
+		return moreUrgent(q.claims[i].claim, q.claims[j].claim)
+	})
+}
+
+// Pop removes the most urgent claim from the queue, and stops reclaiming it.
+// Returns false, if the queue is empty.
+func (q *claimQueue) Pop() (taskClaim, bool) {
+	for {
+		q.m.Lock()
+		if len(q.claims) == 0 {
+			q.m.Unlock()
+			return taskClaim{}, false
+		}
+		qc := q.claims[0]
+		q.claims = q.claims[1:]
+		q.m.Unlock()
+
+		close(qc.stop)
+		<-qc.stopped
+		if !qc.dropped {
+			return qc.claim, true
+		}
+	}
+}
+
+// remove removes qc from the queue, if present
+func (q *claimQueue) remove(qc *queuedClaim) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for i, c := range q.claims {
+		if c == qc {
+			q.claims = append(q.claims[:i], q.claims[i+1:]...)
+			return
+		}
+	}
+}
+
+// enqueueClaims adds claims to the queue of claims waiting for capacity
+func (w *Worker) enqueueClaims(claims []taskClaim) {
+	for _, claim := range claims {
+		qc := &queuedClaim{
+			claim:   claim,
+			stop:    make(chan struct{}),
+			stopped: make(chan struct{}),
+		}
+		w.queued.Push(qc)
+		go w.holdClaim(qc)
+	}
+}
+
+// startQueuedClaims starts processing queued claims, most urgent first, while
+// there is capacity available.
+func (w *Worker) startQueuedClaims() {
+	for w.activeTasks.Value() < w.options.Concurrency {
+		claim, ok := w.queued.Pop()
+		if !ok {
+			return
+		}
+		debug("starting to process task: %s/%d", claim.Status.TaskID, claim.RunID)
+		w.activeTasks.Increment()
+		go w.processClaim(claim)
+	}
+}
+
+// holdClaim reclaims qc while it's queued, and drops it from the queue if the
+// task is canceled or the claim expires.
+func (w *Worker) holdClaim(qc *queuedClaim) {
+	defer close(qc.stopped)
+
+	taskID := qc.claim.Status.TaskID
+	runID := strconv.Itoa(qc.claim.RunID)
+	m := w.monitor.WithTags(map[string]string{
+		"taskId": taskID,
+		"runId":  runID,
+	})
+	takenUntil := time.Time(qc.claim.TakenUntil)
+	for {
+		select {
+		case <-qc.stop:
+			return
+		case <-time.After(w.reclaimDelay(takenUntil)):
+		}
+
+		debug("queue.reclaimTask(%s, %s) for queued claim", taskID, runID)
+		q := w.newQueueClient(context.Background(), asClientCredentials(qc.claim.Credentials))
+		result, err := q.ReclaimTask(taskID, runID)
+		if err != nil {
+			e, ok := err.(httpbackoff.BadHttpResponseCode)
+			if (ok && e.HttpResponseCode == 409) || !w.queueNow().Before(takenUntil) {
+				m.Warnf("dropping queued claim, reclaimTask failed, error: %v", err)
+				qc.dropped = true
+				w.queued.remove(qc)
+				return
+			}
+			m.ReportWarning(err, "failed to reclaim queued task")
+			continue
+		}
+		qc.claim.Credentials = result.Credentials
+		qc.claim.TakenUntil = result.TakenUntil
+		takenUntil = time.Time(result.TakenUntil)
+	}
+}
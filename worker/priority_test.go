@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestSortClaims(t *testing.T) {
+	now := time.Now()
+	claim := func(taskID, priority string, deadline time.Duration) taskClaim {
+		var c taskClaim
+		c.Status.TaskID = taskID
+		c.Task.Priority = priority
+		c.Task.Deadline = tcclient.Time(now.Add(deadline))
+		return c
+	}
+	claims := []taskClaim{
+		claim("lowest-late", "lowest", 2*time.Hour),
+		claim("high", "high", 3*time.Hour),
+		claim("lowest-early", "lowest", 1*time.Hour),
+		claim("normal", "normal", 90*time.Minute),
+		claim("highest", "highest", 4*time.Hour),
+	}
+	sortClaims(claims)
+
+	var order []string
+	for _, c := range claims {
+		order = append(order, c.Status.TaskID)
+	}
+	require.Equal(t, []string{
+		"highest", "high", "lowest-early", "normal", "lowest-late",
+	}, order)
+}
+
+func TestClaimQueue(t *testing.T) {
+	w := &Worker{monitor: mocks.NewMockMonitor(false)}
+	claim := func(taskID, priority string) taskClaim {
+		var c taskClaim
+		c.Status.TaskID = taskID
+		c.Task.Priority = priority
+		c.TakenUntil = tcclient.Time(time.Now().Add(time.Hour))
+		return c
+	}
+	w.enqueueClaims([]taskClaim{claim("low", "low"), claim("medium", "medium")})
+	w.enqueueClaims([]taskClaim{claim("highest", "highest")})
+	require.Equal(t, 3, w.queued.Len())
+
+	// The most urgent claim preempts claims queued before it
+	var order []string
+	for {
+		c, ok := w.queued.Pop()
+		if !ok {
+			break
+		}
+		order = append(order, c.Status.TaskID)
+	}
+	require.Equal(t, []string{"highest", "medium", "low"}, order)
+	require.Equal(t, 0, w.queued.Len())
+}
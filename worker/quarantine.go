@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// circuitBreaker counts consecutive internal-errors and trips when threshold
+// is reached. Once tripped it stays tripped, a threshold of zero disables it.
+type circuitBreaker struct {
+	m         sync.Mutex
+	threshold int
+	failures  int
+	tripped   bool
+}
+
+// Record the outcome of a task, returns true if this caused the circuit
+// breaker to trip.
+func (c *circuitBreaker) Record(internalError bool) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if !internalError {
+		c.failures = 0
+		return false
+	}
+	c.failures++
+	if c.threshold == 0 || c.tripped || c.failures < c.threshold {
+		return false
+	}
+	c.tripped = true
+	return true
+}
+
+// Tripped returns true, if threshold consecutive internal-errors have been
+// recorded.
+func (c *circuitBreaker) Tripped() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.tripped
+}
+
+// recordOutcome records the outcome of a task or self-test, and quarantines
+// the worker if too many consecutive internal-errors have been observed.
+func (w *Worker) recordOutcome(internalError bool) {
+	if !w.quarantine.Record(internalError) {
+		return
+	}
+	w.monitor.Count("quarantined", 1)
+	w.monitor.ReportError(errors.Errorf(
+		"worker quarantined after %d consecutive internal-errors",
+		w.options.QuarantineThreshold,
+	), "worker is quarantined and will not claim any more tasks")
+}
+
+// isQuarantined returns true, if the worker has stopped claiming tasks due to
+// internal-errors, failed integrity checks or failed host verifications.
+func (w *Worker) isQuarantined() bool {
+	return w.quarantine.Tripped() || w.integrity.Tampered() || w.hostHealth.Tripped()
+}
+
+// canClaim returns true, if the worker isn't quarantined or paused by the
+// kill-switch.
+func (w *Worker) canClaim() bool {
+	return !w.isQuarantined() && !w.killSwitch.Paused()
+}
@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	c := circuitBreaker{threshold: 3}
+	require.False(t, c.Record(true))
+	require.False(t, c.Record(true))
+	require.False(t, c.Record(false), "success should reset the count")
+	require.False(t, c.Record(true))
+	require.False(t, c.Record(true))
+	require.False(t, c.Tripped())
+	require.True(t, c.Record(true), "third consecutive failure should trip")
+	require.True(t, c.Tripped())
+	require.False(t, c.Record(true), "should only trip once")
+	require.False(t, c.Record(false))
+	require.True(t, c.Tripped(), "should stay tripped")
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	c := circuitBreaker{}
+	for i := 0; i < 100; i++ {
+		require.False(t, c.Record(true))
+	}
+	require.False(t, c.Tripped())
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"math/rand"
+)
+
+// queues returns the list of queues to claim tasks from, with default weights
+func (o *options) queues() []queueOptions {
+	queues := []queueOptions{{
+		ProvisionerID: o.ProvisionerID,
+		WorkerType:    o.WorkerType,
+		Weight:        o.Weight,
+	}}
+	queues = append(queues, o.AdditionalQueues...)
+	for i := range queues {
+		if queues[i].Weight == 0 {
+			queues[i].Weight = 1
+		}
+	}
+	return queues
+}
+
+// weightedOrder returns queues in random order, such that the probability of
+// a queue being ordered before another is proportional to its weight.
+func weightedOrder(queues []queueOptions) []queueOptions {
+	remaining := append([]queueOptions{}, queues...)
+	result := make([]queueOptions, 0, len(queues))
+	for len(remaining) > 0 {
+		total := 0
+		for _, q := range remaining {
+			total += q.Weight
+		}
+		pick := rand.Intn(total)
+		i := 0
+		for pick >= remaining[i].Weight {
+			pick -= remaining[i].Weight
+			i++
+		}
+		result = append(result, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	return result
+}
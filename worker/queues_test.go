@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsQueues(t *testing.T) {
+	o := options{
+		ProvisionerID: "test-provisioner-id",
+		WorkerType:    "test-worker-type",
+		AdditionalQueues: []queueOptions{
+			{ProvisionerID: "test-provisioner-id", WorkerType: "other-worker-type", Weight: 3},
+		},
+	}
+	require.Equal(t, []queueOptions{
+		{ProvisionerID: "test-provisioner-id", WorkerType: "test-worker-type", Weight: 1},
+		{ProvisionerID: "test-provisioner-id", WorkerType: "other-worker-type", Weight: 3},
+	}, o.queues())
+}
+
+func TestWeightedOrder(t *testing.T) {
+	queues := []queueOptions{
+		{WorkerType: "a", Weight: 1},
+		{WorkerType: "b", Weight: 3},
+	}
+	first := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		order := weightedOrder(queues)
+		require.Len(t, order, 2)
+		require.NotEqual(t, order[0].WorkerType, order[1].WorkerType)
+		first[order[0].WorkerType]++
+	}
+	// Expect 'b' first 3 out of 4 times, allow for some variance
+	require.InDelta(t, 3000, first["b"], 200)
+}
@@ -0,0 +1,136 @@
+package worker
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+// Maximum number of bytes from the end of the self-test log to include when
+// reporting a failed self-test.
+const maxSelfTestLogTail = 4 * 1024
+
+// selfTestOptions configures a canary payload the worker runs periodically
+type selfTestOptions struct {
+	Payload    map[string]interface{} `json:"payload"`
+	Interval   int                    `json:"interval"`
+	MaxRunTime int                    `json:"maxRunTime"`
+}
+
+// selfTestDue returns true, if a self-test is configured and more than the
+// configured interval have elapsed since lastSelfTest.
+func (w *Worker) selfTestDue(lastSelfTest time.Time) bool {
+	if w.options.SelfTest == nil {
+		return false
+	}
+	interval := time.Duration(w.options.SelfTest.Interval) * time.Second
+	return time.Since(lastSelfTest) >= interval
+}
+
+// runSelfTest runs the self-test payload directly against the engine and
+// reports failures. Caller must increment activeTasks before calling this.
+func (w *Worker) runSelfTest() {
+	defer w.activeTasks.Decrement()
+
+	monitor := w.monitor.WithPrefix("self-test")
+	started := time.Now()
+	err := w.selfTest(monitor)
+	monitor.Measure("duration", time.Since(started).Seconds())
+	w.recordOutcome(err != nil)
+	if err != nil {
+		monitor.Count("failed", 1)
+		monitor.ReportError(err, "self-test failed, host may be unable to run tasks")
+		return
+	}
+	monitor.Count("passed", 1)
+	monitor.Debug("self-test passed")
+}
+
+func (w *Worker) selfTest(monitor runtime.Monitor) error {
+	opts := w.options.SelfTest
+	maxRunTime := time.Duration(opts.MaxRunTime) * time.Second
+
+	taskID := slugid.Nice()
+	now := time.Now()
+	ctx, controller, err := runtime.NewTaskContext(w.environment.TemporaryStorage.NewFilePath(), runtime.TaskInfo{
+		TaskID:        taskID,
+		ProvisionerID: w.options.ProvisionerID,
+		WorkerType:    w.options.WorkerType,
+		Created:       now,
+		Deadline:      now.Add(maxRunTime),
+		Expires:       now.Add(maxRunTime),
+		Metadata: runtime.TaskMetadata{
+			Name: "self-test",
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create TaskContext for self-test")
+	}
+	defer controller.Dispose()
+
+	err = w.runSelfTestSandbox(ctx, monitor.WithTag("taskId", taskID), maxRunTime)
+	controller.CloseLog()
+	if err != nil {
+		return errors.Wrapf(err, "self-test log ends with:\n%s", selfTestLogTail(ctx))
+	}
+	return nil
+}
+
+func (w *Worker) runSelfTestSandbox(ctx *runtime.TaskContext, monitor runtime.Monitor, maxRunTime time.Duration) error {
+	sandboxBuilder, err := w.engine.NewSandboxBuilder(engines.SandboxOptions{
+		TaskContext: ctx,
+		Payload:     w.engine.PayloadSchema().Filter(w.options.SelfTest.Payload),
+		Monitor:     monitor,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create SandboxBuilder")
+	}
+	sandbox, err := sandboxBuilder.StartSandbox()
+	if err != nil {
+		sandboxBuilder.Discard()
+		return errors.Wrap(err, "failed to start sandbox")
+	}
+
+	// Abort the sandbox if the self-test exceeds maxRunTime
+	var timedOut atomics.Bool
+	timer := time.AfterFunc(maxRunTime, func() {
+		timedOut.Set(true)
+		sandbox.Abort()
+	})
+	resultSet, err := sandbox.WaitForResult()
+	timer.Stop()
+	if err == engines.ErrSandboxAborted && timedOut.Get() {
+		return errors.Errorf("self-test didn't finish within maxRunTime: %s", maxRunTime)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to wait for sandbox result")
+	}
+	defer resultSet.Dispose()
+
+	if !resultSet.Success() {
+		return errors.New("self-test payload was unsuccessful")
+	}
+	return nil
+}
+
+// selfTestLogTail returns the end of the log from ctx, log must be closed
+func selfTestLogTail(ctx *runtime.TaskContext) string {
+	r, err := ctx.ExtractLog()
+	if err != nil {
+		return "<unable to read log>"
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "<unable to read log>"
+	}
+	if len(data) > maxSelfTestLogTail {
+		data = data[len(data)-maxSelfTestLogTail:]
+	}
+	return string(data)
+}
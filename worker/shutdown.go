@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// shutdownManager stops the worker gracefully when shutdown is requested, and
+// stops it now, resolving running tasks exception w. worker-shutdown, when the
+// grace period has elapsed or shutdown is requested again.
+type shutdownManager struct {
+	stoppable runtime.Stoppable
+	grace     time.Duration
+	monitor   runtime.Monitor
+	requests  chan string // reasons for shutdown requests
+	done      chan struct{}
+	once      sync.Once
+}
+
+func newShutdownManager(stoppable runtime.Stoppable, grace time.Duration, monitor runtime.Monitor) *shutdownManager {
+	return &shutdownManager{
+		stoppable: stoppable,
+		grace:     grace,
+		monitor:   monitor,
+		requests:  make(chan string, 2),
+		done:      make(chan struct{}),
+	}
+}
+
+// HandleShutdownSignals makes the worker stop claiming tasks on SIGTERM or
+// SIGINT, and resolve running tasks exception w. worker-shutdown when the
+// configured 'shutdownGracePeriod' has elapsed, or another signal is received.
+//
+// Returns a function that stops handling signals, this should be called when
+// Start() has returned.
+func (w *Worker) HandleShutdownSignals() func() {
+	m := newShutdownManager(w, w.shutdownGracePeriod(), w.monitor)
+	go m.run()
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				m.request("received " + sig.String())
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		m.stop()
+	}
+}
+
+// shutdownGracePeriod returns the configured 'shutdownGracePeriod'
+func (w *Worker) shutdownGracePeriod() time.Duration {
+	return time.Duration(w.options.ShutdownGracePeriod) * time.Second
+}
+
+// request shutdown, reason is logged
+func (m *shutdownManager) request(reason string) {
+	select {
+	case m.requests <- reason:
+	default: // already requested twice, no need to do more
+	}
+}
+
+func (m *shutdownManager) run() {
+	select {
+	case reason := <-m.requests:
+		if m.grace <= 0 {
+			m.monitor.Infof("%s, stopping now", reason)
+			m.stoppable.StopNow()
+			return
+		}
+		m.monitor.Infof("%s, stopping gracefully, running tasks will be resolved in %s", reason, m.grace)
+		m.stoppable.StopGracefully()
+	case <-m.done:
+		return
+	}
+
+	timer := time.NewTimer(m.grace)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		m.monitor.Info("shutdown grace period elapsed, stopping now")
+	case reason := <-m.requests:
+		m.monitor.Infof("%s during shutdown grace period, stopping now", reason)
+	case <-m.done:
+		return
+	}
+	m.stoppable.StopNow()
+}
+
+// stop makes run() return without stopping the worker, if it hasn't already
+func (m *shutdownManager) stop() {
+	m.once.Do(func() {
+		close(m.done)
+	})
+}
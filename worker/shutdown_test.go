@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestShutdownManagerGracePeriod(t *testing.T) {
+	var tracker runtime.LifeCycleTracker
+	m := newShutdownManager(&tracker, 50*time.Millisecond, mocks.NewMockMonitor(false))
+	go m.run()
+	defer m.stop()
+
+	m.request("received interrupt")
+	tracker.StoppingGracefully.Wait()
+	require.False(t, tracker.StoppingNow.IsDone(), "expected grace period before StopNow()")
+
+	select {
+	case <-tracker.StoppingNow.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected StopNow() when grace period elapsed")
+	}
+}
+
+func TestShutdownManagerSecondSignal(t *testing.T) {
+	var tracker runtime.LifeCycleTracker
+	m := newShutdownManager(&tracker, time.Hour, mocks.NewMockMonitor(false))
+	go m.run()
+	defer m.stop()
+
+	m.request("received interrupt")
+	tracker.StoppingGracefully.Wait()
+	m.request("received interrupt")
+	select {
+	case <-tracker.StoppingNow.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected StopNow() when second signal is received")
+	}
+}
+
+func TestShutdownManagerNoGracePeriod(t *testing.T) {
+	var tracker runtime.LifeCycleTracker
+	m := newShutdownManager(&tracker, 0, mocks.NewMockMonitor(false))
+	go m.run()
+	defer m.stop()
+
+	m.request("received interrupt")
+	select {
+	case <-tracker.StoppingNow.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected StopNow() when signal is received")
+	}
+}
+
+func TestShutdownManagerStop(t *testing.T) {
+	var tracker runtime.LifeCycleTracker
+	m := newShutdownManager(&tracker, 0, mocks.NewMockMonitor(false))
+	m.stop()
+	m.run() // returns immediately when stopped
+	m.stop()
+	require.False(t, tracker.StoppingGracefully.IsDone())
+}
@@ -8,6 +8,12 @@ const (
 	// shutdown immediately.
 	WorkerShutdown AbortReason = 1 + iota
 	// TaskCanceled is used to abort a TaskRun when the queue reports that the
-	// task has been canceled, deadline exceeded or claim expired.
+	// task has been canceled or deadline exceeded.
 	TaskCanceled
+	// DiskQuotaExceeded is used to abort a TaskRun when the task log and
+	// temporary storage used by the task exceeds the configured disk quota.
+	DiskQuotaExceeded
+	// ClaimExpired is used to abort a TaskRun when the claim expired before it
+	// could be reclaimed, the queue resolves the run, so it isn't reported.
+	ClaimExpired
 )
@@ -0,0 +1,77 @@
+package taskrun
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// diskQuotaInterval is the interval between checks of disk usage against the
+// disk quota of a task.
+const diskQuotaInterval = 5 * time.Second
+
+// diskUsage returns the number of bytes used by the task log and the per-task
+// temporary storage.
+func (t *TaskRun) diskUsage() int64 {
+	usage := t.controller.LogSize()
+	if t.storage != nil {
+		usage += folderSize(t.storage.Path())
+	}
+	return usage
+}
+
+// folderSize returns the total size of files in folder, files removed while
+// walking the folder are ignored.
+func folderSize(folder string) int64 {
+	var size int64
+	filepath.Walk(folder, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // ignore files removed while walking, or unreadable files
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// enforceDiskQuota checks disk usage every diskQuotaInterval until
+// t.stopQuota is closed, aborting the TaskRun if usage exceeds t.diskQuota.
+// t.quotaDone is closed when this returns.
+func (t *TaskRun) enforceDiskQuota() {
+	defer close(t.quotaDone)
+	for {
+		select {
+		case <-t.stopQuota:
+			return
+		case <-time.After(diskQuotaInterval):
+		}
+
+		usage := t.diskUsage()
+		if usage <= t.diskQuota {
+			continue
+		}
+		t.controller.LogError(
+			"Task exceeded disk quota, using ", usage, " bytes of ", t.diskQuota,
+			" bytes allowed for task log and temporary files, aborting task",
+		)
+		t.monitor.WithTag("stage", "disk-quota").Info("aborting task for exceeding disk quota")
+		t.Abort(DiskQuotaExceeded)
+		return
+	}
+}
+
+// newTaskStorage creates per-task temporary storage, returns nil if the
+// folder couldn't be created, in which case disk usage can only be tracked for
+// the task log.
+func (t *TaskRun) newTaskStorage() runtime.TemporaryFolder {
+	folder, err := t.environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		t.monitor.WithTag("stage", "init").ReportWarning(err, "failed to create per-task temporary folder")
+		return nil
+	}
+	return folder
+}
@@ -0,0 +1,25 @@
+package taskrun
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolderSize(t *testing.T) {
+	folder, err := ioutil.TempDir("", "taskrun-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	require.Equal(t, int64(0), folderSize(folder))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "a.txt"), make([]byte, 100), 0600))
+	require.NoError(t, os.Mkdir(filepath.Join(folder, "sub"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "sub", "b.txt"), make([]byte, 50), 0600))
+	require.Equal(t, int64(150), folderSize(folder))
+
+	require.Equal(t, int64(0), folderSize(filepath.Join(folder, "missing")))
+}
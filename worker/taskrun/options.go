@@ -1,6 +1,7 @@
 package taskrun
 
 import (
+	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime"
@@ -16,6 +17,29 @@ type Options struct {
 	TaskInfo      runtime.TaskInfo
 	Payload       map[string]interface{}
 	Queue         client.Queue
+	LogHeader     []string // Lines to be written at the top of the task log
+	Secrets       []string // Values to be redacted from the task log
+	// Resolve as intermittent-task on infrastructure errors, this should only
+	// be true if the task has retries left.
+	AllowIntermittent bool
+	// Number of bytes of task log to hold in memory before writing the log to
+	// a temporary file, defaults to runtime.DefaultMemoryLogSize if zero.
+	MemoryLogSize int
+	// Storage for task logs exceeding MemoryLogSize, defaults to
+	// runtime.FileLogStorage if nil.
+	LogStorage runtime.LogStorage
+	// Payload schema merged from engine and plugins, this is computed for each
+	// TaskRun if not given, so callers should cache it across TaskRuns.
+	PayloadSchema schematypes.Object
+	// Maximum number of bytes the task log and per-task temporary storage may
+	// use before the task is aborted, zero means no quota.
+	DiskQuota int64
+	// Substitute '${NAME}' variables in task.payload strings after the payload
+	// has been validated, see plugins.ExpandPayload.
+	PayloadTemplating bool
+	// Write a replay bundle when the task is resolved exception, nil to
+	// disable replay bundles.
+	ReplayBundle *ReplayBundleOptions
 }
 
 // mustBeValid panics if Options contains empty values, this allows us to catch
@@ -0,0 +1,86 @@
+package taskrun
+
+import (
+	"bytes"
+	"fmt"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// panicArtifactName is the name of the artifact to which stack traces are
+// uploaded, if a panic was recovered during the TaskRun. This isn't public as
+// stack traces may reveal details about the worker configuration.
+const panicArtifactName = "private/logs/worker-panic.txt"
+
+// panicLogLines is the number of lines from the end of the worker log for the
+// task included in the panic report.
+const panicLogLines = 100
+
+// panicReport holds a recovered panic
+type panicReport struct {
+	stage      string
+	incidentID string
+	crash      interface{}
+	stack      []byte
+}
+
+// capturePanic calls fn, recovering and reporting any panic with monitor. If
+// a panic is recovered the incidentID and a report with the stack trace of
+// the panic is returned.
+func capturePanic(monitor runtime.Monitor, stage string, fn func()) (string, *panicReport) {
+	var report *panicReport
+	incidentID := monitor.CapturePanic(func() {
+		defer func() {
+			if crash := recover(); crash != nil {
+				// Capture stack trace from within the panicking goroutine, and
+				// re-panic so the monitor reports it
+				buf := make([]byte, 64*1024)
+				buf = buf[:goruntime.Stack(buf, false)]
+				report = &panicReport{stage: stage, crash: crash, stack: buf}
+				panic(crash)
+			}
+		}()
+		fn()
+	})
+	if incidentID == "" {
+		return "", nil
+	}
+	if report != nil {
+		report.incidentID = incidentID
+	}
+	return incidentID, report
+}
+
+// uploadPanicReport uploads stack traces of recovered panics along with the
+// last lines the worker logged for the task, if any panics were recovered.
+// Secrets registered with the TaskContext are redacted from the report.
+func (t *TaskRun) uploadPanicReport() error {
+	if len(t.panics) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	for _, p := range t.panics {
+		fmt.Fprintf(&b, "panic in stage: %s, incidentId: %s\n", p.stage, p.incidentID)
+		fmt.Fprintf(&b, "%v\n\n%s\n\n", p.crash, p.stack)
+	}
+	if lines := t.workerLog.Lines(); len(lines) > 0 {
+		fmt.Fprintf(&b, "last %d lines of worker log:\n%s\n", len(lines), strings.Join(lines, "\n"))
+	}
+
+	debug("uploading %s", panicArtifactName)
+	err := t.controller.UploadS3Artifact(runtime.S3Artifact{
+		Name:     panicArtifactName,
+		Mimetype: "text/plain; charset=utf-8",
+		Expires:  t.taskInfo.Expires,
+		Stream:   ioext.NopCloser(strings.NewReader(t.controller.RedactSecrets(b.String()))),
+	})
+	if err != nil {
+		t.monitor.WithTag("stage", "exception").ReportWarning(err, "failed to upload ", panicArtifactName)
+		return runtime.ErrNonFatalInternalError
+	}
+	return nil
+}
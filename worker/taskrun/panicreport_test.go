@@ -0,0 +1,42 @@
+package taskrun
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestCapturePanic(t *testing.T) {
+	monitor := mocks.NewMockMonitor(false)
+
+	incidentID, report := capturePanic(monitor, "build", func() {})
+	require.Equal(t, "", incidentID)
+	require.Nil(t, report)
+
+	incidentID, report = capturePanic(monitor, "build", func() {
+		panic("something bad")
+	})
+	require.NotEqual(t, "", incidentID)
+	require.NotNil(t, report)
+	require.Equal(t, incidentID, report.incidentID)
+	require.Equal(t, "build", report.stage)
+	require.Equal(t, "something bad", report.crash)
+	require.True(t, strings.Contains(string(report.stack), "TestCapturePanic"), "expected stack trace")
+}
+
+func TestWorkerLog(t *testing.T) {
+	log := newWorkerLog(3)
+	monitor := log.Monitor(mocks.NewMockMonitor(false)).WithPrefix("engine").WithTag("taskId", "abc")
+	monitor.Info("first")
+	monitor.Debugf("second %d", 2)
+	monitor.WithTag("stage", "build").Warnln("third")
+	monitor.ReportWarning(errors.New("bad thing"), "fourth")
+	require.Equal(t, []string{
+		"DEBUG: second 2 (engine, taskId=abc)",
+		"WARN: third (engine, stage=build, taskId=abc)",
+		"WARN: fourth, error: bad thing (engine, taskId=abc)",
+	}, log.Lines())
+}
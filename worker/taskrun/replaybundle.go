@@ -0,0 +1,189 @@
+package taskrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// replayBundleArtifactName is the name of the artifact to which replay bundles
+// are uploaded. This isn't public as the payload and task log may contain
+// information the task author doesn't want to publish.
+const replayBundleArtifactName = "private/logs/replay-bundle.json"
+
+// secretPropertySuffixes are suffixes of configuration property names that
+// may hold secrets, matched case-insensitively. Such properties are removed
+// from the engine configuration written to replay bundles.
+var secretPropertySuffixes = []string{
+	"password", "passphrase", "secret", "token", "key", "credentials", "certificate",
+}
+
+// ReplayBundleVersion is the version of the replay bundle format, bundles
+// with a different version cannot be replayed.
+const ReplayBundleVersion = 1
+
+// ReplayBundleOptions configures writing of replay bundles, when a task is
+// resolved exception.
+type ReplayBundleOptions struct {
+	// Folder to write replay bundles to, bundles are not written to disk if
+	// this is empty.
+	Folder string
+	// Upload replay bundles as a private artifact.
+	Upload bool
+	// Engine name and engine configuration to include in the replay bundle,
+	// properties that may hold secrets are removed from the configuration.
+	Engine       string
+	EngineConfig interface{}
+}
+
+// A ReplayBundle holds everything needed to reproduce a TaskRun that was
+// resolved exception, see the 'exec' command.
+type ReplayBundle struct {
+	Version      int                    `json:"version"`
+	TaskInfo     runtime.TaskInfo       `json:"taskInfo"`
+	Reason       string                 `json:"reason"`
+	Payload      map[string]interface{} `json:"payload"`
+	Engine       string                 `json:"engine"`
+	EngineConfig interface{}            `json:"engineConfig"`
+	Diagnostics  string                 `json:"diagnostics"`
+	Panics       []string               `json:"panics"`
+	Log          string                 `json:"log"`
+}
+
+// ReadReplayBundle reads a ReplayBundle from file.
+func ReadReplayBundle(file string) (*ReplayBundle, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var b ReplayBundle
+	if err = json.Unmarshal(data, &b); err != nil {
+		return nil, errors.Wrap(err, "failed to parse replay bundle")
+	}
+	if b.Version != ReplayBundleVersion {
+		return nil, fmt.Errorf(
+			"unsupported replay bundle version %d, expected %d", b.Version, ReplayBundleVersion,
+		)
+	}
+	return &b, nil
+}
+
+// shouldWriteReplayBundle returns true, if the task was resolved with an
+// exception that is worth replaying.
+func (t *TaskRun) shouldWriteReplayBundle() bool {
+	if t.replayBundle == nil || !t.exception {
+		return false
+	}
+	switch t.reason {
+	case runtime.ReasonCanceled, runtime.ReasonWorkerShutdown, runtime.ReasonSuperseded, runtime.ReasonClaimExpired:
+		return false
+	}
+	return true
+}
+
+// writeReplayBundle writes a replay bundle to disk and/or uploads it as an
+// artifact, this must be called after the task log has been closed.
+func (t *TaskRun) writeReplayBundle() error {
+	o := t.replayBundle
+	// Record the payload as declared, as substituted values may be secret
+	payload := t.payload
+	if t.declaredPayload != nil {
+		payload = t.declaredPayload
+	}
+	b := ReplayBundle{
+		Version:      ReplayBundleVersion,
+		TaskInfo:     t.taskInfo,
+		Reason:       t.reason.String(),
+		Payload:      payload,
+		Engine:       o.Engine,
+		EngineConfig: stripSecrets(o.EngineConfig),
+		Diagnostics:  t.controller.RedactSecrets(string(t.controller.Diagnostics())),
+		Panics:       []string{},
+	}
+	for _, p := range t.panics {
+		b.Panics = append(b.Panics, t.controller.RedactSecrets(fmt.Sprintf(
+			"panic in stage: %s, incidentId: %s\n%v\n\n%s", p.stage, p.incidentID, p.crash, p.stack,
+		)))
+	}
+	if log, err := t.controller.ExtractLog(); err == nil {
+		data, _ := ioutil.ReadAll(log)
+		log.Close()
+		b.Log = t.controller.RedactSecrets(string(data))
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		t.monitor.WithTag("stage", "exception").ReportError(err, "failed to serialize replay bundle")
+		return runtime.ErrNonFatalInternalError
+	}
+
+	var result error
+	if o.Folder != "" {
+		file := filepath.Join(o.Folder, fmt.Sprintf("%s-%d.json", t.taskInfo.TaskID, t.taskInfo.RunID))
+		debug("writing replay bundle to %s", file)
+		err = os.MkdirAll(o.Folder, 0700)
+		if err == nil {
+			err = ioutil.WriteFile(file, data, 0600)
+		}
+		if err != nil {
+			t.monitor.WithTag("stage", "exception").ReportWarning(err, "failed to write replay bundle to ", file)
+			result = runtime.ErrNonFatalInternalError
+		}
+	}
+	if o.Upload {
+		debug("uploading %s", replayBundleArtifactName)
+		err = t.controller.UploadS3Artifact(runtime.S3Artifact{
+			Name:     replayBundleArtifactName,
+			Mimetype: "application/json",
+			Expires:  t.taskInfo.Expires,
+			Stream:   ioext.NopCloser(bytes.NewReader(data)),
+		})
+		if err != nil {
+			t.monitor.WithTag("stage", "exception").ReportWarning(err, "failed to upload ", replayBundleArtifactName)
+			result = runtime.ErrNonFatalInternalError
+		}
+	}
+	return result
+}
+
+// stripSecrets returns a copy of config without properties that may hold
+// secrets, see secretPropertySuffixes.
+func stripSecrets(config interface{}) interface{} {
+	switch value := config.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			if !isSecretProperty(k) {
+				result[k] = stripSecrets(v)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, v := range value {
+			result[i] = stripSecrets(v)
+		}
+		return result
+	default:
+		return config
+	}
+}
+
+// isSecretProperty returns true, if a property with given name may hold a
+// secret.
+func isSecretProperty(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range secretPropertySuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
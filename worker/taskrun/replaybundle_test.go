@@ -0,0 +1,46 @@
+package taskrun
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripSecrets(t *testing.T) {
+	config := map[string]interface{}{
+		"maxConcurrency": 2,
+		"registries": map[string]interface{}{
+			"docker.io": map[string]interface{}{"username": "me", "password": "hunter2"},
+		},
+		"network": map[string]interface{}{
+			"vpnConnections": []interface{}{
+				map[string]interface{}{
+					"remote":       "vpn.example.com",
+					"keyDirection": 1,
+					"key":          "KEY-DATA",
+					"tlsKey":       "TLS-KEY-DATA",
+					"certificate":  "CERT-DATA",
+				},
+			},
+		},
+		"accessToken": "secret-token",
+	}
+	assert.Equal(t, map[string]interface{}{
+		"maxConcurrency": 2,
+		"registries": map[string]interface{}{
+			"docker.io": map[string]interface{}{"username": "me"},
+		},
+		"network": map[string]interface{}{
+			"vpnConnections": []interface{}{
+				map[string]interface{}{
+					"remote":       "vpn.example.com",
+					"keyDirection": 1,
+				},
+			},
+		},
+	}, stripSecrets(config))
+
+	// config is not modified
+	assert.Equal(t, "secret-token", config["accessToken"])
+	assert.Nil(t, stripSecrets(nil))
+}
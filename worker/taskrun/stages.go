@@ -57,15 +57,31 @@ var stages = map[Stage]func(*TaskRun) error{
 }
 
 func prepare(t *TaskRun) error {
-	// Construct payload schema
-	payloadSchema, err := schematypes.Merge(
-		t.engine.PayloadSchema(),
-		t.pluginManager.PayloadSchema(),
-	)
-	if err != nil {
-		panic(fmt.Sprintf(
-			"Conflicting plugin and engine payload properties, error: %s", err,
-		))
+	t.startSection("setup")
+
+	// Convert payloads declaring an older payloadVersion to the current format
+	var migrations []runtime.PayloadMigration
+	migrations = append(migrations, t.engine.PayloadMigrations()...)
+	migrations = append(migrations, t.pluginManager.PayloadMigrations()...)
+	payload, merr := runtime.MigratePayload(t.payload, migrations)
+	if merr == nil {
+		t.payload = payload
+	}
+
+	// Construct payload schema, unless it was given in Options
+	payloadSchema := t.payloadSchema
+	if payloadSchema.Properties == nil {
+		var err error
+		payloadSchema, err = schematypes.Merge(
+			t.engine.PayloadSchema(),
+			t.pluginManager.PayloadSchema(),
+			runtime.PayloadVersionSchema(runtime.CurrentPayloadVersion(migrations)),
+		)
+		if err != nil {
+			panic(fmt.Sprintf(
+				"Conflicting plugin and engine payload properties, error: %s", err,
+			))
+		}
 	}
 
 	// Validate payload against schema
@@ -80,6 +96,24 @@ func prepare(t *TaskRun) error {
 	} else if verr != nil {
 		verr = runtime.NewMalformedPayloadError("task.payload schema violation: ", verr)
 	}
+	// If migration failed the payload isn't in the current version
+	if merr != nil {
+		verr = merr
+	}
+
+	// Substitute payload variables, once we know the payload is valid
+	if verr == nil && t.templating {
+		var payload map[string]interface{}
+		payload, verr = plugins.ExpandPayload(t.payload, t.pluginManager.PayloadVariables(), plugins.PayloadVariableOptions{
+			Environment: &t.environment,
+			TaskInfo:    &t.taskInfo,
+			TaskContext: t.taskContext,
+		})
+		if verr == nil {
+			t.declaredPayload = t.payload
+			t.payload = payload
+		}
+	}
 
 	var err1, err2 error
 	util.Parallel(func() {
@@ -91,22 +125,29 @@ func prepare(t *TaskRun) error {
 		t.sandboxBuilder, err1 = t.engine.NewSandboxBuilder(engines.SandboxOptions{
 			TaskContext: t.taskContext,
 			Payload:     t.engine.PayloadSchema().Filter(t.payload),
-			Monitor: t.environment.Monitor.WithPrefix("engine").WithTags(map[string]string{
+			Monitor: t.workerLog.Monitor(t.environment.Monitor.WithPrefix("engine").WithTags(map[string]string{
 				"taskId": t.taskInfo.TaskID,
 				"runId":  strconv.Itoa(t.taskInfo.RunID),
-			}),
+			})),
 		})
 	}, func() {
+		// Only expose the entire payload, if it satisfies the schema
+		var taskPayload map[string]interface{}
+		if verr == nil {
+			taskPayload = t.payload
+		}
 		// Create TaskPlugin, even if we have schema validation error, how else
 		// will the logging plugins upload logs?
 		t.taskPlugin, err2 = t.pluginManager.NewTaskPlugin(plugins.TaskPluginOptions{
 			TaskInfo:    &t.taskInfo,
 			TaskContext: t.taskContext,
 			Payload:     t.pluginManager.PayloadSchema().Filter(t.payload),
-			Monitor: t.environment.Monitor.WithPrefix("plugin").WithTags(map[string]string{
+			TaskPayload: taskPayload,
+			Scopes:      t.taskInfo.Scopes,
+			Monitor: t.workerLog.Monitor(t.environment.Monitor.WithPrefix("plugin").WithTags(map[string]string{
 				"taskId": t.taskInfo.TaskID,
 				"runId":  strconv.Itoa(t.taskInfo.RunID),
-			}),
+			})),
 		})
 		if err2 != nil {
 			return
@@ -133,10 +174,14 @@ func start(t *TaskRun) error {
 	var err error
 	t.sandbox, err = t.sandboxBuilder.StartSandbox()
 	t.sandboxBuilder = nil
+	if t.sandbox != nil {
+		t.sandboxGauge().Add(1)
+	}
 	return err
 }
 
 func started(t *TaskRun) error {
+	t.startSection("execution")
 	return t.taskPlugin.Started(t.sandbox)
 }
 
@@ -144,22 +189,35 @@ func waiting(t *TaskRun) error {
 	var err error
 	t.resultSet, err = t.sandbox.WaitForResult()
 	t.sandbox = nil
+	t.sandboxGauge().Add(-1)
 	return err
 }
 
 func stopped(t *TaskRun) error {
+	t.startSection("teardown")
 	var err error
 	t.success, err = t.taskPlugin.Stopped(t.resultSet)
 	return err
 }
 
 func finished(t *TaskRun) error {
-	// Close log
+	// End teardown section and close log
+	t.endSection()
 	err := t.controller.CloseLog()
 	if err != nil {
 		panic(fmt.Sprintf("Failed to close task-log, error: %s", err))
 	}
 
+	// Upload logs registered with TaskContext.AddLog()
+	var lerr error
+	t.logsUploaded.Do(func() {
+		lerr = t.uploadAdditionalLogs()
+	})
+
 	// Call finish handler on plugins
-	return t.taskPlugin.Finished(t.success)
+	err = t.taskPlugin.Finished(t.success)
+	if err == nil {
+		err = lerr
+	}
+	return err
 }
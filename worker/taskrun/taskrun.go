@@ -1,21 +1,31 @@
 package taskrun
 
 import (
-	"errors"
+	"bytes"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
 )
 
+// diagnosticsArtifactName is the name of the artifact to which diagnostics
+// are uploaded, if the task is resolved internal-error.
+const diagnosticsArtifactName = "public/logs/worker.txt"
+
 // A TaskRun holds the state of a running task.
 //
-// Methods on this object is not thread-safe, with the exception of Abort() and
-// SetQueueClient() which are intended to be called from other threads.
+// Methods on this object is not thread-safe, with the exception of Abort(),
+// SetQueueClient(), SetCredentials() and SetTakenUntil() which are intended to
+// be called from other threads.
 type TaskRun struct {
 	// Constants
 	environment   runtime.Environment
@@ -24,11 +34,24 @@ type TaskRun struct {
 	monitor       runtime.Monitor
 	taskInfo      runtime.TaskInfo
 	payload       map[string]interface{}
+	payloadSchema schematypes.Object // merged payload schema, computed if empty
+	intermittent  bool               // true, if infrastructure errors resolve intermittent-task
+	templating    bool               // true, if payload variables should be substituted
+	replayBundle  *ReplayBundleOptions
+
+	// Payload as declared, nil unless payload variables were substituted
+	declaredPayload map[string]interface{}
 
 	// TaskContext
 	taskContext *runtime.TaskContext
 	controller  *runtime.TaskContextController
 
+	// Per-task temporary storage and disk quota, if diskQuota is non-zero
+	storage   runtime.TemporaryFolder
+	diskQuota int64
+	stopQuota chan struct{} // closed to stop enforcing the disk quota
+	quotaDone chan struct{} // closed when disk quota is no longer enforced
+
 	// State
 	m         sync.Mutex // lock protecting state variables
 	c         sync.Cond  // Broadcast when state changes
@@ -37,6 +60,17 @@ type TaskRun struct {
 	success   bool       // true, if task is completed successfully
 	exception bool       // true, if reason has a value
 	reason    runtime.ExceptionReason
+	section   string    // log section currently open, only used by running thread
+	sectionAt time.Time // time the current log section was started
+
+	// Ensure that additional logs are only uploaded once
+	logsUploaded atomics.Once
+
+	// Panics recovered while running stages, uploaded in Dispose()
+	panics []panicReport
+
+	// Recent worker log lines for this task, included in the panic report
+	workerLog *workerLog
 
 	// Final error to return from Dispose()
 	fatalErr    atomics.Bool // If we've seen ErrFatalInternalError
@@ -54,21 +88,38 @@ func New(options Options) *TaskRun {
 	// simple validation, having this a few places is just sane
 	options.mustBeValid()
 
+	workerLog := newWorkerLog(panicLogLines)
 	t := &TaskRun{
 		environment:   options.Environment,
 		engine:        options.Engine,
 		pluginManager: options.PluginManager,
-		monitor:       options.Monitor,
+		monitor:       workerLog.Monitor(options.Monitor),
 		taskInfo:      options.TaskInfo,
 		payload:       options.Payload,
+		payloadSchema: options.PayloadSchema,
+		intermittent:  options.AllowIntermittent,
+		diskQuota:     options.DiskQuota,
+		templating:    options.PayloadTemplating,
+		replayBundle:  options.ReplayBundle,
+		workerLog:     workerLog,
 	}
 	t.c.L = &t.m
 
 	// Create TaskContext and controller
+	memoryLogSize := options.MemoryLogSize
+	if memoryLogSize == 0 {
+		memoryLogSize = runtime.DefaultMemoryLogSize
+	}
+	logStorage := options.LogStorage
+	if logStorage == nil {
+		logStorage = runtime.FileLogStorage
+	}
 	var err error
-	t.taskContext, t.controller, err = runtime.NewTaskContext(
+	t.taskContext, t.controller, err = runtime.NewTaskContextWithLogStorage(
 		t.environment.TemporaryStorage.NewFilePath(),
 		t.taskInfo,
+		memoryLogSize,
+		logStorage,
 	)
 	if err != nil {
 		t.monitor.WithTag("stage", "init").ReportError(err, "failed to create TaskContext")
@@ -80,6 +131,23 @@ func New(options Options) *TaskRun {
 		t.fatalErr.Set(true)
 	} else {
 		t.controller.SetQueueClient(options.Queue)
+		for _, secret := range options.Secrets {
+			t.controller.AddSecret(secret)
+		}
+		if t.environment.ArtifactUploader != nil {
+			t.controller.SetArtifactUploader(t.environment.ArtifactUploader)
+		}
+		for _, line := range options.LogHeader {
+			t.controller.Log(line)
+		}
+		if t.storage = t.newTaskStorage(); t.storage != nil {
+			t.controller.SetTemporaryStorage(t.storage)
+		}
+		if t.diskQuota > 0 {
+			t.stopQuota = make(chan struct{})
+			t.quotaDone = make(chan struct{})
+			go t.enforceDiskQuota()
+		}
 	}
 	return t
 }
@@ -101,6 +169,14 @@ func (t *TaskRun) SetCredentials(clientID, accessToken, certificate string) {
 	}
 }
 
+// SetTakenUntil is used to provide the time until which the task is claimed,
+// and update it whenever the task is reclaimed.
+func (t *TaskRun) SetTakenUntil(takenUntil time.Time) {
+	if t.controller != nil {
+		t.controller.SetTakenUntil(takenUntil)
+	}
+}
+
 // Abort will interrupt task execution.
 func (t *TaskRun) Abort(reason AbortReason) {
 	t.m.Lock()
@@ -123,6 +199,10 @@ func (t *TaskRun) Abort(reason AbortReason) {
 		t.reason = runtime.ReasonWorkerShutdown
 	case TaskCanceled:
 		t.reason = runtime.ReasonCanceled
+	case DiskQuotaExceeded:
+		t.reason = runtime.ReasonResourceUnavailable
+	case ClaimExpired:
+		t.reason = runtime.ReasonClaimExpired
 	default:
 		panic(fmt.Sprintf("Unknown AbortReason: %d", reason))
 	}
@@ -166,30 +246,53 @@ func (t *TaskRun) RunToStage(targetStage Stage) {
 		monitor := t.monitor.WithTag("stage", stage.String())
 		monitor.Debug("running stage: ", stage.String())
 		var err error
-		incidentID := monitor.CapturePanic(func() {
+		var fingerprint string // fingerprint of err, if reported
+		incidentID, report := capturePanic(monitor, stage.String(), func() {
 			err = stages[stage](t)
 		})
 		t.m.Lock()
+		if report != nil {
+			t.panics = append(t.panics, *report)
+		}
 
-		// Handle errors
+		// Handle errors, classified by the underlying error if wrapped
 		if err != nil || incidentID != "" {
 			reason := runtime.ReasonInternalError
-			if e, ok := runtime.IsMalformedPayloadError(err); ok {
+			switch e := errors.Cause(err).(type) {
+			case nil:
+			case runtime.MalformedPayloadError:
 				for _, m := range e.Messages() {
 					t.controller.LogError(m)
 				}
 				reason = runtime.ReasonMalformedPayload
-			} else if err == runtime.ErrNonFatalInternalError {
-				t.nonFatalErr.Set(true)
-			} else if err == runtime.ErrFatalInternalError {
-				t.fatalErr.Set(true)
-			} else if err != nil {
-				incidentID = monitor.ReportError(err)
+			case runtime.ResourceExhaustedError:
+				t.controller.LogError(e.Message())
+				reason = runtime.ReasonResourceUnavailable
+			case runtime.InfrastructureError:
+				t.controller.LogError(e.Message())
+				if t.intermittent {
+					reason = runtime.ReasonIntermittentTask
+				} else {
+					t.nonFatalErr.Set(true)
+				}
+			default:
+				fatal, ok := runtime.IsInternalError(e)
+				switch {
+				case ok && fatal:
+					t.fatalErr.Set(true)
+				case ok:
+					t.nonFatalErr.Set(true)
+				default:
+					incidentID = monitor.ReportError(err)
+					fingerprint = runtime.ErrorFingerprint(err, t.environment.Engine, 0)
+					t.controller.LogDiagnostic("stage: ", stage.String(), " failed, error: ", err)
+				}
 			}
 			if incidentID != "" {
 				t.fatalErr.Set(true)
-				t.controller.LogError("Unhandled worker error encountered incidentID=", incidentID)
+				t.controller.LogError(runtime.IncidentMessage(incidentID, fingerprint))
 			}
+			t.endSection()
 			// Never change the resolution, if we've been cancelled or worker-shutdown
 			if t.stage != stageResolved {
 				t.stage = stageResolved
@@ -215,6 +318,24 @@ func (t *TaskRun) RunToStage(targetStage Stage) {
 	t.c.Broadcast()
 }
 
+// startSection ends the current log section, if any, and starts a new section
+// with given name.
+func (t *TaskRun) startSection(name string) {
+	t.endSection()
+	t.section = name
+	t.sectionAt = time.Now()
+	t.controller.LogSectionStart(name)
+}
+
+// endSection ends the current log section, if any, logging the time spent.
+func (t *TaskRun) endSection() {
+	if t.section != "" {
+		t.controller.LogTiming(t.section, time.Since(t.sectionAt))
+		t.controller.LogSectionEnd(t.section)
+		t.section = ""
+	}
+}
+
 // WaitForResult will run all stages up to and including StageFinished, before
 // returning the resolution of the given TaskRun.
 func (t *TaskRun) WaitForResult() (success bool, exception bool, reason runtime.ExceptionReason) {
@@ -229,26 +350,61 @@ func (t *TaskRun) WaitForResult() (success bool, exception bool, reason runtime.
 	return
 }
 
+// sandboxGauge returns the gauge counting sandboxes currently running
+func (t *TaskRun) sandboxGauge() *metrics.Gauge {
+	return t.environment.Metrics.Gauge(
+		"taskcluster_worker_sandboxes", "Number of sandboxes currently running.",
+	)
+}
+
 func (t *TaskRun) capturePanicAndError(stage string, fn func() error) {
 	monitor := t.monitor.WithTag("stage", stage)
 	var err error
-	incidentID := monitor.CapturePanic(func() {
+	incidentID, report := capturePanic(monitor, stage, func() {
 		err = fn()
 	})
+	if report != nil {
+		t.panics = append(t.panics, *report)
+	}
 	if incidentID != "" {
 		err = runtime.ErrFatalInternalError
 	}
-	switch err {
-	case runtime.ErrFatalInternalError:
-		t.fatalErr.Set(true)
-	case runtime.ErrNonFatalInternalError:
-		t.nonFatalErr.Set(true)
-	case nil:
+	if err == nil {
 		return
-	default:
-		t.fatalErr.Set(true)
-		monitor.ReportError(err, "unhandled error in stage: ", stage)
 	}
+	if fatal, ok := runtime.IsInternalError(err); ok {
+		if fatal {
+			t.fatalErr.Set(true)
+		} else {
+			t.nonFatalErr.Set(true)
+		}
+		return
+	}
+	t.fatalErr.Set(true)
+	monitor.ReportError(err, "unhandled error in stage: ", stage)
+}
+
+// uploadDiagnostics uploads diagnostics from the TaskContext, if any, with
+// secrets registered with the TaskContext redacted.
+func (t *TaskRun) uploadDiagnostics() error {
+	diagnostics := t.controller.Diagnostics()
+	if diagnostics == nil {
+		return nil
+	}
+	diagnostics = []byte(t.controller.RedactSecrets(string(diagnostics)))
+
+	debug("uploading %s", diagnosticsArtifactName)
+	err := t.controller.UploadS3Artifact(runtime.S3Artifact{
+		Name:     diagnosticsArtifactName,
+		Mimetype: "text/plain; charset=utf-8",
+		Expires:  t.taskInfo.Expires,
+		Stream:   ioext.NopCloser(bytes.NewReader(diagnostics)),
+	})
+	if err != nil {
+		t.monitor.WithTag("stage", "exception").ReportWarning(err, "failed to upload ", diagnosticsArtifactName)
+		return runtime.ErrNonFatalInternalError
+	}
+	return nil
 }
 
 // Dispose will finish any final processing dispose of all resources.
@@ -260,10 +416,32 @@ func (t *TaskRun) capturePanicAndError(stage string, fn func() error) {
 func (t *TaskRun) Dispose() error {
 	t.monitor.WithTag("stage", "dispose").Debug("running stage: dispose")
 
+	if t.stopQuota != nil {
+		close(t.stopQuota)
+		<-t.quotaDone
+		t.stopQuota = nil
+	}
+
 	if t.controller != nil {
 		debug("canceling TaskContext and closing log")
+		t.endSection()
 		t.controller.Cancel()
 		t.capturePanicAndError("dispose", t.controller.CloseLog)
+		t.logsUploaded.Do(func() {
+			t.capturePanicAndError("exception", t.uploadAdditionalLogs)
+		})
+	}
+
+	if t.exception && t.reason == runtime.ReasonInternalError && t.controller != nil {
+		t.capturePanicAndError("exception", t.uploadDiagnostics)
+	}
+
+	if len(t.panics) > 0 && t.controller != nil {
+		t.capturePanicAndError("exception", t.uploadPanicReport)
+	}
+
+	if t.shouldWriteReplayBundle() && t.controller != nil {
+		t.capturePanicAndError("exception", t.writeReplayBundle)
 	}
 
 	if t.exception && t.taskPlugin != nil {
@@ -308,6 +486,7 @@ func (t *TaskRun) Dispose() error {
 			return err
 		})
 		t.sandbox = nil
+		t.sandboxGauge().Add(-1)
 	}
 
 	if t.resultSet != nil {
@@ -322,6 +501,12 @@ func (t *TaskRun) Dispose() error {
 		t.controller = nil
 	}
 
+	if t.storage != nil {
+		debug("removing per-task temporary folder")
+		t.capturePanicAndError("dispose", t.storage.Remove)
+		t.storage = nil
+	}
+
 	// We report any errors, so they'll be in sentry and logs, hence, we just
 	// notify caller about the fact that there was an unhandled error.
 	if t.fatalErr.Get() {
@@ -332,3 +517,32 @@ func (t *TaskRun) Dispose() error {
 	}
 	return nil
 }
+
+// uploadAdditionalLogs uploads logs registered with TaskContext.AddLog(),
+// this should only be called once, after the task log has been closed.
+func (t *TaskRun) uploadAdditionalLogs() error {
+	var err error
+	for _, log := range t.controller.AdditionalLogs() {
+		name := runtime.AdditionalLogPrefix + log.Name
+		debug("uploading %s", name)
+		stream, oerr := log.Open()
+		if oerr != nil {
+			t.monitor.WithTag("log", log.Name).ReportError(oerr, "failed to open additional log: ", name)
+			err = runtime.ErrNonFatalInternalError
+			continue
+		}
+		uerr := t.controller.UploadS3Artifact(runtime.S3Artifact{
+			Name:     name,
+			Mimetype: log.Mimetype,
+			Expires:  t.taskInfo.Expires,
+			Stream:   stream,
+		})
+		stream.Close()
+		if uerr != nil {
+			t.monitor.WithTag("log", log.Name).ReportWarning(uerr, "failed to upload ", name)
+			t.controller.LogError("Failed to upload log: ", name)
+			err = runtime.ErrNonFatalInternalError
+		}
+	}
+	return err
+}
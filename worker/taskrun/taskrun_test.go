@@ -2,6 +2,7 @@ package taskrun
 
 import (
 	"encoding/json"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -169,6 +170,32 @@ func TestTaskRun(t *testing.T) {
 		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
 	})
 
+	t.Run("malformed-payload unsupported payloadVersion", func(t *testing.T) {
+		plugin := &mockPlugin{}
+		plugin.On("PayloadSchema").Return(schematypes.Object{})
+		plugin.On("NewTaskPlugin", taskPluginOptions).Return(plugin, nil)
+		plugin.On("Exception", runtime.ReasonMalformedPayload).Return(nil)
+		plugin.On("Dispose").Return(nil)
+		defer plugin.AssertExpectations(t)
+
+		defer delete(options.Payload, "payloadVersion")
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"payloadVersion": 2,
+			"delay":    10,
+			"function": "true",
+			"argument": "whatever"
+		}`), &options.Payload), "unable to parse payload")
+
+		run := New(options)
+		run.pluginManager = plugin // hack to inject mock for PluginManager
+		success, exception, reason := run.WaitForResult()
+		assert.False(t, success, "expected success to be false")
+		assert.True(t, exception, "expected exception to be true")
+		assert.Equal(t, runtime.ReasonMalformedPayload, reason, "expected malformed-payload")
+
+		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
+	})
+
 	t.Run("malformed-payload after start", func(t *testing.T) {
 		plugin := &mockPlugin{}
 		plugin.On("PayloadSchema").Return(schematypes.Object{})
@@ -249,6 +276,87 @@ func TestTaskRun(t *testing.T) {
 		require.Equal(t, runtime.ErrNonFatalInternalError, err, "expected non-fatal error")
 	})
 
+	t.Run("infrastructure error", func(t *testing.T) {
+		plugin := &mockPlugin{}
+		plugin.On("PayloadSchema").Return(schematypes.Object{})
+		plugin.On("NewTaskPlugin", taskPluginOptions).Return(plugin, nil)
+		plugin.On("BuildSandbox", mockSandboxBuilder).Return(nil)
+		plugin.On("Started", mockSandbox).Return(nil)
+		plugin.On("Exception", runtime.ReasonIntermittentTask).Return(nil)
+		plugin.On("Dispose").Return(nil)
+		defer plugin.AssertExpectations(t)
+
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"delay":    10,
+			"function": "infrastructure-error",
+			"argument": "image server returned 503"
+		}`), &options.Payload), "unable to parse payload")
+
+		options.AllowIntermittent = true
+		defer func() { options.AllowIntermittent = false }()
+		run := New(options)
+		run.pluginManager = plugin // hack to inject mock for PluginManager
+		success, exception, reason := run.WaitForResult()
+		assert.False(t, success, "expected success to be false")
+		assert.True(t, exception, "expected exception to be true")
+		assert.Equal(t, runtime.ReasonIntermittentTask, reason, "expected intermittent-task")
+
+		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
+	})
+
+	t.Run("infrastructure error without retries", func(t *testing.T) {
+		plugin := &mockPlugin{}
+		plugin.On("PayloadSchema").Return(schematypes.Object{})
+		plugin.On("NewTaskPlugin", taskPluginOptions).Return(plugin, nil)
+		plugin.On("BuildSandbox", mockSandboxBuilder).Return(nil)
+		plugin.On("Started", mockSandbox).Return(nil)
+		plugin.On("Exception", runtime.ReasonInternalError).Return(nil)
+		plugin.On("Dispose").Return(nil)
+		defer plugin.AssertExpectations(t)
+
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"delay":    10,
+			"function": "infrastructure-error",
+			"argument": "image server returned 503"
+		}`), &options.Payload), "unable to parse payload")
+
+		run := New(options)
+		run.pluginManager = plugin // hack to inject mock for PluginManager
+		success, exception, reason := run.WaitForResult()
+		assert.False(t, success, "expected success to be false")
+		assert.True(t, exception, "expected exception to be true")
+		assert.Equal(t, runtime.ReasonInternalError, reason, "expected internal-error")
+
+		err := run.Dispose()
+		require.Equal(t, runtime.ErrNonFatalInternalError, err, "expected non-fatal error")
+	})
+
+	t.Run("resource exhausted", func(t *testing.T) {
+		plugin := &mockPlugin{}
+		plugin.On("PayloadSchema").Return(schematypes.Object{})
+		plugin.On("NewTaskPlugin", taskPluginOptions).Return(plugin, nil)
+		plugin.On("BuildSandbox", mockSandboxBuilder).Return(nil)
+		plugin.On("Started", mockSandbox).Return(nil)
+		plugin.On("Exception", runtime.ReasonResourceUnavailable).Return(nil)
+		plugin.On("Dispose").Return(nil)
+		defer plugin.AssertExpectations(t)
+
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"delay":    10,
+			"function": "resource-exhausted",
+			"argument": "image too large for disk"
+		}`), &options.Payload), "unable to parse payload")
+
+		run := New(options)
+		run.pluginManager = plugin // hack to inject mock for PluginManager
+		success, exception, reason := run.WaitForResult()
+		assert.False(t, success, "expected success to be false")
+		assert.True(t, exception, "expected exception to be true")
+		assert.Equal(t, runtime.ReasonResourceUnavailable, reason, "expected resource-unavailable")
+
+		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
+	})
+
 	t.Run("fatal internal plugin error", func(t *testing.T) {
 		plugin := &mockPlugin{}
 		plugin.On("PayloadSchema").Return(schematypes.Object{})
@@ -378,4 +486,45 @@ func TestTaskRun(t *testing.T) {
 
 		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
 	})
+
+	t.Run("replay bundle", func(t *testing.T) {
+		plugin := &mockPlugin{}
+		plugin.On("PayloadSchema").Return(schematypes.Object{})
+		plugin.On("NewTaskPlugin", taskPluginOptions).Return(plugin, nil)
+		plugin.On("Exception", runtime.ReasonMalformedPayload).Return(nil)
+		plugin.On("Dispose").Return(nil)
+		defer plugin.AssertExpectations(t)
+
+		folder := storage.NewFilePath() // created when writing the replay bundle
+		o := options
+		o.ReplayBundle = &ReplayBundleOptions{
+			Folder: folder,
+			Engine: "mock",
+			EngineConfig: map[string]interface{}{
+				"registry": map[string]interface{}{"username": "me", "password": "hunter2"},
+			},
+		}
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"delay":    10,
+			"function": "malformed-payload-initial",
+			"argument": "example of a bad payload"
+		}`), &o.Payload), "unable to parse payload")
+
+		run := New(o)
+		run.pluginManager = plugin // hack to inject mock for PluginManager
+		_, _, reason := run.WaitForResult()
+		assert.Equal(t, runtime.ReasonMalformedPayload, reason, "expected malformed-payload")
+		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
+
+		b, err := ReadReplayBundle(filepath.Join(folder, "--test-task-id---0.json"))
+		require.NoError(t, err)
+		assert.Equal(t, "malformed-payload", b.Reason)
+		assert.Equal(t, "mock", b.Engine)
+		assert.Equal(t, "--test-task-id--", b.TaskInfo.TaskID)
+		assert.Equal(t, "malformed-payload-initial", b.Payload["function"])
+		assert.Contains(t, b.Log, "example of a bad payload")
+		assert.Equal(t, map[string]interface{}{
+			"registry": map[string]interface{}{"username": "me"},
+		}, b.EngineConfig, "expected secrets to be removed from engine config")
+	})
 }
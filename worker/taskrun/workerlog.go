@@ -0,0 +1,203 @@
+package taskrun
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// workerLog holds the last lines written to the monitors of a TaskRun, such
+// that worker log lines for the task can be included in the panic report.
+type workerLog struct {
+	m     sync.Mutex
+	size  int
+	lines []string
+}
+
+func newWorkerLog(size int) *workerLog {
+	return &workerLog{size: size}
+}
+
+func (l *workerLog) add(line string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.lines = append(l.lines, line)
+	if len(l.lines) > l.size {
+		l.lines = append([]string(nil), l.lines[len(l.lines)-l.size:]...)
+	}
+}
+
+// Lines returns the lines recorded, oldest first
+func (l *workerLog) Lines() []string {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return append([]string(nil), l.lines...)
+}
+
+// Monitor returns a runtime.Monitor that records log messages and reported
+// errors in l before forwarding them to monitor.
+func (l *workerLog) Monitor(monitor runtime.Monitor) runtime.Monitor {
+	return &logMonitor{Monitor: monitor, log: l}
+}
+
+// logMonitor wraps a runtime.Monitor recording messages in a workerLog
+type logMonitor struct {
+	runtime.Monitor
+	log    *workerLog
+	prefix string
+	tags   map[string]string
+}
+
+func (m *logMonitor) record(level string, message string) {
+	var context []string
+	for k, v := range m.tags {
+		context = append(context, k+"="+v)
+	}
+	sort.Strings(context)
+	if m.prefix != "" {
+		context = append([]string{m.prefix}, context...)
+	}
+	message = strings.TrimRight(message, "\n")
+	if len(context) > 0 {
+		message += " (" + strings.Join(context, ", ") + ")"
+	}
+	m.log.add(level + ": " + message)
+}
+
+func (m *logMonitor) ReportError(err error, message ...interface{}) string {
+	m.record("ERROR", fmt.Sprint(message...)+", error: "+err.Error())
+	return m.Monitor.ReportError(err, message...)
+}
+
+func (m *logMonitor) ReportWarning(err error, message ...interface{}) string {
+	m.record("WARN", fmt.Sprint(message...)+", error: "+err.Error())
+	return m.Monitor.ReportWarning(err, message...)
+}
+
+func (m *logMonitor) Debug(a ...interface{}) {
+	m.record("DEBUG", fmt.Sprint(a...))
+	m.Monitor.Debug(a...)
+}
+
+func (m *logMonitor) Debugln(a ...interface{}) {
+	m.record("DEBUG", fmt.Sprintln(a...))
+	m.Monitor.Debugln(a...)
+}
+
+func (m *logMonitor) Debugf(format string, a ...interface{}) {
+	m.record("DEBUG", fmt.Sprintf(format, a...))
+	m.Monitor.Debugf(format, a...)
+}
+
+func (m *logMonitor) Print(a ...interface{}) {
+	m.record("INFO", fmt.Sprint(a...))
+	m.Monitor.Print(a...)
+}
+
+func (m *logMonitor) Println(a ...interface{}) {
+	m.record("INFO", fmt.Sprintln(a...))
+	m.Monitor.Println(a...)
+}
+
+func (m *logMonitor) Printf(format string, a ...interface{}) {
+	m.record("INFO", fmt.Sprintf(format, a...))
+	m.Monitor.Printf(format, a...)
+}
+
+func (m *logMonitor) Info(a ...interface{}) {
+	m.record("INFO", fmt.Sprint(a...))
+	m.Monitor.Info(a...)
+}
+
+func (m *logMonitor) Infoln(a ...interface{}) {
+	m.record("INFO", fmt.Sprintln(a...))
+	m.Monitor.Infoln(a...)
+}
+
+func (m *logMonitor) Infof(format string, a ...interface{}) {
+	m.record("INFO", fmt.Sprintf(format, a...))
+	m.Monitor.Infof(format, a...)
+}
+
+func (m *logMonitor) Warn(a ...interface{}) {
+	m.record("WARN", fmt.Sprint(a...))
+	m.Monitor.Warn(a...)
+}
+
+func (m *logMonitor) Warnln(a ...interface{}) {
+	m.record("WARN", fmt.Sprintln(a...))
+	m.Monitor.Warnln(a...)
+}
+
+func (m *logMonitor) Warnf(format string, a ...interface{}) {
+	m.record("WARN", fmt.Sprintf(format, a...))
+	m.Monitor.Warnf(format, a...)
+}
+
+func (m *logMonitor) Error(a ...interface{}) {
+	m.record("ERROR", fmt.Sprint(a...))
+	m.Monitor.Error(a...)
+}
+
+func (m *logMonitor) Errorln(a ...interface{}) {
+	m.record("ERROR", fmt.Sprintln(a...))
+	m.Monitor.Errorln(a...)
+}
+
+func (m *logMonitor) Errorf(format string, a ...interface{}) {
+	m.record("ERROR", fmt.Sprintf(format, a...))
+	m.Monitor.Errorf(format, a...)
+}
+
+func (m *logMonitor) Panic(a ...interface{}) {
+	m.record("PANIC", fmt.Sprint(a...))
+	m.Monitor.Panic(a...)
+}
+
+func (m *logMonitor) Panicln(a ...interface{}) {
+	m.record("PANIC", fmt.Sprintln(a...))
+	m.Monitor.Panicln(a...)
+}
+
+func (m *logMonitor) Panicf(format string, a ...interface{}) {
+	m.record("PANIC", fmt.Sprintf(format, a...))
+	m.Monitor.Panicf(format, a...)
+}
+
+func (m *logMonitor) WithTags(tags map[string]string) runtime.Monitor {
+	allTags := make(map[string]string, len(m.tags)+len(tags))
+	for k, v := range m.tags {
+		allTags[k] = v
+	}
+	for k, v := range tags {
+		allTags[k] = v
+	}
+	return &logMonitor{
+		Monitor: m.Monitor.WithTags(tags),
+		log:     m.log,
+		prefix:  m.prefix,
+		tags:    allTags,
+	}
+}
+
+func (m *logMonitor) WithTag(key, value string) runtime.Monitor {
+	return m.WithTags(map[string]string{key: value})
+}
+
+func (m *logMonitor) WithPrefix(prefix string) runtime.Monitor {
+	p := m.prefix
+	if p != "" && prefix != "" {
+		p += "."
+	}
+	return &logMonitor{
+		Monitor: m.Monitor.WithPrefix(prefix),
+		log:     m.log,
+		prefix:  p + prefix,
+		tags:    m.tags,
+	}
+}
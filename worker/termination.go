@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/runtime/termination"
+)
+
+// terminationMargin is the time before the announced termination of the host,
+// at which running tasks are resolved exception w. worker-shutdown.
+const terminationMargin = 30 * time.Second
+
+// Default number of seconds between checks for termination notices
+const defaultTerminationPollingInterval = 5
+
+type terminationOptions struct {
+	Provider        string `json:"provider"`
+	PollingInterval int    `json:"pollingInterval"`
+}
+
+// watchTermination checks for notices that the host is about to be terminated,
+// until done is closed, and stops the worker when a notice is found. Running
+// tasks are resolved exception w. worker-shutdown when 'shutdownGracePeriod'
+// has elapsed, or terminationMargin before the announced termination.
+func (w *Worker) watchTermination(done <-chan struct{}) {
+	o := w.options.TerminationNotices
+	if o == nil {
+		return
+	}
+	interval := time.Duration(o.PollingInterval) * time.Second
+	if interval == 0 {
+		interval = defaultTerminationPollingInterval * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	monitor := w.monitor.WithPrefix("termination")
+	provider := termination.Providers()[o.Provider]
+	notice, ok := termination.Watch(ctx, provider, interval, monitor)
+	if !ok {
+		return
+	}
+	monitor.Count("notice", 1)
+
+	grace := w.shutdownGracePeriod()
+	if !notice.Time.IsZero() {
+		if remaining := time.Until(notice.Time) - terminationMargin; remaining < grace {
+			grace = remaining
+		}
+	}
+	m := newShutdownManager(w, grace, w.monitor)
+	m.request("termination notice: " + notice.Description)
+	go func() {
+		<-done
+		m.stop()
+	}()
+	m.run()
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -13,14 +16,16 @@ import (
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/httpbackoff"
 	tcclient "github.com/taskcluster/taskcluster-client-go"
-	"github.com/taskcluster/taskcluster-client-go/auth"
 	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-client-go/secrets"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/cas"
 	"github.com/taskcluster/taskcluster-worker/runtime/client"
 	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/metrics"
 	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 	"github.com/taskcluster/taskcluster-worker/runtime/webhookserver"
@@ -31,19 +36,42 @@ import (
 type Worker struct {
 	// New
 	garbageCollector *gc.GarbageCollector
+	collectGarbage   bool // true, if minimumDiskSpace or minimumMemory is set
 	temporaryStorage runtime.TemporaryFolder
 	environment      runtime.Environment
 	lifeCycleTracker runtime.LifeCycleTracker
+	operations       *runtime.OperationTracker
 	webhookserver    webhookserver.Server
 	engine           engines.Engine
 	plugin           *plugins.PluginManager
+	payloadSchema    schematypes.Object // merged engine and plugin payload schema
 	queue            client.Queue
+	rootURL          string
 	queueBaseURL     string
 	options          options
 	monitor          runtime.Monitor
+	logHeader        []string
+	replayBundle     *taskrun.ReplayBundleOptions
+	events           *eventPublisher  // nil, if no event webhooks are configured
+	secrets          *secrets.Secrets // nil, if no kill-switch is configured
+	metrics          *metrics.Registry
+	logStorage       runtime.LogStorage
+	logSecrets       []string // redacted from task logs
+	stats            workerMetrics
 	// State
 	started     atomics.Once
+	draining    atomics.Bool
+	drained     atomics.Bool
 	activeTasks taskCounter
+	queued      claimQueue // claims waiting for capacity
+	quarantine  circuitBreaker
+	integrity   integrityCheck
+	hostHealth  circuitBreaker
+	hostFailed  atomics.Bool
+	killSwitch  killSwitch
+	clockSkew   clockSkew
+	// Recently executed task groups, for task-group affinity
+	recentTaskGroups recentTaskGroups
 }
 
 // New creates a new Worker
@@ -52,27 +80,45 @@ func New(config interface{}) (w *Worker, err error) {
 	schematypes.MustValidateAndMap(ConfigSchema(), config, &c)
 
 	// Create monitor
-	a := auth.New(&c.Credentials)
-	if c.AuthBaseURL != "" {
-		a.BaseURL = c.AuthBaseURL
-	}
-	monitor := monitoring.New(c.Monitor, a)
+	a := client.NewAuth(client.Options{
+		Credentials: &c.Credentials,
+		RootURL:     c.RootURL,
+		BaseURL:     c.AuthBaseURL,
+	})
+	// Tag all reports with the engine, as it's part of error fingerprints
+	monitor := monitoring.New(c.Monitor, a).WithTag("engine", c.Engine)
 
 	// Create worker
 	w = &Worker{
 		monitor:          monitor.WithPrefix("worker"),
 		garbageCollector: gc.New(c.TemporaryFolder, c.MinimumDiskSpace, c.MinimumMemory),
+		collectGarbage:   c.MinimumDiskSpace > 0 || c.MinimumMemory > 0,
+		rootURL:          c.RootURL,
 		queueBaseURL:     c.QueueBaseURL,
 		options:          c.WorkerOptions,
+		quarantine:       circuitBreaker{threshold: c.WorkerOptions.QuarantineThreshold},
+		hostHealth:       circuitBreaker{threshold: c.WorkerOptions.HostVerification.Threshold},
+		recentTaskGroups: recentTaskGroups{size: c.WorkerOptions.TaskGroupAffinity},
 	}
 
 	w.monitor.Info("starting up")
 
+	// Never leak the worker credentials in task logs
+	w.logSecrets = []string{c.Credentials.AccessToken}
+
 	// Create queue client that is aborted when life-cycle ends
 	w.queue = w.newQueueClient(&lifeCycleContext{
 		LifeCycle: &w.lifeCycleTracker,
 	}, &c.Credentials)
 
+	// Create secrets client for reading the kill-switch
+	if c.WorkerOptions.KillSwitch != nil {
+		w.secrets = client.NewSecrets(client.Options{
+			Credentials: &c.Credentials,
+			RootURL:     c.RootURL,
+		})
+	}
+
 	// Create temporary storage
 	w.temporaryStorage, err = runtime.NewTemporaryStorage(c.TemporaryFolder)
 	if err != nil {
@@ -81,6 +127,46 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
+	// Let the garbage collector remove files left behind by a previous worker
+	leftovers, err := runtime.TemporaryLeftovers(c.TemporaryFolder)
+	if err != nil {
+		w.monitor.ReportError(err, "worker.New() failed to find leftovers in TemporaryStorage")
+		err = runtime.ErrFatalInternalError
+		return
+	}
+	if leftovers != nil {
+		w.garbageCollector.Register(leftovers)
+	}
+
+	// Select storage for task logs exceeding memoryLogSize
+	w.logStorage = runtime.FileLogStorage
+	if c.WorkerOptions.LogStorage == "memory" {
+		size := c.WorkerOptions.LogStorageSize
+		if size == 0 {
+			size = runtime.DefaultMemoryLogStorageSize
+		}
+		w.logStorage = runtime.NewMemoryLogStorage(size)
+	}
+
+	// Create content store, and remove content no longer in use
+	var store *cas.Store
+	if c.ContentStore != "" {
+		store, err = cas.New(c.ContentStore)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create content store")
+		}
+		freed, cerr := store.Collect()
+		if cerr != nil {
+			w.monitor.ReportWarning(cerr, "failed to collect unused content from content store")
+		}
+		w.monitor.Infof("content store: removed %d bytes of unused content", freed)
+	}
+
+	// Verify critical host files against expected hashes, so we can detect
+	// tampering, this is repeated after each task
+	w.integrity.Expect(c.WorkerOptions.IntegrityCheck)
+	w.verifyIntegrity()
+
 	// Create webhookserver
 	if c.WebHookServer != nil {
 		w.webhookserver, err = webhookserver.NewServer(c.WebHookServer, &c.Credentials)
@@ -91,7 +177,21 @@ func New(config interface{}) (w *Worker, err error) {
 		}
 	}
 
+	// Post task events to webhooks, if configured
+	var onArtifactCreated func(ctx *runtime.TaskContext, name string)
+	if c.WorkerOptions.EventWebhooks != nil && len(c.WorkerOptions.EventWebhooks.URLs) > 0 {
+		w.events = newEventPublisher(*c.WorkerOptions.EventWebhooks, monitor.WithPrefix("event-webhooks"))
+		onArtifactCreated = func(ctx *runtime.TaskContext, name string) {
+			event := w.newTaskEvent(eventArtifactUploaded, ctx.TaskID, ctx.RunID)
+			event.Artifact = name
+			w.events.Publish(event)
+		}
+	}
+
 	// Create environment
+	w.operations = runtime.NewOperationTracker()
+	w.metrics = metrics.NewRegistry()
+	w.stats = newWorkerMetrics(w.metrics)
 	w.environment = runtime.Environment{
 		Monitor:          monitor,
 		GarbageCollector: w.garbageCollector,
@@ -102,6 +202,20 @@ func New(config interface{}) (w *Worker, err error) {
 		WorkerID:         c.WorkerOptions.WorkerID,
 		ProvisionerID:    c.WorkerOptions.ProvisionerID,
 		WorkerType:       c.WorkerOptions.WorkerType,
+		RootURL:          c.RootURL,
+		QueueBaseURL:     c.QueueBaseURL,
+		Engine:           c.Engine,
+		ArtifactUploader: runtime.NewArtifactUploader(runtime.ArtifactUploaderOptions{
+			Monitor:           monitor.WithPrefix("artifact-uploader"),
+			ConcurrentUploads: c.WorkerOptions.ConcurrentUploads,
+			MaxBandwidth:      c.WorkerOptions.MaxUploadBandwidth * 1024,
+			Operations:        w.operations,
+			OnCreated:         onArtifactCreated,
+			Metrics:           w.metrics,
+		}),
+		ContentStore: store,
+		Operations:   w.operations,
+		Metrics:      w.metrics,
 	}
 
 	// Create engine
@@ -120,6 +234,37 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
+	// Check that the host can run tasks, before we claim anything
+	if err = w.engine.PreflightCheck(); err != nil {
+		w.monitor.ReportError(err, "worker.New() engine preflight check failed")
+		w.engine.Dispose()
+		err = errors.Wrapf(err, "engine '%s' preflight check failed", c.Engine)
+		return
+	}
+
+	// Insecure engines are for development, don't claim tasks from real queues
+	if w.engine.Capabilities().Insecure {
+		if !isLocalURL(w.queueURL()) {
+			w.engine.Dispose()
+			err = fmt.Errorf(
+				"engine '%s' doesn't isolate tasks from the host, refusing to claim tasks from "+
+					"queue at '%s', use a queue on the local machine such as 'taskcluster-worker fake-queue'",
+				c.Engine, w.queueURL(),
+			)
+			return
+		}
+		w.monitor.Warnf("engine '%s' is INSECURE, tasks are not isolated from the host", c.Engine)
+	}
+
+	// Don't claim more tasks than the engine can run in parallel
+	if max := w.engine.Capabilities().MaxConcurrency; max > 0 && w.options.Concurrency > max {
+		w.monitor.Warnf(
+			"worker.concurrency: %d exceeds the maximum concurrency of engine '%s', using %d",
+			w.options.Concurrency, c.Engine, max,
+		)
+		w.options.Concurrency = max
+	}
+
 	// Create plugin manager
 	w.plugin, err = plugins.NewPluginManager(plugins.PluginOptions{
 		Environment: &w.environment,
@@ -133,10 +278,15 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
-	// Check payload schema conflicts
-	_, err = schematypes.Merge(
+	// Merge payload schemas, this also checks for conflicts, the merged schema
+	// is reused for all tasks
+	var migrations []runtime.PayloadMigration
+	migrations = append(migrations, w.engine.PayloadMigrations()...)
+	migrations = append(migrations, w.plugin.PayloadMigrations()...)
+	w.payloadSchema, err = schematypes.Merge(
 		w.engine.PayloadSchema(),
 		w.plugin.PayloadSchema(),
+		runtime.PayloadVersionSchema(runtime.CurrentPayloadVersion(migrations)),
 	)
 	if err != nil {
 		w.monitor.ReportError(err, "worker.New() detected payload schema conflict between engine and plugin")
@@ -144,20 +294,36 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
+	// Validate self-test payload against the engine payload schema
+	if w.options.SelfTest != nil {
+		err = w.engine.PayloadSchema().Validate(w.options.SelfTest.Payload)
+		if err != nil {
+			err = errors.Wrap(err, "worker.selfTest.payload doesn't satisfy the engine payload schema")
+			return
+		}
+	}
+
+	w.logHeader = newLogHeader(c, w.plugin.PluginNames())
+
+	if c.WorkerOptions.ReplayBundles != nil {
+		w.replayBundle = &taskrun.ReplayBundleOptions{
+			Folder:       c.WorkerOptions.ReplayBundles.Folder,
+			Upload:       c.WorkerOptions.ReplayBundles.Upload,
+			Engine:       c.Engine,
+			EngineConfig: c.EngineConfig[c.Engine],
+		}
+	}
+
 	return
 }
 
 // PayloadSchema returns the schema for task.payload
 func (w *Worker) PayloadSchema() schematypes.Schema {
-	payloadSchema, err := schematypes.Merge(
-		w.engine.PayloadSchema(),
-		w.plugin.PayloadSchema(),
-	)
-	if err != nil {
-		// this should never happen, we try to do the above in New()
-		panic(fmt.Sprintf(
-			"Conflicting plugin and engine payload properties, error: %s", err,
-		))
+	// Copy properties, so we don't modify the schema shared with TaskRuns
+	payloadSchema := w.payloadSchema
+	payloadSchema.Properties = schematypes.Properties{}
+	for name, schema := range w.payloadSchema.Properties {
+		payloadSchema.Properties[name] = schema
 	}
 	// Adding supersederUrl to payload schema
 	// NOTE: This can be removed when someday superseding is implemented in the queue
@@ -203,43 +369,110 @@ func (w *Worker) Start() error {
 		}
 	}()
 
+	// Start admin endpoint, failing to do so shouldn't stop the worker
+	if err := w.serveAdmin(done); err != nil {
+		w.monitor.ReportError(err, "failed to start admin endpoint")
+	}
+
+	// Measure clock skew against the queue, so reclaims and deadlines can be
+	// adjusted if the local clock is off
+	go w.monitorClockSkew(done)
+
+	// Stop the worker, if the host is about to be terminated
+	go w.watchTermination(done)
+
+	// Stop claiming tasks while paused by the kill-switch
+	go w.watchKillSwitch(done)
+
+	queues := w.options.queues()
+	var lastSelfTest time.Time
+	emptyPolls := 0 // consecutive polls returning no tasks
 	for !w.lifeCycleTracker.StoppingGracefully.IsDone() {
-		// Claim tasks
-		N := w.options.Concurrency - w.activeTasks.Value()
-		debug("queue.claimWork(%s, %s) with capacity: %d", w.options.ProvisionerID, w.options.WorkerType, N)
-		claims, err := w.queue.ClaimWork(w.options.ProvisionerID, w.options.WorkerType, &queue.ClaimWorkRequest{
-			WorkerGroup: w.options.WorkerGroup,
-			WorkerID:    w.options.WorkerID,
-			Tasks:       N,
-		})
-		if err == context.Canceled {
-			break // if canceled we stop gracefully
+		// Run self-test if due, this takes up capacity like a task would
+		if w.selfTestDue(lastSelfTest) && w.activeTasks.Value() < w.options.Concurrency {
+			lastSelfTest = time.Now()
+			w.activeTasks.Increment()
+			go w.runSelfTest()
 		}
-		if err != nil {
-			w.monitor.ReportError(err, "failed to ClaimWork")
-			w.plugin.ReportNonFatalError()
+
+		// Free disk space and memory from cached resources, before claiming tasks.
+		// Without limits the garbage collector disposes all unused resources, so
+		// we only collect if limits are configured.
+		if w.collectGarbage && w.claimCapacity() > 0 {
+			if err := w.garbageCollector.Collect(); err != nil {
+				w.monitor.ReportWarning(err, "garbage collection failed")
+			}
 		}
 
-		// If we have claims we MUST always handle, even if we have stopNow!
-		if claims != nil {
-			for _, claim := range claims.Tasks {
-				// Start processing tasks
-				debug("starting to process task: %s/%d", claim.Status.TaskID, claim.RunID)
-				w.activeTasks.Increment()
-				go w.processClaim(claim)
+		// Claim pending tasks from recently executed task groups first, as these
+		// are likely to benefit from warm caches and images
+		var claimed []taskClaim
+		if N := w.claimCapacity(); N > 0 && w.canClaim() {
+			claimed = w.claimFromRecentTaskGroups(N)
+		}
+
+		// Claim tasks from each queue, until we have no more capacity
+		canceled := false
+		polled := false
+		for _, q := range weightedOrder(queues) {
+			N := w.claimCapacity() - len(claimed)
+			if N <= 0 || !w.canClaim() {
+				break
+			}
+			debug("queue.claimWork(%s, %s) with capacity: %d", q.ProvisionerID, q.WorkerType, N)
+			polled = true
+			pollStarted := time.Now()
+			claims, err := w.queue.ClaimWork(q.ProvisionerID, q.WorkerType, &queue.ClaimWorkRequest{
+				WorkerGroup: w.options.WorkerGroup,
+				WorkerID:    w.options.WorkerID,
+				Tasks:       N,
+			})
+			w.stats.pollLatency.Observe(time.Since(pollStarted).Seconds())
+			if err == context.Canceled {
+				canceled = true
+				break // if canceled we stop gracefully
+			}
+			if err != nil {
+				w.monitor.ReportError(err, "failed to ClaimWork")
+				w.plugin.ReportNonFatalError()
+			}
+
+			if claims != nil {
+				for _, claim := range claims.Tasks {
+					claimed = append(claimed, taskClaim(claim))
+				}
 			}
 		}
 
+		// If we have claims we MUST always handle, even if we have stopNow!
+		// Queue claims and start the most urgent tasks first, as capacity allows.
+		w.stats.tasksClaimed.Add(float64(len(claimed)))
+		w.enqueueClaims(claimed)
+		w.startQueuedClaims()
+		if canceled {
+			break
+		}
+
 		// If we received zero claims or encountered an error, we wait at-least
-		// pollingInterval before polling again. We start the timer here, so it's
-		// counting while we wait for capacity to be available.
+		// pollingInterval before polling again, backing off up to
+		// maxPollingInterval if polls repeatedly return nothing. We start the
+		// timer here, so it's counting while we wait for capacity to be available.
+		if len(claimed) > 0 {
+			emptyPolls = 0
+		} else if polled {
+			emptyPolls++
+		}
 		var delay <-chan time.Time
-		if claims == nil || len(claims.Tasks) == 0 {
-			delay = time.After(time.Duration(w.options.PollingInterval) * time.Second)
+		if len(claimed) == 0 && w.queued.Len() == 0 {
+			delay = time.After(pollingDelay(
+				time.Duration(w.options.PollingInterval)*time.Second,
+				time.Duration(w.options.MaxPollingInterval)*time.Second,
+				emptyPolls,
+			))
 		} else {
-			// If we received a task from the claimWork request then we don't have to
-			// sleep before polling again. But we do have to wait for activeTasks to
-			// drop below maximum allowed concurrency.
+			// If we received a task from the claimWork request, or have queued tasks
+			// then we don't have to sleep before polling again. But we do have to
+			// wait for activeTasks to drop below maximum allowed concurrency.
 			delay = time.After(0)
 		}
 
@@ -261,9 +494,17 @@ func (w *Worker) Start() error {
 		}
 	}
 
+	// Start queued tasks as capacity becomes available, these were claimed, so
+	// they must be processed, if stopNow happens they will be resolved quickly.
+	for w.queued.Len() > 0 {
+		w.activeTasks.WaitForLessThan(w.options.Concurrency)
+		w.startQueuedClaims()
+	}
+
 	// Wait for tasks to be done, or stopNow happens
 	debug("waiting for active tasks to be resolved")
 	w.activeTasks.WaitForIdle()
+	w.markDrained()
 
 	// free resources when done running
 	w.dispose()
@@ -292,19 +533,46 @@ type taskClaim struct {
 
 // Utility function to create a queue client object
 func (w *Worker) newQueueClient(ctx context.Context, creds *tcclient.Credentials) client.Queue {
-	q := queue.New(creds)
+	return client.NewQueue(client.Options{
+		Credentials: creds,
+		RootURL:     w.rootURL,
+		BaseURL:     w.queueBaseURL,
+		Context:     ctx,
+	})
+}
+
+// queueURL returns the base URL for the queue API
+func (w *Worker) queueURL() string {
 	if w.queueBaseURL != "" {
-		q.BaseURL = w.queueBaseURL
+		return w.queueBaseURL
 	}
-	if ctx != nil {
-		q.Context = ctx
+	return client.ServiceURL(w.rootURL, "queue", "v1")
+}
+
+// isLocalURL returns true, if the host of u is a loopback address or localhost
+func isLocalURL(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
 	}
-	return q
+	host := parsed.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// claimCapacity returns the number of tasks that can be claimed, this includes
+// tasks claimed ahead of capacity to run them, see the 'claimAhead' option.
+func (w *Worker) claimCapacity() int {
+	return w.options.Concurrency + w.options.ClaimAhead - w.activeTasks.Value() - w.queued.Len()
 }
 
-// reclaimDelay returns the delay before reclaiming given takenUntil
+// reclaimDelay returns the delay before reclaiming given takenUntil, which is
+// in queue time and hence adjusted for clock skew.
 func (w *Worker) reclaimDelay(takenUntil time.Time) time.Duration {
-	delay := time.Until(takenUntil) - time.Duration(w.options.ReclaimOffset)*time.Second
+	delay := takenUntil.Sub(w.queueNow()) - time.Duration(w.options.ReclaimOffset)*time.Second
 	// Never delay less than MinimumReclaimDelay
 	if delay < time.Duration(w.options.MinimumReclaimDelay)*time.Second {
 		return time.Duration(w.options.MinimumReclaimDelay) * time.Second
@@ -318,6 +586,10 @@ func (w *Worker) reclaimDelay(takenUntil time.Time) time.Duration {
 func (w *Worker) processClaim(claim taskClaim) {
 	// Decrement number of active tasks when we're done processing the task
 	defer w.activeTasks.Decrement()
+	claimed := time.Now()
+
+	// Remember the task group, so we can prefer claiming tasks from it
+	w.recentTaskGroups.Add(claim.Task.TaskGroupID)
 
 	// If superseding is enabled, find superseding if one is available
 	// NOTE: This can be removed when superseding is implemented in the queue
@@ -345,7 +617,7 @@ func (w *Worker) processClaim(claim taskClaim) {
 	// Convert task definition to interface{} form
 	var jsontask interface{}
 	rawTask, _ := json.Marshal(claim.Task)
-	_ = json.Unmarshal(rawTask, jsontask)
+	_ = json.Unmarshal(rawTask, &jsontask)
 
 	// Create a taskrun
 	var payload map[string]interface{}
@@ -359,14 +631,34 @@ func (w *Worker) processClaim(claim taskClaim) {
 		Monitor:       monitor.WithPrefix("taskrun"),
 		Queue:         q,
 		Payload:       payload,
+		LogHeader:     w.taskLogHeader(time.Now()),
+		Secrets:       w.logSecrets,
+		// Let the queue retry tasks failing from infrastructure errors
+		AllowIntermittent: claim.Status.RetriesLeft > 0,
+		MemoryLogSize:     w.options.MemoryLogSize,
+		LogStorage:        w.logStorage,
+		DiskQuota:         w.options.TaskDiskQuota,
+		PayloadTemplating: w.options.PayloadTemplating,
+		PayloadSchema:     w.payloadSchema,
+		ReplayBundle:      w.replayBundle,
 		TaskInfo: runtime.TaskInfo{
-			TaskID:   claim.Status.TaskID,
-			RunID:    claim.RunID,
-			Created:  time.Time(claim.Task.Created),
-			Deadline: time.Time(claim.Task.Deadline),
-			Expires:  time.Time(claim.Task.Expires),
-			Scopes:   claim.Task.Scopes,
-			Task:     jsontask,
+			TaskID:        claim.Status.TaskID,
+			RunID:         claim.RunID,
+			ProvisionerID: claim.Task.ProvisionerID,
+			WorkerType:    claim.Task.WorkerType,
+			Created:       time.Time(claim.Task.Created),
+			Deadline:      time.Time(claim.Task.Deadline),
+			Expires:       time.Time(claim.Task.Expires),
+			ClockSkew:     w.clockSkew.Offset(),
+			Scopes:        claim.Task.Scopes,
+			Routes:        claim.Task.Routes,
+			Metadata: runtime.TaskMetadata{
+				Name:        claim.Task.Metadata.Name,
+				Description: claim.Task.Metadata.Description,
+				Owner:       claim.Task.Metadata.Owner,
+				Source:      claim.Task.Metadata.Source,
+			},
+			Task: jsontask,
 		},
 	})
 	run.SetCredentials(
@@ -374,6 +666,8 @@ func (w *Worker) processClaim(claim taskClaim) {
 		claim.Credentials.AccessToken,
 		claim.Credentials.Certificate,
 	)
+	run.SetTakenUntil(time.Time(claim.TakenUntil))
+	w.events.Publish(w.newTaskEvent(eventTaskStarted, claim.Status.TaskID, claim.RunID))
 
 	// runId as string for use in requests
 	runID := strconv.Itoa(claim.RunID)
@@ -404,6 +698,14 @@ func (w *Worker) processClaim(claim taskClaim) {
 					return
 				}
 				monitor.ReportWarning(err, "failed to reclaim task")
+				// If takenUntil has passed the claim has expired, so the queue will
+				// resolve the run claim-expired and there is no point in continuing.
+				if !w.queueNow().Before(takenUntil) {
+					monitor.Count("claim-expired", 1)
+					monitor.Warnf("claim expired at %s, aborting task", takenUntil)
+					run.Abort(taskrun.ClaimExpired)
+					return
+				}
 				continue // Maybe we'll have more luck next time
 			}
 
@@ -416,11 +718,13 @@ func (w *Worker) processClaim(claim taskClaim) {
 				result.Credentials.AccessToken,
 				result.Credentials.Certificate,
 			)
+			run.SetTakenUntil(takenUntil)
 		}
 	}()
 
 	// Wait for taskrun to finish
 	success, exception, reason := run.WaitForResult()
+	w.recordOutcome(exception && reason == runtime.ReasonInternalError)
 
 	// Stop reclaiming
 	close(stopReclaiming)
@@ -432,7 +736,8 @@ func (w *Worker) processClaim(claim taskClaim) {
 	debug("reporting task %s/%d resolved", claim.Status.TaskID, claim.RunID)
 	var err error
 	if exception {
-		if reason != runtime.ReasonCanceled {
+		// Canceled runs and expired claims are resolved by the queue
+		if reason != runtime.ReasonCanceled && reason != runtime.ReasonClaimExpired {
 			_, err = q.ReportException(claim.Status.TaskID, runID, &queue.TaskExceptionRequest{
 				Reason: reason.String(),
 			})
@@ -452,20 +757,41 @@ func (w *Worker) processClaim(claim taskClaim) {
 		monitor.ReportError(err, "failed to report task resolution")
 		w.plugin.ReportNonFatalError() // This is bad, but no need for it to be fatal
 	}
+	event := w.newTaskEvent(eventTaskResolved, claim.Status.TaskID, claim.RunID)
+	switch {
+	case exception:
+		event.Resolution = "exception"
+		event.Reason = reason.String()
+	case success:
+		event.Resolution = "completed"
+	default:
+		event.Resolution = "failed"
+	}
+	w.events.Publish(event)
+	outcome := event.Resolution
+	if exception {
+		outcome = event.Reason
+	}
+	w.stats.tasksResolved.Inc(outcome)
+	w.stats.taskDuration.Observe(time.Since(claimed).Seconds(), outcome)
 
 	// Dispose all resources
 	err = run.Dispose()
-	if err == runtime.ErrNonFatalInternalError {
+	if fatal, ok := runtime.IsInternalError(err); ok && !fatal {
 		// Count it, but otherwise ignore
 		w.plugin.ReportNonFatalError()
 	} else if err != nil {
-		if err != runtime.ErrFatalInternalError {
+		if !ok {
 			// This is now allowed, but let's be defensive here
 			monitor.ReportError(err, "TaskRun.Dispose() returned unhandled error")
 		}
 		monitor.Error("fatal error from TaskRun.Dispose() stopping now")
 		w.StopNow()
 	}
+
+	// Verify the host and integrity of host files before capacity is released
+	w.verifyHost()
+	w.verifyIntegrity()
 }
 
 // superseding returns any superseding task, and a function to be called when
@@ -555,6 +881,7 @@ func (w *Worker) superseding(claim taskClaim) (taskClaim, func()) {
 	// Take the last claim we have, as the task we run
 	claim = claims[len(claims)-1]
 	claims = claims[:len(claims)-1]
+	supersededBy := claim.Status.TaskID
 
 	// Start a reclaiming loop, and finish off by resolving superseded
 	var stopReclaiming atomics.Once
@@ -583,8 +910,14 @@ func (w *Worker) superseding(claim taskClaim) (taskClaim, func()) {
 			case <-stopReclaiming.Done():
 				// resolve claims[i] as superseded
 				q := w.newQueueClient(ctx, asClientCredentials(claims[i].Credentials))
-				// TODO: Upload artifacts
-				_, qerr := q.ReportException(taskID, runID, &queue.TaskExceptionRequest{
+				qerr := w.createSupersededByArtifact(q, claims[i], supersededBy)
+				if qerr != nil {
+					m.WithTags(map[string]string{
+						"taskId": taskID,
+						"runId":  runID,
+					}).Warnf("failed to create %s artifact, error: %v", supersededByArtifactName, qerr)
+				}
+				_, qerr = q.ReportException(taskID, runID, &queue.TaskExceptionRequest{
 					Reason: "superseded",
 				})
 				if qerr != nil {
@@ -629,6 +962,27 @@ func (w *Worker) superseding(claim taskClaim) (taskClaim, func()) {
 	}
 }
 
+// supersededByArtifactName is the name of the artifact created for tasks
+// resolved superseded, redirecting to the task that superseded them.
+const supersededByArtifactName = "public/superseded-by"
+
+// createSupersededByArtifact creates a reference artifact for claim pointing
+// to the task definition of the task with taskID supersededBy.
+func (w *Worker) createSupersededByArtifact(q client.Queue, claim taskClaim, supersededBy string) error {
+	req, err := json.Marshal(queue.RedirectArtifactRequest{
+		ContentType: "application/json",
+		Expires:     claim.Task.Expires,
+		StorageType: "reference",
+		URL:         w.queueURL() + "/task/" + supersededBy,
+	})
+	if err != nil {
+		panic(errors.Wrap(err, "failed to serialize data we know to be JSON"))
+	}
+	par := queue.PostArtifactRequest(req)
+	_, err = q.CreateArtifact(claim.Status.TaskID, strconv.Itoa(claim.RunID), supersededByArtifactName, &par)
+	return err
+}
+
 func asClientCredentials(c struct {
 	AccessToken string `json:"accessToken"`
 	Certificate string `json:"certificate"`
@@ -653,10 +1007,37 @@ func (w *Worker) StopGracefully() {
 	w.lifeCycleTracker.StopGracefully()
 }
 
+// Maximum time to wait for in-flight operations before cancelling them, and
+// maximum time to wait for cancelled operations, during shutdown.
+const (
+	operationsTimeout       = 5 * time.Minute
+	operationsCancelTimeout = 30 * time.Second
+)
+
+// awaitOperations waits for in-flight operations to finish, returns false, if
+// operations are still in-flight after timeout.
+func (w *Worker) awaitOperations(timeout time.Duration) bool {
+	if w.operations.Wait(timeout) {
+		return true
+	}
+	w.monitor.Warnf("operations still in-flight after %s: %s",
+		timeout, strings.Join(w.operations.InFlight(), ", "))
+	return false
+}
+
 // dispose all resources
 func (w *Worker) dispose() {
 	hasErr := false
 
+	// Wait for in-flight operations, so we don't delete files being written,
+	// if stopping now or operations takes too long, we cancel them.
+	if w.lifeCycleTracker.StoppingNow.IsDone() || !w.awaitOperations(operationsTimeout) {
+		w.operations.Cancel()
+		if !w.awaitOperations(operationsCancelTimeout) {
+			hasErr = true
+		}
+	}
+
 	// Collect all garbage
 	switch err := w.garbageCollector.CollectAll(); err {
 	case runtime.ErrFatalInternalError, runtime.ErrNonFatalInternalError:
@@ -692,6 +1073,9 @@ func (w *Worker) dispose() {
 		w.webhookserver.Stop()
 	}
 
+	// Deliver pending events to event webhooks
+	w.events.Close()
+
 	// Remove temporary storage
 	switch err := w.temporaryStorage.Remove(); err {
 	case runtime.ErrFatalInternalError, runtime.ErrNonFatalInternalError:
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http/httptest"
 	"os"
@@ -327,6 +328,56 @@ func TestWorkerTaskCanceled(t *testing.T) {
 	}, nil)
 }
 
+func TestWorkerClaimExpired(t *testing.T) {
+	// Set mock queue, server and worker
+	q := client.MockQueue{}
+	s := httptest.NewServer(&q)
+	defer s.Close()
+	defer q.AssertExpectations(t)
+	w := setupTestWorker(t, s.URL, 1)
+
+	// Model the queue
+
+	// return 1 task, once
+	q.On("ClaimWork", "test-provisioner-id", "test-worker-type", mock.Anything).Once().Return(&queue.ClaimWorkResponse{
+		Tasks: append(queue.ClaimWorkResponse{}.Tasks, taskClaim{
+			Status:     queue.TaskStatusStructure{TaskID: "my-task-id-1"},
+			RunID:      0,
+			TakenUntil: tcclient.Time(time.Now().Add(100 * time.Millisecond)),
+			Task: queue.TaskDefinitionResponse{
+				Payload: json.RawMessage(`{
+					"delay": 2500,
+					"function": "true",
+					"argument": ""
+				}`),
+			},
+		}),
+	}, nil)
+	// reclaiming fails after takenUntil, so the task must be aborted without
+	// being reported, as the queue resolves it claim-expired
+	q.On("ReclaimTask", "my-task-id-1", "0").Once().Return((*queue.TaskReclaimResponse)(nil), httpbackoff.BadHttpResponseCode{
+		HttpResponseCode: 401,
+		Message:          "credentials expired",
+	})
+
+	// return no tasks forever, and stop gracefully
+	q.On("ClaimWork", "test-provisioner-id", "test-worker-type", mock.Anything).Run(func(mock.Arguments) {
+		w.StopGracefully()
+	}).Return(&queue.ClaimWorkResponse{
+		Tasks: append(queue.ClaimWorkResponse{}.Tasks),
+	}, nil)
+
+	require.NoError(t, w.Start())
+
+	// The task was aborted, and the resolution wasn't reported
+	var b bytes.Buffer
+	require.NoError(t, w.metrics.Collect(&b))
+	require.Contains(t, b.String(), `taskcluster_worker_tasks_resolved_total{outcome="claim-expired"} 1`)
+	for _, call := range q.Calls {
+		require.NotContains(t, []string{"ReportException", "ReportCompleted", "ReportFailed"}, call.Method)
+	}
+}
+
 func TestWorkerStopNow(t *testing.T) {
 	// Set mock queue, server and worker
 	q := client.MockQueue{}
@@ -366,3 +417,12 @@ func TestWorkerStopNow(t *testing.T) {
 		Reason: "worker-shutdown",
 	}).Once().Return(&queue.TaskStatusResponse{}, nil)
 }
+
+func TestIsLocalURL(t *testing.T) {
+	require.True(t, isLocalURL("http://localhost:8080/v1"))
+	require.True(t, isLocalURL("http://127.0.0.1:8080"))
+	require.True(t, isLocalURL("http://[::1]:8080/"))
+	require.False(t, isLocalURL("https://queue.taskcluster.net/v1"))
+	require.False(t, isLocalURL("http://10.0.0.1/"))
+	require.False(t, isLocalURL("not a url\x00"))
+}
@@ -1,12 +1,17 @@
 package fakequeue
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,7 +22,7 @@ import (
 
 // FakeQueue is a taskcluster-queue implementation with certain limitations:
 //  * No validation of authentication or authenorization
-//  * Data stored in-memory
+//  * Data stored in-memory, artifacts may also be written to a folder
 // The FakeQueue supports the following end-points:
 //  * task
 //  * status
@@ -35,9 +40,10 @@ import (
 //  * listLatestArtifact
 //  * pendingTasks
 type FakeQueue struct {
-	m     sync.Mutex
-	c     sync.Cond
-	tasks map[string]*task
+	m              sync.Mutex
+	c              sync.Cond
+	tasks          map[string]*task
+	artifactFolder string // folder to write artifacts to, empty if none
 }
 
 // New returns a new FakeQueue
@@ -45,6 +51,13 @@ func New() *FakeQueue {
 	return &FakeQueue{}
 }
 
+// NewWithArtifactFolder returns a new FakeQueue which also writes uploaded
+// artifacts to folder as '<taskId>/<runId>/<name>'. This is useful for
+// inspecting the output when running the worker against a FakeQueue locally.
+func NewWithArtifactFolder(folder string) *FakeQueue {
+	return &FakeQueue{artifactFolder: folder}
+}
+
 type task struct {
 	status    queue.TaskStatusStructure
 	task      queue.TaskDefinitionResponse
@@ -545,11 +558,46 @@ func (q *FakeQueue) internalPutArtifact(taskID string, runID int, name string, p
 	a.ContentEncoding = r.Header.Get("Content-Encoding")
 	t.artifacts[runID][name] = a
 
+	if q.artifactFolder != "" {
+		if err := q.writeArtifact(taskID, runID, name, a); err != nil {
+			debug("failed to write artifact to folder, error: %s", err)
+			return restError{
+				StatusCode: http.StatusInternalServerError,
+				Code:       "InternalServerError",
+				Message:    fmt.Sprintf("Failed to write artifact to folder, error: %s", err),
+			}
+		}
+	}
+
 	return map[string]interface{}{
 		"upload": "OK",
 	}
 }
 
+// writeArtifact writes artifact data to artifactFolder, decompressing it if
+// uploaded with gzip content-encoding.
+func (q *FakeQueue) writeArtifact(taskID string, runID int, name string, a artifact) error {
+	folder := filepath.Join(q.artifactFolder, taskID, strconv.Itoa(runID))
+	target := filepath.Join(folder, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, folder+string(filepath.Separator)) {
+		return fmt.Errorf("artifact name '%s' is not a relative path", name)
+	}
+	data := a.Data
+	if a.ContentEncoding == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(target, data, 0666)
+}
+
 func (q *FakeQueue) getArtifact(taskID string, runID int, name string) interface{} {
 	// Find task
 	t, ok := q.tasks[taskID]
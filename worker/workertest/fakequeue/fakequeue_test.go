@@ -1,12 +1,19 @@
 package fakequeue
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/taskcluster/slugid-go/slugid"
 	tcclient "github.com/taskcluster/taskcluster-client-go"
 	"github.com/taskcluster/taskcluster-client-go/queue"
@@ -126,3 +133,64 @@ func TestFakeQueueWithClaimTask(t *testing.T) {
 	assert.NoError(t, err, "failed to get tasks status")
 	assert.True(t, status.Status.State == "completed", "Expected task to be completed")
 }
+
+func TestFakeQueueArtifactFolder(t *testing.T) {
+	folder, err := ioutil.TempDir("", "fakequeue-artifacts-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	s := httptest.NewServer(NewWithArtifactFolder(folder))
+	defer s.Close()
+
+	q := queue.New(&tcclient.Credentials{})
+	q.BaseURL = s.URL
+
+	debug("### Creating and claiming task")
+	taskID := slugid.Nice()
+	task := queue.TaskDefinitionRequest{
+		ProvisionerID: testProvisionerID,
+		WorkerType:    testWorkerType,
+		Created:       tcclient.Time(time.Now()),
+		Deadline:      tcclient.Time(time.Now().Add(60 * time.Minute)),
+		Payload:       json.RawMessage(`{}`),
+	}
+	task.Metadata.Name = "test task"
+	task.Metadata.Description = "Test that artifacts are written to folder"
+	task.Metadata.Source = "https://github.com/taskcluster/taskcluster-worker/tree/master/worker/workertest/fakequeue/fakequeue_test.go"
+	task.Metadata.Owner = "jonasfj@mozilla.com"
+	_, err = q.CreateTask(taskID, &task)
+	require.NoError(t, err, "failed to create task")
+	_, err = q.ClaimTask(taskID, "0", &queue.TaskClaimRequest{
+		WorkerGroup: "test-worker-group",
+		WorkerID:    "test-worker-42",
+	})
+	require.NoError(t, err, "failed to claim task")
+
+	debug("### Upload gzipped artifact")
+	req := queue.PostArtifactRequest(`{
+		"storageType": "s3",
+		"contentType": "text/plain",
+		"expires": "` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"
+	}`)
+	res, err := q.CreateArtifact(taskID, "0", "public/logs/hello.log", &req)
+	require.NoError(t, err, "failed to create artifact")
+	var s3 queue.S3ArtifactResponse
+	require.NoError(t, json.Unmarshal(*res, &s3))
+
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte("hello world"))
+	zw.Close()
+	put, err := http.NewRequest(http.MethodPut, s3.PutURL, &b)
+	require.NoError(t, err)
+	put.Header.Set("Content-Encoding", "gzip")
+	put.Header.Set("Content-Type", "text/plain")
+	r, err := http.DefaultClient.Do(put)
+	require.NoError(t, err, "failed to upload artifact")
+	r.Body.Close()
+	require.Equal(t, http.StatusOK, r.StatusCode)
+
+	data, err := ioutil.ReadFile(filepath.Join(folder, taskID, "0", "public", "logs", "hello.log"))
+	require.NoError(t, err, "expected artifact to be written to folder")
+	require.Equal(t, "hello world", string(data))
+}
@@ -42,6 +42,9 @@ func TestSuperseded(t *testing.T) {
 				TaskID:    slugid.Nice(),
 				Title:     "Task Superseded",
 				Exception: runtime.ReasonSuperseded,
+				Artifacts: ArtifactAssertions{
+					"public/superseded-by": ReferenceArtifact(),
+				},
 				Payload: `{
 					"supersederUrl": "` + s.URL + `",
 					"delay": 50,
@@ -70,8 +70,17 @@ func TestWorkerWithEnv(t *testing.T) {
 					}
 				}`,
 				Artifacts: ArtifactAssertions{
-					"public/logs/live_backing.log": GrepArtifact("hello-world"),
-					"public/logs/live.log":         AnyArtifact(),
+					"public/logs/live_backing.log": func(t *testing.T, a Artifact) {
+						GrepArtifact("hello-world")(t, a)
+						GrepArtifact("engine: mock")(t, a)
+						GrepArtifact("plugins: env, livelog, success")(t, a)
+						GrepArtifact("[taskcluster:section-start:setup]")(t, a)
+						GrepArtifact("[taskcluster:section-end:setup]")(t, a)
+						GrepArtifact("[taskcluster:section-start:execution]")(t, a)
+						GrepArtifact("[taskcluster:section-end:teardown]")(t, a)
+						GrepArtifact("[taskcluster:timing] execution:")(t, a)
+					},
+					"public/logs/live.log": AnyArtifact(),
 				},
 			}, {
 				Title:   "Print Static Env Var",
@@ -119,3 +128,32 @@ func TestWorkerMalformedPayload(t *testing.T) {
 		},
 	}.Test(t)
 }
+
+func TestWorkerInternalErrorDiagnostics(t *testing.T) {
+	Case{
+		Engine:       "mock",
+		Concurrency:  1,
+		EngineConfig: `{}`,
+		PluginConfig: `{
+			"disabled": [],
+			"success": {},
+			"livelog": {}
+		}`,
+		Tasks: []Task{
+			{
+				Title:     "Task Internal Error",
+				Exception: runtime.ReasonInternalError,
+				Payload: `{
+					"delay": 50,
+					"function": "diagnostic-internal-error",
+					"argument": "image download failed"
+				}`,
+				Artifacts: ArtifactAssertions{
+					"public/logs/worker.txt":       GrepArtifact("image download failed"),
+					"public/logs/live_backing.log": NotGrepArtifact("image download failed"),
+					"public/logs/live.log":         AnyArtifact(),
+				},
+			},
+		},
+	}.Test(t)
+}